@@ -0,0 +1,226 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package arch
+
+import (
+	"fmt"
+)
+
+// SyscallTable describes the syscalls of an architecture, as needed to
+// build seccomp filters for it.
+type SyscallTable struct {
+	// AuditArch is the AUDIT_ARCH_* value the kernel reports as the
+	// architecture of a syscall to seccomp filters.
+	AuditArch uint32
+	// Bits64 is true if the syscall arguments are 64-bit wide.
+	Bits64 bool
+	// BigEndian is true if the architecture is big-endian.
+	BigEndian bool
+
+	syscalls map[string]uint32
+}
+
+const (
+	auditArch64Bit  = 0x80000000
+	auditArchLittle = 0x40000000
+)
+
+var syscallTables = map[ArchitectureType]*SyscallTable{
+	"i386":    {AuditArch: 3 | auditArchLittle, syscalls: syscallsI386},
+	"amd64":   {AuditArch: 62 | auditArch64Bit | auditArchLittle, Bits64: true, syscalls: syscallsAmd64},
+	"armhf":   {AuditArch: 40 | auditArchLittle, syscalls: syscallsArmhf},
+	"arm64":   {AuditArch: 183 | auditArch64Bit | auditArchLittle, Bits64: true, syscalls: syscallsArm64},
+	"ppc64el": {AuditArch: 21 | auditArch64Bit | auditArchLittle, Bits64: true, syscalls: syscallsPpc64el},
+	"s390x":   {AuditArch: 22 | auditArch64Bit, Bits64: true, BigEndian: true, syscalls: syscallsS390x},
+	"powerpc": {AuditArch: 20, BigEndian: true, syscalls: syscallsPowerpc},
+}
+
+// compatArchitectures maps architectures to the one of the 32-bit
+// binaries they can also run.
+var compatArchitectures = map[ArchitectureType]ArchitectureType{
+	"amd64": "i386",
+	"arm64": "armhf",
+}
+
+// SyscallTableFor returns the syscall table of the given architecture.
+func SyscallTableFor(arch ArchitectureType) (*SyscallTable, error) {
+	table := syscallTables[arch]
+	if table == nil {
+		return nil, fmt.Errorf("cannot find syscalls of unsupported architecture %q", arch)
+	}
+	return table, nil
+}
+
+// CompatArchitecture returns the architecture of the 32-bit binaries the
+// given architecture can also run, or an empty string if there is none.
+func CompatArchitecture(arch ArchitectureType) ArchitectureType {
+	return compatArchitectures[arch]
+}
+
+// Syscall returns the number of the named syscall, and whether the
+// architecture has such a syscall.
+func (t *SyscallTable) Syscall(name string) (uint32, bool) {
+	nr, ok := t.syscalls[name]
+	return nr, ok
+}
+
+// SyscallArgument returns the value of the named constant that can be
+// passed as a syscall argument, e.g. AF_UNIX, and whether the constant is
+// known.
+func (t *SyscallTable) SyscallArgument(name string) (uint64, bool) {
+	value, ok := syscallArguments[name]
+	return value, ok
+}
+
+// syscallArguments are the constants that can be used in the argument
+// rules of seccomp profiles. Their values are the same on all the
+// supported architectures.
+var syscallArguments = map[string]uint64{
+	// man 2 socket - domain
+	"AF_UNIX":      1,
+	"PF_UNIX":      1,
+	"AF_LOCAL":     1,
+	"PF_LOCAL":     1,
+	"AF_INET":      2,
+	"PF_INET":      2,
+	"AF_INET6":     10,
+	"PF_INET6":     10,
+	"AF_IPX":       4,
+	"PF_IPX":       4,
+	"AF_NETLINK":   16,
+	"PF_NETLINK":   16,
+	"AF_X25":       9,
+	"PF_X25":       9,
+	"AF_AX25":      3,
+	"PF_AX25":      3,
+	"AF_ATMPVC":    8,
+	"PF_ATMPVC":    8,
+	"AF_APPLETALK": 5,
+	"PF_APPLETALK": 5,
+	"AF_PACKET":    17,
+	"PF_PACKET":    17,
+	"AF_ALG":       38,
+	"PF_ALG":       38,
+	"AF_CAN":       29,
+	"PF_CAN":       29,
+
+	// man 2 socket - type
+	"SOCK_STREAM":    1,
+	"SOCK_DGRAM":     2,
+	"SOCK_SEQPACKET": 5,
+	"SOCK_RAW":       3,
+	"SOCK_RDM":       4,
+	"SOCK_PACKET":    10,
+
+	// man 2 prctl
+	"PR_CAP_AMBIENT":              47,
+	"PR_CAP_AMBIENT_RAISE":        2,
+	"PR_CAP_AMBIENT_LOWER":        3,
+	"PR_CAP_AMBIENT_IS_SET":       1,
+	"PR_CAP_AMBIENT_CLEAR_ALL":    4,
+	"PR_CAPBSET_READ":             23,
+	"PR_CAPBSET_DROP":             24,
+	"PR_SET_CHILD_SUBREAPER":      36,
+	"PR_GET_CHILD_SUBREAPER":      37,
+	"PR_SET_DUMPABLE":             4,
+	"PR_GET_DUMPABLE":             3,
+	"PR_SET_ENDIAN":               20,
+	"PR_GET_ENDIAN":               19,
+	"PR_SET_FPEMU":                10,
+	"PR_GET_FPEMU":                9,
+	"PR_SET_FPEXC":                12,
+	"PR_GET_FPEXC":                11,
+	"PR_SET_KEEPCAPS":             8,
+	"PR_GET_KEEPCAPS":             7,
+	"PR_MCE_KILL":                 33,
+	"PR_MCE_KILL_GET":             34,
+	"PR_SET_MM":                   35,
+	"PR_SET_MM_START_CODE":        1,
+	"PR_SET_MM_END_CODE":          2,
+	"PR_SET_MM_START_DATA":        3,
+	"PR_SET_MM_END_DATA":          4,
+	"PR_SET_MM_START_STACK":       5,
+	"PR_SET_MM_START_BRK":         6,
+	"PR_SET_MM_BRK":               7,
+	"PR_SET_MM_ARG_START":         8,
+	"PR_SET_MM_ARG_END":           9,
+	"PR_SET_MM_ENV_START":         10,
+	"PR_SET_MM_ENV_END":           11,
+	"PR_SET_MM_AUXV":              12,
+	"PR_SET_MM_EXE_FILE":          13,
+	"PR_MPX_ENABLE_MANAGEMENT":    43,
+	"PR_MPX_DISABLE_MANAGEMENT":   44,
+	"PR_SET_NAME":                 15,
+	"PR_GET_NAME":                 16,
+	"PR_SET_NO_NEW_PRIVS":         38,
+	"PR_GET_NO_NEW_PRIVS":         39,
+	"PR_SET_PDEATHSIG":            1,
+	"PR_GET_PDEATHSIG":            2,
+	"PR_SET_PTRACER":              0x59616d61,
+	"PR_SET_SECCOMP":              22,
+	"PR_GET_SECCOMP":              21,
+	"PR_SET_SECUREBITS":           28,
+	"PR_GET_SECUREBITS":           27,
+	"PR_SET_THP_DISABLE":          41,
+	"PR_GET_THP_DISABLE":          42,
+	"PR_TASK_PERF_EVENTS_DISABLE": 31,
+	"PR_TASK_PERF_EVENTS_ENABLE":  32,
+	"PR_GET_TID_ADDRESS":          40,
+	"PR_SET_TIMERSLACK":           29,
+	"PR_GET_TIMERSLACK":           30,
+	"PR_SET_TIMING":               14,
+	"PR_GET_TIMING":               13,
+	"PR_SET_TSC":                  26,
+	"PR_GET_TSC":                  25,
+	"PR_SET_UNALIGN":              6,
+	"PR_GET_UNALIGN":              5,
+
+	// man 2 getpriority
+	"PRIO_PROCESS": 0,
+	"PRIO_PGRP":    1,
+	"PRIO_USER":    2,
+
+	// man 2 setns
+	"CLONE_NEWIPC":  0x8000000,
+	"CLONE_NEWNET":  0x40000000,
+	"CLONE_NEWNS":   0x20000,
+	"CLONE_NEWPID":  0x20000000,
+	"CLONE_NEWUSER": 0x10000000,
+	"CLONE_NEWUTS":  0x4000000,
+
+	// man 4 tty_ioctl
+	"TIOCSTI": 0x5412,
+
+	// man 2 quotactl (with what Linux supports)
+	"Q_SYNC":      0x800001,
+	"Q_QUOTAON":   0x800002,
+	"Q_QUOTAOFF":  0x800003,
+	"Q_GETFMT":    0x800004,
+	"Q_GETINFO":   0x800005,
+	"Q_SETINFO":   0x800006,
+	"Q_GETQUOTA":  0x800007,
+	"Q_SETQUOTA":  0x800008,
+	"Q_XQUOTAON":  0x5801,
+	"Q_XQUOTAOFF": 0x5802,
+	"Q_XGETQUOTA": 0x5803,
+	"Q_XSETQLIM":  0x5804,
+	"Q_XGETQSTAT": 0x5805,
+	"Q_XQUOTARM":  0x5806,
+}
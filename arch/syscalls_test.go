@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package arch
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SyscallsTestSuite struct{}
+
+var _ = Suite(&SyscallsTestSuite{})
+
+func (ts *SyscallsTestSuite) TestSyscallTableFor(c *C) {
+	for _, t := range []struct {
+		arch      ArchitectureType
+		auditArch uint32
+		bits64    bool
+		bigEndian bool
+		openat    uint32
+	}{
+		{"i386", 0x40000003, false, false, 295},
+		{"amd64", 0xc000003e, true, false, 257},
+		{"armhf", 0x40000028, false, false, 322},
+		{"arm64", 0xc00000b7, true, false, 56},
+		{"ppc64el", 0xc0000015, true, false, 286},
+		{"s390x", 0x80000016, true, true, 288},
+		{"powerpc", 0x14, false, true, 286},
+	} {
+		table, err := SyscallTableFor(t.arch)
+		c.Assert(err, IsNil)
+		c.Check(table.AuditArch, Equals, t.auditArch, Commentf("%s", t.arch))
+		c.Check(table.Bits64, Equals, t.bits64, Commentf("%s", t.arch))
+		c.Check(table.BigEndian, Equals, t.bigEndian, Commentf("%s", t.arch))
+		nr, ok := table.Syscall("openat")
+		c.Check(ok, Equals, true)
+		c.Check(nr, Equals, t.openat, Commentf("%s", t.arch))
+		_, ok = table.Syscall("no-such-syscall")
+		c.Check(ok, Equals, false)
+	}
+}
+
+func (ts *SyscallsTestSuite) TestSyscallTableForUnsupported(c *C) {
+	_, err := SyscallTableFor("mips")
+	c.Check(err, ErrorMatches, `cannot find syscalls of unsupported architecture "mips"`)
+}
+
+func (ts *SyscallsTestSuite) TestSyscallArchSpecific(c *C) {
+	amd64, err := SyscallTableFor("amd64")
+	c.Assert(err, IsNil)
+	armhf, err := SyscallTableFor("armhf")
+	c.Assert(err, IsNil)
+
+	// only some architectures have the old open syscall
+	_, ok := amd64.Syscall("open")
+	c.Check(ok, Equals, true)
+	arm64, err := SyscallTableFor("arm64")
+	c.Assert(err, IsNil)
+	_, ok = arm64.Syscall("open")
+	c.Check(ok, Equals, false)
+
+	// and private syscalls
+	nr, ok := armhf.Syscall("breakpoint")
+	c.Check(ok, Equals, true)
+	c.Check(nr, Equals, uint32(0x0f0001))
+	_, ok = amd64.Syscall("breakpoint")
+	c.Check(ok, Equals, false)
+}
+
+func (ts *SyscallsTestSuite) TestSyscallArgument(c *C) {
+	table, err := SyscallTableFor("amd64")
+	c.Assert(err, IsNil)
+	value, ok := table.SyscallArgument("AF_UNIX")
+	c.Check(ok, Equals, true)
+	c.Check(value, Equals, uint64(1))
+	value, ok = table.SyscallArgument("PR_SET_PTRACER")
+	c.Check(ok, Equals, true)
+	c.Check(value, Equals, uint64(0x59616d61))
+	_, ok = table.SyscallArgument("AF_UNKNOWN")
+	c.Check(ok, Equals, false)
+}
+
+func (ts *SyscallsTestSuite) TestCompatArchitecture(c *C) {
+	c.Check(CompatArchitecture("amd64"), Equals, ArchitectureType("i386"))
+	c.Check(CompatArchitecture("arm64"), Equals, ArchitectureType("armhf"))
+	c.Check(CompatArchitecture("armhf"), Equals, ArchitectureType(""))
+	c.Check(CompatArchitecture("s390x"), Equals, ArchitectureType(""))
+}
@@ -85,6 +85,14 @@ func DeriveSideInfo(snapPath string, db asserts.RODatabase) (*snap.SideInfo, err
 		return nil, err
 	}
 
+	return DeriveSideInfoFromDigest(snapPath, snapSHA3_384, snapSize, db)
+}
+
+// DeriveSideInfoFromDigest is like DeriveSideInfo but takes the
+// digest and size of the snap file described by snapDesc, for when
+// the snap file is not at hand, e.g. when it is to be reconstructed
+// from a delta.
+func DeriveSideInfoFromDigest(snapDesc, snapSHA3_384 string, snapSize uint64, db asserts.RODatabase) (*snap.SideInfo, error) {
 	// get relevant assertions and reconstruct metadata
 	a, err := db.Find(asserts.SnapRevisionType, map[string]string{
 		"snap-sha3-384": snapSHA3_384,
@@ -96,12 +104,12 @@ func DeriveSideInfo(snapPath string, db asserts.RODatabase) (*snap.SideInfo, err
 	snapRev := a.(*asserts.SnapRevision)
 
 	if snapRev.SnapSize() != snapSize {
-		return nil, fmt.Errorf("snap %q does not have expected size according to signatures (broken or tampered): %d != %d", snapPath, snapSize, snapRev.SnapSize())
+		return nil, fmt.Errorf("snap %q does not have expected size according to signatures (broken or tampered): %d != %d", snapDesc, snapSize, snapRev.SnapSize())
 	}
 
 	snapID := snapRev.SnapID()
 
-	snapDecl, err := findSnapDeclaration(snapID, snapPath, db)
+	snapDecl, err := findSnapDeclaration(snapID, snapDesc, db)
 	if err != nil {
 		return nil, err
 	}
@@ -241,6 +241,34 @@ func (s *snapassertsSuite) TestDeriveSideInfoHappy(c *C) {
 	})
 }
 
+func (s *snapassertsSuite) TestDeriveSideInfoFromDigest(c *C) {
+	digest := makeDigest(42)
+	size := uint64(len(fakeSnap(42)))
+	headers := map[string]interface{}{
+		"snap-id":       "snap-id-1",
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-revision": "42",
+		"developer-id":  s.dev1Acct.AccountID(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, headers, nil, "")
+	c.Assert(err, IsNil)
+	err = s.localDB.Add(snapRev)
+	c.Assert(err, IsNil)
+
+	si, err := snapasserts.DeriveSideInfoFromDigest("anon.delta", digest, size, s.localDB)
+	c.Assert(err, IsNil)
+	c.Check(si, DeepEquals, &snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "snap-id-1",
+		Revision: snap.R(42),
+	})
+
+	_, err = snapasserts.DeriveSideInfoFromDigest("anon.delta", digest, size+1, s.localDB)
+	c.Check(err, ErrorMatches, `snap "anon.delta" does not have expected size according to signatures \(broken or tampered\): .*`)
+}
+
 func (s *snapassertsSuite) TestDeriveSideInfoNoSignatures(c *C) {
 	tempdir := c.MkDir()
 	snapPath := filepath.Join(tempdir, "anon.snap")
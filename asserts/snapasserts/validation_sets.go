@@ -0,0 +1,231 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// ValidationSetKey returns the key identifying the validation-set with
+// the given account-id and name, i.e. <account-id>/<name>.
+func ValidationSetKey(accountID, name string) string {
+	return accountID + "/" + name
+}
+
+// SnapConstraints holds the combined constraints that a group of
+// validation-sets puts on a snap.
+type SnapConstraints struct {
+	Presence asserts.Presence
+	// Revision is the revision the snap is pinned at, unset if any
+	// revision is acceptable.
+	Revision snap.Revision
+	// Sets holds the keys of the validation-sets listing the snap.
+	Sets []string
+}
+
+func (sc *SnapConstraints) setsString() string {
+	return strutil.Quoted(sc.Sets)
+}
+
+// ValidationSets combines validation-set assertions and checks snaps
+// against them.
+type ValidationSets struct {
+	sets  map[string]*asserts.ValidationSet
+	snaps map[string]*SnapConstraints
+}
+
+// NewValidationSets returns an empty ValidationSets.
+func NewValidationSets() *ValidationSets {
+	return &ValidationSets{
+		sets:  make(map[string]*asserts.ValidationSet),
+		snaps: make(map[string]*SnapConstraints),
+	}
+}
+
+// Add adds the given validation-set to the combination. It fails if
+// the validation-set is in conflict with the ones already added, for
+// example if it pins a snap at a different revision.
+func (v *ValidationSets) Add(valset *asserts.ValidationSet) error {
+	key := ValidationSetKey(valset.AccountID(), valset.Name())
+	if _, ok := v.sets[key]; ok {
+		return fmt.Errorf("cannot add validation set %q twice", key)
+	}
+
+	// check everything before changing anything
+	for _, vsnap := range valset.Snaps() {
+		c := v.snaps[vsnap.Name]
+		if c == nil {
+			continue
+		}
+		conflict := false
+		switch {
+		case c.Presence == asserts.PresenceRequired && vsnap.Presence == asserts.PresenceInvalid:
+			conflict = true
+		case c.Presence == asserts.PresenceInvalid && vsnap.Presence == asserts.PresenceRequired:
+			conflict = true
+		case vsnap.Revision != 0 && !c.Revision.Unset() && c.Revision != snap.R(vsnap.Revision):
+			conflict = true
+		}
+		if conflict {
+			return fmt.Errorf("validation set %q is in conflict with %s about snap %q", key, c.setsString(), vsnap.Name)
+		}
+	}
+
+	v.sets[key] = valset
+	for _, vsnap := range valset.Snaps() {
+		c := v.snaps[vsnap.Name]
+		if c == nil {
+			c = &SnapConstraints{Presence: vsnap.Presence}
+			v.snaps[vsnap.Name] = c
+		}
+		// required and invalid win over optional
+		if vsnap.Presence != asserts.PresenceOptional {
+			c.Presence = vsnap.Presence
+		}
+		if vsnap.Revision != 0 {
+			c.Revision = snap.R(vsnap.Revision)
+		}
+		c.Sets = append(c.Sets, key)
+	}
+	return nil
+}
+
+// Keys returns the sorted keys of the validation-sets in the combination.
+func (v *ValidationSets) Keys() []string {
+	keys := make([]string, 0, len(v.sets))
+	for key := range v.sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Constraints returns the combined constraints on the given snap, or
+// nil if no validation-set lists it.
+func (v *ValidationSets) Constraints(snapName string) *SnapConstraints {
+	return v.snaps[snapName]
+}
+
+// RequiredSnaps returns the sorted names of the snaps that must be installed.
+func (v *ValidationSets) RequiredSnaps() []string {
+	var names []string
+	for name, c := range v.snaps {
+		if c.Presence == asserts.PresenceRequired {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckInstall returns an error if installing the given revision of
+// the snap would violate the validation-sets. An unset revision only
+// checks whether the snap can be installed at all.
+func (v *ValidationSets) CheckInstall(snapName string, revision snap.Revision) error {
+	c := v.snaps[snapName]
+	if c == nil {
+		return nil
+	}
+	if c.Presence == asserts.PresenceInvalid {
+		return fmt.Errorf("snap %q is invalid in validation sets %s", snapName, c.setsString())
+	}
+	if !c.Revision.Unset() && !revision.Unset() && revision != c.Revision {
+		return fmt.Errorf("snap %q is pinned at revision %s by validation sets %s", snapName, c.Revision, c.setsString())
+	}
+	return nil
+}
+
+// CheckRemove returns an error if removing the snap would violate the
+// validation-sets.
+func (v *ValidationSets) CheckRemove(snapName string) error {
+	c := v.snaps[snapName]
+	if c != nil && c.Presence == asserts.PresenceRequired {
+		return fmt.Errorf("snap %q is required by validation sets %s", snapName, c.setsString())
+	}
+	return nil
+}
+
+// ValidationSetsValidationError describes how the installed snaps
+// violate a combination of validation-sets.
+type ValidationSetsValidationError struct {
+	// MissingSnaps are required snaps that are not installed.
+	MissingSnaps []string
+	// InvalidSnaps are invalid snaps that are installed.
+	InvalidSnaps []string
+	// WrongRevisionSnaps maps installed snaps to the revision they
+	// are pinned at, when they are installed at a different one.
+	WrongRevisionSnaps map[string]snap.Revision
+}
+
+func (e *ValidationSetsValidationError) Error() string {
+	var parts []string
+	if len(e.MissingSnaps) != 0 {
+		parts = append(parts, fmt.Sprintf("missing required snaps: %s", strings.Join(e.MissingSnaps, ", ")))
+	}
+	if len(e.InvalidSnaps) != 0 {
+		parts = append(parts, fmt.Sprintf("invalid snaps installed: %s", strings.Join(e.InvalidSnaps, ", ")))
+	}
+	if len(e.WrongRevisionSnaps) != 0 {
+		names := make([]string, 0, len(e.WrongRevisionSnaps))
+		for name := range e.WrongRevisionSnaps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		wrong := make([]string, len(names))
+		for i, name := range names {
+			wrong[i] = fmt.Sprintf("%s (required at revision %s)", name, e.WrongRevisionSnaps[name])
+		}
+		parts = append(parts, fmt.Sprintf("snaps at the wrong revision: %s", strings.Join(wrong, ", ")))
+	}
+	return fmt.Sprintf("validation sets are not met: %s", strings.Join(parts, "; "))
+}
+
+// CheckInstalledSnaps checks the installed snaps, given as a map from
+// their names to their current revisions, against the validation-sets.
+// It returns a *ValidationSetsValidationError if they don't match.
+func (v *ValidationSets) CheckInstalledSnaps(installed map[string]snap.Revision) error {
+	verr := &ValidationSetsValidationError{}
+	for name, c := range v.snaps {
+		rev, ok := installed[name]
+		switch {
+		case !ok && c.Presence == asserts.PresenceRequired:
+			verr.MissingSnaps = append(verr.MissingSnaps, name)
+		case ok && c.Presence == asserts.PresenceInvalid:
+			verr.InvalidSnaps = append(verr.InvalidSnaps, name)
+		case ok && !c.Revision.Unset() && rev != c.Revision:
+			if verr.WrongRevisionSnaps == nil {
+				verr.WrongRevisionSnaps = make(map[string]snap.Revision)
+			}
+			verr.WrongRevisionSnaps[name] = c.Revision
+		}
+	}
+	if len(verr.MissingSnaps) == 0 && len(verr.InvalidSnaps) == 0 && len(verr.WrongRevisionSnaps) == 0 {
+		return nil
+	}
+	sort.Strings(verr.MissingSnaps)
+	sort.Strings(verr.InvalidSnaps)
+	return verr
+}
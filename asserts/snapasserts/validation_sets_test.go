@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts_test
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/snap"
+)
+
+type validationSetsSuite struct {
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&validationSetsSuite{})
+
+func (s *validationSetsSuite) SetUpSuite(c *C) {
+	rootPrivKey, _ := assertstest.GenerateKey(1024)
+	storePrivKey, _ := assertstest.GenerateKey(752)
+	s.storeSigning = assertstest.NewStoreStack("can0nical", rootPrivKey, storePrivKey)
+}
+
+func (s *validationSetsSuite) mockValidationSet(c *C, name string, snaps ...interface{}) *asserts.ValidationSet {
+	headers := map[string]interface{}{
+		"series":     "16",
+		"account-id": "can0nical",
+		"name":       name,
+		"sequence":   "1",
+		"snaps":      snaps,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+	a, err := s.storeSigning.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func setSnap(name, presence string, revision int) map[string]interface{} {
+	m := map[string]interface{}{
+		"name": name,
+		"id":   (name + "snapidsnapidsnapidsnapidsnapid")[:32],
+	}
+	if presence != "" {
+		m["presence"] = presence
+	}
+	if revision != 0 {
+		m["revision"] = fmt.Sprint(revision)
+	}
+	return m
+}
+
+func (s *validationSetsSuite) TestAddAndCheck(c *C) {
+	valsets := snapasserts.NewValidationSets()
+	err := valsets.Add(s.mockValidationSet(c, "one",
+		setSnap("foo", "", 7),
+		setSnap("bar", "optional", 0),
+		setSnap("baz", "invalid", 0)))
+	c.Assert(err, IsNil)
+	err = valsets.Add(s.mockValidationSet(c, "two",
+		setSnap("foo", "optional", 0),
+		setSnap("bar", "required", 3)))
+	c.Assert(err, IsNil)
+
+	c.Check(valsets.Keys(), DeepEquals, []string{"can0nical/one", "can0nical/two"})
+	c.Check(valsets.RequiredSnaps(), DeepEquals, []string{"bar", "foo"})
+	c.Check(valsets.Constraints("foo"), DeepEquals, &snapasserts.SnapConstraints{
+		Presence: asserts.PresenceRequired,
+		Revision: snap.R(7),
+		Sets:     []string{"can0nical/one", "can0nical/two"},
+	})
+	c.Check(valsets.Constraints("other"), IsNil)
+
+	c.Check(valsets.CheckInstall("foo", snap.R(0)), IsNil)
+	c.Check(valsets.CheckInstall("foo", snap.R(7)), IsNil)
+	c.Check(valsets.CheckInstall("foo", snap.R(8)), ErrorMatches, `snap "foo" is pinned at revision 7 by validation sets "can0nical/one", "can0nical/two"`)
+	c.Check(valsets.CheckInstall("baz", snap.R(0)), ErrorMatches, `snap "baz" is invalid in validation sets "can0nical/one"`)
+	c.Check(valsets.CheckInstall("other", snap.R(1)), IsNil)
+
+	c.Check(valsets.CheckRemove("bar"), ErrorMatches, `snap "bar" is required by validation sets "can0nical/one", "can0nical/two"`)
+	c.Check(valsets.CheckRemove("baz"), IsNil)
+	c.Check(valsets.CheckRemove("other"), IsNil)
+}
+
+func (s *validationSetsSuite) TestAddConflicts(c *C) {
+	valsets := snapasserts.NewValidationSets()
+	one := s.mockValidationSet(c, "one", setSnap("foo", "", 7), setSnap("bar", "invalid", 0))
+	c.Assert(valsets.Add(one), IsNil)
+
+	err := valsets.Add(one)
+	c.Check(err, ErrorMatches, `cannot add validation set "can0nical/one" twice`)
+
+	err = valsets.Add(s.mockValidationSet(c, "two", setSnap("foo", "", 8)))
+	c.Check(err, ErrorMatches, `validation set "can0nical/two" is in conflict with "can0nical/one" about snap "foo"`)
+
+	err = valsets.Add(s.mockValidationSet(c, "three", setSnap("bar", "required", 0)))
+	c.Check(err, ErrorMatches, `validation set "can0nical/three" is in conflict with "can0nical/one" about snap "bar"`)
+
+	// nothing was changed by the failed additions
+	c.Check(valsets.Keys(), DeepEquals, []string{"can0nical/one"})
+	c.Check(valsets.RequiredSnaps(), DeepEquals, []string{"foo"})
+}
+
+func (s *validationSetsSuite) TestCheckInstalledSnaps(c *C) {
+	valsets := snapasserts.NewValidationSets()
+	err := valsets.Add(s.mockValidationSet(c, "one",
+		setSnap("foo", "", 7),
+		setSnap("bar", "", 0),
+		setSnap("baz", "invalid", 0),
+		setSnap("quux", "optional", 2)))
+	c.Assert(err, IsNil)
+
+	c.Check(valsets.CheckInstalledSnaps(map[string]snap.Revision{
+		"foo": snap.R(7),
+		"bar": snap.R(1),
+	}), IsNil)
+
+	err = valsets.CheckInstalledSnaps(map[string]snap.Revision{
+		"foo":  snap.R(1),
+		"baz":  snap.R(1),
+		"quux": snap.R(3),
+	})
+	c.Assert(err, FitsTypeOf, &snapasserts.ValidationSetsValidationError{})
+	verr := err.(*snapasserts.ValidationSetsValidationError)
+	c.Check(verr.MissingSnaps, DeepEquals, []string{"bar"})
+	c.Check(verr.InvalidSnaps, DeepEquals, []string{"baz"})
+	c.Check(verr.WrongRevisionSnaps, DeepEquals, map[string]snap.Revision{
+		"foo":  snap.R(7),
+		"quux": snap.R(2),
+	})
+	c.Check(err, ErrorMatches, `validation sets are not met: missing required snaps: bar; invalid snaps installed: baz; snaps at the wrong revision: foo \(required at revision 7\), quux \(required at revision 2\)`)
+}
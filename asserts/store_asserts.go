@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Store holds a store assertion, which describes a store, like an
+// on-premises proxy store, giving its location and the devices it
+// serves.
+type Store struct {
+	assertionBase
+	url       *url.URL
+	models    []string
+	timestamp time.Time
+}
+
+// Store returns the identifier of the store.
+func (store *Store) Store() string {
+	return store.HeaderString("store")
+}
+
+// OperatorID returns the account-id of the operator of the store.
+func (store *Store) OperatorID() string {
+	return store.HeaderString("operator-id")
+}
+
+// URL returns the URL of the store API.
+func (store *Store) URL() *url.URL {
+	return store.url
+}
+
+// Models returns the models, as <brand-id>/<model>, of the devices the
+// store serves. They are all models of the operator brand, as only the
+// brand can decide which store its devices use. Empty list means all the
+// devices of the operator brand.
+func (store *Store) Models() []string {
+	return store.models
+}
+
+// ServesModel returns whether the store serves devices of the given
+// brand and model.
+func (store *Store) ServesModel(brandID, model string) bool {
+	if len(store.models) == 0 {
+		return brandID == store.OperatorID()
+	}
+	for _, m := range store.models {
+		if m == brandID+"/"+model {
+			return true
+		}
+	}
+	return false
+}
+
+// Timestamp returns the time when the store assertion was issued.
+func (store *Store) Timestamp() time.Time {
+	return store.timestamp
+}
+
+// Implement further consistency checks.
+func (store *Store) checkConsistency(db RODatabase, acck *AccountKey) error {
+	_, err := db.Find(AccountType, map[string]string{
+		"account-id": store.OperatorID(),
+	})
+	if err == ErrNotFound {
+		return fmt.Errorf("store assertion %q does not have a matching account assertion for the operator %q", store.Store(), store.OperatorID())
+	}
+	return err
+}
+
+// sanity
+var _ consistencyChecker = (*Store)(nil)
+
+// Prerequisites returns references to this store's prerequisite assertions.
+func (store *Store) Prerequisites() []*Ref {
+	return []*Ref{
+		{Type: AccountType, PrimaryKey: []string{store.OperatorID()}},
+	}
+}
+
+var validStoreModel = regexp.MustCompile("^[a-z0-9A-Z-]+/[a-zA-Z0-9](?:-?[a-zA-Z0-9])*$")
+
+func checkStoreURL(headers map[string]interface{}) (*url.URL, error) {
+	s, err := checkNotEmptyString(headers, "url")
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf(`"url" header must be a valid URL: %s`, s)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf(`"url" header scheme must be "https" or "http": %s`, s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf(`"url" header must have a host: %s`, s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf(`"url" header must not have a query or fragment: %s`, s)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		// endpoints are resolved relative to the URL
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+func assembleStore(assert assertionBase) (Assertion, error) {
+	_, err := checkNotEmptyString(assert.headers, "store")
+	if err != nil {
+		return nil, err
+	}
+
+	operatorID, err := checkNotEmptyString(assert.headers, "operator-id")
+	if err != nil {
+		return nil, err
+	}
+	if operatorID != assert.AuthorityID() {
+		return nil, fmt.Errorf("authority-id and operator-id must match, store assertions are expected to be signed by the operator: %q != %q", assert.AuthorityID(), operatorID)
+	}
+
+	u, err := checkStoreURL(assert.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	models, err := checkStringListMatches(assert.headers, "models", validStoreModel)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		if brandID := strings.SplitN(m, "/", 2)[0]; brandID != operatorID {
+			return nil, fmt.Errorf(`"models" header must only list models of the operator brand %q: %s`, operatorID, m)
+		}
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		assertionBase: assert,
+		url:           u,
+		models:        models,
+		timestamp:     timestamp,
+	}, nil
+}
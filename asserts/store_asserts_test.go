@@ -0,0 +1,142 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type storeSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&storeSuite{})
+
+func (ss *storeSuite) SetUpSuite(c *C) {
+	ss.ts = time.Now().Truncate(time.Second).UTC()
+	ss.tsLine = "timestamp: " + ss.ts.Format(time.RFC3339) + "\n"
+}
+
+const storeModels = `models:
+  - brand-id1/model1
+  - brand-id1/model2
+`
+
+func (ss *storeSuite) makeValidEncoded() string {
+	return "type: store\n" +
+		"authority-id: brand-id1\n" +
+		"store: on-prem\n" +
+		"operator-id: brand-id1\n" +
+		"url: https://store.example.com/api\n" +
+		storeModels +
+		ss.tsLine +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+}
+
+func (ss *storeSuite) TestDecodeOK(c *C) {
+	encoded := ss.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.StoreType)
+	store := a.(*asserts.Store)
+	c.Check(store.AuthorityID(), Equals, "brand-id1")
+	c.Check(store.Timestamp(), Equals, ss.ts)
+	c.Check(store.Store(), Equals, "on-prem")
+	c.Check(store.OperatorID(), Equals, "brand-id1")
+	c.Check(store.URL().String(), Equals, "https://store.example.com/api/")
+	c.Check(store.Models(), DeepEquals, []string{"brand-id1/model1", "brand-id1/model2"})
+}
+
+func (ss *storeSuite) TestServesModel(c *C) {
+	a, err := asserts.Decode([]byte(ss.makeValidEncoded()))
+	c.Assert(err, IsNil)
+	store := a.(*asserts.Store)
+	c.Check(store.ServesModel("brand-id1", "model1"), Equals, true)
+	c.Check(store.ServesModel("brand-id1", "model2"), Equals, true)
+	c.Check(store.ServesModel("brand-id1", "model3"), Equals, false)
+	c.Check(store.ServesModel("other-brand", "model2"), Equals, false)
+
+	// without models the devices of the operator are served
+	a, err = asserts.Decode([]byte(strings.Replace(ss.makeValidEncoded(), storeModels, "", 1)))
+	c.Assert(err, IsNil)
+	store = a.(*asserts.Store)
+	c.Check(store.Models(), HasLen, 0)
+	c.Check(store.ServesModel("brand-id1", "any-model"), Equals, true)
+	c.Check(store.ServesModel("other-brand", "model2"), Equals, false)
+}
+
+const storeErrPrefix = "assertion store: "
+
+func (ss *storeSuite) TestDecodeInvalid(c *C) {
+	encoded := ss.makeValidEncoded()
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"store: on-prem\n", "", `"store" header is mandatory`},
+		{"operator-id: brand-id1\n", "", `"operator-id" header is mandatory`},
+		{"operator-id: brand-id1\n", "operator-id: other\n", `authority-id and operator-id must match, store assertions are expected to be signed by the operator: "brand-id1" != "other"`},
+		{"url: https://store.example.com/api\n", "", `"url" header is mandatory`},
+		{"url: https://store.example.com/api\n", "url: ftp://store.example.com\n", `"url" header scheme must be "https" or "http": ftp://store.example.com`},
+		{"url: https://store.example.com/api\n", "url: https:///api\n", `"url" header must have a host: https:///api`},
+		{"url: https://store.example.com/api\n", "url: https://store.example.com/?q=1\n", `"url" header must not have a query or fragment: https://store.example.com/\?q=1`},
+		{storeModels, "models: foo\n", `"models" header must be a list of strings`},
+		{storeModels, "models:\n  - model1\n", `"models" header contains an invalid element: "model1"`},
+		{storeModels, "models:\n  - other-brand/model1\n", `"models" header must only list models of the operator brand "brand-id1": other-brand/model1`},
+		{ss.tsLine, "", `"timestamp" header is mandatory`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, storeErrPrefix+test.expectedErr)
+	}
+}
+
+func (ss *storeSuite) makeHeaders(operatorID string) map[string]interface{} {
+	return map[string]interface{}{
+		"authority-id": operatorID,
+		"store":        "on-prem",
+		"operator-id":  operatorID,
+		"url":          "https://store.example.com",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+}
+
+func (ss *storeSuite) TestStoreCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	operatorDB := setup3rdPartySigning(c, "operator-id1", storeDB, db)
+
+	store, err := operatorDB.Sign(asserts.StoreType, ss.makeHeaders("operator-id1"), nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(store)
+	c.Assert(err, IsNil)
+
+	c.Check(store.Prerequisites(), DeepEquals, []*asserts.Ref{
+		{Type: asserts.AccountType, PrimaryKey: []string{"operator-id1"}},
+	})
+}
@@ -0,0 +1,242 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Presence represents the presence constraint a validation-set puts
+// on a snap.
+type Presence string
+
+const (
+	// PresenceRequired means the snap must be installed.
+	PresenceRequired Presence = "required"
+	// PresenceOptional means the snap may or may not be installed.
+	PresenceOptional Presence = "optional"
+	// PresenceInvalid means the snap must not be installed.
+	PresenceInvalid Presence = "invalid"
+)
+
+// ValidationSetSnap holds the details about a snap listed in a
+// validation-set assertion.
+type ValidationSetSnap struct {
+	Name   string
+	SnapID string
+
+	Presence Presence
+
+	// Revision is the revision the snap is pinned at, 0 if any
+	// revision is acceptable.
+	Revision int
+}
+
+// ValidationSet holds a validation-set assertion, which lists snaps
+// that must be, may be or must not be installed on a system, possibly
+// pinned at specific revisions.
+type ValidationSet struct {
+	assertionBase
+	sequence  int
+	snaps     []*ValidationSetSnap
+	timestamp time.Time
+}
+
+// Series returns the series for which the validation-set holds.
+func (vs *ValidationSet) Series() string {
+	return vs.HeaderString("series")
+}
+
+// AccountID returns the identifier of the account that issued the validation-set.
+func (vs *ValidationSet) AccountID() string {
+	return vs.HeaderString("account-id")
+}
+
+// Name returns the name of the validation-set within its account.
+func (vs *ValidationSet) Name() string {
+	return vs.HeaderString("name")
+}
+
+// Sequence returns the sequence number of this iteration of the validation-set.
+func (vs *ValidationSet) Sequence() int {
+	return vs.sequence
+}
+
+// Snaps returns the snaps listed by the validation-set.
+func (vs *ValidationSet) Snaps() []*ValidationSetSnap {
+	return vs.snaps
+}
+
+// Timestamp returns the time when the validation-set was issued.
+func (vs *ValidationSet) Timestamp() time.Time {
+	return vs.timestamp
+}
+
+// Implement further consistency checks.
+func (vs *ValidationSet) checkConsistency(db RODatabase, acck *AccountKey) error {
+	_, err := db.Find(AccountType, map[string]string{
+		"account-id": vs.AccountID(),
+	})
+	if err == ErrNotFound {
+		return fmt.Errorf("validation-set assertion for %q does not have a matching account assertion", vs.AccountID())
+	}
+	return err
+}
+
+// sanity
+var _ consistencyChecker = (*ValidationSet)(nil)
+
+// Prerequisites returns references to this validation-set's prerequisite assertions.
+func (vs *ValidationSet) Prerequisites() []*Ref {
+	return []*Ref{
+		{Type: AccountType, PrimaryKey: []string{vs.AccountID()}},
+	}
+}
+
+var (
+	validValidationSetName = regexp.MustCompile("^[a-z0-9](?:-?[a-z0-9])*$")
+	validSetSnapName       = regexp.MustCompile("^(?:[a-z0-9]+-?)*[a-z](?:-?[a-z0-9])*$")
+)
+
+func checkValidationSetSnap(snap interface{}, i int) (*ValidationSetSnap, error) {
+	m, ok := snap.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`"snaps" header must be a list of maps`)
+	}
+
+	what := fmt.Sprintf("of snap #%d", i+1)
+	name, err := checkNotEmptyStringWhat(m, "name", what)
+	if err != nil {
+		return nil, err
+	}
+	if !validSetSnapName.MatchString(name) {
+		return nil, fmt.Errorf("invalid snap name %q", name)
+	}
+	what = fmt.Sprintf("of snap %q", name)
+
+	snapID, err := checkNotEmptyStringWhat(m, "id", what)
+	if err != nil {
+		return nil, err
+	}
+	if !validSnapID.MatchString(snapID) {
+		return nil, fmt.Errorf("invalid snap-id %q %s", snapID, what)
+	}
+
+	presence := PresenceRequired
+	if v, ok := m["presence"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf(`"presence" %s must be a string`, what)
+		}
+		presence = Presence(s)
+		switch presence {
+		case PresenceRequired, PresenceOptional, PresenceInvalid:
+		default:
+			return nil, fmt.Errorf(`"presence" %s must be one of required|optional|invalid: %s`, what, s)
+		}
+	}
+
+	revision := 0
+	if v, ok := m["revision"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf(`"revision" %s must be a string`, what)
+		}
+		revision, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf(`"revision" %s is not an integer: %s`, what, s)
+		}
+		if revision < 1 {
+			return nil, fmt.Errorf(`"revision" %s must be >=1: %d`, what, revision)
+		}
+		if presence == PresenceInvalid {
+			return nil, fmt.Errorf(`"revision" %s cannot be specified for an invalid snap`, what)
+		}
+	}
+
+	return &ValidationSetSnap{
+		Name:     name,
+		SnapID:   snapID,
+		Presence: presence,
+		Revision: revision,
+	}, nil
+}
+
+func assembleValidationSet(assert assertionBase) (Assertion, error) {
+	authorityID := assert.AuthorityID()
+	accountID := assert.HeaderString("account-id")
+	if accountID != authorityID {
+		return nil, fmt.Errorf("authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: %q != %q", authorityID, accountID)
+	}
+
+	name, err := checkStringMatches(assert.headers, "name", validValidationSetName)
+	if err != nil {
+		return nil, err
+	}
+	if len(name) > 40 {
+		return nil, fmt.Errorf(`"name" header must be at most 40 characters long: %q`, name)
+	}
+
+	sequence, err := checkInt(assert.headers, "sequence")
+	if err != nil {
+		return nil, err
+	}
+	if sequence < 1 {
+		return nil, fmt.Errorf(`"sequence" header must be >=1: %d`, sequence)
+	}
+
+	snapList, ok := assert.headers["snaps"].([]interface{})
+	if !ok || len(snapList) == 0 {
+		return nil, fmt.Errorf(`"snaps" header must be a non-empty list`)
+	}
+	snaps := make([]*ValidationSetSnap, len(snapList))
+	seenNames := make(map[string]bool, len(snapList))
+	seenIDs := make(map[string]bool, len(snapList))
+	for i, x := range snapList {
+		snap, err := checkValidationSetSnap(x, i)
+		if err != nil {
+			return nil, err
+		}
+		if seenNames[snap.Name] {
+			return nil, fmt.Errorf("cannot list the same snap %q multiple times", snap.Name)
+		}
+		if seenIDs[snap.SnapID] {
+			return nil, fmt.Errorf("cannot list the same snap-id %q multiple times", snap.SnapID)
+		}
+		seenNames[snap.Name] = true
+		seenIDs[snap.SnapID] = true
+		snaps[i] = snap
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidationSet{
+		assertionBase: assert,
+		sequence:      sequence,
+		snaps:         snaps,
+		timestamp:     timestamp,
+	}, nil
+}
@@ -0,0 +1,157 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type validationSetSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&validationSetSuite{})
+
+func (vss *validationSetSuite) SetUpSuite(c *C) {
+	vss.ts = time.Now().Truncate(time.Second).UTC()
+	vss.tsLine = "timestamp: " + vss.ts.Format(time.RFC3339) + "\n"
+}
+
+const validationSetSnaps = `snaps:
+  -
+    name: foo
+    id: foosnapidsnapidsnapidsnapidsnapi
+    revision: 7
+  -
+    name: bar
+    id: barsnapidsnapidsnapidsnapidsnapi
+    presence: optional
+  -
+    name: baz
+    id: bazsnapidsnapidsnapidsnapidsnapi
+    presence: invalid
+`
+
+func (vss *validationSetSuite) makeValidEncoded() string {
+	return "type: validation-set\n" +
+		"authority-id: dev-id1\n" +
+		"series: 16\n" +
+		"account-id: dev-id1\n" +
+		"name: fleet\n" +
+		"sequence: 3\n" +
+		validationSetSnaps +
+		vss.tsLine +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+}
+
+func (vss *validationSetSuite) TestDecodeOK(c *C) {
+	encoded := vss.makeValidEncoded()
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	valset := a.(*asserts.ValidationSet)
+	c.Check(valset.AuthorityID(), Equals, "dev-id1")
+	c.Check(valset.Timestamp(), Equals, vss.ts)
+	c.Check(valset.Series(), Equals, "16")
+	c.Check(valset.AccountID(), Equals, "dev-id1")
+	c.Check(valset.Name(), Equals, "fleet")
+	c.Check(valset.Sequence(), Equals, 3)
+	c.Check(valset.Snaps(), DeepEquals, []*asserts.ValidationSetSnap{
+		{Name: "foo", SnapID: "foosnapidsnapidsnapidsnapidsnapi", Presence: asserts.PresenceRequired, Revision: 7},
+		{Name: "bar", SnapID: "barsnapidsnapidsnapidsnapidsnapi", Presence: asserts.PresenceOptional},
+		{Name: "baz", SnapID: "bazsnapidsnapidsnapidsnapidsnapi", Presence: asserts.PresenceInvalid},
+	})
+}
+
+const validationSetErrPrefix = "assertion validation-set: "
+
+func (vss *validationSetSuite) TestDecodeInvalid(c *C) {
+	encoded := vss.makeValidEncoded()
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"series: 16\n", "", `"series" header is mandatory`},
+		{"account-id: dev-id1\n", "account-id: other\n", `authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: "dev-id1" != "other"`},
+		{"name: fleet\n", "", `"name" header is mandatory`},
+		{"name: fleet\n", "name: Fleet\n", `"name" header contains invalid characters: "Fleet"`},
+		{"sequence: 3\n", "", `"sequence" header is mandatory`},
+		{"sequence: 3\n", "sequence: x\n", `"sequence" header is not an integer: x`},
+		{"sequence: 3\n", "sequence: 0\n", `"sequence" header must be >=1: 0`},
+		{validationSetSnaps, "", `"snaps" header must be a non-empty list`},
+		{validationSetSnaps, "snaps: foo\n", `"snaps" header must be a non-empty list`},
+		{validationSetSnaps, "snaps:\n  - foo\n", `"snaps" header must be a list of maps`},
+		{"    name: foo\n", "", `"name" of snap #1 is mandatory`},
+		{"    name: foo\n", "    name: -foo\n", `invalid snap name "-foo"`},
+		{"    id: foosnapidsnapidsnapidsnapidsnapi\n", "", `"id" of snap "foo" is mandatory`},
+		{"    id: foosnapidsnapidsnapidsnapidsnapi\n", "    id: foo-id\n", `invalid snap-id "foo-id" of snap "foo"`},
+		{"    revision: 7\n", "    revision: z\n", `"revision" of snap "foo" is not an integer: z`},
+		{"    revision: 7\n", "    revision: 0\n", `"revision" of snap "foo" must be >=1: 0`},
+		{"    presence: optional\n", "    presence: maybe\n", `"presence" of snap "bar" must be one of required|optional|invalid: maybe`},
+		{"    presence: invalid\n", "    presence: invalid\n    revision: 1\n", `"revision" of snap "baz" cannot be specified for an invalid snap`},
+		{"    name: bar\n", "    name: foo\n", `cannot list the same snap "foo" multiple times`},
+		{"    id: barsnapidsnapidsnapidsnapidsnapi\n", "    id: foosnapidsnapidsnapidsnapidsnapi\n", `cannot list the same snap-id "foosnapidsnapidsnapidsnapidsnapi" multiple times`},
+		{vss.tsLine, "", `"timestamp" header is mandatory`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, validationSetErrPrefix+test.expectedErr)
+	}
+}
+
+func (vss *validationSetSuite) makeHeaders(accountID string) map[string]interface{} {
+	return map[string]interface{}{
+		"authority-id": accountID,
+		"series":       "16",
+		"account-id":   accountID,
+		"name":         "fleet",
+		"sequence":     "1",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name": "foo",
+				"id":   "foosnapidsnapidsnapidsnapidsnapi",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+}
+
+func (vss *validationSetSuite) TestValidationSetCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	devDB := setup3rdPartySigning(c, "dev-id1", storeDB, db)
+
+	valset, err := devDB.Sign(asserts.ValidationSetType, vss.makeHeaders("dev-id1"), nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(valset)
+	c.Assert(err, IsNil)
+
+	c.Check(valset.Prerequisites(), DeepEquals, []*asserts.Ref{
+		{Type: asserts.AccountType, PrimaryKey: []string{"dev-id1"}},
+	})
+}
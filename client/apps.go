@@ -0,0 +1,224 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppInfo describes a single snap application.
+type AppInfo struct {
+	Snap    string   `json:"snap,omitempty"`
+	Name    string   `json:"name"`
+	Daemon  string   `json:"daemon,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	Enabled bool     `json:"enabled,omitempty"`
+	Active  bool     `json:"active,omitempty"`
+}
+
+// IsService returns true if the application is a background daemon.
+func (a *AppInfo) IsService() bool {
+	if a == nil {
+		return false
+	}
+	if a.Daemon == "" {
+		return false
+	}
+
+	return true
+}
+
+// AppOptions represent the options of the Apps call.
+type AppOptions struct {
+	// If Service is true, only return apps that are services
+	// (app.IsService() is true); otherwise, return all.
+	Service bool
+}
+
+// Apps returns information about all matching apps. Each name can be
+// either a snap or a snap.app. If names is empty, list all (that
+// satisfy opts).
+func (client *Client) Apps(names []string, opts AppOptions) ([]*AppInfo, error) {
+	q := make(url.Values)
+	if len(names) > 0 {
+		q.Add("names", strings.Join(names, ","))
+	}
+	if opts.Service {
+		q.Add("select", "service")
+	}
+
+	var appInfos []*AppInfo
+	_, err := client.doSync("GET", "/v2/apps", q, nil, nil, &appInfos)
+
+	return appInfos, err
+}
+
+// LogOptions represent the options of the Logs call.
+type LogOptions struct {
+	N      int  // The maximum number of log lines to retrieve initially. If <0, no limit.
+	Follow bool // Whether to continue returning new lines as they appear
+}
+
+// A Log holds the information of a single syslog entry
+type Log struct {
+	Timestamp time.Time `json:"timestamp"` // Timestamp of the event, in its original timezone
+	Message   string    `json:"message"`   // Message is the log message itself
+	SID       string    `json:"sid"`       // SID is the syslog identifier
+	PID       string    `json:"pid"`       // PID is the process ID
+}
+
+func (l Log) String() string {
+	return fmt.Sprintf("%s %s[%s]: %s", l.Timestamp.Format(time.RFC3339), l.SID, l.PID, l.Message)
+}
+
+// Logs asks snapd for logs of a series of services, by name.
+func (client *Client) Logs(names []string, opts LogOptions) (<-chan Log, error) {
+	query := url.Values{}
+	if len(names) > 0 {
+		query.Set("names", strings.Join(names, ","))
+	}
+	query.Set("n", strconv.Itoa(opts.N))
+	if opts.Follow {
+		query.Set("follow", strconv.FormatBool(opts.Follow))
+	}
+
+	rsp, err := client.raw("GET", "/v2/logs", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		return nil, parseError(rsp)
+	}
+
+	ch := make(chan Log, 20)
+	go func() {
+		defer rsp.Body.Close()
+		defer close(ch)
+		decodeLogs(bufio.NewReader(rsp.Body), ch)
+	}()
+
+	return ch, nil
+}
+
+// decodeLogs decodes a stream of logs in "json-seq" format (RFC 7464)
+// into ch, until the stream runs out or an entry cannot be decoded.
+func decodeLogs(r *bufio.Reader, ch chan<- Log) error {
+	const RS = "\x1E"
+	for {
+		buf, err := r.ReadBytes('\n')
+		buf = bytes.TrimPrefix(buf, []byte(RS))
+		if len(bytes.TrimSpace(buf)) > 0 {
+			var log Log
+			if err := json.Unmarshal(buf, &log); err != nil {
+				return fmt.Errorf("cannot decode log entry: %v", err)
+			}
+			ch <- log
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ErrNoNames is returned by Start, Stop, or Restart, when the given
+// list of things on which to operate is empty.
+var ErrNoNames = fmt.Errorf(`"names" must not be empty`)
+
+type appInstruction struct {
+	Action  string   `json:"action"`
+	Names   []string `json:"names"`
+	Enable  bool     `json:"enable,omitempty"`
+	Disable bool     `json:"disable,omitempty"`
+}
+
+func (client *Client) doAppInstruction(inst *appInstruction) (changeID string, err error) {
+	if len(inst.Names) == 0 {
+		return "", ErrNoNames
+	}
+
+	b, err := json.Marshal(inst)
+	if err != nil {
+		return "", err
+	}
+
+	return client.doAsync("POST", "/v2/apps", nil, nil, bytes.NewReader(b))
+}
+
+// StartOptions represent the different options of the Start call.
+type StartOptions struct {
+	// Enable, as well as starting, the listed services. A
+	// disabled service does not start on boot.
+	Enable bool
+}
+
+// Start services.
+//
+// It takes a list of names that can be snaps, of which all their
+// services are started, or snap.service which are individual
+// services to start; it shouldn't be empty.
+func (client *Client) Start(names []string, opts StartOptions) (changeID string, err error) {
+	return client.doAppInstruction(&appInstruction{
+		Action: "start",
+		Names:  names,
+		Enable: opts.Enable,
+	})
+}
+
+// StopOptions represent the different options of the Stop call.
+type StopOptions struct {
+	// Disable, as well as stop, the listed services. A
+	// service that is not disabled starts on boot.
+	Disable bool
+}
+
+// Stop services.
+//
+// It takes a list of names that can be snaps, of which all their
+// services are stopped, or snap.service which are individual
+// services to stop; it shouldn't be empty.
+func (client *Client) Stop(names []string, opts StopOptions) (changeID string, err error) {
+	return client.doAppInstruction(&appInstruction{
+		Action:  "stop",
+		Names:   names,
+		Disable: opts.Disable,
+	})
+}
+
+// Restart services.
+//
+// It takes a list of names that can be snaps, of which all their
+// services are restarted, or snap.service which are individual
+// services to restart; it shouldn't be empty.
+func (client *Client) Restart(names []string) (changeID string, err error) {
+	return client.doAppInstruction(&appInstruction{
+		Action: "restart",
+		Names:  names,
+	})
+}
@@ -0,0 +1,155 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientAppsCallsEndpoint(c *check.C) {
+	_, _ = cs.cli.Apps(nil, client.AppOptions{})
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/apps")
+	c.Check(cs.req.URL.Query(), check.HasLen, 0)
+
+	_, _ = cs.cli.Apps([]string{"foo", "bar.baz"}, client.AppOptions{Service: true})
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"names":  []string{"foo,bar.baz"},
+		"select": []string{"service"},
+	})
+}
+
+func (cs *clientSuite) TestClientApps(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [
+			{"snap": "foo", "name": "svc", "daemon": "simple", "enabled": true, "active": true},
+			{"snap": "foo", "name": "app"}
+		]
+	}`
+	apps, err := cs.cli.Apps(nil, client.AppOptions{})
+	c.Assert(err, check.IsNil)
+	c.Check(apps, check.DeepEquals, []*client.AppInfo{
+		{Snap: "foo", Name: "svc", Daemon: "simple", Enabled: true, Active: true},
+		{Snap: "foo", Name: "app"},
+	})
+	c.Check(apps[0].IsService(), check.Equals, true)
+	c.Check(apps[1].IsService(), check.Equals, false)
+}
+
+func (cs *clientSuite) TestClientLogsCallsEndpoint(c *check.C) {
+	_, _ = cs.cli.Logs([]string{"foo", "bar.baz"}, client.LogOptions{N: 42, Follow: true})
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/logs")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"names":  []string{"foo,bar.baz"},
+		"n":      []string{"42"},
+		"follow": []string{"true"},
+	})
+}
+
+func (cs *clientSuite) TestClientLogs(c *check.C) {
+	cs.rsp = "\x1e" + `{"timestamp":"2017-03-08T10:48:24Z","message":"hello","sid":"foo","pid":"42"}` + "\n" +
+		"\x1e" + `{"timestamp":"2017-03-08T10:48:25Z","message":"world","sid":"foo","pid":"42"}` + "\n"
+	ch, err := cs.cli.Logs(nil, client.LogOptions{N: -1})
+	c.Assert(err, check.IsNil)
+
+	var logs []client.Log
+	for l := range ch {
+		logs = append(logs, l)
+	}
+	c.Assert(logs, check.HasLen, 2)
+	c.Check(logs[0].Timestamp.Equal(time.Date(2017, 3, 8, 10, 48, 24, 0, time.UTC)), check.Equals, true)
+	c.Check(logs[0].Message, check.Equals, "hello")
+	c.Check(logs[1].Message, check.Equals, "world")
+	c.Check(logs[1].String(), check.Equals, "2017-03-08T10:48:25Z foo[42]: world")
+}
+
+func (cs *clientSuite) TestClientLogsError(c *check.C) {
+	cs.status = http.StatusBadRequest
+	cs.header = http.Header{"Content-Type": []string{"application/json"}}
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "no such app"}}`
+	_, err := cs.cli.Logs([]string{"foo"}, client.LogOptions{})
+	c.Check(err, check.ErrorMatches, "no such app")
+}
+
+func (cs *clientSuite) testClientAppInstruction(c *check.C, op func() (string, error), expected map[string]interface{}) {
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": {},
+		"change": "chgid"
+	}`
+	id, err := op()
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "chgid")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/apps")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, expected)
+}
+
+func (cs *clientSuite) TestClientStart(c *check.C) {
+	cs.testClientAppInstruction(c, func() (string, error) {
+		return cs.cli.Start([]string{"foo", "bar.baz"}, client.StartOptions{Enable: true})
+	}, map[string]interface{}{
+		"action": "start",
+		"names":  []interface{}{"foo", "bar.baz"},
+		"enable": true,
+	})
+}
+
+func (cs *clientSuite) TestClientStop(c *check.C) {
+	cs.testClientAppInstruction(c, func() (string, error) {
+		return cs.cli.Stop([]string{"foo"}, client.StopOptions{Disable: true})
+	}, map[string]interface{}{
+		"action":  "stop",
+		"names":   []interface{}{"foo"},
+		"disable": true,
+	})
+}
+
+func (cs *clientSuite) TestClientRestart(c *check.C) {
+	cs.testClientAppInstruction(c, func() (string, error) {
+		return cs.cli.Restart([]string{"foo"})
+	}, map[string]interface{}{
+		"action": "restart",
+		"names":  []interface{}{"foo"},
+	})
+}
+
+func (cs *clientSuite) TestClientAppInstructionNoNames(c *check.C) {
+	_, err := cs.cli.Start(nil, client.StartOptions{})
+	c.Check(err, check.Equals, client.ErrNoNames)
+	_, err = cs.cli.Stop(nil, client.StopOptions{})
+	c.Check(err, check.Equals, client.ErrNoNames)
+	_, err = cs.cli.Restart(nil)
+	c.Check(err, check.Equals, client.ErrNoNames)
+	c.Check(cs.req, check.IsNil)
+}
@@ -75,6 +75,9 @@ type Client struct {
 	doer    doer
 
 	disableAuth bool
+
+	warningCount     int
+	warningTimestamp time.Time
 }
 
 // New returns a new instance of Client
@@ -246,6 +249,8 @@ func (client *Client) doSync(method, path string, query url.Values, headers map[
 	if err := rsp.err(); err != nil {
 		return nil, err
 	}
+	client.warningCount = rsp.WarningCount
+	client.warningTimestamp = rsp.WarningTimestamp
 	if rsp.Type != "sync" {
 		return nil, fmt.Errorf("expected sync response, got %q", rsp.Type)
 	}
@@ -268,6 +273,8 @@ func (client *Client) doAsync(method, path string, query url.Values, headers map
 	if err := rsp.err(); err != nil {
 		return "", err
 	}
+	client.warningCount = rsp.WarningCount
+	client.warningTimestamp = rsp.WarningTimestamp
 	if rsp.Type != "async" {
 		return "", fmt.Errorf("expected async response for %q on %q, got %q", method, path, rsp.Type)
 	}
@@ -317,13 +324,17 @@ type response struct {
 	Type       string          `json:"type"`
 	Change     string          `json:"change"`
 
+	WarningCount     int       `json:"warning-count"`
+	WarningTimestamp time.Time `json:"warning-timestamp"`
+
 	ResultInfo
 }
 
 // Error is the real value of response.Result when an error occurs.
 type Error struct {
-	Kind    string `json:"kind"`
-	Message string `json:"message"`
+	Kind    string      `json:"kind"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value"`
 
 	StatusCode int
 }
@@ -345,6 +356,8 @@ const (
 	ErrorKindNoUpdateAvailable    = "snap-no-update-available"
 
 	ErrorKindNotSnap = "snap-not-a-snap"
+
+	ErrorKindUnsuccessful = "unsuccessful"
 )
 
 // IsTwoFactorError returns whether the given error is due to problems
@@ -373,6 +386,17 @@ type SysInfo struct {
 	Managed   bool      `json:"managed"`
 
 	KernelVersion string `json:"kernel-version,omitempty"`
+
+	Refresh RefreshInfo `json:"refresh,omitempty"`
+}
+
+// RefreshInfo holds the auto-refresh schedule and the times of the last
+// and next auto-refresh, and the time until which auto-refreshes are held.
+type RefreshInfo struct {
+	Schedule string    `json:"schedule"`
+	Last     time.Time `json:"last,omitempty"`
+	Next     time.Time `json:"next,omitempty"`
+	Hold     time.Time `json:"hold,omitempty"`
 }
 
 func (rsp *response) err() error {
@@ -175,7 +175,8 @@ func (cs *clientSuite) TestClientSysInfo(c *C) {
                      {"series": "16",
                       "version": "2",
                       "os-release": {"id": "ubuntu", "version-id": "16.04"},
-                      "on-classic": true}}`
+                      "on-classic": true,
+                      "refresh": {"schedule": "mon-fri@9:00-11:00", "last": "2017-08-07T10:00:00Z", "next": "2017-08-08T09:30:00Z"}}}`
 	sysInfo, err := cs.cli.SysInfo()
 	c.Check(err, IsNil)
 	c.Check(sysInfo, DeepEquals, &client.SysInfo{
@@ -186,6 +187,11 @@ func (cs *clientSuite) TestClientSysInfo(c *C) {
 			VersionID: "16.04",
 		},
 		OnClassic: true,
+		Refresh: client.RefreshInfo{
+			Schedule: "mon-fri@9:00-11:00",
+			Last:     time.Date(2017, 8, 7, 10, 0, 0, 0, time.UTC),
+			Next:     time.Date(2017, 8, 8, 9, 30, 0, 0, time.UTC),
+		},
 	})
 }
 
@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"net/url"
+)
+
+// Connection describes a connection between a plug and a slot.
+type Connection struct {
+	Slot      SlotRef                `json:"slot"`
+	SlotAttrs map[string]interface{} `json:"slot-attrs,omitempty"`
+	Plug      PlugRef                `json:"plug"`
+	PlugAttrs map[string]interface{} `json:"plug-attrs,omitempty"`
+	Interface string                 `json:"interface"`
+	// Origin is one of "manual", "auto" or "gadget".
+	Origin string `json:"origin"`
+}
+
+// Connections contains information about the connections in the system.
+type Connections struct {
+	// Established lists the connections that are currently made.
+	Established []Connection `json:"established"`
+	// Undesired lists the automatic connections that were disconnected
+	// by the user.
+	Undesired []Connection `json:"undesired,omitempty"`
+	// Plugs and Slots list the plugs and slots that are not connected.
+	Plugs []Plug `json:"plugs,omitempty"`
+	Slots []Slot `json:"slots,omitempty"`
+}
+
+// ConnectionOptions contains the criteria for selecting the connections
+// to list.
+type ConnectionOptions struct {
+	// Snap limits the listing to the connections of the given snap.
+	Snap string
+	// Interface limits the listing to the given interface.
+	Interface string
+	// All also lists the undesired connections and the plugs and
+	// slots that are not connected.
+	All bool
+}
+
+// Connections returns the connections in the system that match the
+// given options.
+func (client *Client) Connections(opts *ConnectionOptions) (Connections, error) {
+	q := make(url.Values)
+	if opts != nil {
+		if opts.Snap != "" {
+			q.Set("snap", opts.Snap)
+		}
+		if opts.Interface != "" {
+			q.Set("interface", opts.Interface)
+		}
+		if opts.All {
+			q.Set("select", "all")
+		}
+	}
+
+	var conns Connections
+	_, err := client.doSync("GET", "/v2/connections", q, nil, nil, &conns)
+	return conns, err
+}
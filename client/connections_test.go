@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientConnectionsCallsEndpoint(c *check.C) {
+	_, _ = cs.cli.Connections(nil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/connections")
+	c.Check(cs.req.URL.RawQuery, check.Equals, "")
+}
+
+func (cs *clientSuite) TestClientConnectionsQuery(c *check.C) {
+	_, _ = cs.cli.Connections(&client.ConnectionOptions{
+		Snap:      "foo",
+		Interface: "network",
+		All:       true,
+	})
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/connections")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"snap":      {"foo"},
+		"interface": {"network"},
+		"select":    {"all"},
+	})
+}
+
+func (cs *clientSuite) TestClientConnections(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {
+			"established": [
+				{
+					"slot": {"snap": "core", "slot": "network"},
+					"plug": {"snap": "foo", "plug": "network"},
+					"plug-attrs": {"attr": "value"},
+					"interface": "network",
+					"origin": "auto"
+				}
+			],
+			"plugs": [
+				{"snap": "foo", "plug": "camera", "interface": "camera"}
+			]
+		}
+	}`
+	conns, err := cs.cli.Connections(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(conns, check.DeepEquals, client.Connections{
+		Established: []client.Connection{
+			{
+				Slot:      client.SlotRef{Snap: "core", Name: "network"},
+				Plug:      client.PlugRef{Snap: "foo", Name: "network"},
+				PlugAttrs: map[string]interface{}{"attr": "value"},
+				Interface: "network",
+				Origin:    "auto",
+			},
+		},
+		Plugs: []client.Plug{
+			{Snap: "foo", Name: "camera", Interface: "camera"},
+		},
+	})
+}
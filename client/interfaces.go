@@ -58,15 +58,31 @@ type SlotRef struct {
 	Name string `json:"slot"`
 }
 
+// ConnectionState describes the recorded state of a connection.
+type ConnectionState struct {
+	Plug      PlugRef `json:"plug"`
+	Slot      SlotRef `json:"slot"`
+	Interface string  `json:"interface,omitempty"`
+	// Auto is true if the connection was made automatically.
+	Auto bool `json:"auto,omitempty"`
+	// ByGadget is true if the connection was requested by the gadget.
+	ByGadget bool `json:"by-gadget,omitempty"`
+	// Undesired is true if the connection was made automatically but
+	// was then disconnected by the user.
+	Undesired bool `json:"undesired,omitempty"`
+}
+
 // Interfaces contains information about all plugs, slots and their connections
 type Interfaces struct {
-	Plugs []Plug `json:"plugs"`
-	Slots []Slot `json:"slots"`
+	Plugs            []Plug            `json:"plugs"`
+	Slots            []Slot            `json:"slots"`
+	ConnectionStates []ConnectionState `json:"connection-states,omitempty"`
 }
 
 // InterfaceAction represents an action performed on the interface system.
 type InterfaceAction struct {
 	Action string `json:"action"`
+	Forget bool   `json:"forget,omitempty"`
 	Plugs  []Plug `json:"plugs,omitempty"`
 	Slots  []Slot `json:"slots,omitempty"`
 }
@@ -104,3 +120,15 @@ func (client *Client) Disconnect(plugSnapName, plugName, slotSnapName, slotName
 		Slots:  []Slot{{Snap: slotSnapName, Name: slotName}},
 	})
 }
+
+// Forget breaks the connection between a plug and a slot and drops any
+// record of it, so that a connection that was made automatically before
+// can be made automatically again.
+func (client *Client) Forget(plugSnapName, plugName, slotSnapName, slotName string) (changeID string, err error) {
+	return client.performInterfaceAction(&InterfaceAction{
+		Action: "disconnect",
+		Forget: true,
+		Plugs:  []Plug{{Snap: plugSnapName, Name: plugName}},
+		Slots:  []Slot{{Snap: slotSnapName, Name: slotName}},
+	})
+}
@@ -168,3 +168,35 @@ func (cs *clientSuite) TestClientDisconnect(c *check.C) {
 		},
 	})
 }
+
+func (cs *clientSuite) TestClientForget(c *check.C) {
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": { },
+		"change": "42"
+	}`
+	id, err := cs.cli.Forget("producer", "plug", "consumer", "slot")
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "42")
+	var body map[string]interface{}
+	decoder := json.NewDecoder(cs.req.Body)
+	err = decoder.Decode(&body)
+	c.Check(err, check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]interface{}{
+		"action": "disconnect",
+		"forget": true,
+		"plugs": []interface{}{
+			map[string]interface{}{
+				"snap": "producer",
+				"plug": "plug",
+			},
+		},
+		"slots": []interface{}{
+			map[string]interface{}{
+				"snap": "consumer",
+				"slot": "slot",
+			},
+		},
+	})
+}
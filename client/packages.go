@@ -61,12 +61,6 @@ type Snap struct {
 	Channels map[string]*snap.ChannelSnapInfo `json:"channels"`
 }
 
-type AppInfo struct {
-	Name    string   `json:"name"`
-	Daemon  string   `json:"daemon"`
-	Aliases []string `json:"aliases"`
-}
-
 type Screenshot struct {
 	URL    string `json:"url"`
 	Width  int64  `json:"width,omitempty"`
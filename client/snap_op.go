@@ -37,6 +37,7 @@ type SnapOptions struct {
 	Classic          bool   `json:"classic,omitempty"`
 	Dangerous        bool   `json:"dangerous,omitempty"`
 	IgnoreValidation bool   `json:"ignore-validation,omitempty"`
+	Purge            bool   `json:"purge,omitempty"`
 }
 
 func (opts *SnapOptions) writeModeFields(mw *multipart.Writer) error {
@@ -72,6 +73,7 @@ type actionData struct {
 type multiActionData struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
+	Purge  bool     `json:"purge,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -140,12 +142,18 @@ func (client *Client) doSnapAction(actionName string, snapName string, options *
 }
 
 func (client *Client) doMultiSnapAction(actionName string, snaps []string, options *SnapOptions) (changeID string, err error) {
+	var purge bool
 	if options != nil {
-		return "", fmt.Errorf("cannot use options for multi-action") // (yet)
+		// purge is the only option supported for multi-action (yet)
+		if *options != (SnapOptions{Purge: options.Purge}) {
+			return "", fmt.Errorf("cannot use options for multi-action") // (yet)
+		}
+		purge = options.Purge
 	}
 	action := multiActionData{
 		Action: actionName,
 		Snaps:  snaps,
+		Purge:  purge,
 	}
 	data, err := json.Marshal(&action)
 	if err != nil {
@@ -175,7 +183,36 @@ func (client *Client) InstallPath(path string, options *SnapOptions) (changeID s
 
 	pr, pw := io.Pipe()
 	mw := multipart.NewWriter(pw)
-	go sendSnapFile(path, f, pw, mw, &action)
+	go sendSnapFile("snap", path, f, pw, mw, &action)
+
+	headers := map[string]string{
+		"Content-Type": mw.FormDataContentType(),
+	}
+
+	return client.doAsync("POST", "/v2/snaps", nil, headers, pr)
+}
+
+// InstallBundle installs all the snaps of the bundle with the given path,
+// verified with the assertions it contains, returning the UUID of the
+// background operation upon success.
+func (client *Client) InstallBundle(path string, options *SnapOptions) (changeID string, err error) {
+	if options != nil && options.Dangerous {
+		return "", ErrDangerousNotApplicable
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open: %q", path)
+	}
+
+	action := actionData{
+		Action:      "install",
+		SnapOptions: options,
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go sendSnapFile("bundle", path, f, pw, mw, &action)
 
 	headers := map[string]string{
 		"Content-Type": mw.FormDataContentType(),
@@ -207,7 +244,7 @@ func (client *Client) Try(path string, options *SnapOptions) (changeID string, e
 	return client.doAsync("POST", "/v2/snaps", nil, headers, buf)
 }
 
-func sendSnapFile(snapPath string, snapFile *os.File, pw *io.PipeWriter, mw *multipart.Writer, action *actionData) {
+func sendSnapFile(field, snapPath string, snapFile *os.File, pw *io.PipeWriter, mw *multipart.Writer, action *actionData) {
 	defer snapFile.Close()
 
 	if action.SnapOptions == nil {
@@ -237,7 +274,7 @@ func sendSnapFile(snapPath string, snapFile *os.File, pw *io.PipeWriter, mw *mul
 		return
 	}
 
-	fw, err := mw.CreateFormFile("snap", filepath.Base(snapPath))
+	fw, err := mw.CreateFormFile(field, filepath.Base(snapPath))
 	if err != nil {
 		pw.CloseWithError(err)
 		return
@@ -198,6 +198,37 @@ func (cs *clientSuite) TestClientOpInstallPath(c *check.C) {
 	c.Check(id, check.Equals, "66b3")
 }
 
+func (cs *clientSuite) TestClientOpInstallBundle(c *check.C) {
+	cs.rsp = `{
+		"change": "66b3",
+		"status-code": 202,
+		"type": "async"
+	}`
+	bodyData := []byte("bundle-data")
+
+	bundle := filepath.Join(c.MkDir(), "snaps.bundle")
+	err := ioutil.WriteFile(bundle, bodyData, 0644)
+	c.Assert(err, check.IsNil)
+
+	id, err := cs.cli.InstallBundle(bundle, nil)
+	c.Assert(err, check.IsNil)
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(string(body), check.Matches, "(?s).*Content-Disposition: form-data; name=\"bundle\"; filename=\"snaps.bundle\"\r\n.*\r\nbundle-data\r\n.*")
+	c.Assert(string(body), check.Matches, "(?s).*Content-Disposition: form-data; name=\"action\"\r\n\r\ninstall\r\n.*")
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+	c.Assert(cs.req.Header.Get("Content-Type"), check.Matches, "multipart/form-data; boundary=.*")
+	c.Check(id, check.Equals, "66b3")
+
+	// bundles are always verified
+	_, err = cs.cli.InstallBundle(bundle, &client.SnapOptions{Dangerous: true})
+	c.Assert(err, check.Equals, client.ErrDangerousNotApplicable)
+}
+
 func (cs *clientSuite) TestClientOpInstallDangerous(c *check.C) {
 	cs.rsp = `{
 		"change": "66b3",
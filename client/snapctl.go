@@ -35,6 +35,16 @@ type SnapCtlOptions struct {
 	Args []string `json:"args"`
 }
 
+// UnsuccessfulError is returned by RunSnapctl when the command ran
+// but wants snapctl to exit with the given non-zero exit code.
+type UnsuccessfulError struct {
+	ExitCode int
+}
+
+func (e *UnsuccessfulError) Error() string {
+	return fmt.Sprintf("unsuccessful with exit code: %d", e.ExitCode)
+}
+
 type snapctlOutput struct {
 	Stdout string `json:"stdout"`
 	Stderr string `json:"stderr"`
@@ -50,6 +60,14 @@ func (client *Client) RunSnapctl(options *SnapCtlOptions) (stdout, stderr []byte
 	var output snapctlOutput
 	_, err = client.doSync("POST", "/v2/snapctl", nil, nil, bytes.NewReader(b), &output)
 	if err != nil {
+		if e, ok := err.(*Error); ok && e.Kind == ErrorKindUnsuccessful {
+			// the command ran, but wants a non-zero exit code
+			value, _ := e.Value.(map[string]interface{})
+			stdout, _ := value["stdout"].(string)
+			stderr, _ := value["stderr"].(string)
+			exitCode, _ := value["exit-code"].(float64)
+			return []byte(stdout), []byte(stderr), &UnsuccessfulError{ExitCode: int(exitCode)}
+		}
 		return nil, nil, err
 	}
 
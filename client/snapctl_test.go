@@ -66,3 +66,29 @@ func (cs *clientSuite) TestClientRunSnapctl(c *check.C) {
 		"args":       []interface{}{"foo", "bar"},
 	})
 }
+
+func (cs *clientSuite) TestClientRunSnapctlUnsuccessful(c *check.C) {
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 200,
+		"result": {
+			"message": "unsuccessful with exit code: 1",
+			"kind": "unsuccessful",
+			"value": {
+				"stdout": "test stdout",
+				"stderr": "test stderr",
+				"exit-code": 1
+			}
+		}
+	}`
+
+	options := &client.SnapCtlOptions{
+		ContextID: "1234ABCD",
+		Args:      []string{"is-connected", "foo"},
+	}
+
+	stdout, stderr, err := cs.cli.RunSnapctl(options)
+	c.Check(err, check.DeepEquals, &client.UnsuccessfulError{ExitCode: 1})
+	c.Check(string(stdout), check.Equals, "test stdout")
+	c.Check(string(stderr), check.Equals, "test stderr")
+}
@@ -0,0 +1,125 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (cs *clientSuite) TestClientSnapshotSetsCallsEndpoint(c *check.C) {
+	_, _ = cs.cli.SnapshotSets(0, nil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+	c.Check(cs.req.URL.Query(), check.HasLen, 0)
+
+	_, _ = cs.cli.SnapshotSets(42, []string{"foo", "bar"})
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"set":   []string{"42"},
+		"snaps": []string{"foo,bar"},
+	})
+}
+
+func (cs *clientSuite) TestClientSnapshotSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [
+			{"id": 1, "snapshots": [
+				{"set": 1, "time": "2017-08-07T10:00:00Z", "snap": "foo", "revision": "7", "version": "1.0", "summary": "", "sha3-384": {"archive.tgz": "abc"}, "size": 10},
+				{"set": 1, "time": "2017-08-07T09:00:00Z", "snap": "bar", "revision": "x1", "version": "2.0", "summary": "", "sha3-384": {}, "size": 20, "auto": true}
+			]}
+		]
+	}`
+	sets, err := cs.cli.SnapshotSets(0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Check(sets[0].ID, check.Equals, uint64(1))
+	c.Check(sets[0].Snapshots, check.DeepEquals, []*client.Snapshot{
+		{SetID: 1, Time: time.Date(2017, 8, 7, 10, 0, 0, 0, time.UTC), Snap: "foo", Revision: snap.R(7), Version: "1.0", SHA3_384: map[string]string{"archive.tgz": "abc"}, Size: 10},
+		{SetID: 1, Time: time.Date(2017, 8, 7, 9, 0, 0, 0, time.UTC), Snap: "bar", Revision: snap.R(-1), Version: "2.0", SHA3_384: map[string]string{}, Size: 20, Auto: true},
+	})
+	c.Check(sets[0].Time(), check.DeepEquals, time.Date(2017, 8, 7, 9, 0, 0, 0, time.UTC))
+	c.Check(sets[0].Size(), check.Equals, int64(30))
+	c.Check(sets[0].Snapshots[0].IsValid(), check.Equals, true)
+	c.Check(sets[0].Snapshots[1].IsValid(), check.Equals, false)
+}
+
+func (cs *clientSuite) testClientSnapshotAction(c *check.C, op func() (string, error), expected map[string]interface{}) {
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": {},
+		"change": "chgid"
+	}`
+	id, err := op()
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "chgid")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, expected)
+}
+
+func (cs *clientSuite) TestClientSnapshotMany(c *check.C) {
+	cs.testClientSnapshotAction(c, func() (string, error) {
+		return cs.cli.SnapshotMany([]string{"foo", "bar"}, []string{"joe"})
+	}, map[string]interface{}{
+		"action": "snapshot",
+		"snaps":  []interface{}{"foo", "bar"},
+		"users":  []interface{}{"joe"},
+	})
+}
+
+func (cs *clientSuite) TestClientCheckSnapshots(c *check.C) {
+	cs.testClientSnapshotAction(c, func() (string, error) {
+		return cs.cli.CheckSnapshots(42, []string{"foo"}, nil)
+	}, map[string]interface{}{
+		"action": "check",
+		"set":    42.,
+		"snaps":  []interface{}{"foo"},
+	})
+}
+
+func (cs *clientSuite) TestClientRestoreSnapshots(c *check.C) {
+	cs.testClientSnapshotAction(c, func() (string, error) {
+		return cs.cli.RestoreSnapshots(42, nil, []string{"joe"})
+	}, map[string]interface{}{
+		"action": "restore",
+		"set":    42.,
+		"users":  []interface{}{"joe"},
+	})
+}
+
+func (cs *clientSuite) TestClientForgetSnapshots(c *check.C) {
+	cs.testClientSnapshotAction(c, func() (string, error) {
+		return cs.cli.ForgetSnapshots(42, nil)
+	}, map[string]interface{}{
+		"action": "forget",
+		"set":    42.,
+	})
+}
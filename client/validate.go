@@ -0,0 +1,132 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ValidationSetResult holds information about a validation set tracked
+// by the system.
+type ValidationSetResult struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	// PinnedAt is the sequence the validation set was pinned at, 0 if
+	// following the latest one.
+	PinnedAt int `json:"pinned-at,omitempty"`
+	// Sequence is the sequence of the validation set in use.
+	Sequence int `json:"sequence"`
+	// Valid is whether the installed snaps satisfy the validation set.
+	Valid bool `json:"valid"`
+}
+
+// ValidateApplyOptions holds the options for applying a validation set.
+type ValidateApplyOptions struct {
+	// Mode is either "monitor" or "enforce".
+	Mode string
+	// Sequence pins the validation set at the given sequence, 0
+	// means following the latest one.
+	Sequence int
+}
+
+type validationSetAction struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode,omitempty"`
+	Sequence int    `json:"sequence,omitempty"`
+}
+
+func validationSetPath(accountID, name string) string {
+	return "/v2/validation-sets/" + accountID + "/" + name
+}
+
+// ListValidationsSets returns the validation sets tracked by the system.
+func (client *Client) ListValidationsSets() ([]*ValidationSetResult, error) {
+	var res []*ValidationSetResult
+	_, err := client.doSync("GET", "/v2/validation-sets", nil, nil, nil, &res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list validation sets: %v", err)
+	}
+	return res, nil
+}
+
+// ValidationSet returns the given validation set if it's tracked by the system.
+func (client *Client) ValidationSet(accountID, name string) (*ValidationSetResult, error) {
+	var res *ValidationSetResult
+	_, err := client.doSync("GET", validationSetPath(accountID, name), nil, nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ApplyValidationSet starts tracking the given validation set in the given
+// mode. When the validation set is enforced and snaps must be installed or
+// refreshed for it, the ID of the change doing that is returned instead
+// of the validation set.
+func (client *Client) ApplyValidationSet(accountID, name string, opts *ValidateApplyOptions) (res *ValidationSetResult, changeID string, err error) {
+	if opts == nil {
+		opts = &ValidateApplyOptions{}
+	}
+	action := validationSetAction{
+		Action:   "apply",
+		Mode:     opts.Mode,
+		Sequence: opts.Sequence,
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(action); err != nil {
+		return nil, "", err
+	}
+
+	var rsp response
+	if err := client.do("POST", validationSetPath(accountID, name), nil, nil, &body, &rsp); err != nil {
+		return nil, "", err
+	}
+	if err := rsp.err(); err != nil {
+		return nil, "", err
+	}
+	client.warningCount = rsp.WarningCount
+	client.warningTimestamp = rsp.WarningTimestamp
+	switch rsp.Type {
+	case "async":
+		if rsp.Change == "" {
+			return nil, "", fmt.Errorf("async response without change reference")
+		}
+		return nil, rsp.Change, nil
+	case "sync":
+		if err := json.Unmarshal(rsp.Result, &res); err != nil {
+			return nil, "", fmt.Errorf("cannot unmarshal: %v", err)
+		}
+		return res, "", nil
+	}
+	return nil, "", fmt.Errorf("unexpected response type %q", rsp.Type)
+}
+
+// ForgetValidationSet stops tracking the given validation set.
+func (client *Client) ForgetValidationSet(accountID, name string) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(validationSetAction{Action: "forget"}); err != nil {
+		return err
+	}
+	_, err := client.doSync("POST", validationSetPath(accountID, name), nil, nil, &body, nil)
+	return err
+}
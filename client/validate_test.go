@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestListValidationSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [
+			{"account-id": "acc", "name": "one", "mode": "monitor", "pinned-at": 2, "sequence": 2, "valid": true},
+			{"account-id": "acc", "name": "two", "mode": "enforce", "sequence": 5, "valid": false}
+		]
+	}`
+	vsets, err := cs.cli.ListValidationsSets()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets")
+	c.Check(vsets, check.DeepEquals, []*client.ValidationSetResult{
+		{AccountID: "acc", Name: "one", Mode: "monitor", PinnedAt: 2, Sequence: 2, Valid: true},
+		{AccountID: "acc", Name: "two", Mode: "enforce", Sequence: 5},
+	})
+}
+
+func (cs *clientSuite) TestValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"account-id": "acc", "name": "one", "mode": "monitor", "sequence": 2, "valid": true}
+	}`
+	vset, err := cs.cli.ValidationSet("acc", "one")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/acc/one")
+	c.Check(vset, check.DeepEquals, &client.ValidationSetResult{AccountID: "acc", Name: "one", Mode: "monitor", Sequence: 2, Valid: true})
+}
+
+func (cs *clientSuite) checkValidationSetAction(c *check.C, expected map[string]interface{}) {
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/acc/one")
+	var body map[string]interface{}
+	data, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(json.Unmarshal(data, &body), check.IsNil)
+	c.Check(body, check.DeepEquals, expected)
+}
+
+func (cs *clientSuite) TestApplyValidationSetSync(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"account-id": "acc", "name": "one", "mode": "monitor", "pinned-at": 3, "sequence": 3, "valid": true}
+	}`
+	vset, chgID, err := cs.cli.ApplyValidationSet("acc", "one", &client.ValidateApplyOptions{Mode: "monitor", Sequence: 3})
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "")
+	c.Check(vset, check.DeepEquals, &client.ValidationSetResult{AccountID: "acc", Name: "one", Mode: "monitor", PinnedAt: 3, Sequence: 3, Valid: true})
+	cs.checkValidationSetAction(c, map[string]interface{}{
+		"action":   "apply",
+		"mode":     "monitor",
+		"sequence": 3.,
+	})
+}
+
+func (cs *clientSuite) TestApplyValidationSetAsync(c *check.C) {
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+	vset, chgID, err := cs.cli.ApplyValidationSet("acc", "one", &client.ValidateApplyOptions{Mode: "enforce"})
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(vset, check.IsNil)
+	cs.checkValidationSetAction(c, map[string]interface{}{
+		"action": "apply",
+		"mode":   "enforce",
+	})
+}
+
+func (cs *clientSuite) TestForgetValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": null
+	}`
+	err := cs.cli.ForgetValidationSet("acc", "one")
+	c.Assert(err, check.IsNil)
+	cs.checkValidationSetAction(c, map[string]interface{}{
+		"action": "forget",
+	})
+}
@@ -602,3 +602,38 @@ void sc_discard_preserved_ns_group(struct sc_ns_group *group)
 		die("cannot move back to original directory");
 	}
 }
+
+bool sc_join_preserved_ns_group(struct sc_ns_group *group)
+{
+	char mnt_fname[PATH_MAX];
+	sc_must_snprintf(mnt_fname, sizeof mnt_fname, "%s%s", group->name,
+			 SC_NS_MNT_FILE);
+	int mnt_fd __attribute__ ((cleanup(sc_cleanup_close))) = -1;
+	mnt_fd =
+	    openat(group->dir_fd, mnt_fname, O_RDONLY | O_CLOEXEC | O_NOFOLLOW);
+	if (mnt_fd < 0) {
+		if (errno == ENOENT) {
+			debug("namespace group %s has no preserved mount namespace",
+			      group->name);
+			return false;
+		}
+		die("cannot open mount namespace file for namespace group %s",
+		    group->name);
+	}
+	// The file reverts to a regular file when the namespace is discarded.
+	struct statfs buf;
+	if (fstatfs(mnt_fd, &buf) < 0) {
+		die("cannot perform fstatfs() on an mount namespace file descriptor");
+	}
+	if (buf.f_type != NSFS_MAGIC && buf.f_type != PROC_SUPER_MAGIC) {
+		debug("namespace group %s has no preserved mount namespace",
+		      group->name);
+		return false;
+	}
+	if (setns(mnt_fd, CLONE_NEWNS) < 0) {
+		die("cannot re-associate the mount namespace with namespace group %s", group->name);
+	}
+	debug("joined the preserved mount namespace of namespace group %s",
+	      group->name);
+	return true;
+}
@@ -100,6 +100,7 @@ void sc_close_ns_group(struct sc_ns_group *group);
  * - sc_should_populate_ns_group()
  * - sc_preserve_populated_ns_group()
  * - sc_discard_preserved_ns_group()
+ * - sc_join_preserved_ns_group()
  **/
 void sc_lock_ns_mutex(struct sc_ns_group *group);
 
@@ -162,4 +163,13 @@ void sc_preserve_populated_ns_group(struct sc_ns_group *group);
  **/
 void sc_discard_preserved_ns_group(struct sc_ns_group *group);
 
+/**
+ * Join the preserved namespace group, if there is one.
+ *
+ * This function re-associates the calling process with the mount namespace
+ * bind-mounted to /run/snapd/ns/${group_name}.mnt and returns true. If there
+ * is no preserved mount namespace then nothing is done and false is returned.
+ **/
+bool sc_join_preserved_ns_group(struct sc_ns_group *group);
+
 #endif
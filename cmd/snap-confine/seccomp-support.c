@@ -21,6 +21,8 @@
 #include <ctype.h>
 #include <errno.h>
 #include <linux/can.h>		// needed for search mappings
+#include <linux/filter.h>
+#include <linux/seccomp.h>
 #include <sched.h>
 #include <search.h>
 #include <stdbool.h>
@@ -31,6 +33,7 @@
 #include <sys/quota.h>
 #include <sys/resource.h>
 #include <sys/socket.h>
+#include <sys/stat.h>
 #include <sys/types.h>
 #include <sys/utsname.h>
 #include <termios.h>
@@ -627,6 +630,66 @@ static void sc_add_seccomp_archs(scmp_filter_ctx * ctx)
 	}
 }
 
+static void sc_set_filter_profile_dir(void)
+{
+	// Note that secure_gettenv will always return NULL when suid, so
+	// SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR can't be (ab)used in that case.
+	if (secure_getenv("SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR") != NULL)
+		filter_profile_dir =
+		    secure_getenv("SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR");
+}
+
+bool sc_read_seccomp_filter(const char *security_tag, struct sock_fprog *prog)
+{
+	// The filter is compiled by snapd for the architecture of its
+	// userspace, along with the compat one; when the kernel is of another
+	// architecture the text profile is used, see sc_add_seccomp_archs().
+	if (get_hostarch() != seccomp_arch_native()) {
+		debug("kernel and userspace architectures differ, "
+		      "not using the precompiled seccomp filter");
+		return false;
+	}
+
+	sc_set_filter_profile_dir();
+	char filter_path[512];	// arbitrary path name limit
+	sc_must_snprintf(filter_path, sizeof(filter_path), "%s/%s.bin",
+			 filter_profile_dir, security_tag);
+
+	FILE *f = fopen(filter_path, "rb");
+	if (f == NULL) {
+		if (errno == ENOENT) {
+			// unrestricted and complain mode profiles are not
+			// compiled, neither are those of older snapd
+			debug("no precompiled seccomp filter %s", filter_path);
+			return false;
+		}
+		die("cannot open %s", filter_path);
+	}
+	struct stat stat_buf;
+	if (fstat(fileno(f), &stat_buf) != 0)
+		die("cannot stat %s", filter_path);
+	size_t len = stat_buf.st_size / sizeof(struct sock_filter);
+	if (stat_buf.st_size <= 0
+	    || stat_buf.st_size % sizeof(struct sock_filter) != 0
+	    || len > BPF_MAXINSNS) {
+		errno = 0;
+		die("invalid seccomp filter %s", filter_path);
+	}
+
+	prog->filter = calloc(len, sizeof(struct sock_filter));
+	if (prog->filter == NULL)
+		die("Out of memory");
+	prog->len = len;
+	if (fread(prog->filter, sizeof(struct sock_filter), len, f) != len)
+		die("cannot read %s", filter_path);
+	if (fclose(f) != 0)
+		die("could not close seccomp filter file");
+
+	debug("read precompiled seccomp filter %s (%zu instructions)",
+	      filter_path, len);
+	return true;
+}
+
 scmp_filter_ctx sc_prepare_seccomp_context(const char *filter_profile)
 {
 	int rc = 0;
@@ -670,11 +733,7 @@ scmp_filter_ctx sc_prepare_seccomp_context(const char *filter_profile)
 		if (seccomp_attr_set(ctx, SCMP_FLTATR_CTL_NNP, 0) != 0)
 			die("Cannot disable nnp");
 
-	// Note that secure_gettenv will always return NULL when suid, so
-	// SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR can't be (ab)used in that case.
-	if (secure_getenv("SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR") != NULL)
-		filter_profile_dir =
-		    secure_getenv("SNAPPY_LAUNCHER_SECCOMP_PROFILE_DIR");
+	sc_set_filter_profile_dir();
 
 	char profile_path[512];	// arbitrary path name limit
 	sc_must_snprintf(profile_path, sizeof(profile_path), "%s/%s",
@@ -751,18 +810,10 @@ scmp_filter_ctx sc_prepare_seccomp_context(const char *filter_profile)
 	return ctx;
 }
 
-void sc_load_seccomp_context(scmp_filter_ctx ctx)
+static void sc_raise_privs_for_seccomp(void)
 {
-	int rc;
 	uid_t real_uid, effective_uid, saved_uid;
 
-	// if sc_prepare_seccomp_context() sees @unrestricted or @complain it bails
-	// out early and destroys the context object. In that case we have nothing
-	// to do.
-	if (ctx == NULL) {
-		return;
-	}
-
 	if (getresuid(&real_uid, &effective_uid, &saved_uid) != 0)
 		die("could not find user IDs");
 
@@ -775,14 +826,10 @@ void sc_load_seccomp_context(scmp_filter_ctx ctx)
 		if (geteuid() != 0)
 			die("raising privs before seccomp_load did not work");
 	}
-	// load it into the kernel
-	debug("loading seccomp profile into the kernel");
-	rc = seccomp_load(ctx);
-	if (rc != 0) {
-		fprintf(stderr, "seccomp_load failed with %i\n", rc);
-		die("aborting");
-	}
-	// drop privileges again
+}
+
+static void sc_drop_privs_after_seccomp(void)
+{
 	debug("dropping privileges after loading seccomp profile");
 	if (geteuid() == 0) {
 		unsigned real_uid = getuid();
@@ -793,6 +840,55 @@ void sc_load_seccomp_context(scmp_filter_ctx ctx)
 	}
 }
 
+void sc_load_seccomp_context(scmp_filter_ctx ctx)
+{
+	int rc;
+
+	// if sc_prepare_seccomp_context() sees @unrestricted or @complain it bails
+	// out early and destroys the context object. In that case we have nothing
+	// to do.
+	if (ctx == NULL) {
+		return;
+	}
+
+	sc_raise_privs_for_seccomp();
+	// load it into the kernel
+	debug("loading seccomp profile into the kernel");
+	rc = seccomp_load(ctx);
+	if (rc != 0) {
+		fprintf(stderr, "seccomp_load failed with %i\n", rc);
+		die("aborting");
+	}
+	sc_drop_privs_after_seccomp();
+}
+
+void sc_load_seccomp_filter(struct sock_fprog *prog)
+{
+	uid_t real_uid, effective_uid, saved_uid;
+
+	if (getresuid(&real_uid, &effective_uid, &saved_uid) != 0)
+		die("could not find user IDs");
+
+	// As with sc_prepare_seccomp_context(), only set nnp when there is no
+	// way to be privileged, the kernel needs either to load the filter.
+	if (real_uid != 0 && effective_uid != 0 && saved_uid != 0)
+		if (prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) != 0)
+			die("cannot set no_new_privs");
+
+	sc_raise_privs_for_seccomp();
+	debug("loading precompiled seccomp filter into the kernel");
+	if (prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, prog) != 0)
+		die("cannot load seccomp filter");
+	sc_drop_privs_after_seccomp();
+}
+
+void sc_cleanup_seccomp_filter(struct sock_fprog *prog)
+{
+	free(prog->filter);
+	prog->filter = NULL;
+	prog->len = 0;
+}
+
 void sc_cleanup_seccomp_release(scmp_filter_ctx * ptr)
 {
 	seccomp_release(*ptr);
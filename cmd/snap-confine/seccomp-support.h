@@ -17,7 +17,42 @@
 #ifndef SNAP_CONFINE_SECCOMP_SUPPORT_H
 #define SNAP_CONFINE_SECCOMP_SUPPORT_H
 
+#include <linux/filter.h>
 #include <seccomp.h>
+#include <stdbool.h>
+
+/**
+ * Read the precompiled seccomp filter associated with the security tag.
+ *
+ * This function reads the BPF program snapd compiled from the seccomp
+ * profile, from /var/lib/snapd/seccomp/profiles/$SECURITY_TAG.bin, into
+ * prog. It returns false if there is no such filter, as is the case for
+ * unrestricted and complain mode profiles or when the kernel is of another
+ * architecture than userspace, and the profile is to be used with
+ * sc_prepare_seccomp_context() instead.
+ *
+ * The filter can be made effective with a call to sc_load_seccomp_filter()
+ * and should be cleaned up with sc_cleanup_seccomp_filter().
+ *
+ * This function calls die() on all errors.
+ **/
+bool sc_read_seccomp_filter(const char *security_tag,
+			    struct sock_fprog *prog);
+
+/**
+ * Load a precompiled seccomp filter.
+ *
+ * This function calls die() if the kernel refuses the filter.
+ **/
+void sc_load_seccomp_filter(struct sock_fprog *prog);
+
+/**
+ * Release a precompiled seccomp filter.
+ *
+ * This function is designed to be used with
+ * __attribute__((cleanup(sc_cleanup_seccomp_filter))).
+ **/
+void sc_cleanup_seccomp_filter(struct sock_fprog *prog);
 
 /**
  * Prepare seccomp profile associated with the security tag.
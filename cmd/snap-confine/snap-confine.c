@@ -108,7 +108,12 @@ int main(int argc, char **argv)
 #ifdef HAVE_SECCOMP
 	scmp_filter_ctx seccomp_ctx
 	    __attribute__ ((cleanup(sc_cleanup_seccomp_release))) = NULL;
-	seccomp_ctx = sc_prepare_seccomp_context(security_tag);
+	struct sock_fprog seccomp_filter
+	    __attribute__ ((cleanup(sc_cleanup_seccomp_filter))) = { 0 };
+	// use the filter snapd compiled if there is one, and the profile
+	// otherwise
+	if (!sc_read_seccomp_filter(security_tag, &seccomp_filter))
+		seccomp_ctx = sc_prepare_seccomp_context(security_tag);
 #endif				// ifdef HAVE_SECCOMP
 
 	if (geteuid() == 0) {
@@ -193,7 +198,10 @@ int main(int argc, char **argv)
 	// https://wiki.ubuntu.com/SecurityTeam/Specifications/SnappyConfinement
 	sc_maybe_aa_change_onexec(&apparmor, security_tag);
 #ifdef HAVE_SECCOMP
-	sc_load_seccomp_context(seccomp_ctx);
+	if (seccomp_filter.filter != NULL)
+		sc_load_seccomp_filter(&seccomp_filter);
+	else
+		sc_load_seccomp_context(seccomp_ctx);
 #endif				// ifdef HAVE_SECCOMP
 
 	// Permanently drop if not root
@@ -0,0 +1,54 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// snap-update-ns-helper applies the changes of the mount profile of a snap
+// to the preserved mount namespace of that snap.
+//
+// It is executed by snap-update-ns after joining the namespace, which cannot
+// be done by a multi-threaded Go program.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/snapcore/snapd/interfaces/mount"
+	"github.com/snapcore/snapd/snap"
+)
+
+// for the tests
+var updateNamespace = mount.UpdateNamespace
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot update snap namespace: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("need the name of the snap as the only argument")
+	}
+	snapName := args[0]
+	if err := snap.ValidateName(snapName); err != nil {
+		return err
+	}
+	return updateNamespace(snapName)
+}
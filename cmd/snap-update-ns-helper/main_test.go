@@ -0,0 +1,59 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/mount"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type helperSuite struct{}
+
+var _ = Suite(&helperSuite{})
+
+func (s *helperSuite) TearDownTest(c *C) {
+	updateNamespace = mount.UpdateNamespace
+}
+
+func (s *helperSuite) TestRun(c *C) {
+	var updated []string
+	updateNamespace = func(snapName string) error {
+		updated = append(updated, snapName)
+		return nil
+	}
+	c.Assert(run([]string{"foo"}), IsNil)
+	c.Check(updated, DeepEquals, []string{"foo"})
+}
+
+func (s *helperSuite) TestRunBadArgs(c *C) {
+	updateNamespace = func(snapName string) error {
+		c.Fatalf("unexpected update of %q", snapName)
+		return nil
+	}
+	c.Check(run(nil), ErrorMatches, "need the name of the snap as the only argument")
+	c.Check(run([]string{"foo", "bar"}), ErrorMatches, "need the name of the snap as the only argument")
+	c.Check(run([]string{"Foo!"}), ErrorMatches, `invalid snap name: "Foo!"`)
+}
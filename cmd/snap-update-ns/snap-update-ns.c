@@ -19,7 +19,64 @@
 #include "config.h"
 #endif
 
-int main(int arch, char **argv)
+#include <fcntl.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "../libsnap-confine-private/cleanup-funcs.h"
+#include "../libsnap-confine-private/error.h"
+#include "../libsnap-confine-private/snap.h"
+#include "../libsnap-confine-private/utils.h"
+#include "../snap-confine/ns-support.h"
+
+extern char **environ;
+
+int main(int argc, char **argv)
 {
+	if (argc != 2)
+		die("Usage: %s snap-name", argv[0]);
+	const char *snap_name = argv[1];
+	struct sc_error *err = NULL;
+	sc_snap_name_validate(snap_name, &err);
+	sc_die_on_error(err);
+
+	// The helper is opened before joining the mount namespace of the snap
+	// where the libexec directory of the host is not visible.
+	int helper_fd __attribute__ ((cleanup(sc_cleanup_close))) = -1;
+	helper_fd = open(LIBEXECDIR "/snap-update-ns-helper",
+			 O_RDONLY | O_CLOEXEC);
+	if (helper_fd < 0) {
+		die("cannot open snap-update-ns-helper");
+	}
+	struct sc_ns_group *group =
+	    sc_open_ns_group(snap_name, SC_NS_FAIL_GRACEFULLY);
+	if (group == NULL) {
+		return 0;
+	}
+	// The lock is held until the helper is done so that the namespace is
+	// not populated, discarded or updated by anyone else in the meantime.
+	sc_lock_ns_mutex(group);
+	int status = 0;
+	if (sc_join_preserved_ns_group(group)) {
+		pid_t child = fork();
+		if (child < 0) {
+			die("cannot fork helper process");
+		}
+		if (child == 0) {
+			char *helper_argv[] =
+			    { "snap-update-ns-helper", (char *)snap_name, NULL };
+			fexecve(helper_fd, helper_argv, environ);
+			die("cannot execute snap-update-ns-helper");
+		}
+		if (waitpid(child, &status, 0) < 0) {
+			die("cannot wait for helper process");
+		}
+	}
+	sc_unlock_ns_mutex(group);
+	sc_close_ns_group(group);
+	if (WIFEXITED(status)) {
+		return WEXITSTATUS(status);
+	}
 	return 1;
 }
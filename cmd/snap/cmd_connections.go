@@ -0,0 +1,136 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdConnections struct {
+	All        bool   `long:"all"`
+	Interface  string `short:"i" long:"interface"`
+	Format     string `long:"format" choice:"table" choice:"json" default:"table"`
+	Positional struct {
+		Snap installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"true"`
+}
+
+var shortConnectionsHelp = i18n.G("List interface connections")
+var longConnectionsHelp = i18n.G(`
+The connections command lists the connections between plugs and slots in
+the system, one per line.
+
+$ snap connections <snap>
+
+Lists only the connections of the given snap.
+
+$ snap connections --all
+
+Also lists the plugs and slots that are not connected, as well as the
+connections that were made automatically and then disconnected by the
+user, which are noted as undesired.
+
+The Notes column tells whether a connection was made manually, or
+automatically either by snapd or as requested by the gadget. Use
+--format=json for output suitable for processing by other programs.
+`)
+
+func init() {
+	addCommand("connections", shortConnectionsHelp, longConnectionsHelp, func() flags.Commander {
+		return &cmdConnections{}
+	}, map[string]string{
+		"all":       i18n.G("Show plugs and slots that are not connected as well"),
+		"interface": i18n.G("Constrain listing to the given interface"),
+		"format":    i18n.G("Output format: table or json"),
+	}, []argDesc{{
+		name: "<snap>",
+		desc: i18n.G("Constrain listing to the given snap"),
+	}})
+}
+
+func (x *cmdConnections) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	conns, err := Client().Connections(&client.ConnectionOptions{
+		Snap:      string(x.Positional.Snap),
+		Interface: x.Interface,
+		All:       x.All,
+	})
+	if err != nil {
+		return err
+	}
+
+	if x.Format == "json" {
+		out, err := json.MarshalIndent(conns, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", out)
+		return nil
+	}
+
+	if len(conns.Established) == 0 && len(conns.Undesired) == 0 && len(conns.Plugs) == 0 && len(conns.Slots) == 0 {
+		if x.Positional.Snap != "" || x.Interface != "" {
+			fmt.Fprintln(Stderr, i18n.G("No matching connections found."))
+		} else {
+			fmt.Fprintln(Stderr, i18n.G("No connections found."))
+		}
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Interface\tPlug\tSlot\tNotes"))
+	for _, conn := range conns.Established {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", conn.Interface, plugRefStr(conn.Plug), slotRefStr(conn.Slot), conn.Origin)
+	}
+	for _, conn := range conns.Undesired {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", conn.Interface, plugRefStr(conn.Plug), slotRefStr(conn.Slot), "undesired")
+	}
+	for _, plug := range conns.Plugs {
+		fmt.Fprintf(w, "%s\t%s\t-\t-\n", plug.Interface, plugRefStr(client.PlugRef{Snap: plug.Snap, Name: plug.Name}))
+	}
+	for _, slot := range conns.Slots {
+		fmt.Fprintf(w, "%s\t-\t%s\t-\n", slot.Interface, slotRefStr(client.SlotRef{Snap: slot.Snap, Name: slot.Name}))
+	}
+	return nil
+}
+
+func plugRefStr(ref client.PlugRef) string {
+	return fmt.Sprintf("%s:%s", ref.Snap, ref.Name)
+}
+
+// slotRefStr uses the abbreviated syntax for the slots of the core snap,
+// like the interfaces command.
+func slotRefStr(ref client.SlotRef) string {
+	if ref.Snap == "core" || ref.Snap == "ubuntu-core" {
+		return ":" + ref.Name
+	}
+	return fmt.Sprintf("%s:%s", ref.Snap, ref.Name)
+}
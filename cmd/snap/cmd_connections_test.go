@@ -0,0 +1,151 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/snapcore/snapd/cmd/snap"
+)
+
+const connectionsResult = `{
+	"type": "sync",
+	"result": {
+		"established": [
+			{
+				"slot": {"snap": "core", "slot": "network"},
+				"plug": {"snap": "foo", "plug": "network"},
+				"interface": "network",
+				"origin": "auto"
+			},
+			{
+				"slot": {"snap": "bar", "slot": "dbus-svc"},
+				"slot-attrs": {"bus": "session"},
+				"plug": {"snap": "foo", "plug": "dbus-client"},
+				"interface": "dbus",
+				"origin": "manual"
+			}
+		],
+		"undesired": [
+			{
+				"slot": {"snap": "core", "slot": "camera"},
+				"plug": {"snap": "foo", "plug": "camera"},
+				"interface": "camera",
+				"origin": "auto"
+			}
+		],
+		"plugs": [
+			{"snap": "foo", "plug": "camera", "interface": "camera"}
+		],
+		"slots": [
+			{"snap": "bar", "slot": "unused", "interface": "content"}
+		]
+	}
+}`
+
+func (s *SnapSuite) TestConnections(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/connections")
+		c.Check(r.URL.Query(), DeepEquals, url.Values{
+			"snap":   {"foo"},
+			"select": {"all"},
+		})
+		fmt.Fprintln(w, connectionsResult)
+	})
+	rest, err := Parser().ParseArgs([]string{"connections", "--all", "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, ""+
+		"Interface  Plug             Slot          Notes\n"+
+		"network    foo:network      :network      auto\n"+
+		"dbus       foo:dbus-client  bar:dbus-svc  manual\n"+
+		"camera     foo:camera       :camera       undesired\n"+
+		"camera     foo:camera       -             -\n"+
+		"content    -                bar:unused    -\n")
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestConnectionsJSON(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/connections")
+		c.Check(r.URL.Query(), DeepEquals, url.Values{
+			"interface": {"dbus"},
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {"established": [
+			{
+				"slot": {"snap": "bar", "slot": "dbus-svc"},
+				"slot-attrs": {"bus": "session"},
+				"plug": {"snap": "foo", "plug": "dbus-client"},
+				"interface": "dbus",
+				"origin": "manual"
+			}
+		]}}`)
+	})
+	rest, err := Parser().ParseArgs([]string{"connections", "-i", "dbus", "--format=json"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, `{
+  "established": [
+    {
+      "slot": {
+        "snap": "bar",
+        "slot": "dbus-svc"
+      },
+      "slot-attrs": {
+        "bus": "session"
+      },
+      "plug": {
+        "snap": "foo",
+        "plug": "dbus-client"
+      },
+      "interface": "dbus",
+      "origin": "manual"
+    }
+  ]
+}
+`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestConnectionsNoneFound(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": {"established": []}}`)
+	})
+	_, err := Parser().ParseArgs([]string{"connections"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "No connections found.\n")
+
+	s.ResetStdStreams()
+	_, err = Parser().ParseArgs([]string{"connections", "foo"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "No matching connections found.\n")
+}
+
+func (s *SnapSuite) TestConnectionsBadFormat(c *C) {
+	_, err := Parser().ParseArgs([]string{"connections", "--format=yaml"})
+	c.Assert(err, ErrorMatches, `Invalid value .yaml. for option .--format.*`)
+}
@@ -0,0 +1,97 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/snap/snapdelta"
+)
+
+type cmdDelta struct {
+	Positional struct {
+		Operation string
+		Source    string
+		Input     string
+		Output    string
+	} `positional-args:"yes" required:"yes"`
+}
+
+var shortDeltaHelp = i18n.G("Create or apply a delta between two snap files")
+var longDeltaHelp = i18n.G(`
+The delta command creates or applies binary deltas between snap files,
+without needing the store, e.g. to update snaps from a local mirror.
+
+'snap delta create <old.snap> <new.snap> <delta>' writes a delta that
+reconstructs the new snap from the old one.
+
+'snap delta apply <old.snap> <delta> <new.snap>' reconstructs the new
+snap, verifying it against the digest recorded in the delta.
+`)
+
+func init() {
+	addCommand("delta",
+		shortDeltaHelp,
+		longDeltaHelp,
+		func() flags.Commander {
+			return &cmdDelta{}
+		}, nil, []argDesc{{
+			name: i18n.G("<operation>"),
+			desc: i18n.G("Either 'create' or 'apply'"),
+		}, {
+			name: i18n.G("<source>"),
+			desc: i18n.G("The snap file the delta is based on"),
+		}, {
+			name: i18n.G("<input>"),
+			desc: i18n.G("The new snap file to create, or the delta file to apply"),
+		}, {
+			name: i18n.G("<output>"),
+			desc: i18n.G("The delta file to write, or the snap file to reconstruct"),
+		}})
+}
+
+func (x *cmdDelta) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	source, input, output := x.Positional.Source, x.Positional.Input, x.Positional.Output
+	switch x.Positional.Operation {
+	case "create":
+		if err := snapdelta.Create(source, input, output); err != nil {
+			return err
+		}
+		// TRANSLATORS: the first %s is the delta file, the second and third are snap files
+		fmt.Fprintf(Stdout, i18n.G("Created delta %s from %s to %s\n"), output, source, input)
+	case "apply":
+		if _, err := snapdelta.Apply(source, input, output); err != nil {
+			return err
+		}
+		// TRANSLATORS: the first %s is a snap file, the second a delta file
+		fmt.Fprintf(Stdout, i18n.G("Reconstructed %s from %s\n"), output, input)
+	default:
+		// TRANSLATORS: %q is the operation given by the user
+		return fmt.Errorf(i18n.G("unknown delta operation %q (expected 'create' or 'apply')"), x.Positional.Operation)
+	}
+	return nil
+}
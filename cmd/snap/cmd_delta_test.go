@@ -0,0 +1,71 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type SnapDeltaSuite struct {
+	BaseSnapSuite
+}
+
+var _ = Suite(&SnapDeltaSuite{})
+
+func (s *SnapDeltaSuite) TestDeltaCreateAndApply(c *C) {
+	mockXdelta3 := testutil.MockCommand(c, "xdelta3", `if [ "$1" = "-e" ]; then cat "$5"; else cat; fi`)
+	defer mockXdelta3.Restore()
+
+	dir := c.MkDir()
+	oldSnap := filepath.Join(dir, "foo_1.snap")
+	newSnap := filepath.Join(dir, "foo_2.snap")
+	delta := filepath.Join(dir, "foo_1_2.delta")
+	reconstructed := filepath.Join(dir, "foo_2_reconstructed.snap")
+	c.Assert(ioutil.WriteFile(oldSnap, []byte("old"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(newSnap, []byte("new"), 0644), IsNil)
+
+	rest, err := snap.Parser().ParseArgs([]string{"delta", "create", oldSnap, newSnap, delta})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "Created delta "+delta+" from "+oldSnap+" to "+newSnap+"\n")
+
+	s.stdout.Reset()
+	rest, err = snap.Parser().ParseArgs([]string{"delta", "apply", oldSnap, delta, reconstructed})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "Reconstructed "+reconstructed+" from "+delta+"\n")
+	c.Check(s.Stderr(), Equals, "")
+
+	content, err := ioutil.ReadFile(reconstructed)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "new")
+}
+
+func (s *SnapDeltaSuite) TestDeltaUnknownOperation(c *C) {
+	_, err := snap.Parser().ParseArgs([]string{"delta", "merge", "a", "b", "c"})
+	c.Assert(err, ErrorMatches, `unknown delta operation "merge" \(expected 'create' or 'apply'\)`)
+	c.Check(s.Stdout(), Equals, "")
+}
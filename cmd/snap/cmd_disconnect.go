@@ -28,6 +28,7 @@ import (
 )
 
 type cmdDisconnect struct {
+	Forget      bool `long:"forget"`
 	Positionals struct {
 		Offer SnapAndName `required:"true"`
 		Use   SnapAndName
@@ -47,12 +48,19 @@ $ snap disconnect <snap>:<slot or plug>
 
 Disconnects everything from the provided plug or slot.
 The snap name may be omitted for the core snap.
+
+Connections that were made automatically are remembered as disconnected,
+so that they are not made again automatically, for example when the snap
+is refreshed. With --forget that record is dropped as well, letting the
+connection be made automatically again.
 `)
 
 func init() {
 	addCommand("disconnect", shortDisconnectHelp, longDisconnectHelp, func() flags.Commander {
 		return &cmdDisconnect{}
-	}, nil, []argDesc{
+	}, map[string]string{
+		"forget": i18n.G("Forget remembered state about the given connection"),
+	}, []argDesc{
 		{name: i18n.G("<snap>:<plug>")},
 		{name: i18n.G("<snap>:<slot>")},
 	})
@@ -74,7 +82,11 @@ func (x *cmdDisconnect) Execute(args []string) error {
 	}
 
 	cli := Client()
-	id, err := cli.Disconnect(x.Positionals.Offer.Snap, x.Positionals.Offer.Name, x.Positionals.Use.Snap, x.Positionals.Use.Name)
+	disconnect := cli.Disconnect
+	if x.Forget {
+		disconnect = cli.Forget
+	}
+	id, err := disconnect(x.Positionals.Offer.Snap, x.Positionals.Offer.Name, x.Positionals.Use.Snap, x.Positionals.Use.Name)
 	if err != nil {
 		return err
 	}
@@ -30,7 +30,7 @@ import (
 
 func (s *SnapSuite) TestDisconnectHelp(c *C) {
 	msg := `Usage:
-  snap.test [OPTIONS] disconnect [<snap>:<plug>] [<snap>:<slot>]
+  snap.test [OPTIONS] disconnect [disconnect-OPTIONS] [<snap>:<plug>] [<snap>:<slot>]
 
 The disconnect command disconnects a plug from a slot.
 It may be called in the following ways:
@@ -44,11 +44,19 @@ $ snap disconnect <snap>:<slot or plug>
 Disconnects everything from the provided plug or slot.
 The snap name may be omitted for the core snap.
 
+Connections that were made automatically are remembered as disconnected,
+so that they are not made again automatically, for example when the snap
+is refreshed. With --forget that record is dropped as well, letting the
+connection be made automatically again.
+
 Application Options:
       --version            Print the version and exit
 
 Help Options:
   -h, --help               Show this help message
+
+[disconnect command options]
+          --forget         Forget remembered state about the given connection
 `
 	rest, err := Parser().ParseArgs([]string{"disconnect", "--help"})
 	c.Assert(err.Error(), Equals, msg)
@@ -90,6 +98,42 @@ func (s *SnapSuite) TestDisconnectExplicitEverything(c *C) {
 	c.Assert(s.Stderr(), Equals, "")
 }
 
+func (s *SnapSuite) TestDisconnectForget(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/interfaces":
+			c.Check(r.Method, Equals, "POST")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "disconnect",
+				"forget": true,
+				"plugs": []interface{}{
+					map[string]interface{}{
+						"snap": "producer",
+						"plug": "plug",
+					},
+				},
+				"slots": []interface{}{
+					map[string]interface{}{
+						"snap": "consumer",
+						"slot": "slot",
+					},
+				},
+			})
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "zzz"}`)
+		case "/v2/changes/zzz":
+			c.Check(r.Method, Equals, "GET")
+			fmt.Fprintln(w, `{"type":"sync", "result":{"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+	rest, err := Parser().ParseArgs([]string{"disconnect", "--forget", "producer:plug", "consumer:slot"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Assert(s.Stdout(), Equals, "")
+	c.Assert(s.Stderr(), Equals, "")
+}
+
 func (s *SnapSuite) TestDisconnectEverythingFromSpecificSlot(c *C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
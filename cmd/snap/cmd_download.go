@@ -20,7 +20,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -32,14 +34,16 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
 )
 
 type cmdDownload struct {
 	channelMixin
 	Revision string `long:"revision"`
+	Bundle   bool   `long:"bundle"`
 
 	Positional struct {
-		Snap remoteSnapName
+		Snaps []remoteSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"true" required:"true"`
 }
 
@@ -47,6 +51,12 @@ var shortDownloadHelp = i18n.G("Downloads the given snap")
 var longDownloadHelp = i18n.G(`
 The download command downloads the given snap and its supporting assertions
 to the current directory under .snap and .assert file extensions, respectively.
+
+With --bundle, the given snaps and all their supporting assertions are
+written to the current directory as a single bundle file, which can be
+installed with 'snap install --bundle' on systems without store access.
+The snaps they need, the core snap or their base and their default
+content providers, are added to the bundle as well.
 `)
 
 func init() {
@@ -54,17 +64,22 @@ func init() {
 		return &cmdDownload{}
 	}, channelDescs.also(map[string]string{
 		"revision": i18n.G("Download the given revision of a snap, to which you must have developer access"),
+		"bundle":   i18n.G("Download the given snaps and their assertions into a single bundle file"),
 	}), []argDesc{{
 		name: "<snap>",
 		desc: i18n.G("Snap name"),
 	}})
 }
 
-func fetchSnapAssertions(tsto *image.ToolingStore, snapPath string, snapInfo *snap.Info) error {
-	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+func newAssertionsDB() (*asserts.Database, error) {
+	return asserts.OpenDatabase(&asserts.DatabaseConfig{
 		Backstore: asserts.NewMemoryBackstore(),
 		Trusted:   sysdb.Trusted(),
 	})
+}
+
+func fetchSnapAssertions(tsto *image.ToolingStore, snapPath string, snapInfo *snap.Info) error {
+	db, err := newAssertionsDB()
 	if err != nil {
 		return err
 	}
@@ -106,13 +121,29 @@ func (x *cmdDownload) Execute(args []string) error {
 		}
 	}
 
-	snapName := string(x.Positional.Snap)
+	snapNames := make([]string, len(x.Positional.Snaps))
+	for i, name := range x.Positional.Snaps {
+		snapNames[i] = string(name)
+	}
+
+	if !x.Bundle && len(snapNames) > 1 {
+		return errors.New(i18n.G("a single snap name is needed unless --bundle is given"))
+	}
+	if x.Revision != "" && len(snapNames) > 1 {
+		return errors.New(i18n.G("a single snap name is needed to specify the revision"))
+	}
 
 	tsto, err := image.NewToolingStore()
 	if err != nil {
 		return err
 	}
 
+	if x.Bundle {
+		return x.downloadBundle(tsto, snapNames, revision)
+	}
+
+	snapName := snapNames[0]
+
 	fmt.Fprintf(Stderr, i18n.G("Fetching snap %q\n"), snapName)
 	dlOpts := image.DownloadOptions{
 		TargetDir: "", // cwd
@@ -131,3 +162,92 @@ func (x *cmdDownload) Execute(args []string) error {
 
 	return nil
 }
+
+func readSnapFileInfo(snapPath string) (*snap.Info, error) {
+	snapf, err := snap.Open(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ReadInfoFromSnapFile(snapf, nil)
+}
+
+func (x *cmdDownload) downloadBundle(tsto *image.ToolingStore, snapNames []string, revision snap.Revision) error {
+	dir, err := ioutil.TempDir("", "snap-download-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := newAssertionsDB()
+	if err != nil {
+		return err
+	}
+	// the fetcher saves prerequisites before the assertions
+	// depending on them, and each assertion only once
+	var assertions []asserts.Assertion
+	save := func(a asserts.Assertion) error {
+		assertions = append(assertions, a)
+		return nil
+	}
+	f := tsto.AssertionFetcher(db, save)
+
+	// the snaps needed to install the given ones are added to the
+	// bundle as well, as it is meant for systems without store access
+	toFetch := make([]string, 0, len(snapNames))
+	queued := make(map[string]bool, len(snapNames))
+	for _, snapName := range snapNames {
+		if !queued[snapName] {
+			queued[snapName] = true
+			toFetch = append(toFetch, snapName)
+		}
+	}
+	requested := len(toFetch)
+	haveCore := false
+	snapPaths := make([]string, 0, len(snapNames))
+	for i := 0; i < len(toFetch); i++ {
+		snapName := toFetch[i]
+		dlOpts := image.DownloadOptions{
+			TargetDir: dir,
+			Channel:   x.Channel,
+		}
+		snapRevision := revision
+		if i >= requested {
+			if snapName == snapbundle.CoreSnapName && haveCore {
+				continue
+			}
+			// prerequisites are not what channel and revision refer to
+			dlOpts.Channel = "stable"
+			snapRevision = snap.R(0)
+		}
+
+		fmt.Fprintf(Stderr, i18n.G("Fetching snap %q\n"), snapName)
+		snapPath, snapInfo, err := tsto.DownloadSnap(snapName, snapRevision, &dlOpts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(Stderr, i18n.G("Fetching assertions for %q\n"), snapName)
+		if _, err := image.FetchAndCheckSnapAssertions(snapPath, snapInfo, f, db); err != nil {
+			return err
+		}
+		snapPaths = append(snapPaths, snapPath)
+
+		info, err := readSnapFileInfo(snapPath)
+		if err != nil {
+			return err
+		}
+		if info.Type == snap.TypeOS {
+			haveCore = true
+		}
+		for _, prereq := range snapbundle.Prerequisites(info) {
+			if !queued[prereq] {
+				queued[prereq] = true
+				toFetch = append(toFetch, prereq)
+			}
+		}
+	}
+
+	path := strings.Join(snapNames, "+") + ".bundle"
+	fmt.Fprintf(Stderr, i18n.G("Writing bundle %q\n"), path)
+	return snapbundle.Create(path, snapPaths, assertions)
+}
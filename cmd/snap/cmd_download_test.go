@@ -0,0 +1,42 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+type SnapDownloadSuite struct {
+	BaseSnapSuite
+}
+
+var _ = check.Suite(&SnapDownloadSuite{})
+
+func (s *SnapDownloadSuite) TestDownloadManyNeedsBundle(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"download", "one", "two"})
+	c.Check(err, check.ErrorMatches, "a single snap name is needed unless --bundle is given")
+}
+
+func (s *SnapDownloadSuite) TestDownloadBundleRevisionNeedsSingleSnap(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"download", "--bundle", "--revision", "1", "one", "two"})
+	c.Check(err, check.ErrorMatches, "a single snap name is needed to specify the revision")
+}
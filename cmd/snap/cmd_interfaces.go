@@ -21,7 +21,9 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
 
 	"github.com/jessevdk/go-flags"
@@ -74,9 +76,11 @@ func (x *cmdInterfaces) Execute(args []string) error {
 		if len(ifaces.Plugs) == 0 && len(ifaces.Slots) == 0 {
 			return fmt.Errorf(i18n.G("no interfaces found"))
 		}
-		w := tabWriter()
-		fmt.Fprintln(w, i18n.G("Slot\tPlug"))
-		defer w.Flush()
+		states := make(map[connKey]client.ConnectionState, len(ifaces.ConnectionStates))
+		for _, cs := range ifaces.ConnectionStates {
+			states[connKey{cs.Plug, cs.Slot}] = cs
+		}
+		var rows []interfacesRow
 		for _, slot := range ifaces.Slots {
 			if wanted := x.Positionals.Query.Snap; wanted != "" {
 				ok := wanted == slot.Snap
@@ -93,28 +97,39 @@ func (x *cmdInterfaces) Execute(args []string) error {
 			if x.Interface != "" && slot.Interface != x.Interface {
 				continue
 			}
+			var row interfacesRow
 			// The OS snap is special and enable abbreviated
 			// display syntax on the slot-side of the connection.
 			if slot.Snap == "core" || slot.Snap == "ubuntu-core" {
-				fmt.Fprintf(w, ":%s\t", slot.Name)
+				row.slot = fmt.Sprintf(":%s", slot.Name)
 			} else {
-				fmt.Fprintf(w, "%s:%s\t", slot.Snap, slot.Name)
+				row.slot = fmt.Sprintf("%s:%s", slot.Snap, slot.Name)
 			}
-			for i := 0; i < len(slot.Connections); i++ {
-				if i > 0 {
-					fmt.Fprint(w, ",")
-				}
-				if slot.Connections[i].Name != slot.Name {
-					fmt.Fprintf(w, "%s:%s", slot.Connections[i].Snap, slot.Connections[i].Name)
+			slotRef := client.SlotRef{Snap: slot.Snap, Name: slot.Name}
+			var plugs, origins []string
+			for _, plugRef := range slot.Connections {
+				if plugRef.Name != slot.Name {
+					plugs = append(plugs, fmt.Sprintf("%s:%s", plugRef.Snap, plugRef.Name))
 				} else {
-					fmt.Fprintf(w, "%s", slot.Connections[i].Snap)
+					plugs = append(plugs, plugRef.Snap)
 				}
+				origins = appendOrigin(origins, states[connKey{plugRef, slotRef}])
 			}
 			// Display visual indicator for disconnected slots
 			if len(slot.Connections) == 0 {
-				fmt.Fprint(w, "-")
+				row.plug = "-"
+				if hasUndesired(ifaces.ConnectionStates, slot.Snap, slot.Name) {
+					row.notes = "undesired"
+				}
+			} else {
+				row.plug = strings.Join(plugs, ",")
+				// manual connections are the norm, only point
+				// them out when mixed with other ones
+				if len(origins) > 1 || len(origins) == 1 && origins[0] != "manual" {
+					row.notes = strings.Join(origins, ",")
+				}
 			}
-			fmt.Fprintf(w, "\n")
+			rows = append(rows, row)
 		}
 		// Plugs are treated differently. Since the loop above already printed each connected
 		// plug, the loop below focuses on printing just the disconnected plugs.
@@ -130,9 +145,80 @@ func (x *cmdInterfaces) Execute(args []string) error {
 			}
 			// Display visual indicator for disconnected plugs.
 			if len(plug.Connections) == 0 {
-				fmt.Fprintf(w, "-\t%s:%s\n", plug.Snap, plug.Name)
+				row := interfacesRow{slot: "-", plug: fmt.Sprintf("%s:%s", plug.Snap, plug.Name)}
+				if hasUndesired(ifaces.ConnectionStates, plug.Snap, plug.Name) {
+					row.notes = "undesired"
+				}
+				rows = append(rows, row)
+			}
+		}
+
+		withNotes := false
+		for _, row := range rows {
+			if row.notes != "" {
+				withNotes = true
+				break
+			}
+		}
+		w := tabWriter()
+		defer w.Flush()
+		if withNotes {
+			fmt.Fprintln(w, i18n.G("Slot\tPlug\tNotes"))
+		} else {
+			fmt.Fprintln(w, i18n.G("Slot\tPlug"))
+		}
+		for _, row := range rows {
+			if withNotes {
+				notes := row.notes
+				if notes == "" {
+					notes = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", row.slot, row.plug, notes)
+			} else {
+				fmt.Fprintf(w, "%s\t%s\n", row.slot, row.plug)
 			}
 		}
 	}
 	return err
 }
+
+type connKey struct {
+	plug client.PlugRef
+	slot client.SlotRef
+}
+
+type interfacesRow struct {
+	slot, plug, notes string
+}
+
+// appendOrigin appends how the given connection was made to origins,
+// unless it is already listed there.
+func appendOrigin(origins []string, cs client.ConnectionState) []string {
+	origin := "manual"
+	switch {
+	case cs.ByGadget:
+		origin = "gadget"
+	case cs.Auto:
+		origin = "auto"
+	}
+	for _, o := range origins {
+		if o == origin {
+			return origins
+		}
+	}
+	return append(origins, origin)
+}
+
+// hasUndesired returns whether a connection of the given plug or slot was
+// disconnected by the user after being made automatically.
+func hasUndesired(states []client.ConnectionState, snapName, name string) bool {
+	for _, cs := range states {
+		if !cs.Undesired {
+			continue
+		}
+		if cs.Plug.Snap == snapName && cs.Plug.Name == name || cs.Slot.Snap == snapName && cs.Slot.Name == name {
+			return true
+		}
+	}
+	return false
+}
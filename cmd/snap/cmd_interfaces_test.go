@@ -525,3 +525,101 @@ func (s *SnapSuite) TestInterfacesNothingAtAll(c *C) {
 	c.Assert(s.Stdout(), Equals, "")
 	c.Assert(s.Stderr(), Equals, "")
 }
+
+func (s *SnapSuite) TestInterfacesConnectionNotes(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/interfaces")
+		EncodeResponseBody(c, w, map[string]interface{}{
+			"type": "sync",
+			"result": client.Interfaces{
+				Slots: []client.Slot{
+					{
+						Snap:      "core",
+						Name:      "network",
+						Interface: "network",
+						Connections: []client.PlugRef{
+							{Snap: "foo", Name: "network"},
+							{Snap: "bar", Name: "network"},
+						},
+					},
+					{
+						Snap:      "core",
+						Name:      "home",
+						Interface: "home",
+						Connections: []client.PlugRef{
+							{Snap: "foo", Name: "home"},
+						},
+					},
+					{
+						Snap:      "core",
+						Name:      "camera",
+						Interface: "camera",
+					},
+				},
+				Plugs: []client.Plug{
+					{
+						Snap:        "foo",
+						Name:        "network",
+						Interface:   "network",
+						Connections: []client.SlotRef{{Snap: "core", Name: "network"}},
+					},
+					{
+						Snap:        "bar",
+						Name:        "network",
+						Interface:   "network",
+						Connections: []client.SlotRef{{Snap: "core", Name: "network"}},
+					},
+					{
+						Snap:        "foo",
+						Name:        "home",
+						Interface:   "home",
+						Connections: []client.SlotRef{{Snap: "core", Name: "home"}},
+					},
+					{
+						Snap:      "foo",
+						Name:      "camera",
+						Interface: "camera",
+					},
+				},
+				ConnectionStates: []client.ConnectionState{
+					{
+						Plug:      client.PlugRef{Snap: "foo", Name: "network"},
+						Slot:      client.SlotRef{Snap: "core", Name: "network"},
+						Interface: "network",
+						Auto:      true,
+					},
+					{
+						Plug:      client.PlugRef{Snap: "bar", Name: "network"},
+						Slot:      client.SlotRef{Snap: "core", Name: "network"},
+						Interface: "network",
+						ByGadget:  true,
+					},
+					{
+						Plug:      client.PlugRef{Snap: "foo", Name: "home"},
+						Slot:      client.SlotRef{Snap: "core", Name: "home"},
+						Interface: "home",
+					},
+					{
+						Plug:      client.PlugRef{Snap: "foo", Name: "camera"},
+						Slot:      client.SlotRef{Snap: "core", Name: "camera"},
+						Interface: "camera",
+						Auto:      true,
+						Undesired: true,
+					},
+				},
+			},
+		})
+	})
+	rest, err := Parser().ParseArgs([]string{"interfaces"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	expectedStdout := "" +
+		"Slot      Plug        Notes\n" +
+		":network  foo,bar     auto,gadget\n" +
+		":home     foo         -\n" +
+		":camera   -           undesired\n" +
+		"-         foo:camera  undesired\n"
+	c.Assert(s.Stdout(), Equals, expectedStdout)
+	c.Assert(s.Stderr(), Equals, "")
+}
@@ -0,0 +1,84 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+var (
+	shortLogsHelp = i18n.G("Retrieve logs of services")
+	longLogsHelp  = i18n.G(`
+The logs command fetches logs of the given services and displays them in
+chronological order.
+`)
+)
+
+type cmdLogs struct {
+	N      string `short:"n" default:"10"`
+	Follow bool   `short:"f"`
+
+	Positional struct {
+		Snaps []serviceName `positional-arg-name:"<service>" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	addCommand("logs", shortLogsHelp, longLogsHelp, func() flags.Commander { return &cmdLogs{} },
+		map[string]string{
+			"n": i18n.G("Show only the given number of lines, or 'all'."),
+			"f": i18n.G("Wait for new lines and print them as they come in."),
+		}, []argDesc{{name: i18n.G("<service>")}})
+}
+
+func (x *cmdLogs) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var n int
+	if x.N == "all" {
+		n = -1
+	} else {
+		l, err := strconv.ParseInt(x.N, 0, 32)
+		if err != nil || l < 0 {
+			return errors.New(i18n.G("invalid argument for flag ‘-n’: expected a non-negative integer argument, or “all”."))
+		}
+		n = int(l)
+	}
+
+	logs, err := Client().Logs(svcNames(x.Positional.Snaps), client.LogOptions{N: n, Follow: x.Follow})
+	if err != nil {
+		return err
+	}
+
+	for log := range logs {
+		fmt.Fprintln(Stdout, log)
+	}
+
+	return nil
+}
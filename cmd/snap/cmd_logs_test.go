@@ -0,0 +1,95 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+var logsResponse = "\x1E" + `{"timestamp":"2016-04-21T01:02:03Z","message":"Thing occurred","sid":"snap.foo.bar","pid":"42"}` + "\n" +
+	"\x1E" + `{"timestamp":"2016-04-21T01:02:04Z","message":"Other thing occurred","sid":"snap.foo.baz","pid":"44"}` + "\n"
+
+func (s *appOpSuite) TestLogs(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/logs")
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Query(), check.HasLen, 2)
+			c.Check(r.URL.Query().Get("names"), check.Equals, "foo")
+			c.Check(r.URL.Query().Get("n"), check.Equals, "10")
+			w.Header().Set("Content-Type", "application/json-seq")
+			fmt.Fprint(w, logsResponse)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"logs", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `2016-04-21T01:02:03Z snap.foo.bar[42]: Thing occurred
+2016-04-21T01:02:04Z snap.foo.baz[44]: Other thing occurred
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *appOpSuite) TestLogsN(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/logs")
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Query().Get("names"), check.Equals, "foo,bar.baz")
+			c.Check(r.URL.Query().Get("n"), check.Equals, "-1")
+			c.Check(r.URL.Query().Get("follow"), check.Equals, "true")
+			w.Header().Set("Content-Type", "application/json-seq")
+			fmt.Fprint(w, logsResponse)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"logs", "-n=all", "-f", "foo", "bar.baz"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *appOpSuite) TestLogsBadN(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+	for _, n := range []string{"-1", "potato", "99999999999"} {
+		_, err := snap.Parser().ParseArgs([]string{"logs", "-n=" + n, "foo"})
+		c.Check(err, check.ErrorMatches, "invalid argument for flag ‘-n’: expected a non-negative integer argument, or “all”.")
+	}
+}
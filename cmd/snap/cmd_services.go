@@ -0,0 +1,186 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type svcStatus struct {
+	Positionals struct {
+		ServiceNames []serviceName `positional-arg-name:"<service>"`
+	} `positional-args:"yes"`
+}
+
+type svcStart struct {
+	Positionals struct {
+		ServiceNames []serviceName `positional-arg-name:"<service>" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+	Enable bool `long:"enable"`
+}
+
+type svcStop struct {
+	Positionals struct {
+		ServiceNames []serviceName `positional-arg-name:"<service>" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+	Disable bool `long:"disable"`
+}
+
+type svcRestart struct {
+	Positionals struct {
+		ServiceNames []serviceName `positional-arg-name:"<service>" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var (
+	shortServicesHelp = i18n.G("Query the status of services")
+	longServicesHelp  = i18n.G(`
+The services command lists information about the services specified, or about
+the services in all currently installed snaps.
+`)
+	shortStartHelp = i18n.G("Start services")
+	longStartHelp  = i18n.G(`
+The start command starts, and optionally enables, the given services.
+
+If a snap name is given, all the services of that snap are started.
+`)
+	shortStopHelp = i18n.G("Stop services")
+	longStopHelp  = i18n.G(`
+The stop command stops, and optionally disables, the given services.
+
+If a snap name is given, all the services of that snap are stopped.
+`)
+	shortRestartHelp = i18n.G("Restart services")
+	longRestartHelp  = i18n.G(`
+The restart command restarts the given services.
+
+If a snap name is given, all the services of that snap are restarted.
+`)
+)
+
+func init() {
+	argdescs := []argDesc{{name: i18n.G("<service>")}}
+	addCommand("services", shortServicesHelp, longServicesHelp, func() flags.Commander { return &svcStatus{} }, nil, argdescs)
+	addCommand("start", shortStartHelp, longStartHelp, func() flags.Commander { return &svcStart{} },
+		map[string]string{"enable": i18n.G("As well as starting the service now, arrange for it to be started on boot.")}, argdescs)
+	addCommand("stop", shortStopHelp, longStopHelp, func() flags.Commander { return &svcStop{} },
+		map[string]string{"disable": i18n.G("As well as stopping the service now, arrange for it to no longer be started on boot.")}, argdescs)
+	addCommand("restart", shortRestartHelp, longRestartHelp, func() flags.Commander { return &svcRestart{} }, nil, argdescs)
+}
+
+func svcNames(s []serviceName) []string {
+	svcNames := make([]string, len(s))
+	for i, svcName := range s {
+		svcNames[i] = string(svcName)
+	}
+	return svcNames
+}
+
+func (s *svcStatus) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	services, err := Client().Apps(svcNames(s.Positionals.ServiceNames), client.AppOptions{Service: true})
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Snap.Service\tStartup\tCurrent"))
+
+	for _, svc := range services {
+		startup := i18n.G("disabled")
+		if svc.Enabled {
+			startup = i18n.G("enabled")
+		}
+		current := i18n.G("inactive")
+		if svc.Active {
+			current = i18n.G("active")
+		}
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current)
+	}
+
+	return nil
+}
+
+func (s *svcStart) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	cli := Client()
+	names := svcNames(s.Positionals.ServiceNames)
+	changeID, err := cli.Start(names, client.StartOptions{Enable: s.Enable})
+	if err != nil {
+		return err
+	}
+	if _, err := wait(cli, changeID); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(Stdout, i18n.G("Started."))
+
+	return nil
+}
+
+func (s *svcStop) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	cli := Client()
+	names := svcNames(s.Positionals.ServiceNames)
+	changeID, err := cli.Stop(names, client.StopOptions{Disable: s.Disable})
+	if err != nil {
+		return err
+	}
+	if _, err := wait(cli, changeID); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(Stdout, i18n.G("Stopped."))
+
+	return nil
+}
+
+func (s *svcRestart) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	cli := Client()
+	names := svcNames(s.Positionals.ServiceNames)
+	changeID, err := cli.Restart(names)
+	if err != nil {
+		return err
+	}
+	if _, err := wait(cli, changeID); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(Stdout, i18n.G("Restarted."))
+
+	return nil
+}
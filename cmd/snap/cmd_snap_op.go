@@ -158,6 +158,9 @@ var (
 
 var longInstallHelp = i18n.G(`
 The install command installs the named snap in the system.
+
+With --bundle, all the snaps of a bundle created by 'snap download --bundle'
+are installed in one go, verified with the assertions it contains.
 `)
 
 var longRemoveHelp = i18n.G(`
@@ -166,10 +169,17 @@ The remove command removes the named snap from the system.
 By default all the snap revisions are removed, including their data and the common
 data directory. When a --revision option is passed only the specified revision is
 removed.
+
+Unless --purge is given, a snapshot of the data of the snap is saved
+before it is removed; see 'snap saved'.
 `)
 
 var longRefreshHelp = i18n.G(`
 The refresh command refreshes (updates) the named snap.
+
+Snaps are also refreshed automatically, in the windows given by the
+refresh.schedule option of the core snap; 'snap refresh --time' shows
+when the last and the next automatic refresh happen.
 `)
 
 var longTryHelp = i18n.G(`
@@ -197,6 +207,7 @@ type cmdRemove struct {
 	waitMixin
 
 	Revision   string `long:"revision"`
+	Purge      bool   `long:"purge"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>" required:"1"`
 	} `positional-args:"yes" required:"yes"`
@@ -270,7 +281,7 @@ func (x *cmdRemove) removeMany(opts *client.SnapOptions) error {
 }
 
 func (x *cmdRemove) Execute([]string) error {
-	opts := &client.SnapOptions{Revision: x.Revision}
+	opts := &client.SnapOptions{Revision: x.Revision, Purge: x.Purge}
 	if len(x.Positional.Snaps) == 1 {
 		return x.removeOne(opts)
 	}
@@ -278,7 +289,10 @@ func (x *cmdRemove) Execute([]string) error {
 	if x.Revision != "" {
 		return errors.New(i18n.G("a single snap name is needed to specify the revision"))
 	}
-	return x.removeMany(nil)
+	if !x.Purge {
+		opts = nil
+	}
+	return x.removeMany(opts)
 }
 
 type channelMixin struct {
@@ -414,6 +428,8 @@ type cmdInstall struct {
 	// because we released 2.14.2 with --force-dangerous
 	ForceDangerous bool `long:"force-dangerous" hidden:"yes"`
 
+	Bundle bool `long:"bundle"`
+
 	Positional struct {
 		Snaps []remoteSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes" required:"yes"`
@@ -527,6 +543,31 @@ func (x *cmdInstall) installMany(names []string, opts *client.SnapOptions) error
 	return nil
 }
 
+func (x *cmdInstall) installBundle(bundlePath string) error {
+	cli := Client()
+	changeID, err := cli.InstallBundle(bundlePath, nil)
+	if err != nil {
+		return err
+	}
+
+	setupAbortHandler(changeID)
+
+	chg, err := x.wait(cli, changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var installed []string
+	if err := chg.Get("snap-names", &installed); err != nil {
+		return fmt.Errorf("cannot extract the snap names from bundle %q: %s", bundlePath, err)
+	}
+
+	return showDone(installed, "install")
+}
+
 func (x *cmdInstall) Execute([]string) error {
 	if err := x.setChannelFromCommandline(); err != nil {
 		return err
@@ -535,6 +576,16 @@ func (x *cmdInstall) Execute([]string) error {
 		return err
 	}
 
+	if x.Bundle {
+		if len(x.Positional.Snaps) != 1 {
+			return errors.New(i18n.G("a single bundle file is needed with --bundle"))
+		}
+		if x.asksForMode() || x.asksForChannel() || x.Revision != "" || x.Dangerous || x.ForceDangerous {
+			return errors.New(i18n.G("cannot use mode, channel, revision or dangerous flags with --bundle"))
+		}
+		return x.installBundle(string(x.Positional.Snaps[0]))
+	}
+
 	dangerous := x.Dangerous || x.ForceDangerous
 	opts := &client.SnapOptions{
 		Channel:   x.Channel,
@@ -567,6 +618,7 @@ type cmdRefresh struct {
 
 	Revision         string `long:"revision"`
 	List             bool   `long:"list"`
+	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
 	Positional       struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
@@ -650,6 +702,29 @@ func (x *cmdRefresh) listRefresh() error {
 	return nil
 }
 
+func fmtRefreshTime(t time.Time) string {
+	if t.IsZero() {
+		return i18n.G("n/a")
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func (x *cmdRefresh) showRefreshTimes() error {
+	sysinfo, err := Client().SysInfo()
+	if err != nil {
+		return err
+	}
+
+	refresh := sysinfo.Refresh
+	fmt.Fprintf(Stdout, "schedule: %s\n", refresh.Schedule)
+	fmt.Fprintf(Stdout, "last: %s\n", fmtRefreshTime(refresh.Last))
+	if !refresh.Hold.IsZero() {
+		fmt.Fprintf(Stdout, "hold: %s\n", fmtRefreshTime(refresh.Hold))
+	}
+	fmt.Fprintf(Stdout, "next: %s\n", fmtRefreshTime(refresh.Next))
+	return nil
+}
+
 func (x *cmdRefresh) Execute([]string) error {
 	if err := x.setChannelFromCommandline(); err != nil {
 		return err
@@ -666,6 +741,14 @@ func (x *cmdRefresh) Execute([]string) error {
 		return x.listRefresh()
 	}
 
+	if x.Time {
+		if x.asksForMode() || x.asksForChannel() || len(x.Positional.Snaps) > 0 {
+			return errors.New(i18n.G("--time does not take mode nor channel flags, nor snap names"))
+		}
+
+		return x.showRefreshTimes()
+	}
+
 	if len(x.Positional.Snaps) == 0 && os.Getenv("SNAP_REFRESH_FROM_TIMER") == "1" {
 		fmt.Fprintf(Stdout, "Ignoring `snap refresh` from the systemd timer")
 		return nil
@@ -894,17 +977,22 @@ func (x *cmdRevert) Execute(args []string) error {
 
 func init() {
 	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} },
-		waitDescs.also(map[string]string{"revision": i18n.G("Remove only the given revision")}), nil)
+		waitDescs.also(map[string]string{
+			"revision": i18n.G("Remove only the given revision"),
+			"purge":    i18n.G("Remove the snap without saving a snapshot of its data"),
+		}), nil)
 	addCommand("install", shortInstallHelp, longInstallHelp, func() flags.Commander { return &cmdInstall{} },
 		waitDescs.also(channelDescs).also(modeDescs).also(map[string]string{
 			"revision":        i18n.G("Install the given revision of a snap, to which you must have developer access"),
 			"dangerous":       i18n.G("Install the given snap file even if there are no pre-acknowledged signatures for it, meaning it was not verified and could be dangerous (--devmode implies this)"),
 			"force-dangerous": i18n.G("Alias for --dangerous (DEPRECATED)"),
+			"bundle":          i18n.G("Install all the snaps of the given bundle file, verified with its assertions"),
 		}), nil)
 	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() flags.Commander { return &cmdRefresh{} },
 		waitDescs.also(channelDescs).also(modeDescs).also(map[string]string{
 			"revision":          i18n.G("Refresh to the given revision"),
 			"list":              i18n.G("Show available snaps for refresh"),
+			"time":              i18n.G("Show auto refresh information but do not perform a refresh"),
 			"ignore-validation": i18n.G("Ignore validation by other snaps blocking the refresh"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
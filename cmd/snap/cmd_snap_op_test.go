@@ -478,6 +478,56 @@ func (s *SnapSuite) TestRefreshListErr(c *check.C) {
 	c.Check(err, check.ErrorMatches, "--list does not take .* flags")
 }
 
+func (s *SnapSuite) TestRefreshTime(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/system-info")
+			fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"refresh": {"schedule": "mon-fri@9:00-11:00", "last": "2017-08-07T10:00:00Z", "next": "2017-08-08T09:30:00Z"}}}`)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"refresh", "--time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	last := time.Date(2017, 8, 7, 10, 0, 0, 0, time.UTC).Local().Format(time.RFC3339)
+	next := time.Date(2017, 8, 8, 9, 30, 0, 0, time.UTC).Local().Format(time.RFC3339)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf(`schedule: mon-fri@9:00-11:00
+last: %s
+next: %s
+`, last, next))
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestRefreshTimeNoRefreshYet(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"refresh": {"schedule": "9:00-11:00", "hold": "2017-08-10T15:04:05Z"}}}`)
+	})
+	_, err := snap.Parser().ParseArgs([]string{"refresh", "--time"})
+	c.Assert(err, check.IsNil)
+	hold := time.Date(2017, 8, 10, 15, 4, 5, 0, time.UTC).Local().Format(time.RFC3339)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf(`schedule: 9:00-11:00
+last: n/a
+hold: %s
+next: n/a
+`, hold))
+}
+
+func (s *SnapSuite) TestRefreshTimeErr(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	_, err := snap.Parser().ParseArgs([]string{"refresh", "--time", "--beta"})
+	c.Check(err, check.ErrorMatches, "--time does not take .* flags, nor snap names")
+	_, err = snap.Parser().ParseArgs([]string{"refresh", "--time", "foo"})
+	c.Check(err, check.ErrorMatches, "--time does not take .* flags, nor snap names")
+}
+
 func (s *SnapOpSuite) TestRefreshOne(c *check.C) {
 	s.RedirectClientToTestServer(s.srv.handle)
 	s.srv.checker = func(r *http.Request) {
@@ -830,6 +880,35 @@ func (s *SnapOpSuite) TestRemoveMany(c *check.C) {
 	c.Check(n, check.Equals, total)
 }
 
+func (s *SnapOpSuite) TestRemoveManyPurge(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "remove",
+				"snaps":  []interface{}{"one", "two"},
+				"purge":  true,
+			})
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"snap-names": ["one","two"]}}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"remove", "--purge", "one", "two"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "one removed\ntwo removed\n")
+	c.Check(n, check.Equals, 2)
+}
+
 func (s *SnapOpSuite) TestInstallManyChannel(c *check.C) {
 	s.RedirectClientToTestServer(nil)
 	_, err := snap.Parser().ParseArgs([]string{"install", "--beta", "one", "two"})
@@ -888,6 +967,68 @@ func (s *SnapOpSuite) TestInstallMany(c *check.C) {
 	c.Check(n, check.Equals, total)
 }
 
+func (s *SnapOpSuite) TestInstallBundle(c *check.C) {
+	total := 4
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			form := testForm(r, c)
+			defer form.RemoveAll()
+
+			c.Check(form.Value["action"], check.DeepEquals, []string{"install"})
+			c.Check(form.Value, check.HasLen, 1)
+
+			name, filename, body := formFile(form, c)
+			c.Check(name, check.Equals, "bundle")
+			c.Check(filename, check.Equals, "one+two.bundle")
+			c.Check(string(body), check.Equals, "bundle-data")
+
+			c.Check(r.Method, check.Equals, "POST")
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"status": "Doing"}}`)
+		case 2:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"snap-names": ["one","two"]}}}`)
+		case 3:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			fmt.Fprintf(w, `{"type": "sync", "result": [{"name": "one", "status": "active", "version": "1.0", "developer": "bar", "revision":42, "channel":"stable"},{"name": "two", "status": "active", "version": "2.0", "developer": "baz", "revision":42, "channel":"stable"}]}\n`)
+		default:
+			c.Fatalf("expected to get %d requests, now on %d", total, n+1)
+		}
+
+		n++
+	})
+
+	bundlePath := filepath.Join(c.MkDir(), "one+two.bundle")
+	err := ioutil.WriteFile(bundlePath, []byte("bundle-data"), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := snap.Parser().ParseArgs([]string{"install", "--bundle", bundlePath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?sm).*one 1.0 from 'bar' installed`)
+	c.Check(s.Stdout(), check.Matches, `(?sm).*two 2.0 from 'baz' installed`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(n, check.Equals, total)
+}
+
+func (s *SnapOpSuite) TestInstallBundleBadFlags(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"install", "--bundle", "one.bundle", "two.bundle"})
+	c.Check(err, check.ErrorMatches, "a single bundle file is needed with --bundle")
+
+	_, err = snap.Parser().ParseArgs([]string{"install", "--bundle", "--devmode", "one.bundle"})
+	c.Check(err, check.ErrorMatches, "cannot use mode, channel, revision or dangerous flags with --bundle")
+}
+
 func (s *SnapOpSuite) TestNoWait(c *check.C) {
 	s.srv.checker = func(r *http.Request) {}
 
@@ -0,0 +1,362 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var (
+	shortSavedHelp = i18n.G("List currently stored snapshots")
+	longSavedHelp  = i18n.G(`
+The saved command displays a list of snapshots that have been created
+previously with the 'save' command, or automatically when a snap was
+removed.
+`)
+	shortSaveHelp = i18n.G("Save a snapshot of the current data")
+	longSaveHelp  = i18n.G(`
+The save command creates a snapshot of the current user, system and
+configuration data for the given snaps.
+
+By default, this command saves the data of all snaps for all users.
+Alternatively, you can specify the data of which snaps to save, or
+for which users, or a combination of these.
+
+If a snap is included in a save operation, excluding its system and
+configuration data from the snapshot is not currently possible. This
+restriction may be lifted in the future.
+`)
+	shortForgetHelp = i18n.G("Delete a snapshot")
+	longForgetHelp  = i18n.G(`
+The forget command deletes a snapshot. This operation can not be
+undone.
+
+A snapshot contains archives for the user, system and configuration
+data of each snap included in the snapshot.
+
+By default, this command forgets all the data in a snapshot.
+Alternatively, you can specify the data of which snaps to forget.
+`)
+	shortCheckHelp = i18n.G("Check a snapshot")
+	longCheckHelp  = i18n.G(`
+The check-snapshot command verifies the user, system and configuration
+data of the snaps included in the specified snapshot.
+
+The check operation runs the same data integrity verification that is
+performed when a snapshot is restored.
+
+By default, this command checks all the data in a snapshot.
+Alternatively, you can specify the data of which snaps to check, or
+for which users, or a combination of these.
+`)
+	shortRestoreHelp = i18n.G("Restore a snapshot")
+	longRestoreHelp  = i18n.G(`
+The restore command replaces the current user, system and
+configuration data of included snaps, with the corresponding data from
+the specified snapshot.
+
+By default, this command restores all the data in a snapshot.
+Alternatively, you can specify the data of which snaps to restore, or
+for which users, or a combination of these.
+
+If a snap is included in a restore operation, excluding its system and
+configuration data from the restore is not currently possible. This
+restriction may be lifted in the future.
+`)
+)
+
+type savedCmd struct {
+	ID         snapshotID `long:"id"`
+	Positional struct {
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes"`
+}
+
+func (x *savedCmd) Execute([]string) error {
+	var setID uint64
+	if x.ID != "" {
+		var err error
+		setID, err = x.ID.ToUint()
+		if err != nil {
+			return err
+		}
+	}
+	snaps := installedSnapNames(x.Positional.Snaps)
+	list, err := Client().SnapshotSets(setID, snaps)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("No snapshots found."))
+		return nil
+	}
+	w := tabWriter()
+	defer w.Flush()
+
+	// TRANSLATORS: 'Set' as in group or bag of things
+	fmt.Fprintln(w, i18n.G("Set\tSnap\tAge\tVersion\tRev\tSize\tNotes"))
+	for _, sg := range list {
+		for _, sh := range sg.Snapshots {
+			notes := []string{}
+			if sh.Auto {
+				notes = append(notes, "auto")
+			}
+			if sh.Broken != "" {
+				notes = append(notes, "broken: "+sh.Broken)
+			}
+			note := "-"
+			if len(notes) > 0 {
+				note = strings.Join(notes, ", ")
+			}
+			size := strutil.SizeToStr(sh.Size)
+			age := formatAge(timeNow().Sub(sh.Time))
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", sg.ID, sh.Snap, age, sh.Version, sh.Revision, size, note)
+		}
+	}
+	return nil
+}
+
+var timeNow = time.Now
+
+// formatAge returns a short, rough, human readable representation of
+// the given duration, e.g. "5m", "2h" or "3d".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%.0fs", d.Seconds())
+	case d < time.Hour:
+		return fmt.Sprintf("%.0fm", d.Minutes())
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%.0fh", d.Hours())
+	default:
+		return fmt.Sprintf("%.0fd", d.Hours()/24)
+	}
+}
+
+type snapshotID string
+
+func (s snapshotID) ToUint() (uint64, error) {
+	setID, err := strconv.ParseUint((string)(s), 10, 64)
+	if err != nil {
+		return 0, errors.New(i18n.G("invalid argument for snapshot set id: expected a non-negative integer argument (see 'snap help saved')"))
+	}
+	return setID, nil
+}
+
+func installedSnapNames(snaps []installedSnapName) []string {
+	names := make([]string, len(snaps))
+	for i, snap := range snaps {
+		names[i] = string(snap)
+	}
+	return names
+}
+
+func usersFromFlag(users string) []string {
+	if users == "" {
+		return nil
+	}
+	return strings.Split(users, ",")
+}
+
+type saveCmd struct {
+	waitMixin
+	Users      string `long:"users"`
+	Positional struct {
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes"`
+}
+
+func (x *saveCmd) Execute([]string) error {
+	cli := Client()
+	changeID, err := cli.SnapshotMany(installedSnapNames(x.Positional.Snaps), usersFromFlag(x.Users))
+	if err != nil {
+		return err
+	}
+	chg, err := x.wait(cli, changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var setID uint64
+	if err := chg.Get("set-id", &setID); err != nil {
+		return errors.New(i18n.G("could not get the snapshot set id of the change"))
+	}
+
+	y := &savedCmd{ID: snapshotID(strconv.FormatUint(setID, 10))}
+	return y.Execute(nil)
+}
+
+type forgetCmd struct {
+	waitMixin
+	Positional struct {
+		ID    snapshotID          `positional-arg-name:"<id>"`
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *forgetCmd) Execute([]string) error {
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+	cli := Client()
+	snaps := installedSnapNames(x.Positional.Snaps)
+	changeID, err := cli.ForgetSnapshots(setID, snaps)
+	if err != nil {
+		return err
+	}
+	_, err = x.wait(cli, changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(snaps) > 0 {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Snapshot #%d of snaps %s forgotten.\n"), setID, strutil.Quoted(snaps))
+	} else {
+		fmt.Fprintf(Stdout, i18n.G("Snapshot #%d forgotten.\n"), setID)
+	}
+	return nil
+}
+
+type checkSnapshotCmd struct {
+	waitMixin
+	Users      string `long:"users"`
+	Positional struct {
+		ID    snapshotID          `positional-arg-name:"<id>"`
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *checkSnapshotCmd) Execute([]string) error {
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+	snaps := installedSnapNames(x.Positional.Snaps)
+	users := usersFromFlag(x.Users)
+	cli := Client()
+	changeID, err := cli.CheckSnapshots(setID, snaps, users)
+	if err != nil {
+		return err
+	}
+	_, err = x.wait(cli, changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(snaps) > 0 {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Snapshot #%d of snaps %s verified successfully.\n"), setID, strutil.Quoted(snaps))
+	} else {
+		fmt.Fprintf(Stdout, i18n.G("Snapshot #%d verified successfully.\n"), setID)
+	}
+	return nil
+}
+
+type restoreCmd struct {
+	waitMixin
+	Users      string `long:"users"`
+	Positional struct {
+		ID    snapshotID          `positional-arg-name:"<id>"`
+		Snaps []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *restoreCmd) Execute([]string) error {
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+	snaps := installedSnapNames(x.Positional.Snaps)
+	users := usersFromFlag(x.Users)
+	cli := Client()
+	changeID, err := cli.RestoreSnapshots(setID, snaps, users)
+	if err != nil {
+		return err
+	}
+	_, err = x.wait(cli, changeID)
+	if err == noWait {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(snaps) > 0 {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Restored snapshot #%d of snaps %s.\n"), setID, strutil.Quoted(snaps))
+	} else {
+		fmt.Fprintf(Stdout, i18n.G("Restored snapshot #%d.\n"), setID)
+	}
+	return nil
+}
+
+func init() {
+	addCommand("saved", shortSavedHelp, longSavedHelp, func() flags.Commander { return &savedCmd{} },
+		map[string]string{
+			"id": i18n.G("Show only a specific snapshot."),
+		}, nil)
+
+	addCommand("save", shortSaveHelp, longSaveHelp, func() flags.Commander { return &saveCmd{} },
+		waitDescs.also(map[string]string{
+			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+		}), nil)
+
+	addCommand("restore", shortRestoreHelp, longRestoreHelp, func() flags.Commander { return &restoreCmd{} },
+		waitDescs.also(map[string]string{
+			"users": i18n.G("Restore data of only specific users (comma-separated) (default: all users)"),
+		}), []argDesc{
+			{name: i18n.G("<id>")},
+			{name: i18n.G("<snap>")},
+		})
+
+	addCommand("forget", shortForgetHelp, longForgetHelp, func() flags.Commander { return &forgetCmd{} },
+		waitDescs, []argDesc{
+			{name: i18n.G("<id>")},
+			{name: i18n.G("<snap>")},
+		})
+
+	addCommand("check-snapshot", shortCheckHelp, longCheckHelp, func() flags.Commander { return &checkSnapshotCmd{} },
+		waitDescs.also(map[string]string{
+			"users": i18n.G("Check data of only specific users (comma-separated) (default: all users)"),
+		}), []argDesc{
+			{name: i18n.G("<id>")},
+			{name: i18n.G("<snap>")},
+		})
+}
@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+const snapshotsResponse = `{"type": "sync", "result": [{"id": 1, "snapshots": [
+  {"set": 1, "time": "2017-09-27T12:00:00Z", "snap": "foo", "revision": "x1", "version": "1.0", "size": 1024, "sha3-384": {"archive.tgz": "abc"}},
+  {"set": 1, "time": "2017-09-25T12:00:00Z", "snap": "bar", "revision": "2", "version": "2.0", "auto": true, "sha3-384": {"archive.tgz": "def"}}
+]}]}`
+
+func (s *SnapSuite) mockSnapshotsNow() func() {
+	now, err := time.Parse(time.RFC3339, "2017-09-27T14:30:00Z")
+	if err != nil {
+		panic(err)
+	}
+	return snap.MockTimeNow(func() time.Time { return now })
+}
+
+func (s *SnapSuite) TestSaved(c *check.C) {
+	defer s.mockSnapshotsNow()()
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/snapshots")
+			c.Check(r.URL.Query().Get("set"), check.Equals, "1")
+			c.Check(r.URL.Query().Get("snaps"), check.Equals, "foo,bar")
+			fmt.Fprintln(w, snapshotsResponse)
+		default:
+			c.Fatalf("expected to get 1 request, now on %d", n+1)
+		}
+		n++
+	})
+	rest, err := snap.Parser().ParseArgs([]string{"saved", "--id=1", "foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `Set  Snap  Age  Version  Rev  Size  Notes
+1    foo   2h   1.0      x1   1kB   -
+1    bar   2d   2.0      2    0B    auto
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSavedNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+	_, err := snap.Parser().ParseArgs([]string{"saved"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No snapshots found.\n")
+}
+
+func (s *SnapSuite) TestSavedBadID(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"saved", "--id=x"})
+	c.Check(err, check.ErrorMatches, `invalid argument for snapshot set id: expected a non-negative integer argument \(see 'snap help saved'\)`)
+}
+
+func (s *SnapSuite) TestSave(c *check.C) {
+	defer s.mockSnapshotsNow()()
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snapshots")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "snapshot",
+				"snaps":  []interface{}{"foo", "bar"},
+				"users":  []interface{}{"alice", "bob"},
+			})
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"set-id": 1, "snap-names": ["foo", "bar"]}}}`)
+		case 2:
+			c.Check(r.URL.Path, check.Equals, "/v2/snapshots")
+			c.Check(r.URL.Query().Get("set"), check.Equals, "1")
+			fmt.Fprintln(w, snapshotsResponse)
+		default:
+			c.Fatalf("expected to get 3 requests, now on %d", n+1)
+		}
+		n++
+	})
+	_, err := snap.Parser().ParseArgs([]string{"save", "--users=alice,bob", "foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `(?s)Set +Snap +Age +Version +Rev +Size +Notes\n1 +foo .*`)
+	c.Check(n, check.Equals, 3)
+}
+
+func (s *SnapSuite) testSnapshotAction(c *check.C, args []string, body map[string]interface{}, expected string) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snapshots")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, body)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+	_, err := snap.Parser().ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, expected)
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *SnapSuite) TestForget(c *check.C) {
+	s.testSnapshotAction(c, []string{"forget", "1"}, map[string]interface{}{
+		"action": "forget",
+		"set":    1.,
+	}, "Snapshot #1 forgotten.\n")
+}
+
+func (s *SnapSuite) TestCheckSnapshot(c *check.C) {
+	s.testSnapshotAction(c, []string{"check-snapshot", "1", "foo"}, map[string]interface{}{
+		"action": "check",
+		"set":    1.,
+		"snaps":  []interface{}{"foo"},
+	}, "Snapshot #1 of snaps \"foo\" verified successfully.\n")
+}
+
+func (s *SnapSuite) TestRestore(c *check.C) {
+	s.testSnapshotAction(c, []string{"restore", "--users=alice", "1"}, map[string]interface{}{
+		"action": "restore",
+		"set":    1.,
+		"users":  []interface{}{"alice"},
+	}, "Restored snapshot #1.\n")
+}
@@ -0,0 +1,195 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdValidate struct {
+	waitMixin
+	Monitor    bool `long:"monitor"`
+	Enforce    bool `long:"enforce"`
+	Forget     bool `long:"forget"`
+	Positional struct {
+		ValidationSet string `positional-arg-name:"<validation-set>"`
+	} `positional-args:"yes"`
+}
+
+var shortValidateHelp = i18n.G("List or apply validation sets")
+var longValidateHelp = i18n.G(`
+The validate command lists or applies validation sets that state which snaps
+are required or permitted to be installed together, optionally constrained
+to fixed revisions.
+
+A validation set can either be in monitoring mode, in which case its
+constraints aren't enforced, or in enforcing mode, in which case snapd
+will not allow operations that would result in snaps breaking the
+constraints of the validation set, and will install or refresh required
+snaps as needed.
+
+A validation set is identified by <account-id>/<name>, and can be pinned
+at a given sequence with <account-id>/<name>=<sequence>.
+`)
+
+func init() {
+	addCommand("validate", shortValidateHelp, longValidateHelp, func() flags.Commander { return &cmdValidate{} },
+		waitDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"monitor": i18n.G("Monitor the given validations set"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"enforce": i18n.G("Enforce the given validation set"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"forget": i18n.G("Forget the given validation set"),
+		}), []argDesc{{
+			// TRANSLATORS: This needs to begin with < and end with >
+			name: i18n.G("<validation-set>"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			desc: i18n.G("Validation set with an optional pinned sequence point, i.e. account-id/name[=seq]"),
+		}})
+}
+
+var validationSetRx = regexp.MustCompile(`^([a-zA-Z0-9]{1,64})/([a-z0-9](?:-?[a-z0-9])*)(?:=([0-9]+))?$`)
+
+func splitValidationSetArg(arg string) (accountID, name string, seq int, err error) {
+	parts := validationSetRx.FindStringSubmatch(arg)
+	if parts == nil {
+		return "", "", 0, fmt.Errorf(i18n.G("cannot parse validation set %q: expected account-id/name[=sequence]"), arg)
+	}
+	if parts[3] != "" {
+		seq, err = strconv.Atoi(parts[3])
+		if err != nil || seq < 1 {
+			return "", "", 0, fmt.Errorf(i18n.G("cannot parse validation set %q: invalid sequence %q"), arg, parts[3])
+		}
+	}
+	return parts[1], parts[2], seq, nil
+}
+
+func fmtValid(res *client.ValidationSetResult) string {
+	if res.Valid {
+		return i18n.G("valid")
+	}
+	return i18n.G("invalid")
+}
+
+func (cmd *cmdValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	action := ""
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{{cmd.Monitor, "monitor"}, {cmd.Enforce, "enforce"}, {cmd.Forget, "forget"}} {
+		if !flag.set {
+			continue
+		}
+		if action != "" {
+			return errors.New(i18n.G("cannot use --monitor, --enforce and --forget together"))
+		}
+		action = flag.name
+	}
+
+	if cmd.Positional.ValidationSet == "" {
+		if action != "" {
+			return fmt.Errorf(i18n.G("missing validation set argument for --%s"), action)
+		}
+		return cmd.list()
+	}
+
+	accountID, name, seq, err := splitValidationSetArg(cmd.Positional.ValidationSet)
+	if err != nil {
+		return err
+	}
+
+	cli := Client()
+	switch action {
+	case "":
+		if seq != 0 {
+			return errors.New(i18n.G("cannot specify a sequence when showing a validation set"))
+		}
+		res, err := cli.ValidationSet(accountID, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(Stdout, fmtValid(res))
+		return nil
+	case "forget":
+		if seq != 0 {
+			return errors.New(i18n.G("cannot specify a sequence with --forget"))
+		}
+		return cli.ForgetValidationSet(accountID, name)
+	}
+
+	res, changeID, err := cli.ApplyValidationSet(accountID, name, &client.ValidateApplyOptions{
+		Mode:     action,
+		Sequence: seq,
+	})
+	if err != nil {
+		return err
+	}
+	if changeID != "" {
+		if _, err := cmd.wait(cli, changeID); err != nil {
+			if err == noWait {
+				return nil
+			}
+			return err
+		}
+		res, err = cli.ValidationSet(accountID, name)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(Stdout, fmtValid(res))
+	return nil
+}
+
+func (cmd *cmdValidate) list() error {
+	sets, err := Client().ListValidationsSets()
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No validations are available"))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Validation\tMode\tSeq\tCurrent"))
+	for _, res := range sets {
+		validation := res.AccountID + "/" + res.Name
+		if res.PinnedAt != 0 {
+			validation += fmt.Sprintf("=%d", res.PinnedAt)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", validation, res.Mode, res.Sequence, fmtValid(res))
+	}
+	return nil
+}
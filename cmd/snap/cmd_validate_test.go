@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+type validateSuite struct {
+	BaseSnapSuite
+}
+
+var _ = check.Suite(&validateSuite{})
+
+const validationSetsList = `{"type": "sync", "status-code": 200, "result": [
+	{"account-id": "foo", "name": "bar", "mode": "monitor", "sequence": 3, "valid": true},
+	{"account-id": "foo", "name": "baz", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": false}
+]}`
+
+func (s *validateSuite) TestValidateList(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(n, check.Equals, 0)
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets")
+		fmt.Fprintln(w, validationSetsList)
+		n++
+	})
+
+	rest, err := snap.Parser().ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `Validation  Mode     Seq  Current
+foo/bar     monitor  3    valid
+foo/baz=2   enforce  2    invalid
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *validateSuite) TestValidateListEmpty(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No validations are available\n")
+}
+
+func (s *validateSuite) TestValidateShow(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "monitor", "sequence": 3, "valid": false}}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "invalid\n")
+}
+
+func (s *validateSuite) TestValidateMonitor(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":   "apply",
+			"mode":     "monitor",
+			"sequence": 3.0,
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "monitor", "pinned-at": 3, "sequence": 3, "valid": true}}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--monitor", "foo/bar=3"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "valid\n")
+}
+
+func (s *validateSuite) TestValidateEnforceWithChange(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "apply",
+				"mode":   "enforce",
+			})
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		case 2:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+			fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "enforce", "sequence": 3, "valid": true}}`)
+		default:
+			c.Fatalf("expected to get 3 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--enforce", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "valid\n")
+	c.Check(n, check.Equals, 3)
+}
+
+func (s *validateSuite) TestValidateForget(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "forget",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": null}`)
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"validate", "--forget", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
+func (s *validateSuite) TestValidateErrors(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"validate", "--monitor", "--enforce", "foo/bar"}, "cannot use --monitor, --enforce and --forget together"},
+		{[]string{"validate", "--enforce"}, "missing validation set argument for --enforce"},
+		{[]string{"validate", "foo"}, `cannot parse validation set "foo": expected account-id/name\[=sequence\]`},
+		{[]string{"validate", "foo/Bar"}, `cannot parse validation set "foo/Bar": expected account-id/name\[=sequence\]`},
+		{[]string{"validate", "--monitor", "foo/bar=0"}, `cannot parse validation set "foo/bar=0": invalid sequence "0"`},
+		{[]string{"validate", "foo/bar=1"}, "cannot specify a sequence when showing a validation set"},
+		{[]string{"validate", "--forget", "foo/bar=1"}, "cannot specify a sequence with --forget"},
+	} {
+		_, err := snap.Parser().ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
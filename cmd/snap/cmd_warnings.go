@@ -0,0 +1,198 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
+)
+
+type cmdWarnings struct {
+	All     bool `long:"all"`
+	Verbose bool `long:"verbose"`
+}
+
+type cmdOkay struct{}
+
+var shortWarningsHelp = i18n.G("List warnings")
+var longWarningsHelp = i18n.G(`
+The warnings command lists the warnings that have been reported to the
+system.
+
+Once warnings have been listed with 'snap warnings', 'snap okay' may be
+used to silence them. A warning that's been silenced in this way will
+not be listed again unless it happens again, _and_ a cooldown time has
+passed.
+
+Warnings expire automatically, and once expired they are forgotten.
+`)
+
+var shortOkayHelp = i18n.G("Acknowledge warnings")
+var longOkayHelp = i18n.G(`
+The okay command acknowledges the warnings listed with 'snap warnings'.
+
+Once acknowledged a warning won't appear again unless it re-occurrs and
+sufficient time has passed.
+`)
+
+func init() {
+	addCommand("warnings", shortWarningsHelp, longWarningsHelp, func() flags.Commander { return &cmdWarnings{} },
+		map[string]string{
+			"all":     i18n.G("Show all warnings"),
+			"verbose": i18n.G("Show more information"),
+		}, nil)
+	addCommand("okay", shortOkayHelp, longOkayHelp, func() flags.Commander { return &cmdOkay{} }, nil, nil)
+}
+
+func (cmd *cmdWarnings) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	now := time.Now()
+
+	warnings, err := Client().Warnings(client.WarningsOptions{All: cmd.All})
+	if err != nil {
+		return err
+	}
+	if len(warnings) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No warnings."))
+		return nil
+	}
+
+	if err := writeWarningTimestamp(now); err != nil {
+		return err
+	}
+
+	for i, warning := range warnings {
+		if i > 0 {
+			fmt.Fprintln(Stdout, "---")
+		}
+		if cmd.Verbose {
+			fmt.Fprintf(Stdout, "first-occurrence:  %s\n", fmtWarningTime(warning.FirstAdded))
+		}
+		fmt.Fprintf(Stdout, "last-occurrence:   %s\n", fmtWarningTime(warning.LastAdded))
+		if cmd.Verbose {
+			lastShown := "-"
+			if !warning.LastShown.IsZero() {
+				lastShown = fmtWarningTime(warning.LastShown)
+			}
+			fmt.Fprintf(Stdout, "acknowledged:      %s\n", lastShown)
+			fmt.Fprintf(Stdout, "repeats-after:     %s\n", warning.RepeatAfter)
+			fmt.Fprintf(Stdout, "expires-after:     %s\n", warning.ExpireAfter)
+		}
+		fmt.Fprintln(Stdout, "warning: |")
+		for _, line := range strings.Split(warning.Message, "\n") {
+			fmt.Fprintf(Stdout, "  %s\n", line)
+		}
+	}
+
+	return nil
+}
+
+func (cmd *cmdOkay) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	last, err := lastWarningTimestamp()
+	if err != nil {
+		return err
+	}
+
+	return Client().Okay(last)
+}
+
+func fmtWarningTime(t time.Time) string {
+	return t.Local().Format(time.RFC3339)
+}
+
+var warnFilename = func() (string, error) {
+	user, err := osutil.RealUser()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(user.HomeDir, ".snap", "warnings.json"), nil
+}
+
+type clientWarningData struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func writeWarningTimestamp(t time.Time) error {
+	filename, err := warnFilename()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(clientWarningData{Timestamp: t})
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filename, data, 0600, 0)
+}
+
+func lastWarningTimestamp() (time.Time, error) {
+	filename, err := warnFilename()
+	if err != nil {
+		return time.Time{}, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, errors.New(i18n.G("you must have looked at the warnings before acknowledging them. Try 'snap warnings'."))
+		}
+		return time.Time{}, fmt.Errorf("cannot open timestamp file: %v", err)
+	}
+	defer f.Close()
+
+	var d clientWarningData
+	if err := json.NewDecoder(f).Decode(&d); err != nil {
+		return time.Time{}, fmt.Errorf("cannot decode timestamp file: %v", err)
+	}
+
+	return d.Timestamp, nil
+}
+
+// maybePresentWarnings tells the user about new warnings, if there are
+// any that are newer than the last time they looked at them.
+func maybePresentWarnings(count int, timestamp time.Time) {
+	if count == 0 {
+		return
+	}
+
+	if last, _ := lastWarningTimestamp(); !timestamp.After(last) {
+		return
+	}
+
+	fmt.Fprintf(Stderr, i18n.NG("WARNING: there is %d new warning. See 'snap warnings'.\n", "WARNING: there are %d new warnings. See 'snap warnings'.\n", uint32(count)), count)
+}
@@ -0,0 +1,194 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+type warningSuite struct {
+	BaseSnapSuite
+	filename string
+}
+
+var _ = check.Suite(&warningSuite{})
+
+const twoWarnings = `{
+			"result": [
+			    {
+				"expire-after": "672h0m0s",
+				"first-added": "2018-09-19T12:41:18.505007495Z",
+				"last-added": "2018-09-19T12:41:18.505007495Z",
+				"message": "hello world number one",
+				"repeat-after": "24h0m0s"
+			    },
+			    {
+				"expire-after": "672h0m0s",
+				"first-added": "2018-09-19T12:44:19.680362867Z",
+				"last-added": "2018-09-19T12:44:19.680362867Z",
+				"message": "hello world number two",
+				"repeat-after": "24h0m0s"
+			    }
+			],
+			"status": "OK",
+			"status-code": 200,
+			"type": "sync"
+		}`
+
+func (s *warningSuite) SetUpTest(c *check.C) {
+	s.BaseSnapSuite.SetUpTest(c)
+	s.filename = filepath.Join(c.MkDir(), "warnings.json")
+	s.AddCleanup(snap.MockWarningsFilename(s.filename))
+}
+
+func mkWarningsFakeHandler(c *check.C, body string) func(w http.ResponseWriter, r *http.Request) {
+	var called bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		if called {
+			c.Fatalf("expected a single request")
+		}
+		called = true
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/warnings")
+		c.Check(r.URL.Query(), check.HasLen, 0)
+		w.WriteHeader(200)
+		fmt.Fprintln(w, body)
+	}
+}
+
+func localTime(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		panic(err)
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func (s *warningSuite) TestNoWarningsEver(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, `{"type": "sync", "status-code": 200, "result": []}`))
+
+	rest, err := snap.Parser().ParseArgs([]string{"warnings"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "No warnings.\n")
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
+func (s *warningSuite) TestWarnings(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
+
+	rest, err := snap.Parser().ParseArgs([]string{"warnings"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf(`last-occurrence:   %s
+warning: |
+  hello world number one
+---
+last-occurrence:   %s
+warning: |
+  hello world number two
+`, localTime("2018-09-19T12:41:18.505007495Z"), localTime("2018-09-19T12:44:19.680362867Z")))
+}
+
+func (s *warningSuite) TestVerboseWarnings(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
+
+	_, err := snap.Parser().ParseArgs([]string{"warnings", "--verbose"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `(?s)first-occurrence: .*
+last-occurrence: .*
+acknowledged:      -
+repeats-after:     24h0m0s
+expires-after:     672h0m0s
+warning: \|
+  hello world number one
+---
+.*`)
+}
+
+func (s *warningSuite) TestOkay(c *check.C) {
+	var n int
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch n {
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			fmt.Fprintln(w, twoWarnings)
+		case 2:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/warnings")
+			c.Check(DecodedRequestBody(c, r)["action"], check.Equals, "okay")
+			fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": 2}`)
+		default:
+			c.Fatalf("expected 2 requests, now on %d", n)
+		}
+	})
+
+	_, err := snap.Parser().ParseArgs([]string{"warnings"})
+	c.Assert(err, check.IsNil)
+	stamp, err := ioutil.ReadFile(s.filename)
+	c.Assert(err, check.IsNil)
+	c.Check(string(stamp), check.Matches, `{"timestamp":".*"}`)
+
+	_, err = snap.Parser().ParseArgs([]string{"okay"})
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *warningSuite) TestOkayBeforeWarnings(c *check.C) {
+	_, err := snap.Parser().ParseArgs([]string{"okay"})
+	c.Assert(err, check.ErrorMatches, "you must have looked at the warnings before acknowledging them. Try 'snap warnings'.")
+}
+
+func (s *warningSuite) TestWarningCountShownAfterCommand(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [], "warning-count": 2, "warning-timestamp": "2018-09-19T12:44:19.680362867Z"}`)
+	})
+
+	restore := mockArgs("snap", "list")
+	defer restore()
+
+	err := snap.RunMain()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Matches, `(?s).*WARNING: there are 2 new warnings. See 'snap warnings'.\n`)
+}
+
+func (s *warningSuite) TestWarningCountNotShownIfSeen(c *check.C) {
+	c.Assert(ioutil.WriteFile(s.filename, []byte(`{"timestamp": "2018-09-19T13:00:00Z"}`), 0600), check.IsNil)
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [], "warning-count": 2, "warning-timestamp": "2018-09-19T12:44:19.680362867Z"}`)
+	})
+
+	restore := mockArgs("snap", "list")
+	defer restore()
+
+	err := snap.RunMain()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Not(check.Matches), `(?s).*WARNING.*`)
+}
@@ -168,3 +168,30 @@ func (cps connectPlugSpec) Complete(match string) []flags.Completion {
 
 	return ret
 }
+
+type serviceName string
+
+func (s serviceName) Complete(match string) []flags.Completion {
+	cli := Client()
+	apps, err := cli.Apps(nil, client.AppOptions{Service: true})
+	if err != nil {
+		return nil
+	}
+
+	snaps := map[string]bool{}
+	var ret []flags.Completion
+	for _, app := range apps {
+		if !app.IsService() {
+			continue
+		}
+		if !snaps[app.Snap] && strings.HasPrefix(app.Snap, match) {
+			snaps[app.Snap] = true
+			ret = append(ret, flags.Completion{Item: app.Snap})
+		}
+		if name := app.Snap + "." + app.Name; strings.HasPrefix(name, match) {
+			ret = append(ret, flags.Completion{Item: name})
+		}
+	}
+
+	return ret
+}
@@ -102,3 +102,15 @@ func AliasInfoLess(snapName1, alias1, app1, snapName2, alias2, app2 string) bool
 	}
 	return x.Less(0, 1)
 }
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	oldTimeNow := timeNow
+	timeNow = f
+	return func() { timeNow = oldTimeNow }
+}
+
+func MockWarningsFilename(filename string) (restore func()) {
+	oldWarnFilename := warnFilename
+	warnFilename = func() (string, error) { return filename, nil }
+	return func() { warnFilename = oldWarnFilename }
+}
@@ -226,8 +226,13 @@ snaps on the system. Start with 'snap list' to see installed snaps.
 var ClientConfig client.Config
 
 // Client returns a new client using ClientConfig as configuration.
+// lastClient is the client most recently handed out by Client, used
+// to report on warnings once the command is done.
+var lastClient *client.Client
+
 func Client() *client.Client {
-	return client.New(&ClientConfig)
+	lastClient = client.New(&ClientConfig)
+	return lastClient
 }
 
 func init() {
@@ -296,8 +301,12 @@ func (e *exitStatus) Error() string {
 }
 
 func run() error {
+	lastClient = nil
 	parser := Parser()
 	_, err := parser.Parse()
+	if err == nil && lastClient != nil {
+		maybePresentWarnings(lastClient.WarningsSummary())
+	}
 	if err != nil {
 		if e, ok := err.(*flags.Error); ok {
 			if e.Type == flags.ErrHelp || e.Type == flags.ErrCommandRequired {
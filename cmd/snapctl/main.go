@@ -36,6 +36,11 @@ var clientConfig = client.Config{
 func main() {
 	stdout, stderr, err := run()
 	if err != nil {
+		if e, ok := err.(*client.UnsuccessfulError); ok {
+			os.Stdout.Write(stdout)
+			os.Stderr.Write(stderr)
+			os.Exit(e.ExitCode)
+		}
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
 	}
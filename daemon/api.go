@@ -32,6 +32,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -54,13 +55,18 @@ import (
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
 	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+	"github.com/snapcore/snapd/snap/snapdelta"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
 )
 
 var api = []*Command{
@@ -74,6 +80,7 @@ var api = []*Command{
 	snapCmd,
 	snapConfCmd,
 	interfacesCmd,
+	connectionsCmd,
 	assertsCmd,
 	assertsFindManyCmd,
 	stateChangeCmd,
@@ -85,6 +92,12 @@ var api = []*Command{
 	usersCmd,
 	sectionsCmd,
 	aliasesCmd,
+	appsCmd,
+	logsCmd,
+	snapshotCmd,
+	warningsCmd,
+	validationSetsListCmd,
+	validationSetsCmd,
 	debugCmd,
 }
 
@@ -151,6 +164,12 @@ var (
 		POST:   changeInterfaces,
 	}
 
+	connectionsCmd = &Command{
+		Path:   "/v2/connections",
+		UserOK: true,
+		GET:    getConnections,
+	}
+
 	// TODO: allow to post assertions for UserOK? they are verified anyway
 	assertsCmd = &Command{
 		Path: "/v2/assertions",
@@ -223,6 +242,46 @@ var (
 		GET:    getAliases,
 		POST:   changeAliases,
 	}
+
+	appsCmd = &Command{
+		Path:   "/v2/apps",
+		UserOK: true,
+		GET:    getAppsInfo,
+		POST:   postApps,
+	}
+
+	logsCmd = &Command{
+		Path: "/v2/logs",
+		GET:  getLogs,
+	}
+
+	snapshotCmd = &Command{
+		// TODO: also support /v2/snapshots/<id>
+		Path:   "/v2/snapshots",
+		UserOK: true,
+		GET:    listSnapshots,
+		POST:   changeSnapshots,
+	}
+
+	warningsCmd = &Command{
+		Path:   "/v2/warnings",
+		UserOK: true,
+		GET:    getWarnings,
+		POST:   ackWarnings,
+	}
+
+	validationSetsListCmd = &Command{
+		Path:   "/v2/validation-sets",
+		UserOK: true,
+		GET:    listValidationSets,
+	}
+
+	validationSetsCmd = &Command{
+		Path:   "/v2/validation-sets/{account}/{name}",
+		UserOK: true,
+		GET:    getValidationSet,
+		POST:   applyValidationSet,
+	}
 )
 
 func tbd(c *Command, r *http.Request, user *auth.UserState) Response {
@@ -233,10 +292,15 @@ func sysInfo(c *Command, r *http.Request, user *auth.UserState) Response {
 	st := c.d.overlord.State()
 	st.Lock()
 	users, err := auth.Users(st)
-	st.Unlock()
 	if err != nil && err != state.ErrNoState {
+		st.Unlock()
 		return InternalError("cannot get user auth data: %s", err)
 	}
+	refreshInfo, err := refreshScheduleInfo(st, c.d.overlord.SnapManager())
+	st.Unlock()
+	if err != nil {
+		return InternalError("cannot get refresh schedule: %s", err)
+	}
 
 	m := map[string]interface{}{
 		"series":     release.Series,
@@ -246,6 +310,7 @@ func sysInfo(c *Command, r *http.Request, user *auth.UserState) Response {
 		"managed":    len(users) > 0,
 
 		"kernel-version": release.KernelVersion(),
+		"refresh":        refreshInfo,
 	}
 
 	// TODO: set the store-id here from the model information
@@ -256,6 +321,37 @@ func sysInfo(c *Command, r *http.Request, user *auth.UserState) Response {
 	return SyncResponse(m, nil)
 }
 
+// refreshScheduleInfo returns the auto-refresh schedule and the times of
+// the last and next auto-refresh, and of any hold, as far as known.
+func refreshScheduleInfo(st *state.State, snapMgr *snapstate.SnapManager) (map[string]interface{}, error) {
+	schedule, next, err := snapMgr.RefreshSchedule()
+	if err != nil {
+		return nil, err
+	}
+	last, err := snapstate.LastRefresh(st)
+	if err != nil {
+		return nil, err
+	}
+	hold, err := snapstate.RefreshHold(st)
+	if err != nil {
+		return nil, err
+	}
+	// a hold in the past holds nothing
+	if hold.Before(time.Now()) {
+		hold = time.Time{}
+	}
+
+	m := map[string]interface{}{
+		"schedule": schedule,
+	}
+	for key, t := range map[string]time.Time{"last": last, "next": next, "hold": hold} {
+		if !t.IsZero() {
+			m[key] = t.Format(time.RFC3339)
+		}
+	}
+	return m, nil
+}
+
 // userResponseData contains the data releated to user creation/login/query
 type userResponseData struct {
 	ID       int      `json:"id,omitempty"`
@@ -753,6 +849,7 @@ type snapInstruction struct {
 	JailMode         bool          `json:"jailmode"`
 	Classic          bool          `json:"classic"`
 	IgnoreValidation bool          `json:"ignore-validation"`
+	Purge            bool          `json:"purge,omitempty"`
 	// dropping support temporarely until flag confusion is sorted,
 	// this isn't supported by client atm anyway
 	LeaveOld bool         `json:"temp-dropped-leave-old"`
@@ -771,6 +868,7 @@ var (
 	snapstateCoreInfo          = snapstate.CoreInfo
 	snapstateInstall           = snapstate.Install
 	snapstateInstallPath       = snapstate.InstallPath
+	snapstateDeltaSource       = snapstate.DeltaSource
 	snapstateRefreshCandidates = snapstate.RefreshCandidates
 	snapstateTryPath           = snapstate.TryPath
 	snapstateUpdate            = snapstate.Update
@@ -882,7 +980,12 @@ func snapUpdateMany(inst *snapInstruction, st *state.State) (msg string, updated
 }
 
 func snapInstallMany(inst *snapInstruction, st *state.State) (msg string, installed []string, tasksets []*state.TaskSet, err error) {
-	installed, tasksets, err = snapstateInstallMany(st, inst.Snaps, inst.userID)
+	flags, err := inst.modeFlags()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	installed, tasksets, err = snapstateInstallMany(st, inst.Snaps, inst.Channel, inst.userID, flags)
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -954,7 +1057,7 @@ func snapUpdate(inst *snapInstruction, st *state.State) (string, []*state.TaskSe
 }
 
 func snapRemoveMany(inst *snapInstruction, st *state.State) (msg string, removed []string, tasksets []*state.TaskSet, err error) {
-	removed, tasksets, err = snapstateRemoveMany(st, inst.Snaps)
+	removed, tasksets, err = snapstateRemoveMany(st, inst.Snaps, &snapstate.RemoveFlags{Purge: inst.Purge})
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -974,7 +1077,7 @@ func snapRemoveMany(inst *snapInstruction, st *state.State) (msg string, removed
 }
 
 func snapRemove(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
-	ts, err := snapstate.Remove(st, inst.Snaps[0], inst.Revision)
+	ts, err := snapstate.Remove(st, inst.Snaps[0], inst.Revision, &snapstate.RemoveFlags{Purge: inst.Purge})
 	if err != nil {
 		return "", nil, err
 	}
@@ -1286,6 +1389,11 @@ func postSnaps(c *Command, r *http.Request, user *auth.UserState) Response {
 		return trySnap(c, r, user, form.Value["snap-path"][0], flags)
 	}
 
+	if fheaders := form.File["bundle"]; len(fheaders) > 0 {
+		defer form.RemoveAll()
+		return sideloadBundle(c, user, fheaders[0], flags)
+	}
+
 	// find the file for the "snap" form field
 	var snapBody multipart.File
 	var origPath string
@@ -1343,10 +1451,34 @@ out:
 	var snapName string
 	var sideInfo *snap.SideInfo
 
+	// a delta cannot be read as a snap, its metadata comes from the
+	// installed snap it was created from and from the digest of the
+	// snap it reconstructs
+	deltaHeader, err := snapdelta.ReadHeader(tempPath)
+	if err != nil && err != snapdelta.ErrNotDelta {
+		return BadRequest("cannot read snap file: %v", err)
+	}
+	deriveSideInfo := func() (*snap.SideInfo, error) {
+		return snapasserts.DeriveSideInfo(tempPath, assertstate.DB(st))
+	}
+	if deltaHeader != nil {
+		sourceName, _, err := snapstateDeltaSource(st, deltaHeader)
+		if err != nil {
+			return BadRequest("cannot install snap delta: %v", err)
+		}
+		snapName = sourceName
+		deriveSideInfo = func() (*snap.SideInfo, error) {
+			return snapasserts.DeriveSideInfoFromDigest(origPath, deltaHeader.TargetSHA3_384, deltaHeader.TargetSize, assertstate.DB(st))
+		}
+	}
+
 	if !dangerousOK {
-		si, err := snapasserts.DeriveSideInfo(tempPath, assertstate.DB(st))
+		si, err := deriveSideInfo()
 		switch err {
 		case nil:
+			if snapName != "" && si.RealName != snapName {
+				return BadRequest("cannot install snap delta: it reconstructs snap %q from snap %q", si.RealName, snapName)
+			}
 			snapName = si.RealName
 			sideInfo = si
 		case asserts.ErrNotFound:
@@ -1365,6 +1497,10 @@ out:
 		}
 	}
 
+	if sideInfo == nil && snapName != "" {
+		// potentially dangerous delta, dangerous or devmode params were set
+		sideInfo = &snap.SideInfo{RealName: snapName}
+	}
 	if snapName == "" {
 		// potentially dangerous but dangerous or devmode params were set
 		info, err := unsafeReadSnapInfo(tempPath)
@@ -1406,6 +1542,205 @@ out:
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
 
+// bundleInstallOrder orders the snaps of a bundle so that the
+// prerequisites of a snap, the core snap or its base and its default
+// content providers, are installed before it.
+func bundleInstallOrder(infos []*snap.Info) []*snap.Info {
+	byName := make(map[string]*snap.Info, len(infos))
+	for _, info := range infos {
+		byName[info.Name()] = info
+	}
+
+	ordered := make([]*snap.Info, 0, len(infos))
+	visited := make(map[string]bool, len(infos))
+	var visit func(info *snap.Info)
+	visit = func(info *snap.Info) {
+		if visited[info.Name()] {
+			return
+		}
+		visited[info.Name()] = true
+		for _, name := range snapbundle.Prerequisites(info) {
+			if prereq := byName[name]; prereq != nil {
+				visit(prereq)
+			}
+		}
+		ordered = append(ordered, info)
+	}
+
+	for _, info := range infos {
+		if info.Type == snap.TypeOS {
+			visit(info)
+		}
+	}
+	for _, info := range infos {
+		visit(info)
+	}
+	return ordered
+}
+
+// checkBundlePrerequisites checks that the prerequisites of the snaps
+// of a bundle are either in the bundle or already installed, as the
+// bundle is meant for systems without access to the store.
+func checkBundlePrerequisites(st *state.State, infos []*snap.Info) error {
+	inBundle := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		inBundle[info.Name()] = true
+		if info.Type == snap.TypeOS {
+			inBundle[snapbundle.CoreSnapName] = true
+		}
+	}
+
+	for _, info := range infos {
+		for _, name := range snapbundle.Prerequisites(info) {
+			if inBundle[name] {
+				continue
+			}
+			if name == snapbundle.CoreSnapName {
+				_, err := snapstateCoreInfo(st)
+				if err == nil {
+					continue
+				}
+				if err != state.ErrNoState {
+					return err
+				}
+			} else {
+				var snapst snapstate.SnapState
+				err := snapstate.Get(st, name, &snapst)
+				if err != nil && err != state.ErrNoState {
+					return err
+				}
+				if snapst.HasCurrent() {
+					continue
+				}
+			}
+			return fmt.Errorf("snap %q needs snap %q which is neither installed nor in the bundle", info.Name(), name)
+		}
+	}
+	return nil
+}
+
+// sideloadBundle installs in one change all the snaps of an uploaded
+// bundle, after adding the bundle assertions to the system database.
+// Every snap of the bundle must be covered by the assertions.
+func sideloadBundle(c *Command, user *auth.UserState, fheader *multipart.FileHeader, flags snapstate.Flags) Response {
+	bundleBody, err := fheader.Open()
+	if err != nil {
+		return BadRequest(`cannot open uploaded "bundle" file: %v`, err)
+	}
+	defer bundleBody.Close()
+
+	tmpdir, err := ioutil.TempDir("", "snapd-sideload-bundle-")
+	if err != nil {
+		return InternalError("cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	bundle, err := snapbundle.Extract(bundleBody, tmpdir)
+	if err != nil {
+		return BadRequest(err.Error())
+	}
+
+	// we are in charge of the tempfiles life cycle until we hand
+	// them off to the change
+	changeTriggered := false
+	var tempPaths []string
+	defer func() {
+		if !changeTriggered {
+			for _, tempPath := range tempPaths {
+				os.Remove(tempPath)
+			}
+		}
+	}()
+	paths := make(map[string]string, len(bundle.Snaps))
+
+	batch := assertstate.NewBatch()
+	for _, a := range bundle.Assertions {
+		if err := batch.Add(a); err != nil {
+			return BadRequest("cannot add bundle assertion %v: %v", a.Ref(), err)
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if err := batch.Commit(st); err != nil {
+		return BadRequest("cannot add bundle assertions: %v", err)
+	}
+
+	db := assertstate.DB(st)
+	infos := make([]*snap.Info, 0, len(bundle.Snaps))
+	for _, snapPath := range bundle.Snaps {
+		si, err := snapasserts.DeriveSideInfo(snapPath, db)
+		if err == asserts.ErrNotFound {
+			return BadRequest("cannot find signatures with metadata for snap %q in bundle", filepath.Base(snapPath))
+		}
+		if err != nil {
+			return BadRequest(err.Error())
+		}
+		info, err := unsafeReadSnapInfo(snapPath)
+		if err != nil {
+			return BadRequest("cannot read snap file: %v", err)
+		}
+		info.SideInfo = *si
+		if paths[info.Name()] != "" {
+			return BadRequest("cannot install snap %q more than once from bundle", info.Name())
+		}
+		infos = append(infos, info)
+
+		// move the snap out of tmpdir, it gets removed once installed
+		tmpf, err := ioutil.TempFile("", "snapd-sideload-pkg-")
+		if err != nil {
+			return InternalError("cannot create temporary file: %v", err)
+		}
+		tmpf.Close()
+		tempPaths = append(tempPaths, tmpf.Name())
+		if err := os.Rename(snapPath, tmpf.Name()); err != nil {
+			return InternalError("cannot move snap into temporary file: %v", err)
+		}
+		paths[info.Name()] = tmpf.Name()
+	}
+
+	if err := checkBundlePrerequisites(st, infos); err != nil {
+		return BadRequest("cannot install snap bundle: %v", err)
+	}
+
+	var tsets []*state.TaskSet
+	var prev *state.TaskSet
+	flags.RemoveSnapPath = true
+	var names []string
+	for _, info := range bundleInstallOrder(infos) {
+		ts, err := snapstateInstallPath(st, &info.SideInfo, paths[info.Name()], "", flags)
+		if err != nil {
+			return InternalError("cannot install snap %q from bundle: %v", info.Name(), err)
+		}
+		if prev != nil {
+			ts.WaitAll(prev)
+		}
+		prev = ts
+		tsets = append(tsets, ts)
+		names = append(names, info.Name())
+	}
+
+	// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+	msg := fmt.Sprintf(i18n.G("Install snaps %s from bundle"), strutil.Quoted(names))
+	if fheader.Filename != "" {
+		// TRANSLATORS: the first %s is a comma-separated list of quoted snap names, the %q the bundle file name
+		msg = fmt.Sprintf(i18n.G("Install snaps %s from bundle %q"), strutil.Quoted(names), fheader.Filename)
+	}
+
+	chg := newChange(st, "install-snap", msg, tsets, names)
+	chg.Set("api-data", map[string]interface{}{"snap-names": names})
+
+	ensureStateSoon(st)
+
+	// only when the unlock succeeds (as opposed to panicing) is the handoff done
+	// but this is good enough
+	changeTriggered = true
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
 func unsafeReadSnapInfoImpl(snapPath string) (*snap.Info, error) {
 	// Condider using DeriveSideInfo before falling back to this!
 	snapf, err := snap.Open(snapPath)
@@ -1500,10 +1835,208 @@ func setSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 	return AsyncResponse(nil, &Meta{Change: change.ID()})
 }
 
+// interfacesJSON aids in marshaling the plugs and slots of the repository
+// together with the recorded state of the connections into JSON.
+type interfacesJSON struct {
+	Plugs            []*interfaces.Plug    `json:"plugs"`
+	Slots            []*interfaces.Slot    `json:"slots"`
+	ConnectionStates []connectionStateJSON `json:"connection-states,omitempty"`
+}
+
+// connectionStateJSON aids in marshaling ifacestate.ConnectionState into JSON.
+type connectionStateJSON struct {
+	Plug      interfaces.PlugRef `json:"plug"`
+	Slot      interfaces.SlotRef `json:"slot"`
+	Interface string             `json:"interface,omitempty"`
+	Auto      bool               `json:"auto,omitempty"`
+	ByGadget  bool               `json:"by-gadget,omitempty"`
+	Undesired bool               `json:"undesired,omitempty"`
+}
+
 // getInterfaces returns all plugs and slots.
 func getInterfaces(c *Command, r *http.Request, user *auth.UserState) Response {
 	repo := c.d.overlord.InterfaceManager().Repository()
-	return SyncResponse(repo.Interfaces(), nil)
+	ifaces := repo.Interfaces()
+
+	st := c.d.overlord.State()
+	st.Lock()
+	connStates, err := ifacestate.ConnectionStates(st)
+	st.Unlock()
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	ids := make([]string, 0, len(connStates))
+	for id := range connStates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := &interfacesJSON{Plugs: ifaces.Plugs, Slots: ifaces.Slots}
+	for _, id := range ids {
+		connRef, err := interfaces.ParseConnRef(id)
+		if err != nil {
+			return InternalError("%v", err)
+		}
+		cs := connStates[id]
+		result.ConnectionStates = append(result.ConnectionStates, connectionStateJSON{
+			Plug:      connRef.PlugRef,
+			Slot:      connRef.SlotRef,
+			Interface: cs.Interface,
+			Auto:      cs.Auto,
+			ByGadget:  cs.ByGadget,
+			Undesired: cs.Undesired,
+		})
+	}
+	return SyncResponse(result, nil)
+}
+
+// connectionJSON aids in marshaling a connection into JSON.
+type connectionJSON struct {
+	Slot      interfaces.SlotRef     `json:"slot"`
+	SlotAttrs map[string]interface{} `json:"slot-attrs,omitempty"`
+	Plug      interfaces.PlugRef     `json:"plug"`
+	PlugAttrs map[string]interface{} `json:"plug-attrs,omitempty"`
+	Interface string                 `json:"interface"`
+	// Origin is one of "manual", "auto" or "gadget".
+	Origin string `json:"origin"`
+}
+
+// connectionsJSON aids in marshaling the result of GET /v2/connections.
+type connectionsJSON struct {
+	Established []connectionJSON `json:"established"`
+	// Undesired lists the automatic connections that were disconnected
+	// by the user.
+	Undesired []connectionJSON `json:"undesired,omitempty"`
+	// Plugs and Slots list the plugs and slots that are not connected,
+	// when asked for all of them.
+	Plugs []*interfaces.Plug `json:"plugs,omitempty"`
+	Slots []*interfaces.Slot `json:"slots,omitempty"`
+}
+
+func connectionOrigin(cs ifacestate.ConnectionState) string {
+	switch {
+	case cs.ByGadget:
+		return "gadget"
+	case cs.Auto:
+		return "auto"
+	}
+	return "manual"
+}
+
+// getConnections returns the connections in the system, optionally
+// filtered by snap and interface, and with select=all also the plugs and
+// slots that are not connected.
+func getConnections(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+	snapName := query.Get("snap")
+	ifaceName := query.Get("interface")
+	var all bool
+	switch sel := query.Get("select"); sel {
+	case "", "connected":
+	case "all":
+		all = true
+	default:
+		return BadRequest("invalid select parameter: %q", sel)
+	}
+
+	repo := c.d.overlord.InterfaceManager().Repository()
+	ifaces := repo.Interfaces()
+
+	st := c.d.overlord.State()
+	st.Lock()
+	connStates, err := ifacestate.ConnectionStates(st)
+	st.Unlock()
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	wanted := func(iface string, snapNames ...string) bool {
+		if ifaceName != "" && ifaceName != iface {
+			return false
+		}
+		if snapName == "" {
+			return true
+		}
+		for _, name := range snapNames {
+			if name == snapName {
+				return true
+			}
+		}
+		return false
+	}
+
+	result := &connectionsJSON{Established: []connectionJSON{}}
+	for _, plug := range ifaces.Plugs {
+		for _, slotRef := range plug.Connections {
+			if !wanted(plug.Interface, plug.Snap.Name(), slotRef.Snap) {
+				continue
+			}
+			connRef := interfaces.ConnRef{PlugRef: plug.Ref(), SlotRef: slotRef}
+			plugAttrs, slotAttrs, err := repo.ConnectionAttrs(connRef)
+			if err != nil {
+				// disconnected in the meantime
+				continue
+			}
+			result.Established = append(result.Established, connectionJSON{
+				Slot:      slotRef,
+				SlotAttrs: slotAttrs,
+				Plug:      connRef.PlugRef,
+				PlugAttrs: plugAttrs,
+				Interface: plug.Interface,
+				Origin:    connectionOrigin(connStates[connRef.ID()]),
+			})
+		}
+		if all && len(plug.Connections) == 0 && wanted(plug.Interface, plug.Snap.Name()) {
+			result.Plugs = append(result.Plugs, plug)
+		}
+	}
+	if all {
+		for _, slot := range ifaces.Slots {
+			if len(slot.Connections) == 0 && wanted(slot.Interface, slot.Snap.Name()) {
+				result.Slots = append(result.Slots, slot)
+			}
+		}
+		for id, cs := range connStates {
+			if !cs.Undesired {
+				continue
+			}
+			connRef, err := interfaces.ParseConnRef(id)
+			if err != nil {
+				return InternalError("%v", err)
+			}
+			if !wanted(cs.Interface, connRef.PlugRef.Snap, connRef.SlotRef.Snap) {
+				continue
+			}
+			result.Undesired = append(result.Undesired, connectionJSON{
+				Slot:      connRef.SlotRef,
+				Plug:      connRef.PlugRef,
+				Interface: cs.Interface,
+				Origin:    connectionOrigin(cs),
+			})
+		}
+	}
+	sort.Sort(byConnRef(result.Established))
+	sort.Sort(byConnRef(result.Undesired))
+
+	return SyncResponse(result, nil)
+}
+
+type byConnRef []connectionJSON
+
+func (c byConnRef) Len() int      { return len(c) }
+func (c byConnRef) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byConnRef) Less(i, j int) bool {
+	if c[i].Plug.Snap != c[j].Plug.Snap {
+		return c[i].Plug.Snap < c[j].Plug.Snap
+	}
+	if c[i].Plug.Name != c[j].Plug.Name {
+		return c[i].Plug.Name < c[j].Plug.Name
+	}
+	if c[i].Slot.Snap != c[j].Slot.Snap {
+		return c[i].Slot.Snap < c[j].Slot.Snap
+	}
+	return c[i].Slot.Name < c[j].Slot.Name
 }
 
 // plugJSON aids in marshaling Plug into JSON.
@@ -1531,6 +2064,7 @@ type slotJSON struct {
 // interfaceAction is an action performed on the interface system.
 type interfaceAction struct {
 	Action string     `json:"action"`
+	Forget bool       `json:"forget,omitempty"`
 	Plugs  []plugJSON `json:"plugs,omitempty"`
 	Slots  []slotJSON `json:"slots,omitempty"`
 }
@@ -1560,6 +2094,9 @@ func changeInterfaces(c *Command, r *http.Request, user *auth.UserState) Respons
 	if len(a.Plugs) == 0 || len(a.Slots) == 0 {
 		return BadRequest("at least one plug and slot is required")
 	}
+	if a.Forget && a.Action != "disconnect" {
+		return BadRequest("forget is only supported when disconnecting")
+	}
 
 	var summary string
 	var taskset *state.TaskSet
@@ -1580,7 +2117,11 @@ func changeInterfaces(c *Command, r *http.Request, user *auth.UserState) Respons
 		}
 	case "disconnect":
 		summary = fmt.Sprintf("Disconnect %s:%s from %s:%s", a.Plugs[0].Snap, a.Plugs[0].Name, a.Slots[0].Snap, a.Slots[0].Name)
-		taskset, err = ifacestate.Disconnect(state, a.Plugs[0].Snap, a.Plugs[0].Name, a.Slots[0].Snap, a.Slots[0].Name)
+		if a.Forget {
+			taskset, err = ifacestate.Forget(state, a.Plugs[0].Snap, a.Plugs[0].Name, a.Slots[0].Snap, a.Slots[0].Name)
+		} else {
+			taskset, err = ifacestate.Disconnect(state, a.Plugs[0].Snap, a.Plugs[0].Name, a.Slots[0].Snap, a.Slots[0].Name)
+		}
 	}
 	if err != nil {
 		return BadRequest("%v", err)
@@ -1699,11 +2240,17 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 	for j, t := range tasks {
 		label, done, total := t.Progress()
 
+		taskStatus := t.Status().String()
+		if t.IsThrottled() {
+			// ready to run, but held back by a concurrency limit
+			taskStatus = "Throttled"
+		}
+
 		taskInfo := &taskInfo{
 			ID:      t.ID(),
 			Kind:    t.Kind(),
 			Summary: t.Summary(),
-			Status:  t.Status().String(),
+			Status:  taskStatus,
 			Log:     t.Log(),
 			Progress: taskInfoProgress{
 				Label: label,
@@ -2206,6 +2753,21 @@ func runSnapctl(c *Command, r *http.Request, user *auth.UserState) Response {
 	context, _ := c.d.overlord.HookManager().Context(snapctlOptions.ContextID)
 	stdout, stderr, err := ctlcmd.Run(context, snapctlOptions.Args)
 	if err != nil {
+		if e, ok := err.(*ctlcmd.UnsuccessfulError); ok {
+			return &resp{
+				Type: ResponseTypeError,
+				Result: &errorResult{
+					Message: e.Error(),
+					Kind:    errorKindUnsuccessful,
+					Value: map[string]interface{}{
+						"stdout":    string(stdout),
+						"stderr":    string(stderr),
+						"exit-code": e.ExitCode,
+					},
+				},
+				Status: http.StatusOK,
+			}
+		}
 		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
 			stdout = []byte(e.Error())
 		} else {
@@ -2354,3 +2916,485 @@ func getAliases(c *Command, r *http.Request, user *auth.UserState) Response {
 
 	return SyncResponse(res, nil)
 }
+
+// splitQS splits a comma-separated query string parameter into its
+// non-empty elements.
+func splitQS(qs string) []string {
+	qsl := strings.Split(qs, ",")
+	split := make([]string, 0, len(qsl))
+	for _, elem := range qsl {
+		elem = strings.TrimSpace(elem)
+		if len(elem) > 0 {
+			split = append(split, elem)
+		}
+	}
+
+	return split
+}
+
+func getAppsInfo(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+
+	opts := appInfoOptions{}
+	switch sel := query.Get("select"); sel {
+	case "":
+		// nothing to do
+	case "service":
+		opts.service = true
+	default:
+		return BadRequest("invalid select parameter: %q", sel)
+	}
+
+	appInfos, rsp := appInfosFor(c.d.overlord.State(), splitQS(query.Get("names")), opts)
+	if rsp != nil {
+		return rsp
+	}
+
+	clientAppInfos, err := clientAppInfosFromSnapAppInfos(appInfos)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	return SyncResponse(clientAppInfos, nil)
+}
+
+func postApps(c *Command, r *http.Request, user *auth.UserState) Response {
+	var inst servicestate.Instruction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&inst); err != nil {
+		return BadRequest("cannot decode request body into service operation: %v", err)
+	}
+	if len(inst.Names) == 0 {
+		// on POST, don't allow empty to mean all
+		return BadRequest("cannot perform operation on services without a list of services to operate on")
+	}
+
+	st := c.d.overlord.State()
+	appInfos, rsp := appInfosFor(st, inst.Names, appInfoOptions{service: true})
+	if rsp != nil {
+		return rsp
+	}
+	if len(appInfos) == 0 {
+		return NotFound("no matching services")
+	}
+
+	var snapNames []string
+	seen := make(map[string]bool)
+	for _, app := range appInfos {
+		if !seen[app.Snap.Name()] {
+			seen[app.Snap.Name()] = true
+			snapNames = append(snapNames, app.Snap.Name())
+		}
+	}
+
+	st.Lock()
+	defer st.Unlock()
+
+	ts, err := servicestate.Control(st, appInfos, &inst, "")
+	if err != nil {
+		return BadRequest("cannot %s services: %v", inst.Action, err)
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run service command %q for %s"), inst.Action, strutil.Quoted(inst.Names))
+	chg := newChange(st, "service-control", summary, []*state.TaskSet{ts}, snapNames)
+
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+func getLogs(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+	n := 10
+	if s := query.Get("n"); s != "" {
+		m, err := strconv.ParseInt(s, 0, 32)
+		if err != nil {
+			return BadRequest(`invalid value for n: %q: %v`, s, err)
+		}
+		n = int(m)
+	}
+	follow := false
+	if s := query.Get("follow"); s != "" {
+		f, err := strconv.ParseBool(s)
+		if err != nil {
+			return BadRequest(`invalid value for follow: %q: %v`, s, err)
+		}
+		follow = f
+	}
+
+	// only services have logs for now
+	appInfos, rsp := appInfosFor(c.d.overlord.State(), splitQS(query.Get("names")), appInfoOptions{service: true})
+	if rsp != nil {
+		return rsp
+	}
+	if len(appInfos) == 0 {
+		return NotFound("no matching services")
+	}
+
+	serviceNames := make([]string, len(appInfos))
+	for i, appInfo := range appInfos {
+		serviceNames[i] = appInfo.ServiceName()
+	}
+
+	nstr := "all"
+	if n >= 0 {
+		nstr = strconv.Itoa(n)
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, &progress.NullProgress{})
+	reader, err := sysd.LogReader(serviceNames, nstr, follow)
+	if err != nil {
+		return InternalError("cannot get logs: %v", err)
+	}
+
+	return &journalLineReaderSeqResponse{
+		ReadCloser: reader,
+		follow:     follow,
+	}
+}
+
+var (
+	snapshotList    = snapshotstate.List
+	snapshotCheck   = snapshotstate.Check
+	snapshotForget  = snapshotstate.Forget
+	snapshotRestore = snapshotstate.Restore
+	snapshotSave    = snapshotstate.Save
+)
+
+func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+	var setID uint64
+	if sid := query.Get("set"); sid != "" {
+		var err error
+		setID, err = strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			return BadRequest("'set', if given, must be a positive base 10 number; got %q", sid)
+		}
+	}
+
+	sets, err := snapshotList(setID, splitQS(query.Get("snaps")))
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	return SyncResponse(sets, nil)
+}
+
+// snapshotAction is used to request an operation on a snapshot
+// keep this in sync with client/snapshot.go
+type snapshotAction struct {
+	SetID  uint64   `json:"set"`
+	Action string   `json:"action"`
+	Snaps  []string `json:"snaps,omitempty"`
+	Users  []string `json:"users,omitempty"`
+}
+
+func (action snapshotAction) String() string {
+	// verb of snapshot #N [for snaps %q] [for users %q]
+	var snaps string
+	var users string
+	if len(action.Snaps) > 0 {
+		snaps = " of snaps " + strutil.Quoted(action.Snaps)
+	}
+	if len(action.Users) > 0 {
+		users = " for users " + strutil.Quoted(action.Users)
+	}
+	return fmt.Sprintf("%s of snapshot set #%d%s%s", strings.Title(action.Action), action.SetID, snaps, users)
+}
+
+func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	var action snapshotAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&action); err != nil {
+		return BadRequest("cannot decode request body into snapshot operation: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("extra content found after snapshot operation")
+	}
+
+	if action.Action == "snapshot" {
+		if action.SetID != 0 {
+			return BadRequest(`snapshot operation "snapshot" does not take a set id`)
+		}
+		return saveSnapshots(c, &action)
+	}
+
+	if action.SetID == 0 {
+		return BadRequest("snapshot operation requires set id")
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var ts *state.TaskSet
+	var snapNames []string
+	var err error
+	switch action.Action {
+	case "check":
+		snapNames, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users)
+	case "restore":
+		snapNames, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+	case "forget":
+		if len(action.Users) != 0 {
+			return BadRequest(`snapshot operation "forget" does not take a list of users`)
+		}
+		snapNames, ts, err = snapshotForget(st, action.SetID, action.Snaps)
+	case "":
+		return BadRequest("snapshot operation not specified")
+	default:
+		return BadRequest("unknown snapshot operation %q", action.Action)
+	}
+
+	if err != nil {
+		return BadRequest("cannot %s snapshot set #%d: %v", action.Action, action.SetID, err)
+	}
+
+	chg := newChange(st, action.Action+"-snapshot", action.String(), []*state.TaskSet{ts}, snapNames)
+	chg.Set("api-data", map[string]interface{}{"set-id": action.SetID, "snap-names": snapNames})
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+func saveSnapshots(c *Command, action *snapshotAction) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	setID, snapNames, ts, err := snapshotSave(st, action.Snaps, action.Users)
+	if err != nil {
+		return BadRequest("cannot save snapshot: %v", err)
+	}
+
+	var summary string
+	switch len(snapNames) {
+	case 1:
+		summary = fmt.Sprintf(i18n.G("Snapshot snap %s"), strutil.Quoted(snapNames))
+	default:
+		summary = fmt.Sprintf(i18n.G("Snapshot snaps %s"), strutil.Quoted(snapNames))
+	}
+	if len(action.Users) > 0 {
+		summary += fmt.Sprintf(i18n.G(" for users %s"), strutil.Quoted(action.Users))
+	}
+
+	chg := newChange(st, "save-snapshot", summary, []*state.TaskSet{ts}, snapNames)
+	chg.Set("api-data", map[string]interface{}{"set-id": setID, "snap-names": snapNames})
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+func getWarnings(c *Command, r *http.Request, _ *auth.UserState) Response {
+	query := r.URL.Query()
+	var all bool
+	sel := query.Get("select")
+	switch sel {
+	case "all":
+		all = true
+	case "pending", "":
+		all = false
+	default:
+		return BadRequest("invalid select parameter: %q", sel)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var ws []*state.Warning
+	if all {
+		ws = st.AllWarnings()
+	} else {
+		ws, _ = st.PendingWarnings()
+	}
+	if len(ws) == 0 {
+		// no need to confuse the issue
+		return SyncResponse([]state.Warning{}, nil)
+	}
+
+	return SyncResponse(ws, nil)
+}
+
+func ackWarnings(c *Command, r *http.Request, _ *auth.UserState) Response {
+	defer r.Body.Close()
+	var op struct {
+		Action    string    `json:"action"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&op); err != nil {
+		return BadRequest("cannot decode request body into warnings operation: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("spurious content after warnings operation")
+	}
+	if op.Action != "okay" {
+		return BadRequest("unknown warning action %q", op.Action)
+	}
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	n := st.OkayWarnings(op.Timestamp)
+
+	return SyncResponse(n, nil)
+}
+
+var (
+	assertstateMonitorValidationSet = assertstate.MonitorValidationSet
+	assertstateEnforceValidationSet = assertstate.EnforceValidationSet
+	assertstateCheckValidationSet   = assertstate.CheckValidationSet
+)
+
+type validationSetResult struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	PinnedAt  int    `json:"pinned-at,omitempty"`
+	Sequence  int    `json:"sequence"`
+	Valid     bool   `json:"valid"`
+}
+
+func validationSetResultFor(st *state.State, tr *assertstate.ValidationSetTracking) (*validationSetResult, error) {
+	err := assertstateCheckValidationSet(st, tr)
+	if _, ok := err.(*snapasserts.ValidationSetsValidationError); err != nil && !ok {
+		return nil, err
+	}
+	return &validationSetResult{
+		AccountID: tr.AccountID,
+		Name:      tr.Name,
+		Mode:      string(tr.Mode),
+		PinnedAt:  tr.PinnedAt,
+		Sequence:  tr.Current,
+		Valid:     err == nil,
+	}, nil
+}
+
+func listValidationSets(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	vsmap, err := assertstate.ValidationSets(st)
+	if err != nil {
+		return InternalError("cannot list validation sets: %v", err)
+	}
+	keys := make([]string, 0, len(vsmap))
+	for key := range vsmap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	results := make([]*validationSetResult, len(keys))
+	for i, key := range keys {
+		res, err := validationSetResultFor(st, vsmap[key])
+		if err != nil {
+			return InternalError("cannot check validation set %q: %v", key, err)
+		}
+		results[i] = res
+	}
+	return SyncResponse(results, nil)
+}
+
+func getValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response {
+	vars := muxVars(r)
+	accountID, name := vars["account"], vars["name"]
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var tr assertstate.ValidationSetTracking
+	err := assertstate.GetValidationSet(st, accountID, name, &tr)
+	if err == state.ErrNoState {
+		return NotFound("validation set %q is not tracked", snapasserts.ValidationSetKey(accountID, name))
+	}
+	if err != nil {
+		return InternalError("cannot get validation set: %v", err)
+	}
+	res, err := validationSetResultFor(st, &tr)
+	if err != nil {
+		return InternalError("cannot check validation set %q: %v", tr.Key(), err)
+	}
+	return SyncResponse(res, nil)
+}
+
+type validationSetAction struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode"`
+	Sequence int    `json:"sequence,omitempty"`
+}
+
+func applyValidationSet(c *Command, r *http.Request, user *auth.UserState) Response {
+	vars := muxVars(r)
+	accountID, name := vars["account"], vars["name"]
+	key := snapasserts.ValidationSetKey(accountID, name)
+
+	var action validationSetAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&action); err != nil {
+		return BadRequest("cannot decode request body into validation set action: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("spurious content after validation set action")
+	}
+	if action.Sequence < 0 {
+		return BadRequest("invalid sequence %d", action.Sequence)
+	}
+
+	var userID int
+	if user != nil {
+		userID = user.ID
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	switch action.Action {
+	case "forget":
+		if action.Mode != "" || action.Sequence != 0 {
+			return BadRequest(`validation set action "forget" does not take a mode or a sequence`)
+		}
+		if err := assertstate.ForgetValidationSet(st, accountID, name); err != nil {
+			return BadRequest("%v", err)
+		}
+		return SyncResponse(nil, nil)
+	case "apply":
+		// handled below
+	default:
+		return BadRequest("unknown validation set action %q", action.Action)
+	}
+
+	var tr *assertstate.ValidationSetTracking
+	var tss []*state.TaskSet
+	var err error
+	switch assertstate.ValidationSetMode(action.Mode) {
+	case assertstate.Monitor:
+		tr, err = assertstateMonitorValidationSet(st, accountID, name, action.Sequence, userID)
+	case assertstate.Enforce:
+		tr, tss, err = assertstateEnforceValidationSet(st, accountID, name, action.Sequence, userID)
+	default:
+		return BadRequest("invalid validation set mode %q", action.Mode)
+	}
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	if len(tss) != 0 {
+		summary := fmt.Sprintf(i18n.G("Enforce validation set %q"), key)
+		chg := newChange(st, "enforce-validation-set", summary, tss, nil)
+		chg.Set("api-data", map[string]interface{}{
+			"account-id": accountID,
+			"name":       name,
+			"sequence":   tr.Current,
+		})
+		ensureStateSoon(st)
+		return AsyncResponse(nil, &Meta{Change: chg.ID()})
+	}
+
+	res, err := validationSetResultFor(st, tr)
+	if err != nil {
+		return InternalError("cannot check validation set %q: %v", key, err)
+	}
+	return SyncResponse(res, nil)
+}
@@ -38,6 +38,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,10 +46,13 @@ import (
 	"golang.org/x/net/context"
 	"gopkg.in/check.v1"
 	"gopkg.in/macaroon.v1"
+	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
@@ -57,13 +61,17 @@ import (
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+	"github.com/snapcore/snapd/snap/snapdelta"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
 )
 
@@ -76,7 +84,8 @@ type apiBaseSuite struct {
 	d                 *Daemon
 	user              *auth.UserState
 	restoreBackends   func()
-	refreshCandidates []*store.RefreshCandidate
+	currentSnaps      []*store.CurrentSnap
+	actions           []*store.SnapAction
 	buyOptions        *store.BuyOptions
 	buyResult         *store.BuyResult
 	storeSigning      *assertstest.StoreStack
@@ -99,8 +108,9 @@ func (s *apiBaseSuite) Find(search *store.Search, user *auth.UserState) ([]*snap
 	return s.rsnaps, s.err
 }
 
-func (s *apiBaseSuite) ListRefresh(snaps []*store.RefreshCandidate, user *auth.UserState) ([]*snap.Info, error) {
-	s.refreshCandidates = snaps
+func (s *apiBaseSuite) SnapAction(currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, user *auth.UserState) ([]*snap.Info, error) {
+	s.currentSnaps = currentSnaps
+	s.actions = actions
 	s.user = user
 
 	return s.rsnaps, s.err
@@ -169,7 +179,8 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 	s.vars = nil
 	s.user = nil
 	s.d = nil
-	s.refreshCandidates = nil
+	s.currentSnaps = nil
+	s.actions = nil
 	// Disable real security backends for all API tests
 	s.restoreBackends = ifacestate.MockSecurityBackends(nil)
 
@@ -181,6 +192,7 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 
 	assertstateRefreshSnapDeclarations = nil
 	snapstateCoreInfo = nil
+	snapstateDeltaSource = nil
 	snapstateInstall = nil
 	snapstateInstallMany = nil
 	snapstateInstallPath = nil
@@ -203,6 +215,7 @@ func (s *apiBaseSuite) TearDownTest(c *check.C) {
 
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
 	snapstateCoreInfo = snapstate.CoreInfo
+	snapstateDeltaSource = snapstate.DeltaSource
 	snapstateInstall = snapstate.Install
 	snapstateInstallMany = snapstate.InstallMany
 	snapstateInstallPath = snapstate.InstallPath
@@ -488,6 +501,7 @@ func (s *apiSuite) TestListIncludesAll(c *check.C) {
 		"snapstateInstall",
 		"snapstateUpdate",
 		"snapstateInstallPath",
+		"snapstateDeltaSource",
 		"snapstateTryPath",
 		"snapstateCoreInfo",
 		"snapstateUpdateMany",
@@ -503,6 +517,16 @@ func (s *apiSuite) TestListIncludesAll(c *check.C) {
 		"storeUserInfo",
 		"postCreateUserUcrednetGetUID",
 		"ensureStateSoon",
+		// snapshot vars:
+		"snapshotList",
+		"snapshotCheck",
+		"snapshotForget",
+		"snapshotRestore",
+		"snapshotSave",
+		// validation set vars:
+		"assertstateMonitorValidationSet",
+		"assertstateEnforceValidationSet",
+		"assertstateCheckValidationSet",
 	}
 	c.Check(found, check.Equals, len(api)+len(exceptions),
 		check.Commentf(`At a glance it looks like you've not added all the Commands defined in api to the api list. If that is not the case, please add the exception to the "exceptions" list in this test.`))
@@ -558,6 +582,9 @@ func (s *apiSuite) TestSysInfo(c *check.C) {
 		},
 		"on-classic": true,
 		"managed":    false,
+		"refresh": map[string]interface{}{
+			"schedule": "00:00-04:59/5:00-10:59/11:00-16:59/17:00-23:59",
+		},
 	}
 	var rsp resp
 	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
@@ -570,6 +597,31 @@ func (s *apiSuite) TestSysInfo(c *check.C) {
 	c.Check(rsp.Result, check.DeepEquals, expected)
 }
 
+func (s *apiSuite) TestSysInfoRefreshSchedule(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "refresh.schedule", "mon-fri@9:00-11:00")
+	tr.Set("core", "refresh.last", "2017-08-07T10:00:00Z")
+	tr.Set("core", "refresh.hold", "2017-08-10T15:04:05Z")
+	tr.Commit()
+	st.Unlock()
+
+	rec := httptest.NewRecorder()
+	sysInfoCmd.GET(sysInfoCmd, nil, nil).ServeHTTP(rec, nil)
+	c.Check(rec.Code, check.Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	// the hold is in the past
+	c.Check(rsp.Result.(map[string]interface{})["refresh"], check.DeepEquals, map[string]interface{}{
+		"schedule": "mon-fri@9:00-11:00",
+		"last":     "2017-08-07T10:00:00Z",
+	})
+}
+
 func (s *apiSuite) makeMyAppsServer(statusCode int, data string) *httptest.Server {
 	mockMyAppsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(statusCode)
@@ -1185,7 +1237,7 @@ func (s *apiSuite) TestFind(c *check.C) {
 	c.Check(rsp.SuggestedCurrency, check.Equals, "EUR")
 
 	c.Check(s.storeSearch, check.DeepEquals, store.Search{Query: "hi"})
-	c.Check(s.refreshCandidates, check.HasLen, 0)
+	c.Check(s.actions, check.HasLen, 0)
 }
 
 func (s *apiSuite) TestFindRefreshes(c *check.C) {
@@ -1208,7 +1260,8 @@ func (s *apiSuite) TestFindRefreshes(c *check.C) {
 	snaps := snapList(rsp.Result)
 	c.Assert(snaps, check.HasLen, 1)
 	c.Assert(snaps[0]["name"], check.Equals, "store")
-	c.Check(s.refreshCandidates, check.HasLen, 1)
+	c.Check(s.currentSnaps, check.HasLen, 1)
+	c.Check(s.actions, check.HasLen, 1)
 }
 
 func (s *apiSuite) TestFindRefreshSideloaded(c *check.C) {
@@ -1243,10 +1296,10 @@ func (s *apiSuite) TestFindRefreshSideloaded(c *check.C) {
 
 	rsp := searchStore(findCmd, req, nil).(*resp)
 
+	// nothing to refresh, the store is not even asked
 	snaps := snapList(rsp.Result)
-	c.Assert(snaps, check.HasLen, 1)
-	c.Assert(snaps[0]["name"], check.Equals, "store")
-	c.Check(s.refreshCandidates, check.HasLen, 0)
+	c.Assert(snaps, check.HasLen, 0)
+	c.Check(s.actions, check.IsNil)
 }
 
 func (s *apiSuite) TestFindPrivate(c *check.C) {
@@ -1955,205 +2008,628 @@ func (s *apiSuite) TestLocalInstallSnapDeriveSideInfo(c *check.C) {
 	})
 }
 
-func (s *apiSuite) TestSideloadSnapNoSignaturesDangerOff(c *check.C) {
-	body := "" +
+// mockDeltaUpload returns a multipart body uploading a delta
+// reconstructing a snap with content "x rev 42" and the digest and size
+// of that snap.
+func (s *apiSuite) mockDeltaUpload(c *check.C, dangerous bool) (body, digest string, size uint64) {
+	targetPath := filepath.Join(c.MkDir(), "x.snap")
+	c.Assert(ioutil.WriteFile(targetPath, []byte("x rev 42"), 0644), check.IsNil)
+	digest, size, err := asserts.SnapFileSHA3_384(targetPath)
+	c.Assert(err, check.IsNil)
+	hdr := &snapdelta.Header{
+		Format:         snapdelta.Format,
+		SourceSHA3_384: "source-digest",
+		TargetSHA3_384: digest,
+		TargetSize:     size,
+	}
+
+	body = "" +
 		"----hello--\r\n" +
-		"Content-Disposition: form-data; name=\"snap\"; filename=\"x\"\r\n" +
+		"Content-Disposition: form-data; name=\"snap\"; filename=\"x.delta\"\r\n" +
 		"\r\n" +
-		"xyzzy\r\n" +
+		hdr.String() + "delta\r\n" +
 		"----hello--\r\n"
+	if dangerous {
+		body += "" +
+			"Content-Disposition: form-data; name=\"dangerous\"\r\n" +
+			"\r\n" +
+			"true\r\n" +
+			"----hello--\r\n"
+	}
+	return body, digest, size
+}
+
+func (s *apiSuite) TestLocalInstallSnapDelta(c *check.C) {
 	d := s.daemon(c)
 	d.overlord.Loop()
 	defer d.overlord.Stop()
 
+	body, digest, size := s.mockDeltaUpload(c, false)
+
+	st := d.overlord.State()
+	assertAdd(st, s.storeSigning.StoreAccountKey(""))
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "devel1", nil, "")
+	assertAdd(st, dev1Acct)
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      "x-id",
+		"snap-name":    "x",
+		"publisher-id": dev1Acct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	assertAdd(st, snapDecl)
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-id":       "x-id",
+		"snap-revision": "42",
+		"developer-id":  dev1Acct.AccountID(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	assertAdd(st, snapRev)
+
 	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
 	c.Assert(err, check.IsNil)
 	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
 
-	// this is the prefix used for tempfiles for sideloading
-	glob := filepath.Join(os.TempDir(), "snapd-sideload-pkg-*")
-	glbBefore, _ := filepath.Glob(glob)
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		c.Fatalf("a delta cannot be read as a snap")
+		return nil, nil
+	}
+	snapstateDeltaSource = func(s *state.State, hdr *snapdelta.Header) (string, snap.Revision, error) {
+		c.Check(hdr.SourceSHA3_384, check.Equals, "source-digest")
+		return "x", snap.R(41), nil
+	}
+	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+		return nil, nil
+	}
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		c.Check(flags, check.Equals, snapstate.Flags{RemoveSnapPath: true})
+		c.Check(si, check.DeepEquals, &snap.SideInfo{
+			RealName: "x",
+			SnapID:   "x-id",
+			Revision: snap.R(42),
+		})
+
+		return state.NewTaskSet(), nil
+	}
+
 	rsp := postSnaps(snapsCmd, req, nil).(*resp)
-	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
-	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find signatures with metadata for snap "x"`)
-	glbAfter, _ := filepath.Glob(glob)
-	c.Check(len(glbBefore), check.Equals, len(glbAfter))
-}
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
 
-func (s *apiSuite) TestSideloadSnapNotValidFormFile(c *check.C) {
-	newTestDaemon(c)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Install "x" snap from file "x.delta"`)
+}
 
-	// try a multipart/form-data upload with missing "name"
-	content := "" +
-		"----hello--\r\n" +
-		"Content-Disposition: form-data; filename=\"x\"\r\n" +
-		"\r\n" +
-		"xyzzy\r\n" +
-		"----hello--\r\n"
-	head := map[string]string{"Content-Type": "multipart/thing; boundary=--hello--"}
+func (s *apiSuite) TestLocalInstallSnapDeltaDangerous(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
 
-	buf := bytes.NewBufferString(content)
-	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	body, _, _ := s.mockDeltaUpload(c, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
 	c.Assert(err, check.IsNil)
-	for k, v := range head {
-		req.Header.Set(k, v)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		c.Fatalf("a delta cannot be read as a snap")
+		return nil, nil
+	}
+	snapstateDeltaSource = func(s *state.State, hdr *snapdelta.Header) (string, snap.Revision, error) {
+		return "x", snap.R(41), nil
+	}
+	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+		return nil, nil
+	}
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		c.Check(si, check.DeepEquals, &snap.SideInfo{RealName: "x"})
+		return state.NewTaskSet(), nil
 	}
 
 	rsp := postSnaps(snapsCmd, req, nil).(*resp)
-	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
-	c.Assert(rsp.Result.(*errorResult).Message, check.Matches, `cannot find "snap" file field in provided multipart/form-data payload`)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
 }
 
-func (s *apiSuite) TestTrySnap(c *check.C) {
+func (s *apiSuite) TestLocalInstallSnapDeltaSourceNotInstalled(c *check.C) {
 	d := s.daemon(c)
 	d.overlord.Loop()
 	defer d.overlord.Stop()
 
-	req, err := http.NewRequest("POST", "/v2/snaps", nil)
+	body, _, _ := s.mockDeltaUpload(c, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
 	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
 
-	// mock a try dir
-	tryDir := c.MkDir()
-	snapYaml := filepath.Join(tryDir, "meta", "snap.yaml")
-	err = os.MkdirAll(filepath.Dir(snapYaml), 0755)
-	c.Assert(err, check.IsNil)
-	err = ioutil.WriteFile(snapYaml, []byte("name: foo\nversion: 1.0\n"), 0644)
-	c.Assert(err, check.IsNil)
+	snapstateDeltaSource = func(s *state.State, hdr *snapdelta.Header) (string, snap.Revision, error) {
+		return "", snap.R(0), fmt.Errorf("cannot find the installed snap the delta was created from")
+	}
 
-	for _, t := range []struct {
-		coreInfoErr error
-		nTasks      int
-		installSnap string
-		flags       snapstate.Flags
-		desc        string
-	}{
-		// core installed
-		{nil, 1, "", snapstate.Flags{}, "core; -"},
-		{nil, 1, "", snapstate.Flags{DevMode: true}, "core; devmode"},
-		{nil, 1, "", snapstate.Flags{JailMode: true}, "core; jailmode"},
-		{nil, 1, "", snapstate.Flags{Classic: true}, "core; classic"},
-		// no-core-installed
-		{state.ErrNoState, 2, "core", snapstate.Flags{}, "no core; -"},
-		{state.ErrNoState, 2, "core", snapstate.Flags{DevMode: true}, "no core; devmode"},
-		{state.ErrNoState, 2, "core", snapstate.Flags{JailMode: true}, "no core; jailmode"},
-		{state.ErrNoState, 2, "core", snapstate.Flags{Classic: true}, "no core; classic"},
-	} {
-		soon := 0
-		ensureStateSoon = func(st *state.State) {
-			soon++
-			ensureStateSoonImpl(st)
-		}
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "cannot install snap delta: cannot find the installed snap the delta was created from")
+}
 
-		tryWasCalled := true
-		snapstateTryPath = func(s *state.State, name, path string, flags snapstate.Flags) (*state.TaskSet, error) {
-			c.Check(flags, check.DeepEquals, t.flags, check.Commentf(t.desc))
-			tryWasCalled = true
-			t := s.NewTask("fake-install-snap", "Doing a fake try")
-			return state.NewTaskSet(t), nil
-		}
+// mockBundle writes a bundle of the given snaps, with all their
+// assertions, and returns a multipart body uploading it. A name of
+// the form <snap>_<suffix> adds another revision of <snap>.
+func (s *apiSuite) mockBundle(c *check.C, names []string, withAssertions bool) (body *bytes.Buffer, contentType string) {
+	dev1Acct := assertstest.NewAccount(s.storeSigning, "devel1", nil, "")
+	assertions := []asserts.Assertion{s.storeSigning.StoreAccountKey(""), dev1Acct}
+
+	dir := c.MkDir()
+	var snapPaths []string
+	declared := make(map[string]bool)
+	for i, name := range names {
+		snapName := strings.SplitN(name, "_", 2)[0]
+		snapPath := filepath.Join(dir, name+".snap")
+		c.Assert(ioutil.WriteFile(snapPath, []byte(name+" content"), 0644), check.IsNil)
+		snapPaths = append(snapPaths, snapPath)
+		digest, size, err := asserts.SnapFileSHA3_384(snapPath)
+		c.Assert(err, check.IsNil)
 
-		installSnap := ""
-		snapstateInstall = func(s *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
-			if name != "core" {
-				c.Check(flags, check.DeepEquals, t.flags, check.Commentf(t.desc))
+		snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+			"series":       "16",
+			"snap-id":      snapName + "-id",
+			"snap-name":    snapName,
+			"publisher-id": dev1Acct.AccountID(),
+			"timestamp":    time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, check.IsNil)
+		snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+			"snap-sha3-384": digest,
+			"snap-size":     fmt.Sprintf("%d", size),
+			"snap-id":       snapName + "-id",
+			"snap-revision": fmt.Sprintf("%d", i+1),
+			"developer-id":  dev1Acct.AccountID(),
+			"timestamp":     time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, check.IsNil)
+		if withAssertions {
+			if !declared[snapName] {
+				assertions = append(assertions, snapDecl)
+				declared[snapName] = true
 			}
-			installSnap = name
-			t := s.NewTask("fake-install-snap", "Doing a fake install")
-			return state.NewTaskSet(t), nil
-		}
-
-		snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
-			return nil, t.coreInfoErr
+			assertions = append(assertions, snapRev)
 		}
-
-		// try the snap (without an installed core)
-		rsp := trySnap(snapsCmd, req, nil, tryDir, t.flags).(*resp)
-		c.Assert(rsp.Type, check.Equals, ResponseTypeAsync, check.Commentf(t.desc))
-		c.Assert(tryWasCalled, check.Equals, true, check.Commentf(t.desc))
-
-		st := d.overlord.State()
-		st.Lock()
-		chg := st.Change(rsp.Change)
-		c.Assert(chg, check.NotNil, check.Commentf(t.desc))
-
-		c.Assert(chg.Tasks(), check.HasLen, t.nTasks, check.Commentf(t.desc))
-		c.Check(installSnap, check.Equals, t.installSnap, check.Commentf(t.desc))
-
-		st.Unlock()
-		<-chg.Ready()
-		st.Lock()
-
-		c.Check(chg.Kind(), check.Equals, "try-snap", check.Commentf(t.desc))
-		c.Check(chg.Summary(), check.Equals, fmt.Sprintf(`Try "%s" snap from %s`, "foo", tryDir), check.Commentf(t.desc))
-		var names []string
-		err = chg.Get("snap-names", &names)
-		c.Assert(err, check.IsNil, check.Commentf(t.desc))
-		c.Check(names, check.DeepEquals, []string{"foo"}, check.Commentf(t.desc))
-		var apiData map[string]interface{}
-		err = chg.Get("api-data", &apiData)
-		c.Assert(err, check.IsNil, check.Commentf(t.desc))
-		c.Check(apiData, check.DeepEquals, map[string]interface{}{
-			"snap-name": "foo",
-		}, check.Commentf(t.desc))
-
-		c.Check(soon, check.Equals, 1, check.Commentf(t.desc))
-		st.Unlock()
 	}
-}
-
-func (s *apiSuite) TestTrySnapRelative(c *check.C) {
-	req, err := http.NewRequest("POST", "/v2/snaps", nil)
-	c.Assert(err, check.IsNil)
-
-	rsp := trySnap(snapsCmd, req, nil, "relative-path", snapstate.Flags{}).(*resp)
-	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
-	c.Check(rsp.Result.(*errorResult).Message, testutil.Contains, "need an absolute path")
-}
 
-func (s *apiSuite) TestTrySnapNotDir(c *check.C) {
-	req, err := http.NewRequest("POST", "/v2/snaps", nil)
+	body = bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("bundle", "snaps.bundle")
 	c.Assert(err, check.IsNil)
+	c.Assert(snapbundle.Write(fw, snapPaths, assertions), check.IsNil)
+	c.Assert(mw.Close(), check.IsNil)
 
-	rsp := trySnap(snapsCmd, req, nil, "/does/not/exist", snapstate.Flags{}).(*resp)
-	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
-	c.Check(rsp.Result.(*errorResult).Message, testutil.Contains, "not a snap directory")
+	return body, mw.FormDataContentType()
 }
 
-func (s *apiSuite) sideloadCheck(c *check.C, content string, head map[string]string, expectedFlags snapstate.Flags, hasCoreSnap bool) string {
+func (s *apiSuite) TestSideloadBundle(c *check.C) {
 	d := s.daemon(c)
 	d.overlord.Loop()
 	defer d.overlord.Stop()
 
-	soon := 0
-	ensureStateSoon = func(st *state.State) {
-		soon++
-		ensureStateSoonImpl(st)
-	}
+	body, contentType := s.mockBundle(c, []string{"x", "y", "core"}, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
 
-	// setup done
-	installQueue := []string{}
 	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
-		return &snap.Info{SuggestedName: "local"}, nil
+		content, err := ioutil.ReadFile(path)
+		c.Assert(err, check.IsNil)
+		switch string(content) {
+		case "core content":
+			return &snap.Info{SuggestedName: "core", Type: snap.TypeOS}, nil
+		case "x content":
+			info := &snap.Info{SuggestedName: "x", Type: snap.TypeApp}
+			info.Plugs = map[string]*snap.PlugInfo{
+				"content": {
+					Snap:      info,
+					Name:      "content",
+					Interface: "content",
+					Attrs:     map[string]interface{}{"default-provider": "y:content"},
+				},
+			}
+			return info, nil
+		}
+		return &snap.Info{SuggestedName: "y", Type: snap.TypeApp}, nil
 	}
-
 	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
-		if hasCoreSnap {
-			return nil, nil
-		}
-		// pretend we do not have a state for ubuntu-core
 		return nil, state.ErrNoState
 	}
-	snapstateInstall = func(s *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
-		// NOTE: ubuntu-core is not installed in developer mode
-		c.Check(flags, check.Equals, snapstate.Flags{})
-		installQueue = append(installQueue, name)
+	var installed []string
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		c.Check(flags, check.Equals, snapstate.Flags{RemoveSnapPath: true})
+		c.Check(path, check.Matches, ".*/snapd-sideload-pkg-.*")
+		c.Check(si.SnapID, check.Equals, si.RealName+"-id")
+		installed = append(installed, si.RealName)
 
 		t := s.NewTask("fake-install-snap", "Doing a fake install")
 		return state.NewTaskSet(t), nil
 	}
 
-	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
-		c.Check(flags, check.DeepEquals, expectedFlags)
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	// the core snap and content providers come first
+	c.Check(installed, check.DeepEquals, []string{"core", "y", "x"})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Install snaps "core", "y", "x" from bundle "snaps.bundle"`)
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 3)
+	c.Check(tasks[1].WaitTasks(), check.DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[2].WaitTasks(), check.DeepEquals, []*state.Task{tasks[1]})
+	var names []string
+	err = chg.Get("snap-names", &names)
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"core", "y", "x"})
+
+	// the bundle assertions were added
+	_, err = assertstate.DB(st).Find(asserts.SnapDeclarationType, map[string]string{
+		"series":  "16",
+		"snap-id": "x-id",
+	})
+	c.Check(err, check.IsNil)
+}
+
+func (s *apiSuite) TestSideloadBundleBaseFirst(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	body, contentType := s.mockBundle(c, []string{"x", "some-base", "core"}, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		content, err := ioutil.ReadFile(path)
+		c.Assert(err, check.IsNil)
+		switch string(content) {
+		case "core content":
+			return &snap.Info{SuggestedName: "core", Type: snap.TypeOS}, nil
+		case "x content":
+			return &snap.Info{SuggestedName: "x", Type: snap.TypeApp, Base: "some-base"}, nil
+		}
+		return &snap.Info{SuggestedName: "some-base", Type: snap.TypeApp}, nil
+	}
+	var installed []string
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		installed = append(installed, si.RealName)
+		t := s.NewTask("fake-install-snap", "Doing a fake install")
+		return state.NewTaskSet(t), nil
+	}
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(installed, check.DeepEquals, []string{"core", "some-base", "x"})
+}
+
+func (s *apiSuite) TestSideloadBundleMissingPrerequisite(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	body, contentType := s.mockBundle(c, []string{"x"}, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		return &snap.Info{SuggestedName: "x", Type: snap.TypeApp}, nil
+	}
+	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+		return nil, state.ErrNoState
+	}
+
+	// this is the prefix used for tempfiles for sideloading
+	glob := filepath.Join(os.TempDir(), "snapd-sideload-*")
+	glbBefore, _ := filepath.Glob(glob)
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot install snap bundle: snap "x" needs snap "core" which is neither installed nor in the bundle`)
+	glbAfter, _ := filepath.Glob(glob)
+	c.Check(len(glbBefore), check.Equals, len(glbAfter))
+}
+
+func (s *apiSuite) TestSideloadBundleInstalledPrerequisites(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	st := d.overlord.State()
+	st.Lock()
+	snapstate.Set(st, "y", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "y", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+	})
+	st.Unlock()
+
+	body, contentType := s.mockBundle(c, []string{"x"}, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		info := &snap.Info{SuggestedName: "x", Type: snap.TypeApp}
+		info.Plugs = map[string]*snap.PlugInfo{
+			"content": {
+				Snap:      info,
+				Name:      "content",
+				Interface: "content",
+				Attrs:     map[string]interface{}{"default-provider": "y:content"},
+			},
+		}
+		return info, nil
+	}
+	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+		return &snap.Info{SuggestedName: "core", Type: snap.TypeOS}, nil
+	}
+	var installed []string
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		installed = append(installed, si.RealName)
+		t := s.NewTask("fake-install-snap", "Doing a fake install")
+		return state.NewTaskSet(t), nil
+	}
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(installed, check.DeepEquals, []string{"x"})
+}
+
+func (s *apiSuite) TestSideloadBundleDuplicateSnap(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	body, contentType := s.mockBundle(c, []string{"x", "x_2"}, true)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		return &snap.Info{SuggestedName: "x", Type: snap.TypeApp}, nil
+	}
+
+	// this is the prefix used for tempfiles for sideloading
+	glob := filepath.Join(os.TempDir(), "snapd-sideload-*")
+	glbBefore, _ := filepath.Glob(glob)
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot install snap "x" more than once from bundle`)
+	glbAfter, _ := filepath.Glob(glob)
+	c.Check(len(glbBefore), check.Equals, len(glbAfter))
+}
+
+func (s *apiSuite) TestSideloadBundleMissingAssertions(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	body, contentType := s.mockBundle(c, []string{"x"}, false)
+	req, err := http.NewRequest("POST", "/v2/snaps", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", contentType)
+
+	// this is the prefix used for tempfiles for sideloading
+	glob := filepath.Join(os.TempDir(), "snapd-sideload-*")
+	glbBefore, _ := filepath.Glob(glob)
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find signatures with metadata for snap "x.snap" in bundle`)
+	glbAfter, _ := filepath.Glob(glob)
+	c.Check(len(glbBefore), check.Equals, len(glbAfter))
+}
+
+func (s *apiSuite) TestSideloadSnapNoSignaturesDangerOff(c *check.C) {
+	body := "" +
+		"----hello--\r\n" +
+		"Content-Disposition: form-data; name=\"snap\"; filename=\"x\"\r\n" +
+		"\r\n" +
+		"xyzzy\r\n" +
+		"----hello--\r\n"
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
+
+	// this is the prefix used for tempfiles for sideloading
+	glob := filepath.Join(os.TempDir(), "snapd-sideload-pkg-*")
+	glbBefore, _ := filepath.Glob(glob)
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find signatures with metadata for snap "x"`)
+	glbAfter, _ := filepath.Glob(glob)
+	c.Check(len(glbBefore), check.Equals, len(glbAfter))
+}
+
+func (s *apiSuite) TestSideloadSnapNotValidFormFile(c *check.C) {
+	newTestDaemon(c)
+
+	// try a multipart/form-data upload with missing "name"
+	content := "" +
+		"----hello--\r\n" +
+		"Content-Disposition: form-data; filename=\"x\"\r\n" +
+		"\r\n" +
+		"xyzzy\r\n" +
+		"----hello--\r\n"
+	head := map[string]string{"Content-Type": "multipart/thing; boundary=--hello--"}
+
+	buf := bytes.NewBufferString(content)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	for k, v := range head {
+		req.Header.Set(k, v)
+	}
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Assert(rsp.Result.(*errorResult).Message, check.Matches, `cannot find "snap" file field in provided multipart/form-data payload`)
+}
+
+func (s *apiSuite) TestTrySnap(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	req, err := http.NewRequest("POST", "/v2/snaps", nil)
+	c.Assert(err, check.IsNil)
+
+	// mock a try dir
+	tryDir := c.MkDir()
+	snapYaml := filepath.Join(tryDir, "meta", "snap.yaml")
+	err = os.MkdirAll(filepath.Dir(snapYaml), 0755)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(snapYaml, []byte("name: foo\nversion: 1.0\n"), 0644)
+	c.Assert(err, check.IsNil)
+
+	for _, t := range []struct {
+		coreInfoErr error
+		nTasks      int
+		installSnap string
+		flags       snapstate.Flags
+		desc        string
+	}{
+		// core installed
+		{nil, 1, "", snapstate.Flags{}, "core; -"},
+		{nil, 1, "", snapstate.Flags{DevMode: true}, "core; devmode"},
+		{nil, 1, "", snapstate.Flags{JailMode: true}, "core; jailmode"},
+		{nil, 1, "", snapstate.Flags{Classic: true}, "core; classic"},
+		// no-core-installed
+		{state.ErrNoState, 2, "core", snapstate.Flags{}, "no core; -"},
+		{state.ErrNoState, 2, "core", snapstate.Flags{DevMode: true}, "no core; devmode"},
+		{state.ErrNoState, 2, "core", snapstate.Flags{JailMode: true}, "no core; jailmode"},
+		{state.ErrNoState, 2, "core", snapstate.Flags{Classic: true}, "no core; classic"},
+	} {
+		soon := 0
+		ensureStateSoon = func(st *state.State) {
+			soon++
+			ensureStateSoonImpl(st)
+		}
+
+		tryWasCalled := true
+		snapstateTryPath = func(s *state.State, name, path string, flags snapstate.Flags) (*state.TaskSet, error) {
+			c.Check(flags, check.DeepEquals, t.flags, check.Commentf(t.desc))
+			tryWasCalled = true
+			t := s.NewTask("fake-install-snap", "Doing a fake try")
+			return state.NewTaskSet(t), nil
+		}
+
+		installSnap := ""
+		snapstateInstall = func(s *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+			if name != "core" {
+				c.Check(flags, check.DeepEquals, t.flags, check.Commentf(t.desc))
+			}
+			installSnap = name
+			t := s.NewTask("fake-install-snap", "Doing a fake install")
+			return state.NewTaskSet(t), nil
+		}
+
+		snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+			return nil, t.coreInfoErr
+		}
+
+		// try the snap (without an installed core)
+		rsp := trySnap(snapsCmd, req, nil, tryDir, t.flags).(*resp)
+		c.Assert(rsp.Type, check.Equals, ResponseTypeAsync, check.Commentf(t.desc))
+		c.Assert(tryWasCalled, check.Equals, true, check.Commentf(t.desc))
+
+		st := d.overlord.State()
+		st.Lock()
+		chg := st.Change(rsp.Change)
+		c.Assert(chg, check.NotNil, check.Commentf(t.desc))
+
+		c.Assert(chg.Tasks(), check.HasLen, t.nTasks, check.Commentf(t.desc))
+		c.Check(installSnap, check.Equals, t.installSnap, check.Commentf(t.desc))
+
+		st.Unlock()
+		<-chg.Ready()
+		st.Lock()
+
+		c.Check(chg.Kind(), check.Equals, "try-snap", check.Commentf(t.desc))
+		c.Check(chg.Summary(), check.Equals, fmt.Sprintf(`Try "%s" snap from %s`, "foo", tryDir), check.Commentf(t.desc))
+		var names []string
+		err = chg.Get("snap-names", &names)
+		c.Assert(err, check.IsNil, check.Commentf(t.desc))
+		c.Check(names, check.DeepEquals, []string{"foo"}, check.Commentf(t.desc))
+		var apiData map[string]interface{}
+		err = chg.Get("api-data", &apiData)
+		c.Assert(err, check.IsNil, check.Commentf(t.desc))
+		c.Check(apiData, check.DeepEquals, map[string]interface{}{
+			"snap-name": "foo",
+		}, check.Commentf(t.desc))
+
+		c.Check(soon, check.Equals, 1, check.Commentf(t.desc))
+		st.Unlock()
+	}
+}
+
+func (s *apiSuite) TestTrySnapRelative(c *check.C) {
+	req, err := http.NewRequest("POST", "/v2/snaps", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := trySnap(snapsCmd, req, nil, "relative-path", snapstate.Flags{}).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, testutil.Contains, "need an absolute path")
+}
+
+func (s *apiSuite) TestTrySnapNotDir(c *check.C) {
+	req, err := http.NewRequest("POST", "/v2/snaps", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := trySnap(snapsCmd, req, nil, "/does/not/exist", snapstate.Flags{}).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, testutil.Contains, "not a snap directory")
+}
+
+func (s *apiSuite) sideloadCheck(c *check.C, content string, head map[string]string, expectedFlags snapstate.Flags, hasCoreSnap bool) string {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	soon := 0
+	ensureStateSoon = func(st *state.State) {
+		soon++
+		ensureStateSoonImpl(st)
+	}
+
+	// setup done
+	installQueue := []string{}
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		return &snap.Info{SuggestedName: "local"}, nil
+	}
+
+	snapstateCoreInfo = func(s *state.State) (*snap.Info, error) {
+		if hasCoreSnap {
+			return nil, nil
+		}
+		// pretend we do not have a state for ubuntu-core
+		return nil, state.ErrNoState
+	}
+	snapstateInstall = func(s *state.State, name, channel string, revision snap.Revision, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		// NOTE: ubuntu-core is not installed in developer mode
+		c.Check(flags, check.Equals, snapstate.Flags{})
+		installQueue = append(installQueue, name)
+
+		t := s.NewTask("fake-install-snap", "Doing a fake install")
+		return state.NewTaskSet(t), nil
+	}
+
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, channel string, flags snapstate.Flags) (*state.TaskSet, error) {
+		c.Check(flags, check.DeepEquals, expectedFlags)
 
 		bs, err := ioutil.ReadFile(path)
 		c.Check(err, check.IsNil)
@@ -2752,8 +3228,10 @@ func (s *apiSuite) TestRefreshMany1(c *check.C) {
 }
 
 func (s *apiSuite) TestInstallMany(c *check.C) {
-	snapstateInstallMany = func(s *state.State, names []string, userID int) ([]string, []*state.TaskSet, error) {
+	snapstateInstallMany = func(s *state.State, names []string, channel string, userID int, flags snapstate.Flags) ([]string, []*state.TaskSet, error) {
 		c.Check(names, check.HasLen, 2)
+		c.Check(channel, check.Equals, "")
+		c.Check(flags, check.Equals, snapstate.Flags{})
 		t := s.NewTask("fake-install-2", "Install two")
 		return names, []*state.TaskSet{state.NewTaskSet(t)}, nil
 	}
@@ -2770,7 +3248,7 @@ func (s *apiSuite) TestInstallMany(c *check.C) {
 }
 
 func (s *apiSuite) TestRemoveMany(c *check.C) {
-	snapstateRemoveMany = func(s *state.State, names []string) ([]string, []*state.TaskSet, error) {
+	snapstateRemoveMany = func(s *state.State, names []string, flags *snapstate.RemoveFlags) ([]string, []*state.TaskSet, error) {
 		c.Check(names, check.HasLen, 2)
 		t := s.NewTask("fake-remove-2", "Remove two")
 		return names, []*state.TaskSet{state.NewTaskSet(t)}, nil
@@ -3116,53 +3594,198 @@ func (s *apiSuite) TestInterfaces(c *check.C) {
 	s.mockSnap(c, consumerYaml)
 	s.mockSnap(c, producerYaml)
 
-	repo := d.overlord.InterfaceManager().Repository()
-	connRef := interfaces.ConnRef{
-		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
-		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
-	}
-	c.Assert(repo.Connect(connRef), check.IsNil)
+	repo := d.overlord.InterfaceManager().Repository()
+	connRef := interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	c.Assert(repo.Connect(connRef), check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/interfaces", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	interfacesCmd.GET(interfacesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]interface{}{
+		"result": map[string]interface{}{
+			"plugs": []interface{}{
+				map[string]interface{}{
+					"snap":      "consumer",
+					"plug":      "plug",
+					"interface": "test",
+					"attrs":     map[string]interface{}{"key": "value"},
+					"apps":      []interface{}{"app"},
+					"label":     "label",
+					"connections": []interface{}{
+						map[string]interface{}{"snap": "producer", "slot": "slot"},
+					},
+				},
+			},
+			"slots": []interface{}{
+				map[string]interface{}{
+					"snap":      "producer",
+					"slot":      "slot",
+					"interface": "test",
+					"attrs":     map[string]interface{}{"key": "value"},
+					"apps":      []interface{}{"app"},
+					"label":     "label",
+					"connections": []interface{}{
+						map[string]interface{}{"snap": "consumer", "plug": "plug"},
+					},
+				},
+			},
+		},
+		"status":      "OK",
+		"status-code": 200.0,
+		"type":        "sync",
+	})
+}
+
+func (s *apiSuite) TestInterfacesConnectionStates(c *check.C) {
+	d := s.daemon(c)
+
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "undesired": true,
+		},
+	})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/interfaces", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	interfacesCmd.GET(interfacesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	result := body["result"].(map[string]interface{})
+	c.Check(result["connection-states"], check.DeepEquals, []interface{}{
+		map[string]interface{}{
+			"plug":      map[string]interface{}{"snap": "consumer", "plug": "plug"},
+			"slot":      map[string]interface{}{"snap": "producer", "slot": "slot"},
+			"interface": "test",
+			"auto":      true,
+			"undesired": true,
+		},
+	})
+}
+
+func (s *apiSuite) getConnections(c *check.C, query string) (int, map[string]interface{}) {
+	req, err := http.NewRequest("GET", "/v2/connections"+query, nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	connectionsCmd.GET(connectionsCmd, req, nil).ServeHTTP(rec, req)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Assert(err, check.IsNil)
+	return rec.Code, body
+}
+
+func (s *apiSuite) TestConnections(c *check.C) {
+	d := s.daemon(c)
+
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	repo := d.overlord.InterfaceManager().Repository()
+	connRef := interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	c.Assert(repo.ConnectWithAttrs(connRef, nil, map[string]interface{}{"path": "/run/socket"}), check.IsNil)
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test", "auto": true},
+	})
+	st.Unlock()
+
+	established := []interface{}{
+		map[string]interface{}{
+			"plug":       map[string]interface{}{"snap": "consumer", "plug": "plug"},
+			"plug-attrs": map[string]interface{}{"key": "value"},
+			"slot":       map[string]interface{}{"snap": "producer", "slot": "slot"},
+			"slot-attrs": map[string]interface{}{"key": "value", "path": "/run/socket"},
+			"interface":  "test",
+			"origin":     "auto",
+		},
+	}
+	for _, query := range []string{"", "?snap=consumer", "?snap=producer", "?interface=test", "?select=connected"} {
+		code, body := s.getConnections(c, query)
+		c.Check(code, check.Equals, 200, check.Commentf(query))
+		c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+			"established": established,
+		}, check.Commentf(query))
+	}
+
+	for _, query := range []string{"?snap=other", "?interface=other"} {
+		code, body := s.getConnections(c, query)
+		c.Check(code, check.Equals, 200, check.Commentf(query))
+		c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+			"established": []interface{}{},
+		}, check.Commentf(query))
+	}
+}
+
+func (s *apiSuite) TestConnectionsAll(c *check.C) {
+	d := s.daemon(c)
+
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "undesired": true,
+		},
+	})
+	st.Unlock()
 
-	req, err := http.NewRequest("GET", "/v2/interfaces", nil)
-	c.Assert(err, check.IsNil)
-	rec := httptest.NewRecorder()
-	interfacesCmd.GET(interfacesCmd, req, nil).ServeHTTP(rec, req)
-	c.Check(rec.Code, check.Equals, 200)
-	var body map[string]interface{}
-	err = json.Unmarshal(rec.Body.Bytes(), &body)
-	c.Check(err, check.IsNil)
-	c.Check(body, check.DeepEquals, map[string]interface{}{
-		"result": map[string]interface{}{
-			"plugs": []interface{}{
-				map[string]interface{}{
-					"snap":      "consumer",
-					"plug":      "plug",
-					"interface": "test",
-					"attrs":     map[string]interface{}{"key": "value"},
-					"apps":      []interface{}{"app"},
-					"label":     "label",
-					"connections": []interface{}{
-						map[string]interface{}{"snap": "producer", "slot": "slot"},
-					},
-				},
+	code, body := s.getConnections(c, "?select=all&snap=consumer")
+	c.Check(code, check.Equals, 200)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"established": []interface{}{},
+		"undesired": []interface{}{
+			map[string]interface{}{
+				"plug":      map[string]interface{}{"snap": "consumer", "plug": "plug"},
+				"slot":      map[string]interface{}{"snap": "producer", "slot": "slot"},
+				"interface": "test",
+				"origin":    "auto",
 			},
-			"slots": []interface{}{
-				map[string]interface{}{
-					"snap":      "producer",
-					"slot":      "slot",
-					"interface": "test",
-					"attrs":     map[string]interface{}{"key": "value"},
-					"apps":      []interface{}{"app"},
-					"label":     "label",
-					"connections": []interface{}{
-						map[string]interface{}{"snap": "consumer", "plug": "plug"},
-					},
-				},
+		},
+		"plugs": []interface{}{
+			map[string]interface{}{
+				"snap":      "consumer",
+				"plug":      "plug",
+				"interface": "test",
+				"attrs":     map[string]interface{}{"key": "value"},
+				"apps":      []interface{}{"app"},
+				"label":     "label",
 			},
 		},
-		"status":      "OK",
-		"status-code": 200.0,
-		"type":        "sync",
+	})
+}
+
+func (s *apiSuite) TestConnectionsBadSelect(c *check.C) {
+	s.daemon(c)
+
+	code, body := s.getConnections(c, "?select=foo")
+	c.Check(code, check.Equals, 400)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"message": `invalid select parameter: "foo"`,
 	})
 }
 
@@ -3398,6 +4021,69 @@ func (s *apiSuite) TestDisconnectPlugSuccess(c *check.C) {
 	c.Assert(slot.Connections, check.HasLen, 0)
 }
 
+func (s *apiSuite) TestDisconnectForget(c *check.C) {
+	d := s.daemon(c)
+
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	action := &interfaceAction{
+		Action: "disconnect",
+		Forget: true,
+		Plugs:  []plugJSON{{Snap: "consumer", Name: "plug"}},
+		Slots:  []slotJSON{{Snap: "producer", Name: "slot"}},
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	buf := bytes.NewBuffer(text)
+	req, err := http.NewRequest("POST", "/v2/interfaces", buf)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	interfacesCmd.POST(interfacesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 202)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	id := body["change"].(string)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(id)
+	c.Assert(chg, check.NotNil)
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	c.Check(tasks[0].Kind(), check.Equals, "disconnect")
+	var forget bool
+	c.Check(tasks[0].Get("forget", &forget), check.IsNil)
+	c.Check(forget, check.Equals, true)
+}
+
+func (s *apiSuite) TestConnectForgetIsBadRequest(c *check.C) {
+	s.daemon(c)
+
+	action := &interfaceAction{
+		Action: "connect",
+		Forget: true,
+		Plugs:  []plugJSON{{Snap: "consumer", Name: "plug"}},
+		Slots:  []slotJSON{{Snap: "producer", Name: "slot"}},
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	buf := bytes.NewBuffer(text)
+	req, err := http.NewRequest("POST", "/v2/interfaces", buf)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	interfacesCmd.POST(interfacesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 400)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"message": "forget is only supported when disconnecting",
+	})
+}
+
 func (s *apiSuite) TestDisconnectPlugFailureNoSuchPlug(c *check.C) {
 	d := s.daemon(c)
 
@@ -4021,6 +4707,34 @@ func (s *apiSuite) TestStateChange(c *check.C) {
 	})
 }
 
+func (s *apiSuite) TestStateChangeThrottled(c *check.C) {
+	st := state.New(nil)
+
+	runner := state.NewTaskRunner(st)
+	runner.AddHandler("download", func(t *state.Task, tb *tomb.Tomb) error {
+		<-tb.Dying()
+		return &state.Retry{}
+	}, nil)
+	runner.SetConcurrencyLimit("download", 1)
+	defer runner.Stop()
+
+	st.Lock()
+	chg := st.NewChange("install", "install...")
+	chg.AddTask(st.NewTask("download", "1..."))
+	chg.AddTask(st.NewTask("download", "2..."))
+	st.Unlock()
+
+	runner.Ensure()
+
+	st.Lock()
+	info := change2changeInfo(chg)
+	st.Unlock()
+
+	c.Assert(info.Tasks, check.HasLen, 2)
+	c.Check(info.Tasks[0].Status, check.Equals, "Doing")
+	c.Check(info.Tasks[1].Status, check.Equals, "Throttled")
+}
+
 func (s *apiSuite) TestStateChangeAbort(c *check.C) {
 	restore := state.MockTime(time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC))
 	defer restore()
@@ -4776,62 +5490,203 @@ func (s *postCreateUserSuite) TestPostCreateUserFromAssertionAllKnownButOwned(c
 	expected := []userResponseData{
 		{Username: "guy"},
 	}
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Result, check.FitsTypeOf, expected)
-	c.Check(rsp.Result, check.DeepEquals, expected)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.FitsTypeOf, expected)
+	c.Check(rsp.Result, check.DeepEquals, expected)
+}
+
+func (s *postCreateUserSuite) TestUsersEmpty(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/users", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getUsers(usersCmd, req, nil).(*resp)
+
+	expected := []userResponseData{}
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.FitsTypeOf, expected)
+	c.Check(rsp.Result, check.DeepEquals, expected)
+}
+
+func (s *postCreateUserSuite) TestUsersHasUser(c *check.C) {
+	st := s.d.overlord.State()
+	st.Lock()
+	u, err := auth.NewUser(st, "someuser", "mymail@test.com", "macaroon", []string{"discharge"})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/users", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getUsers(usersCmd, req, nil).(*resp)
+
+	expected := []userResponseData{
+		{ID: u.ID, Username: u.Username, Email: u.Email},
+	}
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.FitsTypeOf, expected)
+	c.Check(rsp.Result, check.DeepEquals, expected)
+}
+
+func (s *postCreateUserSuite) TestSysinfoIsManaged(c *check.C) {
+	st := s.d.overlord.State()
+	st.Lock()
+	_, err := auth.NewUser(st, "someuser", "mymail@test.com", "macaroon", []string{"discharge"})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/system-info", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := sysInfo(sysInfoCmd, req, nil).(*resp)
+
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result.(map[string]interface{})["managed"], check.Equals, true)
+}
+
+// aliases
+
+func (s *apiSuite) TestAliasSuccess(c *check.C) {
+	err := os.MkdirAll(dirs.SnapBinariesDir, 0755)
+	c.Assert(err, check.IsNil)
+	d := s.daemon(c)
+
+	s.mockSnap(c, aliasYaml)
+
+	oldAutoAliases := snapstate.AutoAliases
+	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
+		return nil, nil
+	}
+	defer func() { snapstate.AutoAliases = oldAutoAliases }()
+
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	action := &aliasAction{
+		Action:  "alias",
+		Snap:    "alias-snap",
+		Aliases: []string{"alias1"},
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	buf := bytes.NewBuffer(text)
+	req, err := http.NewRequest("POST", "/v2/aliases", buf)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	aliasesCmd.POST(aliasesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 202)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	id := body["change"].(string)
+
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.Change(id)
+	st.Unlock()
+	c.Assert(chg, check.NotNil)
+
+	<-chg.Ready()
+
+	st.Lock()
+	err = chg.Err()
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	// sanity check
+	c.Check(osutil.IsSymlink(filepath.Join(dirs.SnapBinariesDir, "alias1")), check.Equals, true)
+}
+
+func (s *apiSuite) TestAliasErrors(c *check.C) {
+	s.daemon(c)
+
+	errScenarios := []struct {
+		mangle func(*aliasAction)
+		err    string
+	}{
+		{func(a *aliasAction) { a.Action = "" }, `unsupported alias action: ""`},
+		{func(a *aliasAction) { a.Action = "what" }, `unsupported alias action: "what"`},
+		{func(a *aliasAction) { a.Aliases = nil }, `at least one alias name is required`},
+		{func(a *aliasAction) { a.Snap = "lalala" }, `cannot find snap "lalala"`},
+	}
+
+	for _, scen := range errScenarios {
+		action := &aliasAction{
+			Action:  "alias",
+			Snap:    "alias-snap",
+			Aliases: []string{"alias1"},
+		}
+		scen.mangle(action)
+
+		text, err := json.Marshal(action)
+		c.Assert(err, check.IsNil)
+		buf := bytes.NewBuffer(text)
+		req, err := http.NewRequest("POST", "/v2/aliases", buf)
+		c.Assert(err, check.IsNil)
+
+		rsp := changeAliases(aliasesCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, scen.err)
+	}
 }
 
-func (s *postCreateUserSuite) TestUsersEmpty(c *check.C) {
-	req, err := http.NewRequest("GET", "/v2/users", nil)
+func (s *apiSuite) TestUnaliasSuccess(c *check.C) {
+	err := os.MkdirAll(dirs.SnapBinariesDir, 0755)
 	c.Assert(err, check.IsNil)
+	d := s.daemon(c)
 
-	rsp := getUsers(usersCmd, req, nil).(*resp)
+	s.mockSnap(c, aliasYaml)
 
-	expected := []userResponseData{}
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Result, check.FitsTypeOf, expected)
-	c.Check(rsp.Result, check.DeepEquals, expected)
-}
+	oldAutoAliases := snapstate.AutoAliases
+	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
+		return nil, nil
+	}
+	defer func() { snapstate.AutoAliases = oldAutoAliases }()
 
-func (s *postCreateUserSuite) TestUsersHasUser(c *check.C) {
-	st := s.d.overlord.State()
-	st.Lock()
-	u, err := auth.NewUser(st, "someuser", "mymail@test.com", "macaroon", []string{"discharge"})
-	st.Unlock()
-	c.Assert(err, check.IsNil)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
 
-	req, err := http.NewRequest("GET", "/v2/users", nil)
+	action := &aliasAction{
+		Action:  "unalias",
+		Snap:    "alias-snap",
+		Aliases: []string{"alias1"},
+	}
+	text, err := json.Marshal(action)
+	c.Assert(err, check.IsNil)
+	buf := bytes.NewBuffer(text)
+	req, err := http.NewRequest("POST", "/v2/aliases", buf)
 	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	aliasesCmd.POST(aliasesCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 202)
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	id := body["change"].(string)
 
-	rsp := getUsers(usersCmd, req, nil).(*resp)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.Change(id)
+	st.Unlock()
+	c.Assert(chg, check.NotNil)
 
-	expected := []userResponseData{
-		{ID: u.ID, Username: u.Username, Email: u.Email},
-	}
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Result, check.FitsTypeOf, expected)
-	c.Check(rsp.Result, check.DeepEquals, expected)
-}
+	<-chg.Ready()
 
-func (s *postCreateUserSuite) TestSysinfoIsManaged(c *check.C) {
-	st := s.d.overlord.State()
 	st.Lock()
-	_, err := auth.NewUser(st, "someuser", "mymail@test.com", "macaroon", []string{"discharge"})
-	st.Unlock()
+	defer st.Unlock()
+	err = chg.Err()
 	c.Assert(err, check.IsNil)
 
-	req, err := http.NewRequest("GET", "/v2/system-info", nil)
+	var allAliases map[string]map[string]string
+	err = st.Get("aliases", &allAliases)
 	c.Assert(err, check.IsNil)
+	c.Check(allAliases, check.DeepEquals, map[string]map[string]string{
+		"alias-snap": {"alias1": "disabled"},
+	})
 
-	rsp := sysInfo(sysInfoCmd, req, nil).(*resp)
-
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Result.(map[string]interface{})["managed"], check.Equals, true)
 }
 
-// aliases
-
-func (s *apiSuite) TestAliasSuccess(c *check.C) {
+func (s *apiSuite) TestResetAliasSuccess(c *check.C) {
 	err := os.MkdirAll(dirs.SnapBinariesDir, 0755)
 	c.Assert(err, check.IsNil)
 	d := s.daemon(c)
@@ -4847,8 +5702,18 @@ func (s *apiSuite) TestAliasSuccess(c *check.C) {
 	d.overlord.Loop()
 	defer d.overlord.Stop()
 
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	st.Set("aliases", map[string]map[string]string{
+		"alias-snap": {
+			"alias1": "disabled",
+		},
+	})
+
 	action := &aliasAction{
-		Action:  "alias",
+		Action:  "reset",
 		Snap:    "alias-snap",
 		Aliases: []string{"alias1"},
 	}
@@ -4858,237 +5723,711 @@ func (s *apiSuite) TestAliasSuccess(c *check.C) {
 	req, err := http.NewRequest("POST", "/v2/aliases", buf)
 	c.Assert(err, check.IsNil)
 	rec := httptest.NewRecorder()
+	st.Unlock()
 	aliasesCmd.POST(aliasesCmd, req, nil).ServeHTTP(rec, req)
+	st.Lock()
 	c.Check(rec.Code, check.Equals, 202)
 	var body map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &body)
 	c.Check(err, check.IsNil)
 	id := body["change"].(string)
 
-	st := d.overlord.State()
-	st.Lock()
 	chg := st.Change(id)
-	st.Unlock()
 	c.Assert(chg, check.NotNil)
 
+	st.Unlock()
 	<-chg.Ready()
-
 	st.Lock()
+
 	err = chg.Err()
+	c.Assert(err, check.IsNil)
+
+	var allAliases map[string]map[string]string
+	err = st.Get("aliases", &allAliases)
+	c.Assert(err, check.IsNil)
+	c.Check(allAliases, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestAliases(c *check.C) {
+	d := s.daemon(c)
+
+	s.mockSnap(c, aliasYaml)
+
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("aliases", map[string]map[string]string{
+		"alias-snap": {
+			"alias1": "enabled",
+			"alias3": "disabled", // gone from the current revision of the snap
+		},
+	})
 	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/aliases", nil)
 	c.Assert(err, check.IsNil)
 
-	// sanity check
-	c.Check(osutil.IsSymlink(filepath.Join(dirs.SnapBinariesDir, "alias1")), check.Equals, true)
+	rsp := getAliases(aliasesCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, map[string]map[string]aliasStatus{
+		"alias-snap": {
+			"alias1": {App: "alias-snap.app", Status: "enabled"},
+			"alias2": {App: "alias-snap.app2"},
+			"alias3": {Status: "disabled"},
+		},
+	})
+
 }
 
-func (s *apiSuite) TestAliasErrors(c *check.C) {
-	s.daemon(c)
+var _ = check.Suite(&postDebugSuite{})
 
-	errScenarios := []struct {
-		mangle func(*aliasAction)
-		err    string
-	}{
-		{func(a *aliasAction) { a.Action = "" }, `unsupported alias action: ""`},
-		{func(a *aliasAction) { a.Action = "what" }, `unsupported alias action: "what"`},
-		{func(a *aliasAction) { a.Aliases = nil }, `at least one alias name is required`},
-		{func(a *aliasAction) { a.Snap = "lalala" }, `cannot find snap "lalala"`},
+type postDebugSuite struct {
+	apiBaseSuite
+}
+
+func (s *postDebugSuite) TestPostDebugEnsureStateSoon(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	soon := 0
+	ensureStateSoon = func(st *state.State) {
+		soon++
+		ensureStateSoonImpl(st)
+	}
+
+	buf := bytes.NewBufferString(`{"action": "ensure-state-soon"}`)
+	req, err := http.NewRequest("POST", "/v2/debug", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postDebug(debugCmd, req, nil).(*resp)
+
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.Equals, true)
+	c.Check(soon, check.Equals, 1)
+}
+
+var _ = check.Suite(&appSuite{})
+
+type appSuite struct {
+	apiBaseSuite
+	sysd [][]string
+	jctl [][]string
+
+	restoreSystemctl func()
+	restoreJctl      func()
+}
+
+func (s *appSuite) SetUpTest(c *check.C) {
+	s.apiBaseSuite.SetUpTest(c)
+
+	s.sysd = nil
+	oldSystemctlCmd := systemd.SystemctlCmd
+	systemd.SystemctlCmd = func(args ...string) ([]byte, error) {
+		s.sysd = append(s.sysd, args)
+		if args[0] == "show" {
+			return []byte("Id=" + args[2] + "\nActiveState=active\nUnitFileState=enabled\n"), nil
+		}
+		return []byte("ActiveState=inactive\n"), nil
+	}
+	s.restoreSystemctl = func() { systemd.SystemctlCmd = oldSystemctlCmd }
+
+	s.jctl = nil
+	oldJctlStreamCmd := systemd.JournalctlStreamCmd
+	systemd.JournalctlStreamCmd = func(svcs []string, n string, follow bool) (io.ReadCloser, error) {
+		s.jctl = append(s.jctl, append([]string{n, strconv.FormatBool(follow)}, svcs...))
+		return ioutil.NopCloser(strings.NewReader(`{"MESSAGE": "hello", "SYSLOG_IDENTIFIER": "xyzzy", "_PID": "42", "__REALTIME_TIMESTAMP": "42000000"}`)), nil
+	}
+	s.restoreJctl = func() { systemd.JournalctlStreamCmd = oldJctlStreamCmd }
+
+	d := s.daemon(c)
+	s.mkInstalledInState(c, d, "snap-a", "dev", "v1", snap.R(1), true, "apps: {svc1: {daemon: simple}, svc2: {daemon: simple}, app1: {}}")
+	s.mkInstalledInState(c, d, "snap-b", "dev", "v1", snap.R(1), true, "apps: {svc3: {daemon: simple}, app2: {}}")
+}
+
+func (s *appSuite) TearDownTest(c *check.C) {
+	s.restoreSystemctl()
+	s.restoreJctl()
+	s.apiBaseSuite.TearDownTest(c)
+}
+
+func (s *appSuite) TestSplitQS(c *check.C) {
+	c.Check(splitQS("foo,bar"), check.DeepEquals, []string{"foo", "bar"})
+	c.Check(splitQS("foo , bar"), check.DeepEquals, []string{"foo", "bar"})
+	c.Check(splitQS("foo ,, bar"), check.DeepEquals, []string{"foo", "bar"})
+	c.Check(splitQS(""), check.HasLen, 0)
+}
+
+func (s *appSuite) TestGetAppsInfo(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/apps", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Assert(rsp.Result, check.FitsTypeOf, []*client.AppInfo{})
+	apps := rsp.Result.([]*client.AppInfo)
+	c.Assert(apps, check.HasLen, 5)
+
+	var names []string
+	for _, app := range apps {
+		names = append(names, app.Snap+"."+app.Name)
+		if app.IsService() {
+			c.Check(app.Enabled, check.Equals, true)
+			c.Check(app.Active, check.Equals, true)
+		} else {
+			c.Check(app.Enabled, check.Equals, false)
+			c.Check(app.Active, check.Equals, false)
+		}
+	}
+	c.Check(names, check.DeepEquals, []string{"snap-a.app1", "snap-a.svc1", "snap-a.svc2", "snap-b.app2", "snap-b.svc3"})
+	c.Check(s.sysd, check.HasLen, 3)
+}
+
+func (s *appSuite) TestGetAppsInfoNames(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/apps?names=snap-a.svc1,snap-b", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	apps := rsp.Result.([]*client.AppInfo)
+	c.Assert(apps, check.HasLen, 3)
+	c.Check(apps[0].Snap+"."+apps[0].Name, check.Equals, "snap-a.svc1")
+	c.Check(apps[1].Snap+"."+apps[1].Name, check.Equals, "snap-b.app2")
+	c.Check(apps[2].Snap+"."+apps[2].Name, check.Equals, "snap-b.svc3")
+}
+
+func (s *appSuite) TestGetAppsInfoServices(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/apps?select=service", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	apps := rsp.Result.([]*client.AppInfo)
+	c.Assert(apps, check.HasLen, 3)
+	for _, app := range apps {
+		c.Check(app.IsService(), check.Equals, true)
+	}
+}
+
+func (s *appSuite) TestGetAppsInfoBadSelect(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/apps?select=potato", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `invalid select parameter: "potato"`)
+}
+
+func (s *appSuite) TestGetAppsInfoNotFound(c *check.C) {
+	for name, msg := range map[string]string{
+		"snap-x":      `snap "snap-x" not found`,
+		"snap-a.foo":  `snap "snap-a" has no app "foo"`,
+		"snap-x.foo":  `snap "snap-x" not found`,
+		"snap-a.app1": "",
+	} {
+		req, err := http.NewRequest("GET", "/v2/apps?names="+name, nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+		if msg == "" {
+			c.Check(rsp.Status, check.Equals, http.StatusOK, check.Commentf(name))
+			continue
+		}
+		c.Check(rsp.Status, check.Equals, http.StatusNotFound, check.Commentf(name))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, msg, check.Commentf(name))
+	}
+}
+
+func (s *appSuite) TestGetAppsInfoServiceNotFound(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/apps?select=service&names=snap-a.app1", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusNotFound)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `snap "snap-a" has no service "app1"`)
+}
+
+func (s *appSuite) testPostApps(c *check.C, inst servicestate.Instruction, expected []string) *state.Change {
+	postBody, err := json.Marshal(inst)
+	c.Assert(err, check.IsNil)
+
+	soon := 0
+	ensureStateSoon = func(st *state.State) {
+		soon++
 	}
 
-	for _, scen := range errScenarios {
-		action := &aliasAction{
-			Action:  "alias",
-			Snap:    "alias-snap",
-			Aliases: []string{"alias1"},
-		}
-		scen.mangle(action)
+	req, err := http.NewRequest("POST", "/v2/apps", bytes.NewBuffer(postBody))
+	c.Assert(err, check.IsNil)
+
+	rsp := postApps(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusAccepted, check.Commentf("%v", rsp.Result))
+	c.Check(soon, check.Equals, 1)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(rsp.Change, check.Matches, `[0-9]+`)
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "service-control")
+	var snapNames []string
+	c.Assert(chg.Get("snap-names", &snapNames), check.IsNil)
+	c.Check(snapNames, check.DeepEquals, expected)
+
+	return chg
+}
+
+func (s *appSuite) TestPostAppsStartOne(c *check.C) {
+	inst := servicestate.Instruction{Action: "start", Names: []string{"snap-a.svc2"}}
+	chg := s.testPostApps(c, inst, []string{"snap-a"})
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(chg.Tasks(), check.HasLen, 1)
+	var action servicestate.ServiceAction
+	c.Assert(chg.Tasks()[0].Get("service-action", &action), check.IsNil)
+	c.Check(action, check.DeepEquals, servicestate.ServiceAction{
+		SnapName: "snap-a",
+		Action:   "start",
+		Services: []string{"svc2"},
+	})
+}
+
+func (s *appSuite) TestPostAppsRestartAll(c *check.C) {
+	inst := servicestate.Instruction{Action: "restart", Names: []string{"snap-a", "snap-b"}}
+	chg := s.testPostApps(c, inst, []string{"snap-a", "snap-b"})
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(chg.Tasks(), check.HasLen, 2)
+}
 
-		text, err := json.Marshal(action)
-		c.Assert(err, check.IsNil)
-		buf := bytes.NewBuffer(text)
-		req, err := http.NewRequest("POST", "/v2/aliases", buf)
+func (s *appSuite) TestPostAppsErrors(c *check.C) {
+	for body, msg := range map[string]string{
+		`{"action": "start"}`:                                     "cannot perform operation on services without a list of services to operate on",
+		`{"action": "potato", "names": ["snap-a"]}`:               `cannot potato services: unknown action "potato"`,
+		`{"action": "stop", "names": ["snap-a.app1"]}`:            `snap "snap-a" has no service "app1"`,
+		`{"action": "stop", "names": ["snap-x"]}`:                 `snap "snap-x" not found`,
+		`{"action": "stop", "enable": true, "names": ["snap-a"]}`: `cannot stop services: cannot use enable with action "stop"`,
+		`potato`: "cannot decode request body into service operation: invalid character 'p' looking for beginning of value",
+	} {
+		req, err := http.NewRequest("POST", "/v2/apps", strings.NewReader(body))
 		c.Assert(err, check.IsNil)
 
-		rsp := changeAliases(aliasesCmd, req, nil).(*resp)
-		c.Check(rsp.Type, check.Equals, ResponseTypeError)
-		c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
-		c.Check(rsp.Result.(*errorResult).Message, check.Matches, scen.err)
+		rsp := postApps(appsCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError, check.Commentf(body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, msg, check.Commentf(body))
 	}
 }
 
-func (s *apiSuite) TestUnaliasSuccess(c *check.C) {
-	err := os.MkdirAll(dirs.SnapBinariesDir, 0755)
+func (s *appSuite) TestLogs(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/logs?names=snap-a.svc2&n=42&follow=false", nil)
 	c.Assert(err, check.IsNil)
-	d := s.daemon(c)
 
-	s.mockSnap(c, aliasYaml)
+	rec := httptest.NewRecorder()
+	getLogs(logsCmd, req, nil).ServeHTTP(rec, req)
 
-	oldAutoAliases := snapstate.AutoAliases
-	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
-		return nil, nil
+	c.Check(s.jctl, check.DeepEquals, [][]string{{"42", "false", "snap.snap-a.svc2.service"}})
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, "application/json-seq")
+	c.Check(rec.Body.String(), check.Equals, "\x1E"+`{"timestamp":"1970-01-01T00:00:42Z","message":"hello","sid":"xyzzy","pid":"42"}`+"\n")
+}
+
+func (s *appSuite) TestLogsN(c *check.C) {
+	for in, out := range map[string]string{
+		"":   "10",
+		"-1": "all",
+		"0":  "0",
+		"5":  "5",
+	} {
+		s.jctl = nil
+
+		req, err := http.NewRequest("GET", "/v2/logs?n="+in, nil)
+		c.Assert(err, check.IsNil)
+
+		rec := httptest.NewRecorder()
+		getLogs(logsCmd, req, nil).ServeHTTP(rec, req)
+
+		c.Check(rec.Code, check.Equals, 200, check.Commentf(in))
+		c.Check(s.jctl, check.DeepEquals, [][]string{{out, "false", "snap.snap-a.svc1.service", "snap.snap-a.svc2.service", "snap.snap-b.svc3.service"}}, check.Commentf(in))
 	}
-	defer func() { snapstate.AutoAliases = oldAutoAliases }()
+}
 
-	d.overlord.Loop()
-	defer d.overlord.Stop()
+func (s *appSuite) TestLogsBadRequest(c *check.C) {
+	for query, msg := range map[string]string{
+		"n=hello":      `invalid value for n: "hello": strconv.ParseInt: parsing "hello": invalid syntax`,
+		"follow=hello": `invalid value for follow: "hello": strconv.ParseBool: parsing "hello": invalid syntax`,
+	} {
+		req, err := http.NewRequest("GET", "/v2/logs?"+query, nil)
+		c.Assert(err, check.IsNil)
 
-	action := &aliasAction{
-		Action:  "unalias",
-		Snap:    "alias-snap",
-		Aliases: []string{"alias1"},
+		rsp := getLogs(logsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest, check.Commentf(query))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, msg, check.Commentf(query))
 	}
-	text, err := json.Marshal(action)
-	c.Assert(err, check.IsNil)
-	buf := bytes.NewBuffer(text)
-	req, err := http.NewRequest("POST", "/v2/aliases", buf)
+	c.Check(s.jctl, check.HasLen, 0)
+}
+
+func (s *appSuite) TestLogsNoServices(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/logs?names=snap-a.app1", nil)
 	c.Assert(err, check.IsNil)
-	rec := httptest.NewRecorder()
-	aliasesCmd.POST(aliasesCmd, req, nil).ServeHTTP(rec, req)
-	c.Check(rec.Code, check.Equals, 202)
-	var body map[string]interface{}
-	err = json.Unmarshal(rec.Body.Bytes(), &body)
-	c.Check(err, check.IsNil)
-	id := body["change"].(string)
 
-	st := d.overlord.State()
-	st.Lock()
-	chg := st.Change(id)
-	st.Unlock()
-	c.Assert(chg, check.NotNil)
+	rsp := getLogs(logsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusNotFound)
+	c.Check(s.jctl, check.HasLen, 0)
+}
 
-	<-chg.Ready()
+func (s *apiSuite) TestListSnapshots(c *check.C) {
+	s.daemon(c)
 
-	st.Lock()
-	defer st.Unlock()
-	err = chg.Err()
-	c.Assert(err, check.IsNil)
+	var calls []string
+	defer func(old func(uint64, []string) ([]client.SnapshotSet, error)) { snapshotList = old }(snapshotList)
+	snapshotList = func(setID uint64, snapNames []string) ([]client.SnapshotSet, error) {
+		calls = append(calls, fmt.Sprintf("%d:%v", setID, snapNames))
+		return []client.SnapshotSet{{ID: setID, Snapshots: []*client.Snapshot{{SetID: setID, Snap: "foo"}}}}, nil
+	}
 
-	var allAliases map[string]map[string]string
-	err = st.Get("aliases", &allAliases)
+	req, err := http.NewRequest("GET", "/v2/snapshots?set=42&snaps=foo,bar", nil)
 	c.Assert(err, check.IsNil)
-	c.Check(allAliases, check.DeepEquals, map[string]map[string]string{
-		"alias-snap": {"alias1": "disabled"},
-	})
+	rsp := listSnapshots(snapshotCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, []client.SnapshotSet{{ID: 42, Snapshots: []*client.Snapshot{{SetID: 42, Snap: "foo"}}}})
+	c.Check(calls, check.DeepEquals, []string{"42:[foo bar]"})
 
+	req, err = http.NewRequest("GET", "/v2/snapshots?set=-1", nil)
+	c.Assert(err, check.IsNil)
+	rsp = listSnapshots(snapshotCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `'set', if given, must be a positive base 10 number; got "-1"`)
 }
 
-func (s *apiSuite) TestResetAliasSuccess(c *check.C) {
-	err := os.MkdirAll(dirs.SnapBinariesDir, 0755)
-	c.Assert(err, check.IsNil)
+func (s *apiSuite) TestSaveSnapshots(c *check.C) {
 	d := s.daemon(c)
 
-	s.mockSnap(c, aliasYaml)
+	soon := 0
+	ensureStateSoon = func(st *state.State) { soon++ }
 
-	oldAutoAliases := snapstate.AutoAliases
-	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
-		return nil, nil
+	defer func(old func(*state.State, []string, []string) (uint64, []string, *state.TaskSet, error)) {
+		snapshotSave = old
+	}(snapshotSave)
+	snapshotSave = func(st *state.State, snapNames []string, users []string) (uint64, []string, *state.TaskSet, error) {
+		c.Check(snapNames, check.DeepEquals, []string{"foo"})
+		c.Check(users, check.DeepEquals, []string{"bob"})
+		return 42, snapNames, state.NewTaskSet(st.NewTask("save-snapshot", "...")), nil
 	}
-	defer func() { snapstate.AutoAliases = oldAutoAliases }()
 
-	d.overlord.Loop()
-	defer d.overlord.Stop()
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(`{"action": "snapshot", "snaps": ["foo"], "users": ["bob"]}`))
+	c.Assert(err, check.IsNil)
+	rsp := changeSnapshots(snapshotCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusAccepted, check.Commentf("%v", rsp.Result))
+	c.Check(soon, check.Equals, 1)
 
 	st := d.overlord.State()
 	st.Lock()
 	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "save-snapshot")
+	c.Check(chg.Summary(), check.Equals, `Snapshot snap "foo" for users "bob"`)
+	var apiData map[string]interface{}
+	c.Assert(chg.Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"set-id":     42.,
+		"snap-names": []interface{}{"foo"},
+	})
+}
 
-	st.Set("aliases", map[string]map[string]string{
-		"alias-snap": {
-			"alias1": "disabled",
-		},
+func (s *apiSuite) TestChangeSnapshots(c *check.C) {
+	d := s.daemon(c)
+	ensureStateSoon = func(*state.State) {}
+
+	var calls []string
+	fake := func(action string) func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+		return func(st *state.State, setID uint64, snapNames []string, users []string) ([]string, *state.TaskSet, error) {
+			calls = append(calls, fmt.Sprintf("%s:%d:%v:%v", action, setID, snapNames, users))
+			return []string{"foo"}, state.NewTaskSet(st.NewTask(action+"-snapshot", "...")), nil
+		}
+	}
+	defer func(check, restore func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error), forget func(*state.State, uint64, []string) ([]string, *state.TaskSet, error)) {
+		snapshotCheck = check
+		snapshotRestore = restore
+		snapshotForget = forget
+	}(snapshotCheck, snapshotRestore, snapshotForget)
+	snapshotCheck = fake("check")
+	snapshotRestore = fake("restore")
+	snapshotForget = func(st *state.State, setID uint64, snapNames []string) ([]string, *state.TaskSet, error) {
+		return fake("forget")(st, setID, snapNames, nil)
+	}
+
+	for _, action := range []string{"check", "restore", "forget"} {
+		body := fmt.Sprintf(`{"action": %q, "set": 42, "snaps": ["foo"]}`, action)
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		rsp := changeSnapshots(snapshotCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, check.Equals, http.StatusAccepted, check.Commentf("%v", rsp.Result))
+
+		st := d.overlord.State()
+		st.Lock()
+		chg := st.Change(rsp.Change)
+		c.Assert(chg, check.NotNil)
+		c.Check(chg.Kind(), check.Equals, action+"-snapshot")
+		st.Unlock()
+	}
+	c.Check(calls, check.DeepEquals, []string{
+		"check:42:[foo]:[]",
+		"restore:42:[foo]:[]",
+		"forget:42:[foo]:[]",
 	})
+}
 
-	action := &aliasAction{
-		Action:  "reset",
-		Snap:    "alias-snap",
-		Aliases: []string{"alias1"},
+func (s *apiSuite) TestChangeSnapshotsBadRequest(c *check.C) {
+	s.daemon(c)
+
+	for body, msg := range map[string]string{
+		`{"action": "snapshot", "set": 42}`:               `snapshot operation "snapshot" does not take a set id`,
+		`{"action": "check"}`:                             `snapshot operation requires set id`,
+		`{"set": 42}`:                                     `snapshot operation not specified`,
+		`{"action": "frobble", "set": 42}`:                `unknown snapshot operation "frobble"`,
+		`{"action": "forget", "set": 42, "users": ["x"]}`: `snapshot operation "forget" does not take a list of users`,
+		`{"action": "check", "set": 42}{}`:                `extra content found after snapshot operation`,
+	} {
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		rsp := changeSnapshots(snapshotCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest, check.Commentf(body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, msg, check.Commentf(body))
 	}
-	text, err := json.Marshal(action)
+}
+
+func (s *apiSuite) TestGetWarnings(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	st.Warnf("hello world")
+	st.Unlock()
+
+	for _, q := range []string{"", "?select=pending", "?select=all"} {
+		req, err := http.NewRequest("GET", "/v2/warnings"+q, nil)
+		c.Assert(err, check.IsNil)
+		rsp := getWarnings(warningsCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, check.Equals, http.StatusOK, check.Commentf(q))
+		ws, ok := rsp.Result.([]*state.Warning)
+		c.Assert(ok, check.Equals, true, check.Commentf(q))
+		c.Assert(ws, check.HasLen, 1)
+		c.Check(ws[0].String(), check.Equals, "hello world")
+	}
+
+	req, err := http.NewRequest("GET", "/v2/warnings?select=foo", nil)
 	c.Assert(err, check.IsNil)
-	buf := bytes.NewBuffer(text)
-	req, err := http.NewRequest("POST", "/v2/aliases", buf)
+	rsp := getWarnings(warningsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+}
+
+func (s *apiSuite) TestGetWarningsNone(c *check.C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/warnings", nil)
 	c.Assert(err, check.IsNil)
-	rec := httptest.NewRecorder()
-	st.Unlock()
-	aliasesCmd.POST(aliasesCmd, req, nil).ServeHTTP(rec, req)
+	rsp := getWarnings(warningsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, []state.Warning{})
+}
+
+func (s *apiSuite) TestAckWarnings(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
 	st.Lock()
-	c.Check(rec.Code, check.Equals, 202)
-	var body map[string]interface{}
-	err = json.Unmarshal(rec.Body.Bytes(), &body)
-	c.Check(err, check.IsNil)
-	id := body["change"].(string)
+	st.Warnf("hello world")
+	st.Unlock()
 
-	chg := st.Change(id)
-	c.Assert(chg, check.NotNil)
+	stamp := time.Now().Add(time.Second).UTC().Format(time.RFC3339Nano)
+	req, err := http.NewRequest("POST", "/v2/warnings", strings.NewReader(`{"action": "okay", "timestamp": "`+stamp+`"}`))
+	c.Assert(err, check.IsNil)
+	rsp := ackWarnings(warningsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.Equals, 1)
 
-	st.Unlock()
-	<-chg.Ready()
 	st.Lock()
+	n, _ := st.WarningsSummary()
+	st.Unlock()
+	c.Check(n, check.Equals, 0)
+}
 
-	err = chg.Err()
-	c.Assert(err, check.IsNil)
+func (s *apiSuite) TestAckWarningsBadRequest(c *check.C) {
+	s.daemon(c)
 
-	var allAliases map[string]map[string]string
-	err = st.Get("aliases", &allAliases)
-	c.Assert(err, check.IsNil)
-	c.Check(allAliases, check.HasLen, 0)
+	for body, msg := range map[string]string{
+		`{"action": "frobble"}`:               `unknown warning action "frobble"`,
+		`{"action": "okay"}{}`:                `spurious content after warnings operation`,
+		`{"action": "okay", "timestamp": 42}`: `cannot decode request body into warnings operation: .*`,
+	} {
+		req, err := http.NewRequest("POST", "/v2/warnings", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		rsp := ackWarnings(warningsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest, check.Commentf(body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, msg, check.Commentf(body))
+	}
 }
 
-func (s *apiSuite) TestAliases(c *check.C) {
-	d := s.daemon(c)
+func (s *apiSuite) mockCheckValidationSet(invalid ...string) (restore func()) {
+	old := assertstateCheckValidationSet
+	assertstateCheckValidationSet = func(st *state.State, tr *assertstate.ValidationSetTracking) error {
+		for _, name := range invalid {
+			if tr.Name == name {
+				return &snapasserts.ValidationSetsValidationError{MissingSnaps: []string{"foo"}}
+			}
+		}
+		return nil
+	}
+	return func() { assertstateCheckValidationSet = old }
+}
 
-	s.mockSnap(c, aliasYaml)
+func (s *apiSuite) TestListValidationSets(c *check.C) {
+	d := s.daemon(c)
+	defer s.mockCheckValidationSet("two")()
 
 	st := d.overlord.State()
 	st.Lock()
-	st.Set("aliases", map[string]map[string]string{
-		"alias-snap": {
-			"alias1": "enabled",
-			"alias3": "disabled", // gone from the current revision of the snap
-		},
+	err := assertstate.UpdateValidationSet(st, &assertstate.ValidationSetTracking{
+		AccountID: "acc", Name: "two", Mode: assertstate.Enforce, Current: 3,
+	})
+	c.Assert(err, check.IsNil)
+	err = assertstate.UpdateValidationSet(st, &assertstate.ValidationSetTracking{
+		AccountID: "acc", Name: "one", Mode: assertstate.Monitor, PinnedAt: 2, Current: 2,
 	})
+	c.Assert(err, check.IsNil)
 	st.Unlock()
 
-	req, err := http.NewRequest("GET", "/v2/aliases", nil)
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
 	c.Assert(err, check.IsNil)
-
-	rsp := getAliases(aliasesCmd, req, nil).(*resp)
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Status, check.Equals, http.StatusOK)
-	c.Check(rsp.Result, check.DeepEquals, map[string]map[string]aliasStatus{
-		"alias-snap": {
-			"alias1": {App: "alias-snap.app", Status: "enabled"},
-			"alias2": {App: "alias-snap.app2"},
-			"alias3": {Status: "disabled"},
-		},
+	rsp := listValidationSets(validationSetsListCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, []*validationSetResult{
+		{AccountID: "acc", Name: "one", Mode: "monitor", PinnedAt: 2, Sequence: 2, Valid: true},
+		{AccountID: "acc", Name: "two", Mode: "enforce", Sequence: 3, Valid: false},
 	})
 
+	s.vars = map[string]string{"account": "acc", "name": "one"}
+	req, err = http.NewRequest("GET", "/v2/validation-sets/acc/one", nil)
+	c.Assert(err, check.IsNil)
+	rsp = getValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK)
+	c.Check(rsp.Result, check.DeepEquals, &validationSetResult{AccountID: "acc", Name: "one", Mode: "monitor", PinnedAt: 2, Sequence: 2, Valid: true})
+
+	s.vars = map[string]string{"account": "acc", "name": "other"}
+	rsp = getValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusNotFound)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `validation set "acc/other" is not tracked`)
 }
 
-var _ = check.Suite(&postDebugSuite{})
+func (s *apiSuite) TestApplyValidationSetMonitor(c *check.C) {
+	s.daemon(c)
+	defer s.mockCheckValidationSet()()
 
-type postDebugSuite struct {
-	apiBaseSuite
+	var calls []string
+	defer func(old func(*state.State, string, string, int, int) (*assertstate.ValidationSetTracking, error)) {
+		assertstateMonitorValidationSet = old
+	}(assertstateMonitorValidationSet)
+	assertstateMonitorValidationSet = func(st *state.State, accountID, name string, sequence, userID int) (*assertstate.ValidationSetTracking, error) {
+		calls = append(calls, fmt.Sprintf("%s/%s=%d", accountID, name, sequence))
+		return &assertstate.ValidationSetTracking{AccountID: accountID, Name: name, Mode: assertstate.Monitor, PinnedAt: sequence, Current: 5}, nil
+	}
+
+	s.vars = map[string]string{"account": "acc", "name": "fleet"}
+	req, err := http.NewRequest("POST", "/v2/validation-sets/acc/fleet", strings.NewReader(`{"action": "apply", "mode": "monitor", "sequence": 5}`))
+	c.Assert(err, check.IsNil)
+	rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK, check.Commentf("%v", rsp.Result))
+	c.Check(rsp.Result, check.DeepEquals, &validationSetResult{AccountID: "acc", Name: "fleet", Mode: "monitor", PinnedAt: 5, Sequence: 5, Valid: true})
+	c.Check(calls, check.DeepEquals, []string{"acc/fleet=5"})
 }
 
-func (s *postDebugSuite) TestPostDebugEnsureStateSoon(c *check.C) {
+func (s *apiSuite) TestApplyValidationSetEnforce(c *check.C) {
 	d := s.daemon(c)
-	d.overlord.Loop()
-	defer d.overlord.Stop()
 
 	soon := 0
-	ensureStateSoon = func(st *state.State) {
-		soon++
-		ensureStateSoonImpl(st)
+	ensureStateSoon = func(st *state.State) { soon++ }
+
+	defer func(old func(*state.State, string, string, int, int) (*assertstate.ValidationSetTracking, []*state.TaskSet, error)) {
+		assertstateEnforceValidationSet = old
+	}(assertstateEnforceValidationSet)
+	assertstateEnforceValidationSet = func(st *state.State, accountID, name string, sequence, userID int) (*assertstate.ValidationSetTracking, []*state.TaskSet, error) {
+		tr := &assertstate.ValidationSetTracking{AccountID: accountID, Name: name, Mode: assertstate.Enforce, Current: 2}
+		return tr, []*state.TaskSet{state.NewTaskSet(st.NewTask("fake-install-snap", "..."))}, nil
 	}
 
-	buf := bytes.NewBufferString(`{"action": "ensure-state-soon"}`)
-	req, err := http.NewRequest("POST", "/v2/debug", buf)
+	s.vars = map[string]string{"account": "acc", "name": "fleet"}
+	req, err := http.NewRequest("POST", "/v2/validation-sets/acc/fleet", strings.NewReader(`{"action": "apply", "mode": "enforce"}`))
 	c.Assert(err, check.IsNil)
+	rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusAccepted, check.Commentf("%v", rsp.Result))
+	c.Check(soon, check.Equals, 1)
 
-	rsp := postDebug(debugCmd, req, nil).(*resp)
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "enforce-validation-set")
+	c.Check(chg.Summary(), check.Equals, `Enforce validation set "acc/fleet"`)
+	var apiData map[string]interface{}
+	c.Assert(chg.Get("api-data", &apiData), check.IsNil)
+	c.Check(apiData, check.DeepEquals, map[string]interface{}{
+		"account-id": "acc",
+		"name":       "fleet",
+		"sequence":   2.,
+	})
+}
 
-	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
-	c.Check(rsp.Result, check.Equals, true)
-	c.Check(soon, check.Equals, 1)
+func (s *apiSuite) TestForgetValidationSet(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	err := assertstate.UpdateValidationSet(st, &assertstate.ValidationSetTracking{
+		AccountID: "acc", Name: "fleet", Mode: assertstate.Monitor, Current: 1,
+	})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"account": "acc", "name": "fleet"}
+	req, err := http.NewRequest("POST", "/v2/validation-sets/acc/fleet", strings.NewReader(`{"action": "forget"}`))
+	c.Assert(err, check.IsNil)
+	rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, http.StatusOK, check.Commentf("%v", rsp.Result))
+
+	st.Lock()
+	vsmap, err := assertstate.ValidationSets(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(vsmap, check.HasLen, 0)
+
+	req, err = http.NewRequest("POST", "/v2/validation-sets/acc/fleet", strings.NewReader(`{"action": "forget"}`))
+	c.Assert(err, check.IsNil)
+	rsp = applyValidationSet(validationSetsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, http.StatusBadRequest)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `validation set "acc/fleet" is not tracked`)
+}
+
+func (s *apiSuite) TestApplyValidationSetErrors(c *check.C) {
+	s.daemon(c)
+	s.vars = map[string]string{"account": "acc", "name": "fleet"}
+
+	for body, msg := range map[string]string{
+		`{"action": "apply", "mode": "foo"}`:      `invalid validation set mode "foo"`,
+		`{"action": "frobnicate"}`:                `unknown validation set action "frobnicate"`,
+		`{"action": "forget", "mode": "monitor"}`: `validation set action "forget" does not take a mode or a sequence`,
+		`{"action": "apply", "sequence": -1}`:     `invalid sequence -1`,
+		`{"action": "apply"}{}`:                   `spurious content after validation set action`,
+	} {
+		req, err := http.NewRequest("POST", "/v2/validation-sets/acc/fleet", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		rsp := applyValidationSet(validationSetsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, http.StatusBadRequest, check.Commentf(body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, msg, check.Commentf(body))
+	}
 }
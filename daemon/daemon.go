@@ -144,6 +144,14 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		rsp = rspf(c, r, user)
 	}
 
+	if rsp, ok := rsp.(*resp); ok && rsp.Type != ResponseTypeError {
+		state.Lock()
+		count, stamp := state.WarningsSummary()
+		state.Unlock()
+
+		rsp.addWarningsToMeta(count, stamp)
+	}
+
 	rsp.ServeHTTP(w, r)
 }
 
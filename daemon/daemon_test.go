@@ -20,6 +20,7 @@
 package daemon
 
 import (
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -113,6 +114,31 @@ func (s *daemonSuite) TestCommandMethodDispatch(c *check.C) {
 	c.Check(rec.Code, check.Equals, http.StatusMethodNotAllowed)
 }
 
+func (s *daemonSuite) TestCommandAddsWarningsToMeta(c *check.C) {
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	st.Warnf("hello")
+	st.Unlock()
+
+	cmd := &Command{d: d}
+	cmd.GET = func(*Command, *http.Request, *auth.UserState) Response {
+		return SyncResponse("hi", nil)
+	}
+	req, err := http.NewRequest("GET", "", nil)
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "uid=0;" + req.RemoteAddr
+
+	rec := httptest.NewRecorder()
+	cmd.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+
+	var rst map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rst), check.IsNil)
+	c.Check(rst["warning-count"], check.Equals, 1.)
+	c.Check(rst["warning-timestamp"], check.NotNil)
+}
+
 func (s *daemonSuite) TestGuestAccess(c *check.C) {
 	get := &http.Request{Method: "GET"}
 	put := &http.Request{Method: "PUT"}
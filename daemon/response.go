@@ -20,15 +20,20 @@
 package daemon
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/systemd"
 )
 
 // ResponseType is the response type
@@ -64,6 +69,9 @@ type Meta struct {
 	Paging            *Paging  `json:"paging,omitempty"`
 	SuggestedCurrency string   `json:"suggested-currency,omitempty"`
 	Change            string   `json:"change,omitempty"`
+
+	WarningTimestamp *time.Time `json:"warning-timestamp,omitempty"`
+	WarningCount     int        `json:"warning-count,omitempty"`
 }
 
 type Paging struct {
@@ -89,6 +97,17 @@ func (r *resp) MarshalJSON() ([]byte, error) {
 	})
 }
 
+func (r *resp) addWarningsToMeta(count int, stamp time.Time) {
+	if r.Meta == nil {
+		r.Meta = &Meta{}
+	}
+	if r.WarningCount != 0 || count == 0 {
+		return
+	}
+	r.WarningCount = count
+	r.WarningTimestamp = &stamp
+}
+
 func (r *resp) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	status := r.Status
 	bs, err := r.MarshalJSON()
@@ -133,6 +152,8 @@ const (
 
 	errorKindSnapNeedsMode          = errorKind("snap-needs-mode")
 	errorKindSnapNeedsClassicSystem = errorKind("snap-needs-classic-system")
+
+	errorKindUnsuccessful = errorKind("unsuccessful")
 )
 
 type errorValue interface{}
@@ -230,6 +251,73 @@ func (ar assertResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// journalLineReaderSeqResponse streams the entries read from a journal
+// reader as a "json-seq" (RFC 7464) of client.Log entries.
+type journalLineReaderSeqResponse struct {
+	io.ReadCloser
+	follow bool
+}
+
+func (rr *journalLineReaderSeqResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer rr.Close()
+
+	w.Header().Set("Content-Type", "application/json-seq")
+
+	if cn, ok := w.(http.CloseNotifier); ok && rr.follow {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-cn.CloseNotify():
+				// the client went away, stop following the journal
+				rr.Close()
+			case <-done:
+			}
+		}()
+	}
+
+	flusher, hasFlusher := w.(http.Flusher)
+
+	var err error
+	dec := json.NewDecoder(rr)
+	writer := bufio.NewWriter(w)
+	enc := json.NewEncoder(writer)
+	for {
+		var log systemd.Log
+		if err = dec.Decode(&log); err != nil {
+			break
+		}
+
+		writer.WriteByte(0x1E) // RS -- see ascii(7), and RFC7464
+
+		// a zero time is all that can be done about a bad timestamp
+		t, _ := log.Time()
+		if err = enc.Encode(client.Log{
+			Timestamp: t,
+			Message:   log.Message(),
+			SID:       log.SID(),
+			PID:       log.PID(),
+		}); err != nil {
+			break
+		}
+
+		if rr.follow {
+			if err = writer.Flush(); err != nil {
+				break
+			}
+			if hasFlusher {
+				flusher.Flush()
+			}
+		}
+	}
+	if err != nil && err != io.EOF {
+		logger.Noticef("cannot stream journal entries: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		logger.Noticef("cannot stream journal entries: %v", err)
+	}
+}
+
 // errorResponder is a callable that produces an error Response.
 // e.g., InternalError("something broke: %v", err), etc.
 type errorResponder func(string, ...interface{}) Response
@@ -24,12 +24,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
 )
 
 var errNoSnap = errors.New("no snap installed")
@@ -155,6 +161,120 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 	return about, firstErr
 }
 
+type appInfoOptions struct {
+	service bool
+}
+
+func (opts appInfoOptions) String() string {
+	if opts.service {
+		return "service"
+	}
+
+	return "app"
+}
+
+type bySnapApp []*snap.AppInfo
+
+func (a bySnapApp) Len() int      { return len(a) }
+func (a bySnapApp) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a bySnapApp) Less(i, j int) bool {
+	iName := a[i].Snap.Name()
+	jName := a[j].Snap.Name()
+	if iName == jName {
+		return a[i].Name < a[j].Name
+	}
+	return iName < jName
+}
+
+// appInfosFor returns a sorted list of the apps described by names.
+//
+// * If names is empty, it returns all the apps of the wanted kind (all
+//   services if opts.service is set, all apps otherwise).
+// * If a name is a snap name, all the apps of the wanted kind of that
+//   snap are included.
+// * If a name is snap.app, that app is included, and it is an error
+//   for it not to be of the wanted kind.
+func appInfosFor(st *state.State, names []string, opts appInfoOptions) ([]*snap.AppInfo, Response) {
+	snapNames := make(map[string]bool)
+	requested := make(map[string]bool)
+	for _, name := range names {
+		requested[name] = true
+		snapNames[strings.SplitN(name, ".", 2)[0]] = true
+	}
+
+	snaps, err := allLocalSnapInfos(st, false, snapNames)
+	if err != nil {
+		return nil, InternalError("cannot list local snaps! %v", err)
+	}
+
+	foundSnaps := make(map[string]bool)
+	found := make(map[string]bool)
+	appInfos := make([]*snap.AppInfo, 0, len(requested))
+	for _, about := range snaps {
+		snapName := about.info.Name()
+		foundSnaps[snapName] = true
+		includeAll := len(requested) == 0 || requested[snapName]
+		if includeAll {
+			// want all services in a snap
+			found[snapName] = true
+		}
+
+		for _, app := range about.info.Apps {
+			appName := snapName + "." + app.Name
+			if includeAll || requested[appName] {
+				if opts.service && !app.IsService() {
+					continue
+				}
+				found[appName] = true
+				appInfos = append(appInfos, app)
+			}
+		}
+	}
+
+	for name := range requested {
+		if found[name] {
+			continue
+		}
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) == 1 || !foundSnaps[parts[0]] {
+			return nil, NotFound("snap %q not found", parts[0])
+		}
+		return nil, NotFound("snap %q has no %s %q", parts[0], opts, parts[1])
+	}
+
+	sort.Sort(bySnapApp(appInfos))
+
+	return appInfos, nil
+}
+
+// clientAppInfosFromSnapAppInfos converts the given apps to their client
+// representation, querying systemd for the status of the services.
+func clientAppInfosFromSnapAppInfos(apps []*snap.AppInfo) ([]*client.AppInfo, error) {
+	sysd := systemd.New(dirs.GlobalRootDir, &progress.NullProgress{})
+
+	out := make([]*client.AppInfo, len(apps))
+	for i, app := range apps {
+		out[i] = &client.AppInfo{
+			Snap:    app.Snap.Name(),
+			Name:    app.Name,
+			Daemon:  app.Daemon,
+			Aliases: app.Aliases,
+		}
+		if !app.IsService() {
+			continue
+		}
+
+		status, err := sysd.ServiceStatus(app.ServiceName())
+		if err != nil {
+			return nil, fmt.Errorf("cannot get status of service %q: %v", app.Name, err)
+		}
+		out[i].Enabled = status.UnitFileState == "enabled"
+		out[i].Active = status.ActiveState == "active"
+	}
+
+	return out, nil
+}
+
 // appJSON contains the json for snap.AppInfo
 type appJSON struct {
 	Name    string   `json:"name"`
@@ -58,6 +58,8 @@ var (
 
 	SnapStateFile string
 
+	SnapshotsDir string
+
 	SnapBinariesDir     string
 	SnapServicesDir     string
 	SnapDesktopFilesDir string
@@ -136,6 +138,8 @@ func SetRootDir(rootdir string) {
 
 	SnapStateFile = filepath.Join(rootdir, snappyDir, "state.json")
 
+	SnapshotsDir = filepath.Join(rootdir, snappyDir, "snapshots")
+
 	SnapSeedDir = filepath.Join(rootdir, snappyDir, "seed")
 	SnapDeviceDir = filepath.Join(rootdir, snappyDir, "device")
 
@@ -41,11 +41,19 @@ import (
 // If no such profile was previously loaded then it is simply added to the kernel.
 // If there was a profile with the same name before, that profile is replaced.
 func LoadProfile(fname string) error {
+	return LoadProfiles([]string{fname})
+}
+
+// LoadProfiles loads apparmor profiles from the given files with a single
+// invocation of apparmor_parser.
+//
+// Profiles are added to the kernel or replace the already loaded profiles of
+// the same name, just as with LoadProfile.
+func LoadProfiles(fnames []string) error {
 	// Use no-expr-simplify since expr-simplify is actually slower on armhf (LP: #1383858)
-	output, err := exec.Command(
-		"apparmor_parser", "--replace", "--write-cache", "-O",
-		"no-expr-simplify", fmt.Sprintf("--cache-loc=%s", dirs.AppArmorCacheDir),
-		fname).CombinedOutput()
+	args := []string{"--replace", "--write-cache", "-O", "no-expr-simplify",
+		fmt.Sprintf("--cache-loc=%s", dirs.AppArmorCacheDir)}
+	output, err := exec.Command("apparmor_parser", append(args, fnames...)...).CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("cannot load apparmor profile: %s\napparmor_parser output:\n%s", err, string(output))
 	}
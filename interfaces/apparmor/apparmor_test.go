@@ -75,6 +75,18 @@ apparmor_parser output:
 	})
 }
 
+// Tests for LoadProfiles()
+
+func (s *appArmorSuite) TestLoadProfilesRunsAppArmorParserOnce(c *C) {
+	cmd := testutil.MockCommand(c, "apparmor_parser", "")
+	defer cmd.Restore()
+	err := apparmor.LoadProfiles([]string{"/path/to/snap.samba.nmbd", "/path/to/snap.samba.smbd"})
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Calls(), DeepEquals, [][]string{
+		{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", "--cache-loc=/var/cache/apparmor", "/path/to/snap.samba.nmbd", "/path/to/snap.samba.smbd"},
+	})
+}
+
 // Tests for Profile.Unload()
 
 func (s *appArmorSuite) TestUnloadProfileRunsAppArmorParserRemove(c *C) {
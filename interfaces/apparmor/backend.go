@@ -40,12 +40,12 @@ package apparmor
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 )
@@ -65,39 +65,138 @@ func (b *Backend) Name() interfaces.SecuritySystem {
 // This method should be called after changing plug, slots, connections between
 // them or application present in the snap.
 func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) error {
+	fingerprint, err := currentFingerprint()
+	if err != nil {
+		logger.Debugf("cannot compute apparmor cache fingerprint: %s", err)
+	}
+	profiles, err := b.prepareProfiles(snapInfo, opts, repo)
+	if err != nil {
+		return err
+	}
+	errReload := loadProfiles(profiles.needLoading(cacheIsFresh(fingerprint), kernelProfiles()))
+	errUnload := unloadProfiles(profiles.removed)
+	if profiles.errEnsure != nil {
+		return fmt.Errorf("cannot synchronize security files for snap %q: %s", snapInfo.Name(), profiles.errEnsure)
+	}
+	if errReload != nil {
+		return errReload
+	}
+	return errUnload
+}
+
+// SetupMany creates and loads apparmor profiles of all the given snaps.
+//
+// Profiles of all the snaps are loaded together, using batched invocations
+// of apparmor_parser. Profiles that are identical to what was written and
+// successfully loaded before, and that the kernel still has, are not loaded
+// again, unless the apparmor_parser binary or the features of the kernel have
+// changed since.
+func (b *Backend) SetupMany(snapInfos []*snap.Info, confinement func(snapName string) interfaces.ConfinementOptions, repo *interfaces.Repository) []error {
+	fingerprint, err := currentFingerprint()
+	if err != nil {
+		logger.Debugf("cannot compute apparmor cache fingerprint: %s", err)
+	}
+	fresh := cacheIsFresh(fingerprint)
+	loaded := kernelProfiles()
+
+	var errs []error
+	var toLoad []string
+	var prepared []*snapProfiles
+	for _, snapInfo := range snapInfos {
+		profiles, err := b.prepareProfiles(snapInfo, confinement(snapInfo.Name()), repo)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		prepared = append(prepared, profiles)
+		toLoad = append(toLoad, profiles.needLoading(fresh, loaded)...)
+	}
+	logger.Debugf("loading %d apparmor profiles of %d snaps", len(toLoad), len(prepared))
+	errReload := loadProfiles(toLoad)
+	for _, profiles := range prepared {
+		if err := unloadProfiles(profiles.removed); err != nil {
+			errs = append(errs, err)
+		}
+		if profiles.errEnsure != nil {
+			errs = append(errs, fmt.Errorf("cannot synchronize security files for snap %q: %s", profiles.snapName, profiles.errEnsure))
+		}
+	}
+	if errReload != nil {
+		errs = append(errs, errReload)
+	}
+	// Profiles that failed to load have no cache and are loaded again next
+	// time, everything else is now compiled with the current parser.
+	if err := recordFingerprint(fingerprint); err != nil {
+		errs = append(errs, fmt.Errorf("cannot record apparmor cache fingerprint: %s", err))
+	}
+	return errs
+}
+
+// snapProfiles describes the apparmor profiles of a snap after they were
+// written to disk.
+type snapProfiles struct {
+	snapName string
+	// all contains the sorted names of all the profiles of the snap.
+	all []string
+	// changed contains the names of the profiles that were written.
+	changed map[string]bool
+	// removed contains the names of the profiles that were removed.
+	removed []string
+	// errEnsure is the error encountered while writing the profiles.
+	errEnsure error
+}
+
+// needLoading returns the profiles that need to be (re)loaded.
+//
+// When the cache is fresh only the profiles that have changed, were never
+// successfully compiled or are not among the given profiles loaded in the
+// kernel are returned. Otherwise all profiles are returned.
+func (p *snapProfiles) needLoading(fresh bool, loaded map[string]bool) []string {
+	var profiles []string
+	for _, name := range p.all {
+		if fresh && loaded[name] && !p.changed[name] && isCached(name) {
+			continue
+		}
+		profiles = append(profiles, name)
+	}
+	return profiles
+}
+
+// prepareProfiles derives and writes the apparmor profiles of a given snap.
+func (b *Backend) prepareProfiles(snapInfo *snap.Info, opts interfaces.ConfinementOptions, repo *interfaces.Repository) (*snapProfiles, error) {
 	snapName := snapInfo.Name()
 	spec, err := repo.SnapSpecification(b.Name(), snapName)
 	if err != nil {
-		return fmt.Errorf("cannot obtain apparmor specification for snap %q: %s", snapName, err)
+		return nil, fmt.Errorf("cannot obtain apparmor specification for snap %q: %s", snapName, err)
 	}
+	// Add rules for the layout of the snap
+	spec.(*Specification).AddSnapLayout(snapInfo)
 	// Get the files that this snap should have
 	content, err := b.deriveContent(spec.(*Specification), snapInfo, opts)
 	if err != nil {
-		return fmt.Errorf("cannot obtain expected security files for snap %q: %s", snapName, err)
+		return nil, fmt.Errorf("cannot obtain expected security files for snap %q: %s", snapName, err)
 	}
 	glob := interfaces.SecurityTagGlob(snapInfo.Name())
 	dir := dirs.SnapAppArmorDir
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("cannot create directory for apparmor profiles %q: %s", dir, err)
+		return nil, fmt.Errorf("cannot create directory for apparmor profiles %q: %s", dir, err)
 	}
-	_, removed, errEnsure := osutil.EnsureDirState(dir, glob, content)
-	// NOTE: load all profiles instead of just the changed profiles.  We're
-	// relying on apparmor cache to make this efficient. This gives us
-	// certainty that each call to Setup ends up with working profiles.
-	all := make([]string, 0, len(content))
-	for name := range content {
-		all = append(all, name)
+	changed, removed, errEnsure := osutil.EnsureDirState(dir, glob, content)
+	profiles := &snapProfiles{
+		snapName:  snapName,
+		all:       make([]string, 0, len(content)),
+		changed:   make(map[string]bool, len(changed)),
+		removed:   removed,
+		errEnsure: errEnsure,
 	}
-	sort.Strings(all)
-	errReload := reloadProfiles(all)
-	errUnload := unloadProfiles(removed)
-	if errEnsure != nil {
-		return fmt.Errorf("cannot synchronize security files for snap %q: %s", snapName, errEnsure)
+	for name := range content {
+		profiles.all = append(profiles.all, name)
 	}
-	if errReload != nil {
-		return errReload
+	sort.Strings(profiles.all)
+	for _, name := range changed {
+		profiles.changed[name] = true
 	}
-	return errUnload
+	return profiles, nil
 }
 
 // Remove removes and unloads apparmor profiles of a given snap.
@@ -180,17 +279,6 @@ func addContent(securityTag string, snapInfo *snap.Info, opts interfaces.Confine
 	}
 }
 
-func reloadProfiles(profiles []string) error {
-	for _, profile := range profiles {
-		fname := filepath.Join(dirs.SnapAppArmorDir, profile)
-		err := LoadProfile(fname)
-		if err != nil {
-			return fmt.Errorf("cannot load apparmor profile %q: %s", profile, err)
-		}
-	}
-	return nil
-}
-
 func unloadProfiles(profiles []string) error {
 	for _, profile := range profiles {
 		if err := UnloadProfile(profile); err != nil {
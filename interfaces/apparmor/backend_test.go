@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	. "gopkg.in/check.v1"
 
@@ -31,14 +32,19 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
 )
 
 type backendSuite struct {
 	ifacetest.BackendSuite
+	testutil.BaseTest
 
 	parserCmd *testutil.MockCmd
+
+	restoreParserJobs func()
 }
 
 var _ = Suite(&backendSuite{})
@@ -51,11 +57,14 @@ var testedConfinementOpts = []interfaces.ConfinementOptions{
 }
 
 // fakeAppAprmorParser contains shell program that creates fake binary cache entries
-// in accordance with what real apparmor_parser would do.
+// in accordance with what real apparmor_parser would do. The profiles it loads
+// are listed in the .loaded file in the cache directory, in the format of the
+// profiles file of the kernel.
 const fakeAppArmorParser = `
 cache_dir=""
-profile=""
+profiles=""
 write=""
+remove=""
 while [ -n "$1" ]; do
 	case "$1" in
 		--cache-loc=*)
@@ -64,7 +73,10 @@ while [ -n "$1" ]; do
 		--write-cache)
 			write=yes
 			;;
-		--replace|--remove)
+		--remove)
+			remove=yes
+			;;
+		--replace)
 			# Ignore
 			;;
 		-O)
@@ -72,18 +84,30 @@ while [ -n "$1" ]; do
 			shift
 			;;
 		*)
-			profile=$(basename "$1")
+			profiles="$profiles $(basename "$1")"
 			;;
 	esac
 	shift
 done
+if [ -e "$cache_dir/.fail" ]; then
+	echo bad policy
+	exit 1
+fi
 if [ "$write" = yes ]; then
-	echo fake > "$cache_dir/$profile"
+	for profile in $profiles; do
+		echo fake > "$cache_dir/$profile"
+	done
+fi
+if [ -n "$cache_dir" ] && [ "$remove" != yes ]; then
+	for profile in $profiles; do
+		echo "$profile (enforce)" >> "$cache_dir/.loaded"
+	done
 fi
 `
 
 func (s *backendSuite) SetUpTest(c *C) {
 	s.Backend = &apparmor.Backend{}
+	s.BaseTest.SetUpTest(c)
 	s.BackendSuite.SetUpTest(c)
 	c.Assert(s.Repo.AddBackend(s.Backend), IsNil)
 
@@ -95,12 +119,17 @@ func (s *backendSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 	// Mock away any real apparmor interaction
 	s.parserCmd = testutil.MockCommand(c, "apparmor_parser", fakeAppArmorParser)
+	// Load all profiles with one apparmor_parser process for predictable calls
+	s.restoreParserJobs = apparmor.MockParserJobs(1)
+	apparmor.MockProfilesPath(&s.BaseTest, filepath.Join(dirs.AppArmorCacheDir, ".loaded"))
 }
 
 func (s *backendSuite) TearDownTest(c *C) {
+	s.restoreParserJobs()
 	s.parserCmd.Restore()
 
 	s.BackendSuite.TearDownTest(c)
+	s.BaseTest.TearDownTest(c)
 }
 
 // Tests for Setup() and Remove()
@@ -214,10 +243,9 @@ func (s *backendSuite) TestUpdatingSnapToOneWithMoreApps(c *C) {
 		// file called "snap.sambda.nmbd" was created
 		_, err := os.Stat(nmbdProfile)
 		c.Check(err, IsNil)
-		// apparmor_parser was used to load the both profiles
+		// apparmor_parser was used to load all the profiles at once
 		c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile},
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), smbdProfile},
+			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile, smbdProfile},
 		})
 		s.RemoveSnap(c, snapInfo)
 	}
@@ -236,11 +264,9 @@ func (s *backendSuite) TestUpdatingSnapToOneWithMoreHooks(c *C) {
 		// Verify that profile "snap.samba.hook.configure" was created
 		_, err := os.Stat(hookProfile)
 		c.Check(err, IsNil)
-		// apparmor_parser was used to load the both profiles
+		// apparmor_parser was used to load all the profiles at once
 		c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), hookProfile},
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile},
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), smbdProfile},
+			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), hookProfile, nmbdProfile, smbdProfile},
 		})
 		s.RemoveSnap(c, snapInfo)
 	}
@@ -281,8 +307,7 @@ func (s *backendSuite) TestUpdatingSnapToOneWithFewerHooks(c *C) {
 		c.Check(os.IsNotExist(err), Equals, true)
 		// apparmor_parser was used to remove the unused profile
 		c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile},
-			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), smbdProfile},
+			{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile, smbdProfile},
 			{"apparmor_parser", "--remove", "snap.samba.hook.configure"},
 		})
 		s.RemoveSnap(c, snapInfo)
@@ -396,3 +421,173 @@ func (s *backendSuite) TestCombineSnippets(c *C) {
 		s.RemoveSnap(c, snapInfo)
 	}
 }
+
+func (s *backendSuite) setupMany(c *C, snapInfos ...*snap.Info) {
+	confinement := func(snapName string) interfaces.ConfinementOptions {
+		return interfaces.ConfinementOptions{}
+	}
+	errs := s.Backend.(*apparmor.Backend).SetupMany(snapInfos, confinement, s.Repo)
+	c.Assert(errs, HasLen, 0)
+}
+
+func (s *backendSuite) TestSetupManyLoadsProfilesOfAllSnapsAtOnce(c *C) {
+	snapInfo1 := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	snapInfo2 := snaptest.MockInfo(c, ifacetest.HookYaml, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo1, snapInfo2)
+	nmbdProfile := filepath.Join(dirs.SnapAppArmorDir, "snap.samba.nmbd")
+	smbdProfile := filepath.Join(dirs.SnapAppArmorDir, "snap.samba.smbd")
+	hookProfile := filepath.Join(dirs.SnapAppArmorDir, "snap.foo.hook.configure")
+	c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
+		{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir), nmbdProfile, smbdProfile, hookProfile},
+	})
+}
+
+func (s *backendSuite) TestSetupManyUsesParallelParserJobs(c *C) {
+	restore := apparmor.MockParserJobs(2)
+	defer restore()
+	// The log of MockCommand is shared by all the processes so each of them
+	// records its own arguments separately instead.
+	callsDir := c.MkDir()
+	cmd := testutil.MockCommand(c, "apparmor_parser", fmt.Sprintf(`echo "$@" > %s/$$`, callsDir))
+	defer cmd.Restore()
+
+	snapInfo1 := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	snapInfo2 := snaptest.MockInfo(c, ifacetest.HookYaml, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo1, snapInfo2)
+
+	files, err := ioutil.ReadDir(callsDir)
+	c.Assert(err, IsNil)
+	var calls []string
+	for _, fi := range files {
+		data, err := ioutil.ReadFile(filepath.Join(callsDir, fi.Name()))
+		c.Assert(err, IsNil)
+		calls = append(calls, string(data))
+	}
+	sort.Strings(calls)
+	opts := fmt.Sprintf("--replace --write-cache -O no-expr-simplify --cache-loc=%s/var/cache/apparmor", s.RootDir)
+	c.Check(calls, DeepEquals, []string{
+		fmt.Sprintf("%s %s/snap.foo.hook.configure\n", opts, dirs.SnapAppArmorDir),
+		fmt.Sprintf("%s %s/snap.samba.nmbd %s/snap.samba.smbd\n", opts, dirs.SnapAppArmorDir, dirs.SnapAppArmorDir),
+	})
+}
+
+func (s *backendSuite) TestSetupManySkipsUnchangedProfiles(c *C) {
+	snapInfo := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), HasLen, 1)
+
+	// Nothing has changed so nothing is loaded.
+	s.parserCmd.ForgetCalls()
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), HasLen, 0)
+
+	// Setup also relies on the cache now.
+	err := s.Backend.Setup(snapInfo, interfaces.ConfinementOptions{}, s.Repo)
+	c.Assert(err, IsNil)
+	c.Check(s.parserCmd.Calls(), HasLen, 0)
+
+	// Changed profiles are loaded.
+	err = s.Backend.Setup(snapInfo, interfaces.ConfinementOptions{DevMode: true}, s.Repo)
+	c.Assert(err, IsNil)
+	c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
+		{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir),
+			filepath.Join(dirs.SnapAppArmorDir, "snap.samba.nmbd"), filepath.Join(dirs.SnapAppArmorDir, "snap.samba.smbd")},
+	})
+
+	// A profile without a binary cache is loaded.
+	s.setupMany(c, snapInfo)
+	s.parserCmd.ForgetCalls()
+	err = os.Remove(filepath.Join(dirs.AppArmorCacheDir, "snap.samba.nmbd"))
+	c.Assert(err, IsNil)
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
+		{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir),
+			filepath.Join(dirs.SnapAppArmorDir, "snap.samba.nmbd")},
+	})
+}
+
+func (s *backendSuite) TestSetupManyLoadsProfilesMissingFromKernel(c *C) {
+	snapInfo := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo)
+	s.parserCmd.ForgetCalls()
+
+	// Only one of the profiles is still loaded, e.g. after a reboot.
+	loaded := filepath.Join(dirs.AppArmorCacheDir, ".loaded")
+	c.Assert(ioutil.WriteFile(loaded, []byte("snap.samba.smbd (enforce)\n"), 0644), IsNil)
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), DeepEquals, [][]string{
+		{"apparmor_parser", "--replace", "--write-cache", "-O", "no-expr-simplify", fmt.Sprintf("--cache-loc=%s/var/cache/apparmor", s.RootDir),
+			filepath.Join(dirs.SnapAppArmorDir, "snap.samba.nmbd")},
+	})
+
+	// Everything is loaded when the kernel cannot be asked.
+	s.parserCmd.ForgetCalls()
+	c.Assert(os.Remove(loaded), IsNil)
+	err := s.Backend.Setup(snapInfo, interfaces.ConfinementOptions{}, s.Repo)
+	c.Assert(err, IsNil)
+	c.Check(s.parserCmd.Calls(), HasLen, 1)
+}
+
+func (s *backendSuite) TestSetupManyReloadsEverythingWhenKernelFeaturesChange(c *C) {
+	snapInfo := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo)
+	s.parserCmd.ForgetCalls()
+
+	featuresDir := filepath.Join(dirs.GlobalRootDir, apparmor.FeaturesDir())
+	c.Assert(os.MkdirAll(filepath.Join(featuresDir, "policy"), 0755), IsNil)
+	err := ioutil.WriteFile(filepath.Join(featuresDir, "policy", "versions"), []byte("v7\n"), 0644)
+	c.Assert(err, IsNil)
+
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), HasLen, 1)
+	s.parserCmd.ForgetCalls()
+	s.setupMany(c, snapInfo)
+	c.Check(s.parserCmd.Calls(), HasLen, 0)
+}
+
+func (s *backendSuite) TestSetupManyReloadsProfilesThatFailedToLoad(c *C) {
+	snapInfo := snaptest.MockInfo(c, ifacetest.SambaYamlV1WithNmbd, &snap.SideInfo{Revision: snap.R(1)})
+	s.setupMany(c, snapInfo)
+
+	// The profiles change but loading them fails.
+	s.parserCmd.ForgetCalls()
+	failFlag := filepath.Join(dirs.AppArmorCacheDir, ".fail")
+	c.Assert(ioutil.WriteFile(failFlag, nil, 0644), IsNil)
+	confinement := func(snapName string) interfaces.ConfinementOptions {
+		return interfaces.ConfinementOptions{DevMode: true}
+	}
+	errs := s.Backend.(*apparmor.Backend).SetupMany([]*snap.Info{snapInfo}, confinement, s.Repo)
+	c.Assert(errs, HasLen, 1)
+	c.Check(errs[0], ErrorMatches, `cannot load apparmor profiles "snap.samba.nmbd", "snap.samba.smbd": cannot load apparmor profile: exit status 1\napparmor_parser output:\nbad policy\n`)
+	c.Check(s.parserCmd.Calls(), HasLen, 1)
+	c.Check(osutil.FileExists(filepath.Join(dirs.AppArmorCacheDir, "snap.samba.nmbd")), Equals, false)
+	c.Check(osutil.FileExists(filepath.Join(dirs.AppArmorCacheDir, "snap.samba.smbd")), Equals, false)
+
+	// The written profiles are unchanged now but they are loaded again.
+	s.parserCmd.ForgetCalls()
+	c.Assert(os.Remove(failFlag), IsNil)
+	errs = s.Backend.(*apparmor.Backend).SetupMany([]*snap.Info{snapInfo}, confinement, s.Repo)
+	c.Assert(errs, HasLen, 0)
+	c.Check(s.parserCmd.Calls(), HasLen, 1)
+}
+
+func (s *backendSuite) TestLayoutIsReflectedInProfiles(c *C) {
+	restoreTemplate := apparmor.MockTemplate("\n" +
+		"###PROFILEATTACH### (attach_disconnected) {\n" +
+		"###SNIPPETS###\n" +
+		"}\n")
+	defer restoreTemplate()
+	snapInfo := s.InstallSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1+`
+layout:
+  /usr/share/samba:
+    bind: $SNAP/usr/share/samba
+`, 1)
+	defer s.RemoveSnap(c, snapInfo)
+	data, err := ioutil.ReadFile(filepath.Join(dirs.SnapAppArmorDir, "snap.samba.smbd"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "\n"+
+		"profile \"snap.samba.smbd\" (attach_disconnected) {\n"+
+		"# Layout path: /usr/share/samba\n"+
+		"/usr/share/samba{,/**} mrwklix,\n"+
+		"}\n")
+}
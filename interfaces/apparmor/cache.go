@@ -0,0 +1,209 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package apparmor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// parserJobs is the maximum number of apparmor_parser processes that are
+// allowed to run at the same time.
+var parserJobs = runtime.NumCPU()
+
+// featuresDir contains the features supported by the running kernel.
+const featuresDir = "/sys/kernel/security/apparmor/features"
+
+// fingerprintFile returns the file storing the fingerprint of the parser and
+// kernel features that were in effect when all the profiles were last loaded.
+func fingerprintFile() string {
+	return filepath.Join(dirs.AppArmorCacheDir, ".snapd-fingerprint")
+}
+
+// currentFingerprint computes a fingerprint of the apparmor_parser binary and
+// of the apparmor features of the running kernel.
+//
+// Any change to either of them can change the compiled form of otherwise
+// identical policy, making the binary cache stale.
+func currentFingerprint() (string, error) {
+	h := sha256.New()
+	parser, err := exec.LookPath("apparmor_parser")
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(parser)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "parser %s %d %d\n", parser, fi.Size(), fi.ModTime().UnixNano())
+	dir := filepath.Join(dirs.GlobalRootDir, featuresDir)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "feature %s %d\n", rel, len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheIsFresh returns true if the given fingerprint matches the one recorded
+// after the profiles were last loaded.
+func cacheIsFresh(fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+	data, err := ioutil.ReadFile(fingerprintFile())
+	if err != nil {
+		return false
+	}
+	return string(data) == fingerprint
+}
+
+// recordFingerprint stores the given fingerprint after the profiles were loaded.
+func recordFingerprint(fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dirs.AppArmorCacheDir, 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(fingerprintFile(), []byte(fingerprint), 0644, 0)
+}
+
+// isCached returns true if the binary cache of a given profile exists.
+func isCached(profile string) bool {
+	return osutil.FileExists(filepath.Join(dirs.AppArmorCacheDir, profile))
+}
+
+// kernelProfiles returns the set of snap profiles currently loaded in the
+// kernel. When that cannot be determined nil is returned and all profiles are
+// loaded again.
+func kernelProfiles() map[string]bool {
+	names, err := LoadedProfiles()
+	if err != nil {
+		logger.Debugf("cannot list loaded apparmor profiles: %s", err)
+		return nil
+	}
+	loaded := make(map[string]bool, len(names))
+	for _, name := range names {
+		loaded[name] = true
+	}
+	return loaded
+}
+
+// loadProfiles loads the given profiles, in batches, using a bounded number
+// of concurrent apparmor_parser processes.
+//
+// The binary cache of each profile in a batch that failed to load is removed
+// so that the profiles are not considered up-to-date later on. The first
+// error, in the order of batches, is returned.
+func loadProfiles(profiles []string) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	jobs := parserJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(profiles) {
+		jobs = len(profiles)
+	}
+	size := (len(profiles) + jobs - 1) / jobs
+	var batches [][]string
+	for i := 0; i < len(profiles); i += size {
+		end := i + size
+		if end > len(profiles) {
+			end = len(profiles)
+		}
+		batches = append(batches, profiles[i:end])
+	}
+
+	start := time.Now()
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer wg.Done()
+			errs[i] = loadBatch(batch)
+		}(i, batch)
+	}
+	wg.Wait()
+	logger.Debugf("loaded %d apparmor profiles with %d parser jobs in %s", len(profiles), len(batches), time.Since(start))
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadBatch(batch []string) error {
+	fnames := make([]string, len(batch))
+	for i, profile := range batch {
+		fnames[i] = filepath.Join(dirs.SnapAppArmorDir, profile)
+	}
+	err := LoadProfiles(fnames)
+	if err == nil {
+		return nil
+	}
+	for _, profile := range batch {
+		if err := os.Remove(filepath.Join(dirs.AppArmorCacheDir, profile)); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("cannot remove apparmor profile cache %q: %s", profile, err)
+		}
+	}
+	if len(batch) == 1 {
+		return fmt.Errorf("cannot load apparmor profile %q: %s", batch[0], err)
+	}
+	return fmt.Errorf("cannot load apparmor profiles %s: %s", strutil.Quoted(batch), err)
+}
@@ -47,3 +47,15 @@ func MockClassicTemplate(fakeTemplate string) (restore func()) {
 	classicTemplate = fakeTemplate
 	return func() { classicTemplate = orig }
 }
+
+// MockParserJobs replaces the number of concurrent apparmor_parser processes.
+func MockParserJobs(n int) (restore func()) {
+	old := parserJobs
+	parserJobs = n
+	return func() { parserJobs = old }
+}
+
+// FeaturesDir returns the directory with the apparmor features of the kernel.
+func FeaturesDir() string {
+	return featuresDir
+}
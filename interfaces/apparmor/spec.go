@@ -20,7 +20,10 @@
 package apparmor
 
 import (
+	"fmt"
+
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/snap"
 
 	"sort"
 	"strings"
@@ -72,6 +75,48 @@ func (spec *Specification) SecurityTags() []string {
 	return tags
 }
 
+// AddSnapLayout adds apparmor snippets based on the layout of the snap.
+//
+// The snippets allow all the apps and hooks of the snap to use the paths
+// provided by the layout.
+func (spec *Specification) AddSnapLayout(si *snap.Info) {
+	if len(si.Layout) == 0 {
+		return
+	}
+
+	// The layout affects all the apps and hooks of the snap.
+	var tags []string
+	for _, app := range si.Apps {
+		tags = append(tags, app.SecurityTag())
+	}
+	for _, hook := range si.Hooks {
+		tags = append(tags, hook.SecurityTag())
+	}
+	spec.securityTags = tags
+	defer func() { spec.securityTags = nil }()
+
+	paths := make([]string, 0, len(si.Layout))
+	for path := range si.Layout {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		l := si.Layout[path]
+		var rule string
+		switch {
+		case l.Bind != "" || l.Type != "":
+			rule = fmt.Sprintf("%s{,/**} mrwklix,", path)
+		case l.BindFile != "":
+			rule = fmt.Sprintf("%s mrwklix,", path)
+		case l.Symlink != "":
+			rule = fmt.Sprintf("%s r,", path)
+		default:
+			continue
+		}
+		spec.AddSnippet(fmt.Sprintf("# Layout path: %s\n%s", path, rule))
+	}
+}
+
 // Implementation of methods required by interfaces.Specification
 
 // AddConnectedPlug records apparmor-specific side-effects of having a connected plug.
@@ -20,12 +20,15 @@
 package apparmor_test
 
 import (
+	"strings"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 )
 
 type specSuite struct {
@@ -99,3 +102,39 @@ func (s *specSuite) TestSpecificationIface(c *C) {
 		"snap.snap2.app2": {"connected-slot", "permanent-slot"},
 	})
 }
+
+const snapWithLayout = `name: vanguard
+version: 0
+apps:
+  vanguard:
+    command: vanguard
+hooks:
+  configure:
+layout:
+  /usr:
+    bind: $SNAP/usr
+  /lib/mytmp:
+    type: tmpfs
+  /lib/mylink:
+    symlink: $SNAP/link/target
+  /etc/foo.conf:
+    bind-file: $SNAP/foo.conf
+`
+
+func (s *specSuite) TestApparmorSnippetsFromLayout(c *C) {
+	snapInfo := snaptest.MockInfo(c, snapWithLayout, &snap.SideInfo{Revision: snap.R(42)})
+	s.spec.AddSnapLayout(snapInfo)
+	snippets := []string{
+		"# Layout path: /etc/foo.conf\n/etc/foo.conf mrwklix,",
+		"# Layout path: /lib/mylink\n/lib/mylink r,",
+		"# Layout path: /lib/mytmp\n/lib/mytmp{,/**} mrwklix,",
+		"# Layout path: /usr\n/usr{,/**} mrwklix,",
+	}
+	c.Assert(s.spec.Snippets(), DeepEquals, map[string][]string{
+		"snap.vanguard.vanguard":       snippets,
+		"snap.vanguard.hook.configure": snippets,
+	})
+	// The security tags of the layout are not used afterwards.
+	s.spec.AddSnippet("unrelated")
+	c.Assert(s.spec.SnippetForTag("snap.vanguard.vanguard"), Equals, strings.Join(snippets, "\n"))
+}
@@ -88,3 +88,14 @@ type SecurityBackend interface {
 	// NewSpecification returns a new specification associated with this backend.
 	NewSpecification() Specification
 }
+
+// SecurityBackendSetupMany is implemented by security backends that can set
+// up the security artefacts of many snaps at once more efficiently than by
+// calling Setup for each of them.
+type SecurityBackendSetupMany interface {
+	// SetupMany creates and loads security artefacts of the given snaps.
+	// The confinement function returns the options of each of the snaps.
+	// Errors of particular snaps do not prevent other snaps from being set
+	// up and are all returned.
+	SetupMany(snapInfos []*snap.Info, confinement func(snapName string) ConfinementOptions, repo *Repository) []error
+}
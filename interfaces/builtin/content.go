@@ -88,6 +88,18 @@ func (iface *ContentInterface) SanitizePlug(plug *interfaces.Plug) error {
 		return fmt.Errorf("content interface target path is not clean: %q", target)
 	}
 
+	// default-provider is optional, and is <snap>[:<slot>]
+	if dprovider, ok := plug.Attrs["default-provider"]; ok {
+		name, ok := dprovider.(string)
+		if !ok {
+			return fmt.Errorf("content plug default-provider must be a string")
+		}
+		name = strings.SplitN(name, ":", 2)[0]
+		if err := snap.ValidateName(name); err != nil {
+			return fmt.Errorf("content plug default-provider is not valid: %v", err)
+		}
+	}
+
 	return nil
 }
 
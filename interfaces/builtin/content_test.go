@@ -179,6 +179,45 @@ plugs:
 	c.Assert(err, ErrorMatches, "content interface target path is not clean:.*")
 }
 
+func (s *ContentSuite) TestSanitizePlugDefaultProvider(c *C) {
+	for _, dprovider := range []string{"provider-snap", "provider-snap:some-slot"} {
+		mockSnapYaml := `name: content-plug-snap
+version: 1.0
+plugs:
+ content-plug:
+  interface: content
+  content: mycont
+  target: import
+  default-provider: ` + dprovider
+		info := snaptest.MockInfo(c, mockSnapYaml, nil)
+		plug := &interfaces.Plug{PlugInfo: info.Plugs["content-plug"]}
+		err := s.iface.SanitizePlug(plug)
+		c.Check(err, IsNil, Commentf("%s", dprovider))
+	}
+}
+
+func (s *ContentSuite) TestSanitizePlugBadDefaultProvider(c *C) {
+	for dprovider, expected := range map[string]string{
+		"[1, 2]":         "content plug default-provider must be a string",
+		"Provider":       `content plug default-provider is not valid: invalid snap name: "Provider"`,
+		":some-slot":     `content plug default-provider is not valid: invalid snap name: ""`,
+		"-provider:slot": `content plug default-provider is not valid: invalid snap name: "-provider"`,
+	} {
+		mockSnapYaml := `name: content-plug-snap
+version: 1.0
+plugs:
+ content-plug:
+  interface: content
+  content: mycont
+  target: import
+  default-provider: ` + dprovider
+		info := snaptest.MockInfo(c, mockSnapYaml, nil)
+		plug := &interfaces.Plug{PlugInfo: info.Plugs["content-plug"]}
+		err := s.iface.SanitizePlug(plug)
+		c.Check(err, ErrorMatches, expected, Commentf("%s", dprovider))
+	}
+}
+
 func (s *ContentSuite) TestResolveSpecialVariable(c *C) {
 	info := snaptest.MockInfo(c, "name: name", &snap.SideInfo{Revision: snap.R(42)})
 	c.Check(builtin.ResolveSpecialVariable("foo", info), Equals, "/snap/name/42/foo")
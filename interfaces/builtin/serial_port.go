@@ -28,6 +28,7 @@ import (
 
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 )
 
 // SerialPortInterface is the type for serial port interfaces.
@@ -196,6 +197,24 @@ func (iface *SerialPortInterface) AutoConnect(*interfaces.Plug, *interfaces.Slot
 	return true
 }
 
+// HotplugDeviceDetected creates a slot for USB serial adapters as they
+// get plugged in.
+func (iface *SerialPortInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.SlotSpec, error) {
+	if di.Subsystem() != "tty" {
+		return nil, nil
+	}
+	if bus, _ := di.Attribute("ID_BUS"); bus != "usb" {
+		return nil, nil
+	}
+	devname := di.DeviceName()
+	if !serialDeviceNodePattern.MatchString(devname) {
+		return nil, nil
+	}
+	return &hotplug.SlotSpec{
+		Attrs: map[string]interface{}{"path": devname},
+	}, nil
+}
+
 func (iface *SerialPortInterface) hasUsbAttrs(slot *interfaces.Slot) bool {
 	if _, ok := slot.Attrs["usb-vendor"]; ok {
 		return true
@@ -25,6 +25,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
 )
@@ -323,3 +324,37 @@ func (s *SerialPortInterfaceSuite) TestConnectedPlugAppArmorSnippets(c *C) {
 	expectedSnippet8 := `/dev/tty[A-Z]*[0-9] rw,`
 	checkConnectedPlugSnippet(s.testPlugPort2, s.testUdev2, expectedSnippet8)
 }
+
+func (s *SerialPortInterfaceSuite) TestHotplugDeviceDetected(c *C) {
+	iface := &builtin.SerialPortInterface{}
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{
+		"DEVPATH":   "/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0",
+		"DEVNAME":   "/dev/ttyUSB0",
+		"SUBSYSTEM": "tty",
+		"ID_BUS":    "usb",
+	})
+	c.Assert(err, IsNil)
+	spec, err := iface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Check(spec, DeepEquals, &hotplug.SlotSpec{
+		Attrs: map[string]interface{}{"path": "/dev/ttyUSB0"},
+	})
+}
+
+func (s *SerialPortInterfaceSuite) TestHotplugDeviceDetectedIgnored(c *C) {
+	iface := &builtin.SerialPortInterface{}
+	for _, env := range []map[string]string{
+		// not a tty
+		{"DEVPATH": "/devices/a", "DEVNAME": "/dev/hidraw0", "SUBSYSTEM": "hidraw", "ID_BUS": "usb"},
+		// not on usb
+		{"DEVPATH": "/devices/b", "DEVNAME": "/dev/ttyS0", "SUBSYSTEM": "tty"},
+		// not a serial port
+		{"DEVPATH": "/devices/c", "DEVNAME": "/dev/tty1", "SUBSYSTEM": "tty", "ID_BUS": "usb"},
+	} {
+		di, err := hotplug.NewHotplugDeviceInfo(env)
+		c.Assert(err, IsNil)
+		spec, err := iface.HotplugDeviceDetected(di)
+		c.Assert(err, IsNil)
+		c.Check(spec, IsNil, Commentf("%v", env))
+	}
+}
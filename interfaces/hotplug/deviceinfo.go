@@ -0,0 +1,83 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// HotplugDeviceInfo carries information about a specific device as
+// reported by udev.
+type HotplugDeviceInfo struct {
+	// the properties of the device, as in the uevent environment
+	data map[string]string
+}
+
+// NewHotplugDeviceInfo returns a new HotplugDeviceInfo for the device with
+// the given udev properties, which must include DEVPATH.
+func NewHotplugDeviceInfo(env map[string]string) (*HotplugDeviceInfo, error) {
+	if env["DEVPATH"] == "" {
+		return nil, fmt.Errorf("missing device path attribute")
+	}
+	return &HotplugDeviceInfo{data: env}, nil
+}
+
+// Properties returns all the udev properties of the device.
+func (h *HotplugDeviceInfo) Properties() map[string]string {
+	return h.data
+}
+
+// Attribute returns the value of the given udev property of the device,
+// and whether the property is set.
+func (h *HotplugDeviceInfo) Attribute(name string) (string, bool) {
+	val, ok := h.data[name]
+	return val, ok
+}
+
+// DevicePath returns the path of the device in sysfs, e.g.
+// /sys/devices/pci0000:00/0000:00:14.0/usb2/2-3/2-3:1.0/ttyUSB0/tty/ttyUSB0.
+func (h *HotplugDeviceInfo) DevicePath() string {
+	return filepath.Join("/sys", h.data["DEVPATH"])
+}
+
+// DeviceName returns the path of the device node, e.g. /dev/ttyUSB0, or
+// an empty string if the device has no node.
+func (h *HotplugDeviceInfo) DeviceName() string {
+	name := h.data["DEVNAME"]
+	if name != "" && !strings.HasPrefix(name, "/") {
+		name = "/dev/" + name
+	}
+	return name
+}
+
+// Subsystem returns the kernel subsystem of the device, e.g. tty.
+func (h *HotplugDeviceInfo) Subsystem() string {
+	return h.data["SUBSYSTEM"]
+}
+
+func (h *HotplugDeviceInfo) String() string {
+	s := h.DevicePath()
+	if name := h.DeviceName(); name != "" {
+		s += fmt.Sprintf(" (%s)", name)
+	}
+	return s
+}
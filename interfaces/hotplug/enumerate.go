@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+var udevadmExport = func() ([]byte, error) {
+	output, err := exec.Command("udevadm", "info", "--export-db").CombinedOutput()
+	if err != nil {
+		return nil, osutil.OutputErr(output, err)
+	}
+	return output, nil
+}
+
+// EnumerateExistingDevices calls the given callback for every device
+// currently known to udev.
+func EnumerateExistingDevices(cb DeviceCallback) error {
+	output, err := udevadmExport()
+	if err != nil {
+		return fmt.Errorf("cannot enumerate devices: %v", err)
+	}
+	return parseUDevadmExport(bytes.NewReader(output), cb)
+}
+
+// parseUDevadmExport parses the output of udevadm info --export-db,
+// which lists devices separated by empty lines, with the properties of
+// each given by "E: KEY=VALUE" lines.
+func parseUDevadmExport(r io.Reader, cb DeviceCallback) error {
+	env := make(map[string]string)
+	flush := func() {
+		if len(env) == 0 {
+			return
+		}
+		if di, err := NewHotplugDeviceInfo(env); err == nil {
+			cb(di)
+		}
+		env = make(map[string]string)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if !strings.HasPrefix(line, "E: ") {
+			continue
+		}
+		kv := strings.SplitN(line[len("E: "):], "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid device property %q", line)
+		}
+		env[kv[0]] = kv[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
@@ -0,0 +1,92 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug_test
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/hotplug"
+)
+
+type enumerateSuite struct{}
+
+var _ = Suite(&enumerateSuite{})
+
+const udevadmOutput = `P: /devices/virtual/net/lo
+E: DEVPATH=/devices/virtual/net/lo
+E: INTERFACE=lo
+E: SUBSYSTEM=net
+
+P: /devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0
+N: ttyUSB0
+E: DEVNAME=/dev/ttyUSB0
+E: DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0
+E: ID_BUS=usb
+E: SUBSYSTEM=tty
+
+P: /module/nopath
+E: SUBSYSTEM=module
+`
+
+func (s *enumerateSuite) TestEnumerateExistingDevices(c *C) {
+	restore := hotplug.MockUDevadmExport(func() ([]byte, error) {
+		return []byte(udevadmOutput), nil
+	})
+	defer restore()
+
+	var devices []*hotplug.HotplugDeviceInfo
+	err := hotplug.EnumerateExistingDevices(func(di *hotplug.HotplugDeviceInfo) {
+		devices = append(devices, di)
+	})
+	c.Assert(err, IsNil)
+	// the device without a path is skipped
+	c.Assert(devices, HasLen, 2)
+	c.Check(devices[0].Properties(), DeepEquals, map[string]string{
+		"DEVPATH":   "/devices/virtual/net/lo",
+		"INTERFACE": "lo",
+		"SUBSYSTEM": "net",
+	})
+	c.Check(devices[1].DeviceName(), Equals, "/dev/ttyUSB0")
+	c.Check(devices[1].Subsystem(), Equals, "tty")
+}
+
+func (s *enumerateSuite) TestEnumerateExistingDevicesError(c *C) {
+	restore := hotplug.MockUDevadmExport(func() ([]byte, error) {
+		return nil, fmt.Errorf("boom")
+	})
+	defer restore()
+
+	err := hotplug.EnumerateExistingDevices(func(di *hotplug.HotplugDeviceInfo) {
+		c.Fatalf("unexpected device")
+	})
+	c.Assert(err, ErrorMatches, "cannot enumerate devices: boom")
+}
+
+func (s *enumerateSuite) TestEnumerateInvalidProperty(c *C) {
+	restore := hotplug.MockUDevadmExport(func() ([]byte, error) {
+		return []byte("E: FOO\n"), nil
+	})
+	defer restore()
+
+	err := hotplug.EnumerateExistingDevices(func(di *hotplug.HotplugDeviceInfo) {})
+	c.Assert(err, ErrorMatches, `invalid device property "E: FOO"`)
+}
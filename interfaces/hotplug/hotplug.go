@@ -0,0 +1,76 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package hotplug implements the detection of devices that come and go,
+// so that interfaces can create slots for them.
+package hotplug
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SlotSpec describes a slot that an interface wants created for a
+// hotplugged device.
+type SlotSpec struct {
+	// Name is the preferred name of the slot. When empty a name is
+	// derived from the device and the interface.
+	Name  string                 `json:"name,omitempty"`
+	Label string                 `json:"label,omitempty"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// HotplugDeviceHandler can be implemented by interfaces that want slots
+// created for hotplugged devices.
+type HotplugDeviceHandler interface {
+	// HotplugDeviceDetected is called for every device that appears
+	// in the system. It returns the slot to create for the device, or
+	// nil if the device is of no interest to the interface.
+	HotplugDeviceDetected(di *HotplugDeviceInfo) (*SlotSpec, error)
+}
+
+// keyProperties are the udev properties that identify a device across
+// reappearances, e.g. when it's unplugged and plugged in again.
+var keyProperties = []string{"ID_VENDOR_ID", "ID_MODEL_ID", "ID_SERIAL"}
+
+// DeviceKey returns a key that identifies the device across
+// reappearances. It's derived from the vendor, model and serial udev
+// properties of the device or, when these are missing, from its path.
+// Devices without a serial number are told apart by the physical port
+// they are plugged into.
+func DeviceKey(di *HotplugDeviceInfo) string {
+	var parts []string
+	for _, prop := range keyProperties {
+		if val, ok := di.Attribute(prop); ok && val != "" {
+			parts = append(parts, prop+"="+val)
+		}
+	}
+	if _, ok := di.Attribute("ID_SERIAL_SHORT"); !ok && len(parts) > 0 {
+		if val, ok := di.Attribute("ID_PATH"); ok && val != "" {
+			parts = append(parts, "ID_PATH="+val)
+		}
+	}
+	if len(parts) == 0 {
+		devpath, _ := di.Attribute("DEVPATH")
+		parts = append(parts, "DEVPATH="+devpath)
+	}
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:16])
+}
@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/hotplug"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type hotplugSuite struct{}
+
+var _ = Suite(&hotplugSuite{})
+
+func (s *hotplugSuite) TestDeviceInfo(c *C) {
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{
+		"DEVPATH":   "/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0",
+		"DEVNAME":   "ttyUSB0",
+		"SUBSYSTEM": "tty",
+		"ID_MODEL":  "FT232R_USB_UART",
+	})
+	c.Assert(err, IsNil)
+	c.Check(di.DevicePath(), Equals, "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0")
+	c.Check(di.DeviceName(), Equals, "/dev/ttyUSB0")
+	c.Check(di.Subsystem(), Equals, "tty")
+	c.Check(di.String(), Equals, "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/ttyUSB0/tty/ttyUSB0 (/dev/ttyUSB0)")
+
+	model, ok := di.Attribute("ID_MODEL")
+	c.Check(ok, Equals, true)
+	c.Check(model, Equals, "FT232R_USB_UART")
+	_, ok = di.Attribute("ID_SERIAL")
+	c.Check(ok, Equals, false)
+}
+
+func (s *hotplugSuite) TestDeviceInfoNoNode(c *C) {
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/devices/virtual/net/lo"})
+	c.Assert(err, IsNil)
+	c.Check(di.DeviceName(), Equals, "")
+	c.Check(di.String(), Equals, "/sys/devices/virtual/net/lo")
+}
+
+func (s *hotplugSuite) TestDeviceInfoMissingPath(c *C) {
+	_, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVNAME": "/dev/ttyUSB0"})
+	c.Assert(err, ErrorMatches, "missing device path attribute")
+}
+
+func deviceInfo(c *C, env map[string]string) *hotplug.HotplugDeviceInfo {
+	di, err := hotplug.NewHotplugDeviceInfo(env)
+	c.Assert(err, IsNil)
+	return di
+}
+
+func (s *hotplugSuite) TestDeviceKey(c *C) {
+	env := map[string]string{
+		"DEVPATH":         "/devices/a/ttyUSB0",
+		"ID_VENDOR_ID":    "0403",
+		"ID_MODEL_ID":     "6001",
+		"ID_SERIAL":       "FTDI_FT232R_USB_UART_A1234",
+		"ID_SERIAL_SHORT": "A1234",
+	}
+	key := hotplug.DeviceKey(deviceInfo(c, env))
+	c.Check(key, HasLen, 32)
+
+	// the same device plugged into another port has the same key
+	env["DEVPATH"] = "/devices/b/ttyUSB1"
+	c.Check(hotplug.DeviceKey(deviceInfo(c, env)), Equals, key)
+
+	// but another device of the same model does not
+	env["ID_SERIAL"] = "FTDI_FT232R_USB_UART_B5678"
+	c.Check(hotplug.DeviceKey(deviceInfo(c, env)), Not(Equals), key)
+}
+
+func (s *hotplugSuite) TestDeviceKeyNoSerial(c *C) {
+	env := map[string]string{
+		"DEVPATH":      "/devices/a/ttyACM0",
+		"ID_VENDOR_ID": "2341",
+		"ID_MODEL_ID":  "0043",
+		"ID_SERIAL":    "2341_0043",
+		"ID_PATH":      "pci-0000:00:14.0-usb-0:1:1.0",
+	}
+	key := hotplug.DeviceKey(deviceInfo(c, env))
+
+	// devices without a serial number are told apart by their port
+	env["ID_PATH"] = "pci-0000:00:14.0-usb-0:2:1.0"
+	c.Check(hotplug.DeviceKey(deviceInfo(c, env)), Not(Equals), key)
+}
+
+func (s *hotplugSuite) TestDeviceKeyFallbackToPath(c *C) {
+	key1 := hotplug.DeviceKey(deviceInfo(c, map[string]string{"DEVPATH": "/devices/a"}))
+	key2 := hotplug.DeviceKey(deviceInfo(c, map[string]string{"DEVPATH": "/devices/b"}))
+	c.Check(key1, Not(Equals), key2)
+	c.Check(hotplug.DeviceKey(deviceInfo(c, map[string]string{"DEVPATH": "/devices/a"})), Equals, key1)
+}
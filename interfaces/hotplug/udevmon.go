@@ -0,0 +1,221 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+// DeviceCallback is called with the details of a device that was added
+// or removed.
+type DeviceCallback func(di *HotplugDeviceInfo)
+
+// UDevMonitor reports the devices added to and removed from the system,
+// as announced by udev over netlink.
+type UDevMonitor struct {
+	added   DeviceCallback
+	removed DeviceCallback
+
+	sock    *os.File
+	running bool
+	tomb    tomb.Tomb
+}
+
+// udevEventGroup is the netlink multicast group of the events sent by
+// udev after it has processed the ones from the kernel; these carry the
+// properties, such as the vendor and model of the device, set by the
+// udev rules.
+const udevEventGroup = 2
+
+// NewUDevMonitor returns a monitor calling added and removed, from its
+// own goroutine, for every device added or removed.
+func NewUDevMonitor(added, removed DeviceCallback) *UDevMonitor {
+	return &UDevMonitor{
+		added:   added,
+		removed: removed,
+	}
+}
+
+// Connect opens the netlink socket the events are received from.
+func (m *UDevMonitor) Connect() error {
+	if m.sock != nil {
+		return fmt.Errorf("udev monitor is already connected")
+	}
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("cannot open netlink socket: %v", err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: udevEventGroup,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("cannot bind netlink socket: %v", err)
+	}
+	// a non-blocking file is handled by the runtime poller, so that
+	// closing it interrupts a pending read
+	m.sock = os.NewFile(uintptr(fd), "udev-monitor")
+	return nil
+}
+
+// Run starts delivering events in the background.
+func (m *UDevMonitor) Run() error {
+	if m.sock == nil {
+		return fmt.Errorf("udev monitor is not connected")
+	}
+	m.running = true
+	m.tomb.Go(m.loop)
+	return nil
+}
+
+// Stop stops delivering events and closes the netlink socket.
+func (m *UDevMonitor) Stop() error {
+	m.tomb.Kill(nil)
+	if m.sock != nil {
+		m.sock.Close()
+	}
+	if !m.running {
+		return nil
+	}
+	return m.tomb.Wait()
+}
+
+func (m *UDevMonitor) loop() error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := m.sock.Read(buf)
+		if err != nil {
+			select {
+			case <-m.tomb.Dying():
+				return nil
+			default:
+			}
+			return fmt.Errorf("cannot read udev event: %v", err)
+		}
+		action, env, err := parseUEvent(buf[:n])
+		if err != nil {
+			logger.Noticef("ignoring udev event: %v", err)
+			continue
+		}
+		m.dispatch(action, env)
+	}
+}
+
+func (m *UDevMonitor) dispatch(action string, env map[string]string) {
+	var cb DeviceCallback
+	switch action {
+	case "add":
+		cb = m.added
+	case "remove":
+		cb = m.removed
+	default:
+		return
+	}
+	di, err := NewHotplugDeviceInfo(env)
+	if err != nil {
+		logger.Noticef("ignoring udev %s event: %v", action, err)
+		return
+	}
+	cb(di)
+}
+
+// libudevPrefix starts the messages sent by udev, followed by a header
+// in host byte order except for the magic number.
+const libudevPrefix = "libudev\x00"
+
+const libudevMagic = 0xfeedcafe
+
+// libudevHeader is the header of the messages sent by udev.
+type libudevHeader struct {
+	Prefix        [8]byte
+	Magic         uint32
+	HeaderSize    uint32
+	PropertiesOff uint32
+	PropertiesLen uint32
+	// the rest of the header is about filtering and of no interest
+}
+
+var nativeEndian = hostByteOrder()
+
+func hostByteOrder() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// parseUEvent parses a message received over netlink, either from udev
+// or from the kernel, returning the action and the properties of the
+// device.
+func parseUEvent(msg []byte) (action string, env map[string]string, err error) {
+	var props []byte
+	if bytes.HasPrefix(msg, []byte(libudevPrefix)) {
+		var hdr libudevHeader
+		if err := binary.Read(bytes.NewReader(msg), nativeEndian, &hdr); err != nil {
+			return "", nil, fmt.Errorf("cannot read udev message header: %v", err)
+		}
+		// the magic number is in network byte order
+		magic := binary.BigEndian.Uint32(msg[8:12])
+		if magic != libudevMagic {
+			return "", nil, fmt.Errorf("invalid udev message magic %#x", magic)
+		}
+		end := uint64(hdr.PropertiesOff) + uint64(hdr.PropertiesLen)
+		if end > uint64(len(msg)) || hdr.PropertiesOff < hdr.HeaderSize {
+			return "", nil, fmt.Errorf("invalid udev message properties offset and length")
+		}
+		props = msg[hdr.PropertiesOff:end]
+	} else {
+		// the kernel sends action@devpath followed by the properties
+		i := bytes.IndexByte(msg, 0)
+		if i < 0 || !bytes.Contains(msg[:i], []byte("@")) {
+			return "", nil, fmt.Errorf("invalid kernel uevent")
+		}
+		props = msg[i+1:]
+	}
+
+	env = make(map[string]string)
+	for _, prop := range bytes.Split(props, []byte{0}) {
+		if len(prop) == 0 {
+			continue
+		}
+		kv := strings.SplitN(string(prop), "=", 2)
+		if len(kv) != 2 {
+			return "", nil, fmt.Errorf("invalid uevent property %q", prop)
+		}
+		env[kv[0]] = kv[1]
+	}
+	action = env["ACTION"]
+	if action == "" {
+		return "", nil, fmt.Errorf("uevent without action")
+	}
+	return action, env, nil
+}
@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hotplug_test
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/hotplug"
+)
+
+type udevmonSuite struct{}
+
+var _ = Suite(&udevmonSuite{})
+
+func (s *udevmonSuite) TestParseKernelUEvent(c *C) {
+	msg := []byte("add@/devices/a/ttyUSB0\x00ACTION=add\x00DEVPATH=/devices/a/ttyUSB0\x00SUBSYSTEM=tty\x00DEVNAME=ttyUSB0\x00")
+	action, env, err := hotplug.ParseUEvent(msg)
+	c.Assert(err, IsNil)
+	c.Check(action, Equals, "add")
+	c.Check(env, DeepEquals, map[string]string{
+		"ACTION":    "add",
+		"DEVPATH":   "/devices/a/ttyUSB0",
+		"SUBSYSTEM": "tty",
+		"DEVNAME":   "ttyUSB0",
+	})
+}
+
+func udevMessage(props string) []byte {
+	const headerSize = 40
+	var buf bytes.Buffer
+	buf.WriteString("libudev\x00")
+	binary.Write(&buf, binary.BigEndian, uint32(0xfeedcafe))
+	// the rest of the header is in host byte order
+	for _, v := range []uint32{headerSize, headerSize, uint32(len(props))} {
+		binary.Write(&buf, hotplug.NativeEndian, v)
+	}
+	buf.Write(make([]byte, headerSize-buf.Len()))
+	buf.WriteString(props)
+	return buf.Bytes()
+}
+
+func (s *udevmonSuite) TestParseUDevEvent(c *C) {
+	msg := udevMessage("ACTION=remove\x00DEVPATH=/devices/a/ttyUSB0\x00ID_MODEL=FT232R_USB_UART\x00")
+	action, env, err := hotplug.ParseUEvent(msg)
+	c.Assert(err, IsNil)
+	c.Check(action, Equals, "remove")
+	c.Check(env, DeepEquals, map[string]string{
+		"ACTION":   "remove",
+		"DEVPATH":  "/devices/a/ttyUSB0",
+		"ID_MODEL": "FT232R_USB_UART",
+	})
+}
+
+func (s *udevmonSuite) TestParseUEventErrors(c *C) {
+	for _, t := range []struct {
+		msg []byte
+		err string
+	}{
+		{[]byte("garbage"), "invalid kernel uevent"},
+		{[]byte("add@/devices/a\x00DEVPATH=/devices/a\x00"), "uevent without action"},
+		{[]byte("add@/devices/a\x00ACTION\x00"), `invalid uevent property "ACTION"`},
+		{[]byte("libudev\x00\x00\x00"), "cannot read udev message header: .*"},
+		{udevMessage("ACTION=add")[:45], "invalid udev message properties offset and length"},
+	} {
+		_, _, err := hotplug.ParseUEvent(t.msg)
+		c.Check(err, ErrorMatches, t.err)
+	}
+
+	msg := udevMessage("ACTION=add\x00")
+	msg[8] = 0
+	_, _, err := hotplug.ParseUEvent(msg)
+	c.Check(err, ErrorMatches, "invalid udev message magic 0xedcafe")
+}
+
+func (s *udevmonSuite) TestRunNotConnected(c *C) {
+	m := hotplug.NewUDevMonitor(nil, nil)
+	c.Check(m.Run(), ErrorMatches, "udev monitor is not connected")
+	c.Check(m.Stop(), IsNil)
+}
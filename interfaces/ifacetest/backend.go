@@ -71,3 +71,29 @@ func (b *TestSecurityBackend) Remove(snapName string) error {
 func (b *TestSecurityBackend) NewSpecification() interfaces.Specification {
 	return &Specification{}
 }
+
+// TestSecurityBackendSetupMany is a security backend intended for testing
+// that can also set up many snaps at once.
+type TestSecurityBackendSetupMany struct {
+	TestSecurityBackend
+	// SetupManyCalls stores information about all calls to SetupMany
+	SetupManyCalls []TestSetupManyCall
+}
+
+// TestSetupManyCall stores details about calls to TestSecurityBackendSetupMany.SetupMany
+type TestSetupManyCall struct {
+	// SnapInfos is a copy of the snapInfos argument to a particular call to SetupMany
+	SnapInfos []*snap.Info
+	// Options are the confinement options of each of the snaps
+	Options []interfaces.ConfinementOptions
+}
+
+// SetupMany records information about the call.
+func (b *TestSecurityBackendSetupMany) SetupMany(snapInfos []*snap.Info, confinement func(snapName string) interfaces.ConfinementOptions, repo *interfaces.Repository) []error {
+	call := TestSetupManyCall{SnapInfos: snapInfos}
+	for _, snapInfo := range snapInfos {
+		call.Options = append(call.Options, confinement(snapInfo.Name()))
+	}
+	b.SetupManyCalls = append(b.SetupManyCalls, call)
+	return nil
+}
@@ -26,7 +26,12 @@
 // Each fstab like file looks like a regular fstab entry:
 //   /src/dir /dst/dir none bind 0 0
 //   /src/dir /dst/dir none bind,rw 0 0
-// but only bind mounts are supported
+// but only bind mounts are supported, with the exception of entries derived
+// from the layout of the snap, which can also describe tmpfs mounts and
+// symbolic links.
+//
+// The package also computes and applies the changes needed to bring an
+// existing mount namespace of a snap in line with an updated profile.
 package mount
 
 import (
@@ -36,6 +41,7 @@ import (
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 )
@@ -56,6 +62,7 @@ func (b *Backend) Setup(snapInfo *snap.Info, confinement interfaces.ConfinementO
 	if err != nil {
 		return fmt.Errorf("cannot obtain mount security snippets for snap %q: %s", snapName, err)
 	}
+	spec.(*Specification).AddSnapLayout(snapInfo)
 	content := deriveContent(spec.(*Specification), snapInfo)
 	// synchronize the content with the filesystem
 	glob := fmt.Sprintf("snap.%s.*fstab", snapName)
@@ -63,9 +70,19 @@ func (b *Backend) Setup(snapInfo *snap.Info, confinement interfaces.ConfinementO
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("cannot create directory for mount configuration files %q: %s", dir, err)
 	}
+	if err := recordCurrentProfile(snapName); err != nil {
+		return err
+	}
 	if _, _, err := osutil.EnsureDirState(dir, glob, content); err != nil {
 		return fmt.Errorf("cannot synchronize mount configuration files for snap %q: %s", snapName, err)
 	}
+	// Bring the mount namespace of running applications in line with the
+	// new profile. If that fails the namespace is discarded so that it is
+	// created from scratch the next time an application is started.
+	if err := UpdateSnapNamespace(snapName); err != nil {
+		logger.Noticef("%s, discarding it", err)
+		return DiscardSnapNamespace(snapName)
+	}
 	return nil
 }
 
@@ -83,14 +100,16 @@ func (b *Backend) Remove(snapName string) error {
 
 // deriveContent computes .fstab tables based on requests made to the specification.
 func deriveContent(spec *Specification, snapInfo *snap.Info) map[string]*osutil.FileState {
+	entries := spec.MountEntries()
 	// No entries? Nothing to do!
-	if len(spec.mountEntries) == 0 {
+	if len(entries) == 0 {
 		return nil
 	}
 	// Compute the contents of the fstab file. It should contain all the mount
-	// rules collected by the backend controller.
+	// rules collected by the backend controller, including the layout of the
+	// snap.
 	var buffer bytes.Buffer
-	for _, entry := range spec.mountEntries {
+	for _, entry := range entries {
 		fmt.Fprintf(&buffer, "%s\n", entry)
 	}
 	fstate := &osutil.FileState{Content: buffer.Bytes(), Mode: 0644}
@@ -35,6 +35,7 @@ import (
 	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/interfaces/mount"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/testutil"
 )
 
 func Test(t *testing.T) {
@@ -175,3 +176,81 @@ func (s *backendSuite) TestSetupSetsupWithoutDir(c *C) {
 		c.Assert(osutil.FileExists(fn), Equals, true, Commentf("Expected mount file for %q", binary))
 	}
 }
+
+func (s *backendSuite) TestSetupSetsupWithLayout(c *C) {
+	fsEntry := mount.Entry{Name: "/src-1", Dir: "/dst-1", Type: "none", Options: []string{"bind", "ro"}}
+	s.Iface.MountPermanentPlugCallback = func(spec *mount.Specification, plug *interfaces.Plug) error {
+		return spec.AddMountEntry(fsEntry)
+	}
+
+	s.InstallSnap(c, interfaces.ConfinementOptions{}, mockSnapYaml+`
+layout:
+  /usr/share/foo:
+    bind: $SNAP/usr/share/foo
+  /var/cache/foo:
+    type: tmpfs
+`, 1)
+
+	// The layout comes first, followed by entries from interfaces.
+	fn := filepath.Join(dirs.SnapMountPolicyDir, "snap.snap-name.fstab")
+	content, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, fmt.Sprintf(""+
+		"%s/snap-name/1/usr/share/foo /usr/share/foo none rbind,rw 0 0\n"+
+		"tmpfs /var/cache/foo tmpfs defaults 0 0\n"+
+		"/src-1 /dst-1 none bind,ro 0 0\n", dirs.SnapMountDir))
+}
+
+func (s *backendSuite) TestSetupSetsupLayoutWithoutInterfaces(c *C) {
+	s.InstallSnap(c, interfaces.ConfinementOptions{}, `name: snap-name
+version: 1
+apps:
+  app:
+layout:
+  /var/cache/foo:
+    type: tmpfs
+`, 1)
+	fn := filepath.Join(dirs.SnapMountPolicyDir, "snap.snap-name.fstab")
+	content, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "tmpfs /var/cache/foo tmpfs defaults 0 0\n")
+}
+
+func (s *backendSuite) TestSetupUpdatesPreservedNamespace(c *C) {
+	fsEntry := mount.Entry{Name: "/src-1", Dir: "/dst-1", Type: "none", Options: []string{"bind", "ro"}}
+	s.Iface.MountPermanentPlugCallback = func(spec *mount.Specification, plug *interfaces.Plug) error {
+		return spec.AddMountEntry(fsEntry)
+	}
+	cmd := testutil.MockCommand(c, "snap-update-ns", "")
+	defer cmd.Restore()
+	dirs.DistroLibExecDir = cmd.BinDir()
+
+	// The preserved mount namespace was populated from the old profile.
+	c.Assert(os.MkdirAll(dirs.SnapRunNsDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapRunNsDir, "snap-name.mnt"), nil, 0644), IsNil)
+	oldProfile := "/src-0 /dst-0 none bind,ro 0 0\n"
+	c.Assert(ioutil.WriteFile(mount.DesiredProfilePath("snap-name"), []byte(oldProfile), 0644), IsNil)
+
+	s.InstallSnap(c, interfaces.ConfinementOptions{}, mockSnapYaml, 0)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{{"snap-update-ns", "snap-name"}})
+	// The old profile is recorded as the one applied to the namespace.
+	content, err := ioutil.ReadFile(mount.CurrentProfilePath("snap-name"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, oldProfile)
+}
+
+func (s *backendSuite) TestSetupDiscardsNamespaceThatCannotBeUpdated(c *C) {
+	cmd := testutil.MockCommand(c, "snap-update-ns", "echo failure; exit 1").Also("snap-discard-ns", "")
+	defer cmd.Restore()
+	dirs.DistroLibExecDir = cmd.BinDir()
+
+	c.Assert(os.MkdirAll(dirs.SnapRunNsDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapRunNsDir, "snap-name.mnt"), nil, 0644), IsNil)
+
+	s.InstallSnap(c, interfaces.ConfinementOptions{}, mockSnapYaml, 0)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"snap-update-ns", "snap-name"},
+		{"snap-discard-ns", "snap-name"},
+	})
+	c.Check(osutil.FileExists(mount.CurrentProfilePath("snap-name")), Equals, false)
+}
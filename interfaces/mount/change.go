@@ -0,0 +1,320 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+// Action represents a mount action (mount, remount, unmount, etc).
+type Action string
+
+const (
+	// Keep indicates that a given mount entry should be kept as-is.
+	Keep Action = "keep"
+	// Mount represents an action that results in mounting something somewhere.
+	Mount Action = "mount"
+	// Unmount represents an action that results in unmounting something from somewhere.
+	Unmount Action = "unmount"
+)
+
+// Change describes a change to the mount table (action and the entry to act on).
+type Change struct {
+	Entry  Entry
+	Action Action
+}
+
+// String formats mount change to a human-readable line.
+func (c Change) String() string {
+	return fmt.Sprintf("%s (%s)", c.Action, c.Entry)
+}
+
+// umountNoFollow is UMOUNT_NOFOLLOW, missing from the syscall package.
+const umountNoFollow = 0x8
+
+// systemCalls contains the system calls used to change the mount namespace.
+type systemCalls interface {
+	Mount(source, target, fstype string, flags uintptr, data string) error
+	Unmount(target string, flags int) error
+	MkdirAll(path string, perm os.FileMode) error
+	CreateFile(path string, perm os.FileMode) error
+	Symlink(oldname, newname string) error
+	Remove(name string) error
+}
+
+type realSystemCalls struct{}
+
+func (realSystemCalls) Mount(source, target, fstype string, flags uintptr, data string) error {
+	return syscall.Mount(source, target, fstype, flags, data)
+}
+
+func (realSystemCalls) Unmount(target string, flags int) error {
+	return syscall.Unmount(target, flags)
+}
+
+func (realSystemCalls) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (realSystemCalls) CreateFile(path string, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (realSystemCalls) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (realSystemCalls) Remove(name string) error {
+	return os.Remove(name)
+}
+
+var sys systemCalls = realSystemCalls{}
+
+// Perform executes the desired mount or unmount change using system calls.
+func (c *Change) Perform() error {
+	switch c.Action {
+	case Mount:
+		return mountEntry(&c.Entry)
+	case Unmount:
+		return unmountEntry(&c.Entry)
+	case Keep:
+		return nil
+	}
+	return fmt.Errorf("cannot process mount change, unknown action: %q", c.Action)
+}
+
+// Undo reverts the effect of a change that was performed before.
+func (c *Change) Undo() error {
+	switch c.Action {
+	case Mount:
+		return unmountEntry(&c.Entry)
+	case Unmount:
+		return mountEntry(&c.Entry)
+	case Keep:
+		return nil
+	}
+	return fmt.Errorf("cannot undo mount change, unknown action: %q", c.Action)
+}
+
+func mountEntry(e *Entry) error {
+	switch XSnapdKind(e) {
+	case "symlink":
+		if err := sys.MkdirAll(filepath.Dir(e.Dir), 0755); err != nil {
+			return err
+		}
+		return sys.Symlink(XSnapdSymlinkTarget(e), e.Dir)
+	case "file":
+		if err := sys.MkdirAll(filepath.Dir(e.Dir), 0755); err != nil {
+			return err
+		}
+		if err := sys.CreateFile(e.Dir, 0644); err != nil {
+			return err
+		}
+	default:
+		if err := sys.MkdirAll(e.Dir, 0755); err != nil {
+			return err
+		}
+	}
+	flags, data := OptsToFlags(e.Options)
+	fsType := e.Type
+	if fsType == "" {
+		fsType = "none"
+	}
+	if err := sys.Mount(e.Name, e.Dir, fsType, flags, data); err != nil {
+		return err
+	}
+	// The kernel ignores the read-only flag when creating a bind mount, it
+	// can only be applied by remounting the new bind mount.
+	if flags&syscall.MS_BIND != 0 && flags&syscall.MS_RDONLY != 0 {
+		remountFlags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY)
+		if err := sys.Mount("none", e.Dir, "", remountFlags, ""); err != nil {
+			sys.Unmount(e.Dir, umountNoFollow)
+			return err
+		}
+	}
+	return nil
+}
+
+func unmountEntry(e *Entry) error {
+	if XSnapdKind(e) == "symlink" {
+		return sys.Remove(e.Dir)
+	}
+	flags := umountNoFollow
+	for _, opt := range e.Options {
+		// Recursive bind mounts may carry other mounts along, detach them
+		// all at once.
+		if opt == "rbind" {
+			flags |= syscall.MNT_DETACH
+		}
+	}
+	return sys.Unmount(e.Dir, flags)
+}
+
+// byMagicDir allows sorting an array of entries that automagically assumes
+// each entry ends with a trailing slash.
+type byMagicDir []Entry
+
+func (c byMagicDir) Len() int      { return len(c) }
+func (c byMagicDir) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byMagicDir) Less(i, j int) bool {
+	iDir := c[i].Dir
+	jDir := c[j].Dir
+	if !strings.HasSuffix(iDir, "/") {
+		iDir = iDir + "/"
+	}
+	if !strings.HasSuffix(jDir, "/") {
+		jDir = jDir + "/"
+	}
+	return iDir < jDir
+}
+
+// NeededChanges computes the changes required to change current to desired mount entries.
+//
+// The current and desired profiles is a fstab like list of mount entries. The
+// lists are processed and a "diff" of mount changes is produced. The mount
+// changes, when applied in order, transform the current profile into the
+// desired profile.
+//
+// Entries that are nested in an entry that is unmounted or mounted, including
+// a new one that would shadow them, are unmounted and mounted again as well,
+// unmounting always happens from the innermost entry
+// outwards and mounting from the outermost entry inwards.
+func NeededChanges(currentProfile, desiredProfile *Profile) []*Change {
+	// Copy both profiles as we will want to mutate them.
+	current := make([]Entry, len(currentProfile.Entries))
+	copy(current, currentProfile.Entries)
+	desired := make([]Entry, len(desiredProfile.Entries))
+	copy(desired, desiredProfile.Entries)
+
+	// Clean the directory part of both profiles. This is done so that we can
+	// easily test if a given directory is a subdirectory with
+	// strings.HasPrefix coupled with an extra slash character.
+	for i := range current {
+		current[i].Dir = path.Clean(current[i].Dir)
+	}
+	for i := range desired {
+		desired[i].Dir = path.Clean(desired[i].Dir)
+	}
+
+	// Sort both lists by directory name with implicit trailing slash.
+	sort.Stable(byMagicDir(current))
+	sort.Stable(byMagicDir(desired))
+
+	// Construct a desired directory map.
+	desiredMap := make(map[string]*Entry)
+	for i := range desired {
+		desiredMap[desired[i].Dir] = &desired[i]
+	}
+
+	// Construct a current directory map.
+	currentMap := make(map[string]*Entry)
+	for i := range current {
+		currentMap[current[i].Dir] = &current[i]
+	}
+
+	// Compute the directories where something is unmounted or mounted. This
+	// includes new mounts, as they would shadow the entries nested in them.
+	var changedDirs []string
+	for i := range current {
+		if entry, ok := desiredMap[current[i].Dir]; !ok || !current[i].Equal(entry) {
+			changedDirs = append(changedDirs, current[i].Dir)
+		}
+	}
+	for i := range desired {
+		if entry, ok := currentMap[desired[i].Dir]; !ok || !desired[i].Equal(entry) {
+			changedDirs = append(changedDirs, desired[i].Dir)
+		}
+	}
+
+	// Compute reusable entries: those which are equal in current and desired and which
+	// are not nested in a directory that changed.
+	reuse := make(map[string]bool)
+	for i := range current {
+		dir := current[i].Dir
+		if entry, ok := desiredMap[dir]; ok && current[i].Equal(entry) && !isNestedInAny(dir, changedDirs) {
+			reuse[dir] = true
+		}
+	}
+
+	// We are now ready to compute the necessary mount changes.
+	var changes []*Change
+
+	// Unmount entries not reused in reverse to handle children before their parent.
+	for i := len(current) - 1; i >= 0; i-- {
+		if reuse[current[i].Dir] {
+			changes = append(changes, &Change{Action: Keep, Entry: current[i]})
+		} else {
+			changes = append(changes, &Change{Action: Unmount, Entry: current[i]})
+		}
+	}
+
+	// Mount desired entries not reused.
+	for i := range desired {
+		if !reuse[desired[i].Dir] {
+			changes = append(changes, &Change{Action: Mount, Entry: desired[i]})
+		}
+	}
+
+	return changes
+}
+
+// isNestedInAny returns true if the given directory is nested in any of the
+// given parent directories.
+func isNestedInAny(dir string, parents []string) bool {
+	for _, parent := range parents {
+		if strings.HasPrefix(dir, strings.TrimSuffix(parent, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyChanges performs the given changes in order.
+//
+// When a change fails, the changes performed so far are undone in reverse
+// order so that the mount namespace is left as it was, and the error of the
+// failed change is returned.
+func ApplyChanges(changes []*Change) error {
+	for i, change := range changes {
+		err := change.Perform()
+		if err == nil {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if undoErr := changes[j].Undo(); undoErr != nil {
+				logger.Noticef("cannot undo %s: %s", changes[j], undoErr)
+			}
+		}
+		return fmt.Errorf("cannot %s: %s", change, err)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/mount"
+)
+
+// fakeSystem records system calls and fails those it is told to.
+type fakeSystem struct {
+	calls []string
+	fail  map[string]error
+}
+
+func (sys *fakeSystem) call(format string, args ...interface{}) error {
+	call := fmt.Sprintf(format, args...)
+	sys.calls = append(sys.calls, call)
+	return sys.fail[call]
+}
+
+func (sys *fakeSystem) Mount(source, target, fstype string, flags uintptr, data string) error {
+	return sys.call("mount %q %q %q %d %q", source, target, fstype, flags, data)
+}
+
+func (sys *fakeSystem) Unmount(target string, flags int) error {
+	return sys.call("unmount %q %d", target, flags)
+}
+
+func (sys *fakeSystem) MkdirAll(path string, perm os.FileMode) error {
+	return sys.call("mkdir-all %q %#o", path, perm)
+}
+
+func (sys *fakeSystem) CreateFile(path string, perm os.FileMode) error {
+	return sys.call("create-file %q %#o", path, perm)
+}
+
+func (sys *fakeSystem) Symlink(oldname, newname string) error {
+	return sys.call("symlink %q %q", oldname, newname)
+}
+
+func (sys *fakeSystem) Remove(name string) error {
+	return sys.call("remove %q", name)
+}
+
+type changeSuite struct {
+	sys     *fakeSystem
+	restore func()
+}
+
+var _ = Suite(&changeSuite{})
+
+func (s *changeSuite) SetUpTest(c *C) {
+	s.sys = &fakeSystem{fail: make(map[string]error)}
+	s.restore = mount.MockSystemCalls(s.sys)
+}
+
+func (s *changeSuite) TearDownTest(c *C) {
+	s.restore()
+}
+
+func (s *changeSuite) TestString(c *C) {
+	change := mount.Change{
+		Entry:  mount.Entry{Dir: "/a/b", Name: "/dev/sda1"},
+		Action: mount.Mount,
+	}
+	c.Assert(change.String(), Equals, "mount (/dev/sda1 /a/b none defaults 0 0)")
+}
+
+// When there are no profiles we don't do anything.
+func (s *changeSuite) TestNeededChangesNoProfiles(c *C) {
+	current := &mount.Profile{}
+	desired := &mount.Profile{}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, IsNil)
+}
+
+// When the profiles are the same we don't do anything.
+func (s *changeSuite) TestNeededChangesNoChange(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{{Dir: "/common/stuf"}}}
+	desired := &mount.Profile{Entries: []mount.Entry{{Dir: "/common/stuf"}}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/stuf"}, Action: mount.Keep},
+	})
+}
+
+// When the content interface is connected we should mount the new entry.
+func (s *changeSuite) TestNeededChangesTrivialMount(c *C) {
+	current := &mount.Profile{}
+	desired := &mount.Profile{Entries: []mount.Entry{{Dir: "/common/stuf"}}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: desired.Entries[0], Action: mount.Mount},
+	})
+}
+
+// When the content interface is disconnected we should unmount the mounted entry.
+func (s *changeSuite) TestNeededChangesTrivialUnmount(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{{Dir: "/common/stuf"}}}
+	desired := &mount.Profile{}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: current.Entries[0], Action: mount.Unmount},
+	})
+}
+
+// When umounting we unmount children before parents.
+func (s *changeSuite) TestNeededChangesUnmountOrder(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/stuf"},
+	}}
+	desired := &mount.Profile{}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf"}, Action: mount.Unmount},
+	})
+}
+
+// When mounting we mount the parents before the children.
+func (s *changeSuite) TestNeededChangesMountOrder(c *C) {
+	current := &mount.Profile{}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/stuf"},
+	}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/stuf"}, Action: mount.Mount},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Mount},
+	})
+}
+
+// When parent changes we don't reuse its children
+func (s *changeSuite) TestNeededChangesChangedParentSameChild(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf", Name: "/dev/sda1"},
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/unrelated"},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf", Name: "/dev/sda2"},
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/unrelated"},
+	}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/unrelated"}, Action: mount.Keep},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf", Name: "/dev/sda1"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf", Name: "/dev/sda2"}, Action: mount.Mount},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Mount},
+	})
+}
+
+// When a new parent is mounted we don't reuse its children, they would be shadowed
+func (s *changeSuite) TestNeededChangesNewParentSameChild(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/unrelated"},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf"},
+		{Dir: "/common/stuf/extra"},
+		{Dir: "/common/unrelated"},
+	}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/unrelated"}, Action: mount.Keep},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf"}, Action: mount.Mount},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra"}, Action: mount.Mount},
+	})
+}
+
+// When child changes we don't touch the unchanged parent
+func (s *changeSuite) TestNeededChangesSameParentChangedChild(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf"},
+		{Dir: "/common/stuf/extra", Name: "/dev/sda1"},
+		{Dir: "/common/unrelated"},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf"},
+		{Dir: "/common/stuf/extra", Name: "/dev/sda2"},
+		{Dir: "/common/unrelated"},
+	}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/unrelated"}, Action: mount.Keep},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra", Name: "/dev/sda1"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf"}, Action: mount.Keep},
+		{Entry: mount.Entry{Dir: "/common/stuf/extra", Name: "/dev/sda2"}, Action: mount.Mount},
+	})
+}
+
+// Unused bind mount farms are unmounted.
+func (s *changeSuite) TestNeededChangesTmpfsBindMountFarmUnused(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Name: "tmpfs", Dir: "/snap/name/42/subdir", Type: "tmpfs"},
+		{Name: "/var/lib/snapd/hostfs/snap/name/42/subdir/existing", Dir: "/snap/name/42/subdir/existing", Options: []string{"bind", "ro"}},
+	}}
+	desired := &mount.Profile{}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: current.Entries[1], Action: mount.Unmount},
+		{Entry: current.Entries[0], Action: mount.Unmount},
+	})
+}
+
+// Sibling directories that share a prefix are not treated as nested.
+func (s *changeSuite) TestNeededChangesSiblingsWithCommonPrefix(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf", Name: "/dev/sda1"},
+		{Dir: "/common/stuf-extra"},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Dir: "/common/stuf", Name: "/dev/sda2"},
+		{Dir: "/common/stuf-extra"},
+	}}
+	changes := mount.NeededChanges(current, desired)
+	c.Assert(changes, DeepEquals, []*mount.Change{
+		{Entry: mount.Entry{Dir: "/common/stuf", Name: "/dev/sda1"}, Action: mount.Unmount},
+		{Entry: mount.Entry{Dir: "/common/stuf-extra"}, Action: mount.Keep},
+		{Entry: mount.Entry{Dir: "/common/stuf", Name: "/dev/sda2"}, Action: mount.Mount},
+	})
+}
+
+func (s *changeSuite) TestPerformMount(c *C) {
+	change := &mount.Change{Action: mount.Mount, Entry: mount.Entry{Name: "/source", Dir: "/target", Options: []string{"bind", "ro"}}}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`mkdir-all "/target" 0755`,
+		`mount "/source" "/target" "none" 4097 ""`,
+		`mount "none" "/target" "" 4129 ""`,
+	})
+}
+
+func (s *changeSuite) TestPerformMountReadOnlyRemountFails(c *C) {
+	s.sys.fail[`mount "none" "/target" "" 4129 ""`] = errors.New("testing")
+	change := &mount.Change{Action: mount.Mount, Entry: mount.Entry{Name: "/source", Dir: "/target", Options: []string{"bind", "ro"}}}
+	c.Assert(change.Perform(), ErrorMatches, "testing")
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`mkdir-all "/target" 0755`,
+		`mount "/source" "/target" "none" 4097 ""`,
+		`mount "none" "/target" "" 4129 ""`,
+		`unmount "/target" 8`,
+	})
+}
+
+func (s *changeSuite) TestPerformMountTmpfs(c *C) {
+	change := &mount.Change{Action: mount.Mount, Entry: mount.Entry{Name: "tmpfs", Dir: "/target", Type: "tmpfs", Options: []string{"mode=0755"}}}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`mkdir-all "/target" 0755`,
+		`mount "tmpfs" "/target" "tmpfs" 0 "mode=0755"`,
+	})
+}
+
+func (s *changeSuite) TestPerformMountFile(c *C) {
+	change := &mount.Change{Action: mount.Mount, Entry: mount.Entry{Name: "/source", Dir: "/etc/target.conf", Options: []string{"bind", "rw", mount.XSnapdKindFile}}}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`mkdir-all "/etc" 0755`,
+		`create-file "/etc/target.conf" 0644`,
+		`mount "/source" "/etc/target.conf" "none" 4096 ""`,
+	})
+}
+
+func (s *changeSuite) TestPerformSymlink(c *C) {
+	entry := mount.Entry{Dir: "/usr/lib/foo", Options: []string{mount.XSnapdKindSymlink, mount.XSnapdSymlink("/snap/foo/1/lib")}}
+	change := &mount.Change{Action: mount.Mount, Entry: entry}
+	c.Assert(change.Perform(), IsNil)
+	change = &mount.Change{Action: mount.Unmount, Entry: entry}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`mkdir-all "/usr/lib" 0755`,
+		`symlink "/snap/foo/1/lib" "/usr/lib/foo"`,
+		`remove "/usr/lib/foo"`,
+	})
+}
+
+func (s *changeSuite) TestPerformUnmount(c *C) {
+	change := &mount.Change{Action: mount.Unmount, Entry: mount.Entry{Name: "/source", Dir: "/target", Options: []string{"bind"}}}
+	c.Assert(change.Perform(), IsNil)
+	change = &mount.Change{Action: mount.Unmount, Entry: mount.Entry{Name: "/source", Dir: "/target", Options: []string{"rbind"}}}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`unmount "/target" 8`,
+		`unmount "/target" 10`,
+	})
+}
+
+func (s *changeSuite) TestPerformKeepAndUnknown(c *C) {
+	change := &mount.Change{Action: mount.Keep, Entry: mount.Entry{Dir: "/target"}}
+	c.Assert(change.Perform(), IsNil)
+	c.Assert(s.sys.calls, HasLen, 0)
+	change = &mount.Change{Action: "frobnicate", Entry: mount.Entry{Dir: "/target"}}
+	c.Assert(change.Perform(), ErrorMatches, `cannot process mount change, unknown action: "frobnicate"`)
+}
+
+func (s *changeSuite) TestApplyChanges(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Name: "/snap/producer/1/content", Dir: "/snap/consumer/1/content", Options: []string{"bind"}},
+		{Name: "/snap/other/1/stuff", Dir: "/snap/consumer/1/stuff", Options: []string{"bind"}},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Name: "/snap/other/1/stuff", Dir: "/snap/consumer/1/stuff", Options: []string{"bind"}},
+	}}
+	err := mount.ApplyChanges(mount.NeededChanges(current, desired))
+	c.Assert(err, IsNil)
+	// Disconnecting the content interface removes its bind mount.
+	c.Assert(s.sys.calls, DeepEquals, []string{
+		`unmount "/snap/consumer/1/content" 8`,
+	})
+}
+
+func (s *changeSuite) TestApplyChangesRollsBackOnFailure(c *C) {
+	current := &mount.Profile{Entries: []mount.Entry{
+		{Name: "/src-old", Dir: "/a", Options: []string{"bind"}},
+	}}
+	desired := &mount.Profile{Entries: []mount.Entry{
+		{Name: "/src-new", Dir: "/a", Options: []string{"bind"}},
+		{Name: "/src-b", Dir: "/b", Options: []string{"bind"}},
+	}}
+	s.sys.fail[`mount "/src-b" "/b" "none" 4096 ""`] = errors.New("testing")
+	err := mount.ApplyChanges(mount.NeededChanges(current, desired))
+	c.Assert(err, ErrorMatches, `cannot mount \(/src-b /b none bind 0 0\): testing`)
+	c.Assert(strings.Join(s.sys.calls, "\n"), Equals, strings.Join([]string{
+		// changes
+		`unmount "/a" 8`,
+		`mkdir-all "/a" 0755`,
+		`mount "/src-new" "/a" "none" 4096 ""`,
+		`mkdir-all "/b" 0755`,
+		`mount "/src-b" "/b" "none" 4096 ""`,
+		// rollback
+		`unmount "/a" 8`,
+		`mkdir-all "/a" 0755`,
+		`mount "/src-old" "/a" "none" 4096 ""`,
+	}, "\n"))
+}
@@ -21,7 +21,9 @@ package mount
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 // Entry describes an /etc/fstab-like mount entry.
@@ -46,6 +48,20 @@ type Entry struct {
 	CheckPassNumber int
 }
 
+const (
+	// XSnapdKindFile is the mount option used by entries that bind mount a
+	// single file rather than a directory.
+	XSnapdKindFile = "x-snapd.kind=file"
+	// XSnapdKindSymlink is the mount option used by entries that describe
+	// a symbolic link rather than a mount.
+	XSnapdKindSymlink = "x-snapd.kind=symlink"
+)
+
+// XSnapdSymlink returns the mount option that holds the target of a symbolic link.
+func XSnapdSymlink(oldname string) string {
+	return "x-snapd.symlink=" + oldname
+}
+
 // escape replaces whitespace characters so that getmntent can parse it correctly.
 //
 // According to the manual page, the following characters need to be escaped.
@@ -84,3 +100,145 @@ func (e Entry) String() string {
 	return fmt.Sprintf("%s %s %s %s %d %d",
 		name, dir, fsType, options, e.DumpFrequency, e.CheckPassNumber)
 }
+
+// Equal checks if one entry is equal to another
+func (e *Entry) Equal(o *Entry) bool {
+	return (e.Name == o.Name && e.Dir == o.Dir && e.Type == o.Type &&
+		equalStrings(e.Options, o.Options) && e.DumpFrequency == o.DumpFrequency &&
+		e.CheckPassNumber == o.CheckPassNumber)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// unescape replaces whitespace escapes with the characters they represent.
+//
+// Unknown escape sequences are left untouched.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				buf = append(buf, byte(n))
+				i += 3
+				continue
+			}
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+// ParseEntry parses a fstab-like line into an Entry structure.
+//
+// The dump frequency and the check pass number are optional and default to
+// zero, just like in /etc/fstab.
+func ParseEntry(s string) (Entry, error) {
+	var e Entry
+	var err error
+	fields := strings.Fields(s)
+	if len(fields) < 4 || len(fields) > 6 {
+		return e, fmt.Errorf("expected between 4 and 6 fields, found %d", len(fields))
+	}
+	e.Name = unescape(fields[0])
+	e.Dir = unescape(fields[1])
+	e.Type = unescape(fields[2])
+	e.Options = strings.Split(unescape(fields[3]), ",")
+	if len(fields) > 4 {
+		if e.DumpFrequency, err = strconv.Atoi(fields[4]); err != nil {
+			return e, fmt.Errorf("cannot parse dump frequency: %q", fields[4])
+		}
+	}
+	if len(fields) > 5 {
+		if e.CheckPassNumber, err = strconv.Atoi(fields[5]); err != nil {
+			return e, fmt.Errorf("cannot parse check pass number: %q", fields[5])
+		}
+	}
+	return e, nil
+}
+
+// optsToFlags contains mount options that map to flags of mount(2).
+var optsToFlags = map[string]uintptr{
+	"ro":          syscall.MS_RDONLY,
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"sync":        syscall.MS_SYNCHRONOUS,
+	"remount":     syscall.MS_REMOUNT,
+	"mand":        syscall.MS_MANDLOCK,
+	"dirsync":     syscall.MS_DIRSYNC,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"bind":        syscall.MS_BIND,
+	"rbind":       syscall.MS_BIND | syscall.MS_REC,
+	"move":        syscall.MS_MOVE,
+	"silent":      syscall.MS_SILENT,
+	"acl":         syscall.MS_POSIXACL,
+	"private":     syscall.MS_PRIVATE,
+	"rprivate":    syscall.MS_PRIVATE | syscall.MS_REC,
+	"slave":       syscall.MS_SLAVE,
+	"rslave":      syscall.MS_SLAVE | syscall.MS_REC,
+	"shared":      syscall.MS_SHARED,
+	"rshared":     syscall.MS_SHARED | syscall.MS_REC,
+	"unbindable":  syscall.MS_UNBINDABLE,
+	"runbindable": syscall.MS_UNBINDABLE | syscall.MS_REC,
+	"relatime":    syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// OptsToFlags converts mount options to the flags and the data of mount(2).
+//
+// Options that have no corresponding flag are returned as a comma separated
+// string suitable as data, except for "rw" and "defaults" which are implied
+// and for options internal to snapd, which start with "x-snapd.".
+func OptsToFlags(opts []string) (flags uintptr, data string) {
+	var unparsed []string
+	for _, opt := range opts {
+		if f, ok := optsToFlags[opt]; ok {
+			flags |= f
+			continue
+		}
+		switch {
+		case opt == "rw" || opt == "defaults":
+			// implied
+		case strings.HasPrefix(opt, "x-snapd."):
+			// internal to snapd
+		default:
+			unparsed = append(unparsed, opt)
+		}
+	}
+	return flags, strings.Join(unparsed, ",")
+}
+
+// XSnapdKind returns the kind of the file system object described by the
+// entry: "file", "symlink" or "" for directories.
+func XSnapdKind(e *Entry) string {
+	for _, opt := range e.Options {
+		if strings.HasPrefix(opt, "x-snapd.kind=") {
+			return strings.TrimPrefix(opt, "x-snapd.kind=")
+		}
+	}
+	return ""
+}
+
+// XSnapdSymlinkTarget returns the target of the symbolic link described by the entry.
+func XSnapdSymlinkTarget(e *Entry) string {
+	for _, opt := range e.Options {
+		if strings.HasPrefix(opt, "x-snapd.symlink=") {
+			return strings.TrimPrefix(opt, "x-snapd.symlink=")
+		}
+	}
+	return ""
+}
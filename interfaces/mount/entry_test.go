@@ -20,6 +20,8 @@
 package mount_test
 
 import (
+	"syscall"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/interfaces/mount"
@@ -54,3 +56,90 @@ func (s *entrySuite) TestString(c *C) {
 	}
 	c.Assert(ent3.String(), Equals, `/dev/sda5 /media/My\040Files ext4 rw,noatime 0 0`)
 }
+
+func (s *entrySuite) TestEqual(c *C) {
+	var a, b *mount.Entry
+	a = &mount.Entry{}
+	b = &mount.Entry{}
+	c.Assert(a.Equal(b), Equals, true)
+	a = &mount.Entry{Dir: "foo"}
+	b = &mount.Entry{Dir: "foo"}
+	c.Assert(a.Equal(b), Equals, true)
+	a = &mount.Entry{Options: []string{"ro"}}
+	b = &mount.Entry{Options: []string{"ro"}}
+	c.Assert(a.Equal(b), Equals, true)
+	a = &mount.Entry{Dir: "foo"}
+	b = &mount.Entry{Dir: "bar"}
+	c.Assert(a.Equal(b), Equals, false)
+	a = &mount.Entry{}
+	b = &mount.Entry{Options: []string{"ro"}}
+	c.Assert(a.Equal(b), Equals, false)
+	a = &mount.Entry{Options: []string{"ro"}}
+	b = &mount.Entry{Options: []string{"rw"}}
+	c.Assert(a.Equal(b), Equals, false)
+}
+
+func (s *entrySuite) TestParseEntry(c *C) {
+	e, err := mount.ParseEntry("/var/snap/foo/common /var/snap/bar/common none bind,ro 0 0")
+	c.Assert(err, IsNil)
+	c.Check(e, DeepEquals, mount.Entry{
+		Name:    "/var/snap/foo/common",
+		Dir:     "/var/snap/bar/common",
+		Type:    "none",
+		Options: []string{"bind", "ro"},
+	})
+
+	// The frequency and the pass number are optional.
+	e, err = mount.ParseEntry("/dev/sda5 /media/foo ext4 rw,noatime")
+	c.Assert(err, IsNil)
+	c.Check(e.DumpFrequency, Equals, 0)
+	c.Check(e.CheckPassNumber, Equals, 0)
+	e, err = mount.ParseEntry("/dev/sda5 /media/foo ext4 defaults 1 2")
+	c.Assert(err, IsNil)
+	c.Check(e.DumpFrequency, Equals, 1)
+	c.Check(e.CheckPassNumber, Equals, 2)
+
+	// Escaped whitespace is restored.
+	e, err = mount.ParseEntry(`/dev/sda5 /media/My\040Files\011and\134more ext4 rw 0 0`)
+	c.Assert(err, IsNil)
+	c.Check(e.Dir, Equals, "/media/My Files\tand\\more")
+
+	// Parsing round-trips with String.
+	ent := mount.Entry{Name: "/a b", Dir: "/c", Type: "none", Options: []string{"bind"}}
+	e, err = mount.ParseEntry(ent.String())
+	c.Assert(err, IsNil)
+	c.Check(e, DeepEquals, ent)
+
+	// Malformed entries.
+	_, err = mount.ParseEntry("too few fields")
+	c.Check(err, ErrorMatches, "expected between 4 and 6 fields, found 3")
+	_, err = mount.ParseEntry("a b c d e f g")
+	c.Check(err, ErrorMatches, "expected between 4 and 6 fields, found 7")
+	_, err = mount.ParseEntry("a b c d e")
+	c.Check(err, ErrorMatches, `cannot parse dump frequency: "e"`)
+	_, err = mount.ParseEntry("a b c d 0 f")
+	c.Check(err, ErrorMatches, `cannot parse check pass number: "f"`)
+}
+
+func (s *entrySuite) TestOptsToFlags(c *C) {
+	flags, data := mount.OptsToFlags([]string{"bind", "ro"})
+	c.Check(flags, Equals, uintptr(syscall.MS_BIND|syscall.MS_RDONLY))
+	c.Check(data, Equals, "")
+	flags, data = mount.OptsToFlags([]string{"rbind", "rw"})
+	c.Check(flags, Equals, uintptr(syscall.MS_BIND|syscall.MS_REC))
+	c.Check(data, Equals, "")
+	flags, data = mount.OptsToFlags([]string{"defaults", "nodev", "mode=0755", "size=10m", mount.XSnapdKindFile})
+	c.Check(flags, Equals, uintptr(syscall.MS_NODEV))
+	c.Check(data, Equals, "mode=0755,size=10m")
+}
+
+func (s *entrySuite) TestXSnapdOptions(c *C) {
+	e := &mount.Entry{Options: []string{"bind"}}
+	c.Check(mount.XSnapdKind(e), Equals, "")
+	c.Check(mount.XSnapdSymlinkTarget(e), Equals, "")
+	e = &mount.Entry{Options: []string{"bind", mount.XSnapdKindFile}}
+	c.Check(mount.XSnapdKind(e), Equals, "file")
+	e = &mount.Entry{Options: []string{mount.XSnapdKindSymlink, mount.XSnapdSymlink("/snap/foo/1/bar")}}
+	c.Check(mount.XSnapdKind(e), Equals, "symlink")
+	c.Check(mount.XSnapdSymlinkTarget(e), Equals, "/snap/foo/1/bar")
+}
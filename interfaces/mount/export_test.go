@@ -0,0 +1,48 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount
+
+import (
+	"os"
+)
+
+// SystemCalls contains the system calls used to change the mount namespace.
+type SystemCalls interface {
+	Mount(source, target, fstype string, flags uintptr, data string) error
+	Unmount(target string, flags int) error
+	MkdirAll(path string, perm os.FileMode) error
+	CreateFile(path string, perm os.FileMode) error
+	Symlink(oldname, newname string) error
+	Remove(name string) error
+}
+
+// MockSystemCalls replaces the system calls used to change the mount namespace.
+func MockSystemCalls(sc SystemCalls) (restore func()) {
+	old := sys
+	sys = sc
+	return func() { sys = old }
+}
+
+// MockMountInfoPath replaces the path of the mountinfo file.
+func MockMountInfoPath(path string) (restore func()) {
+	old := mountInfoPath
+	mountInfoPath = path
+	return func() { mountInfoPath = old }
+}
@@ -0,0 +1,123 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/mount"
+)
+
+type mountinfoSuite struct{}
+
+var _ = Suite(&mountinfoSuite{})
+
+// Check that parsing the example from kernel documentation works correctly.
+func (s *mountinfoSuite) TestParseInfoEntry1(c *C) {
+	real := "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue"
+	e, err := mount.ParseInfoEntry(real)
+	c.Assert(err, IsNil)
+	c.Assert(e.MountID, Equals, 36)
+	c.Assert(e.ParentID, Equals, 35)
+	c.Assert(e.DevMajor, Equals, 98)
+	c.Assert(e.DevMinor, Equals, 0)
+	c.Assert(e.Root, Equals, "/mnt1")
+	c.Assert(e.MountDir, Equals, "/mnt2")
+	c.Assert(e.MountOptions, DeepEquals, map[string]string{"rw": "", "noatime": ""})
+	c.Assert(e.OptionalFields, DeepEquals, []string{"master:1"})
+	c.Assert(e.FsType, Equals, "ext3")
+	c.Assert(e.MountSource, Equals, "/dev/root")
+	c.Assert(e.SuperOptions, DeepEquals, map[string]string{"rw": "", "errors": "continue"})
+}
+
+// Check that various combinations of optional fields are parsed correctly.
+func (s *mountinfoSuite) TestParseInfoEntry2(c *C) {
+	// No optional fields.
+	e, err := mount.ParseInfoEntry("36 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw,errors=continue")
+	c.Assert(err, IsNil)
+	c.Assert(e.MountOptions, DeepEquals, map[string]string{"rw": "", "noatime": ""})
+	c.Assert(e.OptionalFields, HasLen, 0)
+	c.Assert(e.FsType, Equals, "ext3")
+	// One optional field.
+	e, err = mount.ParseInfoEntry("36 35 98:0 /mnt1 /mnt2 rw,noatime shared:1 - ext3 /dev/root rw,errors=continue")
+	c.Assert(err, IsNil)
+	c.Assert(e.OptionalFields, DeepEquals, []string{"shared:1"})
+	// Two optional fields.
+	e, err = mount.ParseInfoEntry("36 35 98:0 /mnt1 /mnt2 rw,noatime shared:1 master:2 - ext3 /dev/root rw,errors=continue")
+	c.Assert(err, IsNil)
+	c.Assert(e.OptionalFields, DeepEquals, []string{"shared:1", "master:2"})
+	c.Assert(e.FsType, Equals, "ext3")
+	c.Assert(e.MountSource, Equals, "/dev/root")
+}
+
+// Check that white-space is unescaped correctly.
+func (s *mountinfoSuite) TestParseInfoEntry3(c *C) {
+	real := `36 35 98:0 /mnt\0401 /mnt\0402 rw,noatime master:1 - ext\0403 /dev/ro\040ot rw,errors=continue`
+	e, err := mount.ParseInfoEntry(real)
+	c.Assert(err, IsNil)
+	c.Assert(e.Root, Equals, "/mnt 1")
+	c.Assert(e.MountDir, Equals, "/mnt 2")
+	c.Assert(e.FsType, Equals, "ext 3")
+	c.Assert(e.MountSource, Equals, "/dev/ro ot")
+}
+
+// Check that various malformed entries are detected.
+func (s *mountinfoSuite) TestParseInfoEntryBroken(c *C) {
+	for _, t := range []struct {
+		line string
+		err  string
+	}{
+		{"36 35 98:0 /mnt1 /mnt2", "incorrect number of fields, expected at least 10 but found 5"},
+		{"x 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw", `cannot parse mount ID: "x"`},
+		{"36 x 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw", `cannot parse parent mount ID: "x"`},
+		{"36 35 98 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw", `cannot parse device major:minor number pair: "98"`},
+		{"36 35 x:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw", `cannot parse device major number: "x"`},
+		{"36 35 98:x /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw", `cannot parse device minor number: "x"`},
+		{"36 35 98:0 /mnt1 /mnt2 rw,noatime shared:1 ext3 /dev/root rw", "list of optional fields is not terminated properly"},
+		{"36 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw extra", "incorrect number of tail fields, expected 3 but found 4"},
+	} {
+		_, err := mount.ParseInfoEntry(t.line)
+		c.Check(err, ErrorMatches, t.err, Commentf("line: %q", t.line))
+	}
+}
+
+// Check that a whole mountinfo file can be loaded.
+func (s *mountinfoSuite) TestLoadMountInfo(c *C) {
+	fname := filepath.Join(c.MkDir(), "mountinfo")
+	err := ioutil.WriteFile(fname, []byte(""+
+		"19 25 0:18 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw\n"+
+		"\n"+
+		"20 25 0:4 / /proc rw,nosuid,nodev,noexec,relatime shared:13 - proc proc rw\n"), 0644)
+	c.Assert(err, IsNil)
+	entries, err := mount.LoadMountInfo(fname)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Check(entries[0].MountDir, Equals, "/sys")
+	c.Check(entries[1].MountDir, Equals, "/proc")
+
+	_, err = mount.ReadMountInfo(strings.NewReader("garbage\n"))
+	c.Check(err, ErrorMatches, "incorrect number of fields, expected at least 10 but found 1")
+	_, err = mount.LoadMountInfo(filepath.Join(c.MkDir(), "missing"))
+	c.Check(err, ErrorMatches, ".*no such file or directory")
+}
@@ -0,0 +1,154 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+)
+
+var mountInfoPath = "/proc/self/mountinfo"
+
+// DesiredProfilePath returns the path of the mount profile that the mount
+// namespace of a given snap should reflect.
+func DesiredProfilePath(snapName string) string {
+	return filepath.Join(dirs.SnapMountPolicyDir, fmt.Sprintf("snap.%s.fstab", snapName))
+}
+
+// CurrentProfilePath returns the path of the mount profile that was applied
+// to the mount namespace of a given snap.
+func CurrentProfilePath(snapName string) string {
+	return filepath.Join(dirs.SnapRunNsDir, fmt.Sprintf("snap.%s.fstab", snapName))
+}
+
+// mountNsPath returns path of the mount namespace file of a given snap.
+func mountNsPath(snapName string) string {
+	// NOTE: This value has to be synchronized with snap-confine
+	return filepath.Join(dirs.SnapRunNsDir, fmt.Sprintf("%s.mnt", snapName))
+}
+
+// runNamespaceTool runs an internal tool on the preserved mount namespace of
+// a given snap, if one exists.
+func runNamespaceTool(toolName, snapName string) ([]byte, error) {
+	if !osutil.FileExists(mountNsPath(snapName)) {
+		return nil, nil
+	}
+	toolPath := filepath.Join(dirs.DistroLibExecDir, toolName)
+	return exec.Command(toolPath, snapName).CombinedOutput()
+}
+
+// DiscardSnapNamespace discards the preserved mount namespace of a given
+// snap, along with the mount profile that was applied to it.
+func DiscardSnapNamespace(snapName string) error {
+	output, err := runNamespaceTool("snap-discard-ns", snapName)
+	if err != nil {
+		return fmt.Errorf("cannot discard preserved namespace of snap %q: %s", snapName, osutil.OutputErr(output, err))
+	}
+	if err := os.Remove(CurrentProfilePath(snapName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove current mount profile of snap %q: %s", snapName, err)
+	}
+	return nil
+}
+
+// UpdateSnapNamespace applies the desired mount profile of a given snap to
+// its preserved mount namespace, if one exists, with snap-update-ns.
+func UpdateSnapNamespace(snapName string) error {
+	output, err := runNamespaceTool("snap-update-ns", snapName)
+	if err != nil {
+		return fmt.Errorf("cannot update preserved namespace of snap %q: %s", snapName, osutil.OutputErr(output, err))
+	}
+	return nil
+}
+
+// recordCurrentProfile records the desired mount profile of a given snap as
+// the profile applied to its preserved mount namespace, unless one was
+// recorded already.
+//
+// snap-confine populates the namespace from the desired profile but does not
+// record it. This must be called before the desired profile is replaced.
+func recordCurrentProfile(snapName string) error {
+	if !osutil.FileExists(mountNsPath(snapName)) || osutil.FileExists(CurrentProfilePath(snapName)) {
+		return nil
+	}
+	profile, err := LoadProfile(DesiredProfilePath(snapName))
+	if err != nil {
+		return fmt.Errorf("cannot load desired mount profile of snap %q: %s", snapName, err)
+	}
+	return profile.Save(CurrentProfilePath(snapName))
+}
+
+// UpdateNamespace brings the mount namespace of a given snap in line with the
+// desired mount profile of that snap.
+//
+// The changes since the profile applied last time are computed and applied
+// so that, for example, disconnecting a content interface removes the bind
+// mount it contributed. On failure all the changes are rolled back and the
+// applied profile stays as it was.
+//
+// NOTE: This must be called from within the mount namespace of the snap, it
+// is used by snap-update-ns after joining it.
+func UpdateNamespace(snapName string) error {
+	desired, err := LoadProfile(DesiredProfilePath(snapName))
+	if err != nil {
+		return fmt.Errorf("cannot load desired mount profile of snap %q: %s", snapName, err)
+	}
+	current, err := LoadProfile(CurrentProfilePath(snapName))
+	if err != nil {
+		return fmt.Errorf("cannot load current mount profile of snap %q: %s", snapName, err)
+	}
+	mounted, err := LoadMountInfo(mountInfoPath)
+	if err != nil {
+		return fmt.Errorf("cannot load mount information: %s", err)
+	}
+	// Entries that are no longer mounted, for example because they were
+	// unmounted by something else, cannot be unmounted again.
+	current = stillMounted(current, mounted)
+
+	changes := NeededChanges(current, desired)
+	if err := ApplyChanges(changes); err != nil {
+		return fmt.Errorf("cannot update mount namespace of snap %q: %s", snapName, err)
+	}
+	if err := os.MkdirAll(dirs.SnapRunNsDir, 0755); err != nil {
+		return err
+	}
+	return desired.Save(CurrentProfilePath(snapName))
+}
+
+// stillMounted returns the profile without the entries that are not mounted.
+//
+// Symbolic links are not mounted and are always kept.
+func stillMounted(p *Profile, mounted []*InfoEntry) *Profile {
+	mountDirs := make(map[string]bool, len(mounted))
+	for _, info := range mounted {
+		mountDirs[info.MountDir] = true
+	}
+	var result Profile
+	for _, e := range p.Entries {
+		if XSnapdKind(&e) == "symlink" || mountDirs[filepath.Clean(e.Dir)] {
+			result.Entries = append(result.Entries, e)
+		}
+	}
+	return &result
+}
@@ -0,0 +1,123 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/mount"
+)
+
+type nsSuite struct {
+	sys       *fakeSystem
+	mountInfo string
+	restore   []func()
+}
+
+var _ = Suite(&nsSuite{})
+
+func (s *nsSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.sys = &fakeSystem{fail: make(map[string]error)}
+	s.mountInfo = filepath.Join(c.MkDir(), "mountinfo")
+	s.restore = []func(){
+		mount.MockSystemCalls(s.sys),
+		mount.MockMountInfoPath(s.mountInfo),
+	}
+	c.Assert(os.MkdirAll(dirs.SnapMountPolicyDir, 0755), IsNil)
+	c.Assert(os.MkdirAll(dirs.SnapRunNsDir, 0755), IsNil)
+}
+
+func (s *nsSuite) TearDownTest(c *C) {
+	for _, restore := range s.restore {
+		restore()
+	}
+	dirs.SetRootDir("")
+}
+
+func (s *nsSuite) TestProfilePaths(c *C) {
+	c.Check(mount.DesiredProfilePath("foo"), Equals, filepath.Join(dirs.SnapMountPolicyDir, "snap.foo.fstab"))
+	c.Check(mount.CurrentProfilePath("foo"), Equals, filepath.Join(dirs.SnapRunNsDir, "snap.foo.fstab"))
+}
+
+func (s *nsSuite) TestUpdateNamespace(c *C) {
+	// The content interface was connected and its bind mount is in place,
+	// along with another mount that is now gone.
+	err := ioutil.WriteFile(mount.CurrentProfilePath("consumer"), []byte(""+
+		"/snap/producer/1/content /snap/consumer/1/content none bind,ro 0 0\n"+
+		"/snap/other/1/gone /snap/consumer/1/gone none bind,ro 0 0\n"), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(s.mountInfo, []byte(""+
+		"1 0 8:1 / / rw - ext4 /dev/sda1 rw\n"+
+		"2 1 7:1 /content /snap/consumer/1/content ro - squashfs /dev/loop1 ro\n"), 0644)
+	c.Assert(err, IsNil)
+	// It was now disconnected and something else was connected.
+	err = ioutil.WriteFile(mount.DesiredProfilePath("consumer"), []byte(""+
+		"/snap/other/1/stuff /snap/consumer/1/stuff none bind,ro 0 0\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = mount.UpdateNamespace("consumer")
+	c.Assert(err, IsNil)
+	c.Check(s.sys.calls, DeepEquals, []string{
+		`unmount "/snap/consumer/1/content" 8`,
+		`mkdir-all "/snap/consumer/1/stuff" 0755`,
+		`mount "/snap/other/1/stuff" "/snap/consumer/1/stuff" "none" 4097 ""`,
+		`mount "none" "/snap/consumer/1/stuff" "" 4129 ""`,
+	})
+
+	// The applied profile is saved.
+	data, err := ioutil.ReadFile(mount.CurrentProfilePath("consumer"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "/snap/other/1/stuff /snap/consumer/1/stuff none bind,ro 0 0\n")
+}
+
+func (s *nsSuite) TestUpdateNamespaceFailure(c *C) {
+	current := "/snap/producer/1/content /snap/consumer/1/content none bind,ro 0 0\n"
+	err := ioutil.WriteFile(mount.CurrentProfilePath("consumer"), []byte(current), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(s.mountInfo, []byte(""+
+		"2 1 7:1 /content /snap/consumer/1/content ro - squashfs /dev/loop1 ro\n"), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(mount.DesiredProfilePath("consumer"), nil, 0644)
+	c.Assert(err, IsNil)
+	s.sys.fail[`unmount "/snap/consumer/1/content" 8`] = errors.New("device or resource busy")
+
+	err = mount.UpdateNamespace("consumer")
+	c.Assert(err, ErrorMatches, `cannot update mount namespace of snap "consumer": cannot unmount \(/snap/producer/1/content /snap/consumer/1/content none bind,ro 0 0\): device or resource busy`)
+
+	// The applied profile is unchanged.
+	data, err := ioutil.ReadFile(mount.CurrentProfilePath("consumer"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, current)
+}
+
+func (s *nsSuite) TestUpdateNamespaceBrokenProfile(c *C) {
+	err := ioutil.WriteFile(mount.DesiredProfilePath("consumer"), []byte("garbage\n"), 0644)
+	c.Assert(err, IsNil)
+	err = mount.UpdateNamespace("consumer")
+	c.Assert(err, ErrorMatches, `cannot load desired mount profile of snap "consumer": cannot parse mount entry "garbage": .*`)
+	c.Check(s.sys.calls, HasLen, 0)
+}
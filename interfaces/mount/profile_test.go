@@ -0,0 +1,118 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mount_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/mount"
+)
+
+type profileSuite struct{}
+
+var _ = Suite(&profileSuite{})
+
+// Test that loading a profile from inexisting file returns an empty profile.
+func (s *profileSuite) TestLoadProfile1(c *C) {
+	dir := c.MkDir()
+	p, err := mount.LoadProfile(filepath.Join(dir, "missing"))
+	c.Assert(err, IsNil)
+	c.Assert(p.Entries, HasLen, 0)
+}
+
+// Test that loading profile from a file works as expected.
+func (s *profileSuite) TestLoadProfile2(c *C) {
+	dir := c.MkDir()
+	fname := filepath.Join(dir, "existing")
+	err := ioutil.WriteFile(fname, []byte("name-1 dir-1 type-1 options-1 1 1 # 1st entry\nname-2 dir-2 type-2 options-2 2 2 # 2nd entry\n"), 0644)
+	c.Assert(err, IsNil)
+	p, err := mount.LoadProfile(fname)
+	c.Assert(err, IsNil)
+	c.Assert(p.Entries, DeepEquals, []mount.Entry{
+		{Name: "name-1", Dir: "dir-1", Type: "type-1", Options: []string{"options-1"}, DumpFrequency: 1, CheckPassNumber: 1},
+		{Name: "name-2", Dir: "dir-2", Type: "type-2", Options: []string{"options-2"}, DumpFrequency: 2, CheckPassNumber: 2},
+	})
+}
+
+// Test that saving a profile to a file works correctly.
+func (s *profileSuite) TestSaveProfile1(c *C) {
+	dir := c.MkDir()
+	fname := filepath.Join(dir, "profile")
+	p := &mount.Profile{
+		Entries: []mount.Entry{
+			{Name: "name-1", Dir: "dir-1", Type: "type-1", Options: []string{"options-1"}, DumpFrequency: 1, CheckPassNumber: 1},
+		},
+	}
+	err := p.Save(fname)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadFile(fname)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "name-1 dir-1 type-1 options-1 1 1\n")
+}
+
+// Test that empty profile reads as empty.
+func (s *profileSuite) TestReadProfile1(c *C) {
+	p, err := mount.ReadProfile(strings.NewReader(""))
+	c.Assert(err, IsNil)
+	c.Assert(p.Entries, HasLen, 0)
+}
+
+// Test that comments and blank lines are ignored.
+func (s *profileSuite) TestReadProfile2(c *C) {
+	p, err := mount.ReadProfile(strings.NewReader(`
+	# comment
+
+	# comment followed by an entry
+	/src /dst none bind 0 0
+	`))
+	c.Assert(err, IsNil)
+	c.Assert(p.Entries, DeepEquals, []mount.Entry{
+		{Name: "/src", Dir: "/dst", Type: "none", Options: []string{"bind"}},
+	})
+}
+
+// Test that malformed entries are reported.
+func (s *profileSuite) TestReadProfile3(c *C) {
+	_, err := mount.ReadProfile(strings.NewReader("/src /dst\n"))
+	c.Assert(err, ErrorMatches, `cannot parse mount entry "/src /dst": expected between 4 and 6 fields, found 2`)
+}
+
+// Test that writing a profile and reading it back gives the same result.
+func (s *profileSuite) TestWriteTo(c *C) {
+	p := &mount.Profile{
+		Entries: []mount.Entry{
+			{Name: "/src with space", Dir: "/dst", Type: "none", Options: []string{"bind", "ro"}},
+			{Name: "tmpfs", Dir: "/tmp", Type: "tmpfs", Options: []string{"defaults"}},
+		},
+	}
+	var buf bytes.Buffer
+	n, err := p.WriteTo(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(buf.Len()))
+	c.Assert(buf.String(), Equals, "/src\\040with\\040space /dst none bind,ro 0 0\ntmpfs /tmp tmpfs defaults 0 0\n")
+	p2, err := mount.ReadProfile(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(p2, DeepEquals, p)
+}
@@ -20,7 +20,10 @@
 package mount
 
 import (
+	"sort"
+
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/snap"
 )
 
 // Specification assists in collecting mount entries associated with an interface.
@@ -29,7 +32,8 @@ import (
 // holds internal state that is used by the mount backend during the interface
 // setup process.
 type Specification struct {
-	mountEntries []Entry
+	layoutMountEntries []Entry
+	mountEntries       []Entry
 }
 
 // AddMountEntry adds a new mount entry.
@@ -38,10 +42,47 @@ func (spec *Specification) AddMountEntry(e Entry) error {
 	return nil
 }
 
+// AddSnapLayout adds mount entries based on the layout of the snap.
+//
+// Layout entries are sorted by their mount point and come before all the
+// entries added by interfaces.
+func (spec *Specification) AddSnapLayout(si *snap.Info) {
+	paths := make([]string, 0, len(si.Layout))
+	for path := range si.Layout {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		spec.layoutMountEntries = append(spec.layoutMountEntries, layoutMountEntry(si.Layout[path]))
+	}
+}
+
+// layoutMountEntry returns the mount entry corresponding to a layout element.
+func layoutMountEntry(l *snap.Layout) Entry {
+	entry := Entry{Dir: l.Path}
+	switch {
+	case l.Bind != "":
+		entry.Name = l.Snap.ExpandSnapVariables(l.Bind)
+		entry.Options = []string{"rbind", "rw"}
+	case l.BindFile != "":
+		entry.Name = l.Snap.ExpandSnapVariables(l.BindFile)
+		entry.Options = []string{"bind", "rw", XSnapdKindFile}
+	case l.Type != "":
+		entry.Name = l.Type
+		entry.Type = l.Type
+	case l.Symlink != "":
+		entry.Options = []string{XSnapdKindSymlink, XSnapdSymlink(l.Snap.ExpandSnapVariables(l.Symlink))}
+	}
+	return entry
+}
+
 // MountEntries returns a copy of the added mount entries.
+//
+// Entries derived from the layout of the snap come first.
 func (spec *Specification) MountEntries() []Entry {
-	result := make([]Entry, len(spec.mountEntries))
-	copy(result, spec.mountEntries)
+	result := make([]Entry, 0, len(spec.layoutMountEntries)+len(spec.mountEntries))
+	result = append(result, spec.layoutMountEntries...)
+	result = append(result, spec.mountEntries...)
 	return result
 }
 
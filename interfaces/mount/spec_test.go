@@ -22,10 +22,12 @@ package mount_test
 import (
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/interfaces/mount"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 )
 
 type specSuite struct {
@@ -91,3 +93,29 @@ func (s *specSuite) TestSpecificationIface(c *C) {
 		{Name: "connected-plug"}, {Name: "connected-slot"},
 		{Name: "permanent-plug"}, {Name: "permanent-slot"}})
 }
+
+const snapWithLayout = `name: vanguard
+version: 0
+layout:
+  /usr:
+    bind: $SNAP/usr
+  /lib/mytmp:
+    type: tmpfs
+  /lib/mylink:
+    symlink: $SNAP/link/target
+  /etc/foo.conf:
+    bind-file: $SNAP_DATA/foo.conf
+`
+
+func (s *specSuite) TestMountEntriesFromLayout(c *C) {
+	snapInfo := snaptest.MockInfo(c, snapWithLayout, &snap.SideInfo{Revision: snap.R(42)})
+	c.Assert(s.spec.AddMountEntry(mount.Entry{Name: "interface"}), IsNil)
+	s.spec.AddSnapLayout(snapInfo)
+	c.Assert(s.spec.MountEntries(), DeepEquals, []mount.Entry{
+		{Name: "/var/snap/vanguard/42/foo.conf", Dir: "/etc/foo.conf", Options: []string{"bind", "rw", mount.XSnapdKindFile}},
+		{Dir: "/lib/mylink", Options: []string{mount.XSnapdKindSymlink, "x-snapd.symlink=" + dirs.SnapMountDir + "/vanguard/42/link/target"}},
+		{Name: "tmpfs", Dir: "/lib/mytmp", Type: "tmpfs"},
+		{Name: dirs.SnapMountDir + "/vanguard/42/usr", Dir: "/usr", Options: []string{"rbind", "rw"}},
+		{Name: "interface"},
+	})
+}
@@ -41,18 +41,29 @@ type Repository struct {
 	slotPlugs map[*Slot]map[*Plug]bool
 	// given a plug and a slot, are they connected?
 	plugSlots map[*Plug]map[*Slot]bool
-	backends  map[SecuritySystem]SecurityBackend
+	// attributes set by the interface hooks of a connection
+	dynamicAttrs map[ConnRef]dynamicAttrs
+	backends     map[SecuritySystem]SecurityBackend
+}
+
+// dynamicAttrs holds the attributes of the plug and slot sides of a
+// connection that were provided when connecting, in addition to the
+// static attributes declared by the snaps.
+type dynamicAttrs struct {
+	plug map[string]interface{}
+	slot map[string]interface{}
 }
 
 // NewRepository creates an empty plug repository.
 func NewRepository() *Repository {
 	return &Repository{
-		ifaces:    make(map[string]Interface),
-		plugs:     make(map[string]map[string]*Plug),
-		slots:     make(map[string]map[string]*Slot),
-		slotPlugs: make(map[*Slot]map[*Plug]bool),
-		plugSlots: make(map[*Plug]map[*Slot]bool),
-		backends:  make(map[SecuritySystem]SecurityBackend),
+		ifaces:       make(map[string]Interface),
+		plugs:        make(map[string]map[string]*Plug),
+		slots:        make(map[string]map[string]*Slot),
+		slotPlugs:    make(map[*Slot]map[*Plug]bool),
+		plugSlots:    make(map[*Plug]map[*Slot]bool),
+		dynamicAttrs: make(map[ConnRef]dynamicAttrs),
+		backends:     make(map[SecuritySystem]SecurityBackend),
 	}
 }
 
@@ -64,6 +75,20 @@ func (r *Repository) Interface(interfaceName string) Interface {
 	return r.ifaces[interfaceName]
 }
 
+// AllInterfaces returns all the interfaces added to the repository,
+// sorted by name.
+func (r *Repository) AllInterfaces() []Interface {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	result := make([]Interface, 0, len(r.ifaces))
+	for _, iface := range r.ifaces {
+		result = append(result, iface)
+	}
+	sort.Sort(byInterfaceName(result))
+	return result
+}
+
 // AddInterface adds the provided interface to the repository.
 func (r *Repository) AddInterface(i Interface) error {
 	r.m.Lock()
@@ -432,6 +457,25 @@ func (r *Repository) Connect(ref ConnRef) error {
 	r.m.Lock()
 	defer r.m.Unlock()
 
+	return r.connect(ref, nil)
+}
+
+// ConnectWithAttrs establishes a connection between a plug and a slot,
+// like Connect, and records the dynamic attributes of both sides of the
+// connection. The security specifications of the connection see those
+// merged with the static attributes of the plug and the slot, the
+// latter taking precedence.
+func (r *Repository) ConnectWithAttrs(ref ConnRef, plugDynamic, slotDynamic map[string]interface{}) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.connect(ref, &dynamicAttrs{plug: plugDynamic, slot: slotDynamic})
+}
+
+// connect establishes a connection between a plug and a slot, replacing
+// the dynamic attributes of the connection unless attrs is nil.
+func (r *Repository) connect(ref ConnRef, attrs *dynamicAttrs) error {
+
 	plugSnapName := ref.PlugRef.Snap
 	plugName := ref.PlugRef.Name
 	slotSnapName := ref.SlotRef.Snap
@@ -452,6 +496,14 @@ func (r *Repository) Connect(ref ConnRef) error {
 		return fmt.Errorf(`cannot connect plug "%s:%s" (interface %q) to "%s:%s" (interface %q)`,
 			plugSnapName, plugName, plug.Interface, slotSnapName, slotName, slot.Interface)
 	}
+	if attrs != nil {
+		connRef := ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()}
+		if len(attrs.plug) > 0 || len(attrs.slot) > 0 {
+			r.dynamicAttrs[connRef] = *attrs
+		} else {
+			delete(r.dynamicAttrs, connRef)
+		}
+	}
 	// Ensure that slot and plug are not connected yet
 	if r.slotPlugs[slot][plug] {
 		// But if they are don't treat this as an error.
@@ -579,8 +631,66 @@ func (r *Repository) DisconnectAll(conns []ConnRef) {
 	}
 }
 
+// DynamicAttrs returns the dynamic attributes of the plug and slot sides
+// of the given connection.
+func (r *Repository) DynamicAttrs(ref ConnRef) (plugDynamic, slotDynamic map[string]interface{}) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	attrs := r.dynamicAttrs[ref]
+	return attrs.plug, attrs.slot
+}
+
+// ConnectionAttrs returns the attributes of the plug and slot sides of an
+// established connection as seen by the interface, that is the static
+// attributes merged with the dynamic ones.
+func (r *Repository) ConnectionAttrs(ref ConnRef) (plugAttrs, slotAttrs map[string]interface{}, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	plug := r.plugs[ref.PlugRef.Snap][ref.PlugRef.Name]
+	slot := r.slots[ref.SlotRef.Snap][ref.SlotRef.Name]
+	if plug == nil || slot == nil || !r.slotPlugs[slot][plug] {
+		return nil, nil, fmt.Errorf("cannot find connection %s", ref.ID())
+	}
+	plug, slot = r.withDynamicAttrs(plug, slot)
+	return plug.Attrs, slot.Attrs, nil
+}
+
+// withDynamicAttrs returns the plug and slot of a connection as seen by
+// the interface, that is with their dynamic attributes merged in.
+func (r *Repository) withDynamicAttrs(plug *Plug, slot *Slot) (*Plug, *Slot) {
+	attrs, ok := r.dynamicAttrs[ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()}]
+	if !ok {
+		return plug, slot
+	}
+	if len(attrs.plug) > 0 {
+		plugInfo := *plug.PlugInfo
+		plugInfo.Attrs = mergeAttrs(plug.Attrs, attrs.plug)
+		plug = &Plug{PlugInfo: &plugInfo, Connections: plug.Connections}
+	}
+	if len(attrs.slot) > 0 {
+		slotInfo := *slot.SlotInfo
+		slotInfo.Attrs = mergeAttrs(slot.Attrs, attrs.slot)
+		slot = &Slot{SlotInfo: &slotInfo, Connections: slot.Connections}
+	}
+	return plug, slot
+}
+
+func mergeAttrs(static, dynamic map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(static)+len(dynamic))
+	for k, v := range dynamic {
+		merged[k] = v
+	}
+	for k, v := range static {
+		merged[k] = v
+	}
+	return merged
+}
+
 // disconnect disconnects a plug from a slot.
 func (r *Repository) disconnect(plug *Plug, slot *Slot) {
+	delete(r.dynamicAttrs, ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()})
 	delete(r.slotPlugs[slot], plug)
 	if len(r.slotPlugs[slot]) == 0 {
 		delete(r.slotPlugs, slot)
@@ -698,6 +808,7 @@ func (r *Repository) securitySnippetsForSnap(snapName string, securitySystem Sec
 
 		// Add connection-specific snippet specific to each plug
 		for plug := range r.slotPlugs[slot] {
+			plug, slot := r.withDynamicAttrs(plug, slot)
 			snippet, err := iface.ConnectedSlotSnippet(plug, slot, securitySystem)
 			if err != nil {
 				return nil, err
@@ -717,6 +828,7 @@ func (r *Repository) securitySnippetsForSnap(snapName string, securitySystem Sec
 
 		// Add connection-specific snippet specific to each slot
 		for slot := range r.plugSlots[plug] {
+			plug, slot := r.withDynamicAttrs(plug, slot)
 			snippet, err := iface.ConnectedPlugSnippet(plug, slot, securitySystem)
 			if err != nil {
 				return nil, err
@@ -746,6 +858,7 @@ func (r *Repository) SnapSpecification(securitySystem SecuritySystem, snapName s
 			return nil, err
 		}
 		for plug := range r.slotPlugs[slot] {
+			plug, slot := r.withDynamicAttrs(plug, slot)
 			if err := spec.AddConnectedSlot(iface, plug, slot); err != nil {
 				return nil, err
 			}
@@ -758,6 +871,7 @@ func (r *Repository) SnapSpecification(securitySystem SecuritySystem, snapName s
 			return nil, err
 		}
 		for slot := range r.plugSlots[plug] {
+			plug, slot := r.withDynamicAttrs(plug, slot)
 			if err := spec.AddConnectedPlug(iface, plug, slot); err != nil {
 				return nil, err
 			}
@@ -164,6 +164,17 @@ func (s *RepositorySuite) TestInterface(c *C) {
 	c.Assert(iface, Equals, s.iface)
 }
 
+// Tests for Repository.AllInterfaces()
+
+func (s *RepositorySuite) TestAllInterfaces(c *C) {
+	c.Assert(s.emptyRepo.AllInterfaces(), HasLen, 0)
+	ifaceB := &ifacetest.TestInterface{InterfaceName: "b"}
+	ifaceA := &ifacetest.TestInterface{InterfaceName: "a"}
+	c.Assert(s.emptyRepo.AddInterface(ifaceB), IsNil)
+	c.Assert(s.emptyRepo.AddInterface(ifaceA), IsNil)
+	c.Assert(s.emptyRepo.AllInterfaces(), DeepEquals, []Interface{ifaceA, ifaceB})
+}
+
 func (s *RepositorySuite) TestInterfaceSearch(c *C) {
 	ifaceA := &ifacetest.TestInterface{InterfaceName: "a"}
 	ifaceB := &ifacetest.TestInterface{InterfaceName: "b"}
@@ -1393,6 +1404,70 @@ func (s *RepositorySuite) TestSnapSpecification(c *C) {
 	})
 }
 
+func (s *RepositorySuite) TestSnapSpecificationDynamicAttrs(c *C) {
+	repo := s.emptyRepo
+	backend := &ifacetest.TestSecurityBackend{BackendName: testSecurity}
+	c.Assert(repo.AddBackend(backend), IsNil)
+	var plugAttrs, slotAttrs []map[string]interface{}
+	iface := &ifacetest.TestInterface{
+		InterfaceName: "interface",
+		TestConnectedPlugCallback: func(spec *ifacetest.Specification, plug *Plug, slot *Slot) error {
+			plugAttrs = append(plugAttrs, plug.Attrs)
+			return nil
+		},
+		TestConnectedSlotCallback: func(spec *ifacetest.Specification, plug *Plug, slot *Slot) error {
+			slotAttrs = append(slotAttrs, slot.Attrs)
+			return nil
+		},
+	}
+	c.Assert(repo.AddInterface(iface), IsNil)
+	c.Assert(repo.AddPlug(s.plug), IsNil)
+	c.Assert(repo.AddSlot(s.slot), IsNil)
+
+	connRef := ConnRef{PlugRef: s.plug.Ref(), SlotRef: s.slot.Ref()}
+	err := repo.ConnectWithAttrs(connRef,
+		map[string]interface{}{"dynamic": "plug", "attr": "ignored"},
+		map[string]interface{}{"path": "/run/socket"})
+	c.Assert(err, IsNil)
+
+	plugDynamic, slotDynamic := repo.DynamicAttrs(connRef)
+	c.Check(plugDynamic, DeepEquals, map[string]interface{}{"dynamic": "plug", "attr": "ignored"})
+	c.Check(slotDynamic, DeepEquals, map[string]interface{}{"path": "/run/socket"})
+
+	_, err = repo.SnapSpecification(testSecurity, s.plug.Snap.Name())
+	c.Assert(err, IsNil)
+	_, err = repo.SnapSpecification(testSecurity, s.slot.Snap.Name())
+	c.Assert(err, IsNil)
+	// static attributes take precedence
+	c.Check(plugAttrs, DeepEquals, []map[string]interface{}{
+		{"attr": "value", "dynamic": "plug"},
+	})
+	c.Check(slotAttrs, DeepEquals, []map[string]interface{}{
+		{"attr": "value", "path": "/run/socket"},
+	})
+	// the plug and the slot themselves are not modified
+	c.Check(s.plug.Attrs, DeepEquals, map[string]interface{}{"attr": "value"})
+	c.Check(s.slot.Attrs, DeepEquals, map[string]interface{}{"attr": "value"})
+
+	plugAttrs2, slotAttrs2, err := repo.ConnectionAttrs(connRef)
+	c.Assert(err, IsNil)
+	c.Check(plugAttrs2, DeepEquals, map[string]interface{}{"attr": "value", "dynamic": "plug"})
+	c.Check(slotAttrs2, DeepEquals, map[string]interface{}{"attr": "value", "path": "/run/socket"})
+
+	// plain connect keeps the attributes
+	c.Assert(repo.Connect(connRef), IsNil)
+	plugDynamic, _ = repo.DynamicAttrs(connRef)
+	c.Check(plugDynamic, HasLen, 2)
+
+	// disconnecting forgets them
+	c.Assert(repo.Disconnect("consumer", "plug", "producer", "slot"), IsNil)
+	plugDynamic, slotDynamic = repo.DynamicAttrs(connRef)
+	c.Check(plugDynamic, IsNil)
+	c.Check(slotDynamic, IsNil)
+	_, _, err = repo.ConnectionAttrs(connRef)
+	c.Check(err, ErrorMatches, `cannot find connection consumer:plug producer:slot`)
+}
+
 func (s *RepositorySuite) TestOrphanInterfaces(c *C) {
 	repo := s.emptyRepo
 	snaps := addPlugsSlots(c, s.testRepo, `
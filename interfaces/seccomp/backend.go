@@ -25,8 +25,9 @@
 // the profile is read and "compiled" to an eBPF program and injected into the
 // kernel for the duration of the execution of the process.
 //
-// There is no binary cache for seccomp, each time the launcher starts an
-// application the profile is parsed and re-compiled.
+// The profiles are also compiled ahead of time, when they are written, so
+// that mistakes in them are reported at installation time. The resulting
+// BPF filters are stored next to the profiles, with a .bin suffix.
 //
 // The actual profiles are stored in /var/lib/snappy/seccomp/profiles.
 // This directory is hard-coded in ubuntu-core-launcher.
@@ -37,6 +38,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/osutil"
@@ -101,20 +103,24 @@ func (b *Backend) deriveContent(spec *Specification, opts interfaces.Confinement
 			content = make(map[string]*osutil.FileState)
 		}
 		securityTag := hookInfo.SecurityTag()
-		addContent(securityTag, opts, spec.SnippetForTag(securityTag), content)
+		if err := addContent(securityTag, opts, spec.SnippetForTag(securityTag), content); err != nil {
+			return nil, err
+		}
 	}
 	for _, appInfo := range snapInfo.Apps {
 		if content == nil {
 			content = make(map[string]*osutil.FileState)
 		}
 		securityTag := appInfo.SecurityTag()
-		addContent(securityTag, opts, spec.SnippetForTag(securityTag), content)
+		if err := addContent(securityTag, opts, spec.SnippetForTag(securityTag), content); err != nil {
+			return nil, err
+		}
 	}
 
 	return content, nil
 }
 
-func addContent(securityTag string, opts interfaces.ConfinementOptions, snippetForTag string, content map[string]*osutil.FileState) {
+func addContent(securityTag string, opts interfaces.ConfinementOptions, snippetForTag string, content map[string]*osutil.FileState) error {
 	var buffer bytes.Buffer
 	if opts.Classic && !opts.JailMode {
 		// NOTE: This is understood by snap-confine
@@ -132,6 +138,24 @@ func addContent(securityTag string, opts interfaces.ConfinementOptions, snippetF
 		Content: buffer.Bytes(),
 		Mode:    0644,
 	}
+
+	// snap-confine loads the compiled filter when there is one, and
+	// falls back to the profile itself otherwise
+	nativeArch := arch.ArchitectureType(arch.UbuntuArchitecture())
+	if _, err := arch.SyscallTableFor(nativeArch); err != nil {
+		return nil
+	}
+	filter, err := Compile(buffer.Bytes(), nativeArch)
+	if err != nil {
+		return fmt.Errorf("cannot compile seccomp profile %s: %v", securityTag, err)
+	}
+	if filter != nil {
+		content[securityTag+".bin"] = &osutil.FileState{
+			Content: filter,
+			Mode:    0644,
+		}
+	}
+	return nil
 }
 
 func (b *Backend) NewSpecification() interfaces.Specification {
@@ -26,6 +26,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
@@ -84,6 +85,54 @@ func (s *backendSuite) TestInstallingSnapWritesHookProfiles(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *backendSuite) TestInstallingSnapWritesCompiledFilters(c *C) {
+	defer arch.SetArchitecture(arch.ArchitectureType(arch.UbuntuArchitecture()))
+	arch.SetArchitecture("amd64")
+
+	snapInfo := s.InstallSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	filter := filepath.Join(dirs.SnapSeccompDir, "snap.samba.smbd.bin")
+	data, err := ioutil.ReadFile(filter)
+	c.Assert(err, IsNil)
+	c.Check(len(data) > 0, Equals, true)
+	c.Check(len(data)%8, Equals, 0)
+
+	// profiles that don't restrict syscalls have no filter
+	for _, opts := range []interfaces.ConfinementOptions{{DevMode: true}, {Classic: true}} {
+		snapInfo = s.UpdateSnap(c, snapInfo, opts, ifacetest.SambaYamlV1, 0)
+		_, err = os.Stat(filter)
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+
+	s.RemoveSnap(c, snapInfo)
+	_, err = os.Stat(filter)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *backendSuite) TestInstallingSnapWithBadRulesFails(c *C) {
+	defer arch.SetArchitecture(arch.ArchitectureType(arch.UbuntuArchitecture()))
+	arch.SetArchitecture("amd64")
+
+	s.Iface.SecCompPermanentSlotCallback = func(spec *seccomp.Specification, slot *interfaces.Slot) error {
+		spec.AddSnippet("socket AF_UNKNOWN")
+		return nil
+	}
+	snapInfo := snaptest.MockInfo(c, ifacetest.SambaYamlV1, nil)
+	c.Assert(s.Repo.AddSnap(snapInfo), IsNil)
+	err := s.Backend.Setup(snapInfo, interfaces.ConfinementOptions{}, s.Repo)
+	c.Assert(err, ErrorMatches, `cannot obtain expected security files for snap "samba": cannot compile seccomp profile snap.samba.smbd: line [0-9]+: unknown constant "AF_UNKNOWN"`)
+}
+
+func (s *backendSuite) TestUnsupportedArchitectureHasNoCompiledFilters(c *C) {
+	defer arch.SetArchitecture(arch.ArchitectureType(arch.UbuntuArchitecture()))
+	arch.SetArchitecture("mips")
+
+	s.InstallSnap(c, interfaces.ConfinementOptions{}, ifacetest.SambaYamlV1, 0)
+	_, err := os.Stat(filepath.Join(dirs.SnapSeccompDir, "snap.samba.smbd"))
+	c.Check(err, IsNil)
+	_, err = os.Stat(filepath.Join(dirs.SnapSeccompDir, "snap.samba.smbd.bin"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
 func (s *backendSuite) TestRemovingSnapRemovesProfiles(c *C) {
 	for _, opts := range testedConfinementOpts {
 		snapInfo := s.InstallSnap(c, opts, ifacetest.SambaYamlV1, 0)
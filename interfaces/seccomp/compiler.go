@@ -0,0 +1,500 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seccomp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/arch"
+)
+
+// The syntax of the profiles is the one understood by snap-confine:
+//
+//   # comment
+//   @unrestricted
+//   @complain
+//   syscall [arg...]
+//
+// where each argument is "-", to match any value, or a number or a known
+// constant, e.g. AF_UNIX, optionally prefixed by one of the comparison
+// operators !, <, <=, > and >=.
+
+// maxLineLength is the longest line snap-confine can read.
+const maxLineLength = 80
+
+// maxArgs is the number of syscall arguments seccomp can inspect.
+const maxArgs = 6
+
+type cmpOp int
+
+const (
+	cmpEQ cmpOp = iota
+	cmpNE
+	cmpGT
+	cmpGE
+	cmpLT
+	cmpLE
+)
+
+type argRule struct {
+	pos   int
+	op    cmpOp
+	value string
+}
+
+type syscallRule struct {
+	line    int
+	syscall string
+	args    []argRule
+}
+
+type profile struct {
+	unrestricted bool
+	complain     bool
+	rules        []syscallRule
+}
+
+func parseArg(pos int, token string) (argRule, error) {
+	rule := argRule{pos: pos, op: cmpEQ, value: token}
+	if len(token) > 1 {
+		for _, prefix := range []struct {
+			str string
+			op  cmpOp
+		}{{">=", cmpGE}, {"<=", cmpLE}, {"!", cmpNE}, {">", cmpGT}, {"<", cmpLT}} {
+			if strings.HasPrefix(token, prefix.str) {
+				rule.op = prefix.op
+				rule.value = token[len(prefix.str):]
+				break
+			}
+		}
+	}
+	if rule.value == "" || strings.HasPrefix(rule.value, "-") {
+		return rule, fmt.Errorf("invalid argument %q", token)
+	}
+	return rule, nil
+}
+
+func parseProfile(content []byte) (*profile, error) {
+	p := &profile{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r\v\f")
+		if line == "" {
+			continue
+		}
+		if len(line) > maxLineLength {
+			return nil, fmt.Errorf("line %d is too long (%d characters max)", lineno, maxLineLength)
+		}
+		switch line {
+		case "@unrestricted":
+			p.unrestricted = true
+			continue
+		case "@complain":
+			p.complain = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > maxArgs+1 {
+			return nil, fmt.Errorf("line %d has too many arguments (%d max)", lineno, maxArgs)
+		}
+		rule := syscallRule{line: lineno, syscall: fields[0]}
+		for pos, token := range fields[1:] {
+			if token == "-" {
+				continue
+			}
+			arg, err := parseArg(pos, token)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineno, err)
+			}
+			rule.args = append(rule.args, arg)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// resolveArg returns the numeric value of the given argument, which is
+// either a decimal number or a constant known to the architecture.
+func resolveArg(table *arch.SyscallTable, value string) (uint64, error) {
+	if value[0] >= '0' && value[0] <= '9' {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", value)
+		}
+		return n, nil
+	}
+	n, ok := table.SyscallArgument(value)
+	if !ok {
+		return 0, fmt.Errorf("unknown constant %q", value)
+	}
+	return n, nil
+}
+
+// BPF instructions, as in linux/filter.h and linux/bpf_common.h.
+const (
+	bpfLdAbsW = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJa     = 0x05 // BPF_JMP | BPF_JA
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgtK   = 0x25 // BPF_JMP | BPF_JGT | BPF_K
+	bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+	// the longest program the kernel accepts
+	bpfMaxInsns = 4096
+)
+
+// Seccomp return values and the layout of struct seccomp_data, as in
+// linux/seccomp.h.
+const (
+	seccompRetKill  = 0x00000000
+	seccompRetAllow = 0x7fff0000
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArgs = 16
+)
+
+type bpfInsn struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+// labelNext is the label of the next instruction.
+const labelNext = -1
+
+type bpfFixup struct {
+	insn   int
+	jt, jf int
+}
+
+// bpfProgram builds a BPF program whose jumps refer to labels, which are
+// resolved to relative offsets once the program is complete.
+type bpfProgram struct {
+	insns  []bpfInsn
+	labels []int
+	fixups []bpfFixup
+}
+
+func (p *bpfProgram) newLabel() int {
+	p.labels = append(p.labels, -1)
+	return len(p.labels) - 1
+}
+
+func (p *bpfProgram) setLabel(label int) {
+	p.labels[label] = len(p.insns)
+}
+
+func (p *bpfProgram) stmt(code uint16, k uint32) {
+	p.insns = append(p.insns, bpfInsn{code: code, k: k})
+}
+
+// jump adds a conditional jump to the jt label if the accumulator
+// compares true to k, and to the jf label otherwise.
+func (p *bpfProgram) jump(code uint16, k uint32, jt, jf int) {
+	p.fixups = append(p.fixups, bpfFixup{insn: len(p.insns), jt: jt, jf: jf})
+	p.insns = append(p.insns, bpfInsn{code: code, k: k})
+}
+
+// jumpAlways adds an unconditional jump, which unlike the conditional
+// ones can go forward by more than 255 instructions.
+func (p *bpfProgram) jumpAlways(label int) {
+	p.fixups = append(p.fixups, bpfFixup{insn: len(p.insns), jt: label, jf: labelNext})
+	p.insns = append(p.insns, bpfInsn{code: bpfJa})
+}
+
+func (p *bpfProgram) offset(from, label int) (int, error) {
+	if label == labelNext {
+		return 0, nil
+	}
+	to := p.labels[label]
+	if to < 0 {
+		return 0, fmt.Errorf("internal error: unset label %d", label)
+	}
+	if to <= from {
+		return 0, fmt.Errorf("internal error: backward jump from %d to %d", from, to)
+	}
+	return to - from - 1, nil
+}
+
+func (p *bpfProgram) resolve() error {
+	for _, fixup := range p.fixups {
+		insn := &p.insns[fixup.insn]
+		jt, err := p.offset(fixup.insn, fixup.jt)
+		if err != nil {
+			return err
+		}
+		if insn.code == bpfJa {
+			insn.k = uint32(jt)
+			continue
+		}
+		jf, err := p.offset(fixup.insn, fixup.jf)
+		if err != nil {
+			return err
+		}
+		if jt > math.MaxUint8 || jf > math.MaxUint8 {
+			return fmt.Errorf("internal error: jump too far at instruction %d", fixup.insn)
+		}
+		insn.jt, insn.jf = uint8(jt), uint8(jf)
+	}
+	return nil
+}
+
+func (p *bpfProgram) bytes(order binary.ByteOrder) []byte {
+	buf := make([]byte, 8*len(p.insns))
+	for i, insn := range p.insns {
+		b := buf[8*i:]
+		order.PutUint16(b[0:], insn.code)
+		b[2] = insn.jt
+		b[3] = insn.jf
+		order.PutUint32(b[4:], insn.k)
+	}
+	return buf
+}
+
+// argOffsets returns the offsets in struct seccomp_data of the high and
+// low 32 bits of the given syscall argument.
+func argOffsets(table *arch.SyscallTable, pos int) (hi, lo uint32) {
+	off := uint32(seccompDataArgs + 8*pos)
+	if table.BigEndian {
+		return off, off + 4
+	}
+	return off + 4, off
+}
+
+// compileArg adds the instructions checking a syscall argument, which
+// jump to the fail label when the check fails and carry on otherwise.
+func (p *bpfProgram) compileArg(table *arch.SyscallTable, arg argRule, value uint64, fail int) {
+	hiOff, loOff := argOffsets(table, arg.pos)
+	hi, lo := uint32(value>>32), uint32(value)
+	pass := p.newLabel()
+
+	if table.Bits64 {
+		// decide on the high 32 bits when they differ
+		p.stmt(bpfLdAbsW, hiOff)
+		switch arg.op {
+		case cmpEQ:
+			p.jump(bpfJeqK, hi, labelNext, fail)
+		case cmpNE:
+			p.jump(bpfJeqK, hi, labelNext, pass)
+		case cmpGT, cmpGE:
+			p.jump(bpfJgtK, hi, pass, labelNext)
+			p.jump(bpfJeqK, hi, labelNext, fail)
+		case cmpLT, cmpLE:
+			p.jump(bpfJgtK, hi, fail, labelNext)
+			p.jump(bpfJeqK, hi, labelNext, pass)
+		}
+	}
+
+	p.stmt(bpfLdAbsW, loOff)
+	switch arg.op {
+	case cmpEQ:
+		p.jump(bpfJeqK, lo, labelNext, fail)
+	case cmpNE:
+		p.jump(bpfJeqK, lo, fail, labelNext)
+	case cmpGT:
+		p.jump(bpfJgtK, lo, labelNext, fail)
+	case cmpGE:
+		p.jump(bpfJgeK, lo, labelNext, fail)
+	case cmpLT:
+		p.jump(bpfJgeK, lo, fail, labelNext)
+	case cmpLE:
+		p.jump(bpfJgtK, lo, fail, labelNext)
+	}
+	p.setLabel(pass)
+}
+
+type resolvedArg struct {
+	rule  argRule
+	value uint64
+}
+
+type syscallGroup struct {
+	nr    uint32
+	rules [][]resolvedArg
+	// unconditional is true if the syscall is allowed whatever its
+	// arguments
+	unconditional bool
+}
+
+// groupRules resolves the rules for the given architecture, grouping them
+// by syscall in the order the syscalls first appear in the profile.
+// Syscalls unknown to the architecture are skipped, as the profiles list
+// the syscalls of all the architectures.
+func groupRules(table *arch.SyscallTable, rules []syscallRule) ([]*syscallGroup, error) {
+	var groups []*syscallGroup
+	byNr := make(map[uint32]*syscallGroup)
+	for _, rule := range rules {
+		nr, ok := table.Syscall(rule.syscall)
+		if !ok {
+			continue
+		}
+		args := make([]resolvedArg, 0, len(rule.args))
+		fits := true
+		for _, arg := range rule.args {
+			value, err := resolveArg(table, arg.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", rule.line, err)
+			}
+			if !table.Bits64 && value > math.MaxUint32 {
+				fits = false
+			}
+			args = append(args, resolvedArg{rule: arg, value: value})
+		}
+		if !fits {
+			// the rule is about values 32-bit arguments can't have,
+			// leave the syscall denied
+			continue
+		}
+		group := byNr[nr]
+		if group == nil {
+			group = &syscallGroup{nr: nr}
+			byNr[nr] = group
+			groups = append(groups, group)
+		}
+		if group.unconditional {
+			continue
+		}
+		if len(args) == 0 {
+			group.unconditional = true
+			group.rules = nil
+			continue
+		}
+		group.rules = append(group.rules, args)
+	}
+	return groups, nil
+}
+
+func (p *bpfProgram) compileGroups(table *arch.SyscallTable, groups []*syscallGroup) {
+	p.stmt(bpfLdAbsW, seccompDataNr)
+	for _, group := range groups {
+		if group.unconditional {
+			p.jump(bpfJeqK, group.nr, labelNext, p.skip(1))
+			p.stmt(bpfRetK, seccompRetAllow)
+			continue
+		}
+		// the checks of the arguments can take more than the 255
+		// instructions a conditional jump can skip
+		body, next := p.newLabel(), p.newLabel()
+		p.jump(bpfJeqK, group.nr, body, labelNext)
+		p.jumpAlways(next)
+		p.setLabel(body)
+		for _, args := range group.rules {
+			fail := p.newLabel()
+			for _, arg := range args {
+				p.compileArg(table, arg.rule, arg.value, fail)
+			}
+			p.stmt(bpfRetK, seccompRetAllow)
+			p.setLabel(fail)
+		}
+		p.stmt(bpfRetK, seccompRetKill)
+		p.setLabel(next)
+	}
+	p.stmt(bpfRetK, seccompRetKill)
+}
+
+// skip returns a label n instructions after the next one.
+func (p *bpfProgram) skip(n int) int {
+	label := p.newLabel()
+	p.labels[label] = len(p.insns) + 1 + n
+	return label
+}
+
+// Compile compiles a seccomp profile into the BPF filter for processes
+// of the given architecture and, if any, of the 32-bit architecture it
+// is compatible with. The filter is an array of struct sock_filter in
+// the byte order of the architecture, as snap-confine reads it from the
+// .bin file next to the profile and hands it to the kernel. A nil
+// filter is returned for profiles that don't restrict syscalls, i.e. in
+// complain mode or unrestricted, which snap-confine handles from the
+// profile itself.
+func Compile(content []byte, nativeArch arch.ArchitectureType) ([]byte, error) {
+	prof, err := parseProfile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	archs := []arch.ArchitectureType{nativeArch}
+	if compat := arch.CompatArchitecture(nativeArch); compat != "" {
+		archs = append(archs, compat)
+	}
+	var tables []*arch.SyscallTable
+	var archGroups [][]*syscallGroup
+	for _, a := range archs {
+		table, err := arch.SyscallTableFor(a)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := groupRules(table, prof.rules)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+		archGroups = append(archGroups, groups)
+	}
+	if prof.unrestricted || prof.complain {
+		return nil, nil
+	}
+
+	p := &bpfProgram{}
+	// dispatch on the architecture of the syscall
+	p.stmt(bpfLdAbsW, seccompDataArch)
+	sections := make([]int, len(tables))
+	for i, table := range tables {
+		sections[i] = p.newLabel()
+		p.jump(bpfJeqK, table.AuditArch, labelNext, p.skip(1))
+		p.jumpAlways(sections[i])
+	}
+	p.stmt(bpfRetK, seccompRetKill)
+	for i, table := range tables {
+		p.setLabel(sections[i])
+		p.compileGroups(table, archGroups[i])
+	}
+
+	if len(p.insns) > bpfMaxInsns {
+		return nil, fmt.Errorf("seccomp filter is too long (%d instructions, %d max)", len(p.insns), bpfMaxInsns)
+	}
+	if err := p.resolve(); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if tables[0].BigEndian {
+		order = binary.BigEndian
+	}
+	return p.bytes(order), nil
+}
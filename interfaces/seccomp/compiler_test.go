@@ -0,0 +1,249 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seccomp_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/interfaces/seccomp"
+)
+
+type compilerSuite struct{}
+
+var _ = Suite(&compilerSuite{})
+
+const (
+	retKill  = 0x00000000
+	retAllow = 0x7fff0000
+)
+
+// syscallData is the struct seccomp_data the filters are run against.
+type syscallData struct {
+	arch arch.ArchitectureType
+	nr   uint32
+	args [6]uint64
+}
+
+// runFilter runs the BPF filter for the given syscall, with a minimal
+// interpreter of the instructions used by the compiler.
+func runFilter(c *C, filter []byte, order binary.ByteOrder, data syscallData) uint32 {
+	table, err := arch.SyscallTableFor(data.arch)
+	c.Assert(err, IsNil)
+	mem := make([]byte, 64)
+	order.PutUint32(mem[0:], data.nr)
+	order.PutUint32(mem[4:], table.AuditArch)
+	for i, arg := range data.args {
+		order.PutUint64(mem[16+8*i:], arg)
+	}
+
+	c.Assert(len(filter)%8, Equals, 0)
+	var acc uint32
+	for pc := 0; pc < len(filter)/8; pc++ {
+		insn := filter[8*pc:]
+		code := order.Uint16(insn[0:])
+		jt, jf := int(insn[2]), int(insn[3])
+		k := order.Uint32(insn[4:])
+		cond := func(ok bool) {
+			if ok {
+				pc += jt
+			} else {
+				pc += jf
+			}
+		}
+		switch code {
+		case 0x20: // ld [k]
+			c.Assert(k+4 <= uint32(len(mem)), Equals, true)
+			acc = order.Uint32(mem[k:])
+		case 0x05: // ja
+			pc += int(k)
+		case 0x15: // jeq #k
+			cond(acc == k)
+		case 0x25: // jgt #k
+			cond(acc > k)
+		case 0x35: // jge #k
+			cond(acc >= k)
+		case 0x06: // ret #k
+			return k
+		default:
+			c.Fatalf("unexpected instruction %#x at %d", code, pc)
+		}
+	}
+	c.Fatalf("filter does not return")
+	return 0
+}
+
+func syscallNr(c *C, a arch.ArchitectureType, name string) uint32 {
+	table, err := arch.SyscallTableFor(a)
+	c.Assert(err, IsNil)
+	nr, ok := table.Syscall(name)
+	c.Assert(ok, Equals, true, Commentf("%s has no %s", a, name))
+	return nr
+}
+
+func (s *compilerSuite) TestCompileSyscalls(c *C) {
+	filter, err := seccomp.Compile([]byte("# comment\nread\n\nwrite  \nno-such-syscall\n"), "amd64")
+	c.Assert(err, IsNil)
+
+	for _, a := range []arch.ArchitectureType{"amd64", "i386"} {
+		for _, t := range []struct {
+			name string
+			ret  uint32
+		}{
+			{"read", retAllow},
+			{"write", retAllow},
+			{"open", retKill},
+		} {
+			data := syscallData{arch: a, nr: syscallNr(c, a, t.name)}
+			c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(t.ret), Commentf("%s %s", a, t.name))
+		}
+	}
+
+	// syscalls of other architectures are killed
+	data := syscallData{arch: "armhf", nr: syscallNr(c, "armhf", "read")}
+	c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(retKill))
+}
+
+func (s *compilerSuite) TestCompileArgs(c *C) {
+	profile := `
+socket AF_UNIX
+socket AF_INET SOCK_STREAM
+setpriority PRIO_PROCESS 0 <=19
+prctl !PR_SET_SECCOMP
+lseek - >4294967296
+sendto - - - - - >=5
+`
+	for _, a := range []arch.ArchitectureType{"amd64", "s390x", "armhf"} {
+		table, err := arch.SyscallTableFor(a)
+		c.Assert(err, IsNil)
+		filter, err := seccomp.Compile([]byte(profile), a)
+		c.Assert(err, IsNil)
+		var order binary.ByteOrder = binary.LittleEndian
+		if table.BigEndian {
+			order = binary.BigEndian
+		}
+
+		for _, t := range []struct {
+			name   string
+			args   [6]uint64
+			ret    uint32
+			bits64 bool
+		}{
+			{"socket", [6]uint64{1, 2}, retAllow, false},
+			{"socket", [6]uint64{2, 1}, retAllow, false},
+			{"socket", [6]uint64{2, 2}, retKill, false},
+			{"socket", [6]uint64{10, 1}, retKill, false},
+			{"socket", [6]uint64{1 | 1<<32}, retKill, true},
+			{"setpriority", [6]uint64{0, 0, 19}, retAllow, false},
+			{"setpriority", [6]uint64{0, 0, 0}, retAllow, false},
+			{"setpriority", [6]uint64{0, 0, 20}, retKill, false},
+			{"setpriority", [6]uint64{0, 1, 10}, retKill, false},
+			{"setpriority", [6]uint64{0, 0, 1 << 32}, retKill, true},
+			{"prctl", [6]uint64{15}, retAllow, false},
+			{"prctl", [6]uint64{22}, retKill, false},
+			{"prctl", [6]uint64{22 | 1<<32}, retAllow, true},
+			{"lseek", [6]uint64{0, 1<<32 + 1}, retAllow, true},
+			{"lseek", [6]uint64{0, 1 << 32}, retKill, false},
+			{"lseek", [6]uint64{0, 1 << 33}, retAllow, true},
+			{"lseek", [6]uint64{0, 5}, retKill, false},
+			// rules about values that don't fit 32-bit arguments are
+			// dropped on 32-bit architectures
+			{"lseek", [6]uint64{0, 1}, retKill, false},
+			{"sendto", [6]uint64{0, 0, 0, 0, 0, 5}, retAllow, false},
+			{"sendto", [6]uint64{0, 0, 0, 0, 0, 4}, retKill, false},
+		} {
+			if t.bits64 && !table.Bits64 {
+				continue
+			}
+			data := syscallData{arch: a, nr: syscallNr(c, a, t.name), args: t.args}
+			c.Check(runFilter(c, filter, order, data), Equals, uint32(t.ret), Commentf("%s %s %v", a, t.name, t.args))
+		}
+	}
+}
+
+func (s *compilerSuite) TestCompileUnconditionalWins(c *C) {
+	filter, err := seccomp.Compile([]byte("socket AF_UNIX\nsocket\n"), "amd64")
+	c.Assert(err, IsNil)
+	data := syscallData{arch: "amd64", nr: syscallNr(c, "amd64", "socket"), args: [6]uint64{2}}
+	c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(retAllow))
+}
+
+func (s *compilerSuite) TestCompileManyRules(c *C) {
+	// the rules of a syscall can take more instructions than a
+	// conditional jump can skip
+	var profile []string
+	for i := 0; i < 100; i++ {
+		profile = append(profile, fmt.Sprintf("ioctl - %d", i))
+	}
+	profile = append(profile, "read")
+	filter, err := seccomp.Compile([]byte(strings.Join(profile, "\n")), "amd64")
+	c.Assert(err, IsNil)
+
+	data := syscallData{arch: "amd64", nr: syscallNr(c, "amd64", "read")}
+	c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(retAllow))
+	data = syscallData{arch: "amd64", nr: syscallNr(c, "amd64", "ioctl"), args: [6]uint64{0, 99}}
+	c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(retAllow))
+	data.args[1] = 100
+	c.Check(runFilter(c, filter, binary.LittleEndian, data), Equals, uint32(retKill))
+}
+
+func (s *compilerSuite) TestCompileUnrestricted(c *C) {
+	for _, profile := range []string{"@unrestricted\nread\n", "@complain\nread\n"} {
+		filter, err := seccomp.Compile([]byte(profile), "amd64")
+		c.Assert(err, IsNil)
+		c.Check(filter, IsNil)
+	}
+}
+
+func (s *compilerSuite) TestCompileErrors(c *C) {
+	for _, t := range []struct {
+		profile string
+		err     string
+	}{
+		{"read 1 2 3 4 5 6 7", "line 1 has too many arguments \\(6 max\\)"},
+		{"\nsocket -1", `line 2: invalid argument "-1"`},
+		{"socket >=", `line 1: invalid argument ">="`},
+		{"socket AF_UNKNOWN", `line 1: unknown constant "AF_UNKNOWN"`},
+		{"socket 0x10", `line 1: invalid number "0x10"`},
+		{"socket 99999999999999999999", `line 1: invalid number "99999999999999999999"`},
+		{"read " + strings.Repeat("- ", 40), "line 1 is too long \\(80 characters max\\)"},
+		// errors are reported even for syscalls the architecture
+		// does not have
+		{"open AF_UNKNOWN", `line 1: unknown constant "AF_UNKNOWN"`},
+	} {
+		_, err := seccomp.Compile([]byte(t.profile), "amd64")
+		c.Check(err, ErrorMatches, t.err, Commentf("%q", t.profile))
+	}
+
+	_, err := seccomp.Compile([]byte("read"), "mips")
+	c.Check(err, ErrorMatches, `cannot find syscalls of unsupported architecture "mips"`)
+}
+
+func (s *compilerSuite) TestCompileDefaultTemplate(c *C) {
+	for _, a := range []arch.ArchitectureType{"i386", "amd64", "armhf", "arm64", "ppc64el", "s390x", "powerpc"} {
+		filter, err := seccomp.Compile(seccomp.DefaultTemplate(), a)
+		c.Assert(err, IsNil, Commentf("%s", a))
+		c.Check(len(filter) > 0, Equals, true)
+	}
+}
@@ -28,3 +28,8 @@ func MockTemplate(fakeTemplate []byte) (restore func()) {
 	defaultTemplate = fakeTemplate
 	return func() { defaultTemplate = orig }
 }
+
+// DefaultTemplate returns the real seccomp template.
+func DefaultTemplate() []byte {
+	return defaultTemplate
+}
@@ -73,3 +73,9 @@ func (c byBackendName) Less(i, j int) bool {
 	}
 	return c[i].Name() < c[j].Name()
 }
+
+type byInterfaceName []Interface
+
+func (c byInterfaceName) Len() int           { return len(c) }
+func (c byInterfaceName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byInterfaceName) Less(i, j int) bool { return c[i].Name() < c[j].Name() }
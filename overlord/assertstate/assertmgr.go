@@ -477,6 +477,15 @@ func init() {
 	snapstate.ValidateRefreshes = ValidateRefreshes
 	// hook auto refresh of assertions into snapstate
 	snapstate.AutoRefreshAssertions = AutoRefreshAssertions
+	// hook cross-checking of snaps reconstructed from deltas into snapstate
+	snapstate.CrossCheckSnap = CrossCheckSnap
+}
+
+// CrossCheckSnap cross checks the digest and size of a snap file
+// with the snap-revision and snap-declaration assertions for the snap
+// described by si.
+func CrossCheckSnap(s *state.State, name, snapSHA3_384 string, snapSize uint64, si *snap.SideInfo) error {
+	return snapasserts.CrossCheck(name, snapSHA3_384, snapSize, si, DB(s))
 }
 
 // BaseDeclaration returns the base-declaration assertion with policies governing all snaps.
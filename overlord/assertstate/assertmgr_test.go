@@ -92,8 +92,8 @@ func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, error)
 	panic("fakeStore.Find not expected")
 }
 
-func (sto *fakeStore) ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error) {
-	panic("fakeStore.ListRefresh not expected")
+func (sto *fakeStore) SnapAction([]*store.CurrentSnap, []*store.SnapAction, *auth.UserState) ([]*snap.Info, error) {
+	panic("fakeStore.SnapAction not expected")
 }
 
 func (sto *fakeStore) Download(context.Context, string, string, *snap.DownloadInfo, progress.Meter, *auth.UserState) error {
@@ -0,0 +1,405 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+)
+
+// ValidationSetMode is the mode in which a tracked validation-set is applied.
+type ValidationSetMode string
+
+const (
+	// Monitor mode refuses operations on snaps that would violate the
+	// validation-set.
+	Monitor ValidationSetMode = "monitor"
+	// Enforce mode additionally installs the missing required snaps and
+	// refreshes snaps to their pinned revisions when it's applied.
+	Enforce ValidationSetMode = "enforce"
+)
+
+// ValidationSetTracking holds tracking information about a validation-set
+// applied to the system.
+type ValidationSetTracking struct {
+	AccountID string            `json:"account-id"`
+	Name      string            `json:"name"`
+	Mode      ValidationSetMode `json:"mode"`
+
+	// PinnedAt is the sequence the user pinned the validation-set at,
+	// 0 when following the latest one.
+	PinnedAt int `json:"pinned-at,omitempty"`
+	// Current is the sequence of the validation-set in use.
+	Current int `json:"current"`
+}
+
+// Key returns the key identifying the tracked validation-set.
+func (tr *ValidationSetTracking) Key() string {
+	return snapasserts.ValidationSetKey(tr.AccountID, tr.Name)
+}
+
+// ValidationSets retrieves all the validation-sets tracked by the
+// system, by key.
+func ValidationSets(st *state.State) (map[string]*ValidationSetTracking, error) {
+	var vsmap map[string]*ValidationSetTracking
+	err := st.Get("validation-sets", &vsmap)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if vsmap == nil {
+		vsmap = make(map[string]*ValidationSetTracking)
+	}
+	return vsmap, nil
+}
+
+// GetValidationSet retrieves the tracking information about the given
+// validation-set. It returns state.ErrNoState if it's not tracked.
+func GetValidationSet(st *state.State, accountID, name string, tr *ValidationSetTracking) error {
+	vsmap, err := ValidationSets(st)
+	if err != nil {
+		return err
+	}
+	cur := vsmap[snapasserts.ValidationSetKey(accountID, name)]
+	if cur == nil {
+		return state.ErrNoState
+	}
+	*tr = *cur
+	return nil
+}
+
+// UpdateValidationSet sets the tracking information about a validation-set.
+func UpdateValidationSet(st *state.State, tr *ValidationSetTracking) error {
+	vsmap, err := ValidationSets(st)
+	if err != nil {
+		return err
+	}
+	vsmap[tr.Key()] = tr
+	st.Set("validation-sets", vsmap)
+	return nil
+}
+
+// ForgetValidationSet stops tracking the given validation-set.
+func ForgetValidationSet(st *state.State, accountID, name string) error {
+	vsmap, err := ValidationSets(st)
+	if err != nil {
+		return err
+	}
+	key := snapasserts.ValidationSetKey(accountID, name)
+	if vsmap[key] == nil {
+		return fmt.Errorf("validation set %q is not tracked", key)
+	}
+	delete(vsmap, key)
+	st.Set("validation-sets", vsmap)
+	return nil
+}
+
+// ValidationSet returns the validation-set assertion with the given
+// account-id, name and sequence if it is present in the system
+// assertion database.
+func ValidationSet(st *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error) {
+	a, err := DB(st).Find(asserts.ValidationSetType, map[string]string{
+		"series":     release.Series,
+		"account-id": accountID,
+		"name":       name,
+		"sequence":   fmt.Sprint(sequence),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.ValidationSet), nil
+}
+
+func latestLocalSequence(st *state.State, accountID, name string) (int, error) {
+	as, err := DB(st).FindMany(asserts.ValidationSetType, map[string]string{
+		"series":     release.Series,
+		"account-id": accountID,
+		"name":       name,
+	})
+	if err == asserts.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, a := range as {
+		if seq := a.(*asserts.ValidationSet).Sequence(); seq > latest {
+			latest = seq
+		}
+	}
+	return latest, nil
+}
+
+// FetchValidationSet fetches the validation-set with the given account-id,
+// name and sequence into the system assertion database, unless it's
+// already there, and returns it. A zero sequence fetches the latest one.
+func FetchValidationSet(st *state.State, accountID, name string, sequence, userID int) (*asserts.ValidationSet, error) {
+	key := snapasserts.ValidationSetKey(accountID, name)
+	if sequence > 0 {
+		vs, err := ValidationSet(st, accountID, name, sequence)
+		if err == nil {
+			return vs, nil
+		}
+		if err != asserts.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	known, err := latestLocalSequence(st, accountID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := func(seq int) *asserts.Ref {
+		return &asserts.Ref{
+			Type:       asserts.ValidationSetType,
+			PrimaryKey: []string{release.Series, accountID, name, fmt.Sprint(seq)},
+		}
+	}
+	latest := known
+	fetching := func(f asserts.Fetcher) error {
+		if sequence > 0 {
+			return f.Fetch(ref(sequence))
+		}
+		// there is no way to ask for the latest one, look for
+		// newer ones than what we know about until there are no more
+		for seq := known + 1; ; seq++ {
+			err := f.Fetch(ref(seq))
+			if notFound, ok := err.(*store.AssertionNotFoundError); ok && notFound.Ref.Type == asserts.ValidationSetType {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			latest = seq
+		}
+	}
+	err = doFetch(st, userID, fetching)
+	if notFound, ok := err.(*store.AssertionNotFoundError); ok && notFound.Ref.Type == asserts.ValidationSetType {
+		return nil, fmt.Errorf("cannot find validation set %q at sequence %d", key, sequence)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if sequence == 0 {
+		if latest == 0 {
+			return nil, fmt.Errorf("cannot find validation set %q", key)
+		}
+		sequence = latest
+	}
+	vs, err := ValidationSet(st, accountID, name, sequence)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot find just fetched validation set %q: %v", key, err)
+	}
+	return vs, nil
+}
+
+// trackedValidationSets returns the combination of the tracked
+// validation-sets, with the one with the given key replaced by
+// replacement if that's not nil.
+func trackedValidationSets(st *state.State, replaceKey string, replacement *asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
+	vsmap, err := ValidationSets(st)
+	if err != nil {
+		return nil, err
+	}
+	valsets := snapasserts.NewValidationSets()
+	for key, tr := range vsmap {
+		if key == replaceKey {
+			continue
+		}
+		vs, err := ValidationSet(st, tr.AccountID, tr.Name, tr.Current)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: cannot find tracked validation set %q: %v", key, err)
+		}
+		if err := valsets.Add(vs); err != nil {
+			return nil, err
+		}
+	}
+	if replacement != nil {
+		if err := valsets.Add(replacement); err != nil {
+			return nil, err
+		}
+	}
+	return valsets, nil
+}
+
+// TrackedValidationSets returns the combination of all the
+// validation-sets tracked by the system.
+func TrackedValidationSets(st *state.State) (*snapasserts.ValidationSets, error) {
+	return trackedValidationSets(st, "", nil)
+}
+
+func installedSnaps(st *state.State) (map[string]snap.Revision, error) {
+	snapStates, err := snapstate.All(st)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]snap.Revision, len(snapStates))
+	for name, snapst := range snapStates {
+		installed[name] = snapst.Current
+	}
+	return installed, nil
+}
+
+// CheckValidationSet checks the installed snaps against the given
+// tracked validation-set alone. It returns a
+// *snapasserts.ValidationSetsValidationError if they don't match it.
+func CheckValidationSet(st *state.State, tr *ValidationSetTracking) error {
+	vs, err := ValidationSet(st, tr.AccountID, tr.Name, tr.Current)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot find tracked validation set %q: %v", tr.Key(), err)
+	}
+	valsets := snapasserts.NewValidationSets()
+	if err := valsets.Add(vs); err != nil {
+		return err
+	}
+	installed, err := installedSnaps(st)
+	if err != nil {
+		return err
+	}
+	return valsets.CheckInstalledSnaps(installed)
+}
+
+func applyValidationSet(st *state.State, accountID, name string, mode ValidationSetMode, sequence, userID int) (*ValidationSetTracking, *asserts.ValidationSet, error) {
+	key := snapasserts.ValidationSetKey(accountID, name)
+	vs, err := FetchValidationSet(st, accountID, name, sequence, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// check that it can be combined with the other tracked sets
+	if _, err := trackedValidationSets(st, key, vs); err != nil {
+		return nil, nil, fmt.Errorf("cannot apply validation set %q: %v", key, err)
+	}
+	tr := &ValidationSetTracking{
+		AccountID: accountID,
+		Name:      name,
+		Mode:      mode,
+		PinnedAt:  sequence,
+		Current:   vs.Sequence(),
+	}
+	return tr, vs, nil
+}
+
+// MonitorValidationSet starts tracking the given validation-set in
+// monitor mode, pinned at sequence unless that's 0. From then on
+// operations on snaps that would violate it are refused.
+func MonitorValidationSet(st *state.State, accountID, name string, sequence, userID int) (*ValidationSetTracking, error) {
+	tr, _, err := applyValidationSet(st, accountID, name, Monitor, sequence, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := UpdateValidationSet(st, tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// EnforceValidationSet starts tracking the given validation-set in
+// enforce mode, pinned at sequence unless that's 0. It returns the task
+// sets to install the missing required snaps and to refresh the snaps
+// that are not at the revision the validation-set pins them at.
+func EnforceValidationSet(st *state.State, accountID, name string, sequence, userID int) (*ValidationSetTracking, []*state.TaskSet, error) {
+	key := snapasserts.ValidationSetKey(accountID, name)
+	tr, vs, err := applyValidationSet(st, accountID, name, Enforce, sequence, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	installed, err := installedSnaps(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	valsets := snapasserts.NewValidationSets()
+	if err := valsets.Add(vs); err != nil {
+		return nil, nil, err
+	}
+	var verr *snapasserts.ValidationSetsValidationError
+	if err := valsets.CheckInstalledSnaps(installed); err != nil {
+		verr = err.(*snapasserts.ValidationSetsValidationError)
+	}
+	if verr != nil && len(verr.InvalidSnaps) != 0 {
+		return nil, nil, fmt.Errorf("cannot enforce validation set %q: %v", key, verr)
+	}
+
+	// track the set first, so that the new operations are checked
+	// against it as well
+	var old ValidationSetTracking
+	err = GetValidationSet(st, accountID, name, &old)
+	if err != nil && err != state.ErrNoState {
+		return nil, nil, err
+	}
+	hadOld := err == nil
+	if err := UpdateValidationSet(st, tr); err != nil {
+		return nil, nil, err
+	}
+
+	tss, err := enforceTasks(st, valsets, verr, userID)
+	if err != nil {
+		if hadOld {
+			UpdateValidationSet(st, &old)
+		} else {
+			ForgetValidationSet(st, accountID, name)
+		}
+		return nil, nil, fmt.Errorf("cannot enforce validation set %q: %v", key, err)
+	}
+	return tr, tss, nil
+}
+
+func enforceTasks(st *state.State, valsets *snapasserts.ValidationSets, verr *snapasserts.ValidationSetsValidationError, userID int) ([]*state.TaskSet, error) {
+	if verr == nil {
+		return nil, nil
+	}
+	var tss []*state.TaskSet
+	for _, name := range verr.MissingSnaps {
+		rev := valsets.Constraints(name).Revision
+		ts, err := snapstate.Install(st, name, "", rev, userID, snapstate.Flags{})
+		if err != nil {
+			return nil, err
+		}
+		tss = append(tss, ts)
+	}
+	names := make([]string, 0, len(verr.WrongRevisionSnaps))
+	for name := range verr.WrongRevisionSnaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ts, err := snapstate.Update(st, name, "", verr.WrongRevisionSnaps[name], userID, snapstate.Flags{})
+		if err != nil {
+			return nil, err
+		}
+		tss = append(tss, ts)
+	}
+	return tss, nil
+}
+
+func init() {
+	// hook the tracked validation sets into snapstate
+	snapstate.TrackedValidationSets = TrackedValidationSets
+}
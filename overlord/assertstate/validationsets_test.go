@@ -0,0 +1,227 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate_test
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *assertMgrSuite) mockValidationSet(c *C, name string, sequence int, snaps ...interface{}) *asserts.ValidationSet {
+	headers := map[string]interface{}{
+		"series":     "16",
+		"account-id": s.dev1Acct.AccountID(),
+		"name":       name,
+		"sequence":   fmt.Sprint(sequence),
+		"snaps":      snaps,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+	a, err := s.dev1Signing.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+	err = s.storeSigning.Add(a)
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func setSnap(name, presence string, revision int) map[string]interface{} {
+	m := map[string]interface{}{
+		"name": name,
+		"id":   (name + "snapidsnapidsnapidsnapidsnapid")[:32],
+	}
+	if presence != "" {
+		m["presence"] = presence
+	}
+	if revision != 0 {
+		m["revision"] = fmt.Sprint(revision)
+	}
+	return m
+}
+
+func (s *assertMgrSuite) mockInstalledSnap(name string, revision int) {
+	si := &snap.SideInfo{
+		RealName: name,
+		SnapID:   (name + "snapidsnapidsnapidsnapidsnapid")[:32],
+		Revision: snap.R(revision),
+	}
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+}
+
+func (s *assertMgrSuite) TestFetchValidationSet(c *C) {
+	s.mockValidationSet(c, "fleet", 1, setSnap("foo", "", 0))
+	s.mockValidationSet(c, "fleet", 2, setSnap("foo", "", 7))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	accountID := s.dev1Acct.AccountID()
+	vs, err := assertstate.FetchValidationSet(s.state, accountID, "fleet", 1, 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 1)
+
+	// latest
+	vs, err = assertstate.FetchValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 2)
+
+	// now in the system database
+	vs, err = assertstate.ValidationSet(s.state, accountID, "fleet", 2)
+	c.Assert(err, IsNil)
+	c.Check(vs.Snaps()[0].Revision, Equals, 7)
+
+	// a newer one appears
+	s.mockValidationSet(c, "fleet", 3, setSnap("foo", "", 8))
+	vs, err = assertstate.FetchValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 3)
+
+	_, err = assertstate.FetchValidationSet(s.state, accountID, "fleet", 9, 0)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot find validation set "%s/fleet" at sequence 9`, accountID))
+
+	_, err = assertstate.FetchValidationSet(s.state, accountID, "other", 0, 0)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot find validation set "%s/other"`, accountID))
+}
+
+func (s *assertMgrSuite) TestMonitorAndForgetValidationSet(c *C) {
+	s.mockValidationSet(c, "fleet", 1, setSnap("foo", "", 0), setSnap("bar", "invalid", 0))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	accountID := s.dev1Acct.AccountID()
+	tr, err := assertstate.MonitorValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr, DeepEquals, &assertstate.ValidationSetTracking{
+		AccountID: accountID,
+		Name:      "fleet",
+		Mode:      assertstate.Monitor,
+		Current:   1,
+	})
+
+	var tr2 assertstate.ValidationSetTracking
+	err = assertstate.GetValidationSet(s.state, accountID, "fleet", &tr2)
+	c.Assert(err, IsNil)
+	c.Check(&tr2, DeepEquals, tr)
+
+	valsets, err := assertstate.TrackedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(valsets.Keys(), DeepEquals, []string{accountID + "/fleet"})
+
+	// foo is missing
+	err = assertstate.CheckValidationSet(s.state, tr)
+	c.Assert(err, FitsTypeOf, &snapasserts.ValidationSetsValidationError{})
+	c.Check(err.(*snapasserts.ValidationSetsValidationError).MissingSnaps, DeepEquals, []string{"foo"})
+
+	s.mockInstalledSnap("foo", 1)
+	c.Check(assertstate.CheckValidationSet(s.state, tr), IsNil)
+
+	err = assertstate.ForgetValidationSet(s.state, accountID, "fleet")
+	c.Assert(err, IsNil)
+	err = assertstate.GetValidationSet(s.state, accountID, "fleet", &tr2)
+	c.Check(err, Equals, state.ErrNoState)
+
+	err = assertstate.ForgetValidationSet(s.state, accountID, "fleet")
+	c.Check(err, ErrorMatches, fmt.Sprintf(`validation set "%s/fleet" is not tracked`, accountID))
+}
+
+func (s *assertMgrSuite) TestUpdateValidationSetBadState(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("validation-sets", "garbage")
+	err := assertstate.UpdateValidationSet(s.state, &assertstate.ValidationSetTracking{
+		AccountID: "acc", Name: "fleet", Mode: assertstate.Monitor, Current: 1,
+	})
+	c.Check(err, ErrorMatches, `internal error: could not unmarshal state entry "validation-sets": .*`)
+}
+
+func (s *assertMgrSuite) TestMonitorValidationSetConflict(c *C) {
+	s.mockValidationSet(c, "one", 1, setSnap("foo", "", 1))
+	s.mockValidationSet(c, "two", 1, setSnap("foo", "", 2))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	accountID := s.dev1Acct.AccountID()
+	_, err := assertstate.MonitorValidationSet(s.state, accountID, "one", 1, 0)
+	c.Assert(err, IsNil)
+
+	_, err = assertstate.MonitorValidationSet(s.state, accountID, "two", 1, 0)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot apply validation set "%[1]s/two": validation set "%[1]s/two" is in conflict with "%[1]s/one" about snap "foo"`, accountID))
+
+	vsmap, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsmap, HasLen, 1)
+}
+
+func (s *assertMgrSuite) TestEnforceValidationSet(c *C) {
+	s.mockValidationSet(c, "fleet", 1, setSnap("foo", "", 0), setSnap("bar", "invalid", 0))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	accountID := s.dev1Acct.AccountID()
+	s.mockInstalledSnap("bar", 1)
+
+	_, _, err := assertstate.EnforceValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot enforce validation set "%s/fleet": validation sets are not met: missing required snaps: foo; invalid snaps installed: bar`, accountID))
+	vsmap, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(vsmap, HasLen, 0)
+
+	snapstate.Set(s.state, "bar", nil)
+	s.mockInstalledSnap("foo", 3)
+
+	tr, tss, err := assertstate.EnforceValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(tss, HasLen, 0)
+	c.Check(tr.Mode, Equals, assertstate.Enforce)
+	c.Check(tr.Current, Equals, 1)
+}
+
+func (s *assertMgrSuite) TestValidationSetsGateSnapstate(c *C) {
+	s.mockValidationSet(c, "fleet", 1, setSnap("foo", "", 0), setSnap("bar", "invalid", 0))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	accountID := s.dev1Acct.AccountID()
+	s.mockInstalledSnap("foo", 1)
+	_, err := assertstate.MonitorValidationSet(s.state, accountID, "fleet", 0, 0)
+	c.Assert(err, IsNil)
+
+	_, err = snapstate.Remove(s.state, "foo", snap.R(0), nil)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot remove: snap "foo" is required by validation sets "%s/fleet"`, accountID))
+
+	_, err = snapstate.Install(s.state, "bar", "", snap.R(0), 0, snapstate.Flags{})
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot install: snap "bar" is invalid in validation sets "%s/fleet"`, accountID))
+}
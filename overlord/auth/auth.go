@@ -24,6 +24,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
@@ -340,6 +341,9 @@ type DeviceAssertions interface {
 
 	// DeviceSessionRequest produces a device-session-request with the given nonce, it also returns the device serial assertion.
 	DeviceSessionRequest(nonce string) (*asserts.DeviceSessionRequest, *asserts.Serial, error)
+
+	// ProxyStore returns the store assertion for the proxy store if one is set.
+	ProxyStore() (*asserts.Store, error)
 }
 
 var (
@@ -358,6 +362,8 @@ type AuthContext interface {
 	StoreID(fallback string) (string, error)
 
 	DeviceSessionRequest(nonce string) (devSessionRequest []byte, serial []byte, err error)
+
+	ProxyStoreURL() (*url.URL, error)
 }
 
 // authContext helps keeping track of auth data in the state and exposing it.
@@ -457,3 +463,19 @@ func (ac *authContext) DeviceSessionRequest(nonce string) (deviceSessionRequest
 	}
 	return asserts.Encode(req), asserts.Encode(ser), nil
 }
+
+// ProxyStoreURL returns the URL of the proxy store to use instead of
+// the default store, or nil if there is none.
+func (ac *authContext) ProxyStoreURL() (*url.URL, error) {
+	if ac.deviceAsserts == nil {
+		return nil, nil
+	}
+	proxyStore, err := ac.deviceAsserts.ProxyStore()
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return proxyStore.URL(), nil
+}
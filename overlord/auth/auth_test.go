@@ -525,6 +525,14 @@ func (as *authSuite) TestAuthContextStoreIDFromEnv(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(storeID, Equals, "env-store-id")
 }
+func (as *authSuite) TestAuthContextProxyStoreURLNilDeviceAssertions(c *C) {
+	authContext := auth.NewAuthContext(as.state, nil)
+
+	proxyStoreURL, err := authContext.ProxyStoreURL()
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreURL, IsNil)
+}
+
 func (as *authSuite) TestAuthContextDeviceSessionRequestNilDeviceAssertions(c *C) {
 	authContext := auth.NewAuthContext(as.state, nil)
 
@@ -567,6 +575,16 @@ device-key-sha3-384: EAD4DbLxK_kn0gzNCXOs3kd6DeMU3f-L6BEsSEuJGBqCORR0gXkdDxMbOm1
 timestamp: 2016-08-24T21:55:00Z
 sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
 
+AXNpZw=`
+
+	exStore = `type: store
+authority-id: my-brand
+store: my-proxy-store
+operator-id: my-brand
+url: https://proxy.example.com/
+timestamp: 2016-08-24T21:55:00Z
+sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij
+
 AXNpZw=`
 
 	exDeviceSessionRequest = `type: device-session-request
@@ -624,6 +642,17 @@ func (da *testDeviceAssertions) DeviceSessionRequest(nonce string) (*asserts.Dev
 	return a1.(*asserts.DeviceSessionRequest), a2.(*asserts.Serial), nil
 }
 
+func (da *testDeviceAssertions) ProxyStore() (*asserts.Store, error) {
+	if da.nothing {
+		return nil, state.ErrNoState
+	}
+	a, err := asserts.Decode([]byte(exStore))
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.Store), nil
+}
+
 func (as *authSuite) TestAuthContextMissingDeviceAssertions(c *C) {
 	// no assertions in state
 	authContext := auth.NewAuthContext(as.state, &testDeviceAssertions{nothing: true})
@@ -634,6 +663,9 @@ func (as *authSuite) TestAuthContextMissingDeviceAssertions(c *C) {
 	storeID, err := authContext.StoreID("fallback")
 	c.Assert(err, IsNil)
 	c.Check(storeID, Equals, "fallback")
+	proxyStoreURL, err := authContext.ProxyStoreURL()
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreURL, IsNil)
 }
 
 func (as *authSuite) TestAuthContextWithDeviceAssertions(c *C) {
@@ -649,6 +681,9 @@ func (as *authSuite) TestAuthContextWithDeviceAssertions(c *C) {
 	storeID, err := authContext.StoreID("store-id")
 	c.Assert(err, IsNil)
 	c.Check(storeID, Equals, "my-brand-store-id")
+	proxyStoreURL, err := authContext.ProxyStoreURL()
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreURL.String(), Equals, "https://proxy.example.com/")
 }
 
 func (as *authSuite) TestUsers(c *C) {
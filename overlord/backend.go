@@ -20,20 +20,25 @@
 package overlord
 
 import (
+	"encoding/json"
 	"time"
 
-	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
 type overlordStateBackend struct {
-	path           string
+	journal        *state.Journal
 	ensureBefore   func(d time.Duration)
 	requestRestart func(t state.RestartType)
 }
 
 func (osb *overlordStateBackend) Checkpoint(data []byte) error {
-	return osutil.AtomicWriteFile(osb.path, data, 0600, 0)
+	return osb.journal.Checkpoint(data)
+}
+
+func (osb *overlordStateBackend) CheckpointEntries(entries map[string]*json.RawMessage) error {
+	return osb.journal.CheckpointEntries(entries)
 }
 
 func (osb *overlordStateBackend) EnsureBefore(d time.Duration) {
@@ -41,5 +46,10 @@ func (osb *overlordStateBackend) EnsureBefore(d time.Duration) {
 }
 
 func (osb *overlordStateBackend) RequestRestart(t state.RestartType) {
+	// whatever runs after the restart, possibly an older snapd not
+	// knowing about the journal, reads the state file
+	if err := osb.journal.CompactAlways(); err != nil {
+		logger.Noticef("cannot compact the state journal before restarting: %v", err)
+	}
 	osb.requestRestart(t)
 }
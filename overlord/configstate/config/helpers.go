@@ -24,6 +24,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/snapcore/snapd/overlord/state"
 )
 
 var validKey = regexp.MustCompile("^(?:[a-z0-9]+-?)*[a-z](?:-?[a-z0-9])*$")
@@ -116,3 +118,40 @@ func GetFromChange(snapName string, subkeys []string, pos int, config map[string
 	}
 	return GetFromChange(snapName, subkeys, pos+1, configm, result)
 }
+
+// GetSnapConfig returns the whole configuration of the given snap, or nil
+// if it has none.
+//
+// The provided state must be locked by the caller.
+func GetSnapConfig(st *state.State, snapName string) (map[string]interface{}, error) {
+	var config map[string]map[string]interface{}
+	err := st.Get("config", &config)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot unmarshal configuration: %v", err)
+	}
+	return config[snapName], nil
+}
+
+// SetSnapConfig replaces the whole configuration of the given snap with
+// the provided one, removing it if it is empty.
+//
+// The provided state must be locked by the caller.
+func SetSnapConfig(st *state.State, snapName string, snapConfig map[string]interface{}) error {
+	var config map[string]map[string]interface{}
+	err := st.Get("config", &config)
+	if err == state.ErrNoState {
+		config = make(map[string]map[string]interface{})
+	} else if err != nil {
+		return fmt.Errorf("internal error: cannot unmarshal configuration: %v", err)
+	}
+	if len(snapConfig) == 0 {
+		delete(config, snapName)
+	} else {
+		config[snapName] = snapConfig
+	}
+	st.Set("config", config)
+	return nil
+}
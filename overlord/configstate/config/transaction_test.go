@@ -282,3 +282,37 @@ func (s *transactionSuite) TestGetUnmarshalError(c *C) {
 	err = tr.Get("test-snap", "foo", &broken)
 	c.Assert(err, ErrorMatches, ".*BAM!.*")
 }
+
+func (s *transactionSuite) TestGetSetSnapConfig(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	conf, err := config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(conf, IsNil)
+
+	c.Check(s.transaction.Set("test-snap", "foo.bar", "baz"), IsNil)
+	c.Check(s.transaction.Set("other-snap", "foo", 42), IsNil)
+	s.transaction.Commit()
+
+	conf, err = config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(conf, DeepEquals, map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}})
+
+	c.Assert(config.SetSnapConfig(s.state, "test-snap", map[string]interface{}{"x": "y"}), IsNil)
+	tr := config.NewTransaction(s.state)
+	var x string
+	c.Check(tr.Get("test-snap", "x", &x), IsNil)
+	c.Check(x, Equals, "y")
+	c.Check(tr.Get("test-snap", "foo", &x), ErrorMatches, `snap "test-snap" has no "foo" configuration option`)
+
+	c.Assert(config.SetSnapConfig(s.state, "test-snap", nil), IsNil)
+	conf, err = config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(conf, IsNil)
+
+	// other snaps are left alone
+	var n int
+	c.Check(config.NewTransaction(s.state).Get("other-snap", "foo", &n), IsNil)
+	c.Check(n, Equals, 42)
+}
@@ -20,8 +20,11 @@
 package configstate
 
 import (
+	"fmt"
+
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
 )
 
 // configureHandler is the handler for the configure hook.
@@ -69,6 +72,11 @@ func (h *configureHandler) Before() error {
 	// context.
 	var patch map[string]interface{}
 	if err := h.context.Get("patch", &patch); err == nil {
+		if h.context.SnapName() == "core" {
+			if err := validateCorePatch(patch); err != nil {
+				return err
+			}
+		}
 		for key, value := range patch {
 			tr.Set(h.context.SnapName(), key, value)
 		}
@@ -77,6 +85,35 @@ func (h *configureHandler) Before() error {
 	return nil
 }
 
+// coreValidators check the options of the core snap that are used by
+// snapd itself.
+var coreValidators = map[string]func(string) error{
+	"refresh.schedule": snapstate.ValidateRefreshSchedule,
+	"refresh.hold":     snapstate.ValidateRefreshHold,
+	"refresh.metered":  snapstate.ValidateRefreshMetered,
+}
+
+func validateCorePatch(patch map[string]interface{}) error {
+	for key, value := range patch {
+		validate := coreValidators[key]
+		if validate == nil {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("cannot set %q: want a string", key)
+		}
+		// unsetting is always fine
+		if s == "" {
+			continue
+		}
+		if err := validate(s); err != nil {
+			return fmt.Errorf("cannot set %q: %s", key, err)
+		}
+	}
+	return nil
+}
+
 // Done is called by the HookManager after the configure hook has exited
 // successfully.
 func (h *configureHandler) Done() error {
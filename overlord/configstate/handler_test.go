@@ -73,3 +73,38 @@ func (s *configureHandlerSuite) TestBeforeInitializesTransaction(c *C) {
 	c.Check(tr.Get("test-snap", "foo", &value), IsNil)
 	c.Check(value, Equals, "bar")
 }
+
+func (s *configureHandlerSuite) TestBeforeValidatesCoreRefreshOptions(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "core", Revision: snap.R(1), Hook: "configure"}
+	context, err := hookstate.NewContext(task, setup, hooktest.NewMockHandler())
+	st.Unlock()
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		key, value string
+		errStr     string
+	}{
+		{"refresh.schedule", "mon-fri@9:00-11:00/sat1@13:00-15:00", ""},
+		{"refresh.schedule", "", ""},
+		{"refresh.schedule", "mon@9:00", `cannot set "refresh.schedule": cannot parse "9:00": not a valid interval`},
+		{"refresh.hold", "2017-08-10T15:04:05+02:00", ""},
+		{"refresh.hold", "tomorrow", `cannot set "refresh.hold": cannot parse "tomorrow": want a RFC3339 timestamp`},
+		{"refresh.metered", "hold", ""},
+		{"refresh.metered", "sometimes", `cannot set "refresh.metered": cannot parse "sometimes": want "hold" or ""`},
+		{"other", "anything", ""},
+	} {
+		context.Lock()
+		context.Set("patch", map[string]interface{}{t.key: t.value})
+		context.Unlock()
+
+		err := configstate.NewConfigureHandler(context).Before()
+		if t.errStr == "" {
+			c.Check(err, IsNil, Commentf("%s=%s", t.key, t.value))
+		} else {
+			c.Check(err, ErrorMatches, t.errStr)
+		}
+	}
+}
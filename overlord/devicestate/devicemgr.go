@@ -862,6 +862,14 @@ func (m *DeviceManager) Serial() (*asserts.Serial, error) {
 	return Serial(m.state)
 }
 
+// ProxyStore returns the store assertion for the proxy store if one is set.
+func (m *DeviceManager) ProxyStore() (*asserts.Store, error) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	return ProxyStore(m.state)
+}
+
 // DeviceSessionRequest produces a device-session-request with the given nonce, it also returns the device serial assertion.
 func (m *DeviceManager) DeviceSessionRequest(nonce string) (*asserts.DeviceSessionRequest, *asserts.Serial, error) {
 	m.state.Lock()
@@ -944,6 +952,44 @@ func Serial(st *state.State) (*asserts.Serial, error) {
 	return a.(*asserts.Serial), nil
 }
 
+// ProxyStore returns the store assertion for the proxy store set
+// with the store-proxy core configuration option. It returns
+// state.ErrNoState if no proxy store is set.
+func ProxyStore(st *state.State) (*asserts.Store, error) {
+	var proxyStore string
+	err := config.NewTransaction(st).GetMaybe("core", "store-proxy", &proxyStore)
+	if err != nil {
+		return nil, err
+	}
+	if proxyStore == "" {
+		return nil, state.ErrNoState
+	}
+
+	a, err := assertstate.DB(st).Find(asserts.StoreType, map[string]string{
+		"store": proxyStore,
+	})
+	if err == asserts.ErrNotFound {
+		return nil, fmt.Errorf("cannot find store assertion for proxy store %q", proxyStore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sto := a.(*asserts.Store)
+
+	model, err := Model(st)
+	if err == state.ErrNoState {
+		return nil, fmt.Errorf("cannot use proxy store %q: no model assertion yet", proxyStore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sto.ServesModel(model.BrandID(), model.Model()) {
+		return nil, fmt.Errorf("cannot use proxy store %q: it does not serve model %s/%s", proxyStore, model.BrandID(), model.Model())
+	}
+
+	return sto, nil
+}
+
 func checkGadgetOrKernel(st *state.State, snapInfo, curInfo *snap.Info, flags snapstate.Flags) error {
 	kind := ""
 	var currentInfo func(*state.State) (*snap.Info, error)
@@ -42,6 +42,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
@@ -103,8 +104,8 @@ func (sto *fakeStore) Find(*store.Search, *auth.UserState) ([]*snap.Info, error)
 	panic("fakeStore.Find not expected")
 }
 
-func (sto *fakeStore) ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error) {
-	panic("fakeStore.ListRefresh not expected")
+func (sto *fakeStore) SnapAction([]*store.CurrentSnap, []*store.SnapAction, *auth.UserState) ([]*snap.Info, error) {
+	panic("fakeStore.SnapAction not expected")
 }
 
 func (sto *fakeStore) Download(context.Context, string, string, *snap.DownloadInfo, progress.Meter, *auth.UserState) error {
@@ -1550,3 +1551,73 @@ func (s *deviceMgrSuite) TestCanAutoRefreshOnClassic(c *C) {
 	s.state.Set("seeded", false)
 	c.Check(canAutoRefresh(), Equals, false)
 }
+
+func (s *deviceMgrSuite) TestProxyStore(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.setupBrands(c)
+
+	setProxyStore := func(name string) {
+		tr := config.NewTransaction(s.state)
+		err := tr.Set("core", "store-proxy", name)
+		c.Assert(err, IsNil)
+		tr.Commit()
+	}
+
+	// nothing set
+	_, err := devicestate.ProxyStore(s.state)
+	c.Check(err, Equals, state.ErrNoState)
+
+	// set but no assertion
+	setProxyStore("foo")
+	_, err = devicestate.ProxyStore(s.state)
+	c.Check(err, ErrorMatches, `cannot find store assertion for proxy store "foo"`)
+
+	stoAs, err := s.brandSigning.Sign(asserts.StoreType, map[string]interface{}{
+		"store":       "foo",
+		"operator-id": "my-brand",
+		"url":         "https://foo.example.com",
+		"timestamp":   time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = assertstate.Add(s.state, stoAs)
+	c.Assert(err, IsNil)
+
+	// no model yet
+	_, err = devicestate.ProxyStore(s.state)
+	c.Check(err, ErrorMatches, `cannot use proxy store "foo": no model assertion yet`)
+
+	// model of another brand
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	s.makeModelAssertionInState(c, "canonical", "pc", map[string]string{
+		"classic": "true",
+	})
+	_, err = devicestate.ProxyStore(s.state)
+	c.Check(err, ErrorMatches, `cannot use proxy store "foo": it does not serve model canonical/pc`)
+
+	// model of the operator
+	auth.SetDevice(s.state, &auth.DeviceState{
+		Brand: "my-brand",
+		Model: "my-model",
+	})
+	model, err := s.brandSigning.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "my-brand",
+		"model":        "my-model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = assertstate.Add(s.state, model)
+	c.Assert(err, IsNil)
+
+	sto, err := devicestate.ProxyStore(s.state)
+	c.Assert(err, IsNil)
+	c.Check(sto.Store(), Equals, "foo")
+	c.Check(sto.URL().String(), Equals, "https://foo.example.com/")
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -129,8 +130,13 @@ func populateStateFromSeedImpl(st *state.State) ([]*state.TaskSet, error) {
 		return nil, fmt.Errorf("cannot proceed, no snaps to seed")
 	}
 
-	ts := tsAll[len(tsAll)-1]
-	markSeeded.WaitAll(ts)
+	// make the connections requested by the gadget once all the
+	// snaps are installed
+	gadgetConnect := ifacestate.GadgetConnect(st)
+	gadgetConnect.WaitAll(tsAll[len(tsAll)-1])
+	tsAll = append(tsAll, gadgetConnect)
+
+	markSeeded.WaitAll(gadgetConnect)
 	tsAll = append(tsAll, state.NewTaskSet(markSeeded))
 
 	return tsAll, nil
@@ -163,6 +163,11 @@ func (c *Context) Get(key string, value interface{}) error {
 	return nil
 }
 
+// Task returns the task associated with the hook.
+func (c *Context) Task() *state.Task {
+	return c.task
+}
+
 // State returns the state contained within the context
 func (c *Context) State() *state.State {
 	return c.task.State()
@@ -75,6 +75,16 @@ type command interface {
 	Execute(args []string) error
 }
 
+// UnsuccessfulError is returned by commands that ran fine but want
+// snapctl to exit with a non-zero exit code, without an error message.
+type UnsuccessfulError struct {
+	ExitCode int
+}
+
+func (e *UnsuccessfulError) Error() string {
+	return fmt.Sprintf("unsuccessful with exit code: %d", e.ExitCode)
+}
+
 type commandInfo struct {
 	shortHelp string
 	longHelp  string
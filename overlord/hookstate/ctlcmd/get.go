@@ -280,21 +280,25 @@ func (c *getCommand) getInterfaceSetting(context *hookstate.Context, plugOrSlot
 		return err
 	}
 
-	var which string
+	var staticWhich, which string
 	if c.ForcePlugSide || (isPlugSide && !c.ForceSlotSide) {
-		which = "plug-attrs"
+		staticWhich, which = "plug-attrs", "plug-dynamic"
 	} else {
-		which = "slot-attrs"
+		staticWhich, which = "slot-attrs", "slot-dynamic"
 	}
 
 	st := context.State()
 	st.Lock()
 	defer st.Unlock()
 
+	// static attributes take precedence over the ones set by the hooks
 	attributes := make(map[string]interface{})
-	if err = attrsTask.Get(which, &attributes); err != nil {
+	if err = attrsTask.Get(which, &attributes); err != nil && err != state.ErrNoState {
 		return fmt.Errorf(i18n.G("internal error: cannot get %s from appropriate task"), which)
 	}
+	if err = attrsTask.Get(staticWhich, &attributes); err != nil {
+		return fmt.Errorf(i18n.G("internal error: cannot get %s from appropriate task"), staticWhich)
+	}
 
 	return c.printValues(func(key string) (interface{}, bool, error) {
 		if value, ok := attributes[key]; ok {
@@ -0,0 +1,141 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// getServiceInfos returns the services of snapName matching the given
+// names, which can be either the snap name itself (meaning all of its
+// services) or <snap>.<app>. Names of services of other snaps are
+// refused, hooks can only act on the services of their own snap.
+func getServiceInfos(st *state.State, snapName string, serviceNames []string) ([]*snap.AppInfo, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	var snapst snapstate.SnapState
+	if err := snapstate.Get(st, snapName, &snapst); err != nil {
+		return nil, err
+	}
+
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var svcs []*snap.AppInfo
+	for _, name := range serviceNames {
+		if name == snapName {
+			// all the services of the snap
+			for _, app := range info.Apps {
+				if app.IsService() {
+					svcs = append(svcs, app)
+				}
+			}
+			continue
+		}
+
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) != 2 || parts[0] != snapName {
+			return nil, fmt.Errorf(i18n.G("unknown service: %q"), name)
+		}
+		app, ok := info.Apps[parts[1]]
+		if !ok || !app.IsService() {
+			return nil, fmt.Errorf(i18n.G("unknown service: %q"), name)
+		}
+		svcs = append(svcs, app)
+	}
+
+	sort.Sort(byAppName(svcs))
+
+	return svcs, nil
+}
+
+type byAppName []*snap.AppInfo
+
+func (a byAppName) Len() int           { return len(a) }
+func (a byAppName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byAppName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// queueCommand adds the given task set to the change of the hook,
+// to be run once all the tasks already in the change are done, the
+// hook included.
+func queueCommand(context *hookstate.Context, ts *state.TaskSet) error {
+	st := context.State()
+	st.Lock()
+	defer st.Unlock()
+
+	hookTask := context.Task()
+	chg := hookTask.Change()
+	if chg == nil {
+		return fmt.Errorf("internal error: hook task %s has no change", hookTask.ID())
+	}
+
+	ts.WaitAll(state.NewTaskSet(chg.Tasks()...))
+	chg.AddAll(ts)
+
+	// the hook task might have been the last one of its change, make
+	// sure the new tasks are considered right away
+	st.EnsureBefore(0)
+
+	return nil
+}
+
+// runServiceCommand queues the service-control tasks carrying out the
+// given action on the named services of the snap of the hook.
+func runServiceCommand(context *hookstate.Context, inst *servicestate.Instruction, serviceNames []string) error {
+	if context == nil {
+		return fmt.Errorf(i18n.G("cannot %s without a context"), inst.Action)
+	}
+
+	st := context.State()
+	appInfos, err := getServiceInfos(st, context.SnapName(), serviceNames)
+	if err != nil {
+		return err
+	}
+	if len(appInfos) == 0 {
+		return fmt.Errorf(i18n.G("snap %q has no services"), context.SnapName())
+	}
+
+	st.Lock()
+	// the change of the hook is not a conflict, the tasks are
+	// queued into it
+	var hookChangeID string
+	if chg := context.Task().Change(); chg != nil {
+		hookChangeID = chg.ID()
+	}
+	ts, err := servicestate.Control(st, appInfos, inst, hookChangeID)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return queueCommand(context, ts)
+}
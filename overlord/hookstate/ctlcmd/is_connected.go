@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+)
+
+var (
+	shortIsConnectedHelp = i18n.G("Return success if the given plug or slot is connected")
+	longIsConnectedHelp  = i18n.G(`
+The is-connected command exits with success if the given plug or slot of
+the snap is connected, and with exit code 1 otherwise.
+
+    $ snapctl is-connected network && echo connected
+`)
+)
+
+type isConnectedCommand struct {
+	baseCommand
+	Positional struct {
+		PlugOrSlot string `positional-arg-name:"<plug|slot>" required:"yes"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	addCommand("is-connected", shortIsConnectedHelp, longIsConnectedHelp, func() command { return &isConnectedCommand{} })
+}
+
+func (c *isConnectedCommand) Execute(args []string) error {
+	context := c.context()
+	if context == nil {
+		return errors.New(i18n.G("cannot check connection status without a context"))
+	}
+
+	snapName := context.SnapName()
+	plugOrSlot := c.Positional.PlugOrSlot
+
+	st := context.State()
+	st.Lock()
+	conns, err := ifacestate.ConnectionStates(st)
+	st.Unlock()
+	if err != nil {
+		return fmt.Errorf(i18n.G("internal error: cannot get connections: %s"), err)
+	}
+
+	for connID, conn := range conns {
+		if conn.Undesired {
+			continue
+		}
+		connRef, err := interfaces.ParseConnRef(connID)
+		if err != nil {
+			return fmt.Errorf(i18n.G("internal error: %s"), err)
+		}
+
+		if (connRef.PlugRef.Snap == snapName && connRef.PlugRef.Name == plugOrSlot) ||
+			(connRef.SlotRef.Snap == snapName && connRef.SlotRef.Name == plugOrSlot) {
+			return nil
+		}
+	}
+
+	return &UnsuccessfulError{ExitCode: 1}
+}
@@ -0,0 +1,81 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type isConnectedSuite struct {
+	st          *state.State
+	mockContext *hookstate.Context
+}
+
+var _ = Suite(&isConnectedSuite{})
+
+func (s *isConnectedSuite) SetUpTest(c *C) {
+	s.st = state.New(nil)
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.st.Set("conns", map[string]interface{}{
+		"test-snap:plug1 other-snap:slot": map[string]interface{}{"interface": "x11"},
+		"other-snap:plug test-snap:slot1": map[string]interface{}{"interface": "x11"},
+		"test-snap:plug3 other-snap:slot": map[string]interface{}{"interface": "x11", "auto": true, "undesired": true},
+	})
+
+	task := s.st.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "test-hook"}
+
+	var err error
+	s.mockContext, err = hookstate.NewContext(task, setup, hooktest.NewMockHandler())
+	c.Assert(err, IsNil)
+}
+
+func (s *isConnectedSuite) TestIsConnected(c *C) {
+	for _, name := range []string{"plug1", "slot1"} {
+		stdout, stderr, err := ctlcmd.Run(s.mockContext, []string{"is-connected", name})
+		c.Check(err, IsNil, Commentf(name))
+		c.Check(string(stdout), Equals, "")
+		c.Check(string(stderr), Equals, "")
+	}
+}
+
+func (s *isConnectedSuite) TestIsNotConnected(c *C) {
+	// "plug" and "slot" are the other snap's, "plug3" was disconnected
+	for _, name := range []string{"plug2", "plug", "slot", "plug3"} {
+		_, _, err := ctlcmd.Run(s.mockContext, []string{"is-connected", name})
+		c.Check(err, DeepEquals, &ctlcmd.UnsuccessfulError{ExitCode: 1}, Commentf(name))
+	}
+}
+
+func (s *isConnectedSuite) TestIsConnectedErrors(c *C) {
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"is-connected"})
+	c.Check(err, ErrorMatches, `.*required argument .* not provided`)
+
+	_, _, err = ctlcmd.Run(nil, []string{"is-connected", "plug1"})
+	c.Check(err, ErrorMatches, "cannot check connection status without a context")
+}
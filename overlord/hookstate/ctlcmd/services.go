@@ -0,0 +1,101 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/systemd"
+)
+
+var (
+	shortServicesHelp = i18n.G("Query the status of services")
+	longServicesHelp  = i18n.G(`
+The services command lists information about the services specified, or
+about all the services of the snap.
+
+    $ snapctl services
+    Service        Startup  Current
+    mysnap.daemon  enabled  active
+`)
+)
+
+type servicesCommand struct {
+	baseCommand
+	Positional struct {
+		ServiceNames []string `positional-arg-name:"<service>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("services", shortServicesHelp, longServicesHelp, func() command { return &servicesCommand{} })
+}
+
+func (c *servicesCommand) Execute(args []string) error {
+	context := c.context()
+	if context == nil {
+		return errors.New(i18n.G("cannot query services without a context"))
+	}
+
+	snapName := context.SnapName()
+	serviceNames := c.Positional.ServiceNames
+	if len(serviceNames) == 0 {
+		serviceNames = []string{snapName}
+	}
+
+	svcs, err := getServiceInfos(context.State(), snapName, serviceNames)
+	if err != nil {
+		return err
+	}
+
+	if len(svcs) == 0 {
+		return nil
+	}
+
+	sysd := systemd.New(dirs.GlobalRootDir, &progress.NullProgress{})
+
+	w := tabwriter.NewWriter(c.stdout, 5, 3, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Service\tStartup\tCurrent"))
+	for _, svc := range svcs {
+		status, err := sysd.ServiceStatus(svc.ServiceName())
+		if err != nil {
+			return fmt.Errorf(i18n.G("cannot get status of service %q: %v"), svc.Name, err)
+		}
+
+		startup := i18n.G("disabled")
+		if status.UnitFileState == "enabled" {
+			startup = i18n.G("enabled")
+		}
+		current := i18n.G("inactive")
+		if status.ActiveState == "active" {
+			current = i18n.G("active")
+		}
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\n", snapName, svc.Name, startup, current)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+)
+
+type servicectlSuite struct {
+	st          *state.State
+	mockContext *hookstate.Context
+	hookTask    *state.Task
+	change      *state.Change
+
+	restoreSystemctl func()
+}
+
+var _ = Suite(&servicectlSuite{})
+
+const servicesSnapYaml = `name: test-snap
+version: 1.0
+apps:
+  svc1:
+    daemon: simple
+  svc2:
+    daemon: simple
+  app:
+`
+
+const otherSnapYaml = `name: other-snap
+version: 1.0
+apps:
+  svc:
+    daemon: simple
+`
+
+func (s *servicectlSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+
+	oldSystemctlCmd := systemd.SystemctlCmd
+	systemd.SystemctlCmd = func(args ...string) ([]byte, error) {
+		switch args[2] {
+		case "snap.test-snap.svc1.service":
+			return []byte("ActiveState=active\nUnitFileState=enabled\n"), nil
+		default:
+			return []byte("ActiveState=inactive\nUnitFileState=disabled\n"), nil
+		}
+	}
+	s.restoreSystemctl = func() { systemd.SystemctlCmd = oldSystemctlCmd }
+
+	s.st = state.New(nil)
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	for _, yaml := range []string{servicesSnapYaml, otherSnapYaml} {
+		info := snaptest.MockSnap(c, yaml, "", &snap.SideInfo{Revision: snap.R(1)})
+		snapstate.Set(s.st, info.Name(), &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{{RealName: info.Name(), Revision: snap.R(1)}},
+			Current:  snap.R(1),
+		})
+	}
+
+	s.change = s.st.NewChange("test", "test change")
+	s.hookTask = s.st.NewTask("run-hook", "my test task")
+	s.change.AddTask(s.hookTask)
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "configure"}
+
+	var err error
+	s.mockContext, err = hookstate.NewContext(s.hookTask, setup, hooktest.NewMockHandler())
+	c.Assert(err, IsNil)
+}
+
+func (s *servicectlSuite) TearDownTest(c *C) {
+	s.restoreSystemctl()
+	dirs.SetRootDir("/")
+}
+
+func (s *servicectlSuite) TestServices(c *C) {
+	stdout, stderr, err := ctlcmd.Run(s.mockContext, []string{"services"})
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `Service         Startup   Current
+test-snap.svc1  enabled   active
+test-snap.svc2  disabled  inactive
+`)
+	c.Check(string(stderr), Equals, "")
+}
+
+func (s *servicectlSuite) TestServicesOne(c *C) {
+	stdout, _, err := ctlcmd.Run(s.mockContext, []string{"services", "test-snap.svc2"})
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `Service         Startup   Current
+test-snap.svc2  disabled  inactive
+`)
+}
+
+func (s *servicectlSuite) TestServiceCommandsErrors(c *C) {
+	for _, cmd := range []string{"services", "start", "stop", "restart"} {
+		_, _, err := ctlcmd.Run(s.mockContext, []string{cmd, "other-snap.svc"})
+		c.Check(err, ErrorMatches, `unknown service: "other-snap.svc"`, Commentf(cmd))
+
+		_, _, err = ctlcmd.Run(s.mockContext, []string{cmd, "test-snap.app"})
+		c.Check(err, ErrorMatches, `unknown service: "test-snap.app"`, Commentf(cmd))
+
+		_, _, err = ctlcmd.Run(s.mockContext, []string{cmd, "test-snap.potato"})
+		c.Check(err, ErrorMatches, `unknown service: "test-snap.potato"`, Commentf(cmd))
+
+		_, _, err = ctlcmd.Run(nil, []string{cmd, "test-snap"})
+		c.Check(err, ErrorMatches, `cannot .* without a context`, Commentf(cmd))
+	}
+
+	for _, cmd := range []string{"start", "stop", "restart"} {
+		_, _, err := ctlcmd.Run(s.mockContext, []string{cmd})
+		c.Check(err, ErrorMatches, `.*required argument .* not provided`, Commentf(cmd))
+	}
+}
+
+func (s *servicectlSuite) testQueuedCommand(c *C, args []string, expected servicestate.ServiceAction) {
+	_, _, err := ctlcmd.Run(s.mockContext, args)
+	c.Assert(err, IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	tasks := s.change.Tasks()
+	c.Assert(tasks, HasLen, 2)
+	t := tasks[1]
+	c.Check(t.Kind(), Equals, "service-control")
+	c.Check(t.WaitTasks(), DeepEquals, []*state.Task{s.hookTask})
+
+	var action servicestate.ServiceAction
+	c.Assert(t.Get("service-action", &action), IsNil)
+	c.Check(action, DeepEquals, expected)
+}
+
+func (s *servicectlSuite) TestStart(c *C) {
+	s.testQueuedCommand(c, []string{"start", "--enable", "test-snap.svc2"}, servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "start",
+		Services: []string{"svc2"},
+		Enable:   true,
+	})
+}
+
+func (s *servicectlSuite) TestStop(c *C) {
+	s.testQueuedCommand(c, []string{"stop", "--disable", "test-snap"}, servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "stop",
+		Services: []string{"svc1", "svc2"},
+		Disable:  true,
+	})
+}
+
+func (s *servicectlSuite) TestRestart(c *C) {
+	s.testQueuedCommand(c, []string{"restart", "test-snap.svc1", "test-snap.svc2"}, servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "restart",
+		Services: []string{"svc1", "svc2"},
+	})
+}
+
+func (s *servicectlSuite) TestQueuedCommandIgnoresOwnChange(c *C) {
+	s.st.Lock()
+	link := s.st.NewTask("link-snap", "link the snap")
+	link.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "test-snap", Revision: snap.R(1)}})
+	s.change.AddTask(link)
+	s.st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"restart", "test-snap"})
+	c.Assert(err, IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(s.change.Tasks(), HasLen, 3)
+}
+
+func (s *servicectlSuite) TestQueuedCommandRunsAfterChange(c *C) {
+	s.st.Lock()
+	// a task of the change that runs after the hook
+	later := s.st.NewTask("later", "later task")
+	later.WaitFor(s.hookTask)
+	s.change.AddTask(later)
+	s.st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"restart", "test-snap.svc1"})
+	c.Assert(err, IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	tasks := s.change.Tasks()
+	c.Assert(tasks, HasLen, 3)
+	t := tasks[2]
+	c.Check(t.Kind(), Equals, "service-control")
+	c.Check(t.WaitTasks(), DeepEquals, []*state.Task{s.hookTask, later})
+	c.Check(later.HaltTasks(), DeepEquals, []*state.Task{t})
+}
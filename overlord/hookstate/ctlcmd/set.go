@@ -27,6 +27,7 @@ import (
 	"github.com/snapcore/snapd/i18n/dumb"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/state"
 )
 
 type setCommand struct {
@@ -51,10 +52,14 @@ Nested values may be modified via a dotted path:
 
     $ snapctl set author.name=frank
 
-Plug and slot attributes may be set in the respective prepare and connect hooks by
+Plug and slot attributes may be set in the respective prepare hooks by
 naming the respective plug or slot:
 
     $ snapctl set :myplug path=/dev/ttyS0
+
+Such attributes complement the ones declared in snap.yaml, which cannot be
+changed, and are seen by the other side of the connection as well as when
+the security profiles of the connection are generated.
 `)
 
 func init() {
@@ -131,19 +136,23 @@ func (s *setCommand) setInterfaceSetting(context *hookstate.Context, plugOrSlot
 		return err
 	}
 
-	var which string
+	var staticWhich, which string
 	if hookType == preparePlugHook {
-		which = "plug-attrs"
+		staticWhich, which = "plug-attrs", "plug-dynamic"
 	} else {
-		which = "slot-attrs"
+		staticWhich, which = "slot-attrs", "slot-dynamic"
 	}
 
 	st := context.State()
 	st.Lock()
 	defer st.Unlock()
 
+	staticAttrs := make(map[string]interface{})
+	if err := attrsTask.Get(staticWhich, &staticAttrs); err != nil {
+		return fmt.Errorf(i18n.G("internal error: cannot get %s from appropriate task"), staticWhich)
+	}
 	attributes := make(map[string]interface{})
-	if err := attrsTask.Get(which, &attributes); err != nil {
+	if err := attrsTask.Get(which, &attributes); err != nil && err != state.ErrNoState {
 		return fmt.Errorf(i18n.G("internal error: cannot get %s from appropriate task"), which)
 	}
 
@@ -153,6 +162,10 @@ func (s *setCommand) setInterfaceSetting(context *hookstate.Context, plugOrSlot
 			return fmt.Errorf(i18n.G("invalid parameter: %q (want key=value)"), attrValue)
 		}
 
+		if _, ok := staticAttrs[parts[0]]; ok {
+			return fmt.Errorf(i18n.G("cannot change static attribute %q"), parts[0])
+		}
+
 		var value interface{}
 		err := json.Unmarshal([]byte(parts[1]), &value)
 		if err != nil {
@@ -158,7 +158,7 @@ func (s *setAttrSuite) SetUpTest(c *C) {
 	attrsTask := state.NewTask("connect-task", "my connect task")
 	attrsTask.Set("plug", &interfaces.PlugRef{Snap: "a", Name: "aplug"})
 	attrsTask.Set("slot", &interfaces.SlotRef{Snap: "b", Name: "bslot"})
-	attrs := make(map[string]interface{})
+	attrs := map[string]interface{}{"static": "value"}
 	attrsTask.Set("plug-attrs", attrs)
 	attrsTask.Set("slot-attrs", attrs)
 	ch.AddTask(attrsTask)
@@ -210,7 +210,7 @@ func (s *setAttrSuite) TestSetPlugAttributesInPlugHook(c *C) {
 	st.Lock()
 	defer st.Unlock()
 	attrs := make(map[string]interface{})
-	err = attrsTask.Get("plug-attrs", &attrs)
+	err = attrsTask.Get("plug-dynamic", &attrs)
 	c.Assert(err, IsNil)
 	c.Check(attrs["foo"], Equals, "bar")
 }
@@ -227,11 +227,38 @@ func (s *setAttrSuite) TestSetSlotAttributesInSlotHook(c *C) {
 	st.Lock()
 	defer st.Unlock()
 	attrs := make(map[string]interface{})
-	err = attrsTask.Get("slot-attrs", &attrs)
+	err = attrsTask.Get("slot-dynamic", &attrs)
 	c.Assert(err, IsNil)
 	c.Check(attrs["foo"], Equals, "bar")
 }
 
+func (s *setAttrSuite) TestSetStaticAttributeFails(c *C) {
+	stdout, stderr, err := ctlcmd.Run(s.mockPlugHookContext, []string{"set", ":aplug", "static=other"})
+	c.Check(err, ErrorMatches, `cannot change static attribute "static"`)
+	c.Check(string(stdout), Equals, "")
+	c.Check(string(stderr), Equals, "")
+
+	attrsTask, err := ctlcmd.AttributesTask(s.mockPlugHookContext)
+	c.Assert(err, IsNil)
+	st := s.mockPlugHookContext.State()
+	st.Lock()
+	defer st.Unlock()
+	attrs := make(map[string]interface{})
+	c.Check(attrsTask.Get("plug-dynamic", &attrs), Equals, state.ErrNoState)
+	c.Assert(attrsTask.Get("plug-attrs", &attrs), IsNil)
+	c.Check(attrs, DeepEquals, map[string]interface{}{"static": "value"})
+}
+
+func (s *setAttrSuite) TestSetThenGetDynamicAttribute(c *C) {
+	_, _, err := ctlcmd.Run(s.mockPlugHookContext, []string{"set", ":aplug", "path=/run/foo.socket", "n=2"})
+	c.Assert(err, IsNil)
+
+	stdout, stderr, err := ctlcmd.Run(s.mockPlugHookContext, []string{"get", "-d", ":aplug", "path", "static", "n"})
+	c.Check(err, IsNil)
+	c.Check(string(stdout), Equals, "{\n\t\"n\": 2,\n\t\"path\": \"/run/foo.socket\",\n\t\"static\": \"value\"\n}\n")
+	c.Check(string(stderr), Equals, "")
+}
+
 func (s *setAttrSuite) TestPlugOrSlotEmpty(c *C) {
 	stdout, stderr, err := ctlcmd.Run(s.mockPlugHookContext, []string{"set", ":", "foo=bar"})
 	c.Check(err.Error(), Equals, "plug or slot name not provided")
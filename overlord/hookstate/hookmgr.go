@@ -86,7 +86,9 @@ func Manager(s *state.State) (*HookManager, error) {
 		contexts:   make(map[string]*Context),
 	}
 
-	runner.AddHandler("run-hook", manager.doRunHook, nil)
+	runner.AddHandler("run-hook", manager.doRunHook, manager.undoRunHook)
+
+	setupHooks(manager)
 
 	return manager, nil
 }
@@ -239,6 +241,13 @@ func (m *HookManager) doRunHook(task *state.Task, tomb *tomb.Tomb) error {
 	return nil
 }
 
+// undoRunHook is a no-op; hooks cannot be undone, but having an undo
+// handler keeps hook tasks in the middle of a change from letting the
+// undo of the tasks they wait for run ahead of the tasks waiting for them.
+func (m *HookManager) undoRunHook(task *state.Task, tomb *tomb.Tomb) error {
+	return nil
+}
+
 func runHookImpl(c *Context, tomb *tomb.Tomb) ([]byte, error) {
 	return runHookAndWait(c.SnapName(), c.SnapRevision(), c.HookName(), c.ID(), tomb)
 }
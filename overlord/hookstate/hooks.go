@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hookstate
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func init() {
+	snapstate.SetupInstallHook = SetupInstallHook
+	snapstate.SetupPreRefreshHook = SetupPreRefreshHook
+	snapstate.SetupPostRefreshHook = SetupPostRefreshHook
+	snapstate.SetupRemoveHook = SetupRemoveHook
+}
+
+func setupOptionalHook(st *state.State, snapName, hookName string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:     snapName,
+		Hook:     hookName,
+		Optional: true,
+	}
+	summary := fmt.Sprintf(i18n.G("Run %s hook of %q snap if present"), hookName, snapName)
+	return HookTask(st, summary, hooksup, nil)
+}
+
+// SetupInstallHook returns a task to run the install hook of the given
+// snap, if it has one.
+func SetupInstallHook(st *state.State, snapName string) *state.Task {
+	return setupOptionalHook(st, snapName, "install")
+}
+
+// SetupPreRefreshHook returns a task to run the pre-refresh hook of the
+// given snap, if it has one.
+func SetupPreRefreshHook(st *state.State, snapName string) *state.Task {
+	return setupOptionalHook(st, snapName, "pre-refresh")
+}
+
+// SetupPostRefreshHook returns a task to run the post-refresh hook of the
+// given snap, if it has one.
+func SetupPostRefreshHook(st *state.State, snapName string) *state.Task {
+	return setupOptionalHook(st, snapName, "post-refresh")
+}
+
+// SetupRemoveHook returns a task to run the remove hook of the given
+// snap, if it has one.
+func SetupRemoveHook(st *state.State, snapName string) *state.Task {
+	return setupOptionalHook(st, snapName, "remove")
+}
+
+type snapHookHandler struct {
+	context *Context
+}
+
+func (h *snapHookHandler) Before() error {
+	return nil
+}
+
+func (h *snapHookHandler) Done() error {
+	return nil
+}
+
+func (h *snapHookHandler) Error(err error) error {
+	return nil
+}
+
+// setupHooks registers the handlers of the hooks of the snap lifecycle.
+func setupHooks(hookMgr *HookManager) {
+	handlerGenerator := func(context *Context) Handler {
+		return &snapHookHandler{context: context}
+	}
+
+	hookMgr.Register(regexp.MustCompile("^install$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
+}
@@ -0,0 +1,158 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hookstate_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type snapHooksSuite struct {
+	state   *state.State
+	manager *hookstate.HookManager
+	command *testutil.MockCmd
+}
+
+var _ = Suite(&snapHooksSuite{})
+
+const snapHooksYaml = `
+name: test-snap
+version: 1.0
+hooks:
+    install:
+    post-refresh:
+`
+
+func (s *snapHooksSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+	manager, err := hookstate.Manager(s.state)
+	c.Assert(err, IsNil)
+	s.manager = manager
+
+	s.state.Lock()
+	sideInfo := &snap.SideInfo{RealName: "test-snap", SnapID: "some-snap-id", Revision: snap.R(1)}
+	snaptest.MockSnap(c, snapHooksYaml, "", sideInfo)
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfo},
+		Current:  snap.R(1),
+	})
+	s.state.Unlock()
+
+	s.command = testutil.MockCommand(c, "snap", "")
+}
+
+func (s *snapHooksSuite) TearDownTest(c *C) {
+	s.command.Restore()
+	s.manager.Stop()
+	dirs.SetRootDir("")
+}
+
+func (s *snapHooksSuite) TestSetupHooks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for hookName, setup := range map[string]func(*state.State, string) *state.Task{
+		"install":      hookstate.SetupInstallHook,
+		"remove":       hookstate.SetupRemoveHook,
+		"pre-refresh":  hookstate.SetupPreRefreshHook,
+		"post-refresh": hookstate.SetupPostRefreshHook,
+	} {
+		task := setup(s.state, "test-snap")
+		c.Check(task.Kind(), Equals, "run-hook")
+		c.Check(task.Summary(), Equals, `Run `+hookName+` hook of "test-snap" snap if present`)
+
+		var hooksup hookstate.HookSetup
+		c.Assert(task.Get("hook-setup", &hooksup), IsNil)
+		c.Check(hooksup, DeepEquals, hookstate.HookSetup{
+			Snap:     "test-snap",
+			Hook:     hookName,
+			Optional: true,
+		})
+	}
+}
+
+func (s *snapHooksSuite) TestSnapstateHooksAreSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var hooksup hookstate.HookSetup
+	c.Assert(snapstate.SetupInstallHook(s.state, "test-snap").Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup.Hook, Equals, "install")
+	c.Assert(snapstate.SetupRemoveHook(s.state, "test-snap").Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup.Hook, Equals, "remove")
+	c.Assert(snapstate.SetupPreRefreshHook(s.state, "test-snap").Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup.Hook, Equals, "pre-refresh")
+	c.Assert(snapstate.SetupPostRefreshHook(s.state, "test-snap").Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup.Hook, Equals, "post-refresh")
+}
+
+func (s *snapHooksSuite) runHooks(c *C, setups ...func(*state.State, string) *state.Task) *state.Change {
+	s.state.Lock()
+	chg := s.state.NewChange("kind", "summary")
+	for _, setup := range setups {
+		chg.AddTask(setup(s.state, "test-snap"))
+	}
+	s.state.Unlock()
+
+	s.manager.Ensure()
+	s.manager.Wait()
+
+	return chg
+}
+
+func (s *snapHooksSuite) TestRunsPresentHooks(c *C) {
+	chg := s.runHooks(c, hookstate.SetupInstallHook, hookstate.SetupPostRefreshHook)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(s.command.Calls(), HasLen, 2)
+	c.Check(s.command.Calls(), testutil.DeepContains, []string{"snap", "run", "--hook", "install", "-r", "unset", "test-snap"})
+	c.Check(s.command.Calls(), testutil.DeepContains, []string{"snap", "run", "--hook", "post-refresh", "-r", "unset", "test-snap"})
+}
+
+func (s *snapHooksSuite) TestSkipsMissingHooks(c *C) {
+	chg := s.runHooks(c, hookstate.SetupRemoveHook, hookstate.SetupPreRefreshHook)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(s.command.Calls(), HasLen, 0)
+}
+
+func (s *snapHooksSuite) TestHookErrorFailsTask(c *C) {
+	s.command = testutil.MockCommand(c, "snap", ">&2 echo 'post-refresh failed'; exit 1")
+
+	chg := s.runHooks(c, hookstate.SetupPostRefreshHook)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*run hook "post-refresh": post-refresh failed.*`)
+}
@@ -19,9 +19,11 @@ package ifacestate
 
 import (
 	"errors"
+	"time"
 
 	"gopkg.in/tomb.v2"
 
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -34,3 +36,25 @@ func (m *InterfaceManager) AddForeignTaskHandlers() {
 	}
 	m.runner.AddHandler("error-trigger", erroringHandler, nil)
 }
+
+type UDevMonitor udevMonitor
+
+func MockCreateUDevMonitor(f func(added, removed hotplug.DeviceCallback) UDevMonitor) (restore func()) {
+	old := createUDevMonitor
+	createUDevMonitor = func(added, removed hotplug.DeviceCallback) udevMonitor {
+		return f(added, removed)
+	}
+	return func() { createUDevMonitor = old }
+}
+
+func MockEnumerateExistingDevices(f func(cb hotplug.DeviceCallback) error) (restore func()) {
+	old := enumerateExistingDevices
+	enumerateExistingDevices = f
+	return func() { enumerateExistingDevices = old }
+}
+
+func MockUDevMonitorRetryInterval(d time.Duration) (restore func()) {
+	old := udevMonitorRetryInterval
+	udevMonitorRetryInterval = d
+	return func() { udevMonitorRetryInterval = old }
+}
@@ -139,6 +139,12 @@ func (m *InterfaceManager) setupProfilesForSnap(task *state.Task, _ *tomb.Tomb,
 	if err != nil {
 		return err
 	}
+	// slots of hotplugged devices are not part of the snap and must be
+	// carried over
+	hotplugSlots, err := m.hotplugSlotsOfSnap(snapName)
+	if err != nil {
+		return err
+	}
 	// XXX: what about snap renames? We should remove the old name (or switch
 	// to IDs in the interfaces repository)
 	if err := m.repo.RemoveSnap(snapName); err != nil {
@@ -151,6 +157,12 @@ func (m *InterfaceManager) setupProfilesForSnap(task *state.Task, _ *tomb.Tomb,
 			return err
 		}
 	}
+	for _, slot := range hotplugSlots {
+		slot.Snap = snapInfo
+		if err := m.repo.AddSlot(slot); err != nil {
+			task.Logf("cannot restore slot %q of hotplugged device: %v", slot.Name, err)
+		}
+	}
 	if err := m.reloadConnections(snapName); err != nil {
 		return err
 	}
@@ -396,7 +408,16 @@ func (m *InterfaceManager) doConnect(task *state.Task, _ *tomb.Tomb) error {
 		}
 	}
 
-	err = m.repo.Connect(connRef)
+	// attributes set by the prepare hooks
+	var plugDynamic, slotDynamic map[string]interface{}
+	if err := task.Get("plug-dynamic", &plugDynamic); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if err := task.Get("slot-dynamic", &slotDynamic); err != nil && err != state.ErrNoState {
+		return err
+	}
+
+	err = m.repo.ConnectWithAttrs(connRef, plugDynamic, slotDynamic)
 	if err != nil {
 		return err
 	}
@@ -420,12 +441,52 @@ func (m *InterfaceManager) doConnect(task *state.Task, _ *tomb.Tomb) error {
 		return err
 	}
 
-	conns[connRef.ID()] = connState{Interface: plug.Interface}
+	conns[connRef.ID()] = connState{
+		Interface:   plug.Interface,
+		PlugDynamic: plugDynamic,
+		SlotDynamic: slotDynamic,
+	}
 	setConns(st, conns)
 
 	return nil
 }
 
+func (m *InterfaceManager) doGadgetConnect(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	conns, err := getConns(st)
+	if err != nil {
+		return err
+	}
+
+	autochecker, err := newAutoConnectChecker(st)
+	if err != nil {
+		return err
+	}
+
+	affected, err := m.gadgetConnect(task, "", conns, autochecker)
+	if err != nil {
+		return err
+	}
+	if len(affected) == 0 {
+		return nil
+	}
+	setConns(st, conns)
+
+	affectedSet := make(map[string]bool, len(affected))
+	for _, name := range affected {
+		affectedSet[name] = true
+	}
+	affectedSnaps := make([]string, 0, len(affectedSet))
+	for name := range affectedSet {
+		affectedSnaps = append(affectedSnaps, name)
+	}
+	sort.Strings(affectedSnaps)
+	return m.setupAffectedSnaps(task, "", affectedSnaps)
+}
+
 func snapNamesFromConns(conns []interfaces.ConnRef) []string {
 	m := make(map[string]bool)
 	for _, conn := range conns {
@@ -450,13 +511,45 @@ func (m *InterfaceManager) doDisconnect(task *state.Task, _ *tomb.Tomb) error {
 		return err
 	}
 
+	var forget bool
+	if err := task.Get("forget", &forget); err != nil && err != state.ErrNoState {
+		return err
+	}
+
 	conns, err := getConns(st)
 	if err != nil {
 		return err
 	}
 
+	forgotten := 0
+	if forget {
+		// drop the records of matching connections that were
+		// disconnected already
+		coreName := "core"
+		if coreInfo, err := snapstate.CoreInfo(st); err == nil {
+			coreName = coreInfo.Name()
+		}
+		for id, conn := range conns {
+			if !conn.Undesired {
+				continue
+			}
+			connRef, err := interfaces.ParseConnRef(id)
+			if err != nil {
+				return err
+			}
+			if matchesDisconnect(connRef, plugRef, slotRef, coreName) {
+				delete(conns, id)
+				forgotten++
+			}
+		}
+	}
+
 	affectedConns, err := m.repo.ResolveDisconnect(plugRef.Snap, plugRef.Name, slotRef.Snap, slotRef.Name)
 	if err != nil {
+		if forgotten > 0 {
+			setConns(st, conns)
+			return nil
+		}
 		return err
 	}
 	m.repo.DisconnectAll(affectedConns)
@@ -476,14 +569,47 @@ func (m *InterfaceManager) doDisconnect(task *state.Task, _ *tomb.Tomb) error {
 			return err
 		}
 	}
-	for _, conn := range affectedConns {
-		delete(conns, conn.ID())
+	for _, connRef := range affectedConns {
+		id := connRef.ID()
+		if conn, ok := conns[id]; ok && !forget && (conn.Auto || conn.ByGadget) {
+			// remember that the user does not want the connection
+			// so that it is not made automatically again
+			conn.Undesired = true
+			conns[id] = conn
+			continue
+		}
+		delete(conns, id)
 	}
 
 	setConns(st, conns)
 	return nil
 }
 
+// matchesDisconnect returns whether the given connection is described by
+// the plug and slot references of a disconnect task. The references are
+// interpreted like in Repository.ResolveDisconnect: an omitted snap name
+// refers to the core snap and when one of the references is omitted
+// entirely the other one names either a plug or a slot.
+func matchesDisconnect(connRef interfaces.ConnRef, plugRef interfaces.PlugRef, slotRef interfaces.SlotRef, coreName string) bool {
+	if plugRef.Snap == "" && plugRef.Name != "" {
+		plugRef.Snap = coreName
+	}
+	if slotRef.Snap == "" && slotRef.Name != "" {
+		slotRef.Snap = coreName
+	}
+	switch {
+	case plugRef.Name != "" && slotRef.Name != "":
+		return connRef.PlugRef == plugRef && connRef.SlotRef == slotRef
+	case plugRef.Name != "":
+		return connRef.PlugRef.Snap == plugRef.Snap && connRef.PlugRef.Name == plugRef.Name ||
+			connRef.SlotRef.Snap == plugRef.Snap && connRef.SlotRef.Name == plugRef.Name
+	case slotRef.Name != "":
+		return connRef.PlugRef.Snap == slotRef.Snap && connRef.PlugRef.Name == slotRef.Name ||
+			connRef.SlotRef.Snap == slotRef.Snap && connRef.SlotRef.Name == slotRef.Name
+	}
+	return false
+}
+
 // transitionConnectionsCoreMigration will transition all connections
 // from oldName to newName. Note that this is only useful when you
 // know that newName supports everything that oldName supports,
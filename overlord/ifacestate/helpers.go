@@ -21,6 +21,7 @@ package ifacestate
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/interfaces"
@@ -29,8 +30,10 @@ import (
 	"github.com/snapcore/snapd/interfaces/policy"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 )
 
@@ -120,34 +123,44 @@ func (m *InterfaceManager) regenerateAllSecurityProfiles() error {
 		snap.AddImplicitSlots(snapInfo)
 	}
 
-	// For each snap:
-	for _, snapInfo := range snaps {
-		snapName := snapInfo.Name()
+	// Compute confinement options of each snap
+	confinement := func(snapName string) interfaces.ConfinementOptions {
 		// Get the state of the snap so we can compute the confinement option
 		var snapst snapstate.SnapState
 		if err := snapstate.Get(m.state, snapName, &snapst); err != nil {
 			logger.Noticef("cannot get state of snap %q: %s", snapName, err)
 		}
+		return confinementOptions(snapst.Flags)
+	}
 
-		// Compute confinement options
-		opts := confinementOptions(snapst.Flags)
-
-		// For each backend:
-		for _, backend := range securityBackends {
-			// The issue this is attempting to fix is only
-			// affecting seccomp/apparmor so limit the work just to
-			// this backend.
-			shouldRefresh := (backend.Name() == interfaces.SecuritySecComp || backend.Name() == interfaces.SecurityAppArmor)
-			if !shouldRefresh {
-				continue
-			}
-			// Refresh security of this snap and backend
-			if err := backend.Setup(snapInfo, opts, m.repo); err != nil {
+	// For each backend:
+	for _, backend := range securityBackends {
+		// The issue this is attempting to fix is only
+		// affecting seccomp/apparmor so limit the work just to
+		// this backend.
+		shouldRefresh := (backend.Name() == interfaces.SecuritySecComp || backend.Name() == interfaces.SecurityAppArmor)
+		if !shouldRefresh {
+			continue
+		}
+		start := time.Now()
+		if setupMany, ok := backend.(interfaces.SecurityBackendSetupMany); ok {
+			// Refresh security of all the snaps at once
+			for _, err := range setupMany.SetupMany(snaps, confinement, m.repo) {
 				// Let's log this but carry on
-				logger.Noticef("cannot regenerate %s profile for snap %q: %s",
-					backend.Name(), snapName, err)
+				logger.Noticef("cannot regenerate %s profiles: %s", backend.Name(), err)
+			}
+		} else {
+			// Refresh security of each snap
+			for _, snapInfo := range snaps {
+				snapName := snapInfo.Name()
+				if err := backend.Setup(snapInfo, confinement(snapName), m.repo); err != nil {
+					// Let's log this but carry on
+					logger.Noticef("cannot regenerate %s profile for snap %q: %s",
+						backend.Name(), snapName, err)
+				}
 			}
 		}
+		logger.Debugf("regenerated %s profiles of %d snaps in %s", backend.Name(), len(snaps), time.Since(start))
 	}
 
 	return nil
@@ -161,7 +174,8 @@ func (m *InterfaceManager) reloadConnections(snapName string) error {
 	if err != nil {
 		return err
 	}
-	for id := range conns {
+	modified := false
+	for id, conn := range conns {
 		connRef, err := interfaces.ParseConnRef(id)
 		if err != nil {
 			return err
@@ -169,9 +183,38 @@ func (m *InterfaceManager) reloadConnections(snapName string) error {
 		if snapName != "" && connRef.PlugRef.Snap != snapName && connRef.SlotRef.Snap != snapName {
 			continue
 		}
-		if err := m.repo.Connect(connRef); err != nil {
+		if conn.Undesired {
+			continue
+		}
+		// connections to the slots of hotplugged devices that are not
+		// present are restored when the devices reappear
+		if m.repo.Slot(connRef.SlotRef.Snap, connRef.SlotRef.Name) == nil {
+			hotplugSlot, err := findSlotOfHotplugDevice(m.state, connRef.SlotRef.Snap, connRef.SlotRef.Name)
+			if err != nil {
+				return err
+			}
+			if hotplugSlot != nil {
+				if !conn.HotplugGone {
+					conn.HotplugGone = true
+					conns[id] = conn
+					modified = true
+				}
+				continue
+			}
+		}
+		if err := m.repo.ConnectWithAttrs(connRef, conn.PlugDynamic, conn.SlotDynamic); err != nil {
 			logger.Noticef("%s", err)
+			m.state.Warnf("cannot restore connection %s: %v", id, err)
+			continue
 		}
+		if conn.HotplugGone {
+			conn.HotplugGone = false
+			conns[id] = conn
+			modified = true
+		}
+	}
+	if modified {
+		setConns(m.state, conns)
 	}
 	return nil
 }
@@ -208,7 +251,19 @@ func (m *InterfaceManager) removeSnapSecurity(task *state.Task, snapName string)
 
 type connState struct {
 	Auto      bool   `json:"auto,omitempty"`
+	ByGadget  bool   `json:"by-gadget,omitempty"`
 	Interface string `json:"interface,omitempty"`
+	// Undesired is true when an automatic connection was disconnected
+	// by the user; the record is kept so that the connection is not
+	// made again automatically.
+	Undesired bool `json:"undesired,omitempty"`
+	// PlugDynamic and SlotDynamic are the attributes set by the
+	// interface hooks when connecting.
+	PlugDynamic map[string]interface{} `json:"plug-dynamic,omitempty"`
+	SlotDynamic map[string]interface{} `json:"slot-dynamic,omitempty"`
+	// HotplugGone is true when the slot of the connection was created
+	// for a hotplugged device that is not present.
+	HotplugGone bool `json:"hotplug-gone,omitempty"`
 }
 
 type autoConnectChecker struct {
@@ -242,14 +297,14 @@ func (c *autoConnectChecker) snapDeclaration(snapID string) (*asserts.SnapDeclar
 	return snapDecl, nil
 }
 
-func (c *autoConnectChecker) check(plug *interfaces.Plug, slot *interfaces.Slot) bool {
+func (c *autoConnectChecker) connectCandidate(plug *interfaces.Plug, slot *interfaces.Slot) (*policy.ConnectCandidate, bool) {
 	var plugDecl *asserts.SnapDeclaration
 	if plug.Snap.SnapID != "" {
 		var err error
 		plugDecl, err = c.snapDeclaration(plug.Snap.SnapID)
 		if err != nil {
 			logger.Noticef("error: cannot find snap declaration for %q: %v", plug.Snap.Name(), err)
-			return false
+			return nil, false
 		}
 	}
 
@@ -259,22 +314,61 @@ func (c *autoConnectChecker) check(plug *interfaces.Plug, slot *interfaces.Slot)
 		slotDecl, err = c.snapDeclaration(slot.Snap.SnapID)
 		if err != nil {
 			logger.Noticef("error: cannot find snap declaration for %q: %v", slot.Snap.Name(), err)
-			return false
+			return nil, false
 		}
 	}
 
-	// check the connection against the declarations' rules
-	ic := policy.ConnectCandidate{
+	return &policy.ConnectCandidate{
 		Plug:                plug.PlugInfo,
 		PlugSnapDeclaration: plugDecl,
 		Slot:                slot.SlotInfo,
 		SlotSnapDeclaration: slotDecl,
 		BaseDeclaration:     c.baseDecl,
-	}
+	}, true
+}
 
+func (c *autoConnectChecker) check(plug *interfaces.Plug, slot *interfaces.Slot) bool {
+	ic, ok := c.connectCandidate(plug, slot)
+	if !ok {
+		return false
+	}
+	// check the connection against the declarations' rules
 	return ic.CheckAutoConnect() == nil
 }
 
+// checkConnect checks the connection against the declarations' rules
+// for regular, non automatic, connections.
+func (c *autoConnectChecker) checkConnect(plug *interfaces.Plug, slot *interfaces.Slot) bool {
+	ic, ok := c.connectCandidate(plug, slot)
+	if !ok {
+		return false
+	}
+	// as for manual connections, snaps without a declaration were
+	// installed with "dangerous" and the check is skipped
+	if ic.PlugSnapDeclaration == nil || ic.SlotSnapDeclaration == nil {
+		return true
+	}
+	return ic.Check() == nil
+}
+
+// brandGadget returns whether the gadget is published by the brand of
+// the device model.
+func (c *autoConnectChecker) brandGadget(gadget *snap.Info) bool {
+	if gadget.SnapID == "" {
+		return false
+	}
+	device, err := auth.Device(c.st)
+	if err != nil || device.Brand == "" {
+		return false
+	}
+	snapDecl, err := c.snapDeclaration(gadget.SnapID)
+	if err != nil {
+		logger.Noticef("error: cannot find snap declaration for %q: %v", gadget.Name(), err)
+		return false
+	}
+	return snapDecl.PublisherID() == device.Brand
+}
+
 // autoConnect connects the given snap to viable candidates returning the list
 // of connected snap names.  The blacklist can prevent auto-connection to
 // specific interfaces (blacklist entries are plug or slot names).
@@ -307,7 +401,8 @@ func (m *InterfaceManager) autoConnect(task *state.Task, snapName string, blackl
 		connRef := interfaces.ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()}
 		key := connRef.ID()
 		if _, ok := conns[key]; ok {
-			// Suggested connection already exist so don't clobber it.
+			// Suggested connection already exist (or was disconnected
+			// by the user) so don't clobber it.
 			continue
 		}
 		if err := m.repo.Connect(connRef); err != nil {
@@ -331,7 +426,8 @@ func (m *InterfaceManager) autoConnect(task *state.Task, snapName string, blackl
 		connRef := interfaces.ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()}
 		key := connRef.ID()
 		if _, ok := conns[key]; ok {
-			// Suggested connection already exist so don't clobber it.
+			// Suggested connection already exist (or was disconnected
+			// by the user) so don't clobber it.
 			continue
 		}
 		if err := m.repo.Connect(connRef); err != nil {
@@ -343,10 +439,109 @@ func (m *InterfaceManager) autoConnect(task *state.Task, snapName string, blackl
 		conns[key] = connState{Interface: plug.Interface, Auto: true}
 	}
 
+	// Make the connections requested by the gadget
+	gadgetAffected, err := m.gadgetConnect(task, snapName, conns, autochecker)
+	if err != nil {
+		return nil, err
+	}
+	affectedSnapNames = append(affectedSnapNames, gadgetAffected...)
+
 	task.State().Set("conns", conns)
 	return affectedSnapNames, nil
 }
 
+// gadgetConnect makes the connections declared in gadget.yaml for which
+// both the plug and the slot snaps are installed, recording them in
+// conns. Connections that already exist, or that were disconnected by
+// the user, are left alone. If snapName is not empty only connections
+// involving that snap are considered. The auto-connection rules of the
+// declarations are only bypassed when the gadget comes from the brand of
+// the device model. It returns the names of the affected snaps.
+func (m *InterfaceManager) gadgetConnect(task *state.Task, snapName string, conns map[string]connState, autochecker *autoConnectChecker) ([]string, error) {
+	st := task.State()
+	gadget, err := snapstate.GadgetInfo(st)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	gadgetInfo, err := snap.ReadGadgetInfo(gadget, release.OnClassic)
+	if err != nil {
+		task.Logf("cannot read connections requested by the gadget: %v", err)
+		return nil, nil
+	}
+	if len(gadgetInfo.Connections) == 0 {
+		return nil, nil
+	}
+
+	brandGadget := autochecker.brandGadget(gadget)
+
+	var affectedSnapNames []string
+	for _, gconn := range gadgetInfo.Connections {
+		plug := m.gadgetConnectionPlug(gconn.Plug)
+		slot := m.gadgetConnectionSlot(gconn.Slot)
+		if plug == nil || slot == nil {
+			// not all the involved snaps are installed (yet)
+			continue
+		}
+		if snapName != "" && plug.Snap.Name() != snapName && slot.Snap.Name() != snapName {
+			continue
+		}
+		connRef := interfaces.ConnRef{PlugRef: plug.Ref(), SlotRef: slot.Ref()}
+		key := connRef.ID()
+		if _, ok := conns[key]; ok {
+			continue
+		}
+		var allowed bool
+		if brandGadget {
+			allowed = autochecker.checkConnect(plug, slot)
+		} else {
+			allowed = autochecker.check(plug, slot)
+		}
+		if !allowed {
+			task.Logf("cannot connect %s to %s: not allowed (gadget connection)", connRef.PlugRef, connRef.SlotRef)
+			continue
+		}
+		if err := m.repo.Connect(connRef); err != nil {
+			task.Logf("cannot connect %s to %s: %s (gadget connection)", connRef.PlugRef, connRef.SlotRef, err)
+			continue
+		}
+		affectedSnapNames = append(affectedSnapNames, connRef.PlugRef.Snap)
+		affectedSnapNames = append(affectedSnapNames, connRef.SlotRef.Snap)
+		conns[key] = connState{Interface: plug.Interface, Auto: true, ByGadget: true}
+	}
+	return affectedSnapNames, nil
+}
+
+// gadgetConnectionPlug finds the plug in the repository referred to by
+// a gadget connection.
+func (m *InterfaceManager) gadgetConnectionPlug(ref snap.GadgetConnectionPlug) *interfaces.Plug {
+	for _, plug := range m.repo.AllPlugs("") {
+		if plug.Snap.SnapID == ref.SnapID && plug.Name == ref.Plug {
+			return plug
+		}
+	}
+	return nil
+}
+
+// gadgetConnectionSlot finds the slot in the repository referred to by
+// a gadget connection, an empty snap-id referring to the system snap.
+func (m *InterfaceManager) gadgetConnectionSlot(ref snap.GadgetConnectionSlot) *interfaces.Slot {
+	for _, slot := range m.repo.AllSlots("") {
+		if slot.Name != ref.Slot {
+			continue
+		}
+		if ref.SnapID == "" && slot.Snap.Type == snap.TypeOS {
+			return slot
+		}
+		if ref.SnapID != "" && slot.Snap.SnapID == ref.SnapID {
+			return slot
+		}
+	}
+	return nil
+}
+
 func getPlugAndSlotRefs(task *state.Task) (interfaces.PlugRef, interfaces.SlotRef, error) {
 	var plugRef interfaces.PlugRef
 	var slotRef interfaces.SlotRef
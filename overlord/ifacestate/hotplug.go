@@ -0,0 +1,556 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// udevMonitor is the source of the hotplug events.
+type udevMonitor interface {
+	Connect() error
+	Run() error
+	Stop() error
+}
+
+var createUDevMonitor = func(added, removed hotplug.DeviceCallback) udevMonitor {
+	return hotplug.NewUDevMonitor(added, removed)
+}
+
+var enumerateExistingDevices = hotplug.EnumerateExistingDevices
+
+// hotplugSlotInfo describes a slot created for a hotplugged device, as
+// remembered in the state. The entries are kept when the device goes
+// away, so that the slot gets the same name when it reappears.
+type hotplugSlotInfo struct {
+	Name        string                 `json:"name"`
+	Interface   string                 `json:"interface"`
+	StaticAttrs map[string]interface{} `json:"static-attrs,omitempty"`
+	HotplugKey  string                 `json:"hotplug-key"`
+}
+
+// hotplugDeviceSlot identifies the slot created by an interface for a
+// device currently present in the system.
+type hotplugDeviceSlot struct {
+	iface string
+	key   string
+}
+
+// hotplugDevice is a device currently present in the system, along with
+// the slots created for it by the change with addChangeID.
+type hotplugDevice struct {
+	slots       []hotplugDeviceSlot
+	addChangeID string
+}
+
+// presentHotplugDevice returns the device with the given path if its
+// slots were created, or are being created. A device whose change
+// failed is forgotten, so that it gets handled anew when it's reported
+// again.
+func (m *InterfaceManager) presentHotplugDevice(devPath string) *hotplugDevice {
+	dev := m.hotplugDevices[devPath]
+	if dev == nil {
+		return nil
+	}
+	if chg := m.state.Change(dev.addChangeID); chg != nil && chg.Status() == state.ErrorStatus {
+		delete(m.hotplugDevices, devPath)
+		return nil
+	}
+	return dev
+}
+
+func getHotplugSlots(st *state.State) (map[string]*hotplugSlotInfo, error) {
+	var slots map[string]*hotplugSlotInfo
+	err := st.Get("hotplug-slots", &slots)
+	if err != nil && err != state.ErrNoState {
+		return nil, fmt.Errorf("cannot obtain data about hotplug slots: %v", err)
+	}
+	if slots == nil {
+		slots = make(map[string]*hotplugSlotInfo)
+	}
+	return slots, nil
+}
+
+func setHotplugSlots(st *state.State, slots map[string]*hotplugSlotInfo) {
+	st.Set("hotplug-slots", slots)
+}
+
+// findHotplugSlot returns the slot created by the given interface for
+// the device with the given key.
+func findHotplugSlot(slots map[string]*hotplugSlotInfo, ifaceName, key string) *hotplugSlotInfo {
+	for _, slot := range slots {
+		if slot.Interface == ifaceName && slot.HotplugKey == key {
+			return slot
+		}
+	}
+	return nil
+}
+
+func hotplugEnabled(st *state.State) (bool, error) {
+	tr := config.NewTransaction(st)
+	var enabled bool
+	err := tr.Get("core", "experimental.hotplug", &enabled)
+	if err != nil && !config.IsNoOption(err) {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// udevMonitorRetryInterval is how long to wait before trying to start
+// monitoring hotplug events again after a failure.
+var udevMonitorRetryInterval = 1 * time.Hour
+
+// ensureUDevMonitor starts the monitoring of hotplug events, once the
+// feature is enabled and a core snap is installed, reporting the devices
+// that are already present first.
+func (m *InterfaceManager) ensureUDevMonitor() error {
+	if m.udevMon != nil {
+		return nil
+	}
+	if time.Now().Before(m.udevRetryTime) {
+		return nil
+	}
+
+	st := m.state
+	st.Lock()
+	enabled, err := hotplugEnabled(st)
+	if err == nil && enabled {
+		_, err = snapstate.CoreInfo(st)
+		if err == state.ErrNoState {
+			// nothing to do until core is installed
+			enabled, err = false, nil
+		}
+	}
+	st.Unlock()
+	if err != nil || !enabled {
+		return err
+	}
+
+	mon := createUDevMonitor(m.hotplugDeviceAdded, m.hotplugDeviceRemoved)
+	if err := m.startUDevMonitor(mon); err != nil {
+		// do not try again on every ensure
+		m.udevRetryTime = time.Now().Add(udevMonitorRetryInterval)
+		return err
+	}
+	m.udevMon = mon
+	m.udevRetryTime = time.Time{}
+	return nil
+}
+
+func (m *InterfaceManager) startUDevMonitor(mon udevMonitor) error {
+	if err := mon.Connect(); err != nil {
+		return err
+	}
+	// devices added after connecting to udev and before enumerating
+	// are reported twice, which is taken care of by hotplugDeviceAdded
+	if err := enumerateExistingDevices(m.hotplugDeviceAdded); err != nil {
+		mon.Stop()
+		return err
+	}
+	if err := mon.Run(); err != nil {
+		mon.Stop()
+		return err
+	}
+	return nil
+}
+
+func (m *InterfaceManager) stopUDevMonitor() {
+	if m.udevMon == nil {
+		return
+	}
+	if err := m.udevMon.Stop(); err != nil {
+		logger.Noticef("cannot stop udev monitor: %v", err)
+	}
+	m.udevMon = nil
+}
+
+var slotNameInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// suggestedSlotName returns a valid slot name based on the model of the
+// device or, failing that, on the given fallback.
+func suggestedSlotName(di *hotplug.HotplugDeviceInfo, fallback string) string {
+	for _, prop := range []string{"ID_MODEL_FROM_DATABASE", "ID_MODEL"} {
+		model, _ := di.Attribute(prop)
+		name := slotNameInvalidChars.ReplaceAllString(strings.ToLower(model), "-")
+		name = strings.Trim(strings.TrimLeft(name, "0123456789-"), "-")
+		if name != "" {
+			return name
+		}
+	}
+	return fallback
+}
+
+// hotplugDeviceAdded is called for every device that appears in the
+// system. Every interface that can handle hotplugged devices is asked
+// whether it wants a slot for the device, and a change creating the slots
+// and restoring their connections is made.
+func (m *InterfaceManager) hotplugDeviceAdded(di *hotplug.HotplugDeviceInfo) {
+	st := m.state
+	st.Lock()
+	defer st.Unlock()
+
+	devPath := di.DevicePath()
+	if m.presentHotplugDevice(devPath) != nil {
+		return
+	}
+
+	key := hotplug.DeviceKey(di)
+	var tasks []*state.Task
+	var devSlots []hotplugDeviceSlot
+	for _, iface := range m.repo.AllInterfaces() {
+		handler, ok := iface.(hotplug.HotplugDeviceHandler)
+		if !ok {
+			continue
+		}
+		spec, err := handler.HotplugDeviceDetected(di)
+		if err != nil {
+			logger.Noticef("cannot handle hotplug device %s with interface %q: %v", di, iface.Name(), err)
+			continue
+		}
+		if spec == nil {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = suggestedSlotName(di, iface.Name())
+		}
+
+		addSlot := st.NewTask("hotplug-add-slot", fmt.Sprintf(i18n.G("Create slot for device %s with interface %q"), di, iface.Name()))
+		addSlot.Set("interface", iface.Name())
+		addSlot.Set("hotplug-key", key)
+		addSlot.Set("slot-spec", spec)
+		connect := st.NewTask("hotplug-connect", fmt.Sprintf(i18n.G("Connect plugs of snaps to the slot for device %s with interface %q"), di, iface.Name()))
+		connect.Set("interface", iface.Name())
+		connect.Set("hotplug-key", key)
+		connect.WaitFor(addSlot)
+		tasks = append(tasks, addSlot, connect)
+		devSlots = append(devSlots, hotplugDeviceSlot{iface: iface.Name(), key: key})
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	chg := st.NewChange("hotplug-add", fmt.Sprintf(i18n.G("Add hotplug slots for device %s"), di))
+	chg.AddAll(state.NewTaskSet(tasks...))
+	m.hotplugDevices[devPath] = &hotplugDevice{slots: devSlots, addChangeID: chg.ID()}
+	st.EnsureBefore(0)
+}
+
+// hotplugDeviceRemoved is called for every device that goes away. A
+// change disconnecting and removing the slots created for the device is
+// made; the connections are remembered for when the device reappears.
+func (m *InterfaceManager) hotplugDeviceRemoved(di *hotplug.HotplugDeviceInfo) {
+	st := m.state
+	st.Lock()
+	defer st.Unlock()
+
+	devPath := di.DevicePath()
+	dev := m.presentHotplugDevice(devPath)
+	if dev == nil {
+		return
+	}
+	delete(m.hotplugDevices, devPath)
+
+	var tasks []*state.Task
+	for _, devSlot := range dev.slots {
+		disconnect := st.NewTask("hotplug-disconnect", fmt.Sprintf(i18n.G("Disconnect the slot for device %s with interface %q"), di, devSlot.iface))
+		disconnect.Set("interface", devSlot.iface)
+		disconnect.Set("hotplug-key", devSlot.key)
+		removeSlot := st.NewTask("hotplug-remove-slot", fmt.Sprintf(i18n.G("Remove the slot for device %s with interface %q"), di, devSlot.iface))
+		removeSlot.Set("interface", devSlot.iface)
+		removeSlot.Set("hotplug-key", devSlot.key)
+		removeSlot.WaitFor(disconnect)
+		tasks = append(tasks, disconnect, removeSlot)
+	}
+
+	chg := st.NewChange("hotplug-remove", fmt.Sprintf(i18n.G("Remove hotplug slots for device %s"), di))
+	chg.AddAll(state.NewTaskSet(tasks...))
+	st.EnsureBefore(0)
+}
+
+func getHotplugAttrs(task *state.Task) (ifaceName, key string, err error) {
+	if err := task.Get("interface", &ifaceName); err != nil {
+		return "", "", fmt.Errorf("internal error: cannot get interface name from hotplug task: %v", err)
+	}
+	if err := task.Get("hotplug-key", &key); err != nil {
+		return "", "", fmt.Errorf("internal error: cannot get hotplug key from hotplug task: %v", err)
+	}
+	return ifaceName, key, nil
+}
+
+// uniqueSlotName returns the given name, or the name with the lowest
+// numeric suffix, that isn't used by another slot of the snap.
+func uniqueSlotName(name string, used func(string) bool) string {
+	candidate := name
+	for i := 1; used(candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
+
+func newHotplugSlot(coreInfo *snap.Info, slotInfo *hotplugSlotInfo) *interfaces.Slot {
+	return &interfaces.Slot{SlotInfo: &snap.SlotInfo{
+		Snap:      coreInfo,
+		Name:      slotInfo.Name,
+		Interface: slotInfo.Interface,
+		Attrs:     slotInfo.StaticAttrs,
+	}}
+}
+
+func (m *InterfaceManager) doHotplugAddSlot(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	ifaceName, key, err := getHotplugAttrs(task)
+	if err != nil {
+		return err
+	}
+	var spec hotplug.SlotSpec
+	if err := task.Get("slot-spec", &spec); err != nil {
+		return fmt.Errorf("internal error: cannot get slot specification from hotplug task: %v", err)
+	}
+
+	coreInfo, err := snapstate.CoreInfo(st)
+	if err != nil {
+		return fmt.Errorf("cannot find the core snap: %v", err)
+	}
+	slots, err := getHotplugSlots(st)
+	if err != nil {
+		return err
+	}
+
+	slotInfo := findHotplugSlot(slots, ifaceName, key)
+	if slotInfo == nil {
+		name := uniqueSlotName(spec.Name, func(name string) bool {
+			_, ok := slots[name]
+			return ok || coreInfo.Slots[name] != nil || m.repo.Slot(coreInfo.Name(), name) != nil
+		})
+		slotInfo = &hotplugSlotInfo{
+			Name:       name,
+			Interface:  ifaceName,
+			HotplugKey: key,
+		}
+	}
+	slotInfo.StaticAttrs = spec.Attrs
+
+	if m.repo.Slot(coreInfo.Name(), slotInfo.Name) == nil {
+		if err := m.repo.AddSlot(newHotplugSlot(coreInfo, slotInfo)); err != nil {
+			return fmt.Errorf("cannot create slot %q for hotplugged device: %v", slotInfo.Name, err)
+		}
+		task.Logf("Created slot %q for interface %q", slotInfo.Name, ifaceName)
+	}
+
+	slots[slotInfo.Name] = slotInfo
+	setHotplugSlots(st, slots)
+	return nil
+}
+
+// hotplugTaskSlot returns the hotplug slot the task is about, or nil if
+// it doesn't exist.
+func hotplugTaskSlot(task *state.Task) (*hotplugSlotInfo, error) {
+	ifaceName, key, err := getHotplugAttrs(task)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := getHotplugSlots(task.State())
+	if err != nil {
+		return nil, err
+	}
+	return findHotplugSlot(slots, ifaceName, key), nil
+}
+
+func (m *InterfaceManager) doHotplugConnect(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	slotInfo, err := hotplugTaskSlot(task)
+	if err != nil {
+		return err
+	}
+	coreInfo, err := snapstate.CoreInfo(st)
+	if err != nil {
+		return fmt.Errorf("cannot find the core snap: %v", err)
+	}
+	if slotInfo == nil || m.repo.Slot(coreInfo.Name(), slotInfo.Name) == nil {
+		return fmt.Errorf("internal error: cannot find the slot for the hotplugged device")
+	}
+
+	conns, err := getConns(st)
+	if err != nil {
+		return err
+	}
+	affected := make(map[string]bool)
+	for id, conn := range conns {
+		if !conn.HotplugGone {
+			continue
+		}
+		connRef, err := interfaces.ParseConnRef(id)
+		if err != nil {
+			return err
+		}
+		if connRef.SlotRef.Snap != coreInfo.Name() || connRef.SlotRef.Name != slotInfo.Name {
+			continue
+		}
+		if err := m.repo.ConnectWithAttrs(connRef, conn.PlugDynamic, conn.SlotDynamic); err != nil {
+			task.Logf("cannot restore connection %s: %v", id, err)
+			continue
+		}
+		conn.HotplugGone = false
+		conns[id] = conn
+		affected[connRef.PlugRef.Snap] = true
+	}
+	setConns(st, conns)
+
+	return m.setupAffectedSnaps(task, coreInfo.Name(), sortedNames(affected))
+}
+
+func (m *InterfaceManager) doHotplugDisconnect(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	slotInfo, err := hotplugTaskSlot(task)
+	if err != nil {
+		return err
+	}
+	coreInfo, err := snapstate.CoreInfo(st)
+	if err != nil {
+		return fmt.Errorf("cannot find the core snap: %v", err)
+	}
+	if slotInfo == nil || m.repo.Slot(coreInfo.Name(), slotInfo.Name) == nil {
+		// nothing to disconnect
+		return nil
+	}
+
+	connRefs, err := m.repo.Connected(coreInfo.Name(), slotInfo.Name)
+	if err != nil {
+		return err
+	}
+	m.repo.DisconnectAll(connRefs)
+
+	conns, err := getConns(st)
+	if err != nil {
+		return err
+	}
+	affected := make(map[string]bool)
+	for _, connRef := range connRefs {
+		id := connRef.ID()
+		if conn, ok := conns[id]; ok {
+			// remember the connection for when the device reappears
+			conn.HotplugGone = true
+			conns[id] = conn
+		}
+		affected[connRef.PlugRef.Snap] = true
+	}
+	setConns(st, conns)
+
+	return m.setupAffectedSnaps(task, coreInfo.Name(), sortedNames(affected))
+}
+
+func (m *InterfaceManager) doHotplugRemoveSlot(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	slotInfo, err := hotplugTaskSlot(task)
+	if err != nil {
+		return err
+	}
+	coreInfo, err := snapstate.CoreInfo(st)
+	if err != nil {
+		return fmt.Errorf("cannot find the core snap: %v", err)
+	}
+	if slotInfo == nil || m.repo.Slot(coreInfo.Name(), slotInfo.Name) == nil {
+		return nil
+	}
+	if err := m.repo.RemoveSlot(coreInfo.Name(), slotInfo.Name); err != nil {
+		return fmt.Errorf("cannot remove slot %q of hotplugged device: %v", slotInfo.Name, err)
+	}
+	task.Logf("Removed slot %q for interface %q", slotInfo.Name, slotInfo.Interface)
+	return nil
+}
+
+// findSlotOfHotplugDevice returns the details of the given slot if it
+// was created for a hotplugged device, whether or not the device is
+// currently present, or nil otherwise.
+func findSlotOfHotplugDevice(st *state.State, snapName, slotName string) (*hotplugSlotInfo, error) {
+	slots, err := getHotplugSlots(st)
+	if err != nil {
+		return nil, err
+	}
+	slotInfo, ok := slots[slotName]
+	if !ok {
+		return nil, nil
+	}
+	coreInfo, err := snapstate.CoreInfo(st)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if snapName != coreInfo.Name() {
+		return nil, nil
+	}
+	return slotInfo, nil
+}
+
+// hotplugSlotsOfSnap returns copies of the slots of hotplugged devices
+// currently present that belong to the given snap.
+func (m *InterfaceManager) hotplugSlotsOfSnap(snapName string) ([]*interfaces.Slot, error) {
+	var result []*interfaces.Slot
+	for _, slot := range m.repo.Slots(snapName) {
+		hotplugSlot, err := findSlotOfHotplugDevice(m.state, snapName, slot.Name)
+		if err != nil {
+			return nil, err
+		}
+		if hotplugSlot == nil {
+			continue
+		}
+		slotInfo := *slot.SlotInfo
+		result = append(result, &interfaces.Slot{SlotInfo: &slotInfo})
+	}
+	return result, nil
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,428 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate_test
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// hotplugInterface creates slots for the tty devices.
+type hotplugInterface struct {
+	ifacetest.TestInterface
+}
+
+func (iface *hotplugInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.SlotSpec, error) {
+	if di.Subsystem() != "tty" {
+		return nil, nil
+	}
+	return &hotplug.SlotSpec{
+		Attrs: map[string]interface{}{"path": di.DeviceName()},
+	}, nil
+}
+
+type fakeUDevMonitor struct {
+	added, removed hotplug.DeviceCallback
+	connected      bool
+	running        bool
+	connectCalls   int
+	connectErr     error
+}
+
+func (m *fakeUDevMonitor) Connect() error {
+	m.connectCalls++
+	if m.connectErr != nil {
+		return m.connectErr
+	}
+	m.connected = true
+	return nil
+}
+
+func (m *fakeUDevMonitor) Run() error {
+	m.running = true
+	return nil
+}
+
+func (m *fakeUDevMonitor) Stop() error {
+	m.running = false
+	return nil
+}
+
+var hotplugCoreYaml = `name: core
+version: 1
+type: os
+`
+
+var hotplugConsumerYaml = `name: consumer
+version: 1
+plugs:
+ plug:
+  interface: test
+`
+
+func (s *interfaceManagerSuite) mockHotplug(c *C, enabled bool, existing ...map[string]string) (*fakeUDevMonitor, func()) {
+	s.mockIface(c, &hotplugInterface{ifacetest.TestInterface{InterfaceName: "test"}})
+	s.mockSnap(c, hotplugCoreYaml)
+	s.setSnapType(c, "core", "os")
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "experimental.hotplug", enabled), IsNil)
+	tr.Commit()
+	s.state.Unlock()
+
+	mon := &fakeUDevMonitor{}
+	restoreMonitor := ifacestate.MockCreateUDevMonitor(func(added, removed hotplug.DeviceCallback) ifacestate.UDevMonitor {
+		mon.added = added
+		mon.removed = removed
+		return mon
+	})
+	restoreEnumerate := ifacestate.MockEnumerateExistingDevices(func(cb hotplug.DeviceCallback) error {
+		for _, env := range existing {
+			cb(s.deviceInfo(c, env))
+		}
+		return nil
+	})
+	return mon, func() {
+		restoreMonitor()
+		restoreEnumerate()
+	}
+}
+
+func (s *interfaceManagerSuite) setSnapType(c *C, name, typ string) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, name, &snapst), IsNil)
+	snapst.SnapType = typ
+	snapstate.Set(s.state, name, &snapst)
+}
+
+func (s *interfaceManagerSuite) hotplugSlots(c *C, repo *interfaces.Repository) []string {
+	var names []string
+	for _, slot := range repo.Slots("core") {
+		if slot.Interface == "test" {
+			names = append(names, slot.Name)
+		}
+	}
+	return names
+}
+
+func (s *interfaceManagerSuite) deviceInfo(c *C, env map[string]string) *hotplug.HotplugDeviceInfo {
+	di, err := hotplug.NewHotplugDeviceInfo(env)
+	c.Assert(err, IsNil)
+	return di
+}
+
+var (
+	serialDevice1 = map[string]string{
+		"DEVPATH":      "/devices/a/ttyUSB0",
+		"DEVNAME":      "/dev/ttyUSB0",
+		"SUBSYSTEM":    "tty",
+		"ID_MODEL":     "FT232R USB UART",
+		"ID_VENDOR_ID": "0403",
+		"ID_MODEL_ID":  "6001",
+		"ID_SERIAL":    "FTDI_FT232R_USB_UART_A1",
+	}
+	serialDevice2 = map[string]string{
+		"DEVPATH":      "/devices/b/ttyUSB1",
+		"DEVNAME":      "/dev/ttyUSB1",
+		"SUBSYSTEM":    "tty",
+		"ID_MODEL":     "FT232R USB UART",
+		"ID_VENDOR_ID": "0403",
+		"ID_MODEL_ID":  "6001",
+		"ID_SERIAL":    "FTDI_FT232R_USB_UART_B2",
+	}
+	otherDevice = map[string]string{
+		"DEVPATH":   "/devices/c/hidraw0",
+		"DEVNAME":   "/dev/hidraw0",
+		"SUBSYSTEM": "hidraw",
+	}
+)
+
+func (s *interfaceManagerSuite) TestHotplugDisabled(c *C) {
+	mon, restore := s.mockHotplug(c, false, serialDevice1)
+	defer restore()
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(mon.connected, Equals, false)
+	c.Check(s.hotplugSlots(c, mgr.Repository()), HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestHotplugNoCore(c *C) {
+	created := false
+	restore := ifacestate.MockCreateUDevMonitor(func(added, removed hotplug.DeviceCallback) ifacestate.UDevMonitor {
+		created = true
+		return &fakeUDevMonitor{}
+	})
+	defer restore()
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "experimental.hotplug", true), IsNil)
+	tr.Commit()
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(created, Equals, false)
+}
+
+func (s *interfaceManagerSuite) TestHotplugExistingDevices(c *C) {
+	mon, restore := s.mockHotplug(c, true, serialDevice1, serialDevice2, otherDevice)
+	defer restore()
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(mon.connected, Equals, true)
+	c.Check(mon.running, Equals, true)
+	s.settle(c)
+
+	repo := mgr.Repository()
+	slot1 := repo.Slot("core", "ft232r-usb-uart")
+	c.Assert(slot1, NotNil)
+	c.Check(slot1.Interface, Equals, "test")
+	c.Check(slot1.Attrs, DeepEquals, map[string]interface{}{"path": "/dev/ttyUSB0"})
+	// the second device of the same model gets a unique name
+	slot2 := repo.Slot("core", "ft232r-usb-uart-1")
+	c.Assert(slot2, NotNil)
+	c.Check(slot2.Attrs, DeepEquals, map[string]interface{}{"path": "/dev/ttyUSB1"})
+	c.Check(s.hotplugSlots(c, repo), DeepEquals, []string{"ft232r-usb-uart", "ft232r-usb-uart-1"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	for _, chg := range s.state.Changes() {
+		c.Check(chg.Kind(), Equals, "hotplug-add")
+		c.Check(chg.Status(), Equals, state.DoneStatus)
+	}
+	c.Check(s.state.Changes(), HasLen, 2)
+
+	mgr.Stop()
+	c.Check(mon.running, Equals, false)
+}
+
+func (s *interfaceManagerSuite) TestHotplugConnectFailureBacksOff(c *C) {
+	mon, restore := s.mockHotplug(c, true)
+	defer restore()
+	restoreInterval := ifacestate.MockUDevMonitorRetryInterval(50 * time.Millisecond)
+	defer restoreInterval()
+	mon.connectErr = fmt.Errorf("boom")
+
+	mgr := s.manager(c)
+	c.Check(mgr.Ensure(), ErrorMatches, "cannot start monitoring hotplug devices: boom")
+	// no new attempt right away
+	c.Check(mgr.Ensure(), IsNil)
+	c.Check(mon.connectCalls, Equals, 1)
+
+	// but after a while
+	mon.connectErr = nil
+	time.Sleep(60 * time.Millisecond)
+	c.Check(mgr.Ensure(), IsNil)
+	c.Check(mon.connectCalls, Equals, 2)
+	c.Check(mon.running, Equals, true)
+}
+
+func (s *interfaceManagerSuite) TestHotplugAddFailureIsRetried(c *C) {
+	mon, restore := s.mockHotplug(c, true)
+	defer restore()
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+
+	// creating the slot fails
+	s.state.Lock()
+	s.state.Set("hotplug-slots", "garbage")
+	s.state.Unlock()
+	mon.added(s.deviceInfo(c, serialDevice1))
+	s.settle(c)
+	repo := mgr.Repository()
+	c.Check(repo.Slot("core", "ft232r-usb-uart"), IsNil)
+
+	// the device is not considered present, a removal is a no-op
+	mon.removed(s.deviceInfo(c, serialDevice1))
+	s.state.Lock()
+	c.Check(s.state.Changes(), HasLen, 1)
+	s.state.Set("hotplug-slots", nil)
+	s.state.Unlock()
+
+	// and once reported again it's handled anew
+	mon.added(s.deviceInfo(c, serialDevice1))
+	s.settle(c)
+	c.Check(repo.Slot("core", "ft232r-usb-uart"), NotNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(s.state.Changes(), HasLen, 2)
+}
+
+func (s *interfaceManagerSuite) TestHotplugReconnect(c *C) {
+	mon, restore := s.mockHotplug(c, true)
+	defer restore()
+	s.mockSnap(c, hotplugConsumerYaml)
+	s.setSnapType(c, "consumer", "app")
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Assert(mon.running, Equals, true)
+
+	// the device is plugged in and its slot connected
+	mon.added(s.deviceInfo(c, serialDevice1))
+	s.settle(c)
+	repo := mgr.Repository()
+	c.Assert(repo.Slot("core", "ft232r-usb-uart"), NotNil)
+
+	s.state.Lock()
+	ts, err := ifacestate.Connect(s.state, "consumer", "plug", "core", "ft232r-usb-uart")
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("connect", "")
+	chg.AddAll(ts)
+	s.state.Unlock()
+	s.settle(c)
+
+	s.state.Lock()
+	c.Assert(chg.Err(), IsNil)
+	s.state.Unlock()
+	connRef := interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "core", Name: "ft232r-usb-uart"},
+	}
+	conns, err := repo.Connected("consumer", "plug")
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, []interfaces.ConnRef{connRef})
+
+	// the device is unplugged, the connection is remembered
+	mon.removed(s.deviceInfo(c, serialDevice1))
+	s.settle(c)
+	c.Check(repo.Slot("core", "ft232r-usb-uart"), IsNil)
+	conns, err = repo.Connected("consumer", "plug")
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 0)
+
+	s.state.Lock()
+	var connStates map[string]interface{}
+	c.Assert(s.state.Get("conns", &connStates), IsNil)
+	c.Check(connStates, DeepEquals, map[string]interface{}{
+		"consumer:plug core:ft232r-usb-uart": map[string]interface{}{
+			"interface":    "test",
+			"hotplug-gone": true,
+		},
+	})
+	s.state.Unlock()
+
+	// the device is plugged into another port, the slot gets the same
+	// name and is connected again
+	s.secBackend.SetupCalls = nil
+	env := make(map[string]string)
+	for k, v := range serialDevice1 {
+		env[k] = v
+	}
+	env["DEVPATH"] = "/devices/z/ttyUSB3"
+	env["DEVNAME"] = "/dev/ttyUSB3"
+	mon.added(s.deviceInfo(c, env))
+	s.settle(c)
+	slot := repo.Slot("core", "ft232r-usb-uart")
+	c.Assert(slot, NotNil)
+	c.Check(slot.Attrs, DeepEquals, map[string]interface{}{"path": "/dev/ttyUSB3"})
+	conns, err = repo.Connected("consumer", "plug")
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, []interfaces.ConnRef{connRef})
+	c.Assert(s.secBackend.SetupCalls, HasLen, 1)
+	c.Check(s.secBackend.SetupCalls[0].SnapInfo.Name(), Equals, "consumer")
+
+	s.state.Lock()
+	c.Assert(s.state.Get("conns", &connStates), IsNil)
+	c.Check(connStates, DeepEquals, map[string]interface{}{
+		"consumer:plug core:ft232r-usb-uart": map[string]interface{}{
+			"interface": "test",
+		},
+	})
+	s.state.Unlock()
+}
+
+func (s *interfaceManagerSuite) TestHotplugConnectionsOfGoneDevicesAtStartup(c *C) {
+	_, restore := s.mockHotplug(c, false)
+	defer restore()
+	s.mockSnap(c, hotplugConsumerYaml)
+	s.setSnapType(c, "consumer", "app")
+
+	s.state.Lock()
+	s.state.Set("hotplug-slots", map[string]interface{}{
+		"ft232r-usb-uart": map[string]interface{}{
+			"name":        "ft232r-usb-uart",
+			"interface":   "test",
+			"hotplug-key": "1234",
+		},
+	})
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug core:ft232r-usb-uart": map[string]interface{}{"interface": "test"},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+	c.Check(mgr.Repository().Slot("core", "ft232r-usb-uart"), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	var connStates map[string]interface{}
+	c.Assert(s.state.Get("conns", &connStates), IsNil)
+	c.Check(connStates, DeepEquals, map[string]interface{}{
+		"consumer:plug core:ft232r-usb-uart": map[string]interface{}{
+			"interface":    "test",
+			"hotplug-gone": true,
+		},
+	})
+	// no warning about the connection that cannot be restored
+	c.Check(s.state.AllWarnings(), HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestHotplugSlotsKeptOnCoreRefresh(c *C) {
+	mon, restore := s.mockHotplug(c, true, serialDevice1)
+	defer restore()
+
+	mgr := s.manager(c)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Assert(mon.running, Equals, true)
+	s.settle(c)
+	c.Assert(s.hotplugSlots(c, mgr.Repository()), DeepEquals, []string{"ft232r-usb-uart"})
+
+	change := s.addSetupSnapSecurityChange(c, &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{RealName: "core", Revision: snap.R(1)},
+	})
+	s.settle(c)
+
+	s.state.Lock()
+	c.Assert(change.Err(), IsNil)
+	s.state.Unlock()
+	slot := mgr.Repository().Slot("core", "ft232r-usb-uart")
+	c.Assert(slot, NotNil)
+	c.Check(slot.Attrs, DeepEquals, map[string]interface{}{"path": "/dev/ttyUSB0"})
+}
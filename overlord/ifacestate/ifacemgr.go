@@ -23,6 +23,7 @@ package ifacestate
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/snapcore/snapd/i18n/dumb"
 	"github.com/snapcore/snapd/interfaces"
@@ -40,6 +41,13 @@ type InterfaceManager struct {
 	state  *state.State
 	runner *state.TaskRunner
 	repo   *interfaces.Repository
+
+	udevMon udevMonitor
+	// udevRetryTime is when to try starting the udev monitor again
+	// after it failed
+	udevRetryTime time.Time
+	// the devices currently present, by device path
+	hotplugDevices map[string]*hotplugDevice
 }
 
 // Manager returns a new InterfaceManager.
@@ -55,6 +63,8 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, extraInterfaces
 		state:  s,
 		runner: runner,
 		repo:   interfaces.NewRepository(),
+
+		hotplugDevices: make(map[string]*hotplugDevice),
 	}
 	if err := m.initialize(extraInterfaces, extraBackends); err != nil {
 		return nil, err
@@ -70,6 +80,13 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, extraInterfaces
 	runner.AddHandler("setup-profiles", m.doSetupProfiles, m.undoSetupProfiles)
 	runner.AddHandler("remove-profiles", m.doRemoveProfiles, m.doSetupProfiles)
 	runner.AddHandler("discard-conns", m.doDiscardConns, m.undoDiscardConns)
+	runner.AddHandler("gadget-connect", m.doGadgetConnect, nil)
+
+	// slots of hotplugged devices
+	runner.AddHandler("hotplug-add-slot", m.doHotplugAddSlot, nil)
+	runner.AddHandler("hotplug-connect", m.doHotplugConnect, nil)
+	runner.AddHandler("hotplug-disconnect", m.doHotplugDisconnect, nil)
+	runner.AddHandler("hotplug-remove-slot", m.doHotplugRemoveSlot, nil)
 
 	// helper for ubuntu-core -> core
 	runner.AddHandler("transition-ubuntu-core", m.doTransitionUbuntuCore, m.undoTransitionUbuntuCore)
@@ -106,6 +123,10 @@ func setInitialConnectAttributes(ts *state.Task, plugSnap string, plugName strin
 	snap.AddImplicitSlots(snapInfo)
 	if slot, ok := snapInfo.Slots[slotName]; ok {
 		ts.Set("slot-attrs", slot.Attrs)
+	} else if hotplugSlot, err := findSlotOfHotplugDevice(st, slotSnap, slotName); err != nil {
+		return err
+	} else if hotplugSlot != nil {
+		ts.Set("slot-attrs", hotplugSlot.StaticAttrs)
 	} else {
 		return fmt.Errorf("snap %q has no slot named %q", slotSnap, slotName)
 	}
@@ -195,7 +216,21 @@ func Connect(st *state.State, plugSnap, plugName, slotSnap, slotName string) (*s
 }
 
 // Disconnect returns a set of tasks for  disconnecting an interface.
+//
+// Connections that were made automatically are remembered as undesired
+// so that they are not made again automatically.
 func Disconnect(st *state.State, plugSnap, plugName, slotSnap, slotName string) (*state.TaskSet, error) {
+	return disconnect(st, plugSnap, plugName, slotSnap, slotName, false)
+}
+
+// Forget returns a set of tasks for disconnecting an interface and
+// dropping any record of the connection, including that of a previous
+// disconnection of an automatic connection.
+func Forget(st *state.State, plugSnap, plugName, slotSnap, slotName string) (*state.TaskSet, error) {
+	return disconnect(st, plugSnap, plugName, slotSnap, slotName, true)
+}
+
+func disconnect(st *state.State, plugSnap, plugName, slotSnap, slotName string, forget bool) (*state.TaskSet, error) {
 	if err := snapstate.CheckChangeConflict(st, plugSnap, nil); err != nil {
 		return nil, err
 	}
@@ -208,12 +243,59 @@ func Disconnect(st *state.State, plugSnap, plugName, slotSnap, slotName string)
 	task := st.NewTask("disconnect", summary)
 	task.Set("slot", interfaces.SlotRef{Snap: slotSnap, Name: slotName})
 	task.Set("plug", interfaces.PlugRef{Snap: plugSnap, Name: plugName})
+	if forget {
+		task.Set("forget", true)
+	}
 	return state.NewTaskSet(task), nil
 }
 
+// GadgetConnect returns a set of tasks for making the connections
+// requested by the gadget among the installed snaps.
+func GadgetConnect(st *state.State) *state.TaskSet {
+	task := st.NewTask("gadget-connect", i18n.G("Connect plugs and slots as requested by the gadget"))
+	return state.NewTaskSet(task)
+}
+
+// ConnectionState describes the state of a connection as recorded by
+// the interface manager.
+type ConnectionState struct {
+	// Interface is the name of the interface of the connection.
+	Interface string
+	// Auto is true if the connection was made automatically.
+	Auto bool
+	// ByGadget is true if the connection was requested by the gadget.
+	ByGadget bool
+	// Undesired is true if the connection was made automatically
+	// but was then disconnected by the user.
+	Undesired bool
+}
+
+// ConnectionStates returns the state of all the connections in the
+// system, keyed by connection ID (see interfaces.ConnRef.ID).
+func ConnectionStates(st *state.State) (map[string]ConnectionState, error) {
+	conns, err := getConns(st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]ConnectionState, len(conns))
+	for id, conn := range conns {
+		result[id] = ConnectionState{
+			Interface: conn.Interface,
+			Auto:      conn.Auto,
+			ByGadget:  conn.ByGadget,
+			Undesired: conn.Undesired,
+		}
+	}
+	return result, nil
+}
+
 // Ensure implements StateManager.Ensure.
 func (m *InterfaceManager) Ensure() error {
 	m.runner.Ensure()
+	if err := m.ensureUDevMonitor(); err != nil {
+		return fmt.Errorf("cannot start monitoring hotplug devices: %v", err)
+	}
 	return nil
 }
 
@@ -225,7 +307,7 @@ func (m *InterfaceManager) Wait() {
 // Stop implements StateManager.Stop.
 func (m *InterfaceManager) Stop() {
 	m.runner.Stop()
-
+	m.stopUDevMonitor()
 }
 
 // Repository returns the interface repository used internally by the manager.
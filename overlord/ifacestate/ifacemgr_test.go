@@ -21,6 +21,8 @@ package ifacestate_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -33,10 +35,12 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
@@ -455,6 +459,31 @@ func (s *interfaceManagerSuite) TestDisconnectTask(c *C) {
 	c.Assert(slot.Name, Equals, "slot")
 }
 
+func (s *interfaceManagerSuite) TestConnectionStates(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	conns, err := ifacestate.ConnectionStates(s.state)
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 0)
+
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot":  map[string]interface{}{"interface": "test", "auto": true},
+		"consumer:other producer:slot": map[string]interface{}{"interface": "test"},
+		"consumer:third producer:slot": map[string]interface{}{"interface": "test", "auto": true, "undesired": true},
+		"consumer:gadg producer:slot":  map[string]interface{}{"interface": "test", "by-gadget": true},
+	})
+
+	conns, err = ifacestate.ConnectionStates(s.state)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, map[string]ifacestate.ConnectionState{
+		"consumer:plug producer:slot":  {Interface: "test", Auto: true},
+		"consumer:other producer:slot": {Interface: "test"},
+		"consumer:third producer:slot": {Interface: "test", Auto: true, Undesired: true},
+		"consumer:gadg producer:slot":  {Interface: "test", ByGadget: true},
+	})
+}
+
 // Disconnect works when both plug and slot are specified
 func (s *interfaceManagerSuite) TestDisconnectFull(c *C) {
 	s.testDisconnect(c, "consumer", "plug", "producer", "slot")
@@ -599,6 +628,7 @@ func (s *interfaceManagerSuite) mockSnap(c *C, yamlText string) *snap.Info {
 		Active:   true,
 		Sequence: []*snap.SideInfo{sideInfo},
 		Current:  sideInfo.Revision,
+		SnapType: string(snapInfo.Type),
 	})
 	return snapInfo
 }
@@ -707,12 +737,21 @@ slots:
 // The setup-profiles task will not auto-connect an plug that was previously
 // explicitly disconnected by the user.
 func (s *interfaceManagerSuite) TestDoSetupSnapSecurityHonorsDisconnect(c *C) {
-	c.Skip("feature disabled until redesign/reimpl")
 	// Add an OS snap as well as a sample snap with a "network" plug.
 	// The plug is normally auto-connected.
 	s.mockSnap(c, osSnapYaml)
 	snapInfo := s.mockSnap(c, sampleSnapYaml)
 
+	// The user disconnected the "network" plug before.
+	undesired := map[string]interface{}{
+		"snap:network ubuntu-core:network": map[string]interface{}{
+			"interface": "network", "auto": true, "undesired": true,
+		},
+	}
+	s.state.Lock()
+	s.state.Set("conns", undesired)
+	s.state.Unlock()
+
 	// Initialize the manager. This registers the two snaps.
 	mgr := s.manager(c)
 
@@ -733,11 +772,11 @@ func (s *interfaceManagerSuite) TestDoSetupSnapSecurityHonorsDisconnect(c *C) {
 	// Ensure that the task succeeded
 	c.Assert(change.Status(), Equals, state.DoneStatus)
 
-	// Ensure that "network" is not saved in the state as auto-connected.
+	// Ensure that "network" is still remembered as undesired.
 	var conns map[string]interface{}
 	err := s.state.Get("conns", &conns)
 	c.Assert(err, IsNil)
-	c.Check(conns, HasLen, 0)
+	c.Check(conns, DeepEquals, undesired)
 
 	// Ensure that "network" is really disconnected.
 	repo := mgr.Repository()
@@ -916,6 +955,195 @@ slots:
 	check(conns, plug)
 }
 
+var gadgetSnapYaml = `
+name: gadget
+version: 1
+type: gadget
+`
+
+var gadgetConnectionsYaml = `
+connections:
+  - plug: consumeridididididididididididid:plug
+    slot: produceridididididididididididid:slot
+`
+
+var noAutoConnectionBaseDeclaration = []byte(`
+type: base-declaration
+authority-id: canonical
+series: 16
+slots:
+  test:
+    allow-auto-connection: false
+`)
+
+// mockGadgetConnections installs a gadget from the given publisher
+// requesting a connection between consumer and producer, and sets the
+// brand of the device model.
+func (s *interfaceManagerSuite) mockGadgetConnections(c *C, gadgetPublisher, brand string) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnapDecl(c, "gadget", gadgetPublisher, nil)
+	s.mockSnapDecl(c, "producer", "one-publisher", nil)
+	s.mockSnapDecl(c, "consumer", "one-publisher", nil)
+
+	gadgetInfo := s.mockSnap(c, gadgetSnapYaml)
+	err := ioutil.WriteFile(filepath.Join(gadgetInfo.MountDir(), "meta", "gadget.yaml"), []byte(gadgetConnectionsYaml), 0644)
+	c.Assert(err, IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	err = auth.SetDevice(s.state, &auth.DeviceState{Brand: brand, Model: "my-model"})
+	c.Assert(err, IsNil)
+}
+
+func (s *interfaceManagerSuite) testDoSetupSnapSecurityGadgetConnections(c *C, gadgetPublisher string, check func(map[string]interface{}, *interfaces.Plug)) {
+	restore := assertstest.MockBuiltinBaseDeclaration(noAutoConnectionBaseDeclaration)
+	defer restore()
+	restore = release.MockOnClassic(true)
+	defer restore()
+
+	s.mockGadgetConnections(c, gadgetPublisher, "my-brand")
+	s.mockSnap(c, producerYaml)
+
+	// Initialize the manager. This registers the gadget and producer snaps.
+	mgr := s.manager(c)
+
+	snapInfo := s.mockSnap(c, consumerYaml)
+
+	// Run the setup-snap-security task and let it finish.
+	change := s.addSetupSnapSecurityChange(c, &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: snapInfo.Name(),
+			SnapID:   snapInfo.SnapID,
+			Revision: snapInfo.Revision,
+		},
+	})
+	mgr.Ensure()
+	mgr.Wait()
+	mgr.Stop()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Status(), Equals, state.DoneStatus)
+
+	var conns map[string]interface{}
+	err := s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+
+	plug := mgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, Not(IsNil))
+
+	check(conns, plug)
+}
+
+// The setup-profiles task makes the connections requested by a gadget of
+// the brand, bypassing the auto-connection rules.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityGadgetConnectionsBrand(c *C) {
+	s.testDoSetupSnapSecurityGadgetConnections(c, "my-brand", func(conns map[string]interface{}, plug *interfaces.Plug) {
+		c.Check(conns, DeepEquals, map[string]interface{}{
+			"consumer:plug producer:slot": map[string]interface{}{
+				"interface": "test", "auto": true, "by-gadget": true,
+			},
+		})
+		c.Check(plug.Connections, HasLen, 1)
+	})
+}
+
+// The setup-profiles task applies the auto-connection rules to the
+// connections requested by a gadget not published by the brand.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityGadgetConnectionsOtherPublisher(c *C) {
+	s.testDoSetupSnapSecurityGadgetConnections(c, "other-publisher", func(conns map[string]interface{}, plug *interfaces.Plug) {
+		c.Check(conns, HasLen, 0)
+		c.Check(plug.Connections, HasLen, 0)
+	})
+}
+
+func (s *interfaceManagerSuite) TestGadgetConnect(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(noAutoConnectionBaseDeclaration)
+	defer restore()
+	restore = release.MockOnClassic(true)
+	defer restore()
+
+	s.mockGadgetConnections(c, "my-brand", "my-brand")
+	s.mockSnap(c, producerYaml)
+	s.mockSnap(c, consumerYaml)
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	change := s.state.NewChange("seed", "")
+	change.AddAll(ifacestate.GadgetConnect(s.state))
+	s.state.Unlock()
+
+	mgr.Ensure()
+	mgr.Wait()
+	mgr.Stop()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Status(), Equals, state.DoneStatus, Commentf("%v", change.Err()))
+
+	var conns map[string]interface{}
+	err := s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "by-gadget": true,
+		},
+	})
+
+	plug := mgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, Not(IsNil))
+	c.Check(plug.Connections, HasLen, 1)
+
+	c.Assert(s.secBackend.SetupCalls, HasLen, 2)
+	c.Check(s.secBackend.SetupCalls[0].SnapInfo.Name(), Equals, "consumer")
+	c.Check(s.secBackend.SetupCalls[1].SnapInfo.Name(), Equals, "producer")
+}
+
+// Connections requested by the gadget that were disconnected by the user are
+// not made again.
+func (s *interfaceManagerSuite) TestGadgetConnectHonorsDisconnect(c *C) {
+	restore := assertstest.MockBuiltinBaseDeclaration(noAutoConnectionBaseDeclaration)
+	defer restore()
+	restore = release.MockOnClassic(true)
+	defer restore()
+
+	s.mockGadgetConnections(c, "my-brand", "my-brand")
+	s.mockSnap(c, producerYaml)
+	s.mockSnap(c, consumerYaml)
+
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "by-gadget": true, "undesired": true,
+		},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	change := s.state.NewChange("seed", "")
+	change.AddAll(ifacestate.GadgetConnect(s.state))
+	s.state.Unlock()
+
+	mgr.Ensure()
+	mgr.Wait()
+	mgr.Stop()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Status(), Equals, state.DoneStatus)
+
+	plug := mgr.Repository().Plug("consumer", "plug")
+	c.Assert(plug, Not(IsNil))
+	c.Check(plug.Connections, HasLen, 0)
+	c.Check(s.secBackend.SetupCalls, HasLen, 0)
+}
+
 // The setup-profiles task will only touch connection state for the task it
 // operates on or auto-connects to and will leave other state intact.
 func (s *interfaceManagerSuite) TestDoSetupSnapSecuirtyKeepsExistingConnectionState(c *C) {
@@ -1376,6 +1604,76 @@ func (s *interfaceManagerSuite) TestConnectTracksConnectionsInState(c *C) {
 	})
 }
 
+func (s *interfaceManagerSuite) TestConnectTracksDynamicAttrs(c *C) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	ts, err := ifacestate.Connect(s.state, "consumer", "plug", "producer", "slot")
+	c.Assert(err, IsNil)
+	// as if set by the prepare hooks
+	ts.Tasks()[2].Set("plug-dynamic", map[string]interface{}{"foo": "bar"})
+	ts.Tasks()[2].Set("slot-dynamic", map[string]interface{}{"path": "/run/socket"})
+
+	change := s.state.NewChange("connect", "")
+	change.AddAll(ts)
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Err(), IsNil)
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	var conns map[string]interface{}
+	err = s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface":    "test",
+			"plug-dynamic": map[string]interface{}{"foo": "bar"},
+			"slot-dynamic": map[string]interface{}{"path": "/run/socket"},
+		},
+	})
+
+	connRef := interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	plugDynamic, slotDynamic := mgr.Repository().DynamicAttrs(connRef)
+	c.Check(plugDynamic, DeepEquals, map[string]interface{}{"foo": "bar"})
+	c.Check(slotDynamic, DeepEquals, map[string]interface{}{"path": "/run/socket"})
+}
+
+func (s *interfaceManagerSuite) TestManagerReloadsDynamicAttrs(c *C) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface":    "test",
+			"slot-dynamic": map[string]interface{}{"path": "/run/socket"},
+		},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	connRef := interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}
+	plugDynamic, slotDynamic := mgr.Repository().DynamicAttrs(connRef)
+	c.Check(plugDynamic, IsNil)
+	c.Check(slotDynamic, DeepEquals, map[string]interface{}{"path": "/run/socket"})
+}
+
 func (s *interfaceManagerSuite) TestConnectSetsUpSecurity(c *C) {
 	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
 	s.mockSnap(c, consumerYaml)
@@ -1498,6 +1796,167 @@ func (s *interfaceManagerSuite) TestDisconnectTracksConnectionsInState(c *C) {
 	c.Check(conns, DeepEquals, map[string]interface{}{})
 }
 
+func (s *interfaceManagerSuite) runDisconnect(c *C, mgr *ifacestate.InterfaceManager, ts *state.TaskSet) *state.Change {
+	s.state.Lock()
+	ts.Tasks()[0].Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "consumer",
+		},
+	})
+	change := s.state.NewChange("disconnect", "")
+	change.AddAll(ts)
+	s.state.Unlock()
+
+	mgr.Ensure()
+	mgr.Wait()
+	mgr.Stop()
+	return change
+}
+
+func (s *interfaceManagerSuite) TestDisconnectRemembersAutoConnectionAsUndesired(c *C) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test", "auto": true},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	ts, err := ifacestate.Disconnect(s.state, "consumer", "plug", "producer", "slot")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	change := s.runDisconnect(c, mgr, ts)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Err(), IsNil)
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	var conns map[string]interface{}
+	err = s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, DeepEquals, map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "undesired": true,
+		},
+	})
+
+	repo := mgr.Repository()
+	c.Check(repo.Plug("consumer", "plug").Connections, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestForgetDropsAutoConnection(c *C) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test", "auto": true},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	ts, err := ifacestate.Forget(s.state, "consumer", "plug", "producer", "slot")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	change := s.runDisconnect(c, mgr, ts)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Err(), IsNil)
+	var conns map[string]interface{}
+	err = s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 0)
+
+	repo := mgr.Repository()
+	c.Check(repo.Plug("consumer", "plug").Connections, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestForgetUndesiredConnectionFull(c *C) {
+	s.testForgetUndesiredConnection(c, "consumer", "plug", "producer", "slot")
+}
+
+func (s *interfaceManagerSuite) TestForgetUndesiredConnectionSlot(c *C) {
+	s.testForgetUndesiredConnection(c, "", "", "producer", "slot")
+}
+
+func (s *interfaceManagerSuite) TestForgetUndesiredConnectionPlug(c *C) {
+	s.testForgetUndesiredConnection(c, "", "", "consumer", "plug")
+}
+
+func (s *interfaceManagerSuite) testForgetUndesiredConnection(c *C, plugSnap, plugName, slotSnap, slotName string) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "undesired": true,
+		},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	// the undesired connection is not restored
+	repo := mgr.Repository()
+	c.Check(repo.Plug("consumer", "plug").Connections, HasLen, 0)
+
+	s.state.Lock()
+	ts, err := ifacestate.Forget(s.state, plugSnap, plugName, slotSnap, slotName)
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	change := s.runDisconnect(c, mgr, ts)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Err(), IsNil)
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	var conns map[string]interface{}
+	err = s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestDisconnectUndesiredConnectionFails(c *C) {
+	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.state.Lock()
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{
+			"interface": "test", "auto": true, "undesired": true,
+		},
+	})
+	s.state.Unlock()
+
+	mgr := s.manager(c)
+
+	s.state.Lock()
+	ts, err := ifacestate.Disconnect(s.state, "consumer", "plug", "producer", "slot")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+	change := s.runDisconnect(c, mgr, ts)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Err(), ErrorMatches, `(?s).*cannot disconnect consumer:plug from producer:slot, it is not connected.*`)
+	var conns map[string]interface{}
+	err = s.state.Get("conns", &conns)
+	c.Assert(err, IsNil)
+	c.Check(conns, HasLen, 1)
+}
+
 func (s *interfaceManagerSuite) TestManagerReloadsConnections(c *C) {
 	s.mockIface(c, &ifacetest.TestInterface{InterfaceName: "test"})
 	s.mockSnap(c, consumerYaml)
@@ -1842,3 +2301,48 @@ func (s *interfaceManagerSuite) TestManagerTransitionConnectionsCoreUndo(c *C) {
 		},
 	})
 }
+
+func (s *interfaceManagerSuite) TestStartupRegeneratesProfilesWithSetupMany(c *C) {
+	backend := &ifacetest.TestSecurityBackendSetupMany{
+		TestSecurityBackend: ifacetest.TestSecurityBackend{BackendName: interfaces.SecurityAppArmor},
+	}
+	restore := ifacestate.MockSecurityBackends([]interfaces.SecurityBackend{backend, s.secBackend})
+	defer restore()
+	s.secBackend.BackendName = interfaces.SecuritySecComp
+
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	s.state.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "consumer", &snapst), IsNil)
+	snapst.Flags.DevMode = true
+	snapstate.Set(s.state, "consumer", &snapst)
+	s.state.Unlock()
+
+	s.manager(c)
+
+	// The backend that can set up many snaps is used once for all of them.
+	c.Assert(backend.SetupManyCalls, HasLen, 1)
+	c.Check(backend.SetupCalls, HasLen, 0)
+	call := backend.SetupManyCalls[0]
+	c.Assert(call.SnapInfos, HasLen, 2)
+	opts := make(map[string]interfaces.ConfinementOptions)
+	for i, snapInfo := range call.SnapInfos {
+		opts[snapInfo.Name()] = call.Options[i]
+	}
+	c.Check(opts, DeepEquals, map[string]interfaces.ConfinementOptions{
+		"consumer": {DevMode: true},
+		"producer": {},
+	})
+
+	// The other backend is still used snap by snap.
+	c.Assert(s.secBackend.SetupCalls, HasLen, 2)
+	opts = make(map[string]interfaces.ConfinementOptions)
+	for _, call := range s.secBackend.SetupCalls {
+		opts[call.SnapInfo.Name()] = call.Options
+	}
+	c.Check(opts, DeepEquals, map[string]interfaces.ConfinementOptions{
+		"consumer": {DevMode: true},
+		"producer": {},
+	})
+}
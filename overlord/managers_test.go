@@ -220,7 +220,7 @@ apps:
 `
 	snapInfo := ms.installLocalTestSnap(c, snapYamlContent+"version: 1.0")
 
-	ts, err := snapstate.Remove(st, "foo", snap.R(0))
+	ts, err := snapstate.Remove(st, "foo", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg := st.NewChange("remove-snap", "...")
 	chg.AddAll(ts)
@@ -403,6 +403,43 @@ func (ms *mgrsSuite) mockStore(c *C) *httptest.Server {
 				panic(err)
 			}
 			w.Write(output)
+		case "action":
+			dec := json.NewDecoder(r.Body)
+			var input struct {
+				Actions []struct {
+					Action      string `json:"action"`
+					InstanceKey string `json:"instance-key"`
+					Name        string `json:"name"`
+					SnapID      string `json:"snap-id"`
+				} `json:"actions"`
+			}
+			err := dec.Decode(&input)
+			if err != nil {
+				panic(err)
+			}
+			var results []map[string]interface{}
+			for _, a := range input.Actions {
+				name := a.Name
+				if a.Action == "refresh" {
+					name = ms.serveIDtoName[a.SnapID]
+				}
+				// identical revisions are filtered out by the client
+				results = append(results, map[string]interface{}{
+					"result":       a.Action,
+					"instance-key": a.InstanceKey,
+					"snap-id":      fakeSnapID(name),
+					"name":         name,
+					"snap":         json.RawMessage(fillHit(name)),
+				})
+			}
+			w.WriteHeader(http.StatusOK)
+			output, err := json.Marshal(map[string]interface{}{
+				"results": results,
+			})
+			if err != nil {
+				panic(err)
+			}
+			w.Write(output)
 		case "snap":
 			if ms.hijackServeSnap != nil {
 				ms.hijackServeSnap(w)
@@ -427,10 +464,13 @@ func (ms *mgrsSuite) mockStore(c *C) *httptest.Server {
 	c.Assert(err, IsNil)
 	assertionsURL, err := url.Parse(baseURL + "/assertions/")
 	c.Assert(err, IsNil)
+	snapActionURL, err := url.Parse(baseURL + "/action")
+	c.Assert(err, IsNil)
 	storeCfg := store.Config{
 		DetailsURI:    detailsURL,
 		BulkURI:       bulkURL,
 		AssertionsURI: assertionsURL,
+		SnapActionURI: snapActionURL,
 	}
 
 	mStore := store.New(&storeCfg, nil)
@@ -969,7 +1009,7 @@ func (ms *mgrsSuite) installLocalTestSnap(c *C, snapYamlContent string) *snap.In
 func (ms *mgrsSuite) removeSnap(c *C, name string) {
 	st := ms.o.State()
 
-	ts, err := snapstate.Remove(st, name, snap.R(0))
+	ts, err := snapstate.Remove(st, name, snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg := st.NewChange("remove-snap", "...")
 	chg.AddAll(ts)
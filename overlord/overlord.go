@@ -21,8 +21,8 @@
 package overlord
 
 import (
+	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -40,6 +40,8 @@ import (
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/patch"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/store"
@@ -57,7 +59,8 @@ var (
 // Overlord is the central manager of a snappy system, keeping
 // track of all available state managers and related helpers.
 type Overlord struct {
-	stateEng *StateEngine
+	stateEng     *StateEngine
+	stateBackend *overlordStateBackend
 	// ensure loop
 	loopTomb    *tomb.Tomb
 	ensureLock  sync.Mutex
@@ -73,6 +76,8 @@ type Overlord struct {
 	hookMgr   *hookstate.HookManager
 	configMgr *configstate.ConfigManager
 	deviceMgr *devicestate.DeviceManager
+	svcMgr    *servicestate.ServiceManager
+	shotMgr   *snapshotstate.SnapshotManager
 }
 
 var storeNew = store.New
@@ -84,7 +89,7 @@ func New() (*Overlord, error) {
 	}
 
 	backend := &overlordStateBackend{
-		path:           dirs.SnapStateFile,
+		journal:        state.NewJournal(dirs.SnapStateFile),
 		ensureBefore:   o.ensureBefore,
 		requestRestart: o.requestRestart,
 	}
@@ -94,6 +99,7 @@ func New() (*Overlord, error) {
 	}
 
 	o.stateEng = NewStateEngine(s)
+	o.stateBackend = backend
 
 	hookMgr, err := hookstate.Manager(s)
 	if err != nil {
@@ -136,6 +142,20 @@ func New() (*Overlord, error) {
 	o.deviceMgr = deviceMgr
 	o.stateEng.AddManager(o.deviceMgr)
 
+	svcMgr, err := servicestate.Manager(s)
+	if err != nil {
+		return nil, err
+	}
+	o.svcMgr = svcMgr
+	o.stateEng.AddManager(o.svcMgr)
+
+	shotMgr, err := snapshotstate.Manager(s)
+	if err != nil {
+		return nil, err
+	}
+	o.shotMgr = shotMgr
+	o.stateEng.AddManager(o.shotMgr)
+
 	// setting up the store
 	authContext := auth.NewAuthContext(s, o.deviceMgr)
 	sto := storeNew(nil, authContext)
@@ -146,7 +166,7 @@ func New() (*Overlord, error) {
 	return o, nil
 }
 
-func loadState(backend state.Backend) (*state.State, error) {
+func loadState(backend *overlordStateBackend) (*state.State, error) {
 	if !osutil.FileExists(dirs.SnapStateFile) {
 		// fail fast, mostly interesting for tests, this dir is setup
 		// by the snapd package
@@ -159,13 +179,13 @@ func loadState(backend state.Backend) (*state.State, error) {
 		return s, nil
 	}
 
-	r, err := os.Open(dirs.SnapStateFile)
+	// this replays the journal, if any, on top of the state file
+	data, err := backend.journal.Load()
 	if err != nil {
-		return nil, fmt.Errorf("cannot read the state file: %s", err)
+		return nil, err
 	}
-	defer r.Close()
 
-	s, err := state.ReadState(backend, r)
+	s, err := state.ReadState(backend, bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -250,7 +270,16 @@ func (o *Overlord) Stop() error {
 	o.loopTomb.Kill(nil)
 	err1 := o.loopTomb.Wait()
 	o.stateEng.Stop()
-	return err1
+
+	// leave a state file that is authoritative on its own
+	st := o.State()
+	st.Lock()
+	err2 := o.stateBackend.journal.Compact()
+	st.Unlock()
+	if err1 != nil {
+		return err1
+	}
+	return err2
 }
 
 // Settle runs first a state engine Ensure and then wait for activities to settle.
@@ -330,3 +359,15 @@ func (o *Overlord) HookManager() *hookstate.HookManager {
 func (o *Overlord) DeviceManager() *devicestate.DeviceManager {
 	return o.deviceMgr
 }
+
+// ServiceManager returns the service manager responsible for controlling
+// the services of snaps.
+func (o *Overlord) ServiceManager() *servicestate.ServiceManager {
+	return o.svcMgr
+}
+
+// SnapshotManager returns the snapshot manager responsible for saving
+// and restoring the data of snaps.
+func (o *Overlord) SnapshotManager() *snapshotstate.SnapshotManager {
+	return o.shotMgr
+}
@@ -33,6 +33,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/patch"
 	"github.com/snapcore/snapd/overlord/snapstate"
@@ -70,6 +71,8 @@ func (ovs *overlordSuite) TestNew(c *C) {
 	c.Check(o.AssertManager(), NotNil)
 	c.Check(o.InterfaceManager(), NotNil)
 	c.Check(o.DeviceManager(), NotNil)
+	c.Check(o.ServiceManager(), NotNil)
+	c.Check(o.SnapshotManager(), NotNil)
 
 	s := o.State()
 	c.Check(s, NotNil)
@@ -117,7 +120,7 @@ func (ovs *overlordSuite) TestNewWithInvalidState(c *C) {
 	c.Assert(err, IsNil)
 
 	_, err = overlord.New()
-	c.Assert(err, ErrorMatches, "EOF")
+	c.Assert(err, ErrorMatches, "cannot parse the state file: unexpected end of JSON input")
 }
 
 func (ovs *overlordSuite) TestNewWithPatches(c *C) {
@@ -447,9 +450,113 @@ func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(st.Mode(), Equals, os.FileMode(0600))
 
+	// the change went to the journal
+	journal := dirs.SnapStateFile + ".journal"
+	st, err = os.Stat(journal)
+	c.Assert(err, IsNil)
+	c.Assert(st.Mode(), Equals, os.FileMode(0600))
+
+	content, err := ioutil.ReadFile(journal)
+	c.Assert(err, IsNil)
+	c.Check(string(content), testutil.Contains, `"data/mark":1`)
+
+	// and is there when loading the state again
+	o, err = overlord.New()
+	c.Assert(err, IsNil)
+	s = o.State()
+	s.Lock()
+	defer s.Unlock()
+	var mark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	c.Check(mark, Equals, 1)
+}
+
+// stateFileMark reads the "mark" key from the state file alone, as an
+// older snapd would.
+func stateFileMark(c *C) int {
+	f, err := os.Open(dirs.SnapStateFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	s, err := state.ReadState(nil, f)
+	c.Assert(err, IsNil)
+	s.Lock()
+	defer s.Unlock()
+	var mark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	return mark
+}
+
+func (ovs *overlordSuite) TestStopCompactsJournal(c *C) {
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	for i := 1; i <= 2; i++ {
+		s.Lock()
+		s.Set("mark", i)
+		s.Unlock()
+	}
+	c.Assert(osutil.FileExists(dirs.SnapStateFile+".journal"), Equals, true)
+
+	o.Loop()
+	c.Assert(o.Stop(), IsNil)
+	c.Check(osutil.FileExists(dirs.SnapStateFile+".journal"), Equals, false)
+	c.Check(stateFileMark(c), Equals, 2)
+}
+
+func (ovs *overlordSuite) TestRequestRestartCompactsJournal(c *C) {
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	for i := 1; i <= 2; i++ {
+		s.Lock()
+		s.Set("mark", i)
+		s.Unlock()
+	}
+	c.Assert(osutil.FileExists(dirs.SnapStateFile+".journal"), Equals, true)
+
+	var markAtRestart int
+	o.SetRestartHandler(func(t state.RestartType) {
+		markAtRestart = stateFileMark(c)
+	})
+	s.RequestRestart(state.RestartSystem)
+	c.Check(markAtRestart, Equals, 2)
+	c.Check(osutil.FileExists(dirs.SnapStateFile+".journal"), Equals, false)
+
+	// until the restart the state file stays authoritative
+	s.Lock()
+	s.Set("mark", 3)
+	s.Unlock()
+	c.Check(osutil.FileExists(dirs.SnapStateFile+".journal"), Equals, false)
+	c.Check(stateFileMark(c), Equals, 3)
+}
+
+func (ovs *overlordSuite) TestMigratesStateFile(c *C) {
+	fakeState := []byte(fmt.Sprintf(`{"data":{"patch-level":%d,"some":"data"},"changes":null,"tasks":null,"last-change-id":0,"last-task-id":0,"last-lane-id":0}`, patch.Level))
+	err := ioutil.WriteFile(dirs.SnapStateFile, fakeState, 0600)
+	c.Assert(err, IsNil)
+
+	o, err := overlord.New()
+	c.Assert(err, IsNil)
+	s := o.State()
+	s.Lock()
+	s.Set("some", "other")
+	s.Unlock()
+
+	// the state file is left alone
 	content, err := ioutil.ReadFile(dirs.SnapStateFile)
 	c.Assert(err, IsNil)
-	c.Check(string(content), testutil.Contains, `"mark":1`)
+	c.Check(content, DeepEquals, fakeState)
+
+	o, err = overlord.New()
+	c.Assert(err, IsNil)
+	s = o.State()
+	s.Lock()
+	defer s.Unlock()
+	var some string
+	c.Assert(s.Get("some", &some), IsNil)
+	c.Check(some, Equals, "other")
 }
 
 type runnerManager struct {
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package servicestate implements the manager and state aspects
+// responsible for controlling the services of snaps.
+package servicestate
+
+import (
+	"fmt"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+// ServiceManager is responsible for starting, stopping and restarting
+// the services of snaps on request.
+type ServiceManager struct {
+	state  *state.State
+	runner *state.TaskRunner
+}
+
+// Manager returns a new service manager.
+func Manager(s *state.State) (*ServiceManager, error) {
+	runner := state.NewTaskRunner(s)
+	m := &ServiceManager{
+		state:  s,
+		runner: runner,
+	}
+
+	runner.AddHandler("service-control", m.doServiceControl, nil)
+
+	return m, nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *ServiceManager) Ensure() error {
+	m.runner.Ensure()
+	return nil
+}
+
+// Wait implements StateManager.Wait.
+func (m *ServiceManager) Wait() {
+	m.runner.Wait()
+}
+
+// Stop implements StateManager.Stop.
+func (m *ServiceManager) Stop() {
+	m.runner.Stop()
+}
+
+func (m *ServiceManager) doServiceControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var sa ServiceAction
+	if err := t.Get("service-action", &sa); err != nil {
+		return fmt.Errorf("internal error: cannot get service action: %v", err)
+	}
+
+	info, err := snapstate.CurrentInfo(st, sa.SnapName)
+	if err != nil {
+		return err
+	}
+
+	apps := make([]*snap.AppInfo, 0, len(sa.Services))
+	for _, name := range sa.Services {
+		app, ok := info.Apps[name]
+		if !ok {
+			return fmt.Errorf("snap %q has no service %q", sa.SnapName, name)
+		}
+		if !app.IsService() {
+			return fmt.Errorf("%s.%s is not a service", sa.SnapName, name)
+		}
+		apps = append(apps, app)
+	}
+
+	pb := snapstate.NewTaskProgressAdapter(t)
+	st.Unlock()
+	defer st.Lock()
+
+	switch sa.Action {
+	case "start":
+		return wrappers.StartServices(apps, sa.Enable, pb)
+	case "stop":
+		return wrappers.StopServices(apps, sa.Disable, pb)
+	case "restart":
+		return wrappers.RestartServices(apps, pb)
+	default:
+		return fmt.Errorf("internal error: unknown service action %q", sa.Action)
+	}
+}
@@ -0,0 +1,115 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// Instruction holds the details of a service control request.
+type Instruction struct {
+	Action string   `json:"action"`
+	Names  []string `json:"names"`
+
+	// Enable services when starting them.
+	Enable bool `json:"enable,omitempty"`
+	// Disable services after stopping them.
+	Disable bool `json:"disable,omitempty"`
+}
+
+// ServiceAction is the action to perform on some services of a snap,
+// as carried by a service-control task.
+type ServiceAction struct {
+	SnapName string   `json:"snap-name"`
+	Action   string   `json:"action"`
+	Services []string `json:"services"`
+
+	Enable  bool `json:"enable,omitempty"`
+	Disable bool `json:"disable,omitempty"`
+}
+
+// Control returns a task set with one service-control task per snap
+// for performing the given instruction on the given service apps.
+// The change with ignoreChangeID, if not empty, is not considered a
+// conflict, e.g. the change of a hook asking for the operation.
+func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, ignoreChangeID string) (*state.TaskSet, error) {
+	switch inst.Action {
+	case "start", "stop", "restart":
+		// ok
+	default:
+		return nil, fmt.Errorf("unknown action %q", inst.Action)
+	}
+	if inst.Enable && inst.Action != "start" {
+		return nil, fmt.Errorf("cannot use enable with action %q", inst.Action)
+	}
+	if inst.Disable && inst.Action != "stop" {
+		return nil, fmt.Errorf("cannot use disable with action %q", inst.Action)
+	}
+
+	services := make(map[string]map[string]bool)
+	for _, app := range appInfos {
+		if !app.IsService() {
+			return nil, fmt.Errorf("%s.%s is not a service", app.Snap.Name(), app.Name)
+		}
+		snapName := app.Snap.Name()
+		if services[snapName] == nil {
+			services[snapName] = make(map[string]bool)
+		}
+		services[snapName][app.Name] = true
+	}
+
+	snapNames := make([]string, 0, len(services))
+	for snapName := range services {
+		snapNames = append(snapNames, snapName)
+	}
+	sort.Strings(snapNames)
+
+	ts := state.NewTaskSet()
+	for _, snapName := range snapNames {
+		if err := snapstate.CheckChangeConflictIgnoringChange(st, snapName, nil, ignoreChangeID); err != nil {
+			return nil, err
+		}
+
+		svcs := make([]string, 0, len(services[snapName]))
+		for svc := range services[snapName] {
+			svcs = append(svcs, svc)
+		}
+		sort.Strings(svcs)
+		summary := fmt.Sprintf(i18n.G("Run service command %q for services %s of snap %q"), inst.Action, strutil.Quoted(svcs), snapName)
+		t := st.NewTask("service-control", summary)
+		t.Set("service-action", &ServiceAction{
+			SnapName: snapName,
+			Action:   inst.Action,
+			Services: svcs,
+			Enable:   inst.Enable,
+			Disable:  inst.Disable,
+		})
+		ts.AddTask(t)
+	}
+
+	return ts, nil
+}
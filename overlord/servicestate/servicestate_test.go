@@ -0,0 +1,209 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func TestServiceState(t *testing.T) { TestingT(t) }
+
+type serviceStateSuite struct {
+	state   *state.State
+	manager *servicestate.ServiceManager
+	info    *snap.Info
+
+	sysdLog       [][]string
+	restoreSysctl func()
+}
+
+var _ = Suite(&serviceStateSuite{})
+
+const snapYaml = `name: test-snap
+version: 1.0
+apps:
+  svc1:
+    daemon: simple
+  svc2:
+    daemon: forking
+  app:
+`
+
+func (s *serviceStateSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+	manager, err := servicestate.Manager(s.state)
+	c.Assert(err, IsNil)
+	s.manager = manager
+
+	s.sysdLog = nil
+	oldSystemctlCmd := systemd.SystemctlCmd
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+	s.restoreSysctl = func() { systemd.SystemctlCmd = oldSystemctlCmd }
+
+	sideInfo := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(1)}
+	s.info = snaptest.MockSnap(c, snapYaml, "", sideInfo)
+
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{sideInfo},
+		Current:  snap.R(1),
+	})
+	s.state.Unlock()
+}
+
+func (s *serviceStateSuite) TearDownTest(c *C) {
+	s.manager.Stop()
+	s.restoreSysctl()
+	dirs.SetRootDir("")
+}
+
+func (s *serviceStateSuite) settle() {
+	for i := 0; i < 5; i++ {
+		s.manager.Ensure()
+		s.manager.Wait()
+	}
+}
+
+func (s *serviceStateSuite) TestControlValidates(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	svc1 := s.info.Apps["svc1"]
+	for _, t := range []struct {
+		inst *servicestate.Instruction
+		apps []*snap.AppInfo
+		err  string
+	}{
+		{&servicestate.Instruction{Action: "frobnicate"}, []*snap.AppInfo{svc1}, `unknown action "frobnicate"`},
+		{&servicestate.Instruction{Action: "stop", Enable: true}, []*snap.AppInfo{svc1}, `cannot use enable with action "stop"`},
+		{&servicestate.Instruction{Action: "start", Disable: true}, []*snap.AppInfo{svc1}, `cannot use disable with action "start"`},
+		{&servicestate.Instruction{Action: "start"}, []*snap.AppInfo{s.info.Apps["app"]}, `test-snap.app is not a service`},
+	} {
+		_, err := servicestate.Control(s.state, t.apps, t.inst, "")
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *serviceStateSuite) TestControlTasks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	apps := []*snap.AppInfo{s.info.Apps["svc2"], s.info.Apps["svc1"], s.info.Apps["svc2"]}
+	ts, err := servicestate.Control(s.state, apps, &servicestate.Instruction{Action: "start", Enable: true}, "")
+	c.Assert(err, IsNil)
+	c.Assert(ts.Tasks(), HasLen, 1)
+
+	t := ts.Tasks()[0]
+	c.Check(t.Kind(), Equals, "service-control")
+	c.Check(t.Summary(), Equals, `Run service command "start" for services "svc1", "svc2" of snap "test-snap"`)
+	var sa servicestate.ServiceAction
+	c.Assert(t.Get("service-action", &sa), IsNil)
+	c.Check(sa, DeepEquals, servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "start",
+		Services: []string{"svc1", "svc2"},
+		Enable:   true,
+	})
+}
+
+func (s *serviceStateSuite) runControl(c *C, inst *servicestate.Instruction, apps ...string) *state.Change {
+	s.state.Lock()
+	appInfos := make([]*snap.AppInfo, len(apps))
+	for i, app := range apps {
+		appInfos[i] = s.info.Apps[app]
+	}
+	ts, err := servicestate.Control(s.state, appInfos, inst, "")
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("service-control", "...")
+	chg.AddAll(ts)
+	s.state.Unlock()
+
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	return chg
+}
+
+func (s *serviceStateSuite) TestDoServiceControlStart(c *C) {
+	s.runControl(c, &servicestate.Instruction{Action: "start", Enable: true}, "svc1")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "snap.test-snap.svc1.service"},
+		{"start", "snap.test-snap.svc1.service"},
+	})
+}
+
+func (s *serviceStateSuite) TestDoServiceControlStop(c *C) {
+	s.runControl(c, &servicestate.Instruction{Action: "stop", Disable: true}, "svc1", "svc2")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"stop", "snap.test-snap.svc1.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc1.service"},
+		{"--root", dirs.GlobalRootDir, "disable", "snap.test-snap.svc1.service"},
+		{"stop", "snap.test-snap.svc2.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc2.service"},
+		{"--root", dirs.GlobalRootDir, "disable", "snap.test-snap.svc2.service"},
+	})
+}
+
+func (s *serviceStateSuite) TestDoServiceControlRestart(c *C) {
+	s.runControl(c, &servicestate.Instruction{Action: "restart"}, "svc2")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"stop", "snap.test-snap.svc2.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc2.service"},
+		{"start", "snap.test-snap.svc2.service"},
+	})
+}
+
+func (s *serviceStateSuite) TestDoServiceControlMissingService(c *C) {
+	s.state.Lock()
+	t := s.state.NewTask("service-control", "...")
+	t.Set("service-action", &servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "start",
+		Services: []string{"not-there"},
+	})
+	chg := s.state.NewChange("service-control", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*snap "test-snap" has no service "not-there".*`)
+	c.Check(s.sysdLog, HasLen, 0)
+}
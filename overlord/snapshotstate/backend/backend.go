@@ -0,0 +1,338 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package backend implements the low level handling of snapshots: the
+// archives of a snap's system and user data, and its configuration.
+//
+// A snapshot is a zip file holding a gzipped tarball of the snap's
+// system data (archive.tgz), one per user of the user data
+// (user/<username>.tgz), and metadata (meta.json) including the
+// sha3-384 sums of all of them; meta.sha3_384 holds the sum of the
+// metadata itself.
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+const (
+	archiveName  = "archive.tgz"
+	metadataName = "meta.json"
+	metaHashName = "meta.sha3_384"
+
+	userArchivePrefix = "user/"
+	userArchiveSuffix = ".tgz"
+)
+
+var (
+	userLookup   = user.Lookup
+	userLookupId = user.LookupId
+)
+
+// Flags encompasses extra flags for snapshots backend Save.
+type Flags struct {
+	// Auto is set for snapshots taken automatically, e.g. on removal
+	Auto bool
+}
+
+// Filename of the given client.Snapshot in this backend.
+func Filename(snapshot *client.Snapshot) string {
+	return filepath.Join(dirs.SnapshotsDir, fmt.Sprintf("%d_%s_%s_%s.zip", snapshot.SetID, snapshot.Snap, snapshot.Version, snapshot.Revision))
+}
+
+// Iter loops over all snapshots in the snapshots directory, calling the
+// given function with a reader for each one. Snapshots that cannot be
+// opened are skipped.
+func Iter(f func(*Reader) error) error {
+	filenames, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*.zip"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		reader, err := Open(filename)
+		if err != nil {
+			logger.Noticef("cannot open snapshot %q: %v", filename, err)
+			continue
+		}
+		err = f(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the snapshots in the snapshots directory that belong to the given
+// set (if non-zero) and are of one of the given snaps (if non-empty),
+// grouped by set.
+func List(setID uint64, snapNames []string) ([]client.SnapshotSet, error) {
+	setshots := make(map[uint64][]*client.Snapshot)
+	err := Iter(func(reader *Reader) error {
+		if setID != 0 && reader.SetID != setID {
+			return nil
+		}
+		if len(snapNames) > 0 && !contains(snapNames, reader.Snap) {
+			return nil
+		}
+		snapshot := reader.Snapshot
+		setshots[reader.SetID] = append(setshots[reader.SetID], &snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]client.SnapshotSet, 0, len(setshots))
+	for id, shots := range setshots {
+		sort.Sort(bySnap(shots))
+		sets = append(sets, client.SnapshotSet{ID: id, Snapshots: shots})
+	}
+	sort.Sort(byID(sets))
+
+	return sets, nil
+}
+
+// Save a snapshot of the given snap's data and configuration, for the
+// given users (or for all the users with data if none are given).
+func Save(id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *Flags) (*client.Snapshot, error) {
+	if flags == nil {
+		flags = &Flags{}
+	}
+	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
+		return nil, err
+	}
+
+	snapshot := &client.Snapshot{
+		SetID:    id,
+		Snap:     si.Name(),
+		SnapID:   si.SnapID,
+		Revision: si.Revision,
+		Version:  si.Version,
+		Summary:  si.Summary(),
+		Time:     time.Now(),
+		SHA3_384: make(map[string]string),
+		Conf:     cfg,
+		Auto:     flags.Auto,
+	}
+
+	users, err := usersForUsernames(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := Filename(snapshot)
+	tmp, err := ioutil.TempFile(dirs.SnapshotsDir, ".snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	w := zip.NewWriter(tmp)
+	if err := addDirsToZip(snapshot, w, archiveName, si.DataDir(), si.CommonDataDir()); err != nil {
+		return nil, err
+	}
+	for _, usr := range users {
+		entry := userArchivePrefix + usr.Username + userArchiveSuffix
+		if err := addDirsToZip(snapshot, w, entry, si.UserDataDir(usr.HomeDir), si.UserCommonDataDir(usr.HomeDir)); err != nil {
+			return nil, err
+		}
+	}
+
+	metaWriter, err := w.Create(metadataName)
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha3.New384()
+	if err := json.NewEncoder(io.MultiWriter(metaWriter, hasher)).Encode(snapshot); err != nil {
+		return nil, err
+	}
+	hashWriter, err := w.Create(metaHashName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// addDirsToZip adds a gzipped tarball of the given directories, which
+// must have a common parent, as the given entry of the zip file. Nothing
+// is added if none of the directories exist.
+func addDirsToZip(snapshot *client.Snapshot, w *zip.Writer, entry string, dirs ...string) error {
+	parent := filepath.Dir(dirs[0])
+	var names []string
+	for _, dir := range dirs {
+		if osutil.IsDirectory(dir) {
+			names = append(names, filepath.Base(dir))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	archiveWriter, err := w.CreateHeader(&zip.FileHeader{
+		Name: entry,
+		// the tarball is compressed already
+		Method: zip.Store,
+	})
+	if err != nil {
+		return err
+	}
+
+	hasher := sha3.New384()
+	var sz sizer
+	var stderr bytes.Buffer
+
+	args := append([]string{"--create", "--sparse", "--gzip", "--directory", parent}, names...)
+	cmd := exec.Command("tar", args...)
+	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cannot create archive of %s: %v", strings.Join(dirs, ", "), osutil.OutputErr(stderr.Bytes(), err))
+	}
+
+	snapshot.SHA3_384[entry] = hex.EncodeToString(hasher.Sum(nil))
+	snapshot.Size += sz.size
+	return nil
+}
+
+type sizer struct {
+	size int64
+}
+
+func (sz *sizer) Write(data []byte) (int, error) {
+	sz.size += int64(len(data))
+	return len(data), nil
+}
+
+// usersForUsernames returns the users with the given usernames, or all
+// the users with a home directory if none are given.
+func usersForUsernames(usernames []string) ([]*user.User, error) {
+	if len(usernames) > 0 {
+		users := make([]*user.User, 0, len(usernames))
+		for _, username := range usernames {
+			usr, err := userLookup(username)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, usr)
+		}
+		return users, nil
+	}
+
+	homes, err := filepath.Glob(filepath.Join(dirs.SnapDataHomeGlob, ".."))
+	if err != nil {
+		return nil, err
+	}
+	homes = append(homes, filepath.Join(dirs.GlobalRootDir, "root"))
+
+	var users []*user.User
+	for _, home := range homes {
+		st, err := os.Stat(home)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sys, ok := st.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil, fmt.Errorf("cannot determine owner of %q", home)
+		}
+		usr, err := userLookupId(strconv.FormatUint(uint64(sys.Uid), 10))
+		if err != nil {
+			// not a user we know about
+			logger.Debugf("cannot look up owner of %q: %v", home, err)
+			continue
+		}
+		// the home in the passwd entry could be elsewhere; what
+		// matters is where the data is
+		users = append(users, &user.User{
+			Uid:      usr.Uid,
+			Gid:      usr.Gid,
+			Username: usr.Username,
+			Name:     usr.Name,
+			HomeDir:  home,
+		})
+	}
+
+	return users, nil
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+type bySnap []*client.Snapshot
+
+func (a bySnap) Len() int           { return len(a) }
+func (a bySnap) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a bySnap) Less(i, j int) bool { return a[i].Snap < a[j].Snap }
+
+type byID []client.SnapshotSet
+
+func (a byID) Len() int           { return len(a) }
+func (a byID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byID) Less(i, j int) bool { return a[i].ID < a[j].ID }
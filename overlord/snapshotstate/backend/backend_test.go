@@ -0,0 +1,348 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type snapshotSuite struct {
+	root    string
+	home    string
+	restore []func()
+}
+
+var _ = Suite(&snapshotSuite{})
+
+func (s *snapshotSuite) SetUpTest(c *C) {
+	s.root = c.MkDir()
+	dirs.SetRootDir(s.root)
+	s.home = filepath.Join(s.root, "home", "snapuser")
+	c.Assert(os.MkdirAll(s.home, 0755), IsNil)
+
+	snapUser := &user.User{
+		Uid:      strconv.Itoa(os.Getuid()),
+		Gid:      strconv.Itoa(os.Getgid()),
+		Username: "snapuser",
+		HomeDir:  s.home,
+	}
+	s.restore = []func(){
+		backend.MockUserLookup(func(username string) (*user.User, error) {
+			if username != "snapuser" {
+				return nil, user.UnknownUserError(username)
+			}
+			return snapUser, nil
+		}),
+		backend.MockUserLookupId(func(uid string) (*user.User, error) {
+			if uid != snapUser.Uid {
+				return nil, user.UnknownUserIdError(os.Getuid())
+			}
+			return snapUser, nil
+		}),
+	}
+}
+
+func (s *snapshotSuite) TearDownTest(c *C) {
+	for _, restore := range s.restore {
+		restore()
+	}
+	dirs.SetRootDir("/")
+}
+
+func (s *snapshotSuite) mkInfo(rev int) *snap.Info {
+	return &snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "hello-snap",
+			Revision: snap.R(rev),
+			SnapID:   "hello-id",
+		},
+		Version: "v1.33",
+	}
+}
+
+func writeFile(c *C, path, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+}
+
+func readFile(c *C, path string) string {
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	return string(content)
+}
+
+func (s *snapshotSuite) mkData(c *C, info *snap.Info, tag string) {
+	writeFile(c, filepath.Join(info.DataDir(), "data"), tag+" system data")
+	writeFile(c, filepath.Join(info.CommonDataDir(), "common"), tag+" system common")
+	writeFile(c, filepath.Join(info.UserDataDir(s.home), "data"), tag+" user data")
+	writeFile(c, filepath.Join(info.UserCommonDataDir(s.home), "common"), tag+" user common")
+}
+
+func (s *snapshotSuite) TestSaveListOpenCheck(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+
+	cfg := map[string]interface{}{"some-setting": false}
+	shot, err := backend.Save(42, info, cfg, nil, &backend.Flags{Auto: true})
+	c.Assert(err, IsNil)
+	c.Check(shot.SetID, Equals, uint64(42))
+	c.Check(shot.Snap, Equals, "hello-snap")
+	c.Check(shot.SnapID, Equals, "hello-id")
+	c.Check(shot.Revision, Equals, snap.R(17))
+	c.Check(shot.Version, Equals, "v1.33")
+	c.Check(shot.Conf, DeepEquals, cfg)
+	c.Check(shot.Auto, Equals, true)
+	c.Check(shot.SHA3_384, HasLen, 2)
+	c.Check(shot.SHA3_384["archive.tgz"], HasLen, 96)
+	c.Check(shot.SHA3_384["user/snapuser.tgz"], HasLen, 96)
+	c.Check(shot.Size > 0, Equals, true)
+
+	filename := backend.Filename(shot)
+	c.Check(filename, Equals, filepath.Join(dirs.SnapshotsDir, "42_hello-snap_v1.33_17.zip"))
+	// no temporary files left behind
+	files, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*"))
+	c.Assert(err, IsNil)
+	c.Check(files, DeepEquals, []string{filename})
+
+	sets, err := backend.List(0, nil)
+	c.Assert(err, IsNil)
+	c.Assert(sets, HasLen, 1)
+	c.Check(sets[0].ID, Equals, uint64(42))
+	c.Assert(sets[0].Snapshots, HasLen, 1)
+	c.Check(sets[0].Snapshots[0].Time.Equal(shot.Time), Equals, true)
+	sets[0].Snapshots[0].Time = shot.Time
+	c.Check(sets[0].Snapshots[0], DeepEquals, shot)
+
+	sets, err = backend.List(41, nil)
+	c.Assert(err, IsNil)
+	c.Check(sets, HasLen, 0)
+	sets, err = backend.List(0, []string{"other-snap"})
+	c.Assert(err, IsNil)
+	c.Check(sets, HasLen, 0)
+
+	reader, err := backend.Open(filename)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	c.Check(reader.Check(nil), IsNil)
+	c.Check(reader.Check([]string{"snapuser"}), IsNil)
+}
+
+func (s *snapshotSuite) TestSaveSpecificUsers(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+
+	shot, err := backend.Save(1, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(shot.SHA3_384, HasLen, 2)
+
+	_, err = backend.Save(2, info, nil, []string{"nobody-we-know"}, nil)
+	c.Check(err, ErrorMatches, `user: unknown user nobody-we-know`)
+}
+
+func (s *snapshotSuite) TestSaveNoData(c *C) {
+	shot, err := backend.Save(1, s.mkInfo(17), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(shot.SHA3_384, HasLen, 0)
+
+	// such a snapshot is not valid, so it is not listed
+	sets, err := backend.List(0, nil)
+	c.Assert(err, IsNil)
+	c.Check(sets, HasLen, 0)
+}
+
+func corruptEntry(c *C, filename, entry string) {
+	// rewrite the zip with a different entry content
+	r, err := zip.OpenReader(filename)
+	c.Assert(err, IsNil)
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	c.Assert(err, IsNil)
+	w := zip.NewWriter(f)
+	for _, zf := range r.File {
+		fw, err := w.Create(zf.Name)
+		c.Assert(err, IsNil)
+		if zf.Name == entry {
+			fmt.Fprint(fw, "not what you'd expect")
+			continue
+		}
+		rc, err := zf.Open()
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(rc)
+		c.Assert(err, IsNil)
+		rc.Close()
+		fw.Write(data)
+	}
+	c.Assert(w.Close(), IsNil)
+	c.Assert(f.Close(), IsNil)
+	r.Close()
+	c.Assert(os.Rename(tmp, filename), IsNil)
+}
+
+func (s *snapshotSuite) TestCheckCorrupted(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+	shot, err := backend.Save(42, info, nil, nil, nil)
+	c.Assert(err, IsNil)
+	filename := backend.Filename(shot)
+
+	corruptEntry(c, filename, "user/snapuser.tgz")
+
+	reader, err := backend.Open(filename)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	c.Check(reader.Check(nil), ErrorMatches, `snapshot entry "user/snapuser.tgz" expected hash \(.*\) does not match actual \(.*\)`)
+	c.Check(reader.Check([]string{"someone-else"}), IsNil)
+}
+
+func (s *snapshotSuite) TestOpenCorruptedMetadata(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+	shot, err := backend.Save(42, info, nil, nil, nil)
+	c.Assert(err, IsNil)
+	filename := backend.Filename(shot)
+
+	corruptEntry(c, filename, "meta.json")
+
+	_, err = backend.Open(filename)
+	c.Check(err, ErrorMatches, `snapshot metadata hash \(.*\) does not match expected \(.*\)`)
+
+	sets, err := backend.List(0, nil)
+	c.Assert(err, IsNil)
+	c.Check(sets, HasLen, 0)
+}
+
+func (s *snapshotSuite) TestRestoreRevertCleanup(c *C) {
+	oldInfo := s.mkInfo(17)
+	s.mkData(c, oldInfo, "old")
+	shot, err := backend.Save(42, oldInfo, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	// the snap got refreshed and its data changed
+	c.Assert(os.RemoveAll(filepath.Join(dirs.SnapDataDir, "hello-snap")), IsNil)
+	c.Assert(os.RemoveAll(filepath.Join(s.home, "snap")), IsNil)
+	newInfo := s.mkInfo(18)
+	s.mkData(c, newInfo, "new")
+
+	reader, err := backend.Open(backend.Filename(shot))
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	rs, err := reader.Restore(snap.R(18), nil, logf)
+	c.Assert(err, IsNil)
+	c.Check(logs, HasLen, 0)
+
+	// the old data is now the current one
+	c.Check(readFile(c, filepath.Join(newInfo.DataDir(), "data")), Equals, "old system data")
+	c.Check(readFile(c, filepath.Join(newInfo.CommonDataDir(), "common")), Equals, "old system common")
+	c.Check(readFile(c, filepath.Join(newInfo.UserDataDir(s.home), "data")), Equals, "old user data")
+	c.Check(readFile(c, filepath.Join(newInfo.UserCommonDataDir(s.home), "common")), Equals, "old user common")
+	c.Check(oldInfo.DataDir(), Not(Equals), newInfo.DataDir())
+	_, err = os.Stat(oldInfo.DataDir())
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// reverting brings back the new data
+	c.Assert(rs.Revert(), IsNil)
+	c.Check(readFile(c, filepath.Join(newInfo.DataDir(), "data")), Equals, "new system data")
+	c.Check(readFile(c, filepath.Join(newInfo.CommonDataDir(), "common")), Equals, "new system common")
+	c.Check(readFile(c, filepath.Join(newInfo.UserDataDir(s.home), "data")), Equals, "new user data")
+	c.Check(readFile(c, filepath.Join(newInfo.UserCommonDataDir(s.home), "common")), Equals, "new user common")
+
+	// restore again, and clean up this time
+	rs, err = reader.Restore(snap.R(18), []string{"snapuser"}, logf)
+	c.Assert(err, IsNil)
+	c.Assert(rs.Cleanup(), IsNil)
+	c.Check(readFile(c, filepath.Join(newInfo.DataDir(), "data")), Equals, "old system data")
+	c.Check(readFile(c, filepath.Join(newInfo.UserDataDir(s.home), "data")), Equals, "old user data")
+
+	// nothing is left behind
+	for _, parent := range []string{filepath.Join(dirs.SnapDataDir, "hello-snap"), filepath.Join(s.home, "snap", "hello-snap")} {
+		leftovers, err := filepath.Glob(filepath.Join(parent, ".snapshot*"))
+		c.Assert(err, IsNil)
+		c.Check(leftovers, HasLen, 0)
+	}
+}
+
+func (s *snapshotSuite) TestRestoreSkipsUnknownUsers(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+	shot, err := backend.Save(42, info, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	restore := backend.MockUserLookup(func(username string) (*user.User, error) {
+		return nil, user.UnknownUserError(username)
+	})
+	defer restore()
+
+	reader, err := backend.Open(backend.Filename(shot))
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	var logs []string
+	rs, err := reader.Restore(snap.R(17), nil, func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	c.Assert(err, IsNil)
+	c.Check(logs, DeepEquals, []string{`Skipping restore of user "snapuser": user: unknown user snapuser.`})
+	c.Check(rs.Moved, DeepEquals, []string{
+		filepath.Join(dirs.SnapDataDir, "hello-snap", "17"),
+		filepath.Join(dirs.SnapDataDir, "hello-snap", "common"),
+	})
+	c.Check(rs.Cleanup(), IsNil)
+}
+
+func (s *snapshotSuite) TestRestoreCorruptedRevertsEverything(c *C) {
+	info := s.mkInfo(17)
+	s.mkData(c, info, "old")
+	shot, err := backend.Save(42, info, nil, nil, nil)
+	c.Assert(err, IsNil)
+	filename := backend.Filename(shot)
+	corruptEntry(c, filename, "user/snapuser.tgz")
+
+	writeFile(c, filepath.Join(info.DataDir(), "data"), "new system data")
+
+	reader, err := backend.Open(filename)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	_, err = reader.Restore(snap.R(17), nil, func(string, ...interface{}) {})
+	c.Assert(err, ErrorMatches, `(?s)cannot unpack snapshot entry "user/snapuser.tgz": .*not in gzip format.*`)
+
+	// the system data restore got reverted
+	c.Check(readFile(c, filepath.Join(info.DataDir(), "data")), Equals, "new system data")
+}
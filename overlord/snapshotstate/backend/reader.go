@@ -0,0 +1,360 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// A Reader is a snapshot that's been opened for reading.
+type Reader struct {
+	*os.File
+	client.Snapshot
+
+	zip *zip.Reader
+}
+
+// Open a Snapshot given its full filename.
+func Open(filename string) (reader *Reader, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, st.Size())
+	if err != nil {
+		return nil, err
+	}
+	reader = &Reader{File: f, zip: zr}
+
+	metaData, err := reader.readEntry(metadataName)
+	if err != nil {
+		return nil, err
+	}
+	metaHash, err := reader.readEntry(metaHashName)
+	if err != nil {
+		return nil, err
+	}
+	actual := sha3.Sum384(metaData)
+	if expected := strings.TrimSpace(string(metaHash)); hex.EncodeToString(actual[:]) != expected {
+		return nil, fmt.Errorf("snapshot metadata hash (%.7s…) does not match expected (%.7s…)", hex.EncodeToString(actual[:]), expected)
+	}
+	if err := json.Unmarshal(metaData, &reader.Snapshot); err != nil {
+		return nil, fmt.Errorf("cannot read snapshot metadata: %v", err)
+	}
+	if !reader.Snapshot.IsValid() {
+		return nil, fmt.Errorf("invalid snapshot")
+	}
+
+	return reader, nil
+}
+
+func (r *Reader) entry(name string) *zip.File {
+	for _, f := range r.zip.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (r *Reader) readEntry(name string) ([]byte, error) {
+	f := r.entry(name)
+	if f == nil {
+		return nil, fmt.Errorf("snapshot has no %q entry", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// entries returns the archive entries of the snapshot, limited to the
+// system archive and to the ones of the given users if any are given.
+func (r *Reader) entries(usernames []string) []string {
+	entries := make([]string, 0, len(r.SHA3_384))
+	for entry := range r.SHA3_384 {
+		if len(usernames) > 0 && entry != archiveName && !contains(usernames, entryUsername(entry)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func entryUsername(entry string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(entry, userArchivePrefix), userArchiveSuffix)
+}
+
+// openEntry returns a reader for the given archive entry that checks,
+// once it has been read to the end, that the content matches its hash.
+func (r *Reader) openEntry(entry string) (*hashReader, error) {
+	f := r.entry(entry)
+	if f == nil {
+		return nil, fmt.Errorf("snapshot has no %q entry", entry)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha3.New384()
+	return &hashReader{
+		Reader:   io.TeeReader(rc, hasher),
+		closer:   rc,
+		entry:    entry,
+		expected: r.SHA3_384[entry],
+		sum:      func() string { return hex.EncodeToString(hasher.Sum(nil)) },
+	}, nil
+}
+
+type hashReader struct {
+	io.Reader
+	closer   io.Closer
+	entry    string
+	expected string
+	sum      func() string
+}
+
+func (hr *hashReader) Close() error {
+	return hr.closer.Close()
+}
+
+func (hr *hashReader) check() error {
+	if actual := hr.sum(); actual != hr.expected {
+		return fmt.Errorf("snapshot entry %q expected hash (%.7s…) does not match actual (%.7s…)", hr.entry, hr.expected, actual)
+	}
+	return nil
+}
+
+// Check that the data contained in the snapshot matches its hashsums,
+// for the system archive and the given users (or all of them if none
+// are given).
+func (r *Reader) Check(usernames []string) error {
+	for _, entry := range r.entries(usernames) {
+		hr, err := r.openEntry(entry)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ioutil.Discard, hr)
+		hr.Close()
+		if err != nil {
+			return fmt.Errorf("cannot read snapshot entry %q: %v", entry, err)
+		}
+		if err := hr.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreState stores information that can be used to cleanly revert (or
+// finish cleaning up) a snapshot Restore.
+type RestoreState struct {
+	// Created are the temporary directories holding the extracted
+	// archives and the data that got replaced
+	Created []string `json:"created,omitempty"`
+	// Moved are the directories that got replaced by restored data
+	Moved []string `json:"moved,omitempty"`
+}
+
+// Cleanup removes the data that was replaced by the restore.
+func (rs *RestoreState) Cleanup() error {
+	for _, dir := range rs.Created {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	rs.Created = nil
+	rs.Moved = nil
+	return nil
+}
+
+// Revert puts back the data that was replaced by the restore, and
+// cleans up.
+func (rs *RestoreState) Revert() error {
+	for i := len(rs.Moved) - 1; i >= 0; i-- {
+		target := rs.Moved[i]
+		tempdir := restoreTempdir(rs.Created, target)
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		old := filepath.Join(tempdir, "old", filepath.Base(target))
+		if osutil.FileExists(old) {
+			if err := os.Rename(old, target); err != nil {
+				return err
+			}
+		}
+	}
+	return rs.Cleanup()
+}
+
+func restoreTempdir(created []string, target string) string {
+	for _, dir := range created {
+		if filepath.Dir(dir) == filepath.Dir(target) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Restore the data of the snapshot onto the given (current) revision of
+// the snap, for the system archive and the given users (or all of them
+// if none are given). Users that are not known to the system are skipped,
+// and logged via logf.
+//
+// On success, the returned RestoreState needs to be Cleanup()'d once the
+// restore is final, or Revert()'d to undo it.
+func (r *Reader) Restore(current snap.Revision, usernames []string, logf func(format string, args ...interface{})) (rs *RestoreState, err error) {
+	rs = &RestoreState{}
+	defer func() {
+		if err != nil {
+			rs.Revert()
+		}
+	}()
+
+	for _, entry := range r.entries(usernames) {
+		var parent string
+		uid, gid := -1, -1
+		if entry == archiveName {
+			parent = filepath.Join(dirs.SnapDataDir, r.Snap)
+		} else {
+			username := entryUsername(entry)
+			usr, err := userLookup(username)
+			if err != nil {
+				logf("Skipping restore of user %q: %v.", username, err)
+				continue
+			}
+			parent = filepath.Join(usr.HomeDir, "snap", r.Snap)
+			if uid, err = strconv.Atoi(usr.Uid); err != nil {
+				return rs, err
+			}
+			if gid, err = strconv.Atoi(usr.Gid); err != nil {
+				return rs, err
+			}
+		}
+
+		if uid == -1 {
+			err = os.MkdirAll(parent, 0755)
+		} else {
+			err = osutil.MkdirAllChown(parent, 0755, uid, gid)
+		}
+		if err != nil {
+			return rs, err
+		}
+
+		if err := r.restoreEntry(rs, entry, parent, current); err != nil {
+			return rs, err
+		}
+	}
+
+	return rs, nil
+}
+
+func (r *Reader) restoreEntry(rs *RestoreState, entry, parent string, current snap.Revision) error {
+	tempdir, err := ioutil.TempDir(parent, ".snapshot")
+	if err != nil {
+		return err
+	}
+	rs.Created = append(rs.Created, tempdir)
+
+	newDir := filepath.Join(tempdir, "new")
+	oldDir := filepath.Join(tempdir, "old")
+	for _, dir := range []string{newDir, oldDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	hr, err := r.openEntry(entry)
+	if err != nil {
+		return err
+	}
+	defer hr.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("tar", "--extract", "--preserve-permissions", "--preserve-order", "--gunzip", "--directory", newDir)
+	cmd.Stdin = hr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cannot unpack snapshot entry %q: %v", entry, osutil.OutputErr(stderr.Bytes(), err))
+	}
+	// make sure all of it was read for the hash to be complete
+	if _, err := io.Copy(ioutil.Discard, hr); err != nil {
+		return err
+	}
+	if err := hr.check(); err != nil {
+		return err
+	}
+
+	names, err := ioutil.ReadDir(newDir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range names {
+		name := fi.Name()
+		// the data of the snapshot's revision goes to the current one
+		if name == r.Revision.String() {
+			name = current.String()
+		}
+		target := filepath.Join(parent, name)
+		if osutil.FileExists(target) {
+			if err := os.Rename(target, filepath.Join(oldDir, name)); err != nil {
+				return err
+			}
+		}
+		rs.Moved = append(rs.Moved, target)
+		if err := os.Rename(filepath.Join(newDir, fi.Name()), target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// SnapshotManager is responsible for saving, checking, restoring and
+// forgetting snapshots of the data of snaps.
+type SnapshotManager struct {
+	state  *state.State
+	runner *state.TaskRunner
+}
+
+// Manager returns a new snapshot manager.
+func Manager(st *state.State) (*SnapshotManager, error) {
+	runner := state.NewTaskRunner(st)
+	m := &SnapshotManager{
+		state:  st,
+		runner: runner,
+	}
+
+	runner.AddHandler("save-snapshot", m.doSave, m.undoSave)
+	runner.AddHandler("forget-snapshot", m.doForget, nil)
+	runner.AddHandler("check-snapshot", m.doCheck, nil)
+	runner.AddHandler("restore-snapshot", m.doRestore, m.undoRestore)
+	runner.AddCleanup("restore-snapshot", m.cleanupRestore)
+
+	return m, nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *SnapshotManager) Ensure() error {
+	m.runner.Ensure()
+	return nil
+}
+
+// Wait implements StateManager.Wait.
+func (m *SnapshotManager) Wait() {
+	m.runner.Wait()
+}
+
+// Stop implements StateManager.Stop.
+func (m *SnapshotManager) Stop() {
+	m.runner.Stop()
+}
+
+// snapshotSetup is what is carried by the tasks of the snapshot manager.
+type snapshotSetup struct {
+	SetID    uint64   `json:"set-id"`
+	Snap     string   `json:"snap"`
+	Users    []string `json:"users,omitempty"`
+	Filename string   `json:"filename,omitempty"`
+	Auto     bool     `json:"auto,omitempty"`
+}
+
+func taskSnapshotSetup(task *state.Task) (*snapshotSetup, error) {
+	var snapshot snapshotSetup
+	if err := task.Get("snapshot-setup", &snapshot); err != nil {
+		return nil, fmt.Errorf("internal error: cannot get snapshot setup: %v", err)
+	}
+	return &snapshot, nil
+}
+
+func (m *SnapshotManager) doSave(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	snapshot, err := taskSnapshotSetup(task)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	info, err := snapstate.CurrentInfo(st, snapshot.Snap)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	cfg, err := config.GetSnapConfig(st, snapshot.Snap)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	shot, err := backendSave(snapshot.SetID, info, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto})
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	snapshot.Filename = backend.Filename(shot)
+	task.Set("snapshot-setup", snapshot)
+	return nil
+}
+
+func (m *SnapshotManager) undoSave(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	snapshot, err := taskSnapshotSetup(task)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+	if snapshot.Filename == "" {
+		return nil
+	}
+	if err := os.Remove(snapshot.Filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (m *SnapshotManager) doForget(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	snapshot, err := taskSnapshotSetup(task)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(snapshot.Filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// the file is gone so newSnapshotSetID can no longer see the
+	// set, make sure its ID does not get reused
+	st.Lock()
+	defer st.Unlock()
+	var lastID uint64
+	if err := st.Get("last-snapshot-set-id", &lastID); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if snapshot.SetID > lastID {
+		st.Set("last-snapshot-set-id", snapshot.SetID)
+	}
+	return nil
+}
+
+func (m *SnapshotManager) doCheck(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	snapshot, err := taskSnapshotSetup(task)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	reader, err := backendOpen(snapshot.Filename)
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	defer reader.Close()
+
+	return reader.Check(snapshot.Users)
+}
+
+func (m *SnapshotManager) doRestore(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	snapshot, err := taskSnapshotSetup(task)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	info, err := snapstate.CurrentInfo(st, snapshot.Snap)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	oldConfig, err := config.GetSnapConfig(st, snapshot.Snap)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	reader, err := backendOpen(snapshot.Filename)
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	defer reader.Close()
+
+	logf := func(format string, args ...interface{}) {
+		st.Lock()
+		defer st.Unlock()
+		task.Logf(format, args...)
+	}
+	rs, err := reader.Restore(info.Revision, snapshot.Users, logf)
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	if err := config.SetSnapConfig(st, snapshot.Snap, reader.Conf); err != nil {
+		st.Unlock()
+		rs.Revert()
+		st.Lock()
+		return err
+	}
+	task.Set("restore-state", rs)
+	task.Set("old-config", oldConfig)
+	return nil
+}
+
+func (m *SnapshotManager) undoRestore(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	snapshot, err := taskSnapshotSetup(task)
+	if err != nil {
+		return err
+	}
+	var rs backend.RestoreState
+	if err := task.Get("restore-state", &rs); err != nil {
+		return fmt.Errorf("internal error: cannot get restore state: %v", err)
+	}
+	var oldConfig map[string]interface{}
+	if err := task.Get("old-config", &oldConfig); err != nil && err != state.ErrNoState {
+		return fmt.Errorf("internal error: cannot get old configuration: %v", err)
+	}
+
+	if err := config.SetSnapConfig(st, snapshot.Snap, oldConfig); err != nil {
+		return err
+	}
+
+	st.Unlock()
+	err = rs.Revert()
+	st.Lock()
+	if err != nil {
+		return err
+	}
+	task.Set("restore-state", &rs)
+	return nil
+}
+
+func (m *SnapshotManager) cleanupRestore(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var rs backend.RestoreState
+	err := task.Get("restore-state", &rs)
+	if err == state.ErrNoState {
+		// nothing got restored
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("internal error: cannot get restore state: %v", err)
+	}
+
+	st.Unlock()
+	err = rs.Cleanup()
+	st.Lock()
+	if err != nil {
+		return err
+	}
+	task.Set("restore-state", &rs)
+	return nil
+}
@@ -0,0 +1,274 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package snapshotstate implements the manager and state aspects
+// responsible for the snapshots of the data of snaps.
+package snapshotstate
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n/dumb"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	backendSave = backend.Save
+	backendOpen = backend.Open
+	backendList = backend.List
+)
+
+func init() {
+	snapstate.AutomaticSnapshot = AutomaticSnapshot
+}
+
+// newSnapshotSetID returns the ID for a new snapshot set; it is kept in
+// the state, but the snapshots on disk are looked at too, so that a
+// reset state does not lead to existing snapshots being overwritten.
+func newSnapshotSetID(st *state.State) (uint64, error) {
+	var lastID uint64
+	err := st.Get("last-snapshot-set-id", &lastID)
+	if err != nil && err != state.ErrNoState {
+		return 0, err
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*_*.zip"))
+	if err != nil {
+		return 0, err
+	}
+	for _, filename := range filenames {
+		l := strings.SplitN(filepath.Base(filename), "_", 2)
+		id, err := strconv.ParseUint(l[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if id > lastID {
+			lastID = id
+		}
+	}
+
+	lastID++
+	st.Set("last-snapshot-set-id", lastID)
+	return lastID, nil
+}
+
+// allActiveSnapNames returns the names of all the active snaps.
+func allActiveSnapNames(st *state.State) ([]string, error) {
+	all, err := snapstate.All(st)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(all))
+	for name, snapst := range all {
+		if snapst.Active {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// checkSnapshotConflict checks that no other snapshot operation on the
+// given set is in progress.
+func checkSnapshotConflict(st *state.State, setID uint64) error {
+	for _, task := range st.Tasks() {
+		switch task.Kind() {
+		case "save-snapshot", "check-snapshot", "restore-snapshot", "forget-snapshot":
+		default:
+			continue
+		}
+		if task.Status().Ready() {
+			continue
+		}
+		var snapshot snapshotSetup
+		if err := task.Get("snapshot-setup", &snapshot); err != nil {
+			continue
+		}
+		if snapshot.SetID == setID {
+			return fmt.Errorf("cannot operate on snapshot set #%d while change %q is in progress", setID, task.Change().ID())
+		}
+	}
+	return nil
+}
+
+// List the snapshot sets, limited to the given set (if non-zero) and to
+// the given snaps (if non-empty).
+func List(setID uint64, snapNames []string) ([]client.SnapshotSet, error) {
+	return backendList(setID, snapNames)
+}
+
+func saveTask(st *state.State, setID uint64, snapName string, users []string, auto bool) *state.Task {
+	summary := fmt.Sprintf(i18n.G("Save data of snap %q in snapshot set #%d"), snapName, setID)
+	task := st.NewTask("save-snapshot", summary)
+	task.Set("snapshot-setup", &snapshotSetup{
+		SetID: setID,
+		Snap:  snapName,
+		Users: users,
+		Auto:  auto,
+	})
+	return task
+}
+
+// Save creates a taskset for taking snapshots of the data of the given
+// snaps (or of all the active ones if none are given), for the given
+// users (or for all of them if none are given).
+func Save(st *state.State, snapNames []string, users []string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	if len(snapNames) == 0 {
+		snapNames, err = allActiveSnapNames(st)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	if len(snapNames) == 0 {
+		return 0, nil, nil, fmt.Errorf("no snaps to save")
+	}
+
+	for _, name := range snapNames {
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, name, &snapst); err != nil {
+			if err == state.ErrNoState {
+				return 0, nil, nil, fmt.Errorf("snap %q is not installed", name)
+			}
+			return 0, nil, nil, err
+		}
+		if err := snapstate.CheckChangeConflict(st, name, nil); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	setID, err = newSnapshotSetID(st)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	ts = state.NewTaskSet()
+	for _, name := range snapNames {
+		ts.AddTask(saveTask(st, setID, name, users, false))
+	}
+
+	return setID, snapNames, ts, nil
+}
+
+// AutomaticSnapshot returns a taskset for saving a snapshot of the data
+// of the given snap for all users, as done before removing it.
+func AutomaticSnapshot(st *state.State, snapName string) (*state.TaskSet, error) {
+	setID, err := newSnapshotSetID(st)
+	if err != nil {
+		return nil, err
+	}
+	return state.NewTaskSet(saveTask(st, setID, snapName, nil, true)), nil
+}
+
+// snapshotsInSet returns the snapshots in the given set, limited to the
+// given snaps if any are given; all of these must be in the set.
+func snapshotsInSet(setID uint64, snapNames []string) ([]*client.Snapshot, error) {
+	sets, err := backendList(setID, snapNames)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		if len(snapNames) > 0 {
+			return nil, fmt.Errorf("no snapshot set #%d with snaps %s", setID, strings.Join(snapNames, ", "))
+		}
+		return nil, fmt.Errorf("no snapshot set #%d", setID)
+	}
+	snapshots := sets[0].Snapshots
+	if len(snapNames) > 0 {
+		found := make(map[string]bool, len(snapshots))
+		for _, sh := range snapshots {
+			found[sh.Snap] = true
+		}
+		for _, name := range snapNames {
+			if !found[name] {
+				return nil, fmt.Errorf("snapshot set #%d has no snapshot of snap %q", setID, name)
+			}
+		}
+	}
+	return snapshots, nil
+}
+
+func snapshotTasks(st *state.State, kind string, setID uint64, snapNames []string, users []string, summary string) (snapsFound []string, ts *state.TaskSet, err error) {
+	if err := checkSnapshotConflict(st, setID); err != nil {
+		return nil, nil, err
+	}
+	snapshots, err := snapshotsInSet(setID, snapNames)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ts = state.NewTaskSet()
+	snapsFound = make([]string, 0, len(snapshots))
+	for _, sh := range snapshots {
+		task := st.NewTask(kind, fmt.Sprintf(summary, sh.Snap, setID))
+		task.Set("snapshot-setup", &snapshotSetup{
+			SetID:    setID,
+			Snap:     sh.Snap,
+			Users:    users,
+			Filename: backend.Filename(sh),
+		})
+		ts.AddTask(task)
+		snapsFound = append(snapsFound, sh.Snap)
+	}
+
+	return snapsFound, ts, nil
+}
+
+// Restore creates a taskset for restoring the snapshots of the given set,
+// limited to the given snaps and users (if any are given). The snaps need
+// to be installed.
+func Restore(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+	snapshots, err := snapshotsInSet(setID, snapNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sh := range snapshots {
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, sh.Snap, &snapst); err != nil {
+			if err == state.ErrNoState {
+				return nil, nil, fmt.Errorf("cannot restore snapshot of snap %q: snap is not installed", sh.Snap)
+			}
+			return nil, nil, err
+		}
+		if err := snapstate.CheckChangeConflict(st, sh.Snap, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return snapshotTasks(st, "restore-snapshot", setID, snapNames, users, i18n.G("Restore data of snap %q from snapshot set #%d"))
+}
+
+// Check creates a taskset for checking the snapshots of the given set,
+// limited to the given snaps and users (if any are given).
+func Check(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+	return snapshotTasks(st, "check-snapshot", setID, snapNames, users, i18n.G("Check data of snap %q in snapshot set #%d"))
+}
+
+// Forget creates a taskset for deleting the snapshots of the given set,
+// limited to the given snaps (if any are given).
+func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []string, ts *state.TaskSet, err error) {
+	return snapshotTasks(st, "forget-snapshot", setID, snapNames, nil, i18n.G("Drop data of snap %q from snapshot set #%d"))
+}
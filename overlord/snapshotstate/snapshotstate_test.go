@@ -0,0 +1,318 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type snapshotSuite struct {
+	state   *state.State
+	manager *snapshotstate.SnapshotManager
+}
+
+var _ = Suite(&snapshotSuite{})
+
+func (s *snapshotSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+	var err error
+	s.manager, err = snapshotstate.Manager(s.state)
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotSuite) TearDownTest(c *C) {
+	s.manager.Stop()
+	dirs.SetRootDir("")
+}
+
+func (s *snapshotSuite) settle() {
+	for i := 0; i < 5; i++ {
+		s.manager.Ensure()
+		s.manager.Wait()
+	}
+}
+
+func (s *snapshotSuite) mockSnap(c *C, name string) {
+	si := &snap.SideInfo{RealName: name, Revision: snap.R(1)}
+	snaptest.MockSnap(c, "name: "+name+"\nversion: 1.0\n", "", si)
+	snapstate.Set(s.state, name, &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+}
+
+func (s *snapshotSuite) TestNewSnapshotSetID(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	id, err := snapshotstate.NewSnapshotSetID(s.state)
+	c.Assert(err, IsNil)
+	c.Check(id, Equals, uint64(1))
+
+	id, err = snapshotstate.NewSnapshotSetID(s.state)
+	c.Assert(err, IsNil)
+	c.Check(id, Equals, uint64(2))
+
+	// snapshots on disk with higher ids are not clobbered
+	c.Assert(os.MkdirAll(dirs.SnapshotsDir, 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapshotsDir, "42_foo_1.0_1.zip"), nil, 0600), IsNil)
+
+	id, err = snapshotstate.NewSnapshotSetID(s.state)
+	c.Assert(err, IsNil)
+	c.Check(id, Equals, uint64(43))
+}
+
+func (s *snapshotSuite) TestSaveNotInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, _, _, err := snapshotstate.Save(s.state, []string{"foo"}, nil)
+	c.Check(err, ErrorMatches, `snap "foo" is not installed`)
+}
+
+func (s *snapshotSuite) TestSaveNothing(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, _, _, err := snapshotstate.Save(s.state, nil, nil)
+	c.Check(err, ErrorMatches, `no snaps to save`)
+}
+
+func (s *snapshotSuite) TestSaveAllActive(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.mockSnap(c, "bar")
+
+	setID, saved, ts, err := snapshotstate.Save(s.state, nil, []string{"user"})
+	c.Assert(err, IsNil)
+	c.Check(setID, Equals, uint64(1))
+	c.Check(saved, DeepEquals, []string{"bar", "foo"})
+	c.Assert(ts.Tasks(), HasLen, 2)
+	for _, task := range ts.Tasks() {
+		c.Check(task.Kind(), Equals, "save-snapshot")
+	}
+}
+
+func (s *snapshotSuite) TestSaveRuns(c *C) {
+	var calls []string
+	defer snapshotstate.MockBackendSave(func(id uint64, si *snap.Info, cfg map[string]interface{}, users []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(id, Equals, uint64(1))
+		c.Check(cfg, DeepEquals, map[string]interface{}{"some": "conf"})
+		c.Check(users, DeepEquals, []string{"user"})
+		c.Check(flags.Auto, Equals, false)
+		calls = append(calls, si.Name())
+		return &client.Snapshot{SetID: id, Snap: si.Name(), Version: si.Version, Revision: si.Revision}, nil
+	})()
+
+	s.state.Lock()
+	s.mockSnap(c, "foo")
+	c.Assert(config.SetSnapConfig(s.state, "foo", map[string]interface{}{"some": "conf"}), IsNil)
+	_, _, ts, err := snapshotstate.Save(s.state, []string{"foo"}, []string{"user"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("save-snapshot", "...")
+	chg.AddAll(ts)
+	s.state.Unlock()
+
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.Err(), IsNil)
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(calls, DeepEquals, []string{"foo"})
+}
+
+func (s *snapshotSuite) TestAutomaticSnapshot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, err := snapstate.AutomaticSnapshot(s.state, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(ts.Tasks(), HasLen, 1)
+	task := ts.Tasks()[0]
+	c.Check(task.Kind(), Equals, "save-snapshot")
+	var setup map[string]interface{}
+	c.Assert(task.Get("snapshot-setup", &setup), IsNil)
+	c.Check(setup["auto"], Equals, true)
+	c.Check(setup["snap"], Equals, "foo")
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *snapshotSuite) mockList() func() {
+	return snapshotstate.MockBackendList(func(setID uint64, snapNames []string) ([]client.SnapshotSet, error) {
+		if setID != 42 {
+			return nil, nil
+		}
+		var snapshots []*client.Snapshot
+		for _, sh := range []*client.Snapshot{
+			{SetID: 42, Snap: "foo", Version: "1.0", Revision: snap.R(1)},
+			{SetID: 42, Snap: "bar", Version: "2.0", Revision: snap.R(2)},
+		} {
+			if len(snapNames) > 0 && !contains(snapNames, sh.Snap) {
+				continue
+			}
+			snapshots = append(snapshots, sh)
+		}
+		if len(snapshots) == 0 {
+			return nil, nil
+		}
+		return []client.SnapshotSet{{ID: 42, Snapshots: snapshots}}, nil
+	})
+}
+
+func (s *snapshotSuite) TestForget(c *C) {
+	defer s.mockList()()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	found, ts, err := snapshotstate.Forget(s.state, 42, nil)
+	c.Assert(err, IsNil)
+	c.Check(found, DeepEquals, []string{"foo", "bar"})
+	c.Check(ts.Tasks(), HasLen, 2)
+
+	_, _, err = snapshotstate.Forget(s.state, 1, nil)
+	c.Check(err, ErrorMatches, `no snapshot set #1`)
+
+	_, _, err = snapshotstate.Forget(s.state, 42, []string{"foo", "baz"})
+	c.Check(err, ErrorMatches, `snapshot set #42 has no snapshot of snap "baz"`)
+}
+
+func (s *snapshotSuite) TestForgetRemovesFile(c *C) {
+	defer s.mockList()()
+
+	filename := backend.Filename(&client.Snapshot{SetID: 42, Snap: "foo", Version: "1.0", Revision: snap.R(1)})
+	c.Assert(os.MkdirAll(filepath.Dir(filename), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filename, nil, 0600), IsNil)
+
+	s.state.Lock()
+	_, ts, err := snapshotstate.Forget(s.state, 42, []string{"foo"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("forget-snapshot", "...")
+	chg.AddAll(ts)
+	s.state.Unlock()
+
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(osutil.FileExists(filename), Equals, false)
+
+	// the ID of the forgotten set is not reused
+	var lastID uint64
+	c.Assert(s.state.Get("last-snapshot-set-id", &lastID), IsNil)
+	c.Check(lastID, Equals, uint64(42))
+}
+
+func (s *snapshotSuite) TestForgetRemoveFails(c *C) {
+	defer s.mockList()()
+
+	// a non-empty directory where the snapshot should be
+	filename := backend.Filename(&client.Snapshot{SetID: 42, Snap: "foo", Version: "1.0", Revision: snap.R(1)})
+	c.Assert(os.MkdirAll(filepath.Join(filename, "sub"), 0700), IsNil)
+
+	s.state.Lock()
+	_, ts, err := snapshotstate.Forget(s.state, 42, []string{"foo"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("forget-snapshot", "...")
+	chg.AddAll(ts)
+	s.state.Unlock()
+
+	s.settle()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	var lastID uint64
+	c.Check(s.state.Get("last-snapshot-set-id", &lastID), Equals, state.ErrNoState)
+}
+
+func (s *snapshotSuite) TestConflict(c *C) {
+	defer s.mockList()()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, ts, err := snapshotstate.Check(s.state, 42, nil, nil)
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("check-snapshot", "...")
+	chg.AddAll(ts)
+
+	_, _, err = snapshotstate.Forget(s.state, 42, nil)
+	c.Check(err, ErrorMatches, `cannot operate on snapshot set #42 while change "1" is in progress`)
+}
+
+func (s *snapshotSuite) TestRestoreNotInstalled(c *C) {
+	defer s.mockList()()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockSnap(c, "foo")
+	_, _, err := snapshotstate.Restore(s.state, 42, nil, nil)
+	c.Check(err, ErrorMatches, `cannot restore snapshot of snap "bar": snap is not installed`)
+
+	found, ts, err := snapshotstate.Restore(s.state, 42, []string{"foo"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(found, DeepEquals, []string{"foo"})
+	c.Assert(ts.Tasks(), HasLen, 1)
+	c.Check(ts.Tasks()[0].Kind(), Equals, "restore-snapshot")
+}
+
+func (s *snapshotSuite) TestListError(c *C) {
+	defer snapshotstate.MockBackendList(func(uint64, []string) ([]client.SnapshotSet, error) {
+		return nil, errors.New("bzzt")
+	})()
+
+	_, err := snapshotstate.List(0, nil)
+	c.Check(err, ErrorMatches, "bzzt")
+}
@@ -0,0 +1,217 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/timeutil"
+)
+
+// The auto-refresh behaviour is controlled via the "core" configuration:
+//
+// refresh.schedule: a time spec as understood by timeutil.ParseSchedule,
+// e.g. "mon-fri@9:00-11:00/sat@13:00-15:00"; when unset defaultRefreshSchedule
+// is used
+//
+// refresh.hold: a RFC3339 timestamp until which auto-refreshes are deferred
+//
+// refresh.metered: when set to "hold" no auto-refreshes happen while on a
+// metered connection
+//
+// the time of the last auto-refresh is kept in refresh.last.
+const defaultRefreshSchedule = "00:00-04:59/5:00-10:59/11:00-16:59/17:00-23:59"
+
+// ValidateRefreshSchedule checks that the given schedule spec is suitable
+// as refresh.schedule.
+func ValidateRefreshSchedule(spec string) error {
+	_, err := timeutil.ParseSchedule(spec)
+	return err
+}
+
+// ValidateRefreshHold checks that the given value is suitable as
+// refresh.hold.
+func ValidateRefreshHold(value string) error {
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return fmt.Errorf("cannot parse %q: want a RFC3339 timestamp", value)
+	}
+	return nil
+}
+
+// ValidateRefreshMetered checks that the given value is suitable as
+// refresh.metered.
+func ValidateRefreshMetered(value string) error {
+	switch value {
+	case "", "hold":
+		return nil
+	}
+	return fmt.Errorf(`cannot parse %q: want "hold" or ""`, value)
+}
+
+// refreshScheduleWithDefault returns the refresh schedule from the core
+// configuration, falling back to defaultRefreshSchedule if it is unset
+// or invalid.
+func refreshScheduleWithDefault(tr *config.Transaction) ([]*timeutil.Schedule, string, error) {
+	var spec string
+	err := tr.Get("core", "refresh.schedule", &spec)
+	if err != nil && !config.IsNoOption(err) {
+		return nil, "", err
+	}
+	if spec != "" {
+		schedule, err := timeutil.ParseSchedule(spec)
+		if err == nil {
+			return schedule, spec, nil
+		}
+		logger.Noticef("cannot use refresh.schedule configuration: %s", err)
+	}
+
+	schedule, err := timeutil.ParseSchedule(defaultRefreshSchedule)
+	if err != nil {
+		panic(fmt.Sprintf("internal error: cannot parse default refresh schedule: %s", err))
+	}
+	return schedule, defaultRefreshSchedule, nil
+}
+
+// getTime reads a timestamp from the core configuration, returning the
+// zero time if it is unset.
+func getTime(tr *config.Transaction, key string) (time.Time, error) {
+	var s string
+	err := tr.Get("core", key, &s)
+	if err != nil && !config.IsNoOption(err) {
+		return time.Time{}, err
+	}
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %s: %s", key, err)
+	}
+	return t, nil
+}
+
+// LastRefresh returns the time of the last auto-refresh, or the zero
+// time if there was none yet.
+func LastRefresh(st *state.State) (time.Time, error) {
+	return getTime(config.NewTransaction(st), "refresh.last")
+}
+
+// RefreshHold returns the time until which auto-refreshes are held, or
+// the zero time if they are not.
+func RefreshHold(st *state.State) (time.Time, error) {
+	return getTime(config.NewTransaction(st), "refresh.hold")
+}
+
+// holdOnMeteredConnection returns whether auto-refreshes should be held
+// back because the system is on a metered connection.
+func holdOnMeteredConnection(tr *config.Transaction) (bool, error) {
+	var policy string
+	err := tr.Get("core", "refresh.metered", &policy)
+	if err != nil && !config.IsNoOption(err) {
+		return false, err
+	}
+	if policy != "hold" {
+		return false, nil
+	}
+	metered, err := isOnMeteredConnection()
+	if err != nil {
+		logger.Debugf("cannot determine whether the connection is metered: %s", err)
+		return false, nil
+	}
+	return metered, nil
+}
+
+var isOnMeteredConnection = isOnMeteredConnectionImpl
+
+// isOnMeteredConnectionImpl asks NetworkManager whether the primary
+// connection is metered.
+func isOnMeteredConnectionImpl() (bool, error) {
+	output, err := exec.Command("busctl", "get-property", "org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", "Metered").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	// the output looks like "u 4"; NMMetered is one of unknown (0),
+	// yes (1), no (2), guess-yes (3) or guess-no (4)
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 || fields[0] != "u" {
+		return false, fmt.Errorf("unexpected output %q", output)
+	}
+	switch fields[1] {
+	case "1", "3":
+		return true, nil
+	}
+	return false, nil
+}
+
+// RefreshSchedule returns the auto-refresh schedule currently in effect
+// and the time of the next auto-refresh, which is zero if it is not
+// known yet.
+//
+// The state must be locked by the caller.
+func (m *SnapManager) RefreshSchedule() (schedule string, next time.Time, err error) {
+	tr := config.NewTransaction(m.state)
+	_, schedule, err = refreshScheduleWithDefault(tr)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if schedule != m.lastRefreshSchedule {
+		return schedule, time.Time{}, nil
+	}
+	return schedule, m.nextRefresh, nil
+}
+
+// updateNextRefresh computes the time of the next auto-refresh if the
+// schedule changed or there is none planned yet.
+func (m *SnapManager) updateNextRefresh(tr *config.Transaction, lastRefresh time.Time) error {
+	schedule, spec, err := refreshScheduleWithDefault(tr)
+	if err != nil {
+		return err
+	}
+	if spec == m.lastRefreshSchedule && !m.nextRefresh.IsZero() {
+		return nil
+	}
+	m.lastRefreshSchedule = spec
+	m.nextRefresh = time.Now().Add(timeutil.Next(schedule, lastRefresh))
+	logger.Debugf("next auto-refresh at %s", m.nextRefresh)
+	return nil
+}
+
+// postponeOutsideSchedule plans the next auto-refresh anew if the
+// current one got delayed (by a hold, a metered connection or the
+// backoff between attempts) past the end of its window. It returns
+// whether the refresh was postponed.
+func (m *SnapManager) postponeOutsideSchedule(tr *config.Transaction, lastRefresh time.Time) (bool, error) {
+	schedule, _, err := refreshScheduleWithDefault(tr)
+	if err != nil {
+		return false, err
+	}
+	if timeutil.Includes(schedule, time.Now()) {
+		return false, nil
+	}
+	m.nextRefresh = time.Time{}
+	return true, m.updateNextRefresh(tr, lastRefresh)
+}
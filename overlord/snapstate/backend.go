@@ -30,11 +30,11 @@ import (
 	"golang.org/x/net/context"
 )
 
-// A StoreService can find, list available updates and download snaps.
+// A StoreService can find, query for install and refresh information and download snaps.
 type StoreService interface {
 	SnapInfo(spec store.SnapSpec, user *auth.UserState) (*snap.Info, error)
 	Find(search *store.Search, user *auth.UserState) ([]*snap.Info, error)
-	ListRefresh([]*store.RefreshCandidate, *auth.UserState) ([]*snap.Info, error)
+	SnapAction(currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, user *auth.UserState) ([]*snap.Info, error)
 	Sections(user *auth.UserState) ([]string, error)
 	Download(context.Context, string, string, *snap.DownloadInfo, progress.Meter, *auth.UserState) error
 
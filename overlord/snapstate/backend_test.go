@@ -43,7 +43,9 @@ type fakeOp struct {
 	revno   snap.Revision
 	sinfo   snap.SideInfo
 	stype   snap.Type
-	cand    store.RefreshCandidate
+
+	curSnaps []store.CurrentSnap
+	action   store.SnapAction
 
 	old string
 
@@ -105,6 +107,20 @@ func (f *fakeStore) pokeStateLock() {
 func (f *fakeStore) SnapInfo(spec store.SnapSpec, user *auth.UserState) (*snap.Info, error) {
 	f.pokeStateLock()
 
+	info, err := f.snapInfo(spec)
+	if err != nil {
+		return nil, err
+	}
+	f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-snap", name: spec.Name, revno: info.Revision})
+
+	return info, nil
+}
+
+func (f *fakeStore) snapInfo(spec store.SnapSpec) (*snap.Info, error) {
+	if spec.Name == "not-in-store" {
+		return nil, store.ErrSnapNotFound
+	}
+
 	if spec.Revision.Unset() {
 		spec.Revision = snap.R(11)
 		if spec.Channel == "channel-for-7" {
@@ -140,7 +156,6 @@ func (f *fakeStore) SnapInfo(spec store.SnapSpec, user *auth.UserState) (*snap.I
 		Confinement: confinement,
 		Type:        typ,
 	}
-	f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-snap", name: spec.Name, revno: spec.Revision})
 
 	return info, nil
 }
@@ -149,38 +164,75 @@ func (f *fakeStore) Find(search *store.Search, user *auth.UserState) ([]*snap.In
 	panic("Find called")
 }
 
-func (f *fakeStore) ListRefresh(cands []*store.RefreshCandidate, _ *auth.UserState) ([]*snap.Info, error) {
+func (f *fakeStore) SnapAction(currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, _ *auth.UserState) ([]*snap.Info, error) {
 	f.pokeStateLock()
 
-	if len(cands) == 0 {
-		return nil, nil
+	if len(currentSnaps) == 0 && len(actions) == 0 {
+		return nil, &store.SnapActionError{NoResults: true}
 	}
-	if len(cands) > 2 {
-		panic("ListRefresh unexpectedly called with more than two candidates")
+	if len(actions) > 3 {
+		panic("SnapAction unexpectedly called with more than 3 actions")
 	}
 
-	var res []*snap.Info
-	for _, cand := range cands {
-		snapID := cand.SnapID
+	curByID := make(map[string]*store.CurrentSnap, len(currentSnaps))
+	curSnaps := make([]store.CurrentSnap, len(currentSnaps))
+	for i, cur := range currentSnaps {
+		if cur.Name == "" || cur.SnapID == "" || cur.Revision.Unset() {
+			return nil, fmt.Errorf("internal error: incomplete current snap info")
+		}
+		curByID[cur.SnapID] = cur
+		curSnaps[i] = *cur
+	}
+	f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-snap-action", curSnaps: curSnaps})
 
-		if snapID == "" || snapID == "other-snap-id" {
+	refreshErrors := make(map[string]error)
+	installErrors := make(map[string]error)
+	var res []*snap.Info
+	for _, a := range actions {
+		if a.Action == "install" {
+			spec := store.SnapSpec{
+				Name:     a.Name,
+				Channel:  a.Channel,
+				Revision: a.Revision,
+			}
+			info, err := f.snapInfo(spec)
+			if err != nil {
+				installErrors[a.Name] = err
+				continue
+			}
+			f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-snap-action:action", action: *a, revno: info.Revision})
+			res = append(res, info)
 			continue
 		}
 
-		if snapID == "fakestore-please-error-on-refresh" {
-			return nil, fmt.Errorf("failing as requested")
+		if a.Action != "refresh" {
+			panic("not supported")
+		}
+
+		if a.SnapID == "fakestore-please-error-on-refresh" {
+			return nil, &store.SnapActionError{Other: []error{fmt.Errorf("failing as requested")}}
+		}
+
+		cur := curByID[a.SnapID]
+		if cur == nil {
+			return nil, fmt.Errorf("internal error: no matching current snap for %q", a.SnapID)
+		}
+
+		if a.SnapID == "other-snap-id" {
+			refreshErrors[cur.Name] = store.ErrNoUpdateAvailable
+			continue
 		}
 
 		var name string
-		if snapID == "some-snap-id" {
+		if a.SnapID == "some-snap-id" {
 			name = "some-snap"
 		} else {
-			panic(fmt.Sprintf("ListRefresh: unknown snap-id: %s", snapID))
+			panic(fmt.Sprintf("SnapAction: unknown snap-id: %s", a.SnapID))
 		}
 
 		revno := snap.R(11)
 		confinement := snap.StrictConfinement
-		switch cand.Channel {
+		switch a.Channel {
 		case "channel-for-7":
 			revno = snap.R(7)
 		case "channel-for-classic":
@@ -192,8 +244,8 @@ func (f *fakeStore) ListRefresh(cands []*store.RefreshCandidate, _ *auth.UserSta
 		info := &snap.Info{
 			SideInfo: snap.SideInfo{
 				RealName: name,
-				Channel:  cand.Channel,
-				SnapID:   cand.SnapID,
+				Channel:  a.Channel,
+				SnapID:   a.SnapID,
 				Revision: revno,
 			},
 			Version: name,
@@ -205,20 +257,36 @@ func (f *fakeStore) ListRefresh(cands []*store.RefreshCandidate, _ *auth.UserSta
 		}
 
 		var hit snap.Revision
-		if cand.Revision != revno {
+		if cur.Revision != revno {
 			hit = revno
 		}
-		for _, blocked := range cand.Block {
+		for _, blocked := range cur.Block {
 			if blocked == revno {
 				hit = snap.Revision{}
 				break
 			}
 		}
 
-		f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-list-refresh", cand: *cand, revno: hit})
+		f.fakeBackend.ops = append(f.fakeBackend.ops, fakeOp{op: "storesvc-snap-action:action", action: *a, revno: hit})
 
-		if !hit.Unset() {
-			res = append(res, info)
+		if hit.Unset() {
+			refreshErrors[cur.Name] = store.ErrNoUpdateAvailable
+			continue
+		}
+		res = append(res, info)
+	}
+
+	if len(refreshErrors)+len(installErrors) > 0 || len(res) == 0 {
+		if len(refreshErrors) == 0 {
+			refreshErrors = nil
+		}
+		if len(installErrors) == 0 {
+			installErrors = nil
+		}
+		return res, &store.SnapActionError{
+			NoResults: len(res) == 0,
+			Refresh:   refreshErrors,
+			Install:   installErrors,
 		}
 	}
 
@@ -318,6 +386,25 @@ func (f *fakeSnappyBackend) ReadInfo(name string, si *snap.SideInfo) (*snap.Info
 	if name == "core" {
 		info.Type = snap.TypeOS
 	}
+	if name == "snap-content-plug" {
+		var err error
+		info, err = snap.InfoFromSnapYaml([]byte(`name: snap-content-plug
+plugs:
+  some-content-plug:
+    interface: content
+    content: shared-content
+    default-provider: snap-content-slot:some-slot
+    target: import
+`))
+		if err != nil {
+			panic(err)
+		}
+		info.SideInfo = *si
+	}
+	if name == "epoch-snap" {
+		// revision N is at epoch N*
+		info.Epoch = snap.E(fmt.Sprintf("%d*", si.Revision.N))
+	}
 	if name == "alias-snap" {
 		var err error
 		info, err = snap.InfoFromSnapYaml([]byte(`name: alias-snap
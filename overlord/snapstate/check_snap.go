@@ -190,6 +190,10 @@ func checkSnap(st *state.State, snapFilePath string, si *snap.SideInfo, curInfo
 		return err
 	}
 
+	if curInfo != nil && !s.Epoch.CanRead(curInfo.Epoch) {
+		return fmt.Errorf("cannot refresh %q to new revision %s with epoch %s, because it cannot read the data of the current epoch %s", s.Name(), s.Revision, s.Epoch, curInfo.Epoch)
+	}
+
 	st.Lock()
 	defer st.Unlock()
 
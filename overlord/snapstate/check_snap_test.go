@@ -199,6 +199,38 @@ version: 1.0`
 	c.Check(checkCbCalled, Equals, true)
 }
 
+func (s *checkSnapSuite) TestCheckSnapEpochs(c *C) {
+	tests := []struct {
+		epoch, curEpoch string
+		err             string
+	}{
+		{epoch: "0", curEpoch: "0"},
+		{epoch: "1*", curEpoch: "0"},
+		{epoch: "1*", curEpoch: "1"},
+		{epoch: "1", curEpoch: "1*"},
+		{epoch: "1", curEpoch: "0", err: `cannot refresh "foo" to new revision 2 with epoch 1, because it cannot read the data of the current epoch 0`},
+		{epoch: "0", curEpoch: "1*", err: `cannot refresh "foo" to new revision 2 with epoch 0, because it cannot read the data of the current epoch 1\*`},
+	}
+
+	for _, test := range tests {
+		var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+			info := snaptest.MockInfo(c, "name: foo\nversion: 1.0\nepoch: "+test.epoch, si)
+			return info, nil, nil
+		}
+		restore := snapstate.MockOpenSnapFile(openSnapFile)
+
+		si := &snap.SideInfo{Revision: snap.R(2)}
+		curInfo := snaptest.MockInfo(c, "name: foo\nversion: 1.0\nepoch: "+test.curEpoch, &snap.SideInfo{Revision: snap.R(1)})
+		err := snapstate.CheckSnap(s.st, "snap-path", si, curInfo, snapstate.Flags{})
+		if test.err == "" {
+			c.Check(err, IsNil, Commentf("%s -> %s", test.curEpoch, test.epoch))
+		} else {
+			c.Check(err, ErrorMatches, test.err, Commentf("%s -> %s", test.curEpoch, test.epoch))
+		}
+		restore()
+	}
+}
+
 func (s *checkSnapSuite) TestCheckSnapCheckCallbackFail(c *C) {
 	const yaml = `name: foo
 version: 1.0`
@@ -21,7 +21,6 @@ package snapstate
 
 import (
 	"errors"
-	"time"
 
 	"gopkg.in/tomb.v2"
 
@@ -70,7 +69,9 @@ func (m *SnapManager) AddForeignTaskHandlers(tracker ForeignTaskTracker) {
 
 	m.runner.AddHandler("run-hook", func(task *state.Task, _ *tomb.Tomb) error {
 		return nil
-	}, nil)
+	}, func(task *state.Task, _ *tomb.Tomb) error {
+		return nil
+	})
 }
 
 // AddAdhocTaskHandlers registers handlers for ad hoc test handler
@@ -96,15 +97,10 @@ func MockErrtrackerReport(mock func(string, string, string, map[string]string) (
 	return func() { errtrackerReport = prev }
 }
 
-func MockRefreshInterval(newMinRefreshInterval, newRefreshRandomness time.Duration) (restore func()) {
-	prevMinRefreshInterval := minRefreshInterval
-	prevDefaultRefreshRandomness := defaultRefreshRandomness
-	minRefreshInterval = newMinRefreshInterval
-	defaultRefreshRandomness = newRefreshRandomness
-	return func() {
-		minRefreshInterval = prevMinRefreshInterval
-		defaultRefreshRandomness = prevDefaultRefreshRandomness
-	}
+func MockIsOnMeteredConnection(mock func() (bool, error)) (restore func()) {
+	prev := isOnMeteredConnection
+	isOnMeteredConnection = mock
+	return func() { isOnMeteredConnection = prev }
 }
 
 var (
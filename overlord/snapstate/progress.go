@@ -32,6 +32,12 @@ type TaskProgressAdapter struct {
 	current float64
 }
 
+// NewTaskProgressAdapter returns a TaskProgressAdapter reporting
+// into the given task. The state must not be locked when using it.
+func NewTaskProgressAdapter(t *state.Task) *TaskProgressAdapter {
+	return &TaskProgressAdapter{task: t}
+}
+
 // Start sets total
 func (t *TaskProgressAdapter) Start(label string, total float64) {
 	t.label = label
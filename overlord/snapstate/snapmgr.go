@@ -23,8 +23,9 @@ package snapstate
 import (
 	"errors"
 	"fmt"
-	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +33,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/errtracker"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
@@ -46,35 +48,6 @@ import (
 	"github.com/snapcore/snapd/strutil"
 )
 
-// FIXME: what we actually want is a schedule spec that is user configurable
-// like:
-// """
-// tue
-// tue,thu
-// tue-thu
-// 9:00
-// 9:00,15:00
-// 9:00-15:00
-// tue,thu@9:00-15:00
-// tue@9:00;thu@15:00
-// mon,wed-fri@9:00-11:00,13:00-15:00
-// """
-// where 9:00 is implicitly taken as 9:00-10:00
-// and tue is implicitly taken as tue@<our current setting?>
-//
-// it is controlled via:
-// $ snap refresh --schedule=<time spec>
-// which is a shorthand for
-// $ snap set core refresh.schedule=<time spec>
-// and we need to validate the time-spec, ideally internally by
-// intercepting the set call
-var (
-	minRefreshInterval = 4 * time.Hour
-
-	// random interval on top of the minmum time between refreshes
-	defaultRefreshRandomness = 4 * time.Hour
-)
-
 var (
 	errtrackerReport = errtracker.Report
 )
@@ -84,8 +57,9 @@ type SnapManager struct {
 	state   *state.State
 	backend managerBackend
 
-	refreshRandomness  time.Duration
-	lastRefreshAttempt time.Time
+	lastRefreshSchedule string
+	nextRefresh         time.Time
+	lastRefreshAttempt  time.Time
 
 	lastUbuntuCoreTransitionAttempt time.Time
 
@@ -305,7 +279,7 @@ func Store(st *state.State) StoreService {
 	panic("internal error: needing the store before managers have initialized it")
 }
 
-func updateInfo(st *state.State, snapst *SnapState, channel string, userID int) (*snap.Info, error) {
+func updateInfo(st *state.State, snapst *SnapState, channel string, userID int, flags Flags) (*snap.Info, error) {
 	user, err := userFromUserID(st, userID)
 	if err != nil {
 		return nil, err
@@ -319,24 +293,39 @@ func updateInfo(st *state.State, snapst *SnapState, channel string, userID int)
 		return nil, fmt.Errorf("cannot refresh local snap %q", curInfo.Name())
 	}
 
-	refreshCand := &store.RefreshCandidate{
+	curSnaps := []*store.CurrentSnap{{
+		Name:            curInfo.Name(),
+		SnapID:          curInfo.SnapID,
+		Revision:        curInfo.Revision,
+		TrackingChannel: snapst.Channel,
+		Epoch:           curInfo.Epoch,
+	}}
+	action := &store.SnapAction{
+		Action: "refresh",
+		SnapID: curInfo.SnapID,
 		// the desired channel
-		Channel:  channel,
-		SnapID:   curInfo.SnapID,
-		Revision: curInfo.Revision,
-		Epoch:    curInfo.Epoch,
+		Channel: channel,
+	}
+	if flags.IgnoreValidation {
+		action.Flags = store.SnapActionIgnoreValidation
 	}
 
 	theStore := Store(st)
 	st.Unlock() // calls to the store should be done without holding the state lock
-	res, err := theStore.ListRefresh([]*store.RefreshCandidate{refreshCand}, user)
+	res, err := theStore.SnapAction(curSnaps, []*store.SnapAction{action}, user)
 	st.Lock()
+	if saErr, ok := err.(*store.SnapActionError); ok && len(saErr.Other) == 0 {
+		refreshErr := saErr.Refresh[curInfo.Name()]
+		if refreshErr == store.ErrNoUpdateAvailable || (refreshErr == nil && saErr.NoResults) {
+			return nil, &snap.NoUpdateAvailableError{Snap: curInfo.Name()}
+		}
+		if refreshErr != nil {
+			err = refreshErr
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot get refresh information for snap %q: %s", curInfo.Name(), err)
 	}
-	if len(res) == 0 {
-		return nil, &snap.NoUpdateAvailableError{Snap: curInfo.Name()}
-	}
 
 	return res[0], nil
 }
@@ -358,6 +347,9 @@ func snapInfo(st *state.State, name, channel string, revision snap.Revision, use
 	return snap, err
 }
 
+// maxConcurrentDownloads is how many snaps may be downloaded at once.
+var maxConcurrentDownloads = 2
+
 // Manager returns a new snap manager.
 func Manager(st *state.State) (*SnapManager, error) {
 	runner := state.NewTaskRunner(st)
@@ -366,10 +358,7 @@ func Manager(st *state.State) (*SnapManager, error) {
 		state:   st,
 		backend: backend.Backend{},
 		runner:  runner,
-
-		refreshRandomness: time.Duration(rand.Int63n(int64(defaultRefreshRandomness))),
 	}
-	logger.Debugf("snapmgr refresh randomness %s", m.refreshRandomness)
 
 	// this handler does nothing
 	runner.AddHandler("nop", func(t *state.Task, _ *tomb.Tomb) error {
@@ -380,6 +369,7 @@ func Manager(st *state.State) (*SnapManager, error) {
 	runner.AddHandler("prepare-snap", m.doPrepareSnap, m.undoPrepareSnap)
 	runner.AddHandler("download-snap", m.doDownloadSnap, m.undoPrepareSnap)
 	runner.AddHandler("mount-snap", m.doMountSnap, m.undoMountSnap)
+	runner.AddHandler("prerequisites", m.doPrerequisites, nil)
 	runner.AddHandler("unlink-current-snap", m.doUnlinkCurrentSnap, m.undoUnlinkCurrentSnap)
 	runner.AddHandler("copy-snap-data", m.doCopySnapData, m.undoCopySnapData)
 	runner.AddCleanup("copy-snap-data", m.cleanupCopySnapData)
@@ -406,6 +396,8 @@ func Manager(st *state.State) (*SnapManager, error) {
 
 	// control serialisation
 	runner.SetBlocked(m.blockedTask)
+	// don't saturate the network with downloads
+	runner.SetConcurrencyLimit("download-snap", maxConcurrentDownloads)
 
 	// test handlers
 	runner.AddHandler("fake-install-snap", func(t *state.Task, _ *tomb.Tomb) error {
@@ -464,14 +456,33 @@ func (m *SnapManager) ensureRefreshes() error {
 		}
 	}
 
-	var lastRefresh time.Time
-	err := tr.Get("core", "refresh.last", &lastRefresh)
-	if err != nil && !config.IsNoOption(err) {
+	lastRefresh, err := getTime(tr, "refresh.last")
+	if err != nil {
 		return err
 	}
+	if err := m.updateNextRefresh(tr, lastRefresh); err != nil {
+		return err
+	}
+	if time.Now().Before(m.nextRefresh) {
+		return nil
+	}
 
-	nextRefresh := lastRefresh.Add(minRefreshInterval).Add(m.refreshRandomness)
-	if time.Now().Before(nextRefresh) {
+	// refreshes can be held off for a while
+	holdTime, err := getTime(tr, "refresh.hold")
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(holdTime) {
+		return nil
+	}
+
+	// and on metered connections
+	hold, err := holdOnMeteredConnection(tr)
+	if err != nil {
+		return err
+	}
+	if hold {
+		logger.Debugf("auto-refresh held back on metered connection")
 		return nil
 	}
 
@@ -490,16 +501,27 @@ func (m *SnapManager) ensureRefreshes() error {
 		return nil
 	}
 
+	// only ever refresh within the schedule
+	if postponed, err := m.postponeOutsideSchedule(tr, lastRefresh); err != nil || postponed {
+		return err
+	}
+
 	// store attempts in memory so that we can backoff a
 	m.lastRefreshAttempt = time.Now()
 	updated, tasksets, err := AutoRefresh(m.state)
 	if err != nil {
+		m.state.Warnf("cannot refresh snaps automatically: %v", err)
 		return err
 	}
 
 	// Do setLastRefresh() only if the store (in AutoRefresh) gave
 	// us no error.
 	setLastRefresh(m.state)
+	// and plan the next one from there
+	m.nextRefresh = time.Time{}
+	if err := m.updateNextRefresh(tr, time.Now()); err != nil {
+		return err
+	}
 
 	var msg string
 	switch len(updated) {
@@ -518,6 +540,8 @@ func (m *SnapManager) ensureRefreshes() error {
 	}
 
 	chg := m.state.NewChange("auto-refresh", msg)
+	// let changes requested by users go first
+	chg.SetPriority(state.BackgroundPriority)
 	for _, ts := range tasksets {
 		chg.AddAll(ts)
 	}
@@ -611,6 +635,7 @@ func (m *SnapManager) ensureUbuntuCoreTransition() error {
 
 	tss, err := TransitionCore(m.state, "ubuntu-core", "core")
 	if err != nil {
+		m.state.Warnf("cannot transition ubuntu-core to core: %v", err)
 		return err
 	}
 
@@ -838,6 +863,7 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 	if err != nil {
 		return err
 	}
+	removePartialDownloads(snapsup.Name(), targetFn)
 
 	snapsup.SnapPath = targetFn
 
@@ -849,6 +875,25 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 	return nil
 }
 
+// removePartialDownloads removes the partial downloads of a given snap left
+// behind by interrupted downloads of revisions other than the one in keepFn,
+// as those are not going to be resumed.
+func removePartialDownloads(snapName, keepFn string) {
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, fmt.Sprintf("%s_*.snap.partial", snapName)))
+	if err != nil {
+		logger.Noticef("cannot look for partial downloads of snap %q: %s", snapName, err)
+		return
+	}
+	for _, partial := range matches {
+		if partial == keepFn+".partial" {
+			continue
+		}
+		if err := os.Remove(partial); err != nil {
+			logger.Noticef("cannot remove partial download %q: %s", partial, err)
+		}
+	}
+}
+
 func (m *SnapManager) doUnlinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	// invoked only if snap has a current active revision
 
@@ -962,6 +1007,7 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 			st.Unlock()
 			return &state.Retry{After: 3 * time.Minute}
 		}
+		removePartialDownloads(snapsup.Name(), "")
 	}
 	st.Lock()
 	Set(st, snapsup.Name(), snapst)
@@ -1035,6 +1081,129 @@ func (m *SnapManager) doMountSnap(t *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+// defaultProviderChannel is the channel default content providers are
+// installed from.
+const defaultProviderChannel = "stable"
+
+// defaultContentProviders returns the sorted names of the snaps that are
+// the default providers of the content plugs of the given snap and that
+// are not installed.
+func defaultContentProviders(st *state.State, info *snap.Info) ([]string, error) {
+	seen := make(map[string]bool)
+	var providers []string
+	for _, plug := range info.Plugs {
+		if plug.Interface != "content" {
+			continue
+		}
+		dprovider, ok := plug.Attrs["default-provider"].(string)
+		if !ok || dprovider == "" {
+			continue
+		}
+		// default-provider is <snap>[:<slot>]
+		name := strings.SplitN(dprovider, ":", 2)[0]
+		if seen[name] || name == info.Name() {
+			continue
+		}
+		seen[name] = true
+
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err != nil && err != state.ErrNoState {
+			return nil, err
+		}
+		if snapst.HasCurrent() {
+			continue
+		}
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	return providers, nil
+}
+
+func (m *SnapManager) doPrerequisites(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var seeded bool
+	err := st.Get("seeded", &seeded)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if !seeded {
+		// default providers are expected to be part of the seed
+		return nil
+	}
+
+	snapsup, err := TaskSnapSetup(t)
+	if err != nil {
+		return err
+	}
+	info, err := readInfo(snapsup.Name(), snapsup.SideInfo)
+	if err != nil {
+		return err
+	}
+
+	providers, err := defaultContentProviders(st, info)
+	if err != nil {
+		return err
+	}
+
+	chg := t.Change()
+	for _, name := range providers {
+		// another snap of the same change, e.g. of an InstallMany,
+		// is or needs the same provider; wait for it to be installed
+		if providerTasks := snapTasksInChange(chg, name); len(providerTasks) > 0 {
+			for _, halted := range t.HaltTasks() {
+				for _, pt := range providerTasks {
+					halted.WaitFor(pt)
+				}
+			}
+			t.Logf("Waiting for default content provider %q installed by the same change", name)
+			continue
+		}
+		// a provider being installed by another change gets its
+		// slots auto-connected once it is there
+		if err := CheckChangeConflict(st, name, nil); err != nil {
+			t.Logf("Skipping default content provider %q: %v", name, err)
+			continue
+		}
+		ts, err := Install(st, name, defaultProviderChannel, snap.R(0), snapsup.UserID, Flags{})
+		if err != nil {
+			return fmt.Errorf("cannot install default content provider %q for snap %q: %v", name, snapsup.Name(), err)
+		}
+		for _, lane := range t.Lanes() {
+			ts.JoinLane(lane)
+		}
+		// everything after this task, and in particular setting up
+		// the security profiles, waits for the provider
+		for _, halted := range t.HaltTasks() {
+			halted.WaitAll(ts)
+		}
+		chg.AddAll(ts)
+		t.Logf("Installing default content provider %q", name)
+	}
+
+	return nil
+}
+
+// snapTasksInChange returns the tasks of the change operating on the
+// given snap.
+func snapTasksInChange(chg *state.Change, snapName string) []*state.Task {
+	var tasks []*state.Task
+	for _, task := range chg.Tasks() {
+		snapsup, err := TaskSnapSetup(task)
+		if err != nil {
+			// not a snap task
+			continue
+		}
+		if snapsup.Name() == snapName {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
 func (m *SnapManager) undoUnlinkCurrentSnap(t *state.Task, _ *tomb.Tomb) error {
 	st := t.State()
 
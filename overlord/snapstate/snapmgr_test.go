@@ -27,12 +27,16 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapstate"
@@ -40,8 +44,10 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdelta"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
 
 	// So it registers Configure.
 	_ "github.com/snapcore/snapd/overlord/configstate"
@@ -58,6 +64,8 @@ type snapmgrTestSuite struct {
 
 	user *auth.UserState
 
+	automaticSnapshot func(*state.State, string) (*state.TaskSet, error)
+
 	reset func()
 }
 
@@ -105,12 +113,18 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
 		return nil, nil
 	}
+
+	s.automaticSnapshot = snapstate.AutomaticSnapshot
+	snapstate.AutomaticSnapshot = func(*state.State, string) (*state.TaskSet, error) {
+		return nil, nil
+	}
 }
 
 func (s *snapmgrTestSuite) TearDownTest(c *C) {
 	snapstate.ValidateRefreshes = nil
 	snapstate.AutoAliases = nil
 	snapstate.CanAutoRefresh = nil
+	snapstate.AutomaticSnapshot = s.automaticSnapshot
 	s.reset()
 }
 
@@ -150,8 +164,12 @@ func verifyInstallUpdateTasks(c *C, opts, discards int, ts *state.TaskSet, st *s
 		"validate-snap",
 		"mount-snap",
 	}
+	if opts&unlinkBefore == 0 {
+		expected = append(expected, "prerequisites")
+	}
 	if opts&unlinkBefore != 0 {
 		expected = append(expected,
+			"run-hook",
 			"stop-snap-services",
 			"remove-aliases",
 			"unlink-current-snap",
@@ -168,6 +186,7 @@ func verifyInstallUpdateTasks(c *C, opts, discards int, ts *state.TaskSet, st *s
 	expected = append(expected,
 		"set-auto-aliases",
 		"setup-aliases",
+		"run-hook",
 		"start-snap-services",
 	)
 	for i := 0; i < discards; i++ {
@@ -191,6 +210,7 @@ func verifyInstallUpdateTasks(c *C, opts, discards int, ts *state.TaskSet, st *s
 func verifyRemoveTasks(c *C, ts *state.TaskSet) {
 	c.Assert(taskKinds(ts.Tasks()), DeepEquals, []string{
 		"stop-snap-services",
+		"run-hook",
 		"remove-aliases",
 		"unlink-snap",
 		"remove-profiles",
@@ -428,6 +448,35 @@ func (s *snapmgrTestSuite) TestUpdateManyDevModeConfinementFiltering(c *C) {
 	c.Assert(tts, HasLen, 0)
 }
 
+func (s *snapmgrTestSuite) TestUpdateManyIgnoreValidation(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "app",
+		Flags:    snapstate.Flags{IgnoreValidation: true},
+	})
+
+	updates, _, err := snapstate.UpdateMany(s.state, []string{"some-snap"}, s.user.ID)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"some-snap"})
+
+	c.Assert(s.fakeBackend.ops, Not(HasLen), 0)
+	c.Check(s.fakeBackend.ops[0], DeepEquals, fakeOp{
+		op: "storesvc-snap-action",
+		curSnaps: []store.CurrentSnap{{
+			Name:             "some-snap",
+			SnapID:           "some-snap-id",
+			Revision:         snap.R(7),
+			Epoch:            snap.E("0"),
+			IgnoreValidation: true,
+		}},
+	})
+}
+
 func (s *snapmgrTestSuite) TestUpdateManyClassicConfinementFiltering(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -814,6 +863,154 @@ func (s *snapmgrTestSuite) TestInstallPathSnapIDRevisionUnset(c *C) {
 	c.Assert(err, ErrorMatches, fmt.Sprintf(`internal error: snap id set to install %q but revision is unset`, mockSnap))
 }
 
+func (s *snapmgrTestSuite) mockSnapDelta(c *C) (deltaPath, targetDigest string, targetSize uint64, restore func()) {
+	dirs.SetRootDir(c.MkDir())
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+	mockXdelta3 := testutil.MockCommand(c, "xdelta3", `if [ "$1" = "-e" ]; then cat "$5"; else cat; fi`)
+	restore = func() {
+		mockXdelta3.Restore()
+		dirs.SetRootDir("")
+	}
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+	c.Assert(ioutil.WriteFile(snap.MountFile("some-snap", snap.R(7)), []byte("rev 7"), 0644), IsNil)
+
+	dir := c.MkDir()
+	targetPath := filepath.Join(dir, "some-snap_8.snap")
+	c.Assert(ioutil.WriteFile(targetPath, []byte("rev 8"), 0644), IsNil)
+	deltaPath = filepath.Join(dir, "some-snap_7_8.delta")
+	c.Assert(snapdelta.Create(snap.MountFile("some-snap", snap.R(7)), targetPath, deltaPath), IsNil)
+
+	targetDigest, targetSize, err := asserts.SnapFileSHA3_384(targetPath)
+	c.Assert(err, IsNil)
+	return deltaPath, targetDigest, targetSize, restore
+}
+
+func (s *snapmgrTestSuite) TestInstallPathDelta(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	deltaPath, targetDigest, targetSize, restore := s.mockSnapDelta(c)
+	defer restore()
+
+	var crossChecked []interface{}
+	snapstate.CrossCheckSnap = func(st *state.State, name, snapSHA3_384 string, snapSize uint64, si *snap.SideInfo) error {
+		crossChecked = []interface{}{name, snapSHA3_384, snapSize, si.Revision}
+		return nil
+	}
+	defer func() { snapstate.CrossCheckSnap = nil }()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(8)}
+	ts, err := snapstate.InstallPath(s.state, si, deltaPath, "", snapstate.Flags{RemoveSnapPath: true})
+	c.Assert(err, IsNil)
+	c.Check(crossChecked, DeepEquals, []interface{}{"some-snap", targetDigest, targetSize, snap.R(8)})
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(filepath.Dir(snapsup.SnapPath), Equals, dirs.SnapBlobDir)
+	c.Check(snapsup.Flags.RemoveSnapPath, Equals, true)
+	content, err := ioutil.ReadFile(snapsup.SnapPath)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "rev 8")
+	// the delta itself is no longer needed
+	c.Check(osutil.FileExists(deltaPath), Equals, false)
+}
+
+func (s *snapmgrTestSuite) TestInstallPathDeltaSourceNotInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	deltaPath, _, _, restore := s.mockSnapDelta(c)
+	defer restore()
+	c.Assert(ioutil.WriteFile(snap.MountFile("some-snap", snap.R(7)), []byte("other rev 7"), 0644), IsNil)
+
+	si := &snap.SideInfo{RealName: "some-snap"}
+	_, err := snapstate.InstallPath(s.state, si, deltaPath, "", snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot install delta for snap "some-snap": the revision it was created from is not installed`)
+	c.Check(osutil.FileExists(deltaPath), Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestInstallPathDeltaCrossCheckFails(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	deltaPath, _, _, restore := s.mockSnapDelta(c)
+	defer restore()
+
+	snapstate.CrossCheckSnap = func(*state.State, string, string, uint64, *snap.SideInfo) error {
+		return fmt.Errorf("snap does not have expected ID or revision")
+	}
+	defer func() { snapstate.CrossCheckSnap = nil }()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(8)}
+	_, err := snapstate.InstallPath(s.state, si, deltaPath, "", snapstate.Flags{})
+	c.Assert(err, ErrorMatches, "snap does not have expected ID or revision")
+
+	// the reconstructed snap was removed
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, "snapd-delta-*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestInstallPathDeltaSkipsMissingMountFiles(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	deltaPath, _, _, restore := s.mockSnapDelta(c)
+	defer restore()
+
+	// revision 9 is the current one but its snap file is gone
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", Revision: snap.R(7)},
+			{RealName: "some-snap", Revision: snap.R(9)},
+		},
+		Current:  snap.R(9),
+		SnapType: "app",
+	})
+
+	si := &snap.SideInfo{RealName: "some-snap"}
+	ts, err := snapstate.InstallPath(s.state, si, deltaPath, "", snapstate.Flags{})
+	c.Assert(err, IsNil)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(snapsup.SnapPath)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "rev 8")
+}
+
+func (s *snapmgrTestSuite) TestDeltaSource(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	deltaPath, _, _, restore := s.mockSnapDelta(c)
+	defer restore()
+	snapstate.Set(s.state, "other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "other-snap", Revision: snap.R(2)}},
+		Current:  snap.R(2),
+		SnapType: "app",
+	})
+
+	hdr, err := snapdelta.ReadHeader(deltaPath)
+	c.Assert(err, IsNil)
+	name, rev, err := snapstate.DeltaSource(s.state, hdr)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "some-snap")
+	c.Check(rev, Equals, snap.R(7))
+
+	c.Assert(ioutil.WriteFile(snap.MountFile("some-snap", snap.R(7)), []byte("other rev 7"), 0644), IsNil)
+	_, _, err = snapstate.DeltaSource(s.state, hdr)
+	c.Assert(err, ErrorMatches, "cannot find the installed snap the delta was created from")
+}
+
 func (s *snapmgrTestSuite) TestUpdateTasksPropagatesErrors(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1065,13 +1262,69 @@ func (s *snapmgrTestSuite) TestRemoveTasks(c *C) {
 		Current: snap.R(11),
 	})
 
-	ts, err := snapstate.Remove(s.state, "foo", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "foo", snap.R(0), nil)
 	c.Assert(err, IsNil)
 
 	c.Assert(s.state.TaskCount(), Equals, len(ts.Tasks()))
 	verifyRemoveTasks(c, ts)
 }
 
+func (s *snapmgrTestSuite) TestRemoveAutomaticSnapshot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var snapshotted []string
+	snapstate.AutomaticSnapshot = func(st *state.State, snapName string) (*state.TaskSet, error) {
+		snapshotted = append(snapshotted, snapName)
+		return state.NewTaskSet(st.NewTask("save-snapshot", "...")), nil
+	}
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", Revision: snap.R(10)},
+			{RealName: "foo", Revision: snap.R(11)},
+		},
+		Current:  snap.R(11),
+		SnapType: "app",
+	})
+
+	// removing a single revision keeps the data around
+	ts, err := snapstate.Remove(s.state, "foo", snap.R(10), nil)
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, HasLen, 0)
+
+	// purging skips the snapshot
+	ts, err = snapstate.Remove(s.state, "foo", snap.R(0), &snapstate.RemoveFlags{Purge: true})
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, HasLen, 0)
+	c.Check(taskKinds(ts.Tasks()), Not(testutil.Contains), "save-snapshot")
+
+	ts, err = snapstate.Remove(s.state, "foo", snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(snapshotted, DeepEquals, []string{"foo"})
+
+	// the snapshot is taken once the snap is unlinked, and before
+	// anything is removed
+	c.Check(taskKinds(ts.Tasks()), DeepEquals, []string{
+		"stop-snap-services",
+		"run-hook",
+		"remove-aliases",
+		"unlink-snap",
+		"remove-profiles",
+		"save-snapshot",
+		"clear-snap",
+		"discard-snap",
+		"clear-snap",
+		"discard-snap",
+		"clear-aliases",
+		"discard-conns",
+	})
+	snapshot := ts.Tasks()[5]
+	c.Check(snapshot.WaitTasks(), DeepEquals, ts.Tasks()[:5])
+	c.Check(ts.Tasks()[6].WaitTasks(), DeepEquals, []*state.Task{snapshot})
+}
+
 func (s *snapmgrTestSuite) TestRemoveConflict(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1082,15 +1335,183 @@ func (s *snapmgrTestSuite) TestRemoveConflict(c *C) {
 		Current:  snap.R(11),
 	})
 
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	// need a change to make the tasks visible
 	s.state.NewChange("remove", "...").AddAll(ts)
 
-	_, err = snapstate.Remove(s.state, "some-snap", snap.R(0))
+	_, err = snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, ErrorMatches, `snap "some-snap" has changes in progress`)
 }
 
+func (s *snapmgrTestSuite) TestInstallWithDefaultProviderRunThrough(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("seeded", true)
+
+	chg := s.state.NewChange("install", "install a snap")
+	ts, err := snapstate.Install(s.state, "snap-content-plug", "stable", snap.R(42), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	// ensure all our tasks ran
+	c.Assert(chg.Err(), IsNil)
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(s.fakeStore.downloads, DeepEquals, []fakeDownload{{
+		macaroon: s.user.StoreMacaroon,
+		name:     "snap-content-plug",
+	}, {
+		macaroon: s.user.StoreMacaroon,
+		name:     "snap-content-slot",
+	}})
+
+	// the provider is installed as part of the same change
+	var snapst snapstate.SnapState
+	err = snapstate.Get(s.state, "snap-content-slot", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Channel, Equals, "stable")
+	c.Check(chg.Tasks(), HasLen, 2*len(ts.Tasks()))
+
+	// and the rest of the snap's installation, security profiles
+	// included, waits for the provider to be linked
+	var prereqs, providerLink, copyData *state.Task
+	for _, t := range chg.Tasks() {
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		if err != nil {
+			continue
+		}
+		switch {
+		case t.Kind() == "prerequisites" && snapsup.Name() == "snap-content-plug":
+			prereqs = t
+		case t.Kind() == "link-snap" && snapsup.Name() == "snap-content-slot":
+			providerLink = t
+		case t.Kind() == "copy-snap-data" && snapsup.Name() == "snap-content-plug":
+			copyData = t
+		}
+	}
+	c.Assert(prereqs, NotNil)
+	c.Assert(providerLink, NotNil)
+	c.Assert(copyData, NotNil)
+	c.Check(strings.Join(prereqs.Log(), ""), Matches, `.*Installing default content provider "snap-content-slot"`)
+	c.Check(copyData.WaitTasks(), testutil.Contains, providerLink)
+}
+
+func (s *snapmgrTestSuite) TestInstallWithDefaultProviderInSameChange(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("seeded", true)
+
+	// the provider is installed by the same change, as with InstallMany
+	chg := s.state.NewChange("install", "install snaps")
+	ts, err := snapstate.Install(s.state, "snap-content-plug", "stable", snap.R(42), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+	ts2, err := snapstate.Install(s.state, "snap-content-slot", "stable", snap.R(0), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts2)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(s.fakeStore.downloads, HasLen, 2)
+	c.Check(chg.Tasks(), HasLen, len(ts.Tasks())+len(ts2.Tasks()))
+
+	// the rest of the snap's installation waits for the provider
+	var prereqs, providerLink, copyData *state.Task
+	for _, t := range chg.Tasks() {
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		if err != nil {
+			continue
+		}
+		switch {
+		case t.Kind() == "prerequisites" && snapsup.Name() == "snap-content-plug":
+			prereqs = t
+		case t.Kind() == "link-snap" && snapsup.Name() == "snap-content-slot":
+			providerLink = t
+		case t.Kind() == "copy-snap-data" && snapsup.Name() == "snap-content-plug":
+			copyData = t
+		}
+	}
+	c.Assert(prereqs, NotNil)
+	c.Assert(providerLink, NotNil)
+	c.Assert(copyData, NotNil)
+	c.Check(strings.Join(prereqs.Log(), ""), Matches, `.*Waiting for default content provider "snap-content-slot" installed by the same change`)
+	c.Check(copyData.WaitTasks(), testutil.Contains, providerLink)
+}
+
+func (s *snapmgrTestSuite) TestInstallWithDefaultProviderInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("seeded", true)
+	snapstate.Set(s.state, "snap-content-slot", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "snap-content-slot", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	chg := s.state.NewChange("install", "install a snap")
+	ts, err := snapstate.Install(s.state, "snap-content-plug", "stable", snap.R(42), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Tasks(), HasLen, len(ts.Tasks()))
+	c.Check(s.fakeStore.downloads, HasLen, 1)
+}
+
+func (s *snapmgrTestSuite) TestInstallRemovesStalePartialDownloads(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+	stale := filepath.Join(dirs.SnapBlobDir, "some-snap_41.snap.partial")
+	current := filepath.Join(dirs.SnapBlobDir, "some-snap_42.snap.partial")
+	other := filepath.Join(dirs.SnapBlobDir, "some-other-snap_41.snap.partial")
+	for _, fn := range []string{stale, current, other} {
+		c.Assert(ioutil.WriteFile(fn, nil, 0644), IsNil)
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg := s.state.NewChange("install", "install a snap")
+	ts, err := snapstate.Install(s.state, "some-snap", "some-channel", snap.R(42), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(osutil.FileExists(stale), Equals, false)
+	// the fake store does not consume the partial download of the
+	// revision that is installed
+	c.Check(osutil.FileExists(current), Equals, true)
+	c.Check(osutil.FileExists(other), Equals, true)
+}
+
 func (s *snapmgrTestSuite) TestInstallRunThrough(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1195,7 +1616,7 @@ func (s *snapmgrTestSuite) TestInstallRunThrough(c *C) {
 	c.Check(task.Summary(), Equals, `Download snap "some-snap" (42) from channel "some-channel"`)
 
 	// check link/start snap summary
-	linkTask := ta[len(ta)-5]
+	linkTask := ta[len(ta)-6]
 	c.Check(linkTask.Summary(), Equals, `Make snap "some-snap" (42) available to the system`)
 	startTask := ta[len(ta)-2]
 	c.Check(startTask.Summary(), Equals, `Start snap "some-snap" (42) services`)
@@ -1266,12 +1687,20 @@ func (s *snapmgrTestSuite) TestUpdateRunThrough(c *C) {
 
 	expected := fakeOps{
 		{
-			op: "storesvc-list-refresh",
-			cand: store.RefreshCandidate{
-				Channel:  "some-channel",
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:     "some-snap",
 				SnapID:   "some-snap-id",
 				Revision: snap.R(7),
-				Epoch:    "",
+				Epoch:    snap.E("0"),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "some-channel",
 			},
 			revno: snap.R(11),
 		},
@@ -1440,12 +1869,20 @@ func (s *snapmgrTestSuite) TestUpdateUndoRunThrough(c *C) {
 
 	expected := fakeOps{
 		{
-			op: "storesvc-list-refresh",
-			cand: store.RefreshCandidate{
-				Channel:  "some-channel",
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:     "some-snap",
 				SnapID:   "some-snap-id",
 				Revision: snap.R(7),
-				Epoch:    "",
+				Epoch:    snap.E("0"),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "some-channel",
 			},
 			revno: snap.R(11),
 		},
@@ -1568,6 +2005,154 @@ func (s *snapmgrTestSuite) TestUpdateUndoRunThrough(c *C) {
 	})
 }
 
+func hookNames(c *C, ts *state.TaskSet) []string {
+	var hooks []string
+	for _, t := range ts.Tasks() {
+		if t.Kind() != "run-hook" {
+			continue
+		}
+		var hooksup struct {
+			Hook string `json:"hook"`
+		}
+		c.Assert(t.Get("hook-setup", &hooksup), IsNil)
+		hooks = append(hooks, hooksup.Hook)
+	}
+	return hooks
+}
+
+func (s *snapmgrTestSuite) TestInstallHooks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	ts, err := snapstate.Install(s.state, "some-snap", "some-channel", snap.R(0), 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	c.Check(hookNames(c, ts), DeepEquals, []string{"install", "configure"})
+}
+
+func (s *snapmgrTestSuite) TestUpdateHooks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	ts, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	c.Check(hookNames(c, ts), DeepEquals, []string{"pre-refresh", "post-refresh", "configure"})
+}
+
+func (s *snapmgrTestSuite) TestRemoveHooks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", Revision: snap.R(5)},
+			{RealName: "some-snap", Revision: snap.R(7)},
+		},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	// removing just an old revision does not run the remove hook
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(5), nil)
+	c.Assert(err, IsNil)
+	c.Check(hookNames(c, ts), HasLen, 0)
+
+	ts, err = snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
+	c.Assert(err, IsNil)
+	c.Check(hookNames(c, ts), DeepEquals, []string{"remove"})
+}
+
+func (s *snapmgrTestSuite) TestUpdatePostRefreshHookFailureUndoesRefresh(c *C) {
+	si := snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(7),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si},
+		Current:  si.Revision,
+		SnapType: "app",
+	})
+
+	s.snapmgr.AddAdhocTaskHandler("run-hook", func(t *state.Task, _ *tomb.Tomb) error {
+		st := t.State()
+		st.Lock()
+		defer st.Unlock()
+		var hooksup struct {
+			Hook string `json:"hook"`
+		}
+		if err := t.Get("hook-setup", &hooksup); err != nil {
+			return err
+		}
+		if hooksup.Hook == "post-refresh" {
+			return errors.New("post-refresh hook failed")
+		}
+		return nil
+	}, func(*state.Task, *tomb.Tomb) error {
+		return nil
+	})
+
+	chg := s.state.NewChange("refresh", "refresh a snap")
+	ts, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*post-refresh hook failed.*`)
+
+	c.Check(s.fakeBackend.ops.Ops(), DeepEquals, []string{
+		"storesvc-snap-action",
+		"storesvc-snap-action:action",
+		"storesvc-download",
+		"validate-snap:Doing",
+		"current",
+		"open-snap-file",
+		"setup-snap",
+		"stop-snap-services",
+		"remove-snap-aliases",
+		"unlink-snap",
+		"copy-data",
+		"setup-profiles:Doing",
+		"candidate",
+		"link-snap",
+		"update-aliases",
+		"matching-aliases",
+		"update-aliases",
+		"unlink-snap",
+		"setup-profiles:Undoing",
+		"undo-copy-snap-data",
+		"link-snap",
+		"update-aliases",
+		"start-snap-services",
+		"undo-setup-snap",
+	})
+
+	var snapst snapstate.SnapState
+	err = snapstate.Get(s.state, "some-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.Active, Equals, true)
+	c.Check(snapst.Current, Equals, snap.R(7))
+	c.Assert(snapst.Sequence, HasLen, 1)
+	c.Check(snapst.Sequence[0].Revision, Equals, snap.R(7))
+}
+
 func (s *snapmgrTestSuite) TestUpdateTotalUndoRunThrough(c *C) {
 	si := snap.SideInfo{
 		RealName: "some-snap",
@@ -1607,13 +2192,22 @@ func (s *snapmgrTestSuite) TestUpdateTotalUndoRunThrough(c *C) {
 	s.state.Lock()
 
 	expected := fakeOps{
-		{
-			op: "storesvc-list-refresh",
-			cand: store.RefreshCandidate{
-				Channel:  "some-channel",
-				SnapID:   "some-snap-id",
-				Revision: snap.R(7),
-				Epoch:    "",
+		{
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:            "some-snap",
+				SnapID:          "some-snap-id",
+				Revision:        snap.R(7),
+				TrackingChannel: "stable",
+				Epoch:           snap.E("0"),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "some-channel",
 			},
 			revno: snap.R(11),
 		},
@@ -1829,16 +2423,25 @@ func (s *snapmgrTestSuite) TestUpdateSameRevisionSwitchChannelRunThrough(c *C) {
 	s.state.Lock()
 
 	expected := fakeOps{
-		// we just expect the "storesvc-list-refresh" op, we
+		// we just expect the "storesvc-snap-action" ops, we
 		// don't have a fakeOp for switchChannel because it has
 		// not a backend method, it just manipulates the state
 		{
-			op: "storesvc-list-refresh",
-			cand: store.RefreshCandidate{
-				Channel:  "channel-for-7",
-				SnapID:   "some-snap-id",
-				Revision: snap.R(7),
-				Epoch:    "",
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:            "some-snap",
+				SnapID:          "some-snap-id",
+				Revision:        snap.R(7),
+				TrackingChannel: "other-channel",
+				Epoch:           snap.E("0"),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "channel-for-7",
 			},
 		},
 	}
@@ -1967,15 +2570,25 @@ func (s *snapmgrTestSuite) TestSingleUpdateBlockedRevision(c *C) {
 	_, err := snapstate.Update(s.state, "some-snap", "some-channel", snap.R(0), s.user.ID, snapstate.Flags{})
 	c.Assert(err, IsNil)
 
-	c.Assert(s.fakeBackend.ops, HasLen, 1)
-	c.Check(s.fakeBackend.ops[0], DeepEquals, fakeOp{
-		op:    "storesvc-list-refresh",
-		revno: snap.R(11),
-		cand: store.RefreshCandidate{
-			SnapID:   "some-snap-id",
-			Revision: snap.R(7),
-			Epoch:    "",
-			Channel:  "some-channel",
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops, DeepEquals, fakeOps{
+		{
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:     "some-snap",
+				SnapID:   "some-snap-id",
+				Revision: snap.R(7),
+				Epoch:    snap.E("0"),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "some-channel",
+			},
+			revno: snap.R(11),
 		},
 	})
 
@@ -2007,13 +2620,24 @@ func (s *snapmgrTestSuite) TestMultiUpdateBlockedRevision(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(updates, DeepEquals, []string{"some-snap"})
 
-	c.Assert(s.fakeBackend.ops, HasLen, 1)
-	c.Check(s.fakeBackend.ops[0], DeepEquals, fakeOp{
-		op:    "storesvc-list-refresh",
-		revno: snap.R(11),
-		cand: store.RefreshCandidate{
-			SnapID:   "some-snap-id",
-			Revision: snap.R(7),
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops, DeepEquals, fakeOps{
+		{
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:     "some-snap",
+				SnapID:   "some-snap-id",
+				Revision: snap.R(7),
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "refresh",
+				SnapID:  "some-snap-id",
+				Channel: "",
+			},
+			revno: snap.R(11),
 		},
 	})
 
@@ -2045,13 +2669,23 @@ func (s *snapmgrTestSuite) TestAllUpdateBlockedRevision(c *C) {
 	c.Check(err, IsNil)
 	c.Check(updates, HasLen, 0)
 
-	c.Assert(s.fakeBackend.ops, HasLen, 1)
-	c.Check(s.fakeBackend.ops[0], DeepEquals, fakeOp{
-		op: "storesvc-list-refresh",
-		cand: store.RefreshCandidate{
-			SnapID:   "some-snap-id",
-			Revision: snap.R(7),
-			Block:    []snap.Revision{snap.R(11)},
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops, DeepEquals, fakeOps{
+		{
+			op: "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{{
+				Name:     "some-snap",
+				SnapID:   "some-snap-id",
+				Revision: snap.R(7),
+				Block:    []snap.Revision{snap.R(11)},
+			}},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action: "refresh",
+				SnapID: "some-snap-id",
+			},
 		},
 	})
 
@@ -2310,7 +2944,7 @@ func (s *snapmgrTestSuite) TestUpdateOneAutoAliasesScenarios(c *C) {
 		}
 		if scenario.update {
 			first := tasks[j]
-			j += 14
+			j += 16
 			c.Check(first.Kind(), Equals, "download-snap")
 			wait := false
 			if expectedRetiring["other-snap"]["aliasA"] != "" {
@@ -2679,6 +3313,42 @@ version: 1.0`)
 	c.Assert(snapst.Required, Equals, true)
 }
 
+func (s *snapmgrTestSuite) TestRemoveRemovesPartialDownloads(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+	partial := filepath.Join(dirs.SnapBlobDir, "some-snap_8.snap.partial")
+	c.Assert(ioutil.WriteFile(partial, nil, 0644), IsNil)
+
+	si := snap.SideInfo{
+		RealName: "some-snap",
+		Revision: snap.R(7),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si},
+		Current:  si.Revision,
+		SnapType: "app",
+	})
+
+	chg := s.state.NewChange("remove", "remove a snap")
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.snapmgr.Stop()
+	s.settle()
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(osutil.FileExists(partial), Equals, false)
+}
+
 func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	si := snap.SideInfo{
 		RealName: "some-snap",
@@ -2696,7 +3366,7 @@ func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -2753,6 +3423,9 @@ func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	// verify snapSetup info
 	tasks := ts.Tasks()
 	for _, t := range tasks {
+		if t.Kind() == "run-hook" {
+			continue
+		}
 		snapsup, err := snapstate.TaskSnapSetup(t)
 		c.Assert(err, IsNil)
 
@@ -2807,7 +3480,7 @@ func (s *snapmgrTestSuite) TestRemoveWithManyRevisionsRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -2883,6 +3556,9 @@ func (s *snapmgrTestSuite) TestRemoveWithManyRevisionsRunThrough(c *C) {
 	revnos := []snap.Revision{{N: 7}, {N: 3}, {N: 5}}
 	whichRevno := 0
 	for _, t := range tasks {
+		if t.Kind() == "run-hook" {
+			continue
+		}
 		snapsup, err := snapstate.TaskSnapSetup(t)
 		c.Assert(err, IsNil)
 
@@ -2942,7 +3618,7 @@ func (s *snapmgrTestSuite) TestRemoveOneRevisionRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(3))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(3), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -2970,6 +3646,9 @@ func (s *snapmgrTestSuite) TestRemoveOneRevisionRunThrough(c *C) {
 	// verify snapSetup info
 	tasks := ts.Tasks()
 	for _, t := range tasks {
+		if t.Kind() == "run-hook" {
+			continue
+		}
 		snapsup, err := snapstate.TaskSnapSetup(t)
 		c.Assert(err, IsNil)
 
@@ -3007,7 +3686,7 @@ func (s *snapmgrTestSuite) TestRemoveLastRevisionRunThrough(c *C) {
 	})
 
 	chg := s.state.NewChange("remove", "remove a snap")
-	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 	c.Assert(err, IsNil)
 	chg.AddAll(ts)
 
@@ -3047,6 +3726,9 @@ func (s *snapmgrTestSuite) TestRemoveLastRevisionRunThrough(c *C) {
 	// verify snapSetup info
 	tasks := ts.Tasks()
 	for _, t := range tasks {
+		if t.Kind() == "run-hook" {
+			continue
+		}
 		snapsup, err := snapstate.TaskSnapSetup(t)
 		c.Assert(err, IsNil)
 
@@ -3084,7 +3766,7 @@ func (s *snapmgrTestSuite) TestRemoveCurrentActiveRevisionRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 
 	c.Check(err, ErrorMatches, `cannot remove active revision 2 of snap "some-snap"`)
 }
@@ -3105,7 +3787,7 @@ func (s *snapmgrTestSuite) TestRemoveCurrentRevisionOfSeveralRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(2), nil)
 	c.Assert(err, NotNil)
 	c.Check(err.Error(), Equals, `cannot remove active revision 2 of snap "some-snap" (revert first?)`)
 }
@@ -3126,7 +3808,7 @@ func (s *snapmgrTestSuite) TestRemoveMissingRevisionRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "some-snap", snap.R(1))
+	_, err := snapstate.Remove(s.state, "some-snap", snap.R(1), nil)
 
 	c.Check(err, ErrorMatches, `revision 1 of snap "some-snap" is not installed`)
 }
@@ -3147,7 +3829,7 @@ func (s *snapmgrTestSuite) TestRemoveRefused(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "gadget", snap.R(0))
+	_, err := snapstate.Remove(s.state, "gadget", snap.R(0), nil)
 
 	c.Check(err, ErrorMatches, `snap "gadget" is not removable`)
 }
@@ -3168,7 +3850,7 @@ func (s *snapmgrTestSuite) TestRemoveRefusedLastRevision(c *C) {
 		SnapType: "app",
 	})
 
-	_, err := snapstate.Remove(s.state, "gadget", snap.R(7))
+	_, err := snapstate.Remove(s.state, "gadget", snap.R(7), nil)
 
 	c.Check(err, ErrorMatches, `snap "gadget" is not removable`)
 }
@@ -3328,6 +4010,40 @@ func (s *snapmgrTestSuite) TestRevertToRevisionAlreadyCurrent(c *C) {
 	c.Assert(ts, IsNil)
 }
 
+func (s *snapmgrTestSuite) TestRevertToRevisionIncompatibleEpoch(c *C) {
+	si := snap.SideInfo{
+		RealName: "epoch-snap",
+		Revision: snap.R(1),
+	}
+	si2 := snap.SideInfo{
+		RealName: "epoch-snap",
+		Revision: snap.R(2),
+	}
+	si3 := snap.SideInfo{
+		RealName: "epoch-snap",
+		Revision: snap.R(3),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "epoch-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si, &si2, &si3},
+		Current:  snap.R(3),
+		SnapType: "app",
+	})
+
+	ts, err := snapstate.RevertToRevision(s.state, "epoch-snap", snap.R(1), snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot revert "epoch-snap" to revision 1 with epoch 1\*, because it cannot read the data of the current epoch 3\*`)
+	c.Assert(ts, IsNil)
+
+	// 3* writes epoch 3, which 2* can't read
+	ts, err = snapstate.Revert(s.state, "epoch-snap", snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot revert "epoch-snap" to revision 2 with epoch 2\*, because it cannot read the data of the current epoch 3\*`)
+	c.Assert(ts, IsNil)
+}
+
 func (s *snapmgrTestSuite) TestRevertRunThrough(c *C) {
 	si := snap.SideInfo{
 		RealName: "some-snap",
@@ -4051,6 +4767,7 @@ link-snap: Error
  ERROR fail
 set-auto-aliases: Hold
 setup-aliases: Hold
+run-hook: Hold
 start-snap-services: Hold
 cleanup: Hold
 run-hook: Hold`)
@@ -4064,6 +4781,7 @@ link-snap: Error
  ERROR fail
 set-auto-aliases: Hold
 setup-aliases: Hold
+run-hook: Hold
 start-snap-services: Hold
 cleanup: Hold
 run-hook: Hold`)
@@ -4142,6 +4860,7 @@ func (s *snapmgrTestSuite) TestEnsureRefreshesWithUpdate(c *C) {
 	c.Check(s.state.Changes(), HasLen, 1)
 	chg := s.state.Changes()[0]
 	c.Check(chg.Kind(), Equals, "auto-refresh")
+	c.Check(chg.Priority(), Equals, state.BackgroundPriority)
 	c.Check(chg.IsReady(), Equals, false)
 	s.verifyRefreshLast(c)
 }
@@ -4285,6 +5004,10 @@ func (s *snapmgrTestSuite) TestEnsureRefreshesWithUpdateStoreError(c *C) {
 	s.state.Lock()
 	c.Check(s.state.Changes(), HasLen, 0)
 	c.Check(autoRefreshAssertionsCalled, Equals, 1)
+	// and a warning was recorded
+	warnings := s.state.AllWarnings()
+	c.Assert(warnings, HasLen, 1)
+	c.Check(warnings[0].String(), Equals, "cannot refresh snaps automatically: simulate store error")
 
 	// run Ensure() again and check that AutoRefresh() did not run
 	// again because to test that lastRefreshAttempt backoff is working
@@ -4295,6 +5018,175 @@ func (s *snapmgrTestSuite) TestEnsureRefreshesWithUpdateStoreError(c *C) {
 	c.Check(autoRefreshAssertionsCalled, Equals, 1)
 }
 
+func (s *snapmgrTestSuite) TestEnsureRefreshesHonorsSchedule(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.last", time.Now())
+	tr.Set("core", "refresh.schedule", "00:00-23:59")
+	tr.Commit()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	// the window for today was used already
+	c.Check(s.state.Changes(), HasLen, 0)
+
+	schedule, next, err := s.snapmgr.RefreshSchedule()
+	c.Assert(err, IsNil)
+	c.Check(schedule, Equals, "00:00-23:59")
+	c.Check(next.After(time.Now()), Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestRefreshScheduleDefault(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.last", time.Now())
+	// invalid schedules are ignored
+	tr.Set("core", "refresh.schedule", "invalid")
+	tr.Commit()
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	schedule, next, err := s.snapmgr.RefreshSchedule()
+	c.Assert(err, IsNil)
+	c.Check(schedule, Equals, "00:00-04:59/5:00-10:59/11:00-16:59/17:00-23:59")
+	c.Check(next.After(time.Now()), Equals, true)
+	c.Check(next.Before(time.Now().Add(12*time.Hour)), Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestEnsureRefreshesHold(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.last", time.Time{})
+	tr.Set("core", "refresh.hold", time.Now().Add(time.Hour).Format(time.RFC3339))
+	tr.Commit()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 0)
+
+	// once the hold is over the refresh happens
+	tr = config.NewTransaction(s.state)
+	tr.Set("core", "refresh.hold", time.Now().Add(-time.Minute).Format(time.RFC3339))
+	tr.Commit()
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 1)
+	s.verifyRefreshLast(c)
+}
+
+func (s *snapmgrTestSuite) TestEnsureRefreshesHoldOutsideSchedule(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	// a window that does not include now
+	schedule := "13:00-14:00"
+	if time.Now().Hour() >= 12 {
+		schedule = "1:00-2:00"
+	}
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.last", time.Time{})
+	tr.Set("core", "refresh.schedule", schedule)
+	tr.Set("core", "refresh.hold", time.Now().Add(-time.Minute).Format(time.RFC3339))
+	tr.Commit()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	// the hold is over but the refresh waits for the next window
+	c.Check(s.state.Changes(), HasLen, 0)
+
+	_, next, err := s.snapmgr.RefreshSchedule()
+	c.Assert(err, IsNil)
+	c.Check(next.After(time.Now()), Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestEnsureRefreshesHoldOnMetered(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+
+	metered := true
+	restore := snapstate.MockIsOnMeteredConnection(func() (bool, error) {
+		return metered, nil
+	})
+	defer restore()
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "refresh.last", time.Time{})
+	tr.Set("core", "refresh.metered", "hold")
+	tr.Commit()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 0)
+
+	metered = false
+	s.state.Unlock()
+	s.snapmgr.Ensure()
+	s.state.Lock()
+
+	c.Check(s.state.Changes(), HasLen, 1)
+}
+
 type snapmgrQuerySuite struct {
 	st *state.State
 }
@@ -4655,12 +5547,14 @@ func (s *snapmgrTestSuite) testTrySetsTryMode(flags snapstate.Flags, c *C) {
 	c.Check(taskKinds(ts.Tasks()), DeepEquals, []string{
 		"prepare-snap",
 		"mount-snap",
+		"prerequisites",
 		"copy-snap-data",
 		"setup-profiles",
 		"link-snap",
 		"setup-profiles",
 		"set-auto-aliases",
 		"setup-aliases",
+		"run-hook",
 		"start-snap-services",
 		"run-hook",
 	})
@@ -5310,7 +6204,7 @@ func (s *snapmgrTestSuite) TestInstallMany(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
 
-	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "two"}, 0)
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "two"}, "", 0, snapstate.Flags{})
 	c.Assert(err, IsNil)
 	c.Assert(tts, HasLen, 2)
 	c.Check(installed, DeepEquals, []string{"one", "two"})
@@ -5318,6 +6212,62 @@ func (s *snapmgrTestSuite) TestInstallMany(c *C) {
 	for _, ts := range tts {
 		verifyInstallUpdateTasks(c, 0, 0, ts, s.state)
 	}
+
+	// the store was asked only once
+	c.Check(s.fakeBackend.ops, DeepEquals, fakeOps{
+		{
+			op:       "storesvc-snap-action",
+			curSnaps: []store.CurrentSnap{},
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "install",
+				Name:    "one",
+				Channel: "stable",
+			},
+			revno: snap.R(11),
+		},
+		{
+			op: "storesvc-snap-action:action",
+			action: store.SnapAction{
+				Action:  "install",
+				Name:    "two",
+				Channel: "stable",
+			},
+			revno: snap.R(11),
+		},
+	})
+}
+
+func (s *snapmgrTestSuite) TestInstallManySkipsInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "one", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "one", SnapID: "one-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "two"}, "", 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 1)
+	c.Check(installed, DeepEquals, []string{"two"})
+	c.Check(s.fakeBackend.ops.Count("storesvc-snap-action:action"), Equals, 1)
+}
+
+func (s *snapmgrTestSuite) TestInstallManyNotInStore(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "not-in-store"}, "", 0, snapstate.Flags{})
+	c.Assert(err, Equals, store.ErrSnapNotFound)
+	c.Check(installed, IsNil)
+	c.Check(tts, IsNil)
 }
 
 func (s *snapmgrTestSuite) TestRemoveMany(c *C) {
@@ -5339,15 +6289,16 @@ func (s *snapmgrTestSuite) TestRemoveMany(c *C) {
 		Current: snap.R(1),
 	})
 
-	removed, tts, err := snapstate.RemoveMany(s.state, []string{"one", "two"})
+	removed, tts, err := snapstate.RemoveMany(s.state, []string{"one", "two"}, nil)
 	c.Assert(err, IsNil)
 	c.Assert(tts, HasLen, 2)
 	c.Check(removed, DeepEquals, []string{"one", "two"})
 
-	c.Assert(s.state.TaskCount(), Equals, 8*2)
+	c.Assert(s.state.TaskCount(), Equals, 9*2)
 	for _, ts := range tts {
 		c.Assert(taskKinds(ts.Tasks()), DeepEquals, []string{
 			"stop-snap-services",
+			"run-hook",
 			"remove-aliases",
 			"unlink-snap",
 			"remove-profiles",
@@ -23,16 +23,23 @@ package snapstate
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"sort"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/i18n/dumb"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdelta"
 	"github.com/snapcore/snapd/store"
 )
 
@@ -105,7 +112,21 @@ func doInstall(st *state.State, snapst *SnapState, snapsup *SnapSetup, flags int
 		prev = mount
 	}
 
+	// install the default providers of the content plugs, so that
+	// they can be auto-connected when setting up security
+	if !snapst.HasCurrent() {
+		prereqs := st.NewTask("prerequisites", fmt.Sprintf(i18n.G("Ensure prerequisites for snap %q are available"), snapsup.Name()))
+		addTask(prereqs)
+		prev = prereqs
+	}
+
 	if snapst.Active {
+		if !snapsup.Flags.Revert {
+			preRefreshHook := SetupPreRefreshHook(st, snapsup.Name())
+			addTask(preRefreshHook)
+			prev = preRefreshHook
+		}
+
 		// unlink-current-snap (will stop services for copy-data)
 		stop := st.NewTask("stop-snap-services", fmt.Sprintf(i18n.G("Stop snap %q services"), snapsup.Name()))
 		addTask(stop)
@@ -154,6 +175,19 @@ func doInstall(st *state.State, snapst *SnapState, snapsup *SnapSetup, flags int
 	addTask(setupAliases)
 	prev = setupAliases
 
+	// run refresh hook when updating an existing snap, otherwise run
+	// the install hook
+	if snapst.HasCurrent() && !snapsup.Flags.Revert {
+		postRefreshHook := SetupPostRefreshHook(st, snapsup.Name())
+		addTask(postRefreshHook)
+		prev = postRefreshHook
+	}
+	if !snapst.HasCurrent() {
+		installHook := SetupInstallHook(st, snapsup.Name())
+		addTask(installHook)
+		prev = installHook
+	}
+
 	// run new serices
 	startSnapServices := st.NewTask("start-snap-services", fmt.Sprintf(i18n.G("Start snap %q%s services"), snapsup.Name(), revisionStr))
 	addTask(startSnapServices)
@@ -236,11 +270,45 @@ var Configure = func(st *state.State, snapName string, patch map[string]interfac
 	panic("internal error: snapstate.Configure is unset")
 }
 
+var SetupInstallHook = func(st *state.State, snapName string) *state.Task {
+	panic("internal error: snapstate.SetupInstallHook is unset")
+}
+
+var SetupPreRefreshHook = func(st *state.State, snapName string) *state.Task {
+	panic("internal error: snapstate.SetupPreRefreshHook is unset")
+}
+
+var SetupPostRefreshHook = func(st *state.State, snapName string) *state.Task {
+	panic("internal error: snapstate.SetupPostRefreshHook is unset")
+}
+
+var SetupRemoveHook = func(st *state.State, snapName string) *state.Task {
+	panic("internal error: snapstate.SetupRemoveHook is unset")
+}
+
+// AutomaticSnapshot returns a task set for saving a snapshot of the data
+// of the given snap before it gets removed, or nil if there is nothing
+// to save.
+var AutomaticSnapshot = func(st *state.State, snapName string) (*state.TaskSet, error) {
+	panic("internal error: snapstate.AutomaticSnapshot is unset")
+}
+
 // CheckChangeConflict ensures that for the given snapName no other
 // changes that alters the snap (like remove, install, refresh) are in
 // progress. It also ensures that snapst (if not nil) did not get
 // modified. If a conflict is detected an error is returned.
 func CheckChangeConflict(st *state.State, snapName string, snapst *SnapState) error {
+	return checkChangeConflict(st, snapName, snapst, "")
+}
+
+// CheckChangeConflictIgnoringChange is like CheckChangeConflict but
+// disregards the tasks of the change with the given ID, for example
+// the change of a hook asking for an operation on its own snap.
+func CheckChangeConflictIgnoringChange(st *state.State, snapName string, snapst *SnapState, ignoreChangeID string) error {
+	return checkChangeConflict(st, snapName, snapst, ignoreChangeID)
+}
+
+func checkChangeConflict(st *state.State, snapName string, snapst *SnapState, ignoreChangeID string) error {
 	for _, chg := range st.Changes() {
 		if chg.Status().Ready() {
 			continue
@@ -253,6 +321,9 @@ func CheckChangeConflict(st *state.State, snapName string, snapst *SnapState) er
 	for _, task := range st.Tasks() {
 		k := task.Kind()
 		chg := task.Change()
+		if chg != nil && chg.ID() == ignoreChangeID {
+			continue
+		}
 		if (k == "link-snap" || k == "unlink-snap" || k == "alias") && (chg == nil || !chg.Status().Ready()) {
 			snapsup, err := TaskSnapSetup(task)
 			if err != nil {
@@ -290,6 +361,8 @@ func CheckChangeConflict(st *state.State, snapName string, snapst *SnapState) er
 // The provided SideInfo can contain just a name which results in a
 // local revision and sideloading, or full metadata in which case it
 // the snap will appear as installed from the store.
+// If path is a snap delta, the state is unlocked while the snap is
+// reconstructed from the installed revision the delta was created from.
 func InstallPath(st *state.State, si *snap.SideInfo, path, channel string, flags Flags) (*state.TaskSet, error) {
 	name := si.RealName
 	if name == "" {
@@ -308,6 +381,27 @@ func InstallPath(st *state.State, si *snap.SideInfo, path, channel string, flags
 		}
 	}
 
+	hdr, err := snapdelta.ReadHeader(path)
+	if err != nil && err != snapdelta.ErrNotDelta && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if hdr != nil {
+		// path is a delta, install the snap reconstructed from it
+		// instead; the state lock is released meanwhile, doInstall
+		// checks below that snapst did not change
+		snapPath, err := applySnapDelta(st, &snapst, si, path, hdr)
+		if err != nil {
+			return nil, err
+		}
+		if flags.RemoveSnapPath {
+			if err := os.Remove(path); err != nil {
+				logger.Noticef("Failed to cleanup %s: %s", path, err)
+			}
+		}
+		path = snapPath
+		flags.RemoveSnapPath = true
+	}
+
 	snapsup := &SnapSetup{
 		SideInfo: si,
 		SnapPath: path,
@@ -315,7 +409,114 @@ func InstallPath(st *state.State, si *snap.SideInfo, path, channel string, flags
 		Flags:    flags.ForSnapSetup(),
 	}
 
-	return doInstall(st, &snapst, snapsup, maybeCore)
+	ts, err := doInstall(st, &snapst, snapsup, maybeCore)
+	if err != nil && hdr != nil {
+		os.Remove(path)
+	}
+	return ts, err
+}
+
+// CrossCheckSnap allows to hook cross-checking a snap file
+// reconstructed from a delta against its snap-revision and
+// snap-declaration assertions.
+var CrossCheckSnap func(st *state.State, name, snapSHA3_384 string, snapSize uint64, si *snap.SideInfo) error
+
+// findDeltaSource returns the first of the given snap revisions whose
+// mount file has the given digest, or nil if there is none. Missing
+// mount files are skipped. The state lock, held by the caller, is
+// released while hashing the files.
+func findDeltaSource(st *state.State, candidates []*snap.SideInfo, sourceSHA3_384 string) (*snap.SideInfo, error) {
+	st.Unlock()
+	defer st.Lock()
+
+	for _, si := range candidates {
+		mountFile := snap.MountFile(si.RealName, si.Revision)
+		if !osutil.FileExists(mountFile) {
+			continue
+		}
+		digest, _, err := asserts.SnapFileSHA3_384(mountFile)
+		if err != nil {
+			return nil, err
+		}
+		if digest == sourceSHA3_384 {
+			return si, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeltaSource returns the name and revision of the installed snap the
+// delta described by hdr was created from.
+// Note that the state must be locked by the caller, it is released
+// while hashing the installed snaps.
+func DeltaSource(st *state.State, hdr *snapdelta.Header) (string, snap.Revision, error) {
+	snapStates, err := All(st)
+	if err != nil {
+		return "", snap.R(0), err
+	}
+	var candidates []*snap.SideInfo
+	for _, snapst := range snapStates {
+		for i := len(snapst.Sequence) - 1; i >= 0; i-- {
+			candidates = append(candidates, snapst.Sequence[i])
+		}
+	}
+
+	source, err := findDeltaSource(st, candidates, hdr.SourceSHA3_384)
+	if err != nil {
+		return "", snap.R(0), err
+	}
+	if source == nil {
+		return "", snap.R(0), fmt.Errorf("cannot find the installed snap the delta was created from")
+	}
+	return source.RealName, source.Revision, nil
+}
+
+// applySnapDelta reconstructs the snap described by the delta at
+// deltaPath from the installed revision the delta was created from.
+// It returns the path of the reconstructed snap, verified against the
+// delta and, if si is asserted, against the assertions.
+// The state lock, held by the caller, is released while looking for
+// the source revision and applying the delta.
+func applySnapDelta(st *state.State, snapst *SnapState, si *snap.SideInfo, deltaPath string, hdr *snapdelta.Header) (string, error) {
+	name := si.RealName
+	if si.SnapID != "" && CrossCheckSnap == nil {
+		return "", fmt.Errorf("internal error: cannot cross-check snap %q reconstructed from delta", name)
+	}
+
+	candidates := make([]*snap.SideInfo, 0, len(snapst.Sequence))
+	for i := len(snapst.Sequence) - 1; i >= 0; i-- {
+		candidates = append(candidates, snapst.Sequence[i])
+	}
+	source, err := findDeltaSource(st, candidates, hdr.SourceSHA3_384)
+	if err != nil {
+		return "", err
+	}
+	if source == nil {
+		return "", fmt.Errorf("cannot install delta for snap %q: the revision it was created from is not installed", name)
+	}
+
+	f, err := ioutil.TempFile(dirs.SnapBlobDir, "snapd-delta-")
+	if err != nil {
+		return "", err
+	}
+	snapPath := f.Name()
+	f.Close()
+
+	st.Unlock()
+	_, err = snapdelta.Apply(snap.MountFile(name, source.Revision), deltaPath, snapPath)
+	st.Lock()
+	if err != nil {
+		os.Remove(snapPath)
+		return "", err
+	}
+	if si.SnapID != "" {
+		if err := CrossCheckSnap(st, name, hdr.TargetSHA3_384, hdr.TargetSize, si); err != nil {
+			os.Remove(snapPath)
+			return "", err
+		}
+	}
+
+	return snapPath, nil
 }
 
 // TryPath returns a set of tasks for trying a snap from a file path.
@@ -342,12 +543,25 @@ func Install(st *state.State, name, channel string, revision snap.Revision, user
 		return nil, &snap.AlreadyInstalledError{Snap: name}
 	}
 
+	if !flags.IgnoreValidation {
+		revision, err = validationSetsRevision(st, name, revision)
+		if err != nil {
+			return nil, fmt.Errorf("cannot install: %v", err)
+		}
+	}
+
 	info, err := snapInfo(st, name, channel, revision, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := validateInfoAndFlags(info, &snapst, flags); err != nil {
+	return installInfo(st, &snapst, info, channel, userID, flags)
+}
+
+// installInfo returns a set of tasks for installing the snap described
+// by info, as obtained from the store for the given channel.
+func installInfo(st *state.State, snapst *SnapState, info *snap.Info, channel string, userID int, flags Flags) (*state.TaskSet, error) {
+	if err := validateInfoAndFlags(info, snapst, flags); err != nil {
 		return nil, err
 	}
 
@@ -359,24 +573,89 @@ func Install(st *state.State, name, channel string, revision snap.Revision, user
 		SideInfo:     &info.SideInfo,
 	}
 
-	return doInstall(st, &snapst, snapsup, needsMaybeCore(info.Type))
+	return doInstall(st, snapst, snapsup, needsMaybeCore(info.Type))
 }
 
-// InstallMany installs everything from the given list of names.
+// InstallMany installs everything from the given list of names, from
+// the given channel and with the given flags.
 // Note that the state must be locked by the caller.
-func InstallMany(st *state.State, names []string, userID int) ([]string, []*state.TaskSet, error) {
+func InstallMany(st *state.State, names []string, channel string, userID int, flags Flags) ([]string, []*state.TaskSet, error) {
+	if channel == "" {
+		channel = "stable"
+	}
+
+	user, err := userFromUserID(st, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	installed := make([]string, 0, len(names))
 	tasksets := make([]*state.TaskSet, 0, len(names))
+
+	snapStates := make(map[string]*SnapState, len(names))
+	actions := make([]*store.SnapAction, 0, len(names))
 	for _, name := range names {
-		ts, err := Install(st, name, "", snap.R(0), userID, Flags{})
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err != nil && err != state.ErrNoState {
+			return nil, nil, err
+		}
 		// FIXME: is this expected behavior?
-		if _, ok := err.(*snap.AlreadyInstalledError); ok {
+		if snapst.HasCurrent() {
 			continue
 		}
+
+		revision := snap.R(0)
+		if !flags.IgnoreValidation {
+			revision, err = validationSetsRevision(st, name, revision)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot install: %v", err)
+			}
+		}
+
+		snapStates[name] = &snapst
+		actions = append(actions, &store.SnapAction{
+			Action:   "install",
+			Name:     name,
+			Channel:  channel,
+			Revision: revision,
+		})
+	}
+
+	if len(actions) == 0 {
+		return installed, tasksets, nil
+	}
+
+	theStore := Store(st)
+	st.Unlock() // calls to the store should be done without holding the state lock
+	infos, err := theStore.SnapAction(nil, actions, user)
+	st.Lock()
+	if saErr, ok := err.(*store.SnapActionError); ok && len(saErr.Other) == 0 {
+		for _, action := range actions {
+			if installErr := saErr.Install[action.Name]; installErr != nil {
+				return nil, nil, installErr
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infoByName := make(map[string]*snap.Info, len(infos))
+	for _, info := range infos {
+		infoByName[info.Name()] = info
+	}
+
+	for _, action := range actions {
+		info := infoByName[action.Name]
+		if info == nil {
+			return nil, nil, fmt.Errorf("cannot install snap %q: no information from the store", action.Name)
+		}
+		ts, err := installInfo(st, snapStates[action.Name], info, channel, userID, flags)
 		if err != nil {
 			return nil, nil, err
 		}
-		installed = append(installed, name)
+		installed = append(installed, action.Name)
 		tasksets = append(tasksets, ts)
 	}
 
@@ -410,7 +689,8 @@ func refreshCandidates(st *state.State, names []string, user *auth.UserState) ([
 	sort.Strings(names)
 
 	stateByID := make(map[string]*SnapState, len(snapStates))
-	candidatesInfo := make([]*store.RefreshCandidate, 0, len(snapStates))
+	curSnaps := make([]*store.CurrentSnap, 0, len(snapStates))
+	actions := make([]*store.SnapAction, 0, len(snapStates))
 	for _, snapst := range snapStates {
 		if len(names) == 0 && (snapst.TryMode || snapst.DevMode) {
 			// no auto-refresh for trymode nor devmode
@@ -440,27 +720,47 @@ func refreshCandidates(st *state.State, names []string, user *auth.UserState) ([
 
 		stateByID[snapInfo.SnapID] = snapst
 
-		// get confinement preference from the snapstate
-		candidateInfo := &store.RefreshCandidate{
-			// the desired channel (not info.Channel!)
-			Channel:  snapst.Channel,
-			SnapID:   snapInfo.SnapID,
-			Revision: snapInfo.Revision,
-			Epoch:    snapInfo.Epoch,
+		curSnap := &store.CurrentSnap{
+			Name:             snapInfo.Name(),
+			SnapID:           snapInfo.SnapID,
+			Revision:         snapInfo.Revision,
+			TrackingChannel:  snapst.Channel,
+			Epoch:            snapInfo.Epoch,
+			IgnoreValidation: snapst.IgnoreValidation,
 		}
 
 		if len(names) == 0 {
-			candidateInfo.Block = snapst.Block()
+			curSnap.Block = snapst.Block()
 		}
 
-		candidatesInfo = append(candidatesInfo, candidateInfo)
+		curSnaps = append(curSnaps, curSnap)
+		actions = append(actions, &store.SnapAction{
+			Action: "refresh",
+			SnapID: snapInfo.SnapID,
+			// the desired channel (not info.Channel!)
+			Channel: snapst.Channel,
+		})
+	}
+
+	if len(actions) == 0 {
+		return nil, stateByID, nil
 	}
 
 	theStore := Store(st)
 
 	st.Unlock()
-	updates, err := theStore.ListRefresh(candidatesInfo, user)
+	updates, err := theStore.SnapAction(curSnaps, actions, user)
 	st.Lock()
+	if saErr, ok := err.(*store.SnapActionError); ok && len(saErr.Other) == 0 {
+		// snaps without updates are not a problem, others
+		// failing should not prevent refreshing the rest
+		for name, refreshErr := range saErr.Refresh {
+			if refreshErr != store.ErrNoUpdateAvailable {
+				logger.Noticef("cannot refresh snap %q: %v", name, refreshErr)
+			}
+		}
+		err = nil
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -471,6 +771,34 @@ func refreshCandidates(st *state.State, names []string, user *auth.UserState) ([
 // ValidateRefreshes allows to hook validation into the handling of refresh candidates.
 var ValidateRefreshes func(st *state.State, refreshes []*snap.Info, userID int) (validated []*snap.Info, err error)
 
+// TrackedValidationSets allows to hook getting the validation sets
+// tracked by the system into snapstate.
+var TrackedValidationSets func(st *state.State) (*snapasserts.ValidationSets, error)
+
+func trackedValidationSets(st *state.State) (*snapasserts.ValidationSets, error) {
+	if TrackedValidationSets == nil {
+		return snapasserts.NewValidationSets(), nil
+	}
+	return TrackedValidationSets(st)
+}
+
+// validationSetsRevision checks the given revision of the snap against
+// the tracked validation sets and returns the revision to use, which is
+// the pinned one if revision is unset and the snap is pinned.
+func validationSetsRevision(st *state.State, name string, revision snap.Revision) (snap.Revision, error) {
+	valsets, err := trackedValidationSets(st)
+	if err != nil {
+		return revision, err
+	}
+	if err := valsets.CheckInstall(name, revision); err != nil {
+		return revision, err
+	}
+	if c := valsets.Constraints(name); c != nil && revision.Unset() {
+		revision = c.Revision
+	}
+	return revision, nil
+}
+
 // UpdateMany updates everything from the given list of names that the
 // store says is updateable. If the list is empty, update everything.
 // Note that the state must be locked by the caller.
@@ -497,6 +825,25 @@ func UpdateMany(st *state.State, names []string, userID int) ([]string, []*state
 		}
 	}
 
+	if len(updates) != 0 {
+		valsets, err := trackedValidationSets(st)
+		if err != nil {
+			return nil, nil, err
+		}
+		allowed := updates[:0]
+		for _, update := range updates {
+			if err := valsets.CheckInstall(update.Name(), update.Revision); err != nil {
+				if len(names) != 0 {
+					return nil, nil, fmt.Errorf("cannot refresh: %v", err)
+				}
+				logger.Noticef("cannot refresh snap %q: %v", update.Name(), err)
+				continue
+			}
+			allowed = append(allowed, update)
+		}
+		updates = allowed
+	}
+
 	params := func(update *snap.Info) (string, Flags, *SnapState) {
 		snapst := stateByID[update.SnapID]
 		return snapst.Channel, snapst.Flags, snapst
@@ -723,7 +1070,22 @@ func Update(st *state.State, name, channel string, revision snap.Revision, userI
 	}
 
 	var updates []*snap.Info
-	info, infoErr := infoForUpdate(st, &snapst, name, channel, revision, userID, flags)
+	var info *snap.Info
+	var infoErr error
+	if !flags.IgnoreValidation {
+		pinned, err := validationSetsRevision(st, name, revision)
+		if err != nil {
+			return nil, fmt.Errorf("cannot refresh: %v", err)
+		}
+		if revision.Unset() && !pinned.Unset() && pinned == snapst.Current {
+			// already at the pinned revision
+			infoErr = &snap.NoUpdateAvailableError{Snap: name}
+		}
+		revision = pinned
+	}
+	if infoErr == nil {
+		info, infoErr = infoForUpdate(st, &snapst, name, channel, revision, userID, flags)
+	}
 	if infoErr != nil {
 		if _, ok := infoErr.(*snap.NoUpdateAvailableError); !ok {
 			return nil, infoErr
@@ -777,7 +1139,7 @@ func Update(st *state.State, name, channel string, revision snap.Revision, userI
 func infoForUpdate(st *state.State, snapst *SnapState, name, channel string, revision snap.Revision, userID int, flags Flags) (*snap.Info, error) {
 	if revision.Unset() {
 		// good ol' refresh
-		info, err := updateInfo(st, snapst, channel, userID)
+		info, err := updateInfo(st, snapst, channel, userID, flags)
 		if err != nil {
 			return nil, err
 		}
@@ -967,9 +1329,19 @@ func canRemove(si *snap.Info, snapst *SnapState, removeAll bool) bool {
 	return true
 }
 
+// RemoveFlags are used to pass additional flags to the Remove operation.
+type RemoveFlags struct {
+	// Purge removes the snap without saving a snapshot of its data.
+	Purge bool
+}
+
 // Remove returns a set of tasks for removing snap.
 // Note that the state must be locked by the caller.
-func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSet, error) {
+func Remove(st *state.State, name string, revision snap.Revision, flags *RemoveFlags) (*state.TaskSet, error) {
+	if flags == nil {
+		flags = &RemoveFlags{}
+	}
+
 	var snapst SnapState
 	err := Get(st, name, &snapst)
 	if err != nil && err != state.ErrNoState {
@@ -984,6 +1356,16 @@ func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSe
 		return nil, err
 	}
 
+	if revision.Unset() {
+		valsets, err := trackedValidationSets(st)
+		if err != nil {
+			return nil, err
+		}
+		if err := valsets.CheckRemove(name); err != nil {
+			return nil, fmt.Errorf("cannot remove: %v", err)
+		}
+	}
+
 	active := snapst.Active
 	var removeAll bool
 	if revision.Unset() {
@@ -1018,6 +1400,15 @@ func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSe
 		return nil, fmt.Errorf("snap %q is not removable", name)
 	}
 
+	// keep a snapshot of the data of apps that go away completely
+	var snapshot *state.TaskSet
+	if removeAll && info.Type == snap.TypeApp && !flags.Purge {
+		snapshot, err = AutomaticSnapshot(st, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// main/current SnapSetup
 	snapsup := SnapSetup{
 		SideInfo: &snap.SideInfo{
@@ -1039,12 +1430,26 @@ func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSe
 		chain = ts
 	}
 
+	var removeHook *state.Task
+	// only run the remove hook if removing the snap completely
+	if removeAll {
+		removeHook = SetupRemoveHook(st, name)
+	}
+
 	if active { // unlink
 		stopSnapServices := st.NewTask("stop-snap-services", fmt.Sprintf(i18n.G("Stop snap %q services"), name))
 		stopSnapServices.Set("snap-setup", snapsup)
+		tasks := []*state.Task{stopSnapServices}
+		prev := stopSnapServices
+
+		if removeHook != nil {
+			removeHook.WaitFor(prev)
+			tasks = append(tasks, removeHook)
+			prev = removeHook
+		}
 
 		removeAliases := st.NewTask("remove-aliases", fmt.Sprintf(i18n.G("Remove aliases for snap %q"), name))
-		removeAliases.WaitFor(stopSnapServices)
+		removeAliases.WaitFor(prev)
 		removeAliases.Set("snap-setup-task", stopSnapServices.ID())
 
 		unlink := st.NewTask("unlink-snap", fmt.Sprintf(i18n.G("Make snap %q unavailable to the system"), name))
@@ -1055,7 +1460,14 @@ func Remove(st *state.State, name string, revision snap.Revision) (*state.TaskSe
 		removeSecurity.WaitFor(unlink)
 		removeSecurity.Set("snap-setup-task", stopSnapServices.ID())
 
-		addNext(state.NewTaskSet(stopSnapServices, removeAliases, unlink, removeSecurity))
+		tasks = append(tasks, removeAliases, unlink, removeSecurity)
+		addNext(state.NewTaskSet(tasks...))
+	} else if removeHook != nil {
+		addNext(state.NewTaskSet(removeHook))
+	}
+
+	if snapshot != nil {
+		addNext(snapshot)
 	}
 
 	if removeAll {
@@ -1107,11 +1519,11 @@ func removeInactiveRevision(st *state.State, name string, revision snap.Revision
 
 // RemoveMany removes everything from the given list of names.
 // Note that the state must be locked by the caller.
-func RemoveMany(st *state.State, names []string) ([]string, []*state.TaskSet, error) {
+func RemoveMany(st *state.State, names []string, flags *RemoveFlags) ([]string, []*state.TaskSet, error) {
 	removed := make([]string, 0, len(names))
 	tasksets := make([]*state.TaskSet, 0, len(names))
 	for _, name := range names {
-		ts, err := Remove(st, name, snap.R(0))
+		ts, err := Remove(st, name, snap.R(0), flags)
 		// FIXME: is this expected behavior?
 		if _, ok := err.(*snap.NotInstalledError); ok {
 			continue
@@ -1165,6 +1577,19 @@ func RevertToRevision(st *state.State, name string, rev snap.Revision, flags Fla
 	if err != nil {
 		return nil, err
 	}
+
+	curInfo, err := snapst.CurrentInfo()
+	if err != nil {
+		return nil, err
+	}
+	info, err := readInfo(name, snapst.Sequence[i])
+	if err != nil {
+		return nil, err
+	}
+	if !info.Epoch.CanRead(curInfo.Epoch) {
+		return nil, fmt.Errorf("cannot revert %q to revision %s with epoch %s, because it cannot read the data of the current epoch %s", name, rev, info.Epoch, curInfo.Epoch)
+	}
+
 	flags.Revert = true
 	snapsup := &SnapSetup{
 		SideInfo: snapst.Sequence[i],
@@ -1235,7 +1660,7 @@ func TransitionCore(st *state.State, oldName, newName string) ([]*state.TaskSet,
 	})
 
 	// then remove the old snap
-	tsRm, err := Remove(st, oldName, snap.R(0))
+	tsRm, err := Remove(st, oldName, snap.R(0), nil)
 	if err != nil {
 		return nil, err
 	}
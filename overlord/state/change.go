@@ -126,10 +126,28 @@ type Change struct {
 	lanes   int
 	ready   chan struct{}
 
+	priority int
+
 	spawnTime time.Time
 	readyTime time.Time
+
+	// serialized caches the change as last checkpointed, it's reset
+	// whenever the change is modified
+	serialized *json.RawMessage
 }
 
+// Priorities for changes. The tasks of changes with a higher priority
+// are started before those of changes with a lower one when they
+// compete for the same task runner.
+const (
+	// BackgroundPriority is for changes nobody is waiting on, such as
+	// automatic refreshes.
+	BackgroundPriority = -10
+	// DefaultPriority is the priority of a change unless set otherwise,
+	// as for changes requested by a user.
+	DefaultPriority = 0
+)
+
 type byReadyTime []*Change
 
 func (a byReadyTime) Len() int           { return len(a) }
@@ -159,6 +177,8 @@ type marshalledChange struct {
 	TaskIDs []string                    `json:"task-ids,omitempty"`
 	Lanes   int                         `json:"lanes,omitempty"`
 
+	Priority int `json:"priority,omitempty"`
+
 	SpawnTime time.Time  `json:"spawn-time"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
 }
@@ -180,6 +200,8 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 		TaskIDs: c.taskIDs,
 		Lanes:   c.lanes,
 
+		Priority: c.priority,
+
 		SpawnTime: c.spawnTime,
 		ReadyTime: readyTime,
 	})
@@ -207,6 +229,7 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 	c.data = custData
 	c.taskIDs = unmarshalled.TaskIDs
 	c.lanes = unmarshalled.Lanes
+	c.priority = unmarshalled.Priority
 	c.ready = make(chan struct{})
 	c.spawnTime = unmarshalled.SpawnTime
 	if unmarshalled.ReadyTime != nil {
@@ -237,10 +260,25 @@ func (c *Change) Summary() string {
 	return c.summary
 }
 
+// SetPriority sets the priority of the change. Ready tasks of changes
+// with a higher priority are started first.
+func (c *Change) SetPriority(priority int) {
+	c.state.writing()
+	c.serialized = nil
+	c.priority = priority
+}
+
+// Priority returns the priority of the change.
+func (c *Change) Priority() int {
+	c.state.reading()
+	return c.priority
+}
+
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (c *Change) Set(key string, value interface{}) {
 	c.state.writing()
+	c.serialized = nil
 	c.data.set(key, value)
 }
 
@@ -301,6 +339,7 @@ func (c *Change) Status() Status {
 // SetStatus sets the change status, overriding the default behavior (see Status method).
 func (c *Change) SetStatus(s Status) {
 	c.state.writing()
+	c.serialized = nil
 	c.status = s
 	if s.Ready() {
 		c.markReady()
@@ -315,6 +354,7 @@ func (c *Change) markReady() {
 	}
 	if c.readyTime.IsZero() {
 		c.readyTime = timeNow()
+		c.serialized = nil
 	}
 }
 
@@ -380,6 +420,7 @@ func (c *Change) taskCleanChanged() {
 		}
 	}
 	c.clean = true
+	c.serialized = nil
 }
 
 // SpawnTime returns the time when the change was created.
@@ -455,10 +496,12 @@ func (c *Change) State() *State {
 // be accomplished.
 func (c *Change) AddTask(t *Task) {
 	c.state.writing()
+	c.serialized = nil
 	if t.change != "" {
 		panic(fmt.Sprintf("internal error: cannot add one %q task to multiple changes", t.Kind()))
 	}
 	t.change = c.id
+	t.serialized = nil
 	c.taskIDs = addOnce(c.taskIDs, t.ID())
 }
 
@@ -466,6 +509,7 @@ func (c *Change) AddTask(t *Task) {
 // change to be accomplished.
 func (c *Change) AddAll(ts *TaskSet) {
 	c.state.writing()
+	c.serialized = nil
 	for _, t := range ts.tasks {
 		c.AddTask(t)
 	}
@@ -481,6 +525,7 @@ func (c *Change) Tasks() []*Task {
 // Cancellation will proceed at the next ensure pass.
 func (c *Change) Abort() {
 	c.state.writing()
+	c.serialized = nil
 	tasks := make([]*Task, len(c.taskIDs))
 	for i, tid := range c.taskIDs {
 		tasks[i] = c.state.tasks[tid]
@@ -493,6 +538,7 @@ func (c *Change) Abort() {
 // on aborted).
 func (c *Change) AbortLanes(lanes []int) {
 	c.state.writing()
+	c.serialized = nil
 	c.abortLanes(lanes, make(map[int]bool))
 }
 
@@ -20,6 +20,8 @@
 package state_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"strconv"
 	"strings"
 	"time"
@@ -43,6 +45,26 @@ func (cs *changeSuite) TestNewChange(c *C) {
 	c.Check(chg.Summary(), Equals, "summary...")
 }
 
+func (cs *changeSuite) TestPriority(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("auto-refresh", "...")
+	c.Check(chg.Priority(), Equals, state.DefaultPriority)
+
+	chg.SetPriority(state.BackgroundPriority)
+	c.Check(chg.Priority(), Equals, state.BackgroundPriority)
+
+	data, err := json.Marshal(st)
+	c.Assert(err, IsNil)
+	st2, err := state.ReadState(nil, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+	c.Check(st2.Change(chg.ID()).Priority(), Equals, state.BackgroundPriority)
+}
+
 func (cs *changeSuite) TestReadyTime(c *C) {
 	st := state.New(nil)
 	st.Lock()
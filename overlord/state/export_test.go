@@ -20,6 +20,7 @@
 package state
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -44,3 +45,28 @@ func MockTaskTimes(t *Task, spawnTime, readyTime time.Time) {
 	t.spawnTime = spawnTime
 	t.readyTime = readyTime
 }
+
+func (s *State) AddWarning(message string, lastAdded, lastShown time.Time, expireAfter, repeatAfter time.Duration) {
+	s.addWarning(Warning{
+		message:     message,
+		lastShown:   lastShown,
+		expireAfter: expireAfter,
+		repeatAfter: repeatAfter,
+	}, lastAdded)
+}
+
+func (s *State) CheckpointEntries() map[string]*json.RawMessage {
+	return s.checkpointEntries()
+}
+
+func (s *State) CheckpointData() []byte {
+	return s.checkpointData()
+}
+
+func MockJournalCompactSize(size int64) (restore func()) {
+	old := JournalCompactSize
+	JournalCompactSize = size
+	return func() { JournalCompactSize = old }
+}
+
+var AssembleEntries = assembleEntries
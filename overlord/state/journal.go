@@ -0,0 +1,403 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// An EntriesBackend is a Backend that can checkpoint the state
+// incrementally. It is handed the state broken down into its separately
+// serialized entries, instead of as a single blob.
+type EntriesBackend interface {
+	Backend
+	CheckpointEntries(entries map[string]*json.RawMessage) error
+}
+
+// the prefixes of the entries holding the elements of the maps of the
+// serialized state; any other entry is a top-level key of it
+var entryMaps = []string{"data", "changes", "tasks"}
+
+func marshalEntry(key string, value interface{}) *json.RawMessage {
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		// this shouldn't happen, because the actual delicate serializing happens at various Set()s
+		logger.Panicf("internal error: could not marshal state entry %q: %v", key, err)
+	}
+	raw := json.RawMessage(serialized)
+	return &raw
+}
+
+// checkpointEntries returns the state broken down into separately
+// serialized entries; assembling them back gives what checkpointData
+// returns.
+func (s *State) checkpointEntries() map[string]*json.RawMessage {
+	entries := make(map[string]*json.RawMessage, len(s.data)+len(s.changes)+len(s.tasks)+4)
+	for k, v := range s.data {
+		entries["data/"+k] = v
+	}
+	// changes and tasks are only marshalled again when they were
+	// modified since the last checkpoint
+	for id, chg := range s.changes {
+		if chg.serialized == nil {
+			chg.serialized = marshalEntry("changes/"+id, chg)
+		}
+		entries["changes/"+id] = chg.serialized
+	}
+	for id, t := range s.tasks {
+		if t.serialized == nil {
+			t.serialized = marshalEntry("tasks/"+id, t)
+		}
+		entries["tasks/"+id] = t.serialized
+	}
+	if len(s.warnings) > 0 {
+		entries["warnings"] = marshalEntry("warnings", s.flattenWarnings())
+	}
+	entries["last-change-id"] = marshalEntry("last-change-id", s.lastChangeId)
+	entries["last-task-id"] = marshalEntry("last-task-id", s.lastTaskId)
+	entries["last-lane-id"] = marshalEntry("last-lane-id", s.lastLaneId)
+	return entries
+}
+
+// splitEntries breaks down serialized state into its entries.
+func splitEntries(data []byte) (map[string]*json.RawMessage, error) {
+	var top map[string]*json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*json.RawMessage, len(top))
+	for k, v := range top {
+		entries[k] = v
+	}
+	for _, prefix := range entryMaps {
+		raw := top[prefix]
+		delete(entries, prefix)
+		if raw == nil {
+			continue
+		}
+		var m map[string]*json.RawMessage
+		if err := json.Unmarshal(*raw, &m); err != nil {
+			return nil, err
+		}
+		for k, v := range m {
+			entries[prefix+"/"+k] = v
+		}
+	}
+	return entries, nil
+}
+
+// assembleEntries puts entries back together into serialized state.
+func assembleEntries(entries map[string]*json.RawMessage) ([]byte, error) {
+	top := make(map[string]interface{}, len(entryMaps)+4)
+	maps := make(map[string]map[string]*json.RawMessage, len(entryMaps))
+	for _, prefix := range entryMaps {
+		maps[prefix] = make(map[string]*json.RawMessage)
+		top[prefix] = maps[prefix]
+	}
+	for k, v := range entries {
+		if i := strings.IndexRune(k, '/'); i > 0 {
+			if m, ok := maps[k[:i]]; ok {
+				m[k[i+1:]] = v
+				continue
+			}
+		}
+		top[k] = v
+	}
+	return json.Marshal(top)
+}
+
+// JournalCompactSize is the size the write-ahead log of a Journal can
+// grow to before it's compacted into the state file.
+var JournalCompactSize int64 = 4 * 1024 * 1024
+
+// A Journal persists the state incrementally: every checkpoint appends
+// only the entries that changed since the previous one to a write-ahead
+// log, which is compacted into a full state file (in the format read by
+// ReadState) once it grows big enough.
+//
+// Each compaction bumps a generation number that is recorded both in
+// the state file and at the start of the log that follows it, so that
+// a log left behind by a crash during compaction is recognized as
+// stale and not replayed.
+//
+// The state file is only authoritative right after a compaction, so
+// the log must be compacted before anything else, e.g. an older snapd
+// after a revert, reads the state file on its own; see Compact and
+// CompactAlways.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	logPath string
+	// always is set when every checkpoint compacts
+	always bool
+
+	// entries is what has been persisted so far
+	entries    map[string]*json.RawMessage
+	logSize    int64
+	generation uint64
+}
+
+// journalGenerationKey is the entry of the state file holding the
+// generation of the journal; it's not part of the state itself.
+const journalGenerationKey = "journal-generation"
+
+// journalRecord is a line in the write-ahead log. The first line of a
+// log only holds its generation.
+type journalRecord struct {
+	Generation uint64                      `json:"generation,omitempty"`
+	Set        map[string]*json.RawMessage `json:"set,omitempty"`
+	Delete     []string                    `json:"delete,omitempty"`
+}
+
+// NewJournal returns a Journal keeping the full state in the file with
+// the given path, and the write-ahead log next to it.
+func NewJournal(path string) *Journal {
+	return &Journal{
+		path:    path,
+		logPath: path + ".journal",
+	}
+}
+
+// Load reads the state file and replays the write-ahead log on top of
+// it, returning the resulting serialized state. A state file without a
+// write-ahead log (as written before journaling was introduced) is
+// loaded as is.
+func (j *Journal) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the state file: %v", err)
+	}
+	entries, err := splitEntries(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the state file: %v", err)
+	}
+	var generation uint64
+	if raw := entries[journalGenerationKey]; raw != nil {
+		if err := json.Unmarshal(*raw, &generation); err != nil {
+			return nil, fmt.Errorf("cannot parse the state file: %v", err)
+		}
+		delete(entries, journalGenerationKey)
+	}
+
+	logSize, replayed, err := j.replay(entries, generation)
+	if err != nil {
+		return nil, err
+	}
+	j.entries = entries
+	j.logSize = logSize
+	j.generation = generation
+
+	if replayed == 0 {
+		return data, nil
+	}
+	return assembleEntries(entries)
+}
+
+// replay applies the records of the write-ahead log to the given
+// entries. A torn last record, from a write interrupted by a crash, is
+// dropped, as is a log from a generation other than the one of the
+// state file.
+func (j *Journal) replay(entries map[string]*json.RawMessage, generation uint64) (size int64, replayed int, err error) {
+	f, err := os.Open(j.logPath)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot open the state journal: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// torn write; the checkpoint never completed
+				if err := os.Truncate(j.logPath, size); err != nil {
+					return 0, 0, fmt.Errorf("cannot truncate the state journal: %v", err)
+				}
+			}
+			return size, replayed, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot read the state journal: %v", err)
+		}
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return 0, 0, fmt.Errorf("cannot parse record %d of the state journal: %v", replayed+1, err)
+		}
+		if size == 0 && record.Generation != generation {
+			// the state file was compacted but the crash came
+			// before the old log was removed
+			logger.Noticef("dropping stale state journal of generation %d (state is at %d)", record.Generation, generation)
+			if err := os.Remove(j.logPath); err != nil {
+				return 0, 0, fmt.Errorf("cannot remove the stale state journal: %v", err)
+			}
+			return 0, 0, nil
+		}
+		for k, v := range record.Set {
+			entries[k] = v
+		}
+		for _, k := range record.Delete {
+			delete(entries, k)
+		}
+		size += int64(len(line))
+		replayed++
+	}
+}
+
+// Compact writes the full state file from what was persisted so far
+// and empties the write-ahead log, if there is one.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.entries == nil || j.logSize == 0 {
+		// the state file is up to date
+		return nil
+	}
+	return j.compact(j.entries)
+}
+
+// CompactAlways compacts the write-ahead log like Compact and makes
+// every later checkpoint write the full state file directly, keeping
+// it authoritative, e.g. when the process is about to be restarted
+// into a possibly older version.
+func (j *Journal) CompactAlways() error {
+	j.mu.Lock()
+	j.always = true
+	j.mu.Unlock()
+	return j.Compact()
+}
+
+// Checkpoint persists the given serialized state.
+func (j *Journal) Checkpoint(data []byte) error {
+	entries, err := splitEntries(data)
+	if err != nil {
+		return err
+	}
+	return j.CheckpointEntries(entries)
+}
+
+// CheckpointEntries persists the entries that changed since the last
+// checkpoint, compacting the write-ahead log if it grew too big.
+func (j *Journal) CheckpointEntries(entries map[string]*json.RawMessage) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.entries == nil || j.always {
+		// nothing was persisted yet, or the state file is kept
+		// authoritative
+		return j.compact(entries)
+	}
+
+	var record journalRecord
+	for k, v := range entries {
+		if old := j.entries[k]; old == nil || (old != v && !bytes.Equal(*old, *v)) {
+			if record.Set == nil {
+				record.Set = make(map[string]*json.RawMessage)
+			}
+			record.Set[k] = v
+		}
+	}
+	for k := range j.entries {
+		if entries[k] == nil {
+			record.Delete = append(record.Delete, k)
+		}
+	}
+	if len(record.Set) == 0 && len(record.Delete) == 0 {
+		return nil
+	}
+	sort.Strings(record.Delete)
+
+	line, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if j.logSize+int64(len(line)) > JournalCompactSize {
+		return j.compact(entries)
+	}
+	if j.logSize == 0 {
+		header, err := json.Marshal(&journalRecord{Generation: j.generation})
+		if err != nil {
+			return err
+		}
+		line = append(append(header, '\n'), line...)
+	}
+	if err := j.appendLog(line); err != nil {
+		return err
+	}
+	j.entries = entries
+	j.logSize += int64(len(line))
+	return nil
+}
+
+func (j *Journal) appendLog(line []byte) error {
+	f, err := os.OpenFile(j.logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		// do not leave a partial record behind
+		f.Truncate(j.logSize)
+		return err
+	}
+	return f.Sync()
+}
+
+// compact writes the full state file, with a new generation, and
+// empties the write-ahead log.
+func (j *Journal) compact(entries map[string]*json.RawMessage) error {
+	generation := j.generation + 1
+	withGeneration := make(map[string]*json.RawMessage, len(entries)+1)
+	for k, v := range entries {
+		withGeneration[k] = v
+	}
+	withGeneration[journalGenerationKey] = marshalEntry(journalGenerationKey, generation)
+	data, err := assembleEntries(withGeneration)
+	if err != nil {
+		return err
+	}
+	if err := osutil.AtomicWriteFile(j.path, data, 0600, 0); err != nil {
+		return err
+	}
+	// the old log would roll back the new state file if it was
+	// replayed on top of it, but after a crash here its generation
+	// tells it apart
+	if err := os.Remove(j.logPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.entries = entries
+	j.logSize = 0
+	j.generation = generation
+	return nil
+}
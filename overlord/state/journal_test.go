@@ -0,0 +1,342 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type journalSuite struct {
+	path string
+}
+
+var _ = Suite(&journalSuite{})
+
+func (s *journalSuite) SetUpTest(c *C) {
+	s.path = filepath.Join(c.MkDir(), "state.json")
+}
+
+type journalBackend struct {
+	*state.Journal
+}
+
+func (journalBackend) EnsureBefore(d time.Duration)       {}
+func (journalBackend) RequestRestart(t state.RestartType) {}
+
+func sameState(c *C, st1, st2 *state.State) {
+	st1.Lock()
+	data1, err := json.Marshal(st1)
+	st1.Unlock()
+	c.Assert(err, IsNil)
+	st2.Lock()
+	data2, err := json.Marshal(st2)
+	st2.Unlock()
+	c.Assert(err, IsNil)
+
+	var v1, v2 map[string]interface{}
+	c.Assert(json.Unmarshal(data1, &v1), IsNil)
+	c.Assert(json.Unmarshal(data2, &v2), IsNil)
+	c.Check(v1, DeepEquals, v2)
+}
+
+func (s *journalSuite) load(c *C) *state.State {
+	j := state.NewJournal(s.path)
+	data, err := j.Load()
+	c.Assert(err, IsNil)
+	st, err := state.ReadState(journalBackend{j}, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	return st
+}
+
+func populate(st *state.State) {
+	st.Lock()
+	defer st.Unlock()
+	st.Set("foo", "bar")
+	st.Set("baz", 42)
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("link", "2...")
+	t2.WaitFor(t1)
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	st.Warnf("hello")
+}
+
+func (s *journalSuite) TestCheckpointEntriesAssembleToCheckpointData(c *C) {
+	st := state.New(nil)
+	populate(st)
+
+	st.Lock()
+	defer st.Unlock()
+	assembled, err := state.AssembleEntries(st.CheckpointEntries())
+	c.Assert(err, IsNil)
+
+	var v1, v2 map[string]interface{}
+	c.Assert(json.Unmarshal(assembled, &v1), IsNil)
+	c.Assert(json.Unmarshal(st.CheckpointData(), &v2), IsNil)
+	c.Check(v1, DeepEquals, v2)
+}
+
+func (s *journalSuite) TestCheckpointEntriesOnlyMarshalsModified(c *C) {
+	st := state.New(nil)
+	populate(st)
+
+	st.Lock()
+	defer st.Unlock()
+	entries1 := st.CheckpointEntries()
+	t1 := st.Changes()[0].Tasks()[0]
+	t1.SetStatus(state.DoneStatus)
+	entries2 := st.CheckpointEntries()
+
+	c.Check(entries2["tasks/"+t1.ID()] == entries1["tasks/"+t1.ID()], Equals, false)
+	// untouched ones are reused as they are
+	t2 := st.Changes()[0].Tasks()[1]
+	c.Check(entries2["tasks/"+t2.ID()] == entries1["tasks/"+t2.ID()], Equals, true)
+	c.Check(entries2["changes/1"] == entries1["changes/1"], Equals, true)
+
+	// the change is marshalled again once it's ready
+	t2.SetStatus(state.DoneStatus)
+	entries3 := st.CheckpointEntries()
+	c.Check(entries3["changes/1"] == entries2["changes/1"], Equals, false)
+}
+
+func (s *journalSuite) TestFirstCheckpointWritesStateFile(c *C) {
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+
+	c.Check(osutil.FileExists(s.path), Equals, true)
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+
+	st2, err := state.ReadState(nil, mustOpen(c, s.path))
+	c.Assert(err, IsNil)
+	sameState(c, st, st2)
+}
+
+func (s *journalSuite) TestCheckpointAppendsAndRecovers(c *C) {
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+	before, err := ioutil.ReadFile(s.path)
+	c.Assert(err, IsNil)
+
+	st.Lock()
+	st.Set("foo", "quux")
+	st.Changes()[0].Tasks()[0].SetStatus(state.DoneStatus)
+	st.Unlock()
+
+	// the state file was left alone
+	after, err := ioutil.ReadFile(s.path)
+	c.Assert(err, IsNil)
+	c.Check(after, DeepEquals, before)
+
+	// only what changed got appended
+	log, err := ioutil.ReadFile(s.path + ".journal")
+	c.Assert(err, IsNil)
+	c.Check(bytes.Count(log, []byte("\n")), Equals, 2)
+	c.Check(string(log), Matches, `{"generation":1}\n{"set":{"data/foo":"quux","tasks/1":{.*"kind":"download".*}}}\n`)
+	sameState(c, st, s.load(c))
+
+	// removals get recorded as well
+	st.Lock()
+	st.Changes()[0].Tasks()[1].SetStatus(state.DoneStatus)
+	st.Prune(0, time.Hour, 100)
+	c.Assert(st.Changes(), HasLen, 0)
+	st.Unlock()
+
+	log, err = ioutil.ReadFile(s.path + ".journal")
+	c.Assert(err, IsNil)
+	c.Check(bytes.Count(log, []byte("\n")), Equals, 3)
+	c.Check(string(log), Matches, `(?s).*"delete":\["changes/1","tasks/1","tasks/2"\].*\n`)
+	sameState(c, st, s.load(c))
+}
+
+func (s *journalSuite) TestTornRecordIsDropped(c *C) {
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+	st.Lock()
+	st.Set("foo", "quux")
+	st.Unlock()
+
+	f, err := os.OpenFile(s.path+".journal", os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteString(`{"set":{"data/foo":"torn`)
+	c.Assert(err, IsNil)
+	f.Close()
+
+	st2 := s.load(c)
+	sameState(c, st, st2)
+
+	// and the journal carries on from there
+	st2.Lock()
+	st2.Set("foo", "again")
+	st2.Unlock()
+	sameState(c, st2, s.load(c))
+}
+
+func (s *journalSuite) TestCorruptRecord(c *C) {
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+
+	c.Assert(ioutil.WriteFile(s.path+".journal", []byte("garbage\n{}\n"), 0600), IsNil)
+
+	_, err := state.NewJournal(s.path).Load()
+	c.Check(err, ErrorMatches, "cannot parse record 1 of the state journal: .*")
+}
+
+func (s *journalSuite) TestCompaction(c *C) {
+	defer state.MockJournalCompactSize(200)()
+
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+
+	for i := 0; i < 10; i++ {
+		st.Lock()
+		st.Set("counter", i)
+		st.Unlock()
+
+		fi, err := os.Stat(s.path + ".journal")
+		if err == nil {
+			c.Check(fi.Size() <= 200, Equals, true)
+		} else {
+			c.Check(os.IsNotExist(err), Equals, true)
+		}
+	}
+
+	sameState(c, st, s.load(c))
+}
+
+func (s *journalSuite) TestStaleJournalAfterCompactionIsDropped(c *C) {
+	st := state.New(journalBackend{state.NewJournal(s.path)})
+	populate(st)
+	st.Lock()
+	st.Set("foo", "quux")
+	st.Unlock()
+	stale, err := ioutil.ReadFile(s.path + ".journal")
+	c.Assert(err, IsNil)
+
+	// compact, and bring back the old log as if a crash happened
+	// before it could be removed
+	restore := state.MockJournalCompactSize(0)
+	st.Lock()
+	st.Set("foo", "compacted")
+	st.Unlock()
+	restore()
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+	c.Assert(ioutil.WriteFile(s.path+".journal", stale, 0600), IsNil)
+
+	st2 := s.load(c)
+	sameState(c, st, st2)
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+
+	// and the journal carries on from there
+	st2.Lock()
+	st2.Set("foo", "again")
+	st2.Unlock()
+	sameState(c, st2, s.load(c))
+}
+
+// readStateFile reads the state file alone, as an older snapd would.
+func (s *journalSuite) readStateFile(c *C) *state.State {
+	f, err := os.Open(s.path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	st, err := state.ReadState(nil, f)
+	c.Assert(err, IsNil)
+	return st
+}
+
+func (s *journalSuite) TestCompact(c *C) {
+	j := state.NewJournal(s.path)
+	// nothing persisted yet
+	c.Assert(j.Compact(), IsNil)
+	c.Check(osutil.FileExists(s.path), Equals, false)
+
+	st := state.New(journalBackend{j})
+	populate(st)
+	st.Lock()
+	st.Set("foo", "quux")
+	st.Unlock()
+	c.Assert(osutil.FileExists(s.path+".journal"), Equals, true)
+
+	c.Assert(j.Compact(), IsNil)
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+	sameState(c, st, s.readStateFile(c))
+
+	// the journal carries on from there
+	st.Lock()
+	st.Set("foo", "again")
+	st.Unlock()
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, true)
+	sameState(c, st, s.load(c))
+}
+
+func (s *journalSuite) TestCompactAlways(c *C) {
+	j := state.NewJournal(s.path)
+	st := state.New(journalBackend{j})
+	populate(st)
+	st.Lock()
+	st.Set("foo", "quux")
+	st.Unlock()
+
+	c.Assert(j.CompactAlways(), IsNil)
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+	sameState(c, st, s.readStateFile(c))
+
+	// later checkpoints go straight to the state file
+	st.Lock()
+	st.Set("foo", "again")
+	st.Unlock()
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, false)
+	sameState(c, st, s.readStateFile(c))
+}
+
+func (s *journalSuite) TestMigratesStateFile(c *C) {
+	// a state file as written by the plain backend
+	st := state.New(nil)
+	populate(st)
+	st.Lock()
+	data := st.CheckpointData()
+	st.Unlock()
+	c.Assert(ioutil.WriteFile(s.path, data, 0600), IsNil)
+
+	st2 := s.load(c)
+	sameState(c, st, st2)
+
+	st2.Lock()
+	st2.Set("foo", "migrated")
+	st2.Unlock()
+	c.Check(osutil.FileExists(s.path+".journal"), Equals, true)
+	sameState(c, st2, s.load(c))
+}
+
+func mustOpen(c *C, path string) *os.File {
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	return f
+}
@@ -90,10 +90,11 @@ type State struct {
 	lastChangeId int
 	lastLaneId   int
 
-	backend Backend
-	data    customData
-	changes map[string]*Change
-	tasks   map[string]*Task
+	backend  Backend
+	data     customData
+	changes  map[string]*Change
+	tasks    map[string]*Task
+	warnings map[string]*Warning
 
 	modified bool
 
@@ -110,6 +111,7 @@ func New(backend Backend) *State {
 		data:     make(customData),
 		changes:  make(map[string]*Change),
 		tasks:    make(map[string]*Task),
+		warnings: make(map[string]*Warning),
 		modified: true,
 		cache:    make(map[interface{}]interface{}),
 	}
@@ -145,9 +147,10 @@ func (s *State) unlock() {
 }
 
 type marshalledState struct {
-	Data    map[string]*json.RawMessage `json:"data"`
-	Changes map[string]*Change          `json:"changes"`
-	Tasks   map[string]*Task            `json:"tasks"`
+	Data     map[string]*json.RawMessage `json:"data"`
+	Changes  map[string]*Change          `json:"changes"`
+	Tasks    map[string]*Task            `json:"tasks"`
+	Warnings []*Warning                  `json:"warnings,omitempty"`
 
 	LastChangeId int `json:"last-change-id"`
 	LastTaskId   int `json:"last-task-id"`
@@ -158,9 +161,10 @@ type marshalledState struct {
 func (s *State) MarshalJSON() ([]byte, error) {
 	s.reading()
 	return json.Marshal(marshalledState{
-		Data:    s.data,
-		Changes: s.changes,
-		Tasks:   s.tasks,
+		Data:     s.data,
+		Changes:  s.changes,
+		Tasks:    s.tasks,
+		Warnings: s.flattenWarnings(),
 
 		LastTaskId:   s.lastTaskId,
 		LastChangeId: s.lastChangeId,
@@ -179,6 +183,7 @@ func (s *State) UnmarshalJSON(data []byte) error {
 	s.data = unmarshalled.Data
 	s.changes = unmarshalled.Changes
 	s.tasks = unmarshalled.Tasks
+	s.unflattenWarnings(unmarshalled.Warnings)
 	s.lastChangeId = unmarshalled.LastChangeId
 	s.lastTaskId = unmarshalled.LastTaskId
 	s.lastLaneId = unmarshalled.LastLaneId
@@ -218,11 +223,18 @@ func (s *State) Unlock() {
 		return
 	}
 
-	data := s.checkpointData()
+	var checkpoint func() error
+	if eb, ok := s.backend.(EntriesBackend); ok {
+		entries := s.checkpointEntries()
+		checkpoint = func() error { return eb.CheckpointEntries(entries) }
+	} else {
+		data := s.checkpointData()
+		checkpoint = func() error { return s.backend.Checkpoint(data) }
+	}
 	var err error
 	start := time.Now()
 	for time.Since(start) <= unlockCheckpointRetryMaxTime {
-		if err = s.backend.Checkpoint(data); err == nil {
+		if err = checkpoint(); err == nil {
 			s.modified = false
 			return
 		}
@@ -384,7 +396,8 @@ func (s *State) tasksIn(tids []string) []*Task {
 
 // Prune removes changes that became ready for more than pruneWait
 // and aborts tasks spawned for more than abortWait.
-// It also removes tasks unlinked to changes after pruneWait. When
+// It also removes tasks unlinked to changes after pruneWait, and
+// expired warnings. When
 // there are more changes than the limit set via "maxReadyChanges"
 // those changes in ready state will also removed even if they are below
 // the pruneWait duration.
@@ -393,6 +406,8 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 	pruneLimit := now.Add(-pruneWait)
 	abortLimit := now.Add(-abortWait)
 
+	s.pruneWarnings(now.UTC())
+
 	// sort from oldest to newest
 	changes := s.Changes()
 	sort.Sort(byReadyTime(changes))
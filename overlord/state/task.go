@@ -56,6 +56,14 @@ type Task struct {
 	readyTime time.Time
 
 	atTime time.Time
+
+	// serialized caches the task as last checkpointed, it's reset
+	// whenever the task is modified
+	serialized *json.RawMessage
+
+	// throttled is not persisted, it's set by the task runner when
+	// the task is ready to run but is being held back
+	throttled bool
 }
 
 func newTask(state *State, id, kind, summary string) *Task {
@@ -185,6 +193,7 @@ func (t *Task) Status() Status {
 // SetStatus sets the task status, overriding the default behavior (see Status method).
 func (t *Task) SetStatus(new Status) {
 	t.state.writing()
+	t.serialized = nil
 	old := t.status
 	t.status = new
 	if !old.Ready() && new.Ready() {
@@ -207,6 +216,7 @@ func (t *Task) IsClean() bool {
 // Cleaning a task must only be done after the change is ready.
 func (t *Task) SetClean() {
 	t.state.writing()
+	t.serialized = nil
 	if t.clean {
 		return
 	}
@@ -250,6 +260,7 @@ func (t *Task) SetProgress(label string, done, total int) {
 	} else {
 		t.state.reading()
 	}
+	t.serialized = nil
 	if total <= 0 || done > total {
 		// Doing math wrong is easy. Be conservative.
 		t.progress = nil
@@ -276,6 +287,14 @@ func (t *Task) AtTime() time.Time {
 	return t.atTime
 }
 
+// IsThrottled returns whether the task is ready to run but was held
+// back by its task runner, because of a concurrency limit or because
+// other running tasks block it.
+func (t *Task) IsThrottled() bool {
+	t.state.reading()
+	return t.throttled && t.Status() == DoStatus
+}
+
 const (
 	// Messages logged in tasks are guaranteed to use the time formatted
 	// per RFC3339 plus the following strings as a prefix, so these may
@@ -322,12 +341,14 @@ func (t *Task) Log() []string {
 // Logf logs information about the progress of the task.
 func (t *Task) Logf(format string, args ...interface{}) {
 	t.state.writing()
+	t.serialized = nil
 	t.addLog(LogInfo, format, args)
 }
 
 // Errorf logs error information about the progress of the task.
 func (t *Task) Errorf(format string, args ...interface{}) {
 	t.state.writing()
+	t.serialized = nil
 	t.addLog(LogError, format, args)
 }
 
@@ -335,6 +356,7 @@ func (t *Task) Errorf(format string, args ...interface{}) {
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (t *Task) Set(key string, value interface{}) {
 	t.state.writing()
+	t.serialized = nil
 	t.data.set(key, value)
 }
 
@@ -348,6 +370,7 @@ func (t *Task) Get(key string, value interface{}) error {
 // Clear disassociates the value from key.
 func (t *Task) Clear(key string) {
 	t.state.writing()
+	t.serialized = nil
 	delete(t.data, key)
 }
 
@@ -363,8 +386,10 @@ func addOnce(set []string, s string) []string {
 // WaitFor registers another task as a requirement for t to make progress.
 func (t *Task) WaitFor(another *Task) {
 	t.state.writing()
+	t.serialized = nil
 	t.waitTasks = addOnce(t.waitTasks, another.id)
 	another.haltTasks = addOnce(another.haltTasks, t.id)
+	another.serialized = nil
 }
 
 // WaitAll registers all the tasks in the set as a requirement for t
@@ -400,12 +425,14 @@ func (t *Task) Lanes() []int {
 // abort independently on errors. See Change.AbortLane for details.
 func (t *Task) JoinLane(lane int) {
 	t.state.writing()
+	t.serialized = nil
 	t.lanes = append(t.lanes, lane)
 }
 
 // At schedules the task, if it's not ready, to happen no earlier than when, if when is the zero time any previous special scheduling is suppressed.
 func (t *Task) At(when time.Time) {
 	t.state.writing()
+	t.serialized = nil
 	iszero := when.IsZero()
 	if t.Status().Ready() && !iszero {
 		return
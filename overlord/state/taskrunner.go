@@ -20,6 +20,8 @@
 package state
 
 import (
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -57,6 +59,8 @@ type TaskRunner struct {
 	blocked     func(t *Task, running []*Task) bool
 	someBlocked bool
 
+	limits map[string]int
+
 	// go-routines lifecycle
 	tombs map[string]*tomb.Tomb
 }
@@ -72,6 +76,7 @@ func NewTaskRunner(s *State) *TaskRunner {
 		handlers: make(map[string]handlerPair),
 		cleanups: make(map[string]HandlerFunc),
 		tombs:    make(map[string]*tomb.Tomb),
+		limits:   make(map[string]int),
 	}
 }
 
@@ -113,6 +118,30 @@ func (r *TaskRunner) SetBlocked(pred func(t *Task, running []*Task) bool) {
 	r.blocked = pred
 }
 
+// SetConcurrencyLimit sets the maximum number of tasks of the given kind
+// that may be running at the same time. Tasks over the limit are left
+// waiting, marked as throttled, until a running one finishes.
+// A limit of zero or less removes the limit.
+func (r *TaskRunner) SetConcurrencyLimit(kind string, max int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if max <= 0 {
+		delete(r.limits, kind)
+		return
+	}
+	r.limits[kind] = max
+}
+
+// ConcurrencyLimit returns the maximum number of tasks of the given kind
+// that may be running at the same time, or zero if there is no limit.
+func (r *TaskRunner) ConcurrencyLimit(kind string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.limits[kind]
+}
+
 // run must be called with the state lock in place
 func (r *TaskRunner) run(t *Task) {
 	var handler HandlerFunc
@@ -307,6 +336,7 @@ func (r *TaskRunner) Ensure() {
 
 	ensureTime := timeNow()
 	nextTaskTime := time.Time{}
+	var ready []*Task
 	for _, t := range r.state.Tasks() {
 		handlers, ok := r.handlers[t.Kind()]
 		if !ok {
@@ -329,6 +359,7 @@ func (r *TaskRunner) Ensure() {
 			continue
 		}
 
+		t.throttled = false
 		status := t.Status()
 		if status.Ready() {
 			if !t.IsClean() {
@@ -359,15 +390,40 @@ func (r *TaskRunner) Ensure() {
 			continue
 		}
 
+		ready = append(ready, t)
+	}
+
+	// start tasks from changes with higher priority first, so that
+	// they take the free slots before tasks from less important changes
+	sort.Stable(byPriority(ready))
+
+	busy := make(map[string]int, len(r.limits))
+	for _, t := range running {
+		if !t.Status().Ready() {
+			busy[t.Kind()]++
+		}
+	}
+
+	for _, t := range ready {
 		if r.blocked != nil && r.blocked(t, running) {
 			r.someBlocked = true
+			t.throttled = true
+			continue
+		}
+
+		kind := t.Kind()
+		if limit, ok := r.limits[kind]; ok && busy[kind] >= limit {
+			r.someBlocked = true
+			t.throttled = true
 			continue
 		}
 
+		t.throttled = false
 		logger.Debugf("Running task %s on %s: %s", t.ID(), t.Status(), t.Summary())
 		r.run(t)
 
 		running = append(running, t)
+		busy[kind]++
 	}
 
 	// schedule next Ensure no later than the next task time
@@ -376,6 +432,40 @@ func (r *TaskRunner) Ensure() {
 	}
 }
 
+// byPriority orders tasks by the priority of their change, highest
+// first, and then by the order in which changes and tasks were created.
+type byPriority []*Task
+
+func (a byPriority) Len() int      { return len(a) }
+func (a byPriority) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPriority) Less(i, j int) bool {
+	pi, ci := taskOrder(a[i])
+	pj, cj := taskOrder(a[j])
+	if pi != pj {
+		return pi > pj
+	}
+	if ci != cj {
+		return ci < cj
+	}
+	return idOrder(a[i].ID()) < idOrder(a[j].ID())
+}
+
+func taskOrder(t *Task) (priority, change int) {
+	chg := t.Change()
+	if chg == nil {
+		return DefaultPriority, 0
+	}
+	return chg.Priority(), idOrder(chg.ID())
+}
+
+func idOrder(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 // mustWait returns whether task t must wait for other tasks to be done.
 func mustWait(t *Task) bool {
 	switch t.Status() {
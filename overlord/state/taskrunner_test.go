@@ -717,3 +717,137 @@ func (ts *taskRunnerSuite) TestCleanup(c *C) {
 	c.Assert(chgIsClean(), Equals, true)
 	c.Assert(called, Equals, 2)
 }
+
+func (ts *taskRunnerSuite) TestConcurrencyLimit(c *C) {
+	ensureBeforeTick := make(chan bool, 1)
+	sb := &stateBackend{
+		ensureBefore:     time.Hour,
+		ensureBeforeSeen: ensureBeforeTick,
+	}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	started := make(chan string, 3)
+	finish := make(chan bool)
+	r.AddHandler("download", func(t *state.Task, _ *tomb.Tomb) error {
+		st.Lock()
+		started <- t.ID()
+		st.Unlock()
+		<-finish
+		return nil
+	}, nil)
+	r.SetConcurrencyLimit("download", 2)
+	c.Check(r.ConcurrencyLimit("download"), Equals, 2)
+	c.Check(r.ConcurrencyLimit("other"), Equals, 0)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	var tasks []*state.Task
+	for i := 0; i < 3; i++ {
+		t := st.NewTask("download", "...")
+		chg.AddTask(t)
+		tasks = append(tasks, t)
+	}
+	st.Unlock()
+
+	r.Ensure() // starts only two of them
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			c.Fatal("download wasn't called")
+		}
+	}
+	c.Check(started, HasLen, 0)
+
+	st.Lock()
+	c.Check(tasks[0].IsThrottled(), Equals, false)
+	c.Check(tasks[1].IsThrottled(), Equals, false)
+	c.Check(tasks[2].IsThrottled(), Equals, true)
+	c.Check(tasks[2].Status(), Equals, state.DoStatus)
+	st.Unlock()
+
+	r.Ensure() // still nothing new
+	c.Check(started, HasLen, 0)
+
+	// finish one
+	finish <- true
+
+	// getting an EnsureBefore 0 call
+	select {
+	case <-ensureBeforeTick:
+	case <-time.After(2 * time.Second):
+		c.Fatal("EnsureBefore wasn't called")
+	}
+	c.Check(sb.ensureBefore, Equals, time.Duration(0))
+
+	r.Ensure() // starts the third
+
+	select {
+	case id := <-started:
+		c.Check(id, Equals, tasks[2].ID())
+	case <-time.After(2 * time.Second):
+		c.Fatal("third download wasn't called")
+	}
+
+	st.Lock()
+	c.Check(tasks[2].IsThrottled(), Equals, false)
+	st.Unlock()
+
+	finish <- true
+	finish <- true
+}
+
+func (ts *taskRunnerSuite) TestChangePriority(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	started := make(chan string, 3)
+	finish := make(chan bool)
+	r.AddHandler("download", func(t *state.Task, _ *tomb.Tomb) error {
+		st.Lock()
+		started <- t.Change().Kind()
+		st.Unlock()
+		<-finish
+		return nil
+	}, nil)
+	r.SetConcurrencyLimit("download", 1)
+
+	st.Lock()
+	// the change created first has a lower priority
+	for _, kind := range []string{"auto-refresh", "install"} {
+		chg := st.NewChange(kind, "...")
+		if kind == "auto-refresh" {
+			chg.SetPriority(state.BackgroundPriority)
+		}
+		chg.AddTask(st.NewTask("download", "..."))
+	}
+	st.Unlock()
+
+	r.Ensure()
+
+	select {
+	case kind := <-started:
+		c.Check(kind, Equals, "install")
+	case <-time.After(2 * time.Second):
+		c.Fatal("download wasn't called")
+	}
+	finish <- true
+
+	// the first download might still be wrapping up
+	for i := 0; i < 200; i++ {
+		r.Ensure()
+		select {
+		case kind := <-started:
+			c.Check(kind, Equals, "auto-refresh")
+			finish <- true
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Fatal("second download wasn't called")
+}
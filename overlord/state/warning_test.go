@@ -0,0 +1,130 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type warningSuite struct{}
+
+var _ = Suite(&warningSuite{})
+
+func (warningSuite) TestWarnf(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.Warnf("hello %s", "world")
+	st.Warnf("hello %s", "world")
+	st.Warnf("goodbye")
+
+	all := st.AllWarnings()
+	c.Assert(all, HasLen, 2)
+	c.Check(all[0].String(), Equals, "hello world")
+	c.Check(all[1].String(), Equals, "goodbye")
+}
+
+func (warningSuite) TestMarshalRoundTrip(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	st.Warnf("hello")
+	st.AddWarning("shown", time.Now().Add(-time.Hour), time.Now(), time.Hour*24, time.Minute)
+	buf, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, IsNil)
+
+	st2, err := state.ReadState(nil, bytes.NewReader(buf))
+	c.Assert(err, IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+
+	all := st2.AllWarnings()
+	c.Assert(all, HasLen, 2)
+	c.Check(all[0].String(), Equals, "shown")
+	c.Check(all[1].String(), Equals, "hello")
+
+	n, _ := st2.WarningsSummary()
+	c.Check(n, Equals, 1)
+}
+
+func (warningSuite) TestUnmarshalInvalid(c *C) {
+	var w state.Warning
+	for data, msg := range map[string]string{
+		`{}`:               "warning has no message",
+		`{"message": "x"}`: "warning has no first-added timestamp",
+		`{"message": "x\u0000y", "first-added": "2017-09-19T12:00:00Z"}`:                "malformed warning message",
+		`{"message": "x", "first-added": "2017-09-19T12:00:00Z"}`:                       "warning has no expire-after duration",
+		`{"message": "x", "first-added": "2017-09-19T12:00:00Z", "expire-after": "1h"}`: "warning has no repeat-after duration",
+	} {
+		c.Check(json.Unmarshal([]byte(data), &w), ErrorMatches, msg, Commentf(data))
+	}
+}
+
+func (warningSuite) TestPendingAndOkay(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now().UTC()
+	st.AddWarning("never shown", now.Add(-time.Minute), time.Time{}, time.Hour*24, time.Hour)
+	st.AddWarning("shown long ago", now.Add(-time.Minute), now.Add(-2*time.Hour), time.Hour*24, time.Hour)
+	st.AddWarning("shown recently", now.Add(-time.Minute), now.Add(-time.Minute), time.Hour*24, time.Hour)
+
+	n, last := st.WarningsSummary()
+	c.Check(n, Equals, 2)
+	c.Check(last.Equal(now.Add(-time.Minute)), Equals, true)
+
+	pending, stamp := st.PendingWarnings()
+	c.Assert(pending, HasLen, 2)
+	c.Check(stamp.After(now) || stamp.Equal(now), Equals, true)
+
+	c.Check(st.OkayWarnings(stamp), Equals, 2)
+	n, _ = st.WarningsSummary()
+	c.Check(n, Equals, 0)
+	pending, _ = st.PendingWarnings()
+	c.Check(pending, HasLen, 0)
+	c.Check(st.AllWarnings(), HasLen, 3)
+
+	st.UnshowAllWarnings()
+	n, _ = st.WarningsSummary()
+	c.Check(n, Equals, 3)
+}
+
+func (warningSuite) TestPruneExpired(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.AddWarning("expired", time.Now().Add(-2*time.Hour), time.Time{}, time.Hour, time.Hour)
+	st.Warnf("fresh")
+
+	st.Prune(time.Hour, time.Hour, 100)
+
+	all := st.AllWarnings()
+	c.Assert(all, HasLen, 1)
+	c.Check(all[0].String(), Equals, "fresh")
+}
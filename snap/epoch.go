@@ -0,0 +1,289 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// An Epoch represents the ability of the snap to read and write its data. Most
+// developers need not worry about it, and snaps default to the 0th epoch, and
+// users are only offered refreshes to epoch 0 snaps. Once an epoch bump is in
+// order, there's a simplified expression they can use which should cover the
+// majority of the cases:
+//
+//	epoch: N
+//
+// means a snap can read/write exactly the Nth epoch's data, and
+//
+//	epoch: N*
+//
+// means a snap can additionally read (N-1)th epoch's data, which means it's a
+// snap that can migrate epochs (so a user on epoch 0 can get offered a refresh
+// to a snap on epoch 1*).
+//
+// If the above is not enough, a developer can explicitly describe what epochs a
+// snap can read and write:
+//
+//	epoch:
+//	  read: [1, 2, 3]
+//	  write: [1, 3]
+//
+// the read attribute defaults to the value of the write attribute, and the
+// write attribute defaults to the last item in the read attribute. If both are
+// unset, it's the same as not specifying an epoch at all (i.e. epoch: 0). The
+// lists must not have more than maxEpochLength items, must be in strictly
+// increasing order, and the write list must not be empty.
+type Epoch struct {
+	Read  []uint32 `yaml:"read"`
+	Write []uint32 `yaml:"write"`
+}
+
+// maxEpochLength is the maximum number of items in the read or write
+// lists of an epoch.
+const maxEpochLength = 10
+
+// EpochError is returned for invalid epochs.
+type EpochError struct {
+	Message string
+}
+
+func (e EpochError) Error() string {
+	return "invalid epoch: " + e.Message
+}
+
+var validShortEpoch = regexp.MustCompile(`^(?:0|[1-9][0-9]*)[*]?$`)
+
+// ParseEpoch parses the short form of an epoch, i.e. N or N*.
+func ParseEpoch(s string) (Epoch, error) {
+	if s == "" || s == "0" {
+		return Epoch{}, nil
+	}
+	if !validShortEpoch.MatchString(s) || s == "0*" {
+		return Epoch{}, &EpochError{Message: fmt.Sprintf("%q is not a valid epoch", s)}
+	}
+	star := s[len(s)-1] == '*'
+	if star {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return Epoch{}, &EpochError{Message: fmt.Sprintf("%q is out of range", s)}
+	}
+	v := uint32(n)
+	if star {
+		return Epoch{Read: []uint32{v - 1, v}, Write: []uint32{v}}, nil
+	}
+	return Epoch{Read: []uint32{v}, Write: []uint32{v}}, nil
+}
+
+// E returns the epoch represented by the given short form.
+// Providing an invalid epoch causes a runtime panic.
+// See ParseEpoch for a polite function that does not panic.
+func E(s string) Epoch {
+	e, err := ParseEpoch(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+type structuredEpoch struct {
+	Read  *[]uint32 `yaml:"read" json:"read"`
+	Write *[]uint32 `yaml:"write" json:"write"`
+}
+
+func (e *Epoch) fromStructured(se structuredEpoch) error {
+	var ep Epoch
+	if se.Read != nil {
+		if len(*se.Read) == 0 {
+			return &EpochError{Message: "read list cannot be explicitly empty"}
+		}
+		ep.Read = *se.Read
+	}
+	if se.Write != nil {
+		if len(*se.Write) == 0 {
+			return &EpochError{Message: "write list cannot be explicitly empty"}
+		}
+		ep.Write = *se.Write
+	}
+	if ep.Read == nil && ep.Write != nil {
+		ep.Read = ep.Write
+	}
+	if ep.Write == nil && ep.Read != nil {
+		ep.Write = ep.Read[len(ep.Read)-1:]
+	}
+	if err := ep.Validate(); err != nil {
+		return err
+	}
+	*e = ep.simplified()
+	return nil
+}
+
+// simplified returns the zero epoch if the epoch is equivalent to it.
+func (e Epoch) simplified() Epoch {
+	if len(e.Read) == 1 && len(e.Write) == 1 && e.Read[0] == 0 && e.Write[0] == 0 {
+		return Epoch{}
+	}
+	return e
+}
+
+func (e *Epoch) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		ep, err := ParseEpoch(s)
+		if err != nil {
+			return err
+		}
+		*e = ep
+		return nil
+	}
+	var se structuredEpoch
+	if err := unmarshal(&se); err != nil {
+		return &EpochError{Message: "epoch must be a number, a number followed by '*', or a read/write map"}
+	}
+	return e.fromStructured(se)
+}
+
+func (e *Epoch) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*e = Epoch{}
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		var se structuredEpoch
+		if err := json.Unmarshal(data, &se); err != nil {
+			return &EpochError{Message: err.Error()}
+		}
+		return e.fromStructured(se)
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return &EpochError{Message: err.Error()}
+		}
+	} else {
+		s = string(data)
+	}
+	ep, err := ParseEpoch(s)
+	if err != nil {
+		return err
+	}
+	*e = ep
+	return nil
+}
+
+func (e Epoch) MarshalJSON() ([]byte, error) {
+	read, write := e.lists()
+	return json.Marshal(struct {
+		Read  []uint32 `json:"read"`
+		Write []uint32 `json:"write"`
+	}{read, write})
+}
+
+// lists returns the read and write lists of the epoch, taking the zero
+// value into account.
+func (e Epoch) lists() (read, write []uint32) {
+	read, write = e.Read, e.Write
+	if len(read) == 0 {
+		read = []uint32{0}
+	}
+	if len(write) == 0 {
+		write = []uint32{0}
+	}
+	return read, write
+}
+
+// IsZero returns whether the epoch is the default epoch 0.
+func (e Epoch) IsZero() bool {
+	read, write := e.lists()
+	return len(read) == 1 && len(write) == 1 && read[0] == 0 && write[0] == 0
+}
+
+// Validate checks that the epoch is well formed.
+func (e Epoch) Validate() error {
+	if e.Read == nil && e.Write == nil {
+		return nil
+	}
+	if len(e.Read) == 0 || len(e.Write) == 0 {
+		return &EpochError{Message: "read and write lists must both be set"}
+	}
+	for _, l := range [][]uint32{e.Read, e.Write} {
+		if len(l) > maxEpochLength {
+			return &EpochError{Message: fmt.Sprintf("read and write lists cannot have more than %d items", maxEpochLength)}
+		}
+		for i := 1; i < len(l); i++ {
+			if l[i] <= l[i-1] {
+				return &EpochError{Message: "read and write lists must be in strictly increasing order"}
+			}
+		}
+	}
+	if !intersects(e.Read, e.Write) {
+		return &EpochError{Message: "read and write lists must have at least one item in common"}
+	}
+	return nil
+}
+
+func (e Epoch) String() string {
+	read, write := e.lists()
+	if len(write) == 1 {
+		w := write[0]
+		if len(read) == 1 && read[0] == w {
+			return strconv.FormatUint(uint64(w), 10)
+		}
+		if len(read) == 2 && w > 0 && read[0] == w-1 && read[1] == w {
+			return strconv.FormatUint(uint64(w), 10) + "*"
+		}
+	}
+	buf, err := e.MarshalJSON()
+	if err != nil {
+		// can't happen
+		return fmt.Sprintf("%v/%v", read, write)
+	}
+	return string(buf)
+}
+
+// CanRead returns whether a snap with this epoch can read the data
+// written by a snap with the other epoch.
+func (e Epoch) CanRead(other Epoch) bool {
+	read, _ := e.lists()
+	_, write := other.lists()
+	return intersects(read, write)
+}
+
+// intersects returns whether the two strictly increasing lists have an
+// item in common.
+func intersects(a, b []uint32) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			return true
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap_test
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/snap"
+)
+
+type epochSuite struct{}
+
+var _ = Suite(&epochSuite{})
+
+var badEpochs = []struct {
+	value string
+	err   string
+}{
+	{value: `"rubbish"`, err: `invalid epoch: "rubbish" is not a valid epoch`},
+	{value: `"0*"`, err: `invalid epoch: "0\*" is not a valid epoch`},
+	{value: `"1**"`, err: `invalid epoch: "1\*\*" is not a valid epoch`},
+	{value: `"-1"`, err: `invalid epoch: "-1" is not a valid epoch`},
+	{value: `"01"`, err: `invalid epoch: "01" is not a valid epoch`},
+	{value: `"99999999999"`, err: `invalid epoch: "99999999999" is out of range`},
+	{value: `{"read": []}`, err: `invalid epoch: read list cannot be explicitly empty`},
+	{value: `{"write": []}`, err: `invalid epoch: write list cannot be explicitly empty`},
+	{value: `{"read": [2, 1]}`, err: `invalid epoch: read and write lists must be in strictly increasing order`},
+	{value: `{"read": [1, 1]}`, err: `invalid epoch: read and write lists must be in strictly increasing order`},
+	{value: `{"read": [1], "write": [2]}`, err: `invalid epoch: read and write lists must have at least one item in common`},
+	{value: `{"read": [0,1,2,3,4,5,6,7,8,9,10]}`, err: `invalid epoch: read and write lists cannot have more than 10 items`},
+}
+
+var goodEpochs = []struct {
+	value string
+	epoch snap.Epoch
+	str   string
+}{
+	{value: `0`, epoch: snap.Epoch{}, str: "0"},
+	{value: `null`, epoch: snap.Epoch{}, str: "0"},
+	{value: `""`, epoch: snap.Epoch{}, str: "0"},
+	{value: `"0"`, epoch: snap.Epoch{}, str: "0"},
+	{value: `{}`, epoch: snap.Epoch{}, str: "0"},
+	{value: `{"read": [0], "write": [0]}`, epoch: snap.Epoch{}, str: "0"},
+	{value: `1`, epoch: snap.Epoch{Read: []uint32{1}, Write: []uint32{1}}, str: "1"},
+	{value: `"1"`, epoch: snap.Epoch{Read: []uint32{1}, Write: []uint32{1}}, str: "1"},
+	{value: `"1*"`, epoch: snap.Epoch{Read: []uint32{0, 1}, Write: []uint32{1}}, str: "1*"},
+	{value: `"400*"`, epoch: snap.Epoch{Read: []uint32{399, 400}, Write: []uint32{400}}, str: "400*"},
+	{value: `{"read": [1, 2]}`, epoch: snap.Epoch{Read: []uint32{1, 2}, Write: []uint32{2}}, str: "2*"},
+	{value: `{"write": [3]}`, epoch: snap.Epoch{Read: []uint32{3}, Write: []uint32{3}}, str: "3"},
+	{value: `{"read": [1, 2, 3], "write": [1, 3]}`, epoch: snap.Epoch{Read: []uint32{1, 2, 3}, Write: []uint32{1, 3}}, str: `{"read":[1,2,3],"write":[1,3]}`},
+}
+
+func (s *epochSuite) TestBadEpochsJSON(c *C) {
+	for _, test := range badEpochs {
+		var e snap.Epoch
+		err := json.Unmarshal([]byte(test.value), &e)
+		c.Check(err, ErrorMatches, test.err, Commentf("%s", test.value))
+	}
+}
+
+func (s *epochSuite) TestBadEpochsYAML(c *C) {
+	for _, test := range badEpochs {
+		var e snap.Epoch
+		err := yaml.Unmarshal([]byte(test.value), &e)
+		c.Check(err, ErrorMatches, test.err, Commentf("%s", test.value))
+	}
+}
+
+func (s *epochSuite) TestGoodEpochsJSON(c *C) {
+	for _, test := range goodEpochs {
+		var e snap.Epoch
+		err := json.Unmarshal([]byte(test.value), &e)
+		c.Assert(err, IsNil, Commentf("%s", test.value))
+		c.Check(e, DeepEquals, test.epoch, Commentf("%s", test.value))
+		c.Check(e.String(), Equals, test.str, Commentf("%s", test.value))
+		c.Check(e.Validate(), IsNil, Commentf("%s", test.value))
+	}
+}
+
+func (s *epochSuite) TestGoodEpochsYAML(c *C) {
+	for _, test := range goodEpochs {
+		if test.value == `""` {
+			// the yaml package does not call UnmarshalYAML for empty strings
+			continue
+		}
+		var e snap.Epoch
+		err := yaml.Unmarshal([]byte(test.value), &e)
+		c.Assert(err, IsNil, Commentf("%s", test.value))
+		c.Check(e, DeepEquals, test.epoch, Commentf("%s", test.value))
+	}
+}
+
+func (s *epochSuite) TestGoodEpochsInSnapYAML(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte(`name: foo
+version: 1.0
+epoch:
+  read: [1, 2]
+  write: [2]
+`))
+	c.Assert(err, IsNil)
+	c.Check(info.Epoch, DeepEquals, snap.E("2*"))
+}
+
+func (s *epochSuite) TestEpochMarshalJSON(c *C) {
+	for _, test := range goodEpochs {
+		bs, err := json.Marshal(test.epoch)
+		c.Assert(err, IsNil)
+		var e snap.Epoch
+		c.Assert(json.Unmarshal(bs, &e), IsNil)
+		c.Check(e, DeepEquals, test.epoch, Commentf("%s", test.value))
+	}
+
+	bs, err := json.Marshal(snap.Epoch{})
+	c.Assert(err, IsNil)
+	c.Check(string(bs), Equals, `{"read":[0],"write":[0]}`)
+	bs, err = json.Marshal(snap.E("1*"))
+	c.Assert(err, IsNil)
+	c.Check(string(bs), Equals, `{"read":[0,1],"write":[1]}`)
+}
+
+func (s *epochSuite) TestE(c *C) {
+	c.Check(snap.E("0"), DeepEquals, snap.Epoch{})
+	c.Check(snap.E("2*"), DeepEquals, snap.Epoch{Read: []uint32{1, 2}, Write: []uint32{2}})
+	c.Check(func() { snap.E("0*") }, PanicMatches, `invalid epoch: "0\*" is not a valid epoch`)
+}
+
+func (s *epochSuite) TestCanRead(c *C) {
+	tests := []struct {
+		a, b    snap.Epoch
+		canRead bool
+	}{
+		{snap.E("0"), snap.E("0"), true},
+		{snap.E("1"), snap.E("0"), false},
+		{snap.E("0"), snap.E("1"), false},
+		{snap.E("1*"), snap.E("0"), true},
+		{snap.E("0"), snap.E("1*"), false},
+		{snap.E("1*"), snap.E("1"), true},
+		{snap.E("2*"), snap.E("1*"), true},
+		{snap.E("2*"), snap.E("0"), false},
+		{snap.Epoch{Read: []uint32{1, 2, 3}, Write: []uint32{3}}, snap.E("2"), true},
+		{snap.Epoch{Read: []uint32{1, 3}, Write: []uint32{3}}, snap.E("2"), false},
+	}
+	for i, test := range tests {
+		c.Check(test.a.CanRead(test.b), Equals, test.canRead, Commentf("#%d: %s can read %s?", i, test.a, test.b))
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -33,6 +35,85 @@ type GadgetInfo struct {
 
 	// Default configuration for snaps (snap-id => key => value).
 	Defaults map[string]map[string]interface{} `yaml:"defaults,omitempty"`
+
+	// Connections to establish once the involved snaps are installed.
+	Connections []GadgetConnection `yaml:"connections,omitempty"`
+}
+
+// GadgetConnection describes an interface connection requested by the
+// gadget, with plug and slot given as <snap-id>:<name>. The slot can
+// also be given as system:<name> to refer to the system snap.
+type GadgetConnection struct {
+	Plug GadgetConnectionPlug `yaml:"plug"`
+	Slot GadgetConnectionSlot `yaml:"slot"`
+}
+
+// GadgetConnectionPlug is the plug side of a gadget connection.
+type GadgetConnectionPlug struct {
+	SnapID string
+	Plug   string
+}
+
+// GadgetConnectionSlot is the slot side of a gadget connection. An
+// empty SnapID refers to the system snap.
+type GadgetConnectionSlot struct {
+	SnapID string
+	Slot   string
+}
+
+// systemSnapID is used in gadget connection slots in place of the
+// snap-id to refer to the system snap.
+const systemSnapID = "system"
+
+var validSnapID = regexp.MustCompile("^[a-zA-Z0-9]{32}$")
+var validPlugOrSlotName = regexp.MustCompile("^[a-z](?:-?[a-z0-9])*$")
+
+func parseGadgetConnectionEnd(what, s string) (snapID, name string, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("gadget connection %s must be of the form <snap-id>:<name>, not %q", what, s)
+	}
+	snapID, name = parts[0], parts[1]
+	if !validPlugOrSlotName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid gadget connection %s name: %q", what, name)
+	}
+	return snapID, name, nil
+}
+
+func (p *GadgetConnectionPlug) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	snapID, name, err := parseGadgetConnectionEnd("plug", s)
+	if err != nil {
+		return err
+	}
+	if !validSnapID.MatchString(snapID) {
+		return fmt.Errorf("invalid gadget connection plug snap-id: %q", snapID)
+	}
+	p.SnapID = snapID
+	p.Plug = name
+	return nil
+}
+
+func (sl *GadgetConnectionSlot) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	snapID, name, err := parseGadgetConnectionEnd("slot", s)
+	if err != nil {
+		return err
+	}
+	if snapID == systemSnapID {
+		snapID = ""
+	} else if !validSnapID.MatchString(snapID) {
+		return fmt.Errorf("invalid gadget connection slot snap-id: %q", snapID)
+	}
+	sl.SnapID = snapID
+	sl.Slot = name
+	return nil
 }
 
 type GadgetVolume struct {
@@ -95,9 +176,18 @@ func ReadGadgetInfo(info *Info, classic bool) (*GadgetInfo, error) {
 		return nil, fmt.Errorf(errorFormat, err)
 	}
 
+	for _, conn := range gi.Connections {
+		if conn.Plug.Plug == "" {
+			return nil, fmt.Errorf(errorFormat, "gadget connection plug cannot be empty")
+		}
+		if conn.Slot.Slot == "" {
+			return nil, fmt.Errorf(errorFormat, "gadget connection slot cannot be empty")
+		}
+	}
+
 	if classic && len(gi.Volumes) == 0 {
 		// volumes can be left out on classic
-		// can still specify defaults though
+		// can still specify defaults and connections though
 		return &gi, nil
 	}
 
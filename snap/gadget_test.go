@@ -20,8 +20,11 @@
 package snap_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	. "gopkg.in/check.v1"
 
@@ -215,3 +218,73 @@ func (s *gadgetYamlTestSuite) TestReadGadgetYamlMissingBootloader(c *C) {
 	_, err = snap.ReadGadgetInfo(info, false)
 	c.Assert(err, ErrorMatches, "cannot read gadget snap details: bootloader not declared in any volume")
 }
+
+var mockClassicGadgetConnectionsYaml = []byte(`
+connections:
+  - plug: snapidsnapidsnapidsnapidsnapid01:plug
+    slot: snapidsnapidsnapidsnapidsnapid02:slot
+  - plug: snapidsnapidsnapidsnapidsnapid01:network-control
+    slot: system:network-control
+`)
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlOnClassicConnectionsIsValid(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, mockGadgetSnapContents, &snap.SideInfo{Revision: snap.R(42)})
+	err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), mockClassicGadgetConnectionsYaml, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := snap.ReadGadgetInfo(info, true)
+	c.Assert(err, IsNil)
+	c.Assert(ginfo, DeepEquals, &snap.GadgetInfo{
+		Connections: []snap.GadgetConnection{
+			{
+				Plug: snap.GadgetConnectionPlug{SnapID: "snapidsnapidsnapidsnapidsnapid01", Plug: "plug"},
+				Slot: snap.GadgetConnectionSlot{SnapID: "snapidsnapidsnapidsnapidsnapid02", Slot: "slot"},
+			},
+			{
+				Plug: snap.GadgetConnectionPlug{SnapID: "snapidsnapidsnapidsnapidsnapid01", Plug: "network-control"},
+				Slot: snap.GadgetConnectionSlot{SnapID: "", Slot: "network-control"},
+			},
+		},
+	})
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlInvalidConnections(c *C) {
+	info := snaptest.MockSnap(c, mockGadgetSnapYaml, mockGadgetSnapContents, &snap.SideInfo{Revision: snap.R(42)})
+
+	for _, t := range []struct {
+		plug string
+		slot string
+		err  string
+	}{
+		{"snapidsnapidsnapidsnapidsnapid01", "system:network",
+			`gadget connection plug must be of the form <snap-id>:<name>, not "snapidsnapidsnapidsnapidsnapid01"`},
+		{"short:plug", "system:network",
+			`invalid gadget connection plug snap-id: "short"`},
+		{"system:plug", "system:network",
+			`invalid gadget connection plug snap-id: "system"`},
+		{"snapidsnapidsnapidsnapidsnapid01:Plug", "system:network",
+			`invalid gadget connection plug name: "Plug"`},
+		{"snapidsnapidsnapidsnapidsnapid01:plug", ":network",
+			`gadget connection slot must be of the form <snap-id>:<name>, not ":network"`},
+		{"snapidsnapidsnapidsnapidsnapid01:plug", "short:network",
+			`invalid gadget connection slot snap-id: "short"`},
+		{"", "system:network",
+			`gadget connection plug cannot be empty`},
+		{"snapidsnapidsnapidsnapidsnapid01:plug", "",
+			`gadget connection slot cannot be empty`},
+	} {
+		var entries []string
+		if t.plug != "" {
+			entries = append(entries, fmt.Sprintf("plug: %q", t.plug))
+		}
+		if t.slot != "" {
+			entries = append(entries, fmt.Sprintf("slot: %q", t.slot))
+		}
+		gadgetYaml := "connections:\n  - " + strings.Join(entries, "\n    ") + "\n"
+		err := ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "gadget.yaml"), []byte(gadgetYaml), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = snap.ReadGadgetInfo(info, true)
+		c.Check(err, ErrorMatches, "cannot read gadget snap details: "+regexp.QuoteMeta(t.err), Commentf(gadgetYaml))
+	}
+}
@@ -134,6 +134,9 @@ type Info struct {
 	Type          Type
 	Architectures []string
 	Assumes       []string
+	// Base is the name of the snap providing the root filesystem of
+	// the snap, if not the core snap.
+	Base string
 
 	OriginalSummary     string
 	OriginalDescription string
@@ -142,7 +145,7 @@ type Info struct {
 
 	LicenseAgreement string
 	LicenseVersion   string
-	Epoch            string
+	Epoch            Epoch
 	Confinement      ConfinementType
 	Apps             map[string]*AppInfo
 	Aliases          map[string]*AppInfo
@@ -150,6 +153,9 @@ type Info struct {
 	Plugs            map[string]*PlugInfo
 	Slots            map[string]*SlotInfo
 
+	// Layout maps absolute paths to their desired layout.
+	Layout map[string]*Layout
+
 	// The information in all the remaining fields is not sourced from the snap blob itself.
 	SideInfo
 
@@ -177,7 +183,7 @@ type ChannelSnapInfo struct {
 	Confinement ConfinementType `json:"confinement"`
 	Version     string          `json:"version"`
 	Channel     string          `json:"channel"`
-	Epoch       string          `json:"epoch"`
+	Epoch       Epoch           `json:"epoch"`
 	Size        int64           `json:"size"`
 }
 
@@ -255,6 +261,23 @@ func (s *Info) CommonDataHomeDir() string {
 	return filepath.Join(dirs.SnapDataHomeGlob, s.Name(), "common")
 }
 
+// ExpandSnapVariables resolves $SNAP, $SNAP_DATA and $SNAP_COMMON inside the
+// given path to the corresponding directories of the snap. Other variables
+// are left untouched.
+func (s *Info) ExpandSnapVariables(path string) string {
+	return os.Expand(path, func(v string) string {
+		switch v {
+		case "SNAP":
+			return s.MountDir()
+		case "SNAP_DATA":
+			return s.DataDir()
+		case "SNAP_COMMON":
+			return s.CommonDataDir()
+		}
+		return "$" + v
+	})
+}
+
 // UserXdgRuntimeDir returns the XDG_RUNTIME_DIR directory of the snap for a particular user.
 func (s *Info) UserXdgRuntimeDir(euid int) string {
 	return filepath.Join("/run/user", fmt.Sprintf("%d/snap.%s", euid, s.Name()))
@@ -394,6 +417,22 @@ type HookInfo struct {
 	Plugs map[string]*PlugInfo
 }
 
+// Layout describes a single element of the layout section of a snap.
+//
+// Exactly one of Bind, BindFile, Type or Symlink is set. Bind and BindFile
+// make a directory or a file from the snap appear at Path, Type creates a
+// fresh filesystem of that type there and Symlink replaces Path with a
+// symbolic link. The sources may refer to $SNAP, $SNAP_DATA and $SNAP_COMMON.
+type Layout struct {
+	Snap *Info
+
+	Path     string
+	Bind     string
+	BindFile string
+	Type     string
+	Symlink  string
+}
+
 // SecurityTag returns application-specific security tag.
 //
 // Security tags are used by various security subsystems as "profile names" and
@@ -444,9 +483,19 @@ func (app *AppInfo) LauncherPostStopCommand() string {
 	return app.launcherCommand("--command=post-stop")
 }
 
+// IsService returns whether the app is a daemon run as a systemd service.
+func (app *AppInfo) IsService() bool {
+	return app.Daemon != ""
+}
+
+// ServiceName returns the systemd service name for the daemon app.
+func (app *AppInfo) ServiceName() string {
+	return app.SecurityTag() + ".service"
+}
+
 // ServiceFile returns the systemd service file path for the daemon app.
 func (app *AppInfo) ServiceFile() string {
-	return filepath.Join(dirs.SnapServicesDir, app.SecurityTag()+".service")
+	return filepath.Join(dirs.SnapServicesDir, app.ServiceName())
 }
 
 // ServiceSocketFile returns the systemd socket file path for the daemon app.
@@ -37,17 +37,19 @@ type snapYaml struct {
 	Type             Type                   `yaml:"type"`
 	Architectures    []string               `yaml:"architectures,omitempty"`
 	Assumes          []string               `yaml:"assumes"`
+	Base             string                 `yaml:"base,omitempty"`
 	Description      string                 `yaml:"description"`
 	Summary          string                 `yaml:"summary"`
 	LicenseAgreement string                 `yaml:"license-agreement,omitempty"`
 	LicenseVersion   string                 `yaml:"license-version,omitempty"`
-	Epoch            string                 `yaml:"epoch,omitempty"`
+	Epoch            Epoch                  `yaml:"epoch,omitempty"`
 	Confinement      ConfinementType        `yaml:"confinement,omitempty"`
 	Environment      strutil.OrderedMap     `yaml:"environment,omitempty"`
 	Plugs            map[string]interface{} `yaml:"plugs,omitempty"`
 	Slots            map[string]interface{} `yaml:"slots,omitempty"`
 	Apps             map[string]appYaml     `yaml:"apps,omitempty"`
 	Hooks            map[string]hookYaml    `yaml:"hooks,omitempty"`
+	Layout           map[string]layoutYaml  `yaml:"layout,omitempty"`
 }
 
 type appYaml struct {
@@ -75,6 +77,13 @@ type hookYaml struct {
 	PlugNames []string `yaml:"plugs,omitempty"`
 }
 
+type layoutYaml struct {
+	Bind     string `yaml:"bind,omitempty"`
+	BindFile string `yaml:"bind-file,omitempty"`
+	Type     string `yaml:"type,omitempty"`
+	Symlink  string `yaml:"symlink,omitempty"`
+}
+
 // InfoFromSnapYaml creates a new info based on the given snap.yaml data
 func InfoFromSnapYaml(yamlData []byte) (*Info, error) {
 	var y snapYaml
@@ -118,6 +127,9 @@ func InfoFromSnapYaml(yamlData []byte) (*Info, error) {
 	// Bind unbound slots to all apps
 	bindUnboundSlots(globalSlotNames, snap)
 
+	// Collect layout elements
+	setLayoutFromSnapYaml(y, snap)
+
 	// FIXME: validation of the fields
 	return snap, nil
 }
@@ -134,10 +146,6 @@ func infoSkeletonFromSnapYaml(y snapYaml) *Info {
 	if y.Type != "" {
 		typ = y.Type
 	}
-	epoch := "0"
-	if y.Epoch != "" {
-		epoch = y.Epoch
-	}
 	confinement := StrictConfinement
 	if y.Confinement != "" {
 		confinement = y.Confinement
@@ -150,11 +158,12 @@ func infoSkeletonFromSnapYaml(y snapYaml) *Info {
 		Type:                typ,
 		Architectures:       architectures,
 		Assumes:             y.Assumes,
+		Base:                y.Base,
 		OriginalDescription: y.Description,
 		OriginalSummary:     y.Summary,
 		LicenseAgreement:    y.LicenseAgreement,
 		LicenseVersion:      y.LicenseVersion,
-		Epoch:               epoch,
+		Epoch:               y.Epoch,
 		Confinement:         confinement,
 		Apps:                make(map[string]*AppInfo),
 		Aliases:             make(map[string]*AppInfo),
@@ -314,6 +323,23 @@ func setHooksFromSnapYaml(y snapYaml, snap *Info) {
 	}
 }
 
+func setLayoutFromSnapYaml(y snapYaml, snap *Info) {
+	if len(y.Layout) == 0 {
+		return
+	}
+	snap.Layout = make(map[string]*Layout, len(y.Layout))
+	for path, l := range y.Layout {
+		snap.Layout[path] = &Layout{
+			Snap:     snap,
+			Path:     path,
+			Bind:     l.Bind,
+			BindFile: l.BindFile,
+			Type:     l.Type,
+			Symlink:  l.Symlink,
+		}
+	}
+}
+
 func bindUnboundPlugs(plugNames []string, snap *Info) error {
 	for _, plugName := range plugNames {
 		plug, ok := snap.Plugs[plugName]
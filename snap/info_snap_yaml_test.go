@@ -1088,7 +1088,7 @@ slots:
 	c.Check(info.Name(), Equals, "foo")
 	c.Check(info.Version, Equals, "1.2")
 	c.Check(info.Type, Equals, snap.TypeApp)
-	c.Check(info.Epoch, Equals, "1*")
+	c.Check(info.Epoch, DeepEquals, snap.E("1*"))
 	c.Check(info.Confinement, Equals, snap.DevModeConfinement)
 	c.Check(info.Summary(), Equals, "foo app")
 	c.Check(info.Description(), Equals, "Foo provides useful services\n")
@@ -1226,7 +1226,17 @@ version: 1.0
 `)
 	info, err := snap.InfoFromSnapYaml(y)
 	c.Assert(err, IsNil)
-	c.Assert(info.Epoch, Equals, "0")
+	c.Assert(info.Epoch.IsZero(), Equals, true)
+}
+
+func (s *YamlSuite) TestSnapYamlBase(c *C) {
+	y := []byte(`name: binary
+version: 1.0
+base: some-base
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+	c.Check(info.Base, Equals, "some-base")
 }
 
 func (s *YamlSuite) TestSnapYamlConfinementDefault(c *C) {
@@ -1426,3 +1436,50 @@ apps:
 	_, err := snap.InfoFromSnapYaml(y)
 	c.Assert(err, ErrorMatches, `cannot set "bar" as alias for both ("foo" and "bar"|"bar" and "foo")`)
 }
+
+func (s *YamlSuite) TestSnapYamlLayout(c *C) {
+	y := []byte(`name: foo
+version: 1.0
+layout:
+  /usr/share/foo:
+    bind: $SNAP/usr/share/foo
+  /etc/foo.conf:
+    bind-file: $SNAP_DATA/foo.conf
+  /var/cache/foo:
+    type: tmpfs
+  /usr/lib/foo:
+    symlink: $SNAP/lib/foo
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+	c.Assert(info.Layout, HasLen, 4)
+	c.Check(info.Layout["/usr/share/foo"], DeepEquals, &snap.Layout{
+		Snap: info,
+		Path: "/usr/share/foo",
+		Bind: "$SNAP/usr/share/foo",
+	})
+	c.Check(info.Layout["/etc/foo.conf"], DeepEquals, &snap.Layout{
+		Snap:     info,
+		Path:     "/etc/foo.conf",
+		BindFile: "$SNAP_DATA/foo.conf",
+	})
+	c.Check(info.Layout["/var/cache/foo"], DeepEquals, &snap.Layout{
+		Snap: info,
+		Path: "/var/cache/foo",
+		Type: "tmpfs",
+	})
+	c.Check(info.Layout["/usr/lib/foo"], DeepEquals, &snap.Layout{
+		Snap:    info,
+		Path:    "/usr/lib/foo",
+		Symlink: "$SNAP/lib/foo",
+	})
+}
+
+func (s *YamlSuite) TestSnapYamlNoLayout(c *C) {
+	y := []byte(`name: foo
+version: 1.0
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+	c.Check(info.Layout, IsNil)
+}
@@ -79,6 +79,14 @@ func (s *infoSuite) TestAppInfoSecurityTag(c *C) {
 	c.Check(appInfo.SecurityTag(), Equals, "snap.http.GET")
 }
 
+func (s *infoSuite) TestAppInfoService(c *C) {
+	appInfo := &snap.AppInfo{Snap: &snap.Info{SuggestedName: "http"}, Name: "GET"}
+	c.Check(appInfo.IsService(), Equals, false)
+	appInfo.Daemon = "simple"
+	c.Check(appInfo.IsService(), Equals, true)
+	c.Check(appInfo.ServiceName(), Equals, "snap.http.GET.service")
+}
+
 func (s *infoSuite) TestPlugSlotSecurityTags(c *C) {
 	info, err := snap.InfoFromSnapYaml([]byte(`name: name
 apps:
@@ -198,7 +206,7 @@ confinement: devmode`
 	c.Check(info.Version, Equals, "1.0")
 	c.Check(info.Type, Equals, snap.TypeApp)
 	c.Check(info.Revision, Equals, snap.R(0))
-	c.Check(info.Epoch, Equals, "1*")
+	c.Check(info.Epoch, DeepEquals, snap.E("1*"))
 	c.Check(info.Confinement, Equals, snap.DevModeConfinement)
 }
 
@@ -217,7 +225,7 @@ type: app`
 	c.Check(info.Version, Equals, "1.0")
 	c.Check(info.Type, Equals, snap.TypeApp)
 	c.Check(info.Revision, Equals, snap.R(0))
-	c.Check(info.Epoch, Equals, "0") // Defaults to 0
+	c.Check(info.Epoch.IsZero(), Equals, true) // Defaults to 0
 }
 
 func (s *infoSuite) TestReadInfoFromSnapFileWithSideInfo(c *C) {
@@ -501,3 +509,14 @@ func (s *infoSuite) TestDirAndFileMethods(c *C) {
 	c.Check(info.CommonDataHomeDir(), Equals, "/home/*/snap/name/common")
 	c.Check(info.XdgRuntimeDirs(), Equals, "/run/user/*/snap.name")
 }
+
+func (s *infoSuite) TestExpandSnapVariables(c *C) {
+	dirs.SetRootDir("")
+	info := &snap.Info{SuggestedName: "name", SideInfo: snap.SideInfo{Revision: snap.R(42)}}
+	c.Check(info.ExpandSnapVariables("$SNAP/stuff"), Equals, fmt.Sprintf("%s/name/42/stuff", dirs.SnapMountDir))
+	c.Check(info.ExpandSnapVariables("$SNAP_DATA/stuff"), Equals, "/var/snap/name/42/stuff")
+	c.Check(info.ExpandSnapVariables("$SNAP_COMMON/stuff"), Equals, "/var/snap/name/common/stuff")
+	c.Check(info.ExpandSnapVariables("$SNAP_COMMON"), Equals, "/var/snap/name/common")
+	c.Check(info.ExpandSnapVariables("$HOME/stuff"), Equals, "$HOME/stuff")
+	c.Check(info.ExpandSnapVariables("/no/variables"), Equals, "/no/variables")
+}
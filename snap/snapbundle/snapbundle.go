@@ -0,0 +1,233 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package snapbundle reads and writes snap bundles, single archives
+// of snap files together with the assertions needed to install them
+// on systems without access to the store.
+package snapbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/snap"
+)
+
+// assertionsName is the name of the archive member holding the
+// assertions of the bundle. It is always the first member.
+const assertionsName = "bundle.assert"
+
+// CoreSnapName is the name of the snap providing the root filesystem
+// of snaps without a base.
+const CoreSnapName = "core"
+
+// Bundle is the content of a snap bundle.
+type Bundle struct {
+	// Snaps are the paths of the snap files of the bundle.
+	Snaps []string
+	// Assertions are the assertions needed to install the snaps,
+	// including all their prerequisites.
+	Assertions []asserts.Assertion
+}
+
+func writeMember(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+func writeSnap(tw *tar.Writer, snapPath string) error {
+	f, err := os.Open(snapPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeMember(tw, filepath.Base(snapPath), st.Size(), f)
+}
+
+// Write writes to w a bundle of the given snap files and assertions.
+func Write(w io.Writer, snapPaths []string, assertions []asserts.Assertion) error {
+	var buf bytes.Buffer
+	enc := asserts.NewEncoder(&buf)
+	for _, a := range assertions {
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeMember(tw, assertionsName, int64(buf.Len()), &buf); err != nil {
+		return err
+	}
+	for _, snapPath := range snapPaths {
+		if err := writeSnap(tw, snapPath); err != nil {
+			return fmt.Errorf("cannot add %q to bundle: %v", snapPath, err)
+		}
+	}
+	return tw.Close()
+}
+
+// Create writes the bundle of the given snap files and assertions to bundlePath.
+func Create(bundlePath string, snapPaths []string, assertions []asserts.Assertion) (err error) {
+	partialPath := bundlePath + ".partial"
+	f, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(partialPath, bundlePath)
+		}
+		if err != nil {
+			os.Remove(partialPath)
+		}
+	}()
+
+	return Write(f, snapPaths, assertions)
+}
+
+func readAssertions(r io.Reader) ([]asserts.Assertion, error) {
+	var assertions []asserts.Assertion
+	dec := asserts.NewDecoder(r)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return assertions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, a)
+	}
+}
+
+func extractSnap(dir, name string, r io.Reader) (snapPath string, err error) {
+	snapPath = filepath.Join(dir, name)
+	f, err := os.OpenFile(snapPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	return snapPath, err
+}
+
+// Extract extracts the snap files of the bundle read from r into dir,
+// returning the content of the bundle. The assertions are decoded but
+// not checked.
+func Extract(r io.Reader, dir string) (*Bundle, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != assertionsName {
+		return nil, fmt.Errorf("cannot read bundle: no %s as first member", assertionsName)
+	}
+	assertions, err := readAssertions(tr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bundle assertions: %v", err)
+	}
+
+	bundle := &Bundle{Assertions: assertions}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read bundle: %v", err)
+		}
+		name := hdr.Name
+		if hdr.Typeflag != tar.TypeReg || filepath.Base(name) != name || !strings.HasSuffix(name, ".snap") {
+			return nil, fmt.Errorf("cannot read bundle: unexpected member %q", name)
+		}
+		snapPath, err := extractSnap(dir, name, tr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot extract %q from bundle: %v", name, err)
+		}
+		bundle.Snaps = append(bundle.Snaps, snapPath)
+	}
+	if len(bundle.Snaps) == 0 {
+		return nil, fmt.Errorf("cannot read bundle: no snaps")
+	}
+	return bundle, nil
+}
+
+// Prerequisites returns the names of the snaps that need to be
+// installed before the snap described by info: its base, or the core
+// snap for snaps other than the core snap itself, and the default
+// providers of its content plugs.
+func Prerequisites(info *snap.Info) []string {
+	var prereqs []string
+	switch {
+	case info.Base != "":
+		prereqs = append(prereqs, info.Base)
+	case info.Type != snap.TypeOS:
+		prereqs = append(prereqs, CoreSnapName)
+	}
+
+	plugNames := make([]string, 0, len(info.Plugs))
+	for plugName := range info.Plugs {
+		plugNames = append(plugNames, plugName)
+	}
+	sort.Strings(plugNames)
+	seen := map[string]bool{info.Name(): true}
+	for _, plugName := range plugNames {
+		plug := info.Plugs[plugName]
+		if plug.Interface != "content" {
+			continue
+		}
+		dprovider, _ := plug.Attrs["default-provider"].(string)
+		// default-provider is <snap>[:<slot>]
+		provider := strings.SplitN(dprovider, ":", 2)[0]
+		if provider == "" || seen[provider] {
+			continue
+		}
+		seen[provider] = true
+		prereqs = append(prereqs, provider)
+	}
+	return prereqs
+}
@@ -0,0 +1,155 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapbundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapbundle"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type bundleSuite struct {
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&bundleSuite{})
+
+func (s *bundleSuite) SetUpSuite(c *C) {
+	rootPrivKey, _ := assertstest.GenerateKey(752)
+	storePrivKey, _ := assertstest.GenerateKey(752)
+	s.storeSigning = assertstest.NewStoreStack("can0nical", rootPrivKey, storePrivKey)
+}
+
+func (s *bundleSuite) makeSnaps(c *C) []string {
+	dir := c.MkDir()
+	var snapPaths []string
+	for _, name := range []string{"core_1.snap", "foo_2.snap"} {
+		snapPath := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(snapPath, []byte(name+" content"), 0644), IsNil)
+		snapPaths = append(snapPaths, snapPath)
+	}
+	return snapPaths
+}
+
+func (s *bundleSuite) TestCreateAndExtract(c *C) {
+	snapPaths := s.makeSnaps(c)
+	assertions := []asserts.Assertion{s.storeSigning.TrustedAccount, s.storeSigning.StoreAccountKey("")}
+
+	bundlePath := filepath.Join(c.MkDir(), "core+foo.bundle")
+	err := snapbundle.Create(bundlePath, snapPaths, assertions)
+	c.Assert(err, IsNil)
+	_, err = os.Stat(bundlePath + ".partial")
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	f, err := os.Open(bundlePath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	dir := c.MkDir()
+	bundle, err := snapbundle.Extract(f, dir)
+	c.Assert(err, IsNil)
+	c.Check(bundle.Snaps, DeepEquals, []string{filepath.Join(dir, "core_1.snap"), filepath.Join(dir, "foo_2.snap")})
+	c.Assert(bundle.Assertions, HasLen, 2)
+	c.Check(bundle.Assertions[0].Ref(), DeepEquals, assertions[0].Ref())
+	c.Check(bundle.Assertions[1].Ref(), DeepEquals, assertions[1].Ref())
+
+	content, err := ioutil.ReadFile(bundle.Snaps[1])
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "foo_2.snap content")
+}
+
+func (s *bundleSuite) TestExtractNoAssertions(c *C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	c.Assert(tw.WriteHeader(&tar.Header{Name: "foo_2.snap", Mode: 0644, Typeflag: tar.TypeReg}), IsNil)
+	c.Assert(tw.Close(), IsNil)
+
+	_, err := snapbundle.Extract(&buf, c.MkDir())
+	c.Check(err, ErrorMatches, "cannot read bundle: no bundle.assert as first member")
+}
+
+func (s *bundleSuite) TestExtractNoSnaps(c *C) {
+	var buf bytes.Buffer
+	c.Assert(snapbundle.Write(&buf, nil, nil), IsNil)
+
+	_, err := snapbundle.Extract(&buf, c.MkDir())
+	c.Check(err, ErrorMatches, "cannot read bundle: no snaps")
+}
+
+func (s *bundleSuite) TestExtractUnexpectedMembers(c *C) {
+	for _, hdr := range []*tar.Header{
+		{Name: "../foo_2.snap", Mode: 0644, Typeflag: tar.TypeReg},
+		{Name: "foo_2.txt", Mode: 0644, Typeflag: tar.TypeReg},
+		{Name: "foo_2.snap", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "foo_2.snap", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		c.Assert(tw.WriteHeader(&tar.Header{Name: "bundle.assert", Mode: 0644, Typeflag: tar.TypeReg}), IsNil)
+		c.Assert(tw.WriteHeader(hdr), IsNil)
+		c.Assert(tw.Close(), IsNil)
+
+		dir := c.MkDir()
+		_, err := snapbundle.Extract(&buf, dir)
+		c.Check(err, ErrorMatches, `cannot read bundle: unexpected member ".*"`)
+		names, err := ioutil.ReadDir(dir)
+		c.Assert(err, IsNil)
+		c.Check(names, HasLen, 0)
+	}
+}
+
+func (s *bundleSuite) TestPrerequisites(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte(`name: foo
+version: 1
+plugs:
+  data:
+    interface: content
+    default-provider: provider-a:data
+  more-data:
+    interface: content
+    default-provider: provider-b
+  same-data:
+    interface: content
+    default-provider: provider-a
+  network:
+`))
+	c.Assert(err, IsNil)
+	c.Check(snapbundle.Prerequisites(info), DeepEquals, []string{"core", "provider-a", "provider-b"})
+
+	info, err = snap.InfoFromSnapYaml([]byte("name: foo\nversion: 1\nbase: some-base\n"))
+	c.Assert(err, IsNil)
+	c.Check(snapbundle.Prerequisites(info), DeepEquals, []string{"some-base"})
+
+	info, err = snap.InfoFromSnapYaml([]byte("name: core\nversion: 1\ntype: os\n"))
+	c.Assert(err, IsNil)
+	c.Check(snapbundle.Prerequisites(info), HasLen, 0)
+}
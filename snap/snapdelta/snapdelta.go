@@ -0,0 +1,224 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package snapdelta produces and applies binary deltas between snap files.
+package snapdelta
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// Format is the delta format used for snap deltas.
+const Format = "xdelta3"
+
+// magic starts the header line of a snap delta file.
+const magic = "snap-delta"
+
+// ErrNotDelta is returned when a file is not a snap delta.
+var ErrNotDelta = errors.New("not a snap delta file")
+
+// Header describes the snaps a delta was created from and for.
+// Digests are SHA3-384 digests encoded as in snap-revision assertions.
+type Header struct {
+	Format         string
+	SourceSHA3_384 string
+	TargetSHA3_384 string
+	TargetSize     uint64
+}
+
+func (h *Header) String() string {
+	return fmt.Sprintf("%s %s %s %s %d\n", magic, h.Format, h.SourceSHA3_384, h.TargetSHA3_384, h.TargetSize)
+}
+
+func readHeader(r *bufio.Reader) (*Header, error) {
+	prefix, err := r.Peek(len(magic) + 1)
+	if err != nil || string(prefix) != magic+" " {
+		return nil, ErrNotDelta
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snap delta header: %v", err)
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid snap delta header: %q", strings.TrimSpace(string(line)))
+	}
+	if fields[1] != Format {
+		return nil, fmt.Errorf("unsupported snap delta format %q (only %s currently)", fields[1], Format)
+	}
+	size, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snap delta target size: %q", fields[4])
+	}
+	return &Header{
+		Format:         fields[1],
+		SourceSHA3_384: fields[2],
+		TargetSHA3_384: fields[3],
+		TargetSize:     size,
+	}, nil
+}
+
+// ReadHeader returns the header of the snap delta at deltaPath, or
+// ErrNotDelta if the file is not a snap delta.
+func ReadHeader(deltaPath string) (*Header, error) {
+	f, err := os.Open(deltaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readHeader(bufio.NewReader(f))
+}
+
+// Xdelta3Command returns a command running xdelta3 with the given
+// arguments, using either the host or the core snap binary.
+func Xdelta3Command(args ...string) (*exec.Cmd, error) {
+	switch {
+	case osutil.ExecutableExists("xdelta3"):
+		return exec.Command("xdelta3", args...), nil
+	case osutil.FileExists(filepath.Join(dirs.SnapMountDir, "/core/current/usr/bin/xdelta3")):
+		return osutil.CommandFromCore("/usr/bin/xdelta3", args...)
+	}
+	return nil, fmt.Errorf("cannot find xdelta3 binary in PATH or core snap")
+}
+
+// runXdelta3 runs xdelta3 with the given arguments, input and output.
+func runXdelta3(stdin io.Reader, stdout io.Writer, args ...string) error {
+	cmd, err := Xdelta3Command(args...)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return osutil.OutputErr(stderr.Bytes(), err)
+	}
+	return nil
+}
+
+// writePartial writes path by calling write on a partial file that is
+// renamed into place on success and removed otherwise.
+func writePartial(path string, write func(f *os.File) error) (err error) {
+	partialPath := path + ".partial"
+	f, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(partialPath, path)
+		}
+		if err != nil {
+			os.Remove(partialPath)
+		}
+	}()
+
+	return write(f)
+}
+
+// Create writes to deltaPath a delta that reconstructs the snap at
+// targetPath from the snap at sourcePath.
+func Create(sourcePath, targetPath, deltaPath string) error {
+	sourceDigest, _, err := asserts.SnapFileSHA3_384(sourcePath)
+	if err != nil {
+		return err
+	}
+	targetDigest, targetSize, err := asserts.SnapFileSHA3_384(targetPath)
+	if err != nil {
+		return err
+	}
+	hdr := &Header{
+		Format:         Format,
+		SourceSHA3_384: sourceDigest,
+		TargetSHA3_384: targetDigest,
+		TargetSize:     targetSize,
+	}
+
+	return writePartial(deltaPath, func(f *os.File) error {
+		if _, err := io.WriteString(f, hdr.String()); err != nil {
+			return err
+		}
+		if err := runXdelta3(nil, f, "-e", "-c", "-s", sourcePath, targetPath); err != nil {
+			return fmt.Errorf("cannot create delta: %v", err)
+		}
+		return nil
+	})
+}
+
+// Apply reconstructs at targetPath the snap described by the delta at
+// deltaPath from the snap at sourcePath. Both the source snap and the
+// reconstructed one are verified against the digests in the delta
+// header, which is returned.
+func Apply(sourcePath, deltaPath, targetPath string) (*Header, error) {
+	f, err := os.Open(deltaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	hdr, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDigest, _, err := asserts.SnapFileSHA3_384(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	if sourceDigest != hdr.SourceSHA3_384 {
+		return nil, fmt.Errorf("cannot apply delta: %q is not the snap the delta was created from", sourcePath)
+	}
+
+	err = writePartial(targetPath, func(out *os.File) error {
+		if err := runXdelta3(r, out, "-d", "-c", "-s", sourcePath); err != nil {
+			return fmt.Errorf("cannot apply delta: %v", err)
+		}
+		targetDigest, targetSize, err := asserts.SnapFileSHA3_384(out.Name())
+		if err != nil {
+			return err
+		}
+		if targetDigest != hdr.TargetSHA3_384 || targetSize != hdr.TargetSize {
+			return fmt.Errorf("cannot apply delta: reconstructed snap does not have the expected digest and size (delta is broken or tampered): %s / %d != %s / %d", targetDigest, targetSize, hdr.TargetSHA3_384, hdr.TargetSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hdr, nil
+}
@@ -0,0 +1,165 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapdelta_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap/snapdelta"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type deltaSuite struct {
+	dir       string
+	source    string
+	target    string
+	delta     string
+	mockDelta *testutil.MockCmd
+}
+
+var _ = Suite(&deltaSuite{})
+
+// fakeXdelta3 uses the target snap itself as the delta
+const fakeXdelta3 = `
+if [ "$1" = "-e" ]; then
+    cat "$5"
+else
+    cat
+fi
+`
+
+func (s *deltaSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.source = filepath.Join(s.dir, "foo_1.snap")
+	s.target = filepath.Join(s.dir, "foo_2.snap")
+	s.delta = filepath.Join(s.dir, "foo_1_2.delta")
+	c.Assert(ioutil.WriteFile(s.source, []byte("old snap"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(s.target, []byte("new snap"), 0644), IsNil)
+
+	s.mockDelta = testutil.MockCommand(c, "xdelta3", fakeXdelta3)
+}
+
+func (s *deltaSuite) TearDownTest(c *C) {
+	s.mockDelta.Restore()
+}
+
+func (s *deltaSuite) TestCreateAndApply(c *C) {
+	err := snapdelta.Create(s.source, s.target, s.delta)
+	c.Assert(err, IsNil)
+	c.Check(osutil.FileExists(s.delta+".partial"), Equals, false)
+
+	sourceDigest, _, err := asserts.SnapFileSHA3_384(s.source)
+	c.Assert(err, IsNil)
+	targetDigest, targetSize, err := asserts.SnapFileSHA3_384(s.target)
+	c.Assert(err, IsNil)
+	expected := &snapdelta.Header{
+		Format:         "xdelta3",
+		SourceSHA3_384: sourceDigest,
+		TargetSHA3_384: targetDigest,
+		TargetSize:     targetSize,
+	}
+
+	hdr, err := snapdelta.ReadHeader(s.delta)
+	c.Assert(err, IsNil)
+	c.Check(hdr, DeepEquals, expected)
+
+	reconstructed := filepath.Join(s.dir, "reconstructed.snap")
+	hdr, err = snapdelta.Apply(s.source, s.delta, reconstructed)
+	c.Assert(err, IsNil)
+	c.Check(hdr, DeepEquals, expected)
+	content, err := ioutil.ReadFile(reconstructed)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "new snap")
+	c.Check(osutil.FileExists(reconstructed+".partial"), Equals, false)
+
+	c.Check(s.mockDelta.Calls(), DeepEquals, [][]string{
+		{"xdelta3", "-e", "-c", "-s", s.source, s.target},
+		{"xdelta3", "-d", "-c", "-s", s.source},
+	})
+}
+
+func (s *deltaSuite) TestReadHeaderNotDelta(c *C) {
+	_, err := snapdelta.ReadHeader(s.source)
+	c.Check(err, Equals, snapdelta.ErrNotDelta)
+}
+
+func (s *deltaSuite) TestReadHeaderErrors(c *C) {
+	for _, t := range []struct {
+		content string
+		err     string
+	}{
+		{"snap-delta xdelta3 src tgt\n", `invalid snap delta header: "snap-delta xdelta3 src tgt"`},
+		{"snap-delta bsdiff src tgt 10\n", `unsupported snap delta format "bsdiff" \(only xdelta3 currently\)`},
+		{"snap-delta xdelta3 src tgt ten\n", `invalid snap delta target size: "ten"`},
+		{"snap-delta xdelta3 src tgt 10", `cannot read snap delta header: EOF`},
+	} {
+		c.Assert(ioutil.WriteFile(s.delta, []byte(t.content), 0644), IsNil)
+		_, err := snapdelta.ReadHeader(s.delta)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *deltaSuite) TestApplyWrongSource(c *C) {
+	err := snapdelta.Create(s.source, s.target, s.delta)
+	c.Assert(err, IsNil)
+
+	_, err = snapdelta.Apply(s.target, s.delta, filepath.Join(s.dir, "reconstructed.snap"))
+	c.Check(err, ErrorMatches, `cannot apply delta: ".*/foo_2.snap" is not the snap the delta was created from`)
+	c.Check(s.mockDelta.Calls(), HasLen, 1)
+}
+
+func (s *deltaSuite) TestApplyTampered(c *C) {
+	err := snapdelta.Create(s.source, s.target, s.delta)
+	c.Assert(err, IsNil)
+
+	f, err := os.OpenFile(s.delta, os.O_APPEND|os.O_WRONLY, 0644)
+	c.Assert(err, IsNil)
+	_, err = f.WriteString(" tampered")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	reconstructed := filepath.Join(s.dir, "reconstructed.snap")
+	_, err = snapdelta.Apply(s.source, s.delta, reconstructed)
+	c.Check(err, ErrorMatches, `cannot apply delta: reconstructed snap does not have the expected digest and size \(delta is broken or tampered\): .*`)
+	c.Check(osutil.FileExists(reconstructed), Equals, false)
+	c.Check(osutil.FileExists(reconstructed+".partial"), Equals, false)
+}
+
+func (s *deltaSuite) TestApplyXdelta3Fails(c *C) {
+	err := snapdelta.Create(s.source, s.target, s.delta)
+	c.Assert(err, IsNil)
+
+	mockFail := testutil.MockCommand(c, "xdelta3", "echo boom >&2; exit 1")
+	defer mockFail.Restore()
+
+	reconstructed := filepath.Join(s.dir, "reconstructed.snap")
+	_, err = snapdelta.Apply(s.source, s.delta, reconstructed)
+	c.Check(err, ErrorMatches, `cannot apply delta: boom`)
+	c.Check(osutil.FileExists(reconstructed+".partial"), Equals, false)
+}
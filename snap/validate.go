@@ -21,12 +21,14 @@ package snap
 
 import (
 	"fmt"
+	"path"
 	"regexp"
+	"sort"
+	"strings"
 )
 
 // Regular expression describing correct identifiers.
 var validSnapName = regexp.MustCompile("^(?:[a-z0-9]+-?)*[a-z](?:-?[a-z0-9])*$")
-var validEpoch = regexp.MustCompile("^(?:0|[1-9][0-9]*[*]?)$")
 var validHookName = regexp.MustCompile("^[a-z](?:-?[a-z0-9])*$")
 
 // ValidateName checks if a string can be used as a snap name.
@@ -38,15 +40,6 @@ func ValidateName(name string) error {
 	return nil
 }
 
-// ValidateEpoch checks if a string can be used as a snap epoch.
-func ValidateEpoch(epoch string) error {
-	valid := validEpoch.MatchString(epoch)
-	if !valid {
-		return fmt.Errorf("invalid snap epoch: %q", epoch)
-	}
-	return nil
-}
-
 // ValidateHook validates the content of the given HookInfo
 func ValidateHook(hook *HookInfo) error {
 	valid := validHookName.MatchString(hook.Name)
@@ -69,12 +62,7 @@ func Validate(info *Info) error {
 		return err
 	}
 
-	epoch := info.Epoch
-	if epoch == "" {
-		return fmt.Errorf("snap epoch cannot be empty")
-	}
-	err = ValidateEpoch(epoch)
-	if err != nil {
+	if err := info.Epoch.Validate(); err != nil {
 		return err
 	}
 
@@ -105,6 +93,18 @@ func Validate(info *Info) error {
 	if err := plugsSlotsUniqueNames(info); err != nil {
 		return err
 	}
+
+	// validate the layout
+	paths := make([]string, 0, len(info.Layout))
+	for path := range info.Layout {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := ValidateLayout(info.Layout[path]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -161,3 +161,84 @@ func ValidateApp(app *AppInfo) error {
 	}
 	return nil
 }
+
+// layoutRejectionList contains directories that cannot be changed by layouts.
+var layoutRejectionList = []string{
+	"/proc", "/sys", "/dev", "/run", "/boot", "/lost+found", "/media",
+	"/snap", "/var/snap", "/var/lib/snapd", "/var/cache/snapd",
+}
+
+// layoutReservedChars contains characters that cannot be used in layout
+// paths, as they have special meaning in apparmor rules and mount profiles.
+const layoutReservedChars = "?*[]{}^\",\\ \t\n"
+
+// layoutSourceVariables contains variables that layout sources must start with.
+var layoutSourceVariables = []string{"$SNAP", "$SNAP_DATA", "$SNAP_COMMON"}
+
+// ValidateLayout verifies the content of a single layout element.
+func ValidateLayout(layout *Layout) error {
+	p := layout.Path
+	if p == "" {
+		return fmt.Errorf("cannot accept layout with empty path")
+	}
+	if !path.IsAbs(p) || path.Clean(p) != p {
+		return fmt.Errorf("layout %q must be an absolute and clean path", p)
+	}
+	if strings.ContainsAny(p, layoutReservedChars) {
+		return fmt.Errorf("layout %q contains a reserved character", p)
+	}
+	if p == "/" {
+		return fmt.Errorf("layout %q in an off-limits area", p)
+	}
+	for _, prefix := range layoutRejectionList {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return fmt.Errorf("layout %q in an off-limits area", p)
+		}
+	}
+
+	var kinds []string
+	if layout.Bind != "" {
+		kinds = append(kinds, "bind")
+	}
+	if layout.BindFile != "" {
+		kinds = append(kinds, "bind-file")
+	}
+	if layout.Type != "" {
+		kinds = append(kinds, "type")
+	}
+	if layout.Symlink != "" {
+		kinds = append(kinds, "symlink")
+	}
+	switch len(kinds) {
+	case 0:
+		return fmt.Errorf("layout %q must define a bind mount, a filesystem mount or a symlink", p)
+	case 1:
+		// valid
+	default:
+		return fmt.Errorf("layout %q must define only one of bind, bind-file, type or symlink (found %s)", p, strings.Join(kinds, ", "))
+	}
+
+	switch {
+	case layout.Bind != "":
+		return validateLayoutSource(p, "bind", layout.Bind)
+	case layout.BindFile != "":
+		return validateLayoutSource(p, "bind-file", layout.BindFile)
+	case layout.Symlink != "":
+		return validateLayoutSource(p, "symlink", layout.Symlink)
+	}
+	if layout.Type != "tmpfs" {
+		return fmt.Errorf("layout %q uses invalid filesystem %q", p, layout.Type)
+	}
+	return nil
+}
+
+func validateLayoutSource(p, kind, source string) error {
+	if path.Clean(source) == source {
+		for _, v := range layoutSourceVariables {
+			if source == v || strings.HasPrefix(source, v+"/") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("layout %q uses invalid %s source %q: must start with $SNAP, $SNAP_DATA or $SNAP_COMMON", p, kind, source)
+}
@@ -65,23 +65,6 @@ func (s *ValidateSuite) TestValidateName(c *C) {
 	}
 }
 
-func (s *ValidateSuite) TestValidateEpoch(c *C) {
-	validEpochs := []string{
-		"0", "1*", "1", "400*", "1234",
-	}
-	for _, epoch := range validEpochs {
-		err := ValidateEpoch(epoch)
-		c.Assert(err, IsNil)
-	}
-	invalidEpochs := []string{
-		"0*", "_", "1-", "1+", "-1", "+1", "-1*", "a", "1a", "1**",
-	}
-	for _, epoch := range invalidEpochs {
-		err := ValidateEpoch(epoch)
-		c.Assert(err, ErrorMatches, `invalid snap epoch: ".*"`)
-	}
-}
-
 func (s *ValidateSuite) TestValidateHook(c *C) {
 	validHooks := []*HookInfo{
 		{Name: "a"},
@@ -226,14 +209,15 @@ version: 1.0
 }
 
 func (s *ValidateSuite) TestIllegalSnapEpoch(c *C) {
-	info, err := InfoFromSnapYaml([]byte(`name: foo
+	_, err := InfoFromSnapYaml([]byte(`name: foo
 version: 1.0
 epoch: 0*
 `))
-	c.Assert(err, IsNil)
+	c.Check(err, ErrorMatches, `.*invalid epoch: "0\*" is not a valid epoch`)
 
+	info := &Info{SuggestedName: "foo", Epoch: Epoch{Read: []uint32{1}, Write: []uint32{2}}}
 	err = Validate(info)
-	c.Check(err, ErrorMatches, `invalid snap epoch: "0\*"`)
+	c.Check(err, ErrorMatches, `invalid epoch: read and write lists must have at least one item in common`)
 }
 
 func (s *ValidateSuite) TestMissingSnapEpochIsOkay(c *C) {
@@ -284,3 +268,59 @@ apps:
 	err = Validate(info)
 	c.Check(err, ErrorMatches, `cannot have "foo\$" as alias name for app "foo" - use only letters, digits, dash, underscore and dot characters`)
 }
+
+func (s *ValidateSuite) TestValidateLayout(c *C) {
+	// Several invalid layouts.
+	c.Check(ValidateLayout(&Layout{}), ErrorMatches,
+		"cannot accept layout with empty path")
+	c.Check(ValidateLayout(&Layout{Path: "foo", Bind: "$SNAP/foo"}), ErrorMatches,
+		`layout "foo" must be an absolute and clean path`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo/../bar", Bind: "$SNAP/foo"}), ErrorMatches,
+		`layout "/foo/../bar" must be an absolute and clean path`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo"}), ErrorMatches,
+		`layout "/foo" must define a bind mount, a filesystem mount or a symlink`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo", Bind: "$SNAP/bar", Type: "tmpfs"}), ErrorMatches,
+		`layout "/foo" must define only one of bind, bind-file, type or symlink \(found bind, type\)`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo", Type: "ext4"}), ErrorMatches,
+		`layout "/foo" uses invalid filesystem "ext4"`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo", Bind: "/bar"}), ErrorMatches,
+		`layout "/foo" uses invalid bind source "/bar": must start with \$SNAP, \$SNAP_DATA or \$SNAP_COMMON`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo", BindFile: "$SNAP/../bar"}), ErrorMatches,
+		`layout "/foo" uses invalid bind-file source "\$SNAP/../bar": must start with \$SNAP, \$SNAP_DATA or \$SNAP_COMMON`)
+	c.Check(ValidateLayout(&Layout{Path: "/foo", Symlink: "$SNAPPY/bar"}), ErrorMatches,
+		`layout "/foo" uses invalid symlink source "\$SNAPPY/bar": must start with \$SNAP, \$SNAP_DATA or \$SNAP_COMMON`)
+
+	for _, path := range []string{"/foo bar", "/foo*", "/foo{a,b}", `/foo"`, "/foo\\bar"} {
+		c.Check(ValidateLayout(&Layout{Path: path, Type: "tmpfs"}), ErrorMatches,
+			regexp.QuoteMeta(fmt.Sprintf("layout %q contains a reserved character", path)))
+	}
+
+	// Layouts in off-limits areas.
+	for _, path := range []string{"/", "/proc", "/sys/kernel", "/dev", "/run/foo", "/boot", "/lost+found",
+		"/media", "/snap", "/snap/foo", "/var/snap", "/var/lib/snapd", "/var/lib/snapd/foo"} {
+		c.Check(ValidateLayout(&Layout{Path: path, Type: "tmpfs"}), ErrorMatches,
+			regexp.QuoteMeta(fmt.Sprintf("layout %q in an off-limits area", path)))
+	}
+
+	// Several valid layouts.
+	c.Check(ValidateLayout(&Layout{Path: "/foo", Type: "tmpfs"}), IsNil)
+	c.Check(ValidateLayout(&Layout{Path: "/usr/share/foo", Bind: "$SNAP/usr/share/foo"}), IsNil)
+	c.Check(ValidateLayout(&Layout{Path: "/etc/foo.conf", BindFile: "$SNAP_DATA/foo.conf"}), IsNil)
+	c.Check(ValidateLayout(&Layout{Path: "/var/cache/foo", Bind: "$SNAP_COMMON"}), IsNil)
+	c.Check(ValidateLayout(&Layout{Path: "/usr/lib/foo", Symlink: "$SNAP/lib/foo"}), IsNil)
+	c.Check(ValidateLayout(&Layout{Path: "/snapshots", Type: "tmpfs"}), IsNil)
+}
+
+func (s *ValidateSuite) TestValidateLayoutAll(c *C) {
+	info, err := InfoFromSnapYaml([]byte(`name: foo
+version: 1.0
+layout:
+  /usr/share/foo:
+    bind: $SNAP/usr/share/foo
+  /proc/foo:
+    type: tmpfs
+`))
+	c.Assert(err, IsNil)
+	err = Validate(info)
+	c.Check(err, ErrorMatches, `layout "/proc/foo" in an off-limits area`)
+}
@@ -41,6 +41,14 @@ var defaultRetryStrategy = retry.LimitCount(5, retry.LimitTime(33*time.Second,
 	},
 ))
 
+// MockRetryStrategy replaces the retry strategy used by store requests, so
+// that tests talking to a fake store are not slowed down by backoffs.
+func MockRetryStrategy(strategy retry.Strategy) (restore func()) {
+	old := defaultRetryStrategy
+	defaultRetryStrategy = strategy
+	return func() { defaultRetryStrategy = old }
+}
+
 func maybeLogRetryAttempt(url string, attempt *retry.Attempt, startTime time.Time) {
 	if osutil.GetenvBool("SNAPD_DEBUG") || attempt.Count() > 1 {
 		logger.Debugf("Retrying %s, attempt %d, elapsed time=%v", url, attempt.Count(), time.Since(startTime))
@@ -30,7 +30,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -50,6 +49,7 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdelta"
 
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
@@ -74,7 +74,7 @@ func infoFromRemote(d snapDetails) *snap.Info {
 	info.Architectures = d.Architectures
 	info.Type = d.Type
 	info.Version = d.Version
-	info.Epoch = "0"
+	info.Epoch = d.Epoch
 	info.RealName = d.Name
 	info.SnapID = d.SnapID
 	info.Revision = snap.R(d.Revision)
@@ -132,6 +132,7 @@ type Config struct {
 	OrdersURI      *url.URL
 	CustomersMeURI *url.URL
 	SectionsURI    *url.URL
+	SnapActionURI  *url.URL
 
 	// StoreID is the store id used if we can't get one through the AuthContext.
 	StoreID string
@@ -152,6 +153,7 @@ type Store struct {
 	ordersURI      *url.URL
 	customersMeURI *url.URL
 	sectionsURI    *url.URL
+	snapActionURI  *url.URL
 
 	architecture string
 	series       string
@@ -203,7 +205,7 @@ func getStructFields(s interface{}) []string {
 func useDeltas() bool {
 	// only xdelta3 is supported for now, so check the binary exists here
 	// TODO: have a per-format checker instead
-	if _, err := getXdelta3Cmd(); err != nil {
+	if _, err := snapdelta.Xdelta3Command(); err != nil {
 		return false
 	}
 
@@ -267,24 +269,33 @@ func DefaultConfig() *Config {
 	return &cfg
 }
 
+const (
+	searchEndpPath     = "snaps/search"
+	detailsEndpPath    = "snaps/details/"
+	bulkEndpPath       = "snaps/metadata"
+	sectionsEndpPath   = "snaps/sections"
+	assertionsEndpPath = "assertions/"
+	snapActionEndpPath = "snaps/action"
+)
+
 func init() {
 	storeBaseURI, err := url.Parse(cpiURL())
 	if err != nil {
 		panic(err)
 	}
 
-	defaultConfig.SearchURI, err = storeBaseURI.Parse("snaps/search")
+	defaultConfig.SearchURI, err = storeBaseURI.Parse(searchEndpPath)
 	if err != nil {
 		panic(err)
 	}
 
 	// slash at the end because snap name is appended to this with .Parse(snapName)
-	defaultConfig.DetailsURI, err = storeBaseURI.Parse("snaps/details/")
+	defaultConfig.DetailsURI, err = storeBaseURI.Parse(detailsEndpPath)
 	if err != nil {
 		panic(err)
 	}
 
-	defaultConfig.BulkURI, err = storeBaseURI.Parse("snaps/metadata")
+	defaultConfig.BulkURI, err = storeBaseURI.Parse(bulkEndpPath)
 	if err != nil {
 		panic(err)
 	}
@@ -294,7 +305,7 @@ func init() {
 		panic(err)
 	}
 
-	defaultConfig.AssertionsURI, err = assertsBaseURI.Parse("assertions/")
+	defaultConfig.AssertionsURI, err = assertsBaseURI.Parse(assertionsEndpPath)
 	if err != nil {
 		panic(err)
 	}
@@ -309,7 +320,12 @@ func init() {
 		panic(err)
 	}
 
-	defaultConfig.SectionsURI, err = storeBaseURI.Parse("snaps/sections")
+	defaultConfig.SectionsURI, err = storeBaseURI.Parse(sectionsEndpPath)
+	if err != nil {
+		panic(err)
+	}
+
+	defaultConfig.SnapActionURI, err = storeBaseURI.Parse(snapActionEndpPath)
 	if err != nil {
 		panic(err)
 	}
@@ -397,6 +413,7 @@ func New(cfg *Config, authContext auth.AuthContext) *Store {
 		ordersURI:       cfg.OrdersURI,
 		customersMeURI:  cfg.CustomersMeURI,
 		sectionsURI:     sectionsURI,
+		snapActionURI:   cfg.SnapActionURI,
 		series:          series,
 		architecture:    architecture,
 		noCDN:           osutil.GetenvBool("SNAPPY_STORE_NO_CDN"),
@@ -412,6 +429,31 @@ func New(cfg *Config, authContext auth.AuthContext) *Store {
 	}
 }
 
+// endpointURL returns the URL to use for the store endpoint at path
+// p. Normally that is defaultURL, but if the device is set up to use
+// a proxy store the endpoint is resolved against the proxy store URL
+// instead, keeping the query of defaultURL.
+func (s *Store) endpointURL(defaultURL *url.URL, p string) (*url.URL, error) {
+	if s.authContext == nil {
+		return defaultURL, nil
+	}
+	proxyURL, err := s.authContext.ProxyStoreURL()
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return defaultURL, nil
+	}
+	u, err := proxyURL.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+	if defaultURL != nil {
+		u.RawQuery = defaultURL.RawQuery
+	}
+	return u, nil
+}
+
 // LoginUser logs user in the store and returns the authentication macaroons.
 func LoginUser(username, password, otp string) (string, string, error) {
 	macaroon, err := requestStoreMacaroon()
@@ -888,9 +930,14 @@ func (s *Store) fakeChannels(snapID string, user *auth.UserState) (map[string]*s
 		return nil, err
 	}
 
+	bulkURI, err := s.endpointURL(s.bulkURI, bulkEndpPath)
+	if err != nil {
+		return nil, err
+	}
+
 	reqOptions := &requestOptions{
 		Method:      "POST",
-		URL:         s.bulkURI,
+		URL:         bulkURI,
 		Accept:      halJsonContentType,
 		ContentType: jsonContentType,
 		Data:        jsonData,
@@ -935,9 +982,13 @@ type SnapSpec struct {
 
 // SnapInfo returns the snap.Info for the store-hosted snap matching the given spec, or an error.
 func (s *Store) SnapInfo(snapSpec SnapSpec, user *auth.UserState) (*snap.Info, error) {
+	detailsURI, err := s.endpointURL(s.detailsURI, detailsEndpPath)
+	if err != nil {
+		return nil, err
+	}
 	// get the query before doing Parse, as that overwrites it
-	query := s.detailsURI.Query()
-	u, err := s.detailsURI.Parse(snapSpec.Name)
+	query := detailsURI.Query()
+	u, err := detailsURI.Parse(snapSpec.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -1024,7 +1075,11 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 		return nil, ErrBadQuery
 	}
 
-	u := *s.searchURI // make a copy, so we can mutate it
+	searchURI, err := s.endpointURL(s.searchURI, searchEndpPath)
+	if err != nil {
+		return nil, err
+	}
+	u := *searchURI // make a copy, so we can mutate it
 	q := u.Query()
 
 	if search.Private {
@@ -1090,7 +1145,11 @@ func (s *Store) Find(search *Search, user *auth.UserState) ([]*snap.Info, error)
 
 // Sections retrieves the list of available store sections.
 func (s *Store) Sections(user *auth.UserState) ([]string, error) {
-	u := *s.sectionsURI // make a copy, so we can mutate it
+	sectionsURI, err := s.endpointURL(s.sectionsURI, sectionsEndpPath)
+	if err != nil {
+		return nil, err
+	}
+	u := *sectionsURI // make a copy, so we can mutate it
 
 	q := u.Query()
 
@@ -1129,7 +1188,7 @@ func (s *Store) Sections(user *auth.UserState) ([]string, error) {
 type RefreshCandidate struct {
 	SnapID   string
 	Revision snap.Revision
-	Epoch    string
+	Epoch    snap.Epoch
 	Block    []snap.Revision
 
 	// the desired channel
@@ -1138,9 +1197,10 @@ type RefreshCandidate struct {
 
 // the exact bits that we need to send to the store
 type currentSnapJson struct {
-	SnapID      string `json:"snap_id"`
-	Channel     string `json:"channel"`
-	Revision    int    `json:"revision,omitempty"`
+	SnapID   string `json:"snap_id"`
+	Channel  string `json:"channel"`
+	Revision int    `json:"revision,omitempty"`
+	// the metadata endpoint takes the epoch in its string form
 	Epoch       string `json:"epoch"`
 	Confinement string `json:"confinement"`
 }
@@ -1169,7 +1229,7 @@ func (s *Store) ListRefresh(installed []*RefreshCandidate, user *auth.UserState)
 		currentSnaps = append(currentSnaps, currentSnapJson{
 			SnapID:   cs.SnapID,
 			Channel:  cs.Channel,
-			Epoch:    cs.Epoch,
+			Epoch:    cs.Epoch.String(),
 			Revision: revision,
 			// confinement purposely left empty
 		})
@@ -1185,9 +1245,14 @@ func (s *Store) ListRefresh(installed []*RefreshCandidate, user *auth.UserState)
 		return nil, err
 	}
 
+	bulkURI, err := s.endpointURL(s.bulkURI, bulkEndpPath)
+	if err != nil {
+		return nil, err
+	}
+
 	reqOptions := &requestOptions{
 		Method:      "POST",
-		URL:         s.bulkURI,
+		URL:         bulkURI,
 		Accept:      halJsonContentType,
 		ContentType: jsonContentType,
 		Data:        jsonData,
@@ -1256,6 +1321,8 @@ func (e HashError) Error() string {
 // filename.
 // The file is saved in temporary storage, and should be removed
 // after use to prevent the disk from running out of space.
+// The download goes to targetPath + ".partial", which is left behind
+// on failure so that a later Download can resume it.
 func (s *Store) Download(ctx context.Context, name string, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter, user *auth.UserState) error {
 	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
 		return err
@@ -1272,6 +1339,8 @@ func (s *Store) Download(ctx context.Context, name string, targetPath string, do
 		logger.Noticef("Cannot download or apply deltas for %s: %v", name, err)
 	}
 
+	// a .partial file left behind by an interrupted download, possibly
+	// before a restart of snapd, is resumed
 	partialPath := targetPath + ".partial"
 	w, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
@@ -1285,30 +1354,49 @@ func (s *Store) Download(ctx context.Context, name string, targetPath string, do
 		if cerr := w.Close(); cerr != nil && err == nil {
 			err = cerr
 		}
-		if err != nil {
+		// keep what was downloaded so far so it can be resumed,
+		// unless it is known to be broken
+		if _, ok := err.(HashError); ok {
 			os.Remove(w.Name())
 		}
 	}()
 
+	complete := false
+	if downloadInfo.Size > 0 && resume >= downloadInfo.Size {
+		// the download was interrupted after the last byte was
+		// written, or the partial file is broken
+		if resume == downloadInfo.Size && downloadInfo.Sha3_384 != "" {
+			sha3_384, _, err := osutil.FileDigest(w.Name(), crypto.SHA3_384)
+			if err != nil {
+				return err
+			}
+			complete = fmt.Sprintf("%x", sha3_384) == downloadInfo.Sha3_384
+		}
+		if !complete {
+			logger.Debugf("Discarding partial download of %s: size %d, expected %d", name, resume, downloadInfo.Size)
+			if err := restartDownload(w); err != nil {
+				return err
+			}
+			resume = 0
+		}
+	}
+
 	url := downloadInfo.AnonDownloadURL
 	if url == "" || hasStoreAuth(user) {
 		url = downloadInfo.DownloadURL
 	}
 
-	err = download(ctx, name, downloadInfo.Sha3_384, url, user, s, w, resume, pbar)
-	// If sha3 checksum is incorrect and it was a resumed download, retry from scratch.
-	// Note that we will retry this way only once.
-	if _, ok := err.(HashError); ok && resume > 0 {
-		logger.Debugf("Error on resumed download: %v", err.Error())
-		err = w.Truncate(0)
-		if err != nil {
-			return err
-		}
-		_, err = w.Seek(0, os.SEEK_SET)
-		if err != nil {
-			return err
+	if !complete {
+		err = download(ctx, name, downloadInfo.Sha3_384, url, user, s, w, resume, pbar)
+		// If sha3 checksum is incorrect and it was a resumed download, retry from scratch.
+		// Note that we will retry this way only once.
+		if _, ok := err.(HashError); ok && resume > 0 {
+			logger.Debugf("Error on resumed download: %v", err.Error())
+			if err = restartDownload(w); err != nil {
+				return err
+			}
+			err = download(ctx, name, downloadInfo.Sha3_384, url, user, s, w, 0, pbar)
 		}
-		err = download(ctx, name, downloadInfo.Sha3_384, url, user, s, w, 0, pbar)
 	}
 
 	if err != nil {
@@ -1322,6 +1410,24 @@ func (s *Store) Download(ctx context.Context, name string, targetPath string, do
 	return w.Sync()
 }
 
+// truncater is implemented by download targets that can be truncated,
+// like *os.File.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// restartDownload discards what was written to w so that the download
+// can start over.
+func restartDownload(w io.ReadWriteSeeker) error {
+	if t, ok := w.(truncater); ok {
+		if err := t.Truncate(0); err != nil {
+			return err
+		}
+	}
+	_, err := w.Seek(0, os.SEEK_SET)
+	return err
+}
+
 // download writes an http.Request showing a progress.Meter
 var download = func(ctx context.Context, name, sha3_384, downloadURL string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter) error {
 	storeURL, err := url.Parse(downloadURL)
@@ -1378,8 +1484,46 @@ var download = func(ctx context.Context, name, sha3_384, downloadURL string, use
 			continue
 		}
 
+		if resume > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			// the partial download cannot be resumed, start over
+			resp.Body.Close()
+			logger.Debugf("Cannot resume download of %s at %d, downloading from the start", name, resume)
+			if err := restartDownload(w); err != nil {
+				return err
+			}
+			resume = 0
+			finalErr = &ErrDownload{Code: resp.StatusCode, URL: resp.Request.URL}
+			continue
+		}
+
+		if resume > 0 && resp.StatusCode == http.StatusPartialContent {
+			if start, err := contentRangeStart(resp); err != nil || start != resume {
+				// the server is not sending what was asked for, the
+				// partial download cannot be trusted, start over
+				resp.Body.Close()
+				logger.Debugf("Unexpected content range %q when resuming download of %s at %d, downloading from the start", resp.Header.Get("Content-Range"), name, resume)
+				if err := restartDownload(w); err != nil {
+					return err
+				}
+				resume = 0
+				finalErr = &ErrDownload{Code: resp.StatusCode, URL: resp.Request.URL}
+				continue
+			}
+		}
+
 		defer resp.Body.Close()
 
+		if resume > 0 && resp.StatusCode == http.StatusOK {
+			// the server ignored the range request and is sending
+			// the whole file
+			logger.Debugf("Server ignored range request for %s, downloading from the start", name)
+			if err := restartDownload(w); err != nil {
+				return err
+			}
+			resume = 0
+			h = crypto.SHA3_384.New()
+		}
+
 		switch resp.StatusCode {
 		case http.StatusOK, http.StatusPartialContent:
 		case http.StatusUnauthorized:
@@ -1392,7 +1536,8 @@ var download = func(ctx context.Context, name, sha3_384, downloadURL string, use
 		if pbar == nil {
 			pbar = &progress.NullProgress{}
 		}
-		pbar.Start(name, float64(resp.ContentLength))
+		pbar.Start(name, float64(resume+resp.ContentLength))
+		pbar.Set(float64(resume))
 		mw := io.MultiWriter(w, h, pbar)
 		_, finalErr = io.Copy(mw, resp.Body)
 		pbar.Finished()
@@ -1422,6 +1567,18 @@ var download = func(ctx context.Context, name, sha3_384, downloadURL string, use
 	return finalErr
 }
 
+// contentRangeStart returns the offset of the first byte sent in a partial
+// response, as given by its Content-Range header.
+func contentRangeStart(resp *http.Response) (int64, error) {
+	contentRange := resp.Header.Get("Content-Range")
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, fmt.Errorf("cannot parse content range %q: %v", contentRange, err)
+	}
+	return start, nil
+}
+
 // downloadDelta downloads the delta for the preferred format, returning the path.
 func (s *Store) downloadDelta(deltaName string, downloadInfo *snap.DownloadInfo, w io.ReadWriteSeeker, pbar progress.Meter, user *auth.UserState) error {
 
@@ -1443,16 +1600,6 @@ func (s *Store) downloadDelta(deltaName string, downloadInfo *snap.DownloadInfo,
 	return download(context.TODO(), deltaName, deltaInfo.Sha3_384, url, user, s, w, 0, pbar)
 }
 
-func getXdelta3Cmd(args ...string) (*exec.Cmd, error) {
-	switch {
-	case osutil.ExecutableExists("xdelta3"):
-		return exec.Command("xdelta3", args...), nil
-	case osutil.FileExists(filepath.Join(dirs.SnapMountDir, "/core/current/usr/bin/xdelta3")):
-		return osutil.CommandFromCore("/usr/bin/xdelta3", args...)
-	}
-	return nil, fmt.Errorf("cannot find xdelta3 binary in PATH or core snap")
-}
-
 // applyDelta generates a target snap from a previously downloaded snap and a downloaded delta.
 var applyDelta = func(name string, deltaPath string, deltaInfo *snap.DeltaInfo, targetPath string, targetSha3_384 string) error {
 	snapBase := fmt.Sprintf("%s_%d.snap", name, deltaInfo.FromRevision)
@@ -1469,7 +1616,7 @@ var applyDelta = func(name string, deltaPath string, deltaInfo *snap.DeltaInfo,
 	partialTargetPath := targetPath + ".partial"
 
 	xdelta3Args := []string{"-d", "-s", snapPath, deltaPath, partialTargetPath}
-	cmd, err := getXdelta3Cmd(xdelta3Args...)
+	cmd, err := snapdelta.Xdelta3Command(xdelta3Args...)
 	if err != nil {
 		return err
 	}
@@ -1541,7 +1688,11 @@ type assertionSvcError struct {
 
 // Assertion retrivies the assertion for the given type and primary key.
 func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
-	u, err := s.assertionsURI.Parse(path.Join(assertType.Name, path.Join(primaryKey...)))
+	assertionsURI, err := s.endpointURL(s.assertionsURI, assertionsEndpPath)
+	if err != nil {
+		return nil, err
+	}
+	u, err := assertionsURI.Parse(path.Join(assertType.Name, path.Join(primaryKey...)))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,366 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/snap"
+)
+
+// CurrentSnap represents the state of an installed snap that is
+// given to the store as context for snap actions.
+type CurrentSnap struct {
+	Name             string
+	SnapID           string
+	Revision         snap.Revision
+	TrackingChannel  string
+	Epoch            snap.Epoch
+	IgnoreValidation bool
+	// Block lists revisions that must not be refreshed to.
+	Block []snap.Revision
+}
+
+// SnapActionFlags are flags for snap actions.
+type SnapActionFlags int
+
+const (
+	// SnapActionIgnoreValidation asks the store to ignore validation
+	// constraints for the action.
+	SnapActionIgnoreValidation SnapActionFlags = 1 << iota
+	// SnapActionEnforceValidation asks the store to enforce validation
+	// constraints even if they were ignored for the current snap.
+	SnapActionEnforceValidation
+)
+
+// SnapAction represents an action to perform on a snap in the
+// store: "install" and "download" by name, "refresh" by snap-id of
+// one of the current snaps.
+type SnapAction struct {
+	Action   string
+	Name     string
+	SnapID   string
+	Channel  string
+	Revision snap.Revision
+	Flags    SnapActionFlags
+}
+
+// SnapActionError conveys the errors of the actions that could not
+// be performed, keyed by snap name for each kind of action.
+type SnapActionError struct {
+	// NoResults is set if there were no results at all
+	NoResults bool
+	Refresh   map[string]error
+	Install   map[string]error
+	Download  map[string]error
+	Other     []error
+}
+
+func (e *SnapActionError) Error() string {
+	var es []string
+	add := func(action string, errs map[string]error) {
+		names := make([]string, 0, len(errs))
+		for name := range errs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			es = append(es, fmt.Sprintf("cannot %s snap %q: %v", action, name, errs[name]))
+		}
+	}
+	add("refresh", e.Refresh)
+	add("install", e.Install)
+	add("download", e.Download)
+	for _, err := range e.Other {
+		es = append(es, err.Error())
+	}
+	if len(es) == 0 {
+		if e.NoResults {
+			return "no install/refresh information results from the store"
+		}
+		return "unexpected snap action error"
+	}
+	return strings.Join(es, "\n")
+}
+
+// the exact bits that we need to send to the store
+type currentSnapActionJSON struct {
+	InstanceKey      string     `json:"instance-key"`
+	SnapID           string     `json:"snap-id"`
+	Revision         int        `json:"revision"`
+	TrackingChannel  string     `json:"tracking-channel"`
+	Epoch            snap.Epoch `json:"epoch"`
+	IgnoreValidation bool       `json:"ignore-validation,omitempty"`
+}
+
+type snapActionJSON struct {
+	Action           string `json:"action"`
+	InstanceKey      string `json:"instance-key"`
+	Name             string `json:"name,omitempty"`
+	SnapID           string `json:"snap-id,omitempty"`
+	Channel          string `json:"channel,omitempty"`
+	Revision         int    `json:"revision,omitempty"`
+	IgnoreValidation *bool  `json:"ignore-validation,omitempty"`
+}
+
+type snapActionRequest struct {
+	Context []*currentSnapActionJSON `json:"context"`
+	Actions []*snapActionJSON        `json:"actions"`
+	Fields  []string                 `json:"fields"`
+}
+
+type snapActionErrorJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type snapActionResult struct {
+	Result      string               `json:"result"`
+	InstanceKey string               `json:"instance-key"`
+	SnapID      string               `json:"snap-id,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Snap        *snapDetails         `json:"snap,omitempty"`
+	Error       *snapActionErrorJSON `json:"error,omitempty"`
+}
+
+type snapActionResultList struct {
+	Results   []*snapActionResult    `json:"results"`
+	ErrorList []*snapActionErrorJSON `json:"error-list"`
+}
+
+func (e *snapActionErrorJSON) toError() error {
+	switch e.Code {
+	case "id-not-found", "name-not-found", "revision-not-found":
+		return ErrSnapNotFound
+	case "no-update":
+		return ErrNoUpdateAvailable
+	}
+	return fmt.Errorf("%v", e.Message)
+}
+
+var snapActionKinds = map[string]bool{
+	"install":  true,
+	"refresh":  true,
+	"download": true,
+}
+
+// SnapAction queries the store for snap information for the given
+// install/refresh/download actions, given the context information
+// about the current installed snaps, all in one request. It returns
+// the snap information for the actions that succeeded, and a
+// *SnapActionError for the ones that did not, if any.
+func (s *Store) SnapAction(currentSnaps []*CurrentSnap, actions []*SnapAction, user *auth.UserState) ([]*snap.Info, error) {
+	if len(currentSnaps) == 0 && len(actions) == 0 {
+		// nothing to do
+		return nil, &SnapActionError{NoResults: true}
+	}
+
+	curSnaps := make(map[string]*CurrentSnap, len(currentSnaps))
+	curSnapJSONs := make([]*currentSnapActionJSON, len(currentSnaps))
+	for i, curSnap := range currentSnaps {
+		if curSnap.SnapID == "" || curSnap.Name == "" || curSnap.Revision.Unset() {
+			return nil, fmt.Errorf("internal error: invalid current snap information")
+		}
+		revision := curSnap.Revision.N
+		if !curSnap.Revision.Store() {
+			revision = 0
+		}
+		curSnaps[curSnap.SnapID] = curSnap
+		curSnapJSONs[i] = &currentSnapActionJSON{
+			InstanceKey:      curSnap.SnapID,
+			SnapID:           curSnap.SnapID,
+			Revision:         revision,
+			TrackingChannel:  curSnap.TrackingChannel,
+			Epoch:            curSnap.Epoch,
+			IgnoreValidation: curSnap.IgnoreValidation,
+		}
+	}
+
+	actionsByKey := make(map[string]*SnapAction, len(actions))
+	actionJSONs := make([]*snapActionJSON, len(actions))
+	for i, a := range actions {
+		if !snapActionKinds[a.Action] {
+			return nil, fmt.Errorf("internal error: unsupported snap action %q", a.Action)
+		}
+		var ignoreValidation *bool
+		if a.Flags&SnapActionIgnoreValidation != 0 {
+			t := true
+			ignoreValidation = &t
+		} else if a.Flags&SnapActionEnforceValidation != 0 {
+			f := false
+			ignoreValidation = &f
+		}
+
+		aJSON := &snapActionJSON{
+			Action:           a.Action,
+			Channel:          a.Channel,
+			Revision:         a.Revision.N,
+			IgnoreValidation: ignoreValidation,
+		}
+		if a.Action == "refresh" {
+			if curSnaps[a.SnapID] == nil {
+				return nil, fmt.Errorf("internal error: refresh action for snap-id %q without current snap information", a.SnapID)
+			}
+			aJSON.SnapID = a.SnapID
+			aJSON.InstanceKey = a.SnapID
+		} else {
+			aJSON.Name = a.Name
+			aJSON.InstanceKey = a.Action + "-" + a.Name
+		}
+		actionsByKey[aJSON.InstanceKey] = a
+		actionJSONs[i] = aJSON
+	}
+
+	jsonData, err := json.Marshal(&snapActionRequest{
+		Context: curSnapJSONs,
+		Actions: actionJSONs,
+		Fields:  s.detailFields,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapActionURI, err := s.endpointURL(s.snapActionURI, snapActionEndpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	reqOptions := &requestOptions{
+		Method:      "POST",
+		URL:         snapActionURI,
+		Accept:      jsonContentType,
+		ContentType: jsonContentType,
+		Data:        jsonData,
+	}
+
+	if useDeltas() {
+		logger.Debugf("Deltas enabled. Adding header X-Ubuntu-Delta-Formats: %v", s.deltaFormat)
+		reqOptions.ExtraHeaders = map[string]string{
+			"X-Ubuntu-Delta-Formats": s.deltaFormat,
+		}
+	}
+
+	var results snapActionResultList
+	resp, err := s.retryRequestDecodeJSON(context.TODO(), s.client, reqOptions, user, &results, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, respToError(resp, "query the store for snap actions")
+	}
+
+	s.extractSuggestedCurrency(resp)
+
+	refreshErrors := make(map[string]error)
+	installErrors := make(map[string]error)
+	downloadErrors := make(map[string]error)
+	var otherErrors []error
+
+	var installs []*snap.Info
+	var snaps []*snap.Info
+	for _, res := range results.Results {
+		a := actionsByKey[res.InstanceKey]
+		if res.Result == "error" {
+			var resErr error
+			if res.Error != nil {
+				resErr = res.Error.toError()
+			} else {
+				resErr = fmt.Errorf("unexpected snap action error result for %q without details", res.InstanceKey)
+			}
+			if a == nil {
+				otherErrors = append(otherErrors, resErr)
+				continue
+			}
+			switch a.Action {
+			case "refresh":
+				refreshErrors[curSnaps[a.SnapID].Name] = resErr
+			case "install":
+				installErrors[a.Name] = resErr
+			case "download":
+				downloadErrors[a.Name] = resErr
+			}
+			continue
+		}
+		if a == nil || a.Action != res.Result || res.Snap == nil {
+			otherErrors = append(otherErrors, fmt.Errorf("unexpected snap action result %q for %q", res.Result, res.InstanceKey))
+			continue
+		}
+
+		info := infoFromRemote(*res.Snap)
+		if a.Action == "refresh" {
+			cur := curSnaps[a.SnapID]
+			// the store also gives us identical revisions, filter those
+			// out, we are not interested
+			if info.Revision == cur.Revision {
+				refreshErrors[cur.Name] = ErrNoUpdateAvailable
+				continue
+			}
+			// do not upgrade to a revision we rolled back from
+			if findRev(info.Revision, cur.Block) {
+				refreshErrors[cur.Name] = ErrNoUpdateAvailable
+				continue
+			}
+		}
+		if a.Action == "install" {
+			installs = append(installs, info)
+		}
+		snaps = append(snaps, info)
+	}
+
+	for _, e := range results.ErrorList {
+		otherErrors = append(otherErrors, e.toError())
+	}
+
+	if len(installs) > 0 {
+		// only needed for installs, the snaps of the refreshes
+		// have already been bought
+		if err := s.decorateOrders(installs, "", user); err != nil {
+			logger.Noticef("cannot get user orders: %v", err)
+		}
+	}
+
+	if len(refreshErrors)+len(installErrors)+len(downloadErrors)+len(otherErrors) != 0 || len(snaps) == 0 {
+		return snaps, &SnapActionError{
+			NoResults: len(snaps) == 0,
+			Refresh:   nilIfEmpty(refreshErrors),
+			Install:   nilIfEmpty(installErrors),
+			Download:  nilIfEmpty(downloadErrors),
+			Other:     otherErrors,
+		}
+	}
+
+	return snaps, nil
+}
+
+func nilIfEmpty(errs map[string]error) map[string]error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,255 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/snap"
+)
+
+func (t *remoteRepoTestSuite) mockSnapActionServer(c *C, check func(req map[string]interface{}), results ...interface{}) (*Store, func()) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// check device authorization is set, implicitly checking doRequest was used
+		c.Check(r.Header.Get("X-Device-Authorization"), Equals, `Macaroon root="device-macaroon"`)
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/snaps/action")
+
+		jsonReq, err := ioutil.ReadAll(r.Body)
+		c.Assert(err, IsNil)
+		var req map[string]interface{}
+		c.Assert(json.Unmarshal(jsonReq, &req), IsNil)
+		if check != nil {
+			check(req)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	}))
+	c.Assert(mockServer, NotNil)
+
+	snapActionURI, err := url.Parse(mockServer.URL + "/snaps/action")
+	c.Assert(err, IsNil)
+	cfg := Config{
+		SnapActionURI: snapActionURI,
+	}
+	authContext := &testAuthContext{c: c, device: t.device}
+	return New(&cfg, authContext), mockServer.Close
+}
+
+func (t *remoteRepoTestSuite) TestSnapActionRefreshAndInstall(c *C) {
+	sto, done := t.mockSnapActionServer(c, func(req map[string]interface{}) {
+		c.Check(req["context"], DeepEquals, []interface{}{
+			map[string]interface{}{
+				"instance-key":     helloWorldSnapID,
+				"snap-id":          helloWorldSnapID,
+				"revision":         float64(1),
+				"tracking-channel": "beta",
+				"epoch": map[string]interface{}{
+					"read":  []interface{}{0.0},
+					"write": []interface{}{0.0},
+				},
+			},
+		})
+		c.Check(req["actions"], DeepEquals, []interface{}{
+			map[string]interface{}{
+				"action":       "refresh",
+				"instance-key": helloWorldSnapID,
+				"snap-id":      helloWorldSnapID,
+				"channel":      "stable",
+			},
+			map[string]interface{}{
+				"action":            "install",
+				"instance-key":      "install-other",
+				"name":              "other",
+				"channel":           "edge",
+				"revision":          float64(3),
+				"ignore-validation": true,
+			},
+		})
+		c.Check(req["fields"], DeepEquals, []interface{}{"abc", "def"})
+	}, map[string]interface{}{
+		"result":       "refresh",
+		"instance-key": helloWorldSnapID,
+		"snap-id":      helloWorldSnapID,
+		"name":         "hello-world",
+		"snap":         json.RawMessage(MockDetailsJSON),
+	}, map[string]interface{}{
+		"result":       "install",
+		"instance-key": "install-other",
+		"name":         "other",
+		"snap": map[string]interface{}{
+			"package_name": "other",
+			"snap_id":      "other-id",
+			"revision":     3,
+		},
+	})
+	defer done()
+	sto.detailFields = []string{"abc", "def"}
+
+	results, err := sto.SnapAction([]*CurrentSnap{
+		{
+			Name:            "hello-world",
+			SnapID:          helloWorldSnapID,
+			TrackingChannel: "beta",
+			Revision:        snap.R(1),
+		},
+	}, []*SnapAction{
+		{
+			Action:  "refresh",
+			SnapID:  helloWorldSnapID,
+			Channel: "stable",
+		},
+		{
+			Action:   "install",
+			Name:     "other",
+			Channel:  "edge",
+			Revision: snap.R(3),
+			Flags:    SnapActionIgnoreValidation,
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Check(results[0].Name(), Equals, "hello-world")
+	c.Check(results[0].Revision, Equals, snap.R(27))
+	c.Check(results[0].SnapID, Equals, helloWorldSnapID)
+	c.Check(results[0].PublisherID, Equals, helloWorldDeveloperID)
+	c.Check(results[0].Sha3_384, Equals, "eed62063c04a8c3819eb71ce7d929cc8d743b43be9e7d86b397b6d61b66b0c3a684f3148a9dbe5821360ae32105c1bd9")
+	c.Check(results[1].Name(), Equals, "other")
+	c.Check(results[1].Revision, Equals, snap.R(3))
+}
+
+func (t *remoteRepoTestSuite) TestSnapActionErrors(c *C) {
+	sto, done := t.mockSnapActionServer(c, nil, map[string]interface{}{
+		"result":       "error",
+		"instance-key": helloWorldSnapID,
+		"snap-id":      helloWorldSnapID,
+		"error": map[string]interface{}{
+			"code":    "revision-not-found",
+			"message": "no revision",
+		},
+	}, map[string]interface{}{
+		"result":       "error",
+		"instance-key": "install-foo",
+		"name":         "foo",
+		"error": map[string]interface{}{
+			"code":    "name-not-found",
+			"message": "no foo",
+		},
+	}, map[string]interface{}{
+		"result":       "error",
+		"instance-key": "download-bar",
+		"name":         "bar",
+		"error": map[string]interface{}{
+			"code":    "other-problem",
+			"message": "bar is broken",
+		},
+	})
+	defer done()
+
+	results, err := sto.SnapAction([]*CurrentSnap{
+		{
+			Name:     "hello-world",
+			SnapID:   helloWorldSnapID,
+			Revision: snap.R(26),
+		},
+	}, []*SnapAction{
+		{Action: "refresh", SnapID: helloWorldSnapID},
+		{Action: "install", Name: "foo"},
+		{Action: "download", Name: "bar"},
+	}, nil)
+	c.Check(results, HasLen, 0)
+	c.Assert(err, DeepEquals, &SnapActionError{
+		NoResults: true,
+		Refresh:   map[string]error{"hello-world": ErrSnapNotFound},
+		Install:   map[string]error{"foo": ErrSnapNotFound},
+		Download:  map[string]error{"bar": err.(*SnapActionError).Download["bar"]},
+	})
+	c.Check(err, ErrorMatches, `cannot refresh snap "hello-world": snap not found
+cannot install snap "foo": snap not found
+cannot download snap "bar": bar is broken`)
+}
+
+func (t *remoteRepoTestSuite) TestSnapActionErrorWithoutDetails(c *C) {
+	sto, done := t.mockSnapActionServer(c, nil, map[string]interface{}{
+		"result":       "error",
+		"instance-key": "install-foo",
+		"name":         "foo",
+	}, map[string]interface{}{
+		"result":       "error",
+		"instance-key": "unknown",
+	})
+	defer done()
+
+	results, err := sto.SnapAction(nil, []*SnapAction{
+		{Action: "install", Name: "foo"},
+	}, nil)
+	c.Check(results, HasLen, 0)
+	c.Check(err, ErrorMatches, `(?s)cannot install snap "foo": unexpected snap action error result for "install-foo" without details.*unexpected snap action error result for "unknown" without details.*`)
+}
+
+func (t *remoteRepoTestSuite) TestSnapActionRefreshNoUpdate(c *C) {
+	sto, done := t.mockSnapActionServer(c, nil, map[string]interface{}{
+		"result":       "refresh",
+		"instance-key": helloWorldSnapID,
+		"snap-id":      helloWorldSnapID,
+		"snap":         json.RawMessage(MockDetailsJSON),
+	})
+	defer done()
+
+	for _, cur := range []*CurrentSnap{
+		// the same revision
+		{Name: "hello-world", SnapID: helloWorldSnapID, Revision: snap.R(27)},
+		// a blocked revision
+		{Name: "hello-world", SnapID: helloWorldSnapID, Revision: snap.R(26), Block: []snap.Revision{snap.R(27)}},
+	} {
+		results, err := sto.SnapAction([]*CurrentSnap{cur}, []*SnapAction{
+			{Action: "refresh", SnapID: helloWorldSnapID},
+		}, nil)
+		c.Check(results, HasLen, 0)
+		c.Check(err, DeepEquals, &SnapActionError{
+			NoResults: true,
+			Refresh:   map[string]error{"hello-world": ErrNoUpdateAvailable},
+		})
+	}
+}
+
+func (t *remoteRepoTestSuite) TestSnapActionInternalErrors(c *C) {
+	sto := New(&Config{}, nil)
+
+	_, err := sto.SnapAction(nil, nil, nil)
+	c.Check(err, DeepEquals, &SnapActionError{NoResults: true})
+
+	_, err = sto.SnapAction([]*CurrentSnap{{Name: "foo", SnapID: "foo-id"}}, nil, nil)
+	c.Check(err, ErrorMatches, "internal error: invalid current snap information")
+
+	_, err = sto.SnapAction(nil, []*SnapAction{{Action: "remove", Name: "foo"}}, nil)
+	c.Check(err, ErrorMatches, `internal error: unsupported snap action "remove"`)
+
+	_, err = sto.SnapAction(nil, []*SnapAction{{Action: "refresh", SnapID: "foo-id"}}, nil)
+	c.Check(err, ErrorMatches, `internal error: refresh action for snap-id "foo-id" without current snap information`)
+}
@@ -109,7 +109,8 @@ type testAuthContext struct {
 	device *auth.DeviceState
 	user   *auth.UserState
 
-	storeID string
+	storeID       string
+	proxyStoreURL *url.URL
 }
 
 func (ac *testAuthContext) Device() (*auth.DeviceState, error) {
@@ -139,6 +140,10 @@ func (ac *testAuthContext) StoreID(fallback string) (string, error) {
 	return fallback, nil
 }
 
+func (ac *testAuthContext) ProxyStoreURL() (*url.URL, error) {
+	return ac.proxyStoreURL, nil
+}
+
 func (ac *testAuthContext) DeviceSessionRequest(nonce string) ([]byte, []byte, error) {
 	serial, err := asserts.Decode([]byte(exSerial))
 	if err != nil {
@@ -445,10 +450,84 @@ func (t *remoteRepoTestSuite) TestDownloadFails(c *C) {
 	path := filepath.Join(c.MkDir(), "downloaded-file")
 	err := t.store.Download(context.TODO(), "foo", path, &snap.DownloadInfo, nil, nil)
 	c.Assert(err, ErrorMatches, "uh, it failed")
-	// ... and ensure that the tempfile is removed
+	// ... and ensure that the partial file is kept for resuming
+	c.Assert(osutil.FileExists(tmpfile.Name()), Equals, true)
+	c.Assert(osutil.FileExists(path), Equals, false)
+}
+
+func (t *remoteRepoTestSuite) TestDownloadHashErrorRemovesPartial(c *C) {
+	var tmpfile *os.File
+	download = func(ctx context.Context, name, sha3, url string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter) error {
+		tmpfile = w.(*os.File)
+		w.Write([]byte("garbage"))
+		return HashError{"foo", "1234", "5678"}
+	}
+
+	snap := &snap.Info{}
+	snap.RealName = "foo"
+	snap.AnonDownloadURL = "anon-url"
+	snap.DownloadURL = "AUTH-URL"
+
+	path := filepath.Join(c.MkDir(), "downloaded-file")
+	err := t.store.Download(context.TODO(), "foo", path, &snap.DownloadInfo, nil, nil)
+	c.Assert(err, FitsTypeOf, HashError{})
+	// the broken partial file cannot be resumed
 	c.Assert(osutil.FileExists(tmpfile.Name()), Equals, false)
 }
 
+func (t *remoteRepoTestSuite) TestDownloadCompletePartial(c *C) {
+	content := "the whole file"
+	h := crypto.SHA3_384.New()
+	h.Write([]byte(content))
+
+	download = func(ctx context.Context, name, sha3, url string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter) error {
+		c.Fatalf("unexpected download")
+		return nil
+	}
+
+	snap := &snap.Info{}
+	snap.RealName = "foo"
+	snap.AnonDownloadURL = "anon-url"
+	snap.Sha3_384 = fmt.Sprintf("%x", h.Sum(nil))
+	snap.Size = int64(len(content))
+
+	targetFn := filepath.Join(c.MkDir(), "foo_1.0_all.snap")
+	err := ioutil.WriteFile(targetFn+".partial", []byte(content), 0644)
+	c.Assert(err, IsNil)
+
+	err = t.store.Download(context.TODO(), "foo", targetFn, &snap.DownloadInfo, nil, nil)
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadFile(targetFn)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, content)
+	c.Check(osutil.FileExists(targetFn+".partial"), Equals, false)
+}
+
+func (t *remoteRepoTestSuite) TestDownloadTooLargePartial(c *C) {
+	download = func(ctx context.Context, name, sha3, url string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter) error {
+		c.Check(resume, Equals, int64(0))
+		w.Write([]byte("downloaded"))
+		return nil
+	}
+
+	snap := &snap.Info{}
+	snap.RealName = "foo"
+	snap.AnonDownloadURL = "anon-url"
+	snap.Size = int64(len("downloaded"))
+
+	targetFn := filepath.Join(c.MkDir(), "foo_1.0_all.snap")
+	err := ioutil.WriteFile(targetFn+".partial", []byte("way too much partial content"), 0644)
+	c.Assert(err, IsNil)
+
+	err = t.store.Download(context.TODO(), "foo", targetFn, &snap.DownloadInfo, nil, nil)
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadFile(targetFn)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "downloaded")
+}
+
 func (t *remoteRepoTestSuite) TestDownloadSyncFails(c *C) {
 	var tmpfile *os.File
 	download = func(ctx context.Context, name, sha3, url string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter) error {
@@ -659,6 +738,9 @@ func (t *remoteRepoTestSuite) TestActualDownloadResume(c *C) {
 	n := 0
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		n++
+		c.Check(r.Header.Get("Range"), Equals, "bytes=5-")
+		w.Header().Set("Content-Range", "bytes 5-8/9")
+		w.WriteHeader(http.StatusPartialContent)
 		io.WriteString(w, "data")
 	}))
 	c.Assert(mockServer, NotNil)
@@ -676,6 +758,92 @@ func (t *remoteRepoTestSuite) TestActualDownloadResume(c *C) {
 	c.Check(n, Equals, 1)
 }
 
+func (t *remoteRepoTestSuite) TestActualDownloadResumeRangeIgnored(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Header.Get("Range"), Equals, "bytes=5-")
+		io.WriteString(w, "some data")
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	theStore := New(&Config{}, nil)
+	buf := NewSillyBufferString("some ")
+	h := crypto.SHA3_384.New()
+	h.Write([]byte("some data"))
+	sha3 := fmt.Sprintf("%x", h.Sum(nil))
+	err := download(context.TODO(), "foo", sha3, mockServer.URL, nil, theStore, buf, int64(len("some ")), nil)
+	c.Check(err, IsNil)
+	c.Check(buf.String(), Equals, "some data")
+	c.Check(n, Equals, 1)
+}
+
+func (t *remoteRepoTestSuite) TestActualDownloadResumeWrongContentRange(c *C) {
+	var ranges []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			// the server sends a range other than the one asked for
+			w.Header().Set("Content-Range", "bytes 0-3/9")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, "some")
+			return
+		}
+		io.WriteString(w, "some data")
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	theStore := New(&Config{}, nil)
+	f, err := os.Create(filepath.Join(c.MkDir(), "foo.partial"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	_, err = f.WriteString("some ")
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA3_384.New()
+	h.Write([]byte("some data"))
+	sha3 := fmt.Sprintf("%x", h.Sum(nil))
+	err = download(context.TODO(), "foo", sha3, mockServer.URL, nil, theStore, f, int64(len("some ")), nil)
+	c.Check(err, IsNil)
+	data, err := ioutil.ReadFile(f.Name())
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "some data")
+	c.Check(ranges, DeepEquals, []string{"bytes=5-", ""})
+}
+
+func (t *remoteRepoTestSuite) TestActualDownloadResumeRangeNotSatisfiable(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		io.WriteString(w, "data")
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	theStore := New(&Config{}, nil)
+	f, err := os.Create(filepath.Join(c.MkDir(), "foo.partial"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	_, err = f.WriteString("more than the whole file")
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA3_384.New()
+	h.Write([]byte("data"))
+	sha3 := fmt.Sprintf("%x", h.Sum(nil))
+	err = download(context.TODO(), "foo", sha3, mockServer.URL, nil, theStore, f, int64(len("more than the whole file")), nil)
+	c.Check(err, IsNil)
+	data, err := ioutil.ReadFile(f.Name())
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "data")
+	c.Check(n, Equals, 2)
+}
+
 func (t *remoteRepoTestSuite) TestUseDeltas(c *C) {
 	origPath := os.Getenv("PATH")
 	defer os.Setenv("PATH", origPath)
@@ -1514,7 +1682,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetails(c *C) {
 	c.Check(result.Contact, Equals, "mailto:snappy-devel@lists.ubuntu.com")
 
 	// Make sure the epoch (currently not sent by the store) defaults to "0"
-	c.Check(result.Epoch, Equals, "0")
+	c.Check(result.Epoch.String(), Equals, "0")
 
 	c.Check(repo.SuggestedCurrency(), Equals, "GBP")
 
@@ -1756,6 +1924,39 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryStoreIDFromAuthContext(c
 	c.Check(result.Name(), Equals, "hello-world")
 }
 
+func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDetailsProxyStore(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/proxy/snaps/details/hello-world")
+		c.Check(r.URL.Query().Get("channel"), Equals, "edge")
+		c.Check(r.URL.Query().Get("fields"), Equals, "abc,def")
+
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, MockDetailsJSON)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	proxyStoreURL, err := url.Parse(mockServer.URL + "/proxy/")
+	c.Assert(err, IsNil)
+	detailsURI, err := url.Parse("http://upstream.example.com/details/")
+	c.Assert(err, IsNil)
+	cfg := DefaultConfig()
+	cfg.DetailsURI = detailsURI
+	cfg.DetailFields = []string{"abc", "def"}
+	repo := New(cfg, &testAuthContext{c: c, device: t.device, proxyStoreURL: proxyStoreURL})
+	c.Assert(repo, NotNil)
+
+	spec := SnapSpec{
+		Name:     "hello-world",
+		Channel:  "edge",
+		Revision: snap.R(0),
+	}
+	result, err := repo.SnapInfo(spec, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Name(), Equals, "hello-world")
+}
+
 func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryRevision(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.URL.Path, ordersPath) {
@@ -2389,7 +2590,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefresh(c *C) {
 			"snap_id":     helloWorldSnapID,
 			"channel":     "stable",
 			"revision":    float64(1),
-			"epoch":       "0",
+			"epoch":       "1*",
 			"confinement": "",
 		})
 		c.Assert(resp.Fields, DeepEquals, detailFields)
@@ -2415,7 +2616,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefresh(c *C) {
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(1),
-			Epoch:    "0",
+			Epoch:    snap.E("1*"),
 		},
 	}, nil)
 	c.Assert(err, IsNil)
@@ -2456,7 +2657,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefreshUnauthorised(c
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(24),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(n, Equals, 1)
@@ -2486,7 +2687,7 @@ func (t *remoteRepoTestSuite) TestListRefresh500(c *C) {
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(24),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, ErrorMatches, `cannot query the store for updates: got unexpected HTTP status code 500 via POST to "http://.*?/updates/"`)
@@ -2518,7 +2719,7 @@ func (t *remoteRepoTestSuite) TestListRefresh500DurationExceeded(c *C) {
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(24),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, ErrorMatches, `cannot query the store for updates: got unexpected HTTP status code 500 via POST to "http://.*?/updates/"`)
@@ -2565,7 +2766,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefreshSkipCurrent(c
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(26),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, IsNil)
@@ -2613,7 +2814,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefreshSkipBlocked(c
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(25),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 			Block:    []snap.Revision{snap.R(26)},
 		},
 	}, nil)
@@ -2721,7 +2922,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryDefaultsDeltasOnClassicOn
 				SnapID:   helloWorldSnapID,
 				Channel:  "stable",
 				Revision: snap.R(24),
-				Epoch:    "0",
+				Epoch:    snap.E("0"),
 			},
 		}, nil)
 	}
@@ -2774,7 +2975,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefreshWithDeltas(c *
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(24),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, IsNil)
@@ -2848,7 +3049,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryListRefreshWithoutDeltas(
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(24),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, IsNil)
@@ -2895,7 +3096,7 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryUpdateNotSendLocalRevs(c
 			SnapID:   helloWorldSnapID,
 			Channel:  "stable",
 			Revision: snap.R(-2),
-			Epoch:    "0",
+			Epoch:    snap.E("0"),
 		},
 	}, nil)
 	c.Assert(err, IsNil)
@@ -3030,6 +3231,31 @@ func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryAssertion(c *C) {
 	c.Check(a.Type(), Equals, asserts.SnapDeclarationType)
 }
 
+func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryAssertionProxyStore(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/assertions/snap-declaration/16/snapidfoo")
+		io.WriteString(w, testAssertion)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	proxyStoreURL, err := url.Parse(mockServer.URL + "/")
+	c.Assert(err, IsNil)
+	assertionsURI, err := url.Parse("http://upstream.example.com/v1/assertions/")
+	c.Assert(err, IsNil)
+
+	cfg := Config{
+		AssertionsURI: assertionsURI,
+	}
+	authContext := &testAuthContext{c: c, device: t.device, proxyStoreURL: proxyStoreURL}
+	repo := New(&cfg, authContext)
+
+	a, err := repo.Assertion(asserts.SnapDeclarationType, []string{"16", "snapidfoo"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.SnapDeclarationType)
+}
+
 func (t *remoteRepoTestSuite) TestUbuntuStoreRepositoryAssertionNotFound(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.Header.Get("Accept"), Equals, "application/x.ubuntu.assertion")
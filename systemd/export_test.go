@@ -20,6 +20,7 @@
 package systemd
 
 import (
+	"io"
 	"time"
 )
 
@@ -38,3 +39,11 @@ func MockStopDelays(checkDelay, notifyDelay time.Duration) func() {
 		stopNotifyDelay = oldNotifyDelay
 	}
 }
+
+func MockJournalctlStream(f func(svcs []string, n string, follow bool) (io.ReadCloser, error)) func() {
+	oldJctlStream := JournalctlStreamCmd
+	JournalctlStreamCmd = f
+	return func() {
+		JournalctlStreamCmd = oldJctlStream
+	}
+}
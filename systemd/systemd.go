@@ -82,6 +82,50 @@ func jctl(svcs []string) ([]byte, error) {
 // JournalctlCmd is called from Logs to run journalctl; exported for testing.
 var JournalctlCmd = jctl
 
+// jctlStream calls journalctl to stream the JSON logs of the given
+// services. n is the number of past entries to start with (or "all"),
+// and if follow is set journalctl keeps waiting for new entries until
+// the returned reader is closed.
+func jctlStream(svcs []string, n string, follow bool) (io.ReadCloser, error) {
+	cmd := []string{"journalctl", "-o", "json", "-n", n}
+	if follow {
+		cmd = append(cmd, "-f")
+	}
+	for i := range svcs {
+		cmd = append(cmd, "-u", svcs[i])
+	}
+
+	c := exec.Command(cmd[0], cmd[1:]...)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	return &journalReader{ReadCloser: stdout, cmd: c}, nil
+}
+
+// JournalctlStreamCmd is called from LogReader to run journalctl; exported for testing.
+var JournalctlStreamCmd = jctlStream
+
+// journalReader reads from the output of a running journalctl, stopping
+// it when closed.
+type journalReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *journalReader) Close() error {
+	// journalctl might be waiting for new entries, so kill it
+	// rather than waiting for it to exit on its own
+	r.cmd.Process.Kill()
+	err := r.ReadCloser.Close()
+	r.cmd.Wait()
+	return err
+}
+
 // Systemd exposes a minimal interface to manage systemd via the systemctl command.
 type Systemd interface {
 	DaemonReload() error
@@ -94,6 +138,7 @@ type Systemd interface {
 	Status(service string) (string, error)
 	ServiceStatus(service string) (*ServiceStatus, error)
 	Logs(services []string) ([]Log, error)
+	LogReader(services []string, n string, follow bool) (io.ReadCloser, error)
 	WriteMountUnitFile(name, what, where, fstype string) (string, error)
 }
 
@@ -228,6 +273,13 @@ func (*systemd) Logs(serviceNames []string) ([]Log, error) {
 	return logs, nil
 }
 
+// LogReader for the given services, starting with the last n entries
+// ("all" for all of them) and optionally following new ones. The
+// reader yields the entries as a stream of JSON objects, see Log.
+func (*systemd) LogReader(serviceNames []string, n string, follow bool) (io.ReadCloser, error) {
+	return JournalctlStreamCmd(serviceNames, n, follow)
+}
+
 var statusregex = regexp.MustCompile(`(?m)^(?:(.*?)=(.*))?$`)
 
 func (s *systemd) Status(serviceName string) (string, error) {
@@ -360,28 +412,39 @@ func IsTimeout(err error) bool {
 
 const myFmt = "2006-01-02T15:04:05.000000Z07:00"
 
+var errNoTimestamp = errors.New("no timestamp!")
+
+// Time of the Log, in UTC.
+func (l Log) Time() (time.Time, error) {
+	ius, ok := l["__REALTIME_TIMESTAMP"]
+	if !ok {
+		return time.Time{}, errNoTimestamp
+	}
+	// according to systemd.journal-fields(7) it's microseconds as a decimal string
+	sus, ok := ius.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("timestamp not a string: %#v", ius)
+	}
+	us, err := strconv.ParseInt(sus, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp not a decimal number: %#v", sus)
+	}
+
+	return time.Unix(us/1000000, 1000*(us%1000000)).UTC(), nil
+}
+
 // Timestamp of the Log, formatted like RFC3339 to µs precision.
 //
 // If no timestamp, the string "-(no timestamp!)-" -- and something is
 // wrong with your system. Some other "impossible" error conditions
 // also result in "-(errror message)-" timestamps.
 func (l Log) Timestamp() string {
-	t := "-(no timestamp!)-"
-	if ius, ok := l["__REALTIME_TIMESTAMP"]; ok {
-		// according to systemd.journal-fields(7) it's microseconds as a decimal string
-		sus, ok := ius.(string)
-		if ok {
-			if us, err := strconv.ParseInt(sus, 10, 64); err == nil {
-				t = time.Unix(us/1000000, 1000*(us%1000000)).UTC().Format(myFmt)
-			} else {
-				t = fmt.Sprintf("-(timestamp not a decimal number: %#v)-", sus)
-			}
-		} else {
-			t = fmt.Sprintf("-(timestamp not a string: %#v)-", ius)
-		}
+	t, err := l.Time()
+	if err != nil {
+		return fmt.Sprintf("-(%v)-", err)
 	}
 
-	return t
+	return t.Format(myFmt)
 }
 
 // Message of the Log, if any; otherwise, "-".
@@ -402,6 +465,18 @@ func (l Log) SID() string {
 	return "-"
 }
 
+// PID of the process that logged the Log, if any; otherwise, "-".
+func (l Log) PID() string {
+	if pid, ok := l["_PID"].(string); ok {
+		return pid
+	}
+	if pid, ok := l["SYSLOG_PID"].(string); ok {
+		return pid
+	}
+
+	return "-"
+}
+
 func (l Log) String() string {
 	return fmt.Sprintf("%s %s %s", l.Timestamp(), l.SID(), l.Message())
 }
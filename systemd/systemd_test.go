@@ -21,9 +21,11 @@ package systemd_test
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -256,6 +258,41 @@ func (s *SystemdTestSuite) TestLogs(c *C) {
 	c.Check(s.j, Equals, 1)
 }
 
+func (s *SystemdTestSuite) TestLogReader(c *C) {
+	var args []interface{}
+	restore := MockJournalctlStream(func(svcs []string, n string, follow bool) (io.ReadCloser, error) {
+		args = []interface{}{svcs, n, follow}
+		return ioutil.NopCloser(strings.NewReader(`{"a": 1}`)), nil
+	})
+	defer restore()
+
+	r, err := New("", s.rep).LogReader([]string{"foo", "bar"}, "10", true)
+	c.Assert(err, IsNil)
+	defer r.Close()
+	bs, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Check(string(bs), Equals, `{"a": 1}`)
+	c.Check(args, DeepEquals, []interface{}{[]string{"foo", "bar"}, "10", true})
+}
+
+func (s *SystemdTestSuite) TestLogTime(c *C) {
+	t, err := Log{"__REALTIME_TIMESTAMP": "42"}.Time()
+	c.Assert(err, IsNil)
+	c.Check(t, Equals, time.Unix(0, 42000).UTC())
+
+	_, err = Log{}.Time()
+	c.Check(err, ErrorMatches, "no timestamp!")
+	_, err = Log{"__REALTIME_TIMESTAMP": 42}.Time()
+	c.Check(err, ErrorMatches, "timestamp not a string: 42")
+}
+
+func (s *SystemdTestSuite) TestLogPID(c *C) {
+	c.Check(Log{}.PID(), Equals, "-")
+	c.Check(Log{"_PID": "99"}.PID(), Equals, "99")
+	c.Check(Log{"SYSLOG_PID": "101"}.PID(), Equals, "101")
+	c.Check(Log{"_PID": "99", "SYSLOG_PID": "101"}.PID(), Equals, "99")
+}
+
 func (s *SystemdTestSuite) TestLogString(c *C) {
 	c.Check(Log{}.String(), Equals, "-(no timestamp!)- - -")
 	c.Check(Log{
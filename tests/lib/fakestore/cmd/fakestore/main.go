@@ -35,6 +35,7 @@ import (
 var (
 	start           = flag.Bool("start", false, "Start the store service")
 	assertFallback  = flag.Bool("assert-fallback", false, "Fallback to the main online store for missing assertions")
+	proxy           = flag.Bool("proxy", false, "Act as a caching proxy for the main online store, serving from <dir>/cache what was fetched when it cannot be reached")
 	topDir          = flag.String("dir", "", "Directory to be used by the store to keep and serve snaps, <dir>/asserts is used for assertions")
 	makeRefreshable = flag.String("make-refreshable", "", "List of snaps with new versions separated by commas")
 	addr            = flag.String("addr", "localhost:11028", "Store address")
@@ -67,7 +68,7 @@ func run() error {
 	}
 
 	if *start {
-		return runServer(*topDir, *addr, *assertFallback)
+		return runServer(*topDir, *addr, *assertFallback, *proxy)
 	}
 
 	if *makeRefreshable != "" {
@@ -77,8 +78,13 @@ func run() error {
 	return fmt.Errorf("please specify either start or make-refreshable")
 }
 
-func runServer(topDir, addr string, assertFallback bool) error {
-	st := store.NewStore(topDir, addr, assertFallback)
+func runServer(topDir, addr string, assertFallback, proxy bool) error {
+	var st *store.Store
+	if proxy {
+		st = store.NewProxyStore(topDir, addr)
+	} else {
+		st = store.NewStore(topDir, addr, assertFallback)
+	}
 
 	if err := st.Start(); err != nil {
 		return err
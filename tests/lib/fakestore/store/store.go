@@ -27,10 +27,14 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/net/context"
 	"gopkg.in/tylerb/graceful.v1"
 
 	"github.com/snapcore/snapd/asserts"
@@ -38,6 +42,7 @@ import (
 	"github.com/snapcore/snapd/asserts/systestkeys"
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 )
@@ -64,6 +69,15 @@ type Store struct {
 	assertFallback bool
 	fallback       *store.Store
 
+	// in proxy mode what is missing locally is fetched from the
+	// fallback store and cached in cacheDir (snaps, snap details
+	// and refresh information) and assertDir (assertions)
+	proxy      bool
+	cacheDir   string
+	downloadMu sync.Mutex
+
+	blobServer http.Handler
+
 	srv *graceful.Server
 }
 
@@ -97,12 +111,29 @@ func NewStore(topDir, addr string, assertFallback bool) *Store {
 	mux.HandleFunc("/search", store.searchEndpoint)
 	mux.HandleFunc("/snaps/details/", store.detailsEndpoint)
 	mux.HandleFunc("/snaps/metadata", store.bulkEndpoint)
-	mux.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(topDir))))
+	mux.HandleFunc("/snaps/action", store.snapActionEndpoint)
+	// the file server honours Range requests, so downloads can be resumed
+	store.blobServer = http.StripPrefix("/download/", http.FileServer(http.Dir(topDir)))
+	mux.HandleFunc("/download/", store.downloadEndpoint)
 	mux.HandleFunc("/assertions/", store.assertionsEndpoint)
 
 	return store
 }
 
+// NewProxyStore creates a new store server that serves the snaps in
+// topDir and the assertions in topDir/asserts like NewStore, and that
+// acts as a caching proxy for the main online store for everything
+// else. Snaps, snap details and refresh information fetched from the
+// online store are cached in topDir/cache, fetched assertions in
+// topDir/asserts, so that they can be served also when the online store
+// cannot be reached.
+func NewProxyStore(topDir, addr string) *Store {
+	store := NewStore(topDir, addr, true)
+	store.proxy = true
+	store.cacheDir = filepath.Join(topDir, "cache")
+	return store
+}
+
 // URL returns the base-url that the store is listening on
 func (s *Store) URL() string {
 	return s.url
@@ -114,6 +145,14 @@ func (s *Store) SnapsDir() string {
 
 // Start listening
 func (s *Store) Start() error {
+	if s.proxy {
+		for _, dir := range []string{s.assertDir, s.cacheDir} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+	}
+
 	l, err := net.Listen("tcp", s.srv.Addr)
 	if err != nil {
 		return err
@@ -243,6 +282,22 @@ type detailsReplyJSON struct {
 	Version         string   `json:"version"`
 	Revision        int      `json:"revision"`
 	DownloadDigest  string   `json:"download_sha3_384"`
+	DownloadSize    int64    `json:"binary_filesize,omitempty"`
+}
+
+func (s *Store) detailsReply(fn string, essInfo *essentialInfo) detailsReplyJSON {
+	return detailsReplyJSON{
+		Architectures:   []string{"all"},
+		SnapID:          essInfo.SnapID,
+		PackageName:     essInfo.Name,
+		Developer:       essInfo.DevelName,
+		DeveloperID:     essInfo.DeveloperID,
+		AnonDownloadURL: fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
+		DownloadURL:     fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
+		Version:         essInfo.Version,
+		Revision:        essInfo.Revision,
+		DownloadDigest:  hexify(essInfo.Digest),
+	}
 }
 
 func (s *Store) searchEndpoint(w http.ResponseWriter, req *http.Request) {
@@ -269,6 +324,10 @@ func (s *Store) detailsEndpoint(w http.ResponseWriter, req *http.Request) {
 
 	fn, ok := snaps[pkg]
 	if !ok {
+		if s.proxy {
+			s.proxyDetails(w, req, pkg)
+			return
+		}
 		http.NotFound(w, req)
 		return
 	}
@@ -281,18 +340,7 @@ func (s *Store) detailsEndpoint(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	details := detailsReplyJSON{
-		Architectures:   []string{"all"},
-		SnapID:          essInfo.SnapID,
-		PackageName:     essInfo.Name,
-		Developer:       essInfo.DevelName,
-		DeveloperID:     essInfo.DeveloperID,
-		AnonDownloadURL: fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
-		DownloadURL:     fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
-		Version:         essInfo.Version,
-		Revision:        essInfo.Revision,
-		DownloadDigest:  hexify(essInfo.Digest),
-	}
+	details := s.detailsReply(fn, essInfo)
 
 	// use indent because this is a development tool, output
 	// should look nice
@@ -328,7 +376,9 @@ func (s *Store) collectSnaps() (map[string]string, error) {
 }
 
 type candidateSnap struct {
-	SnapID string `json:"snap_id"`
+	SnapID  string     `json:"snap_id"`
+	Channel string     `json:"channel"`
+	Epoch   snap.Epoch `json:"epoch"`
 }
 
 type bulkReqJSON struct {
@@ -397,15 +447,21 @@ func (s *Store) bulkEndpoint(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// check if we have downloadable snap of the given SnapID
+	var upstream []candidateSnap
 	for _, pkg := range pkgs.CandidateSnaps {
 
 		name := snapIDtoName[pkg.SnapID]
-		if name == "" {
+		if name == "" && !s.proxy {
 			http.Error(w, fmt.Sprintf("unknown snapid: %q", pkg.SnapID), http.StatusBadRequest)
 			return
 		}
 
-		if fn, ok := snaps[name]; ok {
+		fn, ok := snaps[name]
+		if !ok && s.proxy {
+			upstream = append(upstream, pkg)
+			continue
+		}
+		if ok {
 			essInfo, err := snapEssentialInfo(w, fn, pkg.SnapID, bs)
 			if essInfo == nil {
 				if err != errInfo {
@@ -414,21 +470,19 @@ func (s *Store) bulkEndpoint(w http.ResponseWriter, req *http.Request) {
 				return
 			}
 
-			replyData.Payload.Packages = append(replyData.Payload.Packages, detailsReplyJSON{
-				Architectures:   []string{"all"},
-				SnapID:          essInfo.SnapID,
-				PackageName:     essInfo.Name,
-				Developer:       essInfo.DevelName,
-				DeveloperID:     essInfo.DeveloperID,
-				DownloadURL:     fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
-				AnonDownloadURL: fmt.Sprintf("%s/download/%s", s.URL(), filepath.Base(fn)),
-				Version:         essInfo.Version,
-				Revision:        essInfo.Revision,
-				DownloadDigest:  hexify(essInfo.Digest),
-			})
+			replyData.Payload.Packages = append(replyData.Payload.Packages, s.detailsReply(fn, essInfo))
 		}
 	}
 
+	if len(upstream) > 0 {
+		packages, err := s.proxyRefresh(upstream)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot query the online store for updates: %v", err), http.StatusBadGateway)
+			return
+		}
+		replyData.Payload.Packages = append(replyData.Payload.Packages, packages...)
+	}
+
 	// use indent because this is a development tool, output
 	// should look nice
 	out, err := json.MarshalIndent(replyData, "", "    ")
@@ -440,6 +494,139 @@ func (s *Store) bulkEndpoint(w http.ResponseWriter, req *http.Request) {
 
 }
 
+type currentSnapJSON struct {
+	SnapID          string     `json:"snap-id"`
+	InstanceKey     string     `json:"instance-key"`
+	Revision        int        `json:"revision"`
+	TrackingChannel string     `json:"tracking-channel"`
+	Epoch           snap.Epoch `json:"epoch"`
+}
+
+type snapActionJSON struct {
+	Action      string `json:"action"`
+	InstanceKey string `json:"instance-key"`
+	Name        string `json:"name"`
+	SnapID      string `json:"snap-id"`
+	Channel     string `json:"channel"`
+	Revision    int    `json:"revision"`
+}
+
+type snapActionRequestJSON struct {
+	Context []currentSnapJSON `json:"context"`
+	Actions []snapActionJSON  `json:"actions"`
+	Fields  []string          `json:"fields"`
+}
+
+type snapActionErrorJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type snapActionResultJSON struct {
+	Result      string               `json:"result"`
+	InstanceKey string               `json:"instance-key"`
+	SnapID      string               `json:"snap-id,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Snap        *detailsReplyJSON    `json:"snap,omitempty"`
+	Error       *snapActionErrorJSON `json:"error,omitempty"`
+}
+
+type snapActionReplyJSON struct {
+	Results []snapActionResultJSON `json:"results"`
+}
+
+func (s *Store) snapActionEndpoint(w http.ResponseWriter, req *http.Request) {
+	var reqData snapActionRequestJSON
+	var replyData snapActionReplyJSON
+
+	decoder := json.NewDecoder(req.Body)
+	if err := decoder.Decode(&reqData); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	bs, err := s.collectAssertions()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("internal error collecting assertions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var remoteStore string
+	if osutil.GetenvBool("SNAPPY_USE_STAGING_STORE") {
+		remoteStore = "staging"
+	} else {
+		remoteStore = "production"
+	}
+	snapIDtoName, err := addSnapIDs(bs, someSnapIDtoName[remoteStore])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("internal error collecting snapIDs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	snaps, err := s.collectSnaps()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("internal error collecting snaps: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	tracking := make(map[string]string, len(reqData.Context))
+	for _, cur := range reqData.Context {
+		tracking[cur.SnapID] = cur.TrackingChannel
+	}
+
+	for _, a := range reqData.Actions {
+		res := snapActionResultJSON{
+			Result:      a.Action,
+			InstanceKey: a.InstanceKey,
+			SnapID:      a.SnapID,
+			Name:        a.Name,
+		}
+		notFound := "name-not-found"
+		if a.Action == "refresh" {
+			res.Name = snapIDtoName[a.SnapID]
+			notFound = "id-not-found"
+		}
+
+		if fn, ok := snaps[res.Name]; ok {
+			essInfo, err := snapEssentialInfo(w, fn, a.SnapID, bs)
+			if essInfo == nil {
+				if err != errInfo {
+					panic(err)
+				}
+				return
+			}
+			details := s.detailsReply(fn, essInfo)
+			res.SnapID = details.SnapID
+			res.Snap = &details
+		} else if s.proxy {
+			details, err := s.proxySnapAction(a, tracking[a.SnapID])
+			if err != nil && err != store.ErrSnapNotFound {
+				http.Error(w, fmt.Sprintf("cannot query the online store for snap actions: %v", err), http.StatusBadGateway)
+				return
+			}
+			res.Snap = details
+		}
+
+		if res.Snap == nil {
+			res.Result = "error"
+			res.Error = &snapActionErrorJSON{
+				Code:    notFound,
+				Message: "snap not found",
+			}
+		}
+		replyData.Results = append(replyData.Results, res)
+	}
+
+	// use indent because this is a development tool, output
+	// should look nice
+	out, err := json.MarshalIndent(replyData, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot marshal: %v: %v", replyData, err), http.StatusBadRequest)
+		return
+	}
+	w.Write(out)
+}
+
 func (s *Store) collectAssertions() (asserts.Backstore, error) {
 	bs := asserts.NewMemoryBackstore()
 
@@ -489,7 +676,14 @@ func isAssertNotFound(err error) bool {
 func (s *Store) retrieveAssertion(bs asserts.Backstore, assertType *asserts.AssertionType, primaryKey []string) (asserts.Assertion, error) {
 	a, err := bs.Get(assertType, primaryKey, assertType.MaxSupportedFormat())
 	if err == asserts.ErrNotFound && s.assertFallback {
-		return s.fallback.Assertion(assertType, primaryKey, nil)
+		a, err = s.fallback.Assertion(assertType, primaryKey, nil)
+		if err == nil && s.proxy {
+			// keep it around to be able to serve it offline
+			fn := filepath.Join(s.assertDir, cacheName(append([]string{assertType.Name}, primaryKey...)...)+".assert")
+			if err := osutil.AtomicWriteFile(fn, asserts.Encode(a), 0644, 0); err != nil {
+				return nil, err
+			}
+		}
 	}
 	return a, err
 }
@@ -573,3 +767,248 @@ func findSnapRevision(snapDigest string, bs asserts.Backstore) (*asserts.SnapRev
 
 	return snapRev, devAcct, nil
 }
+
+// cacheName returns a file name for caching what is identified by the
+// given key components.
+func cacheName(comps ...string) string {
+	escaped := make([]string, len(comps))
+	for i, comp := range comps {
+		escaped[i] = url.QueryEscape(comp)
+	}
+	return strings.Join(escaped, "_")
+}
+
+func (s *Store) downloadEndpoint(w http.ResponseWriter, req *http.Request) {
+	fn := filepath.Base(strings.TrimPrefix(req.URL.Path, "/download/"))
+	if !s.proxy || osutil.FileExists(filepath.Join(s.blobDir, fn)) {
+		s.blobServer.ServeHTTP(w, req)
+		return
+	}
+
+	cachedFn := filepath.Join(s.cacheDir, fn)
+	if err := s.proxyDownload(cachedFn); err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		}
+		http.Error(w, fmt.Sprintf("cannot download %s from the online store: %v", fn, err), http.StatusBadGateway)
+		return
+	}
+	http.ServeFile(w, req, cachedFn)
+}
+
+// proxyDownload makes sure the snap cachedFn is in the cache,
+// downloading it from the online store using the download information
+// stored alongside it if needed.
+func (s *Store) proxyDownload(cachedFn string) error {
+	s.downloadMu.Lock()
+	defer s.downloadMu.Unlock()
+
+	if osutil.FileExists(cachedFn) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(cachedFn + ".json")
+	if err != nil {
+		return err
+	}
+	var downloadInfo snap.DownloadInfo
+	if err := json.Unmarshal(b, &downloadInfo); err != nil {
+		return err
+	}
+
+	name := strings.SplitN(filepath.Base(cachedFn), "_", 2)[0]
+	return s.fallback.Download(context.TODO(), name, cachedFn, &downloadInfo, &progress.NullProgress{}, nil)
+}
+
+// proxyReply returns the reply details for a snap from the online
+// store, pointing its download to this store.
+func (s *Store) proxyReply(info *snap.Info) (*detailsReplyJSON, error) {
+	fn := fmt.Sprintf("%s_%s.snap", info.Name(), info.Revision)
+	b, err := json.Marshal(&info.DownloadInfo)
+	if err != nil {
+		return nil, err
+	}
+	if err := osutil.AtomicWriteFile(filepath.Join(s.cacheDir, fn+".json"), b, 0644, 0); err != nil {
+		return nil, err
+	}
+
+	downloadURL := fmt.Sprintf("%s/download/%s", s.URL(), fn)
+	return &detailsReplyJSON{
+		Architectures:   info.Architectures,
+		SnapID:          info.SnapID,
+		PackageName:     info.Name(),
+		Developer:       info.Publisher,
+		DeveloperID:     info.PublisherID,
+		AnonDownloadURL: downloadURL,
+		DownloadURL:     downloadURL,
+		Version:         info.Version,
+		Revision:        info.Revision.N,
+		DownloadDigest:  info.Sha3_384,
+		DownloadSize:    info.Size,
+	}, nil
+}
+
+func (s *Store) proxyDetails(w http.ResponseWriter, req *http.Request, name string) {
+	q := req.URL.Query()
+	spec := store.SnapSpec{
+		Name:    name,
+		Channel: q.Get("channel"),
+	}
+	if q.Get("revision") != "" {
+		rev, err := snap.ParseRevision(q.Get("revision"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid revision: %v", err), http.StatusBadRequest)
+			return
+		}
+		spec.Revision = rev
+	}
+
+	out, err := s.proxySnapInfo(spec)
+	if err == store.ErrSnapNotFound {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot get details for %s from the online store: %v", name, err), http.StatusBadGateway)
+		return
+	}
+	w.Write(out)
+}
+
+// proxySnapInfo returns the marshalled details for a snap from the
+// online store, or from the cache if the online store cannot be
+// reached.
+func (s *Store) proxySnapInfo(spec store.SnapSpec) ([]byte, error) {
+	var revision string
+	if !spec.Revision.Unset() {
+		revision = spec.Revision.String()
+	}
+	cachedFn := filepath.Join(s.cacheDir, "details_"+cacheName(spec.Name, spec.Channel, revision)+".json")
+
+	info, err := s.fallback.SnapInfo(spec, nil)
+	if err == store.ErrSnapNotFound {
+		return nil, err
+	}
+	if err != nil {
+		// the online store cannot be reached, try the cache
+		out, cerr := ioutil.ReadFile(cachedFn)
+		if cerr != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	details, err := s.proxyReply(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// use indent because this is a development tool, output
+	// should look nice
+	out, err := json.MarshalIndent(details, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := osutil.AtomicWriteFile(cachedFn, out, 0644, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// proxyRefresh returns the refresh information for the given snaps from
+// the online store, or from the cache if the online store cannot be
+// reached.
+func (s *Store) proxyRefresh(pkgs []candidateSnap) ([]detailsReplyJSON, error) {
+	cachedFn := func(pkg candidateSnap) string {
+		return filepath.Join(s.cacheDir, "refresh_"+cacheName(pkg.SnapID, pkg.Channel)+".json")
+	}
+
+	// no revision is asked for so that the latest one is returned
+	// and cached independently of what the device has
+	cands := make([]*store.RefreshCandidate, len(pkgs))
+	for i, pkg := range pkgs {
+		cands[i] = &store.RefreshCandidate{
+			SnapID:  pkg.SnapID,
+			Channel: pkg.Channel,
+			Epoch:   pkg.Epoch,
+		}
+	}
+
+	var packages []detailsReplyJSON
+	infos, err := s.fallback.ListRefresh(cands, nil)
+	if err != nil {
+		// the online store cannot be reached, use the cache
+		for _, pkg := range pkgs {
+			b, err := ioutil.ReadFile(cachedFn(pkg))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			var details detailsReplyJSON
+			if err := json.Unmarshal(b, &details); err != nil {
+				return nil, err
+			}
+			packages = append(packages, details)
+		}
+		return packages, nil
+	}
+
+	channels := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		channels[pkg.SnapID] = pkg.Channel
+	}
+	for _, info := range infos {
+		details, err := s.proxyReply(info)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+		pkg := candidateSnap{SnapID: info.SnapID, Channel: channels[info.SnapID]}
+		if err := osutil.AtomicWriteFile(cachedFn(pkg), b, 0644, 0); err != nil {
+			return nil, err
+		}
+		packages = append(packages, *details)
+	}
+	return packages, nil
+}
+
+// proxySnapAction returns the details for the snap of an install,
+// download or refresh action from the online store, or from the cache
+// if the online store cannot be reached. It returns
+// store.ErrSnapNotFound if the online store has nothing for the action.
+func (s *Store) proxySnapAction(a snapActionJSON, trackingChannel string) (*detailsReplyJSON, error) {
+	if a.Action == "refresh" {
+		channel := a.Channel
+		if channel == "" {
+			channel = trackingChannel
+		}
+		packages, err := s.proxyRefresh([]candidateSnap{{SnapID: a.SnapID, Channel: channel}})
+		if err != nil {
+			return nil, err
+		}
+		if len(packages) == 0 {
+			return nil, store.ErrSnapNotFound
+		}
+		return &packages[0], nil
+	}
+
+	out, err := s.proxySnapInfo(store.SnapSpec{
+		Name:     a.Name,
+		Channel:  a.Channel,
+		Revision: snap.R(a.Revision),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var details detailsReplyJSON
+	if err := json.Unmarshal(out, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
@@ -22,17 +22,27 @@ package store
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+	"gopkg.in/retry.v1"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/systestkeys"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/store"
 
 	. "gopkg.in/check.v1"
 )
@@ -103,6 +113,24 @@ func (s *storeTestSuite) TestTrivialGetWorks(c *C) {
 
 }
 
+func (s *storeTestSuite) TestDownloadRange(c *C) {
+	err := ioutil.WriteFile(filepath.Join(s.store.blobDir, "foo_1_all.snap"), []byte("0123456789"), 0644)
+	c.Assert(err, IsNil)
+
+	req, err := http.NewRequest("GET", s.store.URL()+"/download/foo_1_all.snap", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Range", "bytes=4-")
+	resp, err := s.client.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	c.Assert(resp.StatusCode, Equals, http.StatusPartialContent)
+	c.Check(resp.Header.Get("Content-Range"), Equals, "bytes 4-9/10")
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, "456789")
+}
+
 func (s *storeTestSuite) TestSearchEndpoint(c *C) {
 	resp, err := s.StoreGet("/search")
 	c.Assert(err, IsNil)
@@ -228,6 +256,74 @@ func (s *storeTestSuite) TestBulkEndpointWithAssertions(c *C) {
 	}})
 }
 
+func (s *storeTestSuite) TestSnapActionEndpoint(c *C) {
+	snapFn := s.makeTestSnap(c, "name: foo\nversion: 10")
+	s.makeAssertions(c, snapFn, "foo", "xidididididididididididididididid", "foo-devel", "foo-devel-id", 99)
+
+	resp, err := s.StorePostJSON("/snaps/action", []byte(`{
+"context": [{"instance-key":"xidididididididididididididididid","snap-id":"xidididididididididididididididid","tracking-channel":"stable","revision":1}],
+"actions": [{"action":"refresh","instance-key":"xidididididididididididididididid","snap-id":"xidididididididididididididididid"},
+            {"action":"install","instance-key":"install-foo","name":"foo","channel":"stable"}]
+}`))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	c.Assert(resp.StatusCode, Equals, 200)
+	var body struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+	details := map[string]interface{}{
+		"architecture":      []interface{}{"all"},
+		"snap_id":           "xidididididididididididididididid",
+		"package_name":      "foo",
+		"origin":            "foo-devel",
+		"developer_id":      "foo-devel-id",
+		"anon_download_url": s.store.URL() + "/download/foo_10_all.snap",
+		"download_url":      s.store.URL() + "/download/foo_10_all.snap",
+		"version":           "10",
+		"revision":          float64(99),
+		"download_sha3_384": getSha(snapFn),
+	}
+	c.Check(body.Results, DeepEquals, []map[string]interface{}{{
+		"result":       "refresh",
+		"instance-key": "xidididididididididididididididid",
+		"snap-id":      "xidididididididididididididididid",
+		"name":         "foo",
+		"snap":         details,
+	}, {
+		"result":       "install",
+		"instance-key": "install-foo",
+		"snap-id":      "xidididididididididididididididid",
+		"name":         "foo",
+		"snap":         details,
+	}})
+}
+
+func (s *storeTestSuite) TestSnapActionEndpointNotFound(c *C) {
+	resp, err := s.StorePostJSON("/snaps/action", []byte(`{
+"context": [],
+"actions": [{"action":"install","instance-key":"install-foo","name":"foo"}]
+}`))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	c.Assert(resp.StatusCode, Equals, 200)
+	var body struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+	c.Check(body.Results, DeepEquals, []map[string]interface{}{{
+		"result":       "error",
+		"instance-key": "install-foo",
+		"name":         "foo",
+		"error": map[string]interface{}{
+			"code":    "name-not-found",
+			"message": "snap not found",
+		},
+	}})
+}
+
 func (s *storeTestSuite) makeTestSnap(c *C, snapYamlContent string) string {
 	fn := snaptest.MakeTestSnapWithFiles(c, snapYamlContent, nil)
 	dst := filepath.Join(s.store.blobDir, filepath.Base(fn))
@@ -390,3 +486,222 @@ func (s *storeTestSuite) TestAssertionsEndpointNotFound(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(respObj["status"], Equals, float64(404))
 }
+
+type proxyStoreTestSuite struct {
+	client   *http.Client
+	store    *Store
+	upstream *httptest.Server
+	offline  bool
+
+	restoreRetryStrategy func()
+}
+
+var _ = Suite(&proxyStoreTestSuite{})
+
+var (
+	proxyAddr = "localhost:23322"
+	proxyBlob = []byte("snap-blob-content")
+)
+
+func (s *proxyStoreTestSuite) SetUpTest(c *C) {
+	s.offline = false
+	s.restoreRetryStrategy = store.MockRetryStrategy(retry.LimitCount(5, retry.LimitTime(1*time.Second,
+		retry.Exponential{
+			Initial: 1 * time.Millisecond,
+			Factor:  1,
+		},
+	)))
+	s.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.offline {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		details := map[string]interface{}{
+			"architecture":      []string{"all"},
+			"snap_id":           "xidididididididididididididididid",
+			"package_name":      "foo",
+			"origin":            "foo-devel",
+			"developer_id":      "foo-devel-id",
+			"anon_download_url": s.upstream.URL + "/blob",
+			"download_url":      s.upstream.URL + "/blob",
+			"version":           "3",
+			"revision":          3,
+			"download_sha3_384": fmt.Sprintf("%x", sha3.Sum384(proxyBlob)),
+			"binary_filesize":   len(proxyBlob),
+		}
+		switch r.URL.Path {
+		case "/details/foo":
+			json.NewEncoder(w).Encode(details)
+		case "/details/bar":
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"errors": ["snap not found"]}`)
+		case "/metadata":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"_embedded": map[string]interface{}{
+					"clickindex:package": []interface{}{details},
+				},
+			})
+		case "/blob":
+			w.Write(proxyBlob)
+		case "/assertions/snap-revision/QlqR0uAWEAWF5Nwnzj5kqmmwFslYPu1IL16MKtLKhwhv0kpBv5wKZ_axf_nf_2cL":
+			w.Header().Set("Content-Type", asserts.MediaType)
+			io.WriteString(w, exampleSnapRev)
+		default:
+			c.Errorf("unexpected request to %q", r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	topdir := c.MkDir()
+	s.store = NewProxyStore(topdir, proxyAddr)
+	detailsURI, _ := url.Parse(s.upstream.URL + "/details/")
+	bulkURI, _ := url.Parse(s.upstream.URL + "/metadata")
+	assertionsURI, _ := url.Parse(s.upstream.URL + "/assertions/")
+	s.store.fallback = store.New(&store.Config{
+		DetailsURI:    detailsURI,
+		BulkURI:       bulkURI,
+		AssertionsURI: assertionsURI,
+	}, nil)
+	err := s.store.Start()
+	c.Assert(err, IsNil)
+
+	s.client = &http.Client{
+		Transport: &http.Transport{},
+	}
+}
+
+func (s *proxyStoreTestSuite) TearDownTest(c *C) {
+	s.client.Transport.(*http.Transport).CloseIdleConnections()
+	err := s.store.Stop()
+	c.Assert(err, IsNil)
+	s.upstream.Close()
+	s.restoreRetryStrategy()
+}
+
+func (s *proxyStoreTestSuite) get(c *C, path string) (int, []byte) {
+	resp, err := s.client.Get(s.store.URL() + path)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	return resp.StatusCode, body
+}
+
+func (s *proxyStoreTestSuite) TestDetailsAndDownload(c *C) {
+	status, body := s.get(c, "/snaps/details/foo?channel=stable")
+	c.Assert(status, Equals, 200)
+
+	var details map[string]interface{}
+	c.Assert(json.Unmarshal(body, &details), IsNil)
+	c.Check(details["anon_download_url"], Equals, s.store.URL()+"/download/foo_3.snap")
+	c.Check(details["download_url"], Equals, s.store.URL()+"/download/foo_3.snap")
+	c.Check(details["revision"], Equals, float64(3))
+	c.Check(details["binary_filesize"], Equals, float64(len(proxyBlob)))
+
+	status, blob := s.get(c, "/download/foo_3.snap")
+	c.Assert(status, Equals, 200)
+	c.Check(blob, DeepEquals, proxyBlob)
+	cached, err := ioutil.ReadFile(filepath.Join(s.store.cacheDir, "foo_3.snap"))
+	c.Assert(err, IsNil)
+	c.Check(cached, DeepEquals, proxyBlob)
+
+	// everything is served from the cache when offline
+	s.offline = true
+	status, offlineBody := s.get(c, "/snaps/details/foo?channel=stable")
+	c.Assert(status, Equals, 200)
+	c.Check(offlineBody, DeepEquals, body)
+	status, blob = s.get(c, "/download/foo_3.snap")
+	c.Assert(status, Equals, 200)
+	c.Check(blob, DeepEquals, proxyBlob)
+
+	// but not what was never fetched
+	status, _ = s.get(c, "/snaps/details/foo?channel=edge")
+	c.Check(status, Equals, http.StatusBadGateway)
+	status, _ = s.get(c, "/download/foo_4.snap")
+	c.Check(status, Equals, http.StatusNotFound)
+}
+
+func (s *proxyStoreTestSuite) TestDetailsNotFound(c *C) {
+	status, _ := s.get(c, "/snaps/details/bar")
+	c.Check(status, Equals, http.StatusNotFound)
+}
+
+func (s *proxyStoreTestSuite) TestBulk(c *C) {
+	post := func() []map[string]interface{} {
+		resp, err := s.client.Post(s.store.URL()+"/snaps/metadata", "application/json", strings.NewReader(`{
+"snaps": [{"snap_id":"xidididididididididididididididid","channel":"stable","revision":1}]
+}`))
+		c.Assert(err, IsNil)
+		defer resp.Body.Close()
+		c.Assert(resp.StatusCode, Equals, 200)
+
+		var body struct {
+			Top struct {
+				Cat []map[string]interface{} `json:"clickindex:package"`
+			} `json:"_embedded"`
+		}
+		c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+		return body.Top.Cat
+	}
+
+	pkgs := post()
+	c.Assert(pkgs, HasLen, 1)
+	c.Check(pkgs[0]["snap_id"], Equals, "xidididididididididididididididid")
+	c.Check(pkgs[0]["download_url"], Equals, s.store.URL()+"/download/foo_3.snap")
+	c.Check(pkgs[0]["revision"], Equals, float64(3))
+
+	s.offline = true
+	c.Check(post(), DeepEquals, pkgs)
+}
+
+func (s *proxyStoreTestSuite) TestSnapAction(c *C) {
+	refreshFoo := `{"action":"refresh","instance-key":"xidididididididididididididididid","snap-id":"xidididididididididididididididid"}`
+	installFoo := `{"action":"install","instance-key":"install-foo","name":"foo","channel":"stable"}`
+	installBar := `{"action":"install","instance-key":"install-bar","name":"bar","channel":"stable"}`
+	post := func(actions ...string) []map[string]interface{} {
+		resp, err := s.client.Post(s.store.URL()+"/snaps/action", "application/json", strings.NewReader(`{
+"context": [{"instance-key":"xidididididididididididididididid","snap-id":"xidididididididididididididididid","tracking-channel":"stable","revision":1}],
+"actions": [`+strings.Join(actions, ",")+`]
+}`))
+		c.Assert(err, IsNil)
+		defer resp.Body.Close()
+		c.Assert(resp.StatusCode, Equals, 200)
+
+		var body struct {
+			Results []map[string]interface{} `json:"results"`
+		}
+		c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+		return body.Results
+	}
+
+	results := post(refreshFoo, installFoo, installBar)
+	c.Assert(results, HasLen, 3)
+	for _, res := range results[:2] {
+		snap := res["snap"].(map[string]interface{})
+		c.Check(snap["download_url"], Equals, s.store.URL()+"/download/foo_3.snap")
+		c.Check(snap["revision"], Equals, float64(3))
+	}
+	c.Check(results[0]["result"], Equals, "refresh")
+	c.Check(results[1]["result"], Equals, "install")
+	c.Check(results[2]["result"], Equals, "error")
+
+	// the answers for foo are served from the cache when offline
+	s.offline = true
+	c.Check(post(refreshFoo, installFoo), DeepEquals, results[:2])
+}
+
+func (s *proxyStoreTestSuite) TestAssertionsCached(c *C) {
+	path := "/assertions/snap-revision/QlqR0uAWEAWF5Nwnzj5kqmmwFslYPu1IL16MKtLKhwhv0kpBv5wKZ_axf_nf_2cL"
+	status, body := s.get(c, path)
+	c.Assert(status, Equals, 200)
+	c.Check(string(body), Equals, exampleSnapRev)
+
+	fns, err := filepath.Glob(filepath.Join(s.store.assertDir, "*"))
+	c.Assert(err, IsNil)
+	c.Check(fns, HasLen, 1)
+
+	s.offline = true
+	status, body = s.get(c, path)
+	c.Assert(status, Equals, 200)
+	c.Check(string(body), Equals, exampleSnapRev)
+}
@@ -53,18 +53,53 @@ func ParseTime(s string) (t TimeOfDay, err error) {
 	return t, nil
 }
 
-// Schedule defines a start and end time and an optional weekday in which
-// events should run.
+// Schedule defines a start and end time and an optional weekday (or
+// range of weekdays) in which events should run.
 type Schedule struct {
 	Start TimeOfDay
 	End   TimeOfDay
 
 	Weekday string
+	// EndWeekday is set when the schedule covers a range of
+	// weekdays, from Weekday to EndWeekday inclusive.
+	EndWeekday string
+	// Week is set when the schedule only covers the nth Weekday
+	// of the month, 1 to 4, or 5 for the last one.
+	Week int
+}
+
+// includesDay checks whether the given day is covered by the weekday
+// part of the schedule.
+func (sched *Schedule) includesDay(t time.Time) bool {
+	if sched.Weekday == "" {
+		return true
+	}
+	wd := int(t.Weekday())
+	start := weekdayMap[sched.Weekday]
+	if sched.EndWeekday != "" {
+		end := weekdayMap[sched.EndWeekday]
+		if start <= end {
+			return wd >= start && wd <= end
+		}
+		// ranges like fri-mon wrap around the end of the week
+		return wd >= start || wd <= end
+	}
+	if wd != start {
+		return false
+	}
+	switch sched.Week {
+	case 0:
+		return true
+	case 5:
+		// the last one of the month: a week later is next month
+		return t.Add(7*24*time.Hour).Month() != t.Month()
+	default:
+		return (t.Day()-1)/7+1 == sched.Week
+	}
 }
 
 func (sched *Schedule) Next(last time.Time) (start, end time.Time) {
 	now := timeNow()
-	wd := time.Weekday(weekdayMap[sched.Weekday])
 
 	t := last
 	for {
@@ -76,14 +111,14 @@ func (sched *Schedule) Next(last time.Time) (start, end time.Time) {
 		t = t.Add(24 * time.Hour)
 
 		// we have not hit the right day yet
-		if sched.Weekday != "" && a.Weekday() != wd {
+		if !sched.includesDay(a) {
 			continue
 		}
 		// same inteval as last update, move forward
 		if (last.Equal(a) || last.After(a)) && (last.Equal(b) || last.Before(b)) {
 			continue
 		}
-		if b.Before(now) {
+		if b.Before(now) || b.Before(last) {
 			continue
 		}
 
@@ -91,7 +126,28 @@ func (sched *Schedule) Next(last time.Time) (start, end time.Time) {
 	}
 }
 
+// Includes checks whether the given time is within one of the
+// windows of the schedule.
+func Includes(schedule []*Schedule, t time.Time) bool {
+	for _, sched := range schedule {
+		if !sched.includesDay(t) {
+			continue
+		}
+		a := time.Date(t.Year(), t.Month(), t.Day(), sched.Start.Hour, sched.Start.Minute, 0, 0, time.Local)
+		b := time.Date(t.Year(), t.Month(), t.Day(), sched.End.Hour, sched.End.Minute, 0, 0, time.Local)
+		if !t.Before(a) && !t.After(b) {
+			return true
+		}
+	}
+	return false
+}
+
 func randDur(dur time.Duration) time.Duration {
+	// windows that are shorter than the safety margin at their end
+	// leave no room to randomize
+	if dur <= 0 {
+		return 0
+	}
 	return time.Duration(rand.Int63n(int64(dur)))
 }
 
@@ -100,6 +156,9 @@ var (
 
 	// FIMXE: pass in as a parameter for next
 	maxDuration = 14 * 24 * time.Hour
+	// schedules that only run on the nth weekday of the month need
+	// to be allowed to wait for longer
+	maxMonthlyDuration = 5 * 7 * 24 * time.Hour
 )
 
 func init() {
@@ -107,11 +166,26 @@ func init() {
 }
 
 // Next will return the duration until a random time in the next
-// schedule window.
+// schedule window. The returned time is never outside of a window,
+// even if last is unset or longer ago than the maximum wait.
 func Next(schedule []*Schedule, last time.Time) time.Duration {
 	now := timeNow()
 
-	a := last.Add(maxDuration)
+	max := maxDuration
+	for _, sched := range schedule {
+		if sched.Week != 0 {
+			max = maxMonthlyDuration
+		}
+	}
+
+	// the last run is too long ago (or unknown) to matter, look for
+	// the next window starting with the ones of the last day
+	overdue := last.Before(now.Add(-max))
+	if overdue {
+		last = now.Add(-24 * time.Hour)
+	}
+
+	a := last.Add(max)
 	b := a.Add(1 * time.Hour)
 	for _, sched := range schedule {
 		start, end := sched.Next(last)
@@ -121,7 +195,13 @@ func Next(schedule []*Schedule, last time.Time) time.Duration {
 		}
 	}
 	if a.Before(now) {
-		return 0
+		// the window has already started, an overdue run
+		// happens right away
+		if overdue {
+			return 0
+		}
+		// otherwise randomize within what is left
+		a = now
 	}
 
 	when := a.Sub(now) + randDur(b.Add(-5*time.Minute).Sub(a))
@@ -139,24 +219,58 @@ var weekdayMap = map[string]int{
 	"sat": 6,
 }
 
-// parseWeekday gets an input like "mon@9:00-11:00" or "9:00-11:00"
-// and extracts the weekday of that schedule string (which can be
-// empty). It returns the remainder of the string, the weekday
-// and an error.
-func parseWeekday(s string) (weekday, rest string, err error) {
+// parseSingleWeekday parses a weekday like "mon", or "mon1" for the
+// first Monday of the month, and returns the weekday and the week.
+func parseSingleWeekday(s string) (weekday string, week int, err error) {
+	if len(s) == 4 && s[3] >= '1' && s[3] <= '5' {
+		week = int(s[3] - '0')
+		s = s[:3]
+	}
+	if _, ok := weekdayMap[s]; !ok {
+		return "", 0, fmt.Errorf("cannot parse %q", s)
+	}
+	return s, week, nil
+}
+
+// parseWeekday gets an input like "mon@9:00-11:00", "mon-fri@9:00-11:00",
+// "mon1@9:00-11:00" or "9:00-11:00" and extracts the weekday (or range of
+// weekdays, or nth weekday of the month) of that schedule string (which
+// can be empty). It returns the remainder of the string, the weekdays,
+// the week and an error.
+func parseWeekday(s string) (weekday, endWeekday string, week int, rest string, err error) {
 	if !strings.Contains(s, "@") {
-		return "", s, nil
+		return "", "", 0, s, nil
 	}
 	s = strings.ToLower(s)
 	l := strings.SplitN(s, "@", 2)
-	weekday = l[0]
-	_, ok := weekdayMap[weekday]
-	if !ok {
-		return "", "", fmt.Errorf(`cannot parse %q, want "mon", "tue", etc`, l[0])
-	}
 	rest = l[1]
 
-	return weekday, rest, nil
+	wrongWeekday := fmt.Errorf(`cannot parse %q, want "mon", "tue", etc`, l[0])
+	days := strings.Split(l[0], "-")
+	switch len(days) {
+	case 1:
+		weekday, week, err = parseSingleWeekday(days[0])
+		if err != nil {
+			return "", "", 0, "", wrongWeekday
+		}
+	case 2:
+		var startWeek, endWeek int
+		weekday, startWeek, err = parseSingleWeekday(days[0])
+		if err != nil {
+			return "", "", 0, "", wrongWeekday
+		}
+		endWeekday, endWeek, err = parseSingleWeekday(days[1])
+		if err != nil {
+			return "", "", 0, "", wrongWeekday
+		}
+		if startWeek != 0 || endWeek != 0 {
+			return "", "", 0, "", fmt.Errorf("cannot parse %q: week number not allowed in a range of weekdays", l[0])
+		}
+	default:
+		return "", "", 0, "", wrongWeekday
+	}
+
+	return weekday, endWeekday, week, rest, nil
 }
 
 // parseTimeInterval gets an input like "9:00-11:00"
@@ -179,7 +293,7 @@ func parseTimeInterval(s string) (start, end TimeOfDay, err error) {
 	if err != nil {
 		return start, end, fmt.Errorf("cannot parse %q: not a valid time", l[1])
 	}
-	if !(start.Hour <= end.Hour && start.Minute <= end.Minute) {
+	if start.Hour*60+start.Minute > end.Hour*60+end.Minute {
 		return start, end, fmt.Errorf("cannot parse %q: time in an interval cannot go backwards", s)
 	}
 
@@ -189,7 +303,7 @@ func parseTimeInterval(s string) (start, end TimeOfDay, err error) {
 // parseSingleSchedule parses a schedule string like "mon@9:00-11:00" or
 // "9:00-11:00" and returns a Schedule struct and an error.
 func parseSingleSchedule(s string) (*Schedule, error) {
-	weekday, rest, err := parseWeekday(s)
+	weekday, endWeekday, week, rest, err := parseWeekday(s)
 	if err != nil {
 		return nil, err
 	}
@@ -199,9 +313,11 @@ func parseSingleSchedule(s string) (*Schedule, error) {
 	}
 
 	return &Schedule{
-		Weekday: weekday,
-		Start:   start,
-		End:     end,
+		Weekday:    weekday,
+		EndWeekday: endWeekday,
+		Week:       week,
+		Start:      start,
+		End:        end,
 	}, nil
 }
 
@@ -212,6 +328,10 @@ func parseSingleSchedule(s string) (*Schedule, error) {
 // thu@9:00-15:00 (only Thursday between 9am and 3pm)
 // fri@9:00-11:00/mon@13:00-15:00 (only Friday between 9am and 3pm and Monday between 1pm and 3pm)
 // fri@9:00-11:00/13:00-15:00  (only Friday between 9am and 3pm and every day between 1pm and 3pm)
+// mon-fri@9:00-11:00 (Monday to Friday between 9am and 11am)
+// sat-sun@0:00-23:59 (only on weekends)
+// mon1@9:00-11:00 (the first Monday of the month between 9am and 11am)
+// fri5@18:00-20:00 (the last Friday of the month between 6pm and 8pm)
 //
 // and returns a list of Schedule types or an error
 func ParseSchedule(scheduleSpec string) ([]*Schedule, error) {
@@ -75,11 +75,19 @@ func (ts *timeutilSuite) TestParseSchedule(c *C) {
 		{"23:00-01:00", nil, `cannot parse "23:00-01:00": time in an interval cannot go backwards`},
 		// FIXME: error message sucks
 		{"9:00-mon@11:00", nil, `cannot parse "9:00-mon", want "mon", "tue", etc`},
+		{"mon-@9:00-11:00", nil, `cannot parse "mon-", want "mon", "tue", etc`},
+		{"mon-tue-wed@9:00-11:00", nil, `cannot parse "mon-tue-wed", want "mon", "tue", etc`},
+		{"mon6@9:00-11:00", nil, `cannot parse "mon6", want "mon", "tue", etc`},
+		{"mon1-fri@9:00-11:00", nil, `cannot parse "mon1-fri": week number not allowed in a range of weekdays`},
 
 		// valid
 		{"9:00-11:00", []*timeutil.Schedule{{Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}}, ""},
 		{"mon@9:00-11:00", []*timeutil.Schedule{{Weekday: "mon", Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}}, ""},
 		{"9:00-11:00/20:00-22:00", []*timeutil.Schedule{{Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}, {Start: timeutil.TimeOfDay{Hour: 20}, End: timeutil.TimeOfDay{Hour: 22}}}, ""},
+		{"9:30-10:15", []*timeutil.Schedule{{Start: timeutil.TimeOfDay{Hour: 9, Minute: 30}, End: timeutil.TimeOfDay{Hour: 10, Minute: 15}}}, ""},
+		{"mon-fri@9:00-11:00", []*timeutil.Schedule{{Weekday: "mon", EndWeekday: "fri", Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}}, ""},
+		{"Fri-Mon@9:00-11:00", []*timeutil.Schedule{{Weekday: "fri", EndWeekday: "mon", Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}}, ""},
+		{"mon1@9:00-11:00/fri5@9:00-11:00", []*timeutil.Schedule{{Weekday: "mon", Week: 1, Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}, {Weekday: "fri", Week: 5, Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}}, ""},
 		{"mon@9:00-11:00/Wed@22:00-23:00", []*timeutil.Schedule{{Weekday: "mon", Start: timeutil.TimeOfDay{Hour: 9}, End: timeutil.TimeOfDay{Hour: 11}}, {Weekday: "wed", Start: timeutil.TimeOfDay{Hour: 22}, End: timeutil.TimeOfDay{Hour: 23}}}, ""},
 	} {
 		schedule, err := timeutil.ParseSchedule(t.in)
@@ -206,14 +214,80 @@ func (ts *timeutilSuite) TestScheduleNext(c *C) {
 			now:      "2017-02-06 5:00",
 			next:     "4h-6h",
 		},
+		{
+			// weekday range, next window on monday
+			// (2017-02-04 is a saturday)
+			schedule: "mon-fri@9:00-11:00",
+			last:     "2017-02-03 10:00",
+			now:      "2017-02-04 12:00",
+			next:     "45h-47h",
+		},
+		{
+			// weekday range wrapping around the end of the week
+			// (2017-02-06 is a monday)
+			schedule: "sat-mon@9:00-11:00",
+			last:     "2017-02-06 10:00",
+			now:      "2017-02-06 12:00",
+			// 5*24h - 3h
+			next: "117h-119h",
+		},
+		{
+			// first monday of the month
+			// (2017-03-06 is the first monday of march)
+			schedule: "mon1@9:00-11:00",
+			last:     "2017-02-06 10:00",
+			now:      "2017-02-06 12:00",
+			// 28*24h - 3h
+			next: "669h-671h",
+		},
+		{
+			// last friday of the month
+			// (2017-02-24 is the last friday of february)
+			schedule: "fri5@9:00-11:00",
+			last:     "2017-01-27 10:00",
+			now:      "2017-02-06 12:00",
+			// 18*24h - 3h
+			next: "429h-431h",
+		},
 		{
 			// weekly schedule, missed weekly window
 			// by more than 14 days
+			// -> still wait for the next window
 			schedule: "mon@9:00-11:00",
 			last:     "2017-01-01 10:00",
 			now:      "2017-02-06 12:00",
+			// 7*24h - 3h
+			next: "165h-167h",
+		},
+		{
+			// never refreshed, now is within the window
+			schedule: "9:00-11:00",
+			last:     "0001-01-01 00:00",
+			now:      "2017-02-06 10:00",
 			next:     "0s-0s",
 		},
+		{
+			// never refreshed, now is outside of the window
+			schedule: "9:00-11:00",
+			last:     "0001-01-01 00:00",
+			now:      "2017-02-06 12:00",
+			next:     "21h-23h",
+		},
+		{
+			// window shorter than the safety margin
+			schedule: "9:00-9:03",
+			last:     "2017-02-05 09:01",
+			now:      "2017-02-06 08:00",
+			next:     "1h-1h",
+		},
+		{
+			// last is in the future (e.g. a held refresh), skip
+			// the windows that end before it
+			schedule: "9:00-11:00/21:00-23:00",
+			last:     "2017-02-06 15:00",
+			now:      "2017-02-06 08:00",
+			next:     "13h-15h",
+		},
 	} {
 		last, err := time.ParseInLocation(shortForm, t.last, time.Local)
 		c.Assert(err, IsNil)
@@ -234,3 +308,27 @@ func (ts *timeutilSuite) TestScheduleNext(c *C) {
 	}
 
 }
+
+func (ts *timeutilSuite) TestIncludes(c *C) {
+	const shortForm = "2006-01-02 15:04"
+
+	for _, t := range []struct {
+		schedule string
+		now      string
+		included bool
+	}{
+		{"9:00-11:00", "2017-02-06 10:00", true},
+		{"9:00-11:00", "2017-02-06 11:00", true},
+		{"9:00-11:00", "2017-02-06 12:00", false},
+		{"9:00-11:00/21:00-23:00", "2017-02-06 22:00", true},
+		// 2017-02-06 is a monday
+		{"mon@9:00-11:00", "2017-02-06 10:00", true},
+		{"tue@9:00-11:00", "2017-02-06 10:00", false},
+	} {
+		now, err := time.ParseInLocation(shortForm, t.now, time.Local)
+		c.Assert(err, IsNil)
+		sched, err := timeutil.ParseSchedule(t.schedule)
+		c.Assert(err, IsNil)
+		c.Check(timeutil.Includes(sched, now), Equals, t.included, Commentf("%q at %q", t.schedule, t.now))
+	}
+}
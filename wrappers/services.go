@@ -104,6 +104,23 @@ func AddSnapServices(s *snap.Info, inter interacter) error {
 	return nil
 }
 
+func stopService(sysd systemd.Systemd, app *snap.AppInfo, inter interacter) error {
+	serviceName := app.ServiceName()
+	tout := serviceStopTimeout(app)
+	if err := sysd.Stop(serviceName, tout); err != nil {
+		if !systemd.IsTimeout(err) {
+			return err
+		}
+		inter.Notify(fmt.Sprintf("%s refused to stop, killing.", serviceName))
+		// ignore errors for kill; nothing we'd do differently at this point
+		sysd.Kill(serviceName, "TERM")
+		time.Sleep(killWait)
+		sysd.Kill(serviceName, "KILL")
+	}
+
+	return nil
+}
+
 // StopSnapServices stops service units for the applications from the snap which are services.
 func StopSnapServices(s *snap.Info, inter interacter) error {
 	sysd := systemd.New(dirs.GlobalRootDir, inter)
@@ -114,22 +131,75 @@ func StopSnapServices(s *snap.Info, inter interacter) error {
 		if app.Daemon == "" || !osutil.FileExists(app.ServiceFile()) {
 			continue
 		}
-		serviceName := filepath.Base(app.ServiceFile())
-		tout := serviceStopTimeout(app)
-		if err := sysd.Stop(serviceName, tout); err != nil {
-			if !systemd.IsTimeout(err) {
+		if err := stopService(sysd, app, inter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartServices starts the given service applications, enabling them
+// first if enable is set.
+func StartServices(apps []*snap.AppInfo, enable bool, inter interacter) error {
+	sysd := systemd.New(dirs.GlobalRootDir, inter)
+
+	for _, app := range apps {
+		if !app.IsService() {
+			continue
+		}
+		if enable {
+			if err := sysd.Enable(app.ServiceName()); err != nil {
 				return err
 			}
-			inter.Notify(fmt.Sprintf("%s refused to stop, killing.", serviceName))
-			// ignore errors for kill; nothing we'd do differently at this point
-			sysd.Kill(serviceName, "TERM")
-			time.Sleep(killWait)
-			sysd.Kill(serviceName, "KILL")
+		}
+		if err := sysd.Start(app.ServiceName()); err != nil {
+			return err
 		}
 	}
 
 	return nil
+}
+
+// StopServices stops the given service applications, disabling them
+// afterwards if disable is set.
+func StopServices(apps []*snap.AppInfo, disable bool, inter interacter) error {
+	sysd := systemd.New(dirs.GlobalRootDir, inter)
 
+	for _, app := range apps {
+		if !app.IsService() {
+			continue
+		}
+		if err := stopService(sysd, app, inter); err != nil {
+			return err
+		}
+		if disable {
+			if err := sysd.Disable(app.ServiceName()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RestartServices restarts the given service applications.
+func RestartServices(apps []*snap.AppInfo, inter interacter) error {
+	sysd := systemd.New(dirs.GlobalRootDir, inter)
+
+	for _, app := range apps {
+		if !app.IsService() {
+			continue
+		}
+		if err := stopService(sysd, app, inter); err != nil {
+			return err
+		}
+		if err := sysd.Start(app.ServiceName()); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // RemoveSnapServices disables and removes service units for the applications from the snap which are services.
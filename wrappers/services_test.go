@@ -159,3 +159,68 @@ func (s *servicesTestSuite) TestStartSnapServices(c *C) {
 	c.Check(sysdLog[1], DeepEquals, []string{"--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)})
 	c.Check(sysdLog[2], DeepEquals, []string{"start", filepath.Base(svcFile)})
 }
+
+func (s *servicesTestSuite) TestStartServices(c *C) {
+	var sysdLog [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	info := snaptest.MockSnap(c, packageHello, contentsHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+	apps := []*snap.AppInfo{info.Apps["hello"], info.Apps["svc1"]}
+
+	err := wrappers.StartServices(apps, false, nil)
+	c.Assert(err, IsNil)
+	c.Check(sysdLog, DeepEquals, [][]string{
+		{"start", filepath.Base(svcFile)},
+	})
+
+	sysdLog = nil
+	err = wrappers.StartServices(apps, true, nil)
+	c.Assert(err, IsNil)
+	c.Check(sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)},
+		{"start", filepath.Base(svcFile)},
+	})
+}
+
+func (s *servicesTestSuite) TestStopServices(c *C) {
+	var sysdLog [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	info := snaptest.MockSnap(c, packageHello, contentsHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+	apps := []*snap.AppInfo{info.Apps["hello"], info.Apps["svc1"]}
+
+	err := wrappers.StopServices(apps, true, &progress.NullProgress{})
+	c.Assert(err, IsNil)
+	c.Check(sysdLog, DeepEquals, [][]string{
+		{"stop", filepath.Base(svcFile)},
+		{"show", "--property=ActiveState", filepath.Base(svcFile)},
+		{"--root", dirs.GlobalRootDir, "disable", filepath.Base(svcFile)},
+	})
+}
+
+func (s *servicesTestSuite) TestRestartServices(c *C) {
+	var sysdLog [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	info := snaptest.MockSnap(c, packageHello, contentsHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	err := wrappers.RestartServices([]*snap.AppInfo{info.Apps["svc1"]}, &progress.NullProgress{})
+	c.Assert(err, IsNil)
+	c.Check(sysdLog, DeepEquals, [][]string{
+		{"stop", filepath.Base(svcFile)},
+		{"show", "--property=ActiveState", filepath.Base(svcFile)},
+		{"start", filepath.Base(svcFile)},
+	})
+}